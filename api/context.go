@@ -16,10 +16,15 @@ const (
 	CtxGetUsers     ErrorContext = "ctxGetUsers"
 	CtxGetUser      ErrorContext = "ctxGetUser"
 	CtxLoginUser    ErrorContext = "ctxLoginUser"
+	CtxRefreshToken ErrorContext = "ctxRefreshToken"
+	CtxLogoutUser   ErrorContext = "ctxLogoutUser"
+	CtxGetSessions  ErrorContext = "ctxGetSessions"
+	CtxLogoutOthers ErrorContext = "ctxLogoutOthers"
 	CtxCreateUser   ErrorContext = "ctxCreateUser"
 	CtxUpdateUser   ErrorContext = "ctxUpdateUser"
 	CtxDepositMoney ErrorContext = "ctxDepositMoney"
 	CtxBuyProduct   ErrorContext = "ctxBuyProduct"
+	CtxCheckout     ErrorContext = "ctxCheckout"
 	CtxResetDeposit ErrorContext = "ctxResetDeposit"
 	CtxDeleteUser   ErrorContext = "ctxDeleteUser"
 )
@@ -27,11 +32,87 @@ const (
 // Product error contexts
 const (
 	CtxGetProducts   ErrorContext = "ctxGetProducts"
+	CtxSearchProduct ErrorContext = "ctxSearchProduct"
 	CtxGetProduct    ErrorContext = "ctxGetProduct"
 	CtxLoginProduct  ErrorContext = "ctxLoginProduct"
 	CtxCreateProduct ErrorContext = "ctxCreateProduct"
 	CtxUpdateProduct ErrorContext = "ctxUpdateProduct"
 	CtxDeleteProduct ErrorContext = "ctxDeleteProduct"
+
+	CtxGetProductPrices     ErrorContext = "ctxGetProductPrices"
+	CtxScheduleProductPrice ErrorContext = "ctxScheduleProductPrice"
+	CtxCancelProductPrice   ErrorContext = "ctxCancelProductPrice"
+)
+
+// Category error contexts
+const (
+	CtxGetCategories  ErrorContext = "ctxGetCategories"
+	CtxGetCategory    ErrorContext = "ctxGetCategory"
+	CtxCreateCategory ErrorContext = "ctxCreateCategory"
+	CtxUpdateCategory ErrorContext = "ctxUpdateCategory"
+	CtxDeleteCategory ErrorContext = "ctxDeleteCategory"
+)
+
+// Promotion error contexts
+const (
+	CtxGetPromotions   ErrorContext = "ctxGetPromotions"
+	CtxGetPromotion    ErrorContext = "ctxGetPromotion"
+	CtxCreatePromotion ErrorContext = "ctxCreatePromotion"
+	CtxUpdatePromotion ErrorContext = "ctxUpdatePromotion"
+	CtxDeletePromotion ErrorContext = "ctxDeletePromotion"
+)
+
+// Purchase error contexts
+const (
+	CtxGetPurchases     ErrorContext = "ctxGetPurchases"
+	CtxRefundPurchase   ErrorContext = "ctxRefundPurchase"
+	CtxDispensePurchase ErrorContext = "ctxDispensePurchase"
+	CtxConfirmPurchase  ErrorContext = "ctxConfirmPurchase"
+	CtxFailPurchase     ErrorContext = "ctxFailPurchase"
+)
+
+// Account error contexts
+const (
+	CtxGetRevenue ErrorContext = "ctxGetRevenue"
+	CtxReconcile  ErrorContext = "ctxReconcile"
+)
+
+// Payout error contexts
+const (
+	CtxGetPayouts         ErrorContext = "ctxGetPayouts"
+	CtxGetPayout          ErrorContext = "ctxGetPayout"
+	CtxGetPayoutStatement ErrorContext = "ctxGetPayoutStatement"
+	CtxRequestPayout      ErrorContext = "ctxRequestPayout"
+	CtxApprovePayout      ErrorContext = "ctxApprovePayout"
+	CtxRejectPayout       ErrorContext = "ctxRejectPayout"
+)
+
+// Admin error contexts
+const (
+	CtxDisableUser    ErrorContext = "ctxDisableUser"
+	CtxEnableUser     ErrorContext = "ctxEnableUser"
+	CtxUpdateUserRole ErrorContext = "ctxUpdateUserRole"
+	CtxGetSalesReport ErrorContext = "ctxGetSalesReport"
+)
+
+// Machine error contexts
+const (
+	CtxGetMachines   ErrorContext = "ctxGetMachines"
+	CtxGetMachine    ErrorContext = "ctxGetMachine"
+	CtxCreateMachine ErrorContext = "ctxCreateMachine"
+	CtxAssignSlot    ErrorContext = "ctxAssignSlot"
+)
+
+// Coin inventory error contexts
+const (
+	CtxGetCoinInventory ErrorContext = "ctxGetCoinInventory"
+	CtxRefillCoins      ErrorContext = "ctxRefillCoins"
+)
+
+// Sync error contexts
+const (
+	CtxPushSyncBatch    ErrorContext = "ctxPushSyncBatch"
+	CtxGetSyncCatalogue ErrorContext = "ctxGetSyncCatalogue"
 )
 
 // Serializer error contexts
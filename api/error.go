@@ -42,27 +42,121 @@ var (
 	ErrCreatePayload           = NewResponseError("errCreatePayload", "unable to generate response payload")
 
 	// Auth errors
-	ErrInvalidAuth    = NewResponseError("errInvalidAuth", "invalid authorization", http.StatusUnauthorized)
-	ErrUserForbidden  = NewResponseError("errUserForbidden", "user is not permitted", http.StatusForbidden)
-	ErrCreateUserAuth = NewResponseError("errCreateUserAuth", "unable to authorize user")
+	ErrInvalidAuth         = NewResponseError("errInvalidAuth", "invalid authorization", http.StatusUnauthorized)
+	ErrUserForbidden       = NewResponseError("errUserForbidden", "user is not permitted", http.StatusForbidden)
+	ErrCreateUserAuth      = NewResponseError("errCreateUserAuth", "unable to authorize user")
+	ErrRefreshToken        = NewResponseError("errRefreshToken", "unable to refresh token")
+	ErrInvalidRefreshToken = NewResponseError("errInvalidRefreshToken", "refresh token is invalid or expired", http.StatusUnauthorized)
 
 	// User errors
 	ErrUserNotFound = NewResponseError("errUserNotFound", "unable to find user", http.StatusNotFound)
 	ErrGetUsers     = NewResponseError("errFindUser", "unable to get users")
 	ErrGetUser      = NewResponseError("errFindUser", "unable to get user")
 	ErrLoginUser    = NewResponseError("errLoginUser", "unable to login user")
+	ErrLogoutUser   = NewResponseError("errLogoutUser", "unable to logout user")
+	ErrGetSessions  = NewResponseError("errGetSessions", "unable to get sessions")
 	ErrCreateUser   = NewResponseError("errCreateUser", "unable to register user")
 	ErrUpdateUser   = NewResponseError("errUpdateUser", "unable to update user")
 	ErrDepositMoney = NewResponseError("errDepositMoney", "unable to update user deposit")
 	ErrResetDeposit = NewResponseError("errResetDeposit", "unable to reset user deposit")
 	ErrDeleteUser   = NewResponseError("errDeleteUser", "unable to delete user")
 	ErrBuyProduct   = NewResponseError("errBuyProduct", "unable to buy product")
+	ErrCheckout     = NewResponseError("errCheckout", "unable to checkout")
+
+	ErrUserDisabled = NewResponseError("errUserDisabled", "user is disabled", http.StatusForbidden)
+
+	ErrUserHasPurchases = NewResponseError("errUserHasPurchases", "user has purchases", http.StatusConflict)
+
+	ErrDepositHeldByAnotherMachine = NewResponseError("errDepositHeldByAnotherMachine", "deposit is held by another machine", http.StatusConflict)
+
+	// Admin errors
+	ErrDisableUser    = NewResponseError("errDisableUser", "unable to disable user")
+	ErrEnableUser     = NewResponseError("errEnableUser", "unable to enable user")
+	ErrUpdateUserRole = NewResponseError("errUpdateUserRole", "unable to update user role")
+	ErrGetSalesReport = NewResponseError("errGetSalesReport", "unable to get sales report")
+
+	// Machine errors
+	ErrMachineNotFound = NewResponseError("errMachineNotFound", "unable to find machine", http.StatusNotFound)
+	ErrGetMachines     = NewResponseError("errGetMachines", "unable to get machines")
+	ErrGetMachine      = NewResponseError("errGetMachine", "unable to get machine")
+	ErrCreateMachine   = NewResponseError("errCreateMachine", "unable to create machine")
+	ErrAssignSlot      = NewResponseError("errAssignSlot", "unable to assign slot")
+
+	// Idempotency errors
+	ErrIdempotencyKey           = NewResponseError("errIdempotencyKey", "unable to process idempotency key")
+	ErrIdempotencyKeyReused     = NewResponseError("errIdempotencyKeyReused", "idempotency key was already used for a different request", http.StatusConflict)
+	ErrIdempotencyKeyInProgress = NewResponseError("errIdempotencyKeyInProgress", "a request with this idempotency key is still in progress", http.StatusConflict)
+
+	// Coin inventory errors
+	ErrExactChangeOnly  = NewResponseError("errExactChangeOnly", "exact change only", http.StatusConflict)
+	ErrGetCoinInventory = NewResponseError("errGetCoinInventory", "unable to get coin inventory")
+	ErrRefillCoins      = NewResponseError("errRefillCoins", "unable to refill coins")
 
 	// Product errors
 	ErrProductNotFound = NewResponseError("errProductNotFound", "unable to find user", http.StatusNotFound)
 	ErrGetProducts     = NewResponseError("errFindProduct", "unable to get users")
+	ErrSearchProducts  = NewResponseError("errSearchProducts", "unable to search products")
 	ErrGetProduct      = NewResponseError("errFindProduct", "unable to get user")
 	ErrCreateProduct   = NewResponseError("errCreateProduct", "unable to register user")
 	ErrUpdateProduct   = NewResponseError("errUpdateProduct", "unable to update user")
 	ErrDeleteProduct   = NewResponseError("errDeleteProduct", "unable to delete user")
+
+	ErrProductHasPurchases = NewResponseError("errProductHasPurchases", "product has purchases", http.StatusConflict)
+
+	ErrPriceNotFound        = NewResponseError("errPriceNotFound", "unable to find price", http.StatusNotFound)
+	ErrPriceNotScheduled    = NewResponseError("errPriceNotScheduled", "price is already effective", http.StatusConflict)
+	ErrGetProductPrices     = NewResponseError("errGetProductPrices", "unable to get product prices")
+	ErrScheduleProductPrice = NewResponseError("errScheduleProductPrice", "unable to schedule product price")
+	ErrCancelProductPrice   = NewResponseError("errCancelProductPrice", "unable to cancel product price")
+
+	// Category errors
+	ErrCategoryNotFound    = NewResponseError("errCategoryNotFound", "unable to find category", http.StatusNotFound)
+	ErrCategoryExists      = NewResponseError("errCategoryExists", "category with that name already exists", http.StatusConflict)
+	ErrCategoryHasChildren = NewResponseError("errCategoryHasChildren", "category has subcategories", http.StatusConflict)
+	ErrGetCategories       = NewResponseError("errGetCategories", "unable to get categories")
+	ErrGetCategory         = NewResponseError("errGetCategory", "unable to get category")
+	ErrCreateCategory      = NewResponseError("errCreateCategory", "unable to create category")
+	ErrUpdateCategory      = NewResponseError("errUpdateCategory", "unable to update category")
+	ErrDeleteCategory      = NewResponseError("errDeleteCategory", "unable to delete category")
+
+	// Promotion errors
+	ErrPromotionNotFound = NewResponseError("errPromotionNotFound", "unable to find promotion", http.StatusNotFound)
+	ErrGetPromotions     = NewResponseError("errGetPromotions", "unable to get promotions")
+	ErrGetPromotion      = NewResponseError("errGetPromotion", "unable to get promotion")
+	ErrCreatePromotion   = NewResponseError("errCreatePromotion", "unable to create promotion")
+	ErrUpdatePromotion   = NewResponseError("errUpdatePromotion", "unable to update promotion")
+	ErrDeletePromotion   = NewResponseError("errDeletePromotion", "unable to delete promotion")
+
+	// Purchase errors
+	ErrPurchaseNotFound    = NewResponseError("errPurchaseNotFound", "unable to find purchase", http.StatusNotFound)
+	ErrPurchaseRefunded    = NewResponseError("errPurchaseRefunded", "purchase is already refunded", http.StatusConflict)
+	ErrRefundWindowExpired = NewResponseError("errRefundWindowExpired", "refund window has expired", http.StatusForbidden)
+	ErrGetPurchases        = NewResponseError("errGetPurchases", "unable to get purchases")
+	ErrRefundPurchase      = NewResponseError("errRefundPurchase", "unable to refund purchase")
+	ErrPurchaseTransition  = NewResponseError("errPurchaseTransition", "purchase cannot move to the requested status", http.StatusConflict)
+	ErrDispensePurchase    = NewResponseError("errDispensePurchase", "unable to dispense purchase")
+	ErrConfirmPurchase     = NewResponseError("errConfirmPurchase", "unable to confirm purchase")
+	ErrFailPurchase        = NewResponseError("errFailPurchase", "unable to fail purchase")
+
+	// Account errors
+	ErrGetRevenue = NewResponseError("errGetRevenue", "unable to get revenue")
+	ErrReconcile  = NewResponseError("errReconcile", "unable to reconcile accounts")
+
+	// Payout errors
+	ErrPayoutNotFound     = NewResponseError("errPayoutNotFound", "unable to find payout", http.StatusNotFound)
+	ErrPayoutPending      = NewResponseError("errPayoutPending", "a payout is already waiting for approval", http.StatusConflict)
+	ErrNothingToPayOut    = NewResponseError("errNothingToPayOut", "there is no revenue to pay out", http.StatusConflict)
+	ErrPayoutDecided      = NewResponseError("errPayoutDecided", "payout was already approved or rejected", http.StatusConflict)
+	ErrGetPayouts         = NewResponseError("errGetPayouts", "unable to get payouts")
+	ErrGetPayout          = NewResponseError("errGetPayout", "unable to get payout")
+	ErrGetPayoutStatement = NewResponseError("errGetPayoutStatement", "unable to get payout statement")
+	ErrRequestPayout      = NewResponseError("errRequestPayout", "unable to request payout")
+	ErrApprovePayout      = NewResponseError("errApprovePayout", "unable to approve payout")
+	ErrRejectPayout       = NewResponseError("errRejectPayout", "unable to reject payout")
+
+	// Sync errors
+	ErrSyncOutOfOrder   = NewResponseError("errSyncOutOfOrder", "event is not after the last event the machine synced", http.StatusConflict)
+	ErrSyncEventReused  = NewResponseError("errSyncEventReused", "event id was already synced differently", http.StatusConflict)
+	ErrPushSyncBatch    = NewResponseError("errPushSyncBatch", "unable to apply sync batch")
+	ErrGetSyncCatalogue = NewResponseError("errGetSyncCatalogue", "unable to get sync catalogue")
 )
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"sync"
 
 	"github.com/dhurimkelmendi/vending_machine/config"
 	"github.com/dhurimkelmendi/vending_machine/internal/trace"
@@ -17,18 +18,26 @@ type Responder struct {
 	cfg *config.Config
 }
 
-var responderDefaultInstance *Responder
+var (
+	responderDefaultInstance     *Responder
+	responderDefaultInstanceOnce sync.Once
+)
 
 // GetResponderDefaultInstance returns the default instance of Responder.
 func GetResponderDefaultInstance() *Responder {
-	if responderDefaultInstance == nil {
-		responderDefaultInstance = &Responder{
-			cfg: config.GetDefaultInstance(),
-		}
-	}
+	responderDefaultInstanceOnce.Do(func() {
+		responderDefaultInstance = NewResponder(config.GetDefaultInstance())
+	})
 	return responderDefaultInstance
 }
 
+// NewResponder creates a Responder that includes inner errors in responses as the given config specifies.
+func NewResponder(cfg *config.Config) *Responder {
+	return &Responder{
+		cfg: cfg,
+	}
+}
+
 type errorResponse struct {
 	Message    string  `json:"message"`
 	Context    string  `json:"context"`
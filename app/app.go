@@ -0,0 +1,86 @@
+// Package app builds the object graph of the application, from the database connections to the controllers, out of
+// a single config. Several apps with different configs can run side by side in the same process.
+package app
+
+import (
+	"sync"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/controllers"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+	"github.com/dhurimkelmendi/vending_machine/services"
+)
+
+// App is a struct that contains references to everything the application is built of
+type App struct {
+	Config      *config.Config
+	DB          *db.Database
+	Store       repositories.Store
+	Responder   *api.Responder
+	Policy      *auth.Policy
+	Stateless   *auth.StatelessAuthenticationProvider
+	Services    *services.Services
+	Controllers *controllers.Controllers
+}
+
+var (
+	defaultInstance     *App
+	defaultInstanceOnce sync.Once
+)
+
+// GetDefaultInstance returns the app of the default config. It is made of the default instances of the other
+// packages, so it shares its database, services and controllers with the GetXxxDefaultInstance functions
+func GetDefaultInstance() *App {
+	defaultInstanceOnce.Do(func() {
+		defaultInstance = &App{
+			Config:      config.GetDefaultInstance(),
+			DB:          db.GetDefaultInstance(),
+			Store:       repositories.GetStoreDefaultInstance(),
+			Responder:   api.GetResponderDefaultInstance(),
+			Policy:      auth.GetPolicyDefaultInstance(),
+			Stateless:   auth.GetStatelessAuthenticationProviderDefaultInstance(),
+			Services:    services.GetDefaultInstance(),
+			Controllers: controllers.GetControllersDefaultInstance(),
+		}
+	})
+	return defaultInstance
+}
+
+// New builds an app from the given config, with its own database connections, services and controllers
+func New(cfg *config.Config) (*App, error) {
+	database, err := db.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := auth.NewPolicyFromConfig(cfg)
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+	store := repositories.NewStore(database)
+	stateless, err := auth.NewStatelessAuthenticationProvider(cfg, store.RevokedTokens(), store.Sessions())
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	a := &App{
+		Config:    cfg,
+		DB:        database,
+		Store:     store,
+		Responder: api.NewResponder(cfg),
+		Policy:    policy,
+		Stateless: stateless,
+	}
+	a.Services = services.New(cfg, store, policy, stateless)
+	a.Controllers = controllers.New(a.Services, policy, stateless, a.Responder)
+	return a, nil
+}
+
+// Close closes the database connections of the app
+func (a *App) Close() error {
+	return a.DB.Close()
+}
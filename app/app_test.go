@@ -0,0 +1,78 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/app"
+	"github.com/dhurimkelmendi/vending_machine/change"
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/server"
+)
+
+// newApp builds an app from the environment config changed by configure. Postgres is only connected to once it is
+// used, so the app can be built without a database
+func newApp(t *testing.T, configure func(cfg *config.Config)) *app.App {
+	cfg := config.Load()
+	configure(cfg)
+	a, err := app.New(cfg)
+	if err != nil {
+		t.Fatalf("error while building app %+v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func TestApp(t *testing.T) {
+	t.Parallel()
+	euro := newApp(t, func(cfg *config.Config) {
+		cfg.CORSOrigins = "https://euro.example.com"
+		cfg.AcceptableDepositAmountValues = []int32{5, 10, 20, 50, 100}
+	})
+	quarter := newApp(t, func(cfg *config.Config) {
+		cfg.CORSOrigins = "https://quarter.example.com"
+		cfg.AcceptableDepositAmountValues = []int32{25, 50}
+	})
+
+	t.Run("apps keep their own services", func(t *testing.T) {
+		if euro.Services == quarter.Services || euro.Services.Users == quarter.Services.Users {
+			t.Fatalf("expected each app to build its own services")
+		}
+		euroChange, err := euro.Services.UserProducts.CreateChangeRepresentation(75)
+		if err != nil {
+			t.Fatalf("error while making change %+v", err)
+		}
+		if !euroChange.Equals(change.Coins{50: 1, 20: 1, 5: 1}) {
+			t.Fatalf("expected change in the coins of the first app, got: %+v", euroChange)
+		}
+		quarterChange, err := quarter.Services.UserProducts.CreateChangeRepresentation(75)
+		if err != nil {
+			t.Fatalf("error while making change %+v", err)
+		}
+		if !quarterChange.Equals(change.Coins{50: 1, 25: 1}) {
+			t.Fatalf("expected change in the coins of the second app, got: %+v", quarterChange)
+		}
+	})
+
+	t.Run("handlers follow the config of their app", func(t *testing.T) {
+		handlers := map[string]http.Handler{
+			"https://euro.example.com":    server.New(euro),
+			"https://quarter.example.com": server.New(quarter),
+		}
+		for origin, handler := range handlers {
+			for otherOrigin := range handlers {
+				req := httptest.NewRequest(http.MethodOptions, "/public/api/v1/users", nil)
+				req.Header.Set("Origin", otherOrigin)
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				res := httptest.NewRecorder()
+				handler.ServeHTTP(res, req)
+
+				allowed := res.Header().Get("Access-Control-Allow-Origin") == otherOrigin
+				if allowed != (origin == otherOrigin) {
+					t.Fatalf("expected the handler of %s to allow only its own origin, allowed %s: %v", origin, otherOrigin, allowed)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,6 @@
+package auth
+
+// TokenDenylist tells whether an access token was revoked before it expired
+type TokenDenylist interface {
+	IsRevoked(jti string) (bool, error)
+}
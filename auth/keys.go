@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"os"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+// SigningKeys holds the key tokens are signed with, and every key tokens are accepted from.
+// Each key has a `kid`, the thumbprint of the key, which is put in the header of the tokens it signs
+// so that the matching verification key can be found
+type SigningKeys struct {
+	signingKey       jwk.Key
+	verificationKeys jwk.Set
+}
+
+// NewHMACSigningKeys creates SigningKeys signing and verifying tokens with HS256 and the supplied secret
+func NewHMACSigningKeys(secret []byte) (*SigningKeys, error) {
+	key, err := newSigningKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKeys(key)
+}
+
+// LoadSigningKeys creates SigningKeys signing tokens with the PEM encoded private key in privateKeyFile.
+// Tokens signed by the private key of any of the PEM encoded public keys in verificationKeyFiles are accepted too
+func LoadSigningKeys(privateKeyFile string, verificationKeyFiles []string) (*SigningKeys, error) {
+	signingKey, err := loadKey(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := signingKey.(jwk.PublicKeyer); !ok || signingKey.KeyType() == "oct" {
+		return nil, fmt.Errorf("%s: not an asymmetric private key", privateKeyFile)
+	}
+
+	verificationKeys := make([]jwk.Key, 0, len(verificationKeyFiles))
+	for _, file := range verificationKeyFiles {
+		key, err := loadKey(file)
+		if err != nil {
+			return nil, err
+		}
+		if key, err = jwk.PublicKeyOf(key); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+
+	return newSigningKeys(signingKey, verificationKeys...)
+}
+
+func newSigningKeys(signingKey jwk.Key, verificationKeys ...jwk.Key) (*SigningKeys, error) {
+	publicKey := signingKey
+	if signingKey.KeyType() != "oct" {
+		var err error
+		if publicKey, err = jwk.PublicKeyOf(signingKey); err != nil {
+			return nil, err
+		}
+	}
+
+	keySet := jwk.NewSet()
+	keySet.Add(publicKey)
+	for _, key := range verificationKeys {
+		keySet.Add(key)
+	}
+
+	return &SigningKeys{
+		signingKey:       signingKey,
+		verificationKeys: keySet,
+	}, nil
+}
+
+// Sign creates a signed token with the given claims, with the `kid` of the signing key in its header
+func (k *SigningKeys) Sign(claims map[string]interface{}) (jwt.Token, string, error) {
+	token := jwt.New()
+	for name, value := range claims {
+		if err := token.Set(name, value); err != nil {
+			return nil, "", err
+		}
+	}
+
+	signed, err := jwt.Sign(token, jwa.SignatureAlgorithm(k.signingKey.Algorithm()), k.signingKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return token, string(signed), nil
+}
+
+// Verify parses the token, checking its signature with the verification key matching its `kid` and
+// the algorithm of that key, then validates its claims
+func (k *SigningKeys) Verify(tokenString string) (jwt.Token, error) {
+	return jwt.ParseString(tokenString, jwt.WithKeySet(k.verificationKeys), jwt.WithValidate(true))
+}
+
+// PublicKeys returns the public keys tokens are verified with, for clients verifying tokens themselves.
+// It is empty when tokens are signed with a shared secret
+func (k *SigningKeys) PublicKeys() jwk.Set {
+	publicKeys := jwk.NewSet()
+	for i := 0; i < k.verificationKeys.Len(); i++ {
+		key, _ := k.verificationKeys.Get(i)
+		if key.KeyType() != "oct" {
+			publicKeys.Add(key)
+		}
+	}
+	return publicKeys
+}
+
+// loadKey reads a PEM encoded key from the file
+func loadKey(file string) (jwk.Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwk.ParseKey(data, jwk.WithPEM(true))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	key, err = newSigningKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return key, nil
+}
+
+// newSigningKey creates a jwk.Key of the raw key, with its algorithm and its thumbprint as `kid`
+func newSigningKey(raw interface{}) (jwk.Key, error) {
+	algorithm, err := signatureAlgorithmOf(raw)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwk.New(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.AlgorithmKey, algorithm); err != nil {
+		return nil, err
+	}
+	if err := jwk.AssignKeyID(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// signatureAlgorithmOf returns the algorithm tokens are signed with for the type of the raw key
+func signatureAlgorithmOf(raw interface{}) (jwa.SignatureAlgorithm, error) {
+	switch key := raw.(type) {
+	case []byte:
+		return jwa.HS256, nil
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return jwa.RS256, nil
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return jwa.EdDSA, nil
+	case *ecdsa.PrivateKey:
+		return ecdsaAlgorithmOf(&key.PublicKey)
+	case *ecdsa.PublicKey:
+		return ecdsaAlgorithmOf(key)
+	default:
+		return "", fmt.Errorf("unsupported key type %T", raw)
+	}
+}
+
+func ecdsaAlgorithmOf(key *ecdsa.PublicKey) (jwa.SignatureAlgorithm, error) {
+	switch key.Curve.Params().BitSize {
+	case 256:
+		return jwa.ES256, nil
+	case 384:
+		return jwa.ES384, nil
+	case 521:
+		return jwa.ES512, nil
+	default:
+		return "", fmt.Errorf("unsupported elliptic curve %s", key.Curve.Params().Name)
+	}
+}
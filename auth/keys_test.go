@@ -0,0 +1,160 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jws"
+)
+
+// writeKeyPair writes the private key and its public key as PEM files, returning their paths
+func writeKeyPair(t *testing.T, name string, privateKey interface{}, publicKey interface{}) (string, string) {
+	dir := t.TempDir()
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("error encoding private key: %+v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("error encoding public key: %+v", err)
+	}
+
+	privateFile := filepath.Join(dir, name+".pem")
+	publicFile := filepath.Join(dir, name+".pub.pem")
+	if err := os.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		t.Fatalf("error writing private key: %+v", err)
+	}
+	if err := os.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0600); err != nil {
+		t.Fatalf("error writing public key: %+v", err)
+	}
+	return privateFile, publicFile
+}
+
+func signTestToken(t *testing.T, keys *auth.SigningKeys) string {
+	claims := map[string]interface{}{
+		"sub": "user",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	_, token, err := keys.Sign(claims)
+	if err != nil {
+		t.Fatalf("error signing token: %+v", err)
+	}
+	return token
+}
+
+func TestSigningKeys(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating rsa key: %+v", err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating ecdsa key: %+v", err)
+	}
+	ed25519PublicKey, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating ed25519 key: %+v", err)
+	}
+
+	rsaPrivateFile, rsaPublicFile := writeKeyPair(t, "rsa", rsaKey, &rsaKey.PublicKey)
+	ecdsaPrivateFile, _ := writeKeyPair(t, "ecdsa", ecdsaKey, &ecdsaKey.PublicKey)
+	ed25519PrivateFile, _ := writeKeyPair(t, "ed25519", ed25519Key, ed25519PublicKey)
+
+	algorithms := map[string]jwa.SignatureAlgorithm{
+		rsaPrivateFile:     jwa.RS256,
+		ecdsaPrivateFile:   jwa.ES256,
+		ed25519PrivateFile: jwa.EdDSA,
+	}
+	for privateFile, algorithm := range algorithms {
+		privateFile, algorithm := privateFile, algorithm
+		t.Run(string(algorithm), func(t *testing.T) {
+			keys, err := auth.LoadSigningKeys(privateFile, nil)
+			if err != nil {
+				t.Fatalf("error loading signing keys: %+v", err)
+			}
+			token := signTestToken(t, keys)
+
+			message, err := jws.ParseString(token)
+			if err != nil {
+				t.Fatalf("error parsing token: %+v", err)
+			}
+			headers := message.Signatures()[0].ProtectedHeaders()
+			if headers.Algorithm() != algorithm || headers.KeyID() == "" {
+				t.Fatalf("expected a %s token with a kid, got: %s, %q", algorithm, headers.Algorithm(), headers.KeyID())
+			}
+			if _, err := keys.Verify(token); err != nil {
+				t.Fatalf("error verifying token: %+v", err)
+			}
+			if keys.PublicKeys().Len() != 1 {
+				t.Fatalf("expected the public key to be published, got %d keys", keys.PublicKeys().Len())
+			}
+		})
+	}
+
+	t.Run("rotation", func(t *testing.T) {
+		previousKeys, err := auth.LoadSigningKeys(rsaPrivateFile, nil)
+		if err != nil {
+			t.Fatalf("error loading signing keys: %+v", err)
+		}
+		previousToken := signTestToken(t, previousKeys)
+
+		keys, err := auth.LoadSigningKeys(ecdsaPrivateFile, []string{rsaPublicFile})
+		if err != nil {
+			t.Fatalf("error loading signing keys: %+v", err)
+		}
+		if _, err := keys.Verify(previousToken); err != nil {
+			t.Fatalf("expected tokens of the previous key to be accepted, got: %+v", err)
+		}
+		if keys.PublicKeys().Len() != 2 {
+			t.Fatalf("expected both public keys to be published, got %d keys", keys.PublicKeys().Len())
+		}
+
+		ed25519Keys, err := auth.LoadSigningKeys(ed25519PrivateFile, nil)
+		if err != nil {
+			t.Fatalf("error loading signing keys: %+v", err)
+		}
+		if _, err := keys.Verify(signTestToken(t, ed25519Keys)); err == nil {
+			t.Fatalf("expected tokens of an unknown key to be refused")
+		}
+	})
+
+	t.Run("hmac", func(t *testing.T) {
+		keys, err := auth.NewHMACSigningKeys([]byte("secret"))
+		if err != nil {
+			t.Fatalf("error creating signing keys: %+v", err)
+		}
+		if _, err := keys.Verify(signTestToken(t, keys)); err != nil {
+			t.Fatalf("error verifying token: %+v", err)
+		}
+		if keys.PublicKeys().Len() != 0 {
+			t.Fatalf("expected the secret not to be published")
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		keys, err := auth.NewHMACSigningKeys([]byte("secret"))
+		if err != nil {
+			t.Fatalf("error creating signing keys: %+v", err)
+		}
+		_, token, err := keys.Sign(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})
+		if err != nil {
+			t.Fatalf("error signing token: %+v", err)
+		}
+		if _, err := keys.Verify(token); err == nil {
+			t.Fatalf("expected an expired token to be refused")
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Permission is an action that a role is allowed to take, e.g. `product:read`
+type Permission string
+
+// Permissions that are not tied to the owner of a resource
+const (
+	PermUserRead      Permission = "user:read"
+	PermUserManage    Permission = "user:manage"
+	PermDepositWrite  Permission = "deposit:write"
+	PermDepositReset  Permission = "deposit:reset"
+	PermProductRead   Permission = "product:read"
+	PermProductCreate Permission = "product:create"
+	PermProductBuy    Permission = "product:buy"
+	PermSaleRead      Permission = "sale:read"
+	PermMachineRead   Permission = "machine:read"
+	PermMachineCreate Permission = "machine:create"
+	PermReportRead    Permission = "report:read"
+	PermCategoryWrite Permission = "category:write"
+	PermSaleRefund    Permission = "sale:refund"
+	PermPayoutRequest Permission = "payout:request"
+	PermPayoutApprove Permission = "payout:approve"
+)
+
+// ScopedPermission is an action on a resource that is granted either for the resources the user owns,
+// as `<action>:own`, or for all resources, as `<action>:any`
+type ScopedPermission string
+
+// Permissions that are checked against the owner of a resource
+const (
+	PermUserWrite      ScopedPermission = "user:write"
+	PermProductWrite   ScopedPermission = "product:write"
+	PermPurchaseRead   ScopedPermission = "purchase:read"
+	PermMachineWrite   ScopedPermission = "machine:write"
+	PermPromotionWrite ScopedPermission = "promotion:write"
+	PermPurchaseRefund ScopedPermission = "purchase:refund"
+	PermPurchaseVend   ScopedPermission = "purchase:vend"
+	PermPayoutRead     ScopedPermission = "payout:read"
+)
+
+// Own returns the permission granting the action on resources owned by the user
+func (p ScopedPermission) Own() Permission {
+	return Permission(p + ":own")
+}
+
+// Any returns the permission granting the action on all resources
+func (p ScopedPermission) Any() Permission {
+	return Permission(p + ":any")
+}
+
+// KnownPermissions are all the permissions that can be granted to a role
+var KnownPermissions = knownPermissions()
+
+func knownPermissions() map[Permission]bool {
+	known := make(map[Permission]bool)
+	for _, permission := range []Permission{
+		PermUserRead, PermUserManage, PermDepositWrite, PermDepositReset, PermProductRead, PermProductCreate,
+		PermProductBuy, PermSaleRead, PermMachineRead, PermMachineCreate, PermReportRead, PermCategoryWrite,
+		PermSaleRefund, PermPayoutRequest, PermPayoutApprove,
+	} {
+		known[permission] = true
+	}
+	for _, permission := range []ScopedPermission{
+		PermUserWrite, PermProductWrite, PermPurchaseRead, PermMachineWrite, PermPromotionWrite,
+		PermPurchaseRefund, PermPurchaseVend, PermPayoutRead,
+	} {
+		known[permission.Own()] = true
+		known[permission.Any()] = true
+	}
+	return known
+}
+
+// DefaultRolePermissions are the permissions of the built in roles, roles configured with ROLE_PERMISSIONS
+// replace or extend these
+var DefaultRolePermissions = map[models.UserRole][]Permission{
+	models.UserRoleBuyer: {
+		PermUserRead, PermUserWrite.Own(),
+		PermDepositWrite, PermProductRead, PermProductBuy, PermPurchaseRead.Own(), PermPurchaseRefund.Own(), PermMachineRead,
+	},
+	models.UserRoleSeller: {
+		PermUserRead, PermUserWrite.Own(),
+		PermProductRead, PermProductCreate, PermProductWrite.Own(), PermSaleRead, PermSaleRefund,
+		PermMachineRead, PermMachineCreate, PermMachineWrite.Own(), PermPurchaseVend.Own(), PermPromotionWrite.Own(),
+		PermPayoutRequest, PermPayoutRead.Own(),
+	},
+	models.UserRoleAdmin: {
+		PermUserRead, PermUserWrite.Any(), PermUserManage, PermDepositReset,
+		PermProductRead, PermProductWrite.Any(), PermPurchaseRead.Any(), PermPurchaseRefund.Any(), PermReportRead,
+		PermMachineRead, PermCategoryWrite, PermPromotionWrite.Any(), PermPurchaseVend.Any(),
+		PermPayoutApprove, PermPayoutRead.Any(),
+	},
+}
+
+// Policy maps roles to the permissions they are granted
+type Policy struct {
+	permissions map[models.UserRole]map[Permission]bool
+}
+
+var (
+	policyDefaultInstance     *Policy
+	policyDefaultInstanceOnce sync.Once
+)
+
+// GetPolicyDefaultInstance returns the default instance of Policy, built from DefaultRolePermissions
+// and the ROLE_PERMISSIONS config
+func GetPolicyDefaultInstance() *Policy {
+	policyDefaultInstanceOnce.Do(func() {
+		policy, err := NewPolicyFromConfig(config.GetDefaultInstance())
+		if err != nil {
+			logrus.Fatalf("Could not load role permissions: %+v", err)
+		}
+		policyDefaultInstance = policy
+	})
+	return policyDefaultInstance
+}
+
+// NewPolicyFromConfig creates a policy from DefaultRolePermissions and the role permissions of the config
+func NewPolicyFromConfig(cfg *config.Config) (*Policy, error) {
+	rolePermissions, err := ParseRolePermissions(cfg.RolePermissions)
+	if err != nil {
+		return nil, err
+	}
+	return NewPolicy(rolePermissions), nil
+}
+
+// NewPolicy creates a policy granting each role the given permissions
+func NewPolicy(rolePermissions map[models.UserRole][]Permission) *Policy {
+	p := &Policy{permissions: make(map[models.UserRole]map[Permission]bool, len(rolePermissions))}
+	for role, permissions := range rolePermissions {
+		p.permissions[role] = make(map[Permission]bool, len(permissions))
+		for _, permission := range permissions {
+			p.permissions[role][permission] = true
+		}
+	}
+	return p
+}
+
+// ParseRolePermissions reads a JSON object of role names to permission lists, such as
+// `{"auditor": ["user:read", "purchase:read:any", "report:read"]}`, on top of DefaultRolePermissions.
+// A configured role replaces the default permissions of that role, permissions that are not in KnownPermissions are
+// rejected so that a typo cannot silently leave a role without a permission
+func ParseRolePermissions(value string) (map[models.UserRole][]Permission, error) {
+	rolePermissions := make(map[models.UserRole][]Permission, len(DefaultRolePermissions))
+	for role, permissions := range DefaultRolePermissions {
+		rolePermissions[role] = permissions
+	}
+	if strings.TrimSpace(value) == "" {
+		return rolePermissions, nil
+	}
+
+	configured := make(map[models.UserRole][]Permission)
+	if err := json.Unmarshal([]byte(value), &configured); err != nil {
+		return nil, fmt.Errorf("role permissions must be a JSON object of role names to permission lists: %v", err)
+	}
+	for role, permissions := range configured {
+		if role == "" {
+			return nil, fmt.Errorf("role name cannot be empty")
+		}
+		for _, permission := range permissions {
+			if !KnownPermissions[permission] {
+				return nil, fmt.Errorf("role %s has unknown permission %q", role, permission)
+			}
+		}
+		rolePermissions[role] = permissions
+	}
+	return rolePermissions, nil
+}
+
+// HasRole returns true if the role is known to the policy
+func (p *Policy) HasRole(role models.UserRole) bool {
+	_, ok := p.permissions[role]
+	return ok
+}
+
+// Allows returns true if the role is granted the permission
+func (p *Policy) Allows(role models.UserRole, permission Permission) bool {
+	return p.permissions[role][permission]
+}
+
+// AllowsAny returns true if the role is granted at least one of the permissions, or if no permissions are given
+func (p *Policy) AllowsAny(role models.UserRole, permissions ...Permission) bool {
+	if len(permissions) == 0 {
+		return true
+	}
+	for _, permission := range permissions {
+		if p.Allows(role, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns db.ErrUserForbidden unless the user is granted the permission on all resources,
+// or on their own resources while they are the owner
+func (p *Policy) Authorize(userContext UserContext, permission ScopedPermission, ownerID uuid.UUID) error {
+	if p.Allows(userContext.Role, permission.Any()) {
+		return nil
+	}
+	if ownerID == userContext.ID && p.Allows(userContext.Role, permission.Own()) {
+		return nil
+	}
+	return db.ErrUserForbidden
+}
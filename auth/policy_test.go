@@ -0,0 +1,88 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	t.Run("parse role permissions", func(t *testing.T) {
+		t.Run("without config", func(t *testing.T) {
+			rolePermissions, err := auth.ParseRolePermissions("")
+			if err != nil {
+				t.Fatalf("error parsing role permissions: %+v", err)
+			}
+			if len(rolePermissions) != len(auth.DefaultRolePermissions) {
+				t.Fatalf("expected the default roles, got: %+v", rolePermissions)
+			}
+		})
+		t.Run("with a new and an overridden role", func(t *testing.T) {
+			rolePermissions, err := auth.ParseRolePermissions(`{"auditor": ["report:read", "purchase:read:any"], "buyer": ["product:read"]}`)
+			if err != nil {
+				t.Fatalf("error parsing role permissions: %+v", err)
+			}
+			policy := auth.NewPolicy(rolePermissions)
+			if !policy.HasRole("auditor") || !policy.Allows("auditor", auth.PermReportRead) {
+				t.Fatalf("expected auditor to be allowed %s", auth.PermReportRead)
+			}
+			if policy.Allows(models.UserRoleBuyer, auth.PermProductBuy) {
+				t.Fatalf("expected configured buyer permissions to replace the defaults")
+			}
+			if !policy.Allows(models.UserRoleSeller, auth.PermProductCreate) {
+				t.Fatalf("expected seller to keep its default permissions")
+			}
+		})
+		t.Run("with an unknown permission", func(t *testing.T) {
+			if _, err := auth.ParseRolePermissions(`{"auditor": ["report:read", "purchase:read:all"]}`); err == nil {
+				t.Fatal("expected unknown permissions to be rejected")
+			}
+		})
+		t.Run("with invalid JSON", func(t *testing.T) {
+			if _, err := auth.ParseRolePermissions(`auditor=report:read`); err == nil {
+				t.Fatal("expected invalid role permissions to be rejected")
+			}
+		})
+	})
+
+	t.Run("allows any", func(t *testing.T) {
+		policy := auth.NewPolicy(auth.DefaultRolePermissions)
+		if !policy.AllowsAny(models.UserRoleBuyer) {
+			t.Fatal("expected no permissions to allow every role")
+		}
+		if !policy.AllowsAny(models.UserRoleSeller, auth.PermProductWrite.Own(), auth.PermProductWrite.Any()) {
+			t.Fatalf("expected seller to be allowed %s", auth.PermProductWrite.Own())
+		}
+		if policy.AllowsAny(models.UserRoleBuyer, auth.PermProductCreate, auth.PermReportRead) {
+			t.Fatal("expected buyer to be denied")
+		}
+		if policy.AllowsAny("unknown", auth.PermProductRead) {
+			t.Fatal("expected unknown role to be denied")
+		}
+	})
+
+	t.Run("authorize", func(t *testing.T) {
+		policy := auth.NewPolicy(auth.DefaultRolePermissions)
+		seller := auth.UserContext{ID: uuid.NewV4(), Role: models.UserRoleSeller}
+		admin := auth.UserContext{ID: uuid.NewV4(), Role: models.UserRoleAdmin}
+		buyer := auth.UserContext{ID: uuid.NewV4(), Role: models.UserRoleBuyer}
+
+		if err := policy.Authorize(seller, auth.PermProductWrite, seller.ID); err != nil {
+			t.Fatalf("expected seller to write their own product, got: %+v", err)
+		}
+		if err := policy.Authorize(seller, auth.PermProductWrite, uuid.NewV4()); err != db.ErrUserForbidden {
+			t.Fatalf("expected seller to be forbidden writing another product, got: %+v", err)
+		}
+		if err := policy.Authorize(admin, auth.PermProductWrite, seller.ID); err != nil {
+			t.Fatalf("expected admin to write any product, got: %+v", err)
+		}
+		if err := policy.Authorize(buyer, auth.PermProductWrite, buyer.ID); err != db.ErrUserForbidden {
+			t.Fatalf("expected buyer to be forbidden writing products, got: %+v", err)
+		}
+	})
+}
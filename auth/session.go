@@ -0,0 +1,8 @@
+package auth
+
+// SessionStore tells whether an access token belongs to an active session
+type SessionStore interface {
+	// TouchSession marks the session of the access token with the given id as seen,
+	// returning false if there is no such session or it has ended
+	TouchSession(jti string) (bool, error)
+}
@@ -3,44 +3,110 @@ package auth
 import (
 	"errors"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/dhurimkelmendi/vending_machine/api"
 	"github.com/dhurimkelmendi/vending_machine/config"
 	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/sirupsen/logrus"
 
 	uuid "github.com/satori/go.uuid"
 )
 
 // StatelessAuthenticationProvider provides stateless authentication.
 type StatelessAuthenticationProvider struct {
-	errCmp    api.ErrorComponentFn
-	TokenAuth *jwtauth.JWTAuth
+	errCmp         api.ErrorComponentFn
+	keys           *SigningKeys
+	accessTokenTTL time.Duration
+	denylist       TokenDenylist
+	sessions       SessionStore
 }
 
 // UserContext contains user details for the current request context
 type UserContext struct {
 	ID   uuid.UUID
 	Role models.UserRole
+	// TokenID and TokenExpiresAt identify the access token of the request, so that it can be revoked
+	TokenID        string
+	TokenExpiresAt time.Time
 }
 
-var statelessAuthenticationProviderDefaultInstance *StatelessAuthenticationProvider
+var (
+	statelessAuthenticationProviderDefaultInstance     *StatelessAuthenticationProvider
+	statelessAuthenticationProviderDefaultInstanceOnce sync.Once
+)
 
 // GetStatelessAuthenticationProviderDefaultInstance returns the default instance of StatelessAuthenticationProvider
 func GetStatelessAuthenticationProviderDefaultInstance() *StatelessAuthenticationProvider {
-	if statelessAuthenticationProviderDefaultInstance == nil {
-		jwtTokenAuth := jwtauth.New("HS256", []byte(config.GetDefaultInstance().JWTSecret), nil)
-
-		statelessAuthenticationProviderDefaultInstance = &StatelessAuthenticationProvider{
-			errCmp:    api.NewErrorComponent(api.CmpAuthentication),
-			TokenAuth: jwtTokenAuth,
+	statelessAuthenticationProviderDefaultInstanceOnce.Do(func() {
+		store := repositories.GetStoreDefaultInstance()
+		provider, err := NewStatelessAuthenticationProvider(config.GetDefaultInstance(), store.RevokedTokens(), store.Sessions())
+		if err != nil {
+			logrus.Fatalf("Could not load JWT signing keys: %+v", err)
 		}
-	}
+		statelessAuthenticationProviderDefaultInstance = provider
+	})
 	return statelessAuthenticationProviderDefaultInstance
 }
 
-// Authenticator ensures that the request has an auth token
+// NewStatelessAuthenticationProvider creates a StatelessAuthenticationProvider signing tokens with the keys of the
+// config, checking access tokens against the given denylist and sessions
+func NewStatelessAuthenticationProvider(cfg *config.Config, denylist TokenDenylist, sessions SessionStore) (*StatelessAuthenticationProvider, error) {
+	var keys *SigningKeys
+	var err error
+	if cfg.JWTPrivateKeyFile != "" {
+		keys, err = LoadSigningKeys(cfg.JWTPrivateKeyFile, cfg.JWTVerificationKeyFiles)
+	} else {
+		keys, err = NewHMACSigningKeys([]byte(cfg.JWTSecret))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatelessAuthenticationProvider{
+		errCmp:         api.NewErrorComponent(api.CmpAuthentication),
+		keys:           keys,
+		accessTokenTTL: cfg.AccessTokenTTL,
+		denylist:       denylist,
+		sessions:       sessions,
+	}, nil
+}
+
+// Verifier verifies the token from the Authorization header or the `jwt` cookie of the request,
+// putting it on the request context for Authenticator
+func (p *StatelessAuthenticationProvider) Verifier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := jwtauth.TokenFromHeader(r)
+		if tokenString == "" {
+			tokenString = jwtauth.TokenFromCookie(r)
+		}
+
+		var token jwt.Token
+		err := jwtauth.ErrNoTokenFound
+		if tokenString != "" {
+			token, err = p.ParseToken(tokenString)
+		}
+		next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), token, err)))
+	})
+}
+
+// ParseToken verifies the signature and validates the claims of the token
+func (p *StatelessAuthenticationProvider) ParseToken(tokenString string) (jwt.Token, error) {
+	return p.keys.Verify(tokenString)
+}
+
+// PublicKeys returns the public keys tokens are verified with
+func (p *StatelessAuthenticationProvider) PublicKeys() jwk.Set {
+	return p.keys.PublicKeys()
+}
+
+// Authenticator ensures that the request has an auth token that has not expired or been revoked,
+// and that belongs to an active session
 func (p *StatelessAuthenticationProvider) Authenticator(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		errCtx := p.errCmp(api.CtxAuthentication)
@@ -56,6 +122,32 @@ func (p *StatelessAuthenticationProvider) Authenticator(next http.Handler) http.
 			return
 		}
 
+		// tokens issued before expiry was introduced never expire, and cannot be revoked without an id
+		if token.Expiration().IsZero() || token.JwtID() == "" {
+			http.Error(w, errCtx(api.ErrInvalidAuth, errors.New("authorization token has no expiry")).Error(), http.StatusUnauthorized)
+			return
+		}
+
+		revoked, err := p.denylist.IsRevoked(token.JwtID())
+		if err != nil {
+			http.Error(w, errCtx(api.ErrInvalidAuth, err).Error(), http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			http.Error(w, errCtx(api.ErrInvalidAuth, errors.New("authorization token has been revoked")).Error(), http.StatusUnauthorized)
+			return
+		}
+
+		active, err := p.sessions.TouchSession(token.JwtID())
+		if err != nil {
+			http.Error(w, errCtx(api.ErrInvalidAuth, err).Error(), http.StatusInternalServerError)
+			return
+		}
+		if !active {
+			http.Error(w, errCtx(api.ErrInvalidAuth, errors.New("session of the authorization token has ended")).Error(), http.StatusUnauthorized)
+			return
+		}
+
 		// Token is authenticated, pass it through
 		next.ServeHTTP(w, r)
 	})
@@ -63,9 +155,11 @@ func (p *StatelessAuthenticationProvider) Authenticator(next http.Handler) http.
 
 // GetCurrentUserContext gets the user's context from the provided authentication token
 func (p *StatelessAuthenticationProvider) GetCurrentUserContext(r *http.Request) (*UserContext, error) {
-	token, err := jwtauth.VerifyRequest(p.TokenAuth, r, jwtauth.TokenFromHeader)
-	ctx := jwtauth.NewContext(r.Context(), token, err)
-	_, claims, err := jwtauth.FromContext(ctx)
+	tokenString := jwtauth.TokenFromHeader(r)
+	if tokenString == "" {
+		return nil, jwtauth.ErrNoTokenFound
+	}
+	token, err := p.ParseToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
@@ -80,30 +174,48 @@ func (p *StatelessAuthenticationProvider) GetCurrentUserContext(r *http.Request)
 		return nil, errors.New("invalid subject claim")
 	}
 
-	userRole, ok := claims["role"].(string)
+	role, _ := token.Get("role")
+	userRole, ok := role.(string)
 	if !ok {
 		return nil, errors.New("invalid user role claim")
 	}
 
 	return &UserContext{
-		ID:   userID,
-		Role: models.UserRole(userRole),
+		ID:             userID,
+		Role:           models.UserRole(userRole),
+		TokenID:        token.JwtID(),
+		TokenExpiresAt: token.Expiration(),
 	}, nil
 }
 
-// CreateUserAuthToken creates a JWT authentication token for the supplied user
-func (p *StatelessAuthenticationProvider) CreateUserAuthToken(user *models.User) (string, error) {
+// AccessToken is a signed JWT access token, with the claims needed to track and revoke it
+type AccessToken struct {
+	Token     string
+	ID        string
+	ExpiresAt time.Time
+}
+
+// CreateUserAuthToken creates a short-lived JWT access token for the supplied user
+func (p *StatelessAuthenticationProvider) CreateUserAuthToken(user *models.User) (*AccessToken, error) {
+	now := time.Now()
+	accessToken := &AccessToken{
+		ID:        uuid.NewV4().String(),
+		ExpiresAt: now.Add(p.accessTokenTTL).Truncate(time.Second),
+	}
 	claims := map[string]interface{}{
+		"jti":      accessToken.ID,
 		"sub":      user.ID.String(),
 		"username": user.Username,
 		"role":     user.Role,
 	}
-	jwtauth.SetIssuedNow(claims)
+	jwtauth.SetIssuedAt(claims, now)
+	jwtauth.SetExpiry(claims, accessToken.ExpiresAt)
 
-	_, tokenString, err := p.TokenAuth.Encode(claims)
+	var err error
+	_, accessToken.Token, err = p.keys.Sign(claims)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return tokenString, nil
+	return accessToken, nil
 }
@@ -0,0 +1,119 @@
+// Package change provides the algorithms used to break an amount down into
+// coins. Every algorithm implements the ChangeMaker interface and returns the
+// coins as a map of denomination to coin count.
+package change
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrCannotMakeChange is returned when an amount cannot be broken down into the available coins
+var ErrCannotMakeChange = errors.New("cannot make change from the available coins")
+
+// Coins maps a coin denomination to the number of coins of that denomination
+type Coins map[int32]int32
+
+// Total returns the sum of the value of all coins
+func (c Coins) Total() int32 {
+	var total int32
+	for denomination, count := range c {
+		total += denomination * count
+	}
+	return total
+}
+
+// Count returns the number of coins
+func (c Coins) Count() int32 {
+	var count int32
+	for _, n := range c {
+		count += n
+	}
+	return count
+}
+
+// Equals compares two instances of type Coins, ignoring denominations with no coins
+func (c Coins) Equals(secondCoins Coins) bool {
+	for denomination, count := range c {
+		if secondCoins[denomination] != count {
+			return false
+		}
+	}
+	for denomination, count := range secondCoins {
+		if c[denomination] != count {
+			return false
+		}
+	}
+	return true
+}
+
+// ChangeMaker breaks an amount down into coins
+type ChangeMaker interface {
+	MakeChange(amount int32) (Coins, error)
+}
+
+// NewChangeMaker returns the most efficient ChangeMaker that always pays out the fewest coins for the given
+// denominations: the greedy algorithm for canonical coin systems, the dynamic-programming one otherwise
+func NewChangeMaker(denominations []int32) ChangeMaker {
+	if IsCanonical(denominations) {
+		return NewGreedyChangeMaker(denominations)
+	}
+	return NewMinimalCoinsChangeMaker(denominations)
+}
+
+// IsCanonical reports whether the greedy algorithm pays out the fewest coins for every amount with the given
+// denominations. Unless the smallest denomination divides every amount that can be paid out, greedy can get
+// stuck with a remainder. Otherwise, if a counterexample exists, the smallest one is below the sum of the two
+// largest denominations (Kozen and Zaks, 1994), so only those amounts have to be checked
+func IsCanonical(denominations []int32) bool {
+	sorted := sortedDenominations(denominations)
+	if len(sorted) == 0 {
+		return true
+	}
+
+	divisor := sorted[0]
+	for _, denomination := range sorted[1:] {
+		divisor = gcd(divisor, denomination)
+	}
+	if sorted[len(sorted)-1] != divisor {
+		return false
+	}
+	if len(sorted) < 3 {
+		return true
+	}
+
+	greedy := NewGreedyChangeMaker(sorted)
+	minimal := NewMinimalCoinsChangeMaker(sorted)
+	for amount := int32(1); amount < sorted[0]+sorted[1]; amount++ {
+		minimalCoins, err := minimal.MakeChange(amount)
+		if err != nil {
+			continue
+		}
+		greedyCoins, err := greedy.MakeChange(amount)
+		if err != nil || greedyCoins.Count() > minimalCoins.Count() {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedDenominations returns the positive, distinct denominations, largest first
+func sortedDenominations(denominations []int32) []int32 {
+	seen := make(map[int32]bool, len(denominations))
+	sorted := make([]int32, 0, len(denominations))
+	for _, denomination := range denominations {
+		if denomination > 0 && !seen[denomination] {
+			seen[denomination] = true
+			sorted = append(sorted, denomination)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	return sorted
+}
+
+func gcd(a, b int32) int32 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,208 @@
+package change_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/change"
+)
+
+var denominationSets = [][]int32{
+	{5, 10, 20, 50, 100},
+	{1, 5, 10, 25},
+	{1, 3, 4},
+	{5, 20, 25},
+	{7, 11},
+}
+
+// fewestCoins returns the fewest coins needed for every amount up to max, using a brute-force search over the
+// coin counts of every denomination. Unreachable amounts are -1
+func fewestCoins(max int32, denominations []int32, limits []int32) []int32 {
+	fewest := make([]int32, max+1)
+	for a := range fewest {
+		fewest[a] = -1
+	}
+	var search func(i int, amount int32, count int32)
+	search = func(i int, amount int32, count int32) {
+		if amount > max {
+			return
+		}
+		if i == len(denominations) {
+			if fewest[amount] == -1 || count < fewest[amount] {
+				fewest[amount] = count
+			}
+			return
+		}
+		for n := int32(0); n <= limits[i] && amount+n*denominations[i] <= max; n++ {
+			search(i+1, amount+n*denominations[i], count+n)
+		}
+	}
+	search(0, 0, 0)
+	return fewest
+}
+
+func unlimited(denominations []int32, max int32) []int32 {
+	limits := make([]int32, len(denominations))
+	for i := range limits {
+		limits[i] = max
+	}
+	return limits
+}
+
+func TestChangeMakers(t *testing.T) {
+	t.Parallel()
+
+	t.Run("coins always sum to the requested amount", func(t *testing.T) {
+		for _, denominations := range denominationSets {
+			makers := map[string]change.ChangeMaker{
+				"greedy":  change.NewGreedyChangeMaker(denominations),
+				"minimal": change.NewMinimalCoinsChangeMaker(denominations),
+				"default": change.NewChangeMaker(denominations),
+			}
+			for name, maker := range makers {
+				for amount := int32(0); amount <= 500; amount++ {
+					coins, err := maker.MakeChange(amount)
+					if err != nil {
+						continue
+					}
+					if coins.Total() != amount {
+						t.Fatalf("%s change for %d with %v sums to %d: %v", name, amount, denominations, coins.Total(), coins)
+					}
+					for denomination, count := range coins {
+						if count <= 0 || !contains(denominations, denomination) {
+							t.Fatalf("%s change for %d with %v contains invalid coins: %v", name, amount, denominations, coins)
+						}
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("minimal change pays out the fewest coins", func(t *testing.T) {
+		const max = 300
+		for _, denominations := range denominationSets {
+			fewest := fewestCoins(max, denominations, unlimited(denominations, max))
+			minimal := change.NewMinimalCoinsChangeMaker(denominations)
+			defaultMaker := change.NewChangeMaker(denominations)
+			for amount := int32(0); amount <= max; amount++ {
+				for _, maker := range []change.ChangeMaker{minimal, defaultMaker} {
+					coins, err := maker.MakeChange(amount)
+					if fewest[amount] == -1 {
+						if err != change.ErrCannotMakeChange {
+							t.Fatalf("expected change for %d with %v to be impossible, got %v, %v", amount, denominations, coins, err)
+						}
+						continue
+					}
+					if err != nil {
+						t.Fatalf("change for %d with %v failed: %v", amount, denominations, err)
+					}
+					if coins.Count() != fewest[amount] {
+						t.Fatalf("change for %d with %v uses %d coins, expected %d: %v", amount, denominations, coins.Count(), fewest[amount], coins)
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("inventory change never pays out more coins than available", func(t *testing.T) {
+		random := rand.New(rand.NewSource(42))
+		const max = 400
+		for _, denominations := range denominationSets {
+			for round := 0; round < 20; round++ {
+				inventory := change.Coins{}
+				limits := make([]int32, len(denominations))
+				for i, denomination := range denominations {
+					limits[i] = int32(random.Intn(6))
+					inventory[denomination] = limits[i]
+				}
+				fewest := fewestCoins(max, denominations, limits)
+				maker := change.NewInventoryChangeMaker(inventory)
+				for amount := int32(0); amount <= max; amount++ {
+					coins, err := maker.MakeChange(amount)
+					if fewest[amount] == -1 {
+						if err != change.ErrCannotMakeChange {
+							t.Fatalf("expected change for %d from %v to be impossible, got %v, %v", amount, inventory, coins, err)
+						}
+						continue
+					}
+					if err != nil {
+						t.Fatalf("change for %d from %v failed: %v", amount, inventory, err)
+					}
+					if coins.Total() != amount {
+						t.Fatalf("change for %d from %v sums to %d: %v", amount, inventory, coins.Total(), coins)
+					}
+					if coins.Count() != fewest[amount] {
+						t.Fatalf("change for %d from %v uses %d coins, expected %d: %v", amount, inventory, coins.Count(), fewest[amount], coins)
+					}
+					for denomination, count := range coins {
+						if count > inventory[denomination] {
+							t.Fatalf("change for %d from %v pays out more coins than available: %v", amount, inventory, coins)
+						}
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("inventory change rejects amounts above the inventory total", func(t *testing.T) {
+		maker := change.NewInventoryChangeMaker(change.Coins{100: 2, 5: 3})
+		if _, err := maker.MakeChange(math.MaxInt32); err != change.ErrCannotMakeChange {
+			t.Fatalf("expected change for %d to be impossible, got %v", int32(math.MaxInt32), err)
+		}
+	})
+
+	t.Run("amounts that previously produced wrong coins", func(t *testing.T) {
+		maker := change.NewChangeMaker([]int32{5, 10, 20, 50, 100})
+		expectations := map[int32]change.Coins{
+			80:  {50: 1, 20: 1, 10: 1},
+			90:  {50: 1, 20: 2},
+			185: {100: 1, 50: 1, 20: 1, 10: 1, 5: 1},
+			585: {100: 5, 50: 1, 20: 1, 10: 1, 5: 1},
+			0:   {},
+		}
+		for amount, expected := range expectations {
+			coins, err := maker.MakeChange(amount)
+			if err != nil || !coins.Equals(expected) {
+				t.Fatalf("change for %d failed, expected %v, got %v, %v", amount, expected, coins, err)
+			}
+		}
+		if _, err := maker.MakeChange(83); err != change.ErrCannotMakeChange {
+			t.Fatalf("expected change for 83 to be impossible, got %v", err)
+		}
+	})
+
+	t.Run("canonical coin systems", func(t *testing.T) {
+		expectations := []struct {
+			denominations []int32
+			canonical     bool
+		}{
+			{[]int32{5, 10, 20, 50, 100}, true},
+			{[]int32{1, 5, 10, 25}, true},
+			{[]int32{1, 3, 4}, false},
+			{[]int32{5, 20, 25}, false},
+			{[]int32{7, 11}, false},
+			{[]int32{10, 25}, false},
+		}
+		for _, expectation := range expectations {
+			if change.IsCanonical(expectation.denominations) != expectation.canonical {
+				t.Fatalf("expected %v canonical to be %v", expectation.denominations, expectation.canonical)
+			}
+		}
+		if _, ok := change.NewChangeMaker([]int32{5, 10, 20, 50, 100}).(*change.GreedyChangeMaker); !ok {
+			t.Fatal("expected canonical coin systems to use the greedy change maker")
+		}
+		if _, ok := change.NewChangeMaker([]int32{1, 3, 4}).(*change.MinimalCoinsChangeMaker); !ok {
+			t.Fatal("expected non-canonical coin systems to use the minimal coins change maker")
+		}
+	})
+}
+
+func contains(denominations []int32, denomination int32) bool {
+	for _, d := range denominations {
+		if d == denomination {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package change
+
+// GreedyChangeMaker pays out as many coins of the largest denomination as possible before moving on to the
+// next one. It only pays out the fewest coins for canonical coin systems, like the euro or dollar coins
+type GreedyChangeMaker struct {
+	denominations []int32
+}
+
+// NewGreedyChangeMaker returns a GreedyChangeMaker for the given denominations
+func NewGreedyChangeMaker(denominations []int32) *GreedyChangeMaker {
+	return &GreedyChangeMaker{denominations: sortedDenominations(denominations)}
+}
+
+// MakeChange breaks the amount down into coins, ErrCannotMakeChange is returned if a remainder is left
+func (m *GreedyChangeMaker) MakeChange(amount int32) (Coins, error) {
+	coins := Coins{}
+	if amount < 0 {
+		return coins, ErrCannotMakeChange
+	}
+
+	remainder := amount
+	for _, denomination := range m.denominations {
+		if count := remainder / denomination; count > 0 {
+			coins[denomination] = count
+			remainder -= count * denomination
+		}
+	}
+	if remainder != 0 {
+		return Coins{}, ErrCannotMakeChange
+	}
+	return coins, nil
+}
@@ -0,0 +1,124 @@
+package change
+
+import "math"
+
+// MinimalCoinsChangeMaker pays out the fewest coins possible for any set of denominations,
+// using dynamic programming. Every denomination is assumed to be available in unlimited supply
+type MinimalCoinsChangeMaker struct {
+	denominations []int32
+}
+
+// NewMinimalCoinsChangeMaker returns a MinimalCoinsChangeMaker for the given denominations
+func NewMinimalCoinsChangeMaker(denominations []int32) *MinimalCoinsChangeMaker {
+	return &MinimalCoinsChangeMaker{denominations: sortedDenominations(denominations)}
+}
+
+// MakeChange breaks the amount down into the fewest coins, ErrCannotMakeChange is returned if it is not possible
+func (m *MinimalCoinsChangeMaker) MakeChange(amount int32) (Coins, error) {
+	limits := make([]int32, len(m.denominations))
+	for i := range limits {
+		limits[i] = amount
+	}
+	return minimalCoins(amount, m.denominations, limits)
+}
+
+// InventoryChangeMaker pays out the fewest coins possible while never paying out more coins of a denomination
+// than the inventory holds
+type InventoryChangeMaker struct {
+	denominations []int32
+	limits        []int32
+}
+
+// NewInventoryChangeMaker returns an InventoryChangeMaker limited by the given coin inventory
+func NewInventoryChangeMaker(inventory Coins) *InventoryChangeMaker {
+	denominations := make([]int32, 0, len(inventory))
+	for denomination, count := range inventory {
+		if count > 0 {
+			denominations = append(denominations, denomination)
+		}
+	}
+	m := &InventoryChangeMaker{denominations: sortedDenominations(denominations)}
+	m.limits = make([]int32, len(m.denominations))
+	for i, denomination := range m.denominations {
+		m.limits[i] = inventory[denomination]
+	}
+	return m
+}
+
+// MakeChange breaks the amount down into the fewest available coins, ErrCannotMakeChange is returned if it is not
+// possible with the coins in the inventory
+func (m *InventoryChangeMaker) MakeChange(amount int32) (Coins, error) {
+	// the table of minimalCoins grows with the amount, so amounts the inventory cannot cover are rejected first
+	var total int64
+	for i, denomination := range m.denominations {
+		total += int64(denomination) * int64(m.limits[i])
+	}
+	if total < int64(amount) {
+		return Coins{}, ErrCannotMakeChange
+	}
+	return minimalCoins(amount, m.denominations, m.limits)
+}
+
+const unreachable = math.MaxInt32
+
+// minimalCoins returns the fewest coins that sum up to amount, using at most limits[i] coins of denominations[i].
+// Denominations are added one at a time; for each one, the best way to reach every amount is the minimum of
+// best[a - j*d] + j over the allowed coin counts j, which is kept in a sliding window per remainder of a modulo d,
+// making every denomination cost O(amount)
+func minimalCoins(amount int32, denominations []int32, limits []int32) (Coins, error) {
+	if amount < 0 {
+		return Coins{}, ErrCannotMakeChange
+	}
+	if amount == 0 {
+		return Coins{}, nil
+	}
+
+	best := make([]int32, amount+1)
+	for a := range best[1:] {
+		best[a+1] = unreachable
+	}
+	used := make([][]int32, len(denominations))
+
+	for i, denomination := range denominations {
+		next := make([]int32, amount+1)
+		used[i] = make([]int32, amount+1)
+		for remainder := int32(0); remainder < denomination && remainder <= amount; remainder++ {
+			// window holds the candidate coin counts k, ordered by increasing best[remainder + k*d] - k
+			window := make([]int32, 0)
+			value := func(k int32) int32 { return best[remainder+k*denomination] - k }
+			for k := int32(0); remainder+k*denomination <= amount; k++ {
+				a := remainder + k*denomination
+				if best[a] != unreachable {
+					for len(window) > 0 && value(window[len(window)-1]) >= value(k) {
+						window = window[:len(window)-1]
+					}
+					window = append(window, k)
+				}
+				for len(window) > 0 && window[0] < k-limits[i] {
+					window = window[1:]
+				}
+				if len(window) == 0 {
+					next[a] = unreachable
+					continue
+				}
+				next[a] = value(window[0]) + k
+				used[i][a] = k - window[0]
+			}
+		}
+		best = next
+	}
+
+	if best[amount] == unreachable {
+		return Coins{}, ErrCannotMakeChange
+	}
+
+	coins := Coins{}
+	remaining := amount
+	for i := len(denominations) - 1; i >= 0; i-- {
+		if count := used[i][remaining]; count > 0 {
+			coins[denominations[i]] = count
+			remaining -= count * denominations[i]
+		}
+	}
+	return coins, nil
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -22,6 +24,14 @@ const (
 	EnvStaging     Env = "staging"
 )
 
+// The database drivers that are supported.
+const (
+	DatabaseDriverPostgres = "postgres"
+	DatabaseDriverSQLite   = "sqlite"
+	// DatabaseDriverMemory keeps all records in memory until the application stops, e.g. for tests.
+	DatabaseDriverMemory = "memory"
+)
+
 // Config holds configuration values.
 type Config struct {
 	// Env is the current environment the configs were reading from.
@@ -40,6 +50,14 @@ type Config struct {
 	// that're allowed to make cross-origin requests to the API server.
 	CORSOrigins string
 
+	// DatabaseDriver is the database all records are kept in, either "postgres", "sqlite" or "memory". SQLite is
+	// meant for single machine deployments without a connection to a central Postgres, memory keeps nothing once the
+	// application stops.
+	DatabaseDriver string
+
+	// DatabasePath is the path of the SQLite database file, it is only used with the sqlite driver.
+	DatabasePath string
+
 	// DatabaseHost is the host of the Postgres database the application will connect to.
 	DatabaseHost string
 
@@ -55,6 +73,10 @@ type Config struct {
 	// DatabasePassword is the Postgres password of the user who is connecting to the database.
 	DatabasePassword string
 
+	// DatabaseSchema is the Postgres schema the tables are kept in, searched before the public schema holding the
+	// extensions. The default search path of the user is used when it is empty.
+	DatabaseSchema string
+
 	// DebugDatabase if enabled, will display all queries sent to database
 	DebugDatabase bool
 
@@ -62,8 +84,17 @@ type Config struct {
 	HTTPAddr string
 
 	// JWTSecret is the JWT secret used to generate tokens - must be at least 64 bytes long!
+	// It is only used while no JWTPrivateKeyFile is set.
 	JWTSecret string
 
+	// JWTPrivateKeyFile is the path of a PEM encoded RSA, ECDSA or Ed25519 private key tokens are signed with.
+	// The signing algorithm (RS256, ES256/ES384/ES512 or EdDSA) follows from the type of the key.
+	JWTPrivateKeyFile string
+
+	// JWTVerificationKeyFiles is a comma separated list of paths of PEM encoded public keys that tokens are
+	// still accepted from, besides the signing key. Keys are rotated by moving the previous signing key here.
+	JWTVerificationKeyFiles []string
+
 	// APISecret is the JWT secret used to generate service-to-service tokens - must be at least 64 bytes long!
 	APISecret string
 
@@ -73,23 +104,70 @@ type Config struct {
 	// RespondWithInnerError determines if API error response should include inner error messages.
 	RespondWithInnerError bool
 
-	// AcceptableDepositAmountValues specifies the amounts acceptable for deposit
+	// AcceptableDepositAmountValues specifies the amounts acceptable for deposit.
+	// These are also the coin denominations change is paid out in.
 	AcceptableDepositAmountValues []int32
+
+	// IdempotencyKeyTTL is how long the response to a request sent with an Idempotency-Key header is replayed
+	// for retries of that request.
+	IdempotencyKeyTTL time.Duration
+
+	// AccessTokenTTL is how long an access token is accepted after it was issued.
+	AccessTokenTTL time.Duration
+
+	// RefreshTokenTTL is how long a refresh token can be exchanged for a new access token.
+	RefreshTokenTTL time.Duration
+
+	// RolePermissions is a JSON object of role names to the permissions granted to them,
+	// e.g. {"auditor": ["user:read", "purchase:read:any", "report:read"]}.
+	// Configured roles are added to, or replace, the built in buyer, seller and admin roles.
+	RolePermissions string
+
+	// PriceActivationInterval is how often scheduled product prices that became effective are applied to
+	// the product catalogue.
+	PriceActivationInterval time.Duration
+
+	// RefundWindow is how long after a purchase the buyer can refund it themselves, sellers and admins
+	// can refund purchases at any time.
+	RefundWindow time.Duration
+
+	// VendReservationTTL is how long a purchase stays reserved before the machine has to start vending it.
+	// Reservations that are older fail, which returns the stock and money of the purchase.
+	VendReservationTTL time.Duration
+
+	// VendExpiryInterval is how often reservations older than VendReservationTTL are failed.
+	VendExpiryInterval time.Duration
+
+	// PlatformFeePercent is the percentage of every sale the platform keeps as commission, sellers accrue the rest
+	// as revenue that is paid out to them.
+	PlatformFeePercent int32
 }
 
-var defaultInstance *Config
+// defaultJWTSecret is only meant for development, the server refuses to start with it in production
+const defaultJWTSecret = "jwt_secret_signing_key"
+
+var (
+	defaultInstance     *Config
+	defaultInstanceOnce sync.Once
+)
 
-// GetDefaultInstance returns the default instance of Config.
+// GetDefaultInstance returns the default instance of Config, read from the environment once.
 func GetDefaultInstance() *Config {
-	if defaultInstance == nil {
-		defaultInstance = &Config{
-			Env: getEnv(),
-		}
-		defaultInstance.readConfigs()
-	}
+	defaultInstanceOnce.Do(func() {
+		defaultInstance = Load()
+	})
 	return defaultInstance
 }
 
+// Load reads a new Config from the environment variables.
+func Load() *Config {
+	c := &Config{
+		Env: getEnv(),
+	}
+	c.readConfigs()
+	return c
+}
+
 // SetLogLevel checks LOG_LEVEL; in case of not set, default to debug, except we are on production, where the default must be info level
 func (c *Config) SetLogLevel() {
 	var el string
@@ -124,16 +202,30 @@ func (c *Config) readConfigs() {
 
 	c.APIOrigin = appConfig.GetConfig("API_ORIGIN", "")
 	c.CORSOrigins = appConfig.GetConfig("CORS_ORIGINS", "")
+	c.DatabaseDriver = appConfig.GetConfig("DB_DRIVER", DatabaseDriverPostgres)
+	c.DatabasePath = appConfig.GetConfig("DB_PATH", "vending_machine.db")
 	c.DatabaseHost = appConfig.GetConfig("DB_HOST", "localhost")
 	c.DatabasePort = appConfig.GetConfig("DB_PORT", "5432")
 	c.DatabaseName = appConfig.GetConfig("DB_NAME", "vending_machine_db")
 	c.DatabaseUsername = appConfig.GetConfig("DB_USERNAME", "vending_machine")
 	c.DatabasePassword = appConfig.GetConfig("DB_PASSWORD", "vending_machine_pass")
+	c.DatabaseSchema = appConfig.GetConfig("DB_SCHEMA", "")
 	c.HTTPAddr = appConfig.GetConfig("HTTP_ADDR", ":8080")
-	c.JWTSecret = appConfig.GetConfig("JWT_SECRET", "jwt_secret_signing_key")
+	c.JWTSecret = appConfig.GetConfig("JWT_SECRET", defaultJWTSecret)
+	c.JWTPrivateKeyFile = appConfig.GetConfig("JWT_PRIVATE_KEY_FILE", "")
+	c.JWTVerificationKeyFiles = appConfig.GetStrings("JWT_VERIFICATION_KEY_FILES", []string{})
 	c.APISecret = appConfig.GetConfig("API_SECRET", "app_secret_signing_key")
 	c.APIHost = appConfig.GetConfig("API_HOST", "http://localhost:8080")
-	c.AcceptableDepositAmountValues = []int32{5, 10, 20, 50, 100}
+	c.AcceptableDepositAmountValues = appConfig.GetInt32s("ACCEPTABLE_DEPOSIT_AMOUNT_VALUES", []int32{5, 10, 20, 50, 100})
+	c.IdempotencyKeyTTL = appConfig.GetDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+	c.AccessTokenTTL = appConfig.GetDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+	c.RefreshTokenTTL = appConfig.GetDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	c.RolePermissions = appConfig.GetConfig("ROLE_PERMISSIONS", "")
+	c.PriceActivationInterval = appConfig.GetDuration("PRICE_ACTIVATION_INTERVAL", time.Minute)
+	c.RefundWindow = appConfig.GetDuration("REFUND_WINDOW", 15*time.Minute)
+	c.VendReservationTTL = appConfig.GetDuration("VEND_RESERVATION_TTL", 2*time.Minute)
+	c.VendExpiryInterval = appConfig.GetDuration("VEND_EXPIRY_INTERVAL", 30*time.Second)
+	c.PlatformFeePercent = appConfig.GetInt32("PLATFORM_FEE_PERCENT", 10)
 
 	// Set flags
 	c.DebugDatabase = appConfig.GetFlag("DEBUG_DATABASE", false)
@@ -141,6 +233,22 @@ func (c *Config) readConfigs() {
 	c.RespondWithInnerError = c.Env != EnvProduction
 }
 
+// Validate returns an error if the config values are not safe to run the server with in the current environment.
+func (c *Config) Validate() error {
+	if c.Env == EnvProduction && c.JWTPrivateKeyFile == "" && c.JWTSecret == defaultJWTSecret {
+		return fmt.Errorf("JWT_SECRET must be changed from its default value, or JWT_PRIVATE_KEY_FILE set, in production")
+	}
+	switch c.DatabaseDriver {
+	case "", DatabaseDriverPostgres, DatabaseDriverSQLite, DatabaseDriverMemory:
+	default:
+		return fmt.Errorf("DB_DRIVER must be %s, %s or %s", DatabaseDriverPostgres, DatabaseDriverSQLite, DatabaseDriverMemory)
+	}
+	if c.PlatformFeePercent < 0 || c.PlatformFeePercent > 100 {
+		return fmt.Errorf("PLATFORM_FEE_PERCENT must be between 0 and 100")
+	}
+	return nil
+}
+
 // LogConfigs logs the config values.
 func (c *Config) LogConfigs() {
 	logrus.Warn("[Config] Values:")
@@ -148,14 +256,28 @@ func (c *Config) LogConfigs() {
 	logrus.Warn(fmt.Sprintf("  * APIOrigin: %+v", c.APIOrigin))
 	logrus.Warn(fmt.Sprintf("  * CORSOrigins: %+v", c.CORSOrigins))
 	logrus.Warn(fmt.Sprintf("  * DebugDatabase: %+v", c.DebugDatabase))
+	logrus.Warn(fmt.Sprintf("  * DatabaseDriver: %+v", c.DatabaseDriver))
+	logrus.Warn(fmt.Sprintf("  * DatabasePath: %+v", c.DatabasePath))
 	logrus.Warn(fmt.Sprintf("  * DatabaseHost: %+v", c.DatabaseHost))
 	logrus.Warn(fmt.Sprintf("  * DatabasePort: %+v", c.DatabasePort))
 	logrus.Warn(fmt.Sprintf("  * DatabaseName: %+v", c.DatabaseName))
 	logrus.Warn(fmt.Sprintf("  * DatabaseUsername: %+v", c.DatabaseUsername))
 	logrus.Warn(fmt.Sprintf("  * DatabasePassword: %+v", strings.Repeat("*", len(c.DatabasePassword))))
+	logrus.Warn(fmt.Sprintf("  * DatabaseSchema: %+v", c.DatabaseSchema))
 	logrus.Warn(fmt.Sprintf("  * HTTPAddr: %+v", c.HTTPAddr))
-	logrus.Warn(fmt.Sprintf("  * JWTSecret: %+v", c.JWTSecret))
+	logrus.Warn(fmt.Sprintf("  * JWTSecret: %+v", strings.Repeat("*", len(c.JWTSecret))))
+	logrus.Warn(fmt.Sprintf("  * JWTPrivateKeyFile: %+v", c.JWTPrivateKeyFile))
+	logrus.Warn(fmt.Sprintf("  * JWTVerificationKeyFiles: %+v", c.JWTVerificationKeyFiles))
 	logrus.Warn(fmt.Sprintf("  * APISecret: %+v", c.APISecret))
 	logrus.Warn(fmt.Sprintf("  * APIHost: %+v", c.APIHost))
 	logrus.Warn(fmt.Sprintf("  * AcceptableDepositAmountValues: %+v", c.AcceptableDepositAmountValues))
+	logrus.Warn(fmt.Sprintf("  * IdempotencyKeyTTL: %+v", c.IdempotencyKeyTTL))
+	logrus.Warn(fmt.Sprintf("  * AccessTokenTTL: %+v", c.AccessTokenTTL))
+	logrus.Warn(fmt.Sprintf("  * RefreshTokenTTL: %+v", c.RefreshTokenTTL))
+	logrus.Warn(fmt.Sprintf("  * RolePermissions: %+v", c.RolePermissions))
+	logrus.Warn(fmt.Sprintf("  * PriceActivationInterval: %+v", c.PriceActivationInterval))
+	logrus.Warn(fmt.Sprintf("  * RefundWindow: %+v", c.RefundWindow))
+	logrus.Warn(fmt.Sprintf("  * VendReservationTTL: %+v", c.VendReservationTTL))
+	logrus.Warn(fmt.Sprintf("  * VendExpiryInterval: %+v", c.VendExpiryInterval))
+	logrus.Warn(fmt.Sprintf("  * PlatformFeePercent: %+v", c.PlatformFeePercent))
 }
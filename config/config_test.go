@@ -0,0 +1,42 @@
+package config
+
+import "testing"
+
+func TestConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default secret in development", func(t *testing.T) {
+		c := &Config{Env: EnvDevelopment, JWTSecret: defaultJWTSecret}
+		if err := c.Validate(); err != nil {
+			t.Fatalf("expected the default secret to be allowed in development, got: %+v", err)
+		}
+	})
+
+	t.Run("default secret in production", func(t *testing.T) {
+		c := &Config{Env: EnvProduction, JWTSecret: defaultJWTSecret}
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected the default secret to be refused in production")
+		}
+	})
+
+	t.Run("changed secret in production", func(t *testing.T) {
+		c := &Config{Env: EnvProduction, JWTSecret: "a_secret_nobody_knows"}
+		if err := c.Validate(); err != nil {
+			t.Fatalf("expected a changed secret to be allowed in production, got: %+v", err)
+		}
+	})
+
+	t.Run("private key in production", func(t *testing.T) {
+		c := &Config{Env: EnvProduction, JWTSecret: defaultJWTSecret, JWTPrivateKeyFile: "/run/secrets/jwt.pem"}
+		if err := c.Validate(); err != nil {
+			t.Fatalf("expected a private key to be allowed in production, got: %+v", err)
+		}
+	})
+
+	t.Run("unknown database driver", func(t *testing.T) {
+		c := &Config{Env: EnvDevelopment, JWTSecret: defaultJWTSecret, DatabaseDriver: "mysql"}
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected an unknown database driver to be refused")
+		}
+	})
+}
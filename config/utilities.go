@@ -4,6 +4,8 @@ import (
 	"flag"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -15,6 +17,10 @@ type envVarGetter func(key string) string
 type AppConfig interface {
 	GetConfig(key, defaultValue string) string
 	GetFlag(key string, defaultValue bool) bool
+	GetInt32(key string, defaultValue int32) int32
+	GetInt32s(key string, defaultValue []int32) []int32
+	GetStrings(key string, defaultValue []string) []string
+	GetDuration(key string, defaultValue time.Duration) time.Duration
 }
 
 // EnvironmentAppConfig attaches the os environment
@@ -62,6 +68,105 @@ func (e *EnvironmentAppConfig) GetFlag(key string, defaultValue bool) bool {
 	return b
 }
 
+// GetInt32 returns an int32 value from the environment
+func (e *EnvironmentAppConfig) GetInt32(key string, defaultValue int32) int32 {
+	v := e.env(key)
+
+	if v == "" {
+		if e.warnMissing {
+			logrus.Errorf("No value set for environment variable: [ %+v ]; Using default value: `%+v`", key, defaultValue)
+		}
+
+		return defaultValue
+	}
+
+	i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 32)
+	if err != nil {
+		if e.warnMissing {
+			logrus.Errorf("Invalid integer value set for environment variable: [ %+v ]; Using default value: `%+v`", key, defaultValue)
+		}
+
+		return defaultValue
+	}
+
+	return int32(i)
+}
+
+// GetInt32s returns a slice of int32 values from a comma separated environment value
+func (e *EnvironmentAppConfig) GetInt32s(key string, defaultValue []int32) []int32 {
+	v := e.env(key)
+
+	if v == "" {
+		if e.warnMissing {
+			logrus.Errorf("No value set for environment variable: [ %+v ]; Using default value: `%+v`", key, defaultValue)
+		}
+
+		return defaultValue
+	}
+
+	parts := strings.Split(v, ",")
+	values := make([]int32, 0, len(parts))
+	for _, part := range parts {
+		i, err := strconv.ParseInt(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			if e.warnMissing {
+				logrus.Errorf("Invalid integer list set for environment variable: [ %+v ]; Using default value: `%+v`", key, defaultValue)
+			}
+
+			return defaultValue
+		}
+		values = append(values, int32(i))
+	}
+
+	return values
+}
+
+// GetStrings returns a slice of string values from a comma separated environment value, skipping empty values
+func (e *EnvironmentAppConfig) GetStrings(key string, defaultValue []string) []string {
+	v := e.env(key)
+
+	if v == "" {
+		if e.warnMissing {
+			logrus.Errorf("No value set for environment variable: [ %+v ]; Using default value: `%+v`", key, defaultValue)
+		}
+
+		return defaultValue
+	}
+
+	values := make([]string, 0)
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+
+	return values
+}
+
+// GetDuration returns a time.Duration value, such as "24h" or "90s", from the environment
+func (e *EnvironmentAppConfig) GetDuration(key string, defaultValue time.Duration) time.Duration {
+	v := e.env(key)
+
+	if v == "" {
+		if e.warnMissing {
+			logrus.Errorf("No value set for environment variable: [ %+v ]; Using default value: `%+v`", key, defaultValue)
+		}
+
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		if e.warnMissing {
+			logrus.Errorf("Invalid duration value set for environment variable: [ %+v ]; Using default value: `%+v`", key, defaultValue)
+		}
+
+		return defaultValue
+	}
+
+	return d
+}
+
 // envConfigGetter returns a configGetter that gets configs with the given envGetter.
 func envConfigGetter(envGetter envVarGetter, warnMissing bool) AppConfig {
 	return &EnvironmentAppConfig{env: envGetter, warnMissing: warnMissing}
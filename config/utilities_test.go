@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func dummyGetter(name string) string {
@@ -17,6 +18,30 @@ func dummyGetter(name string) string {
 		return "true"
 	}
 
+	if name == "INT1" {
+		return "15"
+	}
+
+	if name == "INTS1" {
+		return "5, 10,20"
+	}
+
+	if name == "INTS2" {
+		return "5,ten"
+	}
+
+	if name == "STRINGS1" {
+		return "a.pem, ,b.pem"
+	}
+
+	if name == "DURATION1" {
+		return "90s"
+	}
+
+	if name == "DURATION2" {
+		return "ninety seconds"
+	}
+
 	return ""
 }
 
@@ -45,4 +70,55 @@ func TestConfigUtilities(t *testing.T) {
 			t.Fatalf("Incorrect value: %v", value)
 		}
 	})
+
+	t.Run("get int32 list config", func(t *testing.T) {
+		value := appConfig.GetInt32s("INTS1", nil)
+		if len(value) != 3 || value[0] != 5 || value[1] != 10 || value[2] != 20 {
+			t.Fatalf("Incorrect value: %v", value)
+		}
+	})
+
+	t.Run("get invalid int32 list config with default", func(t *testing.T) {
+		value := appConfig.GetInt32s("INTS2", []int32{1})
+		if len(value) != 1 || value[0] != 1 {
+			t.Fatalf("Incorrect value: %v", value)
+		}
+	})
+
+	t.Run("get string list config", func(t *testing.T) {
+		value := appConfig.GetStrings("STRINGS1", nil)
+		if len(value) != 2 || value[0] != "a.pem" || value[1] != "b.pem" {
+			t.Fatalf("Incorrect value: %v", value)
+		}
+	})
+
+	t.Run("get string list config with default", func(t *testing.T) {
+		value := appConfig.GetStrings("STRINGSX", []string{"x"})
+		if len(value) != 1 || value[0] != "x" {
+			t.Fatalf("Incorrect value: %v", value)
+		}
+	})
+
+	t.Run("get duration config", func(t *testing.T) {
+		value := appConfig.GetDuration("DURATION1", time.Hour)
+		if value != 90*time.Second {
+			t.Fatalf("Incorrect value: %v", value)
+		}
+	})
+
+	t.Run("get int config", func(t *testing.T) {
+		if value := appConfig.GetInt32("INT1", 10); value != 15 {
+			t.Fatalf("Incorrect value: %v", value)
+		}
+		if value := appConfig.GetInt32("VAR1", 10); value != 10 {
+			t.Fatalf("Incorrect value: %v", value)
+		}
+	})
+
+	t.Run("get invalid duration config with default", func(t *testing.T) {
+		value := appConfig.GetDuration("DURATION2", time.Hour)
+		if value != time.Hour {
+			t.Fatalf("Incorrect value: %v", value)
+		}
+	})
 }
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	"github.com/go-chi/render"
+)
+
+// An AccountsController handles HTTP requests that deal with the accounts of the journal.
+type AccountsController struct {
+	AuthenticatedController
+	accountService *services.AccountService
+}
+
+// GetAccountsControllerDefaultInstance returns the default instance of AccountsController.
+func GetAccountsControllerDefaultInstance() *AccountsController {
+	return GetControllersDefaultInstance().Accounts
+}
+
+// NewAccountController create a new instance of an account controller using the supplied account service, responder and authentication provider
+func NewAccountController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, accountService *services.AccountService) *AccountsController {
+	return newAccountController(newAuthenticatedController(api.CmpController, responder, statelessAuthenticationProvider), accountService)
+}
+
+func newAccountController(authenticatedController AuthenticatedController, accountService *services.AccountService) *AccountsController {
+	return &AccountsController{
+		AuthenticatedController: authenticatedController,
+		accountService:          accountService,
+	}
+}
+
+// GetRevenue returns the revenue balance of the current seller with its latest movements
+func (c *AccountsController) GetRevenue(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetRevenue, r.Header.Get("X-Request-Id"))
+	statement, err := c.accountService.GetRevenue(userContext.ID)
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrGetRevenue, err), http.StatusBadRequest)
+		return
+	}
+
+	if err := render.Render(w, r, statement); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// Reconcile returns the differences between the journal and the deposits of users
+func (c *AccountsController) Reconcile(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxReconcile, r.Header.Get("X-Request-Id"))
+	reconciliation, err := c.accountService.Reconcile()
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrReconcile, err), http.StatusBadRequest)
+		return
+	}
+
+	if err := render.Render(w, r, reconciliation); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
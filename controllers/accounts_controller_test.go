@@ -0,0 +1,96 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/controllers"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/go-chi/chi"
+)
+
+func TestAccountController(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+
+	ctrl := a.Controllers
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	admin, err := fixture.User.CreateAdminUser()
+	if err != nil {
+		t.Fatalf("could not create admin: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	report, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, buyer.ID)
+	if err != nil {
+		t.Fatalf("could not create purchase: %+v", err)
+	}
+	purchase := report.Purchases[0]
+
+	r := chi.NewRouter()
+	r.Get("/api/v1/accounts/revenue", ctrl.AuthenticationRequired(ctrl.Accounts.AuthenticatedController, api.CtxGetRevenue, ctrl.Accounts.GetRevenue, controllers.RequirePermissions(auth.PermSaleRead)))
+	r.Get("/api/v1/admin/accounts/reconciliation", ctrl.AuthenticationRequired(ctrl.Accounts.AuthenticatedController, api.CtxReconcile, ctrl.Accounts.Reconcile, controllers.RequirePermissions(auth.PermReportRead)))
+
+	t.Run("get revenue", func(t *testing.T) {
+		t.Run("as buyer", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/accounts/revenue", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("as seller", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/accounts/revenue", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			statement := &payloads.RevenueStatement{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(statement); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if revenue := int64(purchase.Total - purchase.PlatformFee); statement.SellerID != seller.ID || statement.Balance != revenue {
+				t.Fatalf("expected a revenue of %d, got: %+v", revenue, statement)
+			}
+		})
+	})
+
+	t.Run("reconcile as admin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/accounts/reconciliation", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+		}
+	})
+}
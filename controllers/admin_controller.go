@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	uuid "github.com/satori/go.uuid"
+)
+
+// An AdminController handles HTTP requests that manage users and reports across all users.
+type AdminController struct {
+	AuthenticatedController
+	userService     *services.UserService
+	purchaseService *services.PurchaseService
+}
+
+// GetAdminControllerDefaultInstance returns the default instance of AdminController.
+func GetAdminControllerDefaultInstance() *AdminController {
+	return GetControllersDefaultInstance().Admin
+}
+
+// NewAdminController create a new instance of an admin controller using the supplied user and purchase services, responder and authentication provider
+func NewAdminController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, userService *services.UserService, purchaseService *services.PurchaseService) *AdminController {
+	return newAdminController(newAuthenticatedController(api.CmpAdminController, responder, statelessAuthenticationProvider), userService, purchaseService)
+}
+
+func newAdminController(authenticatedController AuthenticatedController, userService *services.UserService, purchaseService *services.PurchaseService) *AdminController {
+	return &AdminController{
+		AuthenticatedController: authenticatedController,
+		userService:             userService,
+		purchaseService:         purchaseService,
+	}
+}
+
+// GetAllUsers returns a page of all users matching the query parameters, including disabled ones
+func (c *AdminController) GetAllUsers(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetUsers, r.Header.Get("X-Request-Id"))
+	filter, err := payloads.ParseUserFilter(r.URL.Query())
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, err), http.StatusBadRequest)
+		return
+	}
+
+	users, err := c.userService.GetAllUsers(filter)
+	if err != nil {
+		if err == services.ErrInvalidListParams {
+			c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, err), http.StatusBadRequest)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrGetUsers, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, users); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// DisableUser disables the requested user by id and ends all of their sessions
+func (c *AdminController) DisableUser(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	c.setUserDisabled(w, r, api.CtxDisableUser, api.ErrDisableUser, true)
+}
+
+// EnableUser enables the requested user by id
+func (c *AdminController) EnableUser(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	c.setUserDisabled(w, r, api.CtxEnableUser, api.ErrEnableUser, false)
+}
+
+func (c *AdminController) setUserDisabled(w http.ResponseWriter, r *http.Request, errorContext api.ErrorContext, responseErr *api.ResponseError, disabled bool) {
+	errCtx := c.errCmp(errorContext, r.Header.Get("X-Request-Id"))
+	userID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid userId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	user, err := c.userService.SetUserDisabled(context.Background(), userID, disabled)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrUserNotFound, errors.New("no user with that id")), http.StatusNotFound)
+		} else {
+			c.responder.Error(w, errCtx(responseErr, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, payloads.MapUserToUserDetails(user)); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// ResetDeposit resets the deposit of the requested user by id, returning it as change
+func (c *AdminController) ResetDeposit(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxResetDeposit, r.Header.Get("X-Request-Id"))
+	userID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid userId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	user, err := c.userService.ResetDeposit(context.Background(), userID)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrUserNotFound, errors.New("no user with that id")), http.StatusNotFound)
+		} else if err == services.ErrExactChangeOnly {
+			c.responder.Error(w, errCtx(api.ErrExactChangeOnly, err), http.StatusConflict)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrResetDeposit, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, payloads.MapUserToUserDetails(user)); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// UpdateUserRole changes the role of the requested user by id and ends all of their sessions
+func (c *AdminController) UpdateUserRole(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxUpdateUserRole, r.Header.Get("X-Request-Id"))
+	userID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid userId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	updateRole := &payloads.UpdateUserRolePayload{}
+	if err := json.NewDecoder(r.Body).Decode(updateRole); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode role")), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := updateRole.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+
+	user, err := c.userService.UpdateUserRole(context.Background(), userID, updateRole)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrUserNotFound, errors.New("no user with that id")), http.StatusNotFound)
+		} else if err == services.ErrUnknownRole {
+			c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrUpdateUserRole, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, payloads.MapUserToUserDetails(user)); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// GetSalesReport returns the totals of all purchases with a breakdown per product
+func (c *AdminController) GetSalesReport(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetSalesReport, r.Header.Get("X-Request-Id"))
+	report, err := c.purchaseService.GetSalesReport()
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrGetSalesReport, err), http.StatusBadRequest)
+		return
+	}
+
+	if err := render.Render(w, r, report); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,240 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/controllers"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/go-chi/chi"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestAdminController(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+
+	ctrl := a.Controllers
+	admin, err := fixture.User.CreateAdminUser()
+	if err != nil {
+		t.Fatalf("could not create admin: %+v", err)
+	}
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	if _, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, buyer.ID); err != nil {
+		t.Fatalf("could not create purchase: %+v", err)
+	}
+	userWriteOptions := controllers.RequirePermissions(auth.PermUserWrite.Own(), auth.PermUserWrite.Any())
+	userManageOptions := controllers.RequirePermissions(auth.PermUserManage)
+	depositResetOptions := controllers.RequirePermissions(auth.PermDepositReset)
+	productWriteOptions := controllers.RequirePermissions(auth.PermProductWrite.Own(), auth.PermProductWrite.Any())
+	reportReadOptions := controllers.RequirePermissions(auth.PermReportRead)
+
+	r := chi.NewRouter()
+	r.Get("/api/v1/admin/users", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxGetUsers, ctrl.Admin.GetAllUsers, userManageOptions))
+	r.Post("/api/v1/admin/users/{id}/disable", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxDisableUser, ctrl.Admin.DisableUser, userManageOptions))
+	r.Post("/api/v1/admin/users/{id}/enable", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxEnableUser, ctrl.Admin.EnableUser, userManageOptions))
+	r.Post("/api/v1/admin/users/{id}/reset", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxResetDeposit, ctrl.Admin.ResetDeposit, depositResetOptions))
+	r.Put("/api/v1/admin/users/{id}/role", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxUpdateUserRole, ctrl.Admin.UpdateUserRole, userManageOptions))
+	r.Delete("/api/v1/admin/users/{id}", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDeleteUser, ctrl.Users.DeleteUser, userWriteOptions))
+	r.Put("/api/v1/admin/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxUpdateProduct, ctrl.Products.UpdateProduct, productWriteOptions))
+	r.Get("/api/v1/admin/reports/sales", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxGetSalesReport, ctrl.Admin.GetSalesReport, reportReadOptions))
+
+	t.Run("get all users", func(t *testing.T) {
+		t.Run("as admin", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/users", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("as seller", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/users", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+
+	t.Run("disable and enable user", func(t *testing.T) {
+		userToDisable, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		t.Run("disable", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/admin/users/%s/disable", userToDisable.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			userDetails := &payloads.UserDetails{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(userDetails); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if userDetails.DisabledAt == nil {
+				t.Fatalf("expected user to be disabled, got: %+v", userDetails)
+			}
+		})
+		t.Run("enable", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/admin/users/%s/enable", userToDisable.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("non-existing user", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/admin/users/%s/disable", uuid.NewV4()), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusNotFound {
+				t.Fatalf("expected http status code of 404 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+
+	t.Run("reset user deposit", func(t *testing.T) {
+		userToReset, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/admin/users/%s/reset", userToReset.ID), nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+		}
+		userDetails := &payloads.UserDetails{}
+		if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(userDetails); err != nil {
+			t.Fatalf("error decoding response body: %+v", err)
+		}
+		if userDetails.Deposit != 0 {
+			t.Fatalf("expected deposit to be reset, got: %+v", userDetails)
+		}
+	})
+
+	t.Run("update user role", func(t *testing.T) {
+		userToPromote, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		t.Run("with invalid role", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/v1/admin/users/%s/role", userToPromote.ID), bytes.NewBufferString(`{"role":"operator"}`))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected http status code of 400 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("with valid role", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/v1/admin/users/%s/role", userToPromote.ID), bytes.NewBufferString(fmt.Sprintf(`{"role":"%s"}`, models.UserRoleSeller)))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+
+	t.Run("update product of another seller", func(t *testing.T) {
+		productToUpdate, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		newName := strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/products", bytes.NewBufferString(fmt.Sprintf(`{"id":"%s","name":"%s"}`, productToUpdate.ID, newName)))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("delete another user", func(t *testing.T) {
+		userToDelete, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/admin/users/%s", userToDelete.ID), nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusNoContent {
+			t.Fatalf("expected http status code of 204 but got: %+v, %+v", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("get sales report", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/reports/sales", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+		}
+		report := &payloads.SalesReport{}
+		if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(report); err != nil {
+			t.Fatalf("error decoding response body: %+v", err)
+		}
+		if report.Purchases < 1 {
+			t.Fatalf("expected at least one purchase in sales report, got: %+v", report)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	uuid "github.com/satori/go.uuid"
+)
+
+// A CategoriesController handles HTTP requests that deal with product categories.
+type CategoriesController struct {
+	AuthenticatedController
+	categoryService *services.CategoryService
+}
+
+// GetCategoriesControllerDefaultInstance returns the default instance of CategoriesController.
+func GetCategoriesControllerDefaultInstance() *CategoriesController {
+	return GetControllersDefaultInstance().Categories
+}
+
+// NewCategoryController create a new instance of a category controller using the supplied category service, responder and authentication provider
+func NewCategoryController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, categoryService *services.CategoryService) *CategoriesController {
+	return newCategoryController(newAuthenticatedController(api.CmpController, responder, statelessAuthenticationProvider), categoryService)
+}
+
+func newCategoryController(authenticatedController AuthenticatedController, categoryService *services.CategoryService) *CategoriesController {
+	return &CategoriesController{
+		AuthenticatedController: authenticatedController,
+		categoryService:         categoryService,
+	}
+}
+
+// GetCategoryTree returns the root categories, each with its subcategories
+func (c *CategoriesController) GetCategoryTree(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetCategories, r.Header.Get("X-Request-Id"))
+	categories, err := c.categoryService.GetCategoryTree()
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrGetCategories, err), http.StatusBadRequest)
+		return
+	}
+
+	if err := render.Render(w, r, categories); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// GetCategoryByID returns the requested category by id, with its subcategories
+func (c *CategoriesController) GetCategoryByID(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetCategory, r.Header.Get("X-Request-Id"))
+	categoryID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid categoryId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	category, err := c.categoryService.GetCategoryByID(categoryID)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrCategoryNotFound, errors.New("no category with that id")), http.StatusNotFound)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrGetCategory, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, category); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// CreateCategory creates a new category, under the requested parent category if one is given
+func (c *CategoriesController) CreateCategory(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxCreateCategory, r.Header.Get("X-Request-Id"))
+	category := &payloads.CategoryPayload{}
+	if err := json.NewDecoder(r.Body).Decode(category); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode category")), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := category.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+
+	createdCategory, err := c.categoryService.CreateCategory(context.Background(), category)
+	if err != nil {
+		c.categoryError(w, errCtx, api.ErrCreateCategory, err)
+		return
+	}
+
+	c.responder.JSON(w, r, createdCategory, http.StatusCreated)
+}
+
+// UpdateCategory renames the requested category by id and moves it under the requested parent category
+func (c *CategoriesController) UpdateCategory(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxUpdateCategory, r.Header.Get("X-Request-Id"))
+	categoryID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid categoryId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	category := &payloads.CategoryPayload{}
+	if err := json.NewDecoder(r.Body).Decode(category); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode category")), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := category.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+
+	updatedCategory, err := c.categoryService.UpdateCategory(context.Background(), categoryID, category)
+	if err != nil {
+		c.categoryError(w, errCtx, api.ErrUpdateCategory, err)
+		return
+	}
+
+	if err := render.Render(w, r, updatedCategory); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// DeleteCategory deletes the requested category by id, which must not have subcategories
+func (c *CategoriesController) DeleteCategory(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxDeleteCategory, r.Header.Get("X-Request-Id"))
+	categoryID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid categoryId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.categoryService.DeleteCategory(context.Background(), categoryID); err != nil {
+		c.categoryError(w, errCtx, api.ErrDeleteCategory, err)
+		return
+	}
+	c.responder.NoContent(w)
+}
+
+// categoryError responds with the status matching the error of the category service
+func (c *CategoriesController) categoryError(w http.ResponseWriter, errCtx api.ErrorContextFn, responseErr *api.ResponseError, err error) {
+	switch err {
+	case db.ErrNoMatch:
+		c.responder.Error(w, errCtx(api.ErrCategoryNotFound, errors.New("no category with that id")), http.StatusNotFound)
+	case services.ErrUnknownCategory, services.ErrCategoryCycle:
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+	case services.ErrCategoryExists:
+		c.responder.Error(w, errCtx(api.ErrCategoryExists, err), http.StatusConflict)
+	case services.ErrCategoryHasChildren:
+		c.responder.Error(w, errCtx(api.ErrCategoryHasChildren, err), http.StatusConflict)
+	default:
+		c.responder.Error(w, errCtx(responseErr, err), http.StatusBadRequest)
+	}
+}
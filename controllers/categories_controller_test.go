@@ -0,0 +1,161 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/controllers"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/go-chi/chi"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestCategoryController(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+
+	ctrl := a.Controllers
+	admin, err := fixture.User.CreateAdminUser()
+	if err != nil {
+		t.Fatalf("could not create admin: %+v", err)
+	}
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	productReadOptions := controllers.RequirePermissions(auth.PermProductRead)
+	categoryWriteOptions := controllers.RequirePermissions(auth.PermCategoryWrite)
+
+	r := chi.NewRouter()
+	r.Get("/api/v1/categories", ctrl.AuthenticationRequired(ctrl.Categories.AuthenticatedController, api.CtxGetCategories, ctrl.Categories.GetCategoryTree, productReadOptions))
+	r.Get("/api/v1/categories/{id}", ctrl.AuthenticationRequired(ctrl.Categories.AuthenticatedController, api.CtxGetCategory, ctrl.Categories.GetCategoryByID, productReadOptions))
+	r.Post("/api/v1/categories", ctrl.AuthenticationRequired(ctrl.Categories.AuthenticatedController, api.CtxCreateCategory, ctrl.Categories.CreateCategory, categoryWriteOptions))
+	r.Put("/api/v1/categories/{id}", ctrl.AuthenticationRequired(ctrl.Categories.AuthenticatedController, api.CtxUpdateCategory, ctrl.Categories.UpdateCategory, categoryWriteOptions))
+	r.Delete("/api/v1/categories/{id}", ctrl.AuthenticationRequired(ctrl.Categories.AuthenticatedController, api.CtxDeleteCategory, ctrl.Categories.DeleteCategory, categoryWriteOptions))
+
+	parent, err := fixture.Category.CreateCategory(uuid.Nil)
+	if err != nil {
+		t.Fatalf("could not create category: %+v", err)
+	}
+
+	t.Run("create category", func(t *testing.T) {
+		t.Run("as seller", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/categories", bytes.NewBufferString(`{"name":"Snacks"}`))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("as admin", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/categories", bytes.NewBufferString(fmt.Sprintf(`{"name":"%s","parent_id":"%s"}`, uuid.NewV4(), parent.ID)))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusCreated {
+				t.Fatalf("expected http status code of 201 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			category := &models.Category{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(category); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if category.ParentID != parent.ID {
+				t.Fatalf("expected category under %s, got: %+v", parent.ID, category)
+			}
+		})
+	})
+
+	t.Run("get categories", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/categories", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("get category by id", func(t *testing.T) {
+		t.Run("existing category", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/categories/%s", parent.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("non-existing category", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/categories/%s", uuid.NewV4()), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusNotFound {
+				t.Fatalf("expected http status code of 404 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+
+	t.Run("update category", func(t *testing.T) {
+		category, err := fixture.Category.CreateCategory(uuid.Nil)
+		if err != nil {
+			t.Fatalf("could not create category: %+v", err)
+		}
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/v1/categories/%s", category.ID), bytes.NewBufferString(fmt.Sprintf(`{"name":"%s","parent_id":"%s"}`, category.Name, parent.ID)))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("delete category", func(t *testing.T) {
+		t.Run("with subcategories", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/categories/%s", parent.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusConflict {
+				t.Fatalf("expected http status code of 409 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("without subcategories", func(t *testing.T) {
+			category, err := fixture.Category.CreateCategory(uuid.Nil)
+			if err != nil {
+				t.Fatalf("could not create category: %+v", err)
+			}
+			req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/categories/%s", category.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusNoContent {
+				t.Fatalf("expected http status code of 204 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	uuid "github.com/satori/go.uuid"
+)
+
+// A CoinInventoryController handles HTTP requests that deal with the coins held by a machine.
+type CoinInventoryController struct {
+	AuthenticatedController
+	coinInventoryService *services.CoinInventoryService
+}
+
+// GetCoinInventoryControllerDefaultInstance returns the default instance of CoinInventoryController.
+func GetCoinInventoryControllerDefaultInstance() *CoinInventoryController {
+	return GetControllersDefaultInstance().Coins
+}
+
+// NewCoinInventoryController create a new instance of a coin inventory controller using the supplied coin inventory service, responder and authentication provider
+func NewCoinInventoryController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, coinInventoryService *services.CoinInventoryService) *CoinInventoryController {
+	return newCoinInventoryController(newAuthenticatedController(api.CmpController, responder, statelessAuthenticationProvider), coinInventoryService)
+}
+
+func newCoinInventoryController(authenticatedController AuthenticatedController, coinInventoryService *services.CoinInventoryService) *CoinInventoryController {
+	return &CoinInventoryController{
+		AuthenticatedController: authenticatedController,
+		coinInventoryService:    coinInventoryService,
+	}
+}
+
+// GetCoinInventory returns the number of coins of each denomination held by the requested machine
+func (c *CoinInventoryController) GetCoinInventory(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetCoinInventory, r.Header.Get("X-Request-Id"))
+	machineID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid machineId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	coins, err := c.coinInventoryService.GetCoinInventory(machineID)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrMachineNotFound, errors.New("no machine with that id")), http.StatusNotFound)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrGetCoinInventory, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, coins); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// RefillCoins adds coins to the coin tubes of the requested machine
+func (c *CoinInventoryController) RefillCoins(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxRefillCoins, r.Header.Get("X-Request-Id"))
+	machineID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid machineId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	refillCoins := &payloads.RefillCoinsPayload{}
+	if err := json.NewDecoder(r.Body).Decode(refillCoins); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode coins payload")), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	defer r.Body.Close()
+
+	coins, err := c.coinInventoryService.RefillCoins(ctx, machineID, refillCoins, userContext)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrMachineNotFound, errors.New("no machine with that id")), http.StatusNotFound)
+		} else if err == db.ErrUserForbidden {
+			c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrRefillCoins, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, coins); err != nil {
+		c.responder.Error(w, errCtx(api.ErrRefillCoins, err), http.StatusBadRequest)
+		return
+	}
+}
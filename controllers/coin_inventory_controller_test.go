@@ -0,0 +1,122 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/controllers"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/go-chi/chi"
+)
+
+func TestCoinInventoryController(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+
+	ctrl := a.Controllers
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	secondSeller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateMachine(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create machine: %+v", err)
+	}
+	machineWriteOptions := controllers.RequirePermissions(auth.PermMachineWrite.Own(), auth.PermMachineWrite.Any())
+
+	t.Run("get coin inventory", func(t *testing.T) {
+		r := chi.NewRouter()
+		URL := fmt.Sprintf("/api/v1/machines/%s/coins", machine.ID.String())
+		r.Get("/api/v1/machines/{id}/coins", ctrl.AuthenticationRequired(ctrl.Coins.AuthenticatedController, api.CtxGetCoinInventory, ctrl.Coins.GetCoinInventory, machineWriteOptions))
+
+		t.Run("as buyer", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, URL, nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("as seller", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, URL, nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+
+	t.Run("refill coins", func(t *testing.T) {
+		r := chi.NewRouter()
+		URL := fmt.Sprintf("/api/v1/machines/%s/coins/refill", machine.ID.String())
+		r.Post("/api/v1/machines/{id}/coins/refill", ctrl.AuthenticationRequired(ctrl.Coins.AuthenticatedController, api.CtxRefillCoins, ctrl.Coins.RefillCoins, machineWriteOptions))
+
+		t.Run("with acceptable denominations", func(t *testing.T) {
+			bBuf := bytes.NewBuffer([]byte(`{"coins":{"100":10,"5":20}}`))
+			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+
+			coinList := &payloads.CoinInventoryList{}
+			dec := json.NewDecoder(strings.NewReader(res.Body.String()))
+			if err := dec.Decode(coinList); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if coinList.Total != 1100 {
+				t.Fatalf("expected coin inventory total to be 1100, got: %d", coinList.Total)
+			}
+		})
+		t.Run("with unacceptable denomination", func(t *testing.T) {
+			bBuf := bytes.NewBuffer([]byte(`{"coins":{"3":10}}`))
+			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected http status code of 400 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("as seller not operating the machine", func(t *testing.T) {
+			bBuf := bytes.NewBuffer([]byte(`{"coins":{"100":10}}`))
+			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondSeller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+}
@@ -3,19 +3,30 @@ package controllers
 import (
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/dhurimkelmendi/vending_machine/api"
 	"github.com/dhurimkelmendi/vending_machine/auth"
-	"github.com/dhurimkelmendi/vending_machine/helpers"
-	"github.com/dhurimkelmendi/vending_machine/models"
 	"github.com/dhurimkelmendi/vending_machine/services"
 )
 
 // Controllers is a struct that contains references to all controller instances.
 type Controllers struct {
-	userService *services.UserService
-	Users       *UsersController
-	Products    *ProductsController
+	userService        *services.UserService
+	idempotencyService *services.IdempotencyService
+	policy             *auth.Policy
+	Users              *UsersController
+	Products           *ProductsController
+	Categories         *CategoriesController
+	Promotions         *PromotionsController
+	Purchases          *PurchasesController
+	Accounts           *AccountsController
+	Payouts            *PayoutsController
+	Machines           *MachinesController
+	Coins              *CoinInventoryController
+	Sync               *SyncController
+	WellKnown          *WellKnownController
+	Admin              *AdminController
 }
 
 // Controller is a struct that contains references to error components and responders
@@ -30,25 +41,72 @@ type AuthenticatedController struct {
 	statelessAuthenticationProvider *auth.StatelessAuthenticationProvider
 }
 
-// AuthorizationOptions is a struct that contains references to allowed user roles
+// AuthorizationOptions is a struct that contains the permissions of which the user needs at least one,
+// no permissions allow every authenticated user
 type AuthorizationOptions struct {
-	AllowedUserRoles []models.UserRole
+	Permissions []auth.Permission
 }
 
-var controllersDefaultInstance *Controllers
+// RequirePermissions returns AuthorizationOptions that allow users granted at least one of the permissions
+func RequirePermissions(permissions ...auth.Permission) AuthorizationOptions {
+	return AuthorizationOptions{Permissions: permissions}
+}
+
+var (
+	controllersDefaultInstance     *Controllers
+	controllersDefaultInstanceOnce sync.Once
+)
 
 // GetControllersDefaultInstance returns default instances of all available Controllers
 func GetControllersDefaultInstance() *Controllers {
-	if controllersDefaultInstance == nil {
-		controllersDefaultInstance = &Controllers{
-			userService: services.GetUserServiceDefaultInstance(),
-			Users:       GetUsersControllerDefaultInstance(),
-			Products:    GetProductsControllerDefaultInstance(),
-		}
-	}
+	controllersDefaultInstanceOnce.Do(func() {
+		controllersDefaultInstance = New(
+			services.GetDefaultInstance(),
+			auth.GetPolicyDefaultInstance(),
+			auth.GetStatelessAuthenticationProviderDefaultInstance(),
+			api.GetResponderDefaultInstance(),
+		)
+	})
 	return controllersDefaultInstance
 }
 
+// New creates all controllers for the given services, responding with the responder and authenticating users with
+// the stateless authentication provider
+func New(svc *services.Services, policy *auth.Policy, stateless *auth.StatelessAuthenticationProvider, responder *api.Responder) *Controllers {
+	authenticatedController := newAuthenticatedController(api.CmpController, responder, stateless)
+	return &Controllers{
+		userService:        svc.Users,
+		idempotencyService: svc.Idempotency,
+		policy:             policy,
+		Users:              newUserController(authenticatedController, svc.Users, svc.Tokens),
+		Products:           newProductController(authenticatedController, svc.Products, svc.ProductPrices, svc.Users),
+		Categories:         newCategoryController(authenticatedController, svc.Categories),
+		Promotions:         newPromotionController(authenticatedController, svc.Promotions),
+		Purchases:          newPurchaseController(authenticatedController, svc.Purchases, svc.Users),
+		Accounts:           newAccountController(authenticatedController, svc.Accounts),
+		Payouts:            newPayoutController(authenticatedController, svc.Payouts),
+		Machines:           newMachineController(authenticatedController, svc.Machines),
+		Coins:              newCoinInventoryController(authenticatedController, svc.CoinInventory),
+		Sync:               newSyncController(authenticatedController, svc.Sync),
+		WellKnown:          newWellKnownController(authenticatedController.Controller, stateless),
+		Admin:              newAdminController(newAuthenticatedController(api.CmpAdminController, responder, stateless), svc.Users, svc.Purchases),
+	}
+}
+
+func newController(errorComponent api.ErrorComponent, responder *api.Responder) Controller {
+	return Controller{
+		errCmp:    api.NewErrorComponent(errorComponent),
+		responder: responder,
+	}
+}
+
+func newAuthenticatedController(errorComponent api.ErrorComponent, responder *api.Responder, stateless *auth.StatelessAuthenticationProvider) AuthenticatedController {
+	return AuthenticatedController{
+		Controller:                      newController(errorComponent, responder),
+		statelessAuthenticationProvider: stateless,
+	}
+}
+
 // AuthenticatedHandlerFunc is a handler function type that requires authorization
 type AuthenticatedHandlerFunc func(http.ResponseWriter, *http.Request, auth.UserContext)
 
@@ -62,7 +120,7 @@ func (cs *Controllers) AuthenticationRequired(c AuthenticatedController, errorCo
 			return
 		}
 
-		if !helpers.UserRolesContains(opts.AllowedUserRoles, userContext.Role) {
+		if !cs.policy.AllowsAny(userContext.Role, opts.Permissions...) {
 			c.Controller.responder.Error(w, errCtx(api.ErrUserForbidden, fmt.Errorf("user is forbidden")))
 			return
 		}
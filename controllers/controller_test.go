@@ -2,21 +2,40 @@ package controllers_test
 
 import (
 	"strings"
+	"testing"
 
 	"github.com/brianvoe/gofakeit"
+	"github.com/dhurimkelmendi/vending_machine/app"
 	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/fixtures"
+	"github.com/dhurimkelmendi/vending_machine/internal/dbtest"
 	"github.com/dhurimkelmendi/vending_machine/models"
 	uuid "github.com/satori/go.uuid"
 )
 
-func GetInvalidAuthToken() (string, error) {
-	stateless := auth.GetStatelessAuthenticationProviderDefaultInstance()
+// newTestApp builds an app from the environment config on an empty store of the driver TEST_DB_DRIVER selects, the
+// memory driver by default, so every test runs on its own data, and fixtures creating their records with its services
+func newTestApp(t *testing.T) (*app.App, *fixtures.Fixtures) {
+	cfg := config.Load()
+	dbtest.Configure(t, cfg)
+	a, err := app.New(cfg)
+	if err != nil {
+		t.Fatalf("error while building app %+v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a, fixtures.New(cfg, a.Services)
+}
 
+func GetInvalidAuthToken(stateless *auth.StatelessAuthenticationProvider) (string, error) {
 	mockUser := &models.User{}
 	mockUser.ID = uuid.NewV4()
 	mockUser.Username = strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
 	mockUser.Role = models.UserRoleBuyer
-	mockUser.Token = gofakeit.BS()
 	mockUser.Deposit = gofakeit.Int32()
-	return stateless.CreateUserAuthToken(mockUser)
+	token, err := stateless.CreateUserAuthToken(mockUser)
+	if err != nil {
+		return "", err
+	}
+	return token.Token, nil
 }
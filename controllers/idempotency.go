@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	"github.com/sirupsen/logrus"
+)
+
+// IdempotencyKeyHeader is the request header clients use to make retries of a request safe
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on responses that are replayed from a previous request
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+const maxIdempotencyKeyLength = 255
+
+// Idempotent makes the handler safe to retry: the first response to a request carrying an Idempotency-Key header is
+// stored and replayed for every retry with the same key, without running the handler again.
+// The key is released when the handler fails with a server error or panics before committing a change, so that the
+// request can be retried, and kept once it has committed one. Requests without the header are passed through unchanged
+func (cs *Controllers) Idempotent(c AuthenticatedController, errorContext api.ErrorContext, fn AuthenticatedHandlerFunc) AuthenticatedHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			fn(w, r, userContext)
+			return
+		}
+
+		errCtx := c.Controller.errCmp(errorContext, r.Header.Get("X-Request-Id"))
+		if len(key) > maxIdempotencyKeyLength {
+			c.Controller.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("idempotency key must be at most %d characters", maxIdempotencyKeyLength)), http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			c.Controller.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := r.Context()
+		storedResponse, err := cs.idempotencyService.BeginRequest(ctx, userContext.ID, key, hashRequest(r, body))
+		if err != nil {
+			switch err {
+			case services.ErrIdempotencyKeyReused:
+				c.Controller.responder.Error(w, errCtx(api.ErrIdempotencyKeyReused, err), http.StatusConflict)
+			case services.ErrIdempotencyKeyInProgress:
+				c.Controller.responder.Error(w, errCtx(api.ErrIdempotencyKeyInProgress, err), http.StatusConflict)
+			default:
+				c.Controller.responder.Error(w, errCtx(api.ErrIdempotencyKey, err))
+			}
+			return
+		}
+
+		if storedResponse != nil {
+			if storedResponse.ContentType != "" {
+				w.Header().Set("Content-Type", storedResponse.ContentType)
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(storedResponse.Status)
+			if _, err := w.Write(storedResponse.Body); err != nil {
+				logrus.Errorf("Error writing replayed response: %+v", err)
+			}
+			return
+		}
+
+		// once the handler has committed a change the key is kept, so that a retry cannot apply the change again
+		committed := false
+		r = r.WithContext(repositories.WithCommitNotifier(ctx, func() { committed = true }))
+		recorder := newResponseRecorder(w)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// a panic after the commit is stored as a server error, so that a retry does not run the handler again
+			var err error
+			if committed {
+				err = cs.idempotencyService.CompleteRequest(ctx, userContext.ID, key, http.StatusInternalServerError, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+			} else {
+				err = cs.idempotencyService.ReleaseRequest(ctx, userContext.ID, key)
+			}
+			if err != nil {
+				logrus.Errorf("Error storing response for idempotency key %s: %+v", key, err)
+			}
+			panic(recovered)
+		}()
+		fn(recorder, r, userContext)
+
+		// server errors before the commit are not stored, so that the request can be retried with the same key
+		if recorder.status >= http.StatusInternalServerError && !committed {
+			err = cs.idempotencyService.ReleaseRequest(ctx, userContext.ID, key)
+		} else {
+			err = cs.idempotencyService.CompleteRequest(ctx, userContext.ID, key, recorder.status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		}
+		if err != nil {
+			logrus.Errorf("Error storing response for idempotency key %s: %+v", key, err)
+		}
+	}
+}
+
+// hashRequest returns a fingerprint of the request, used to detect an idempotency key being reused for another request
+func hashRequest(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder writes the response through to the underlying http.ResponseWriter,
+// keeping a copy of the status code and body
+type responseRecorder struct {
+	w      http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{w: w}
+}
+
+// Header calls the underlying http.ResponseWriter's `Header` method.
+func (r *responseRecorder) Header() http.Header {
+	return r.w.Header()
+}
+
+// Write copies the body before calling the underlying http.ResponseWriter's `Write` method.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.w.Write(b)
+}
+
+// WriteHeader saves the status code before calling the underlying http.ResponseWriter's `WriteHeader` method.
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.w.WriteHeader(status)
+}
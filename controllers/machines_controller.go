@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	uuid "github.com/satori/go.uuid"
+)
+
+// A MachinesController handles HTTP requests that deal with vending machines and their slots.
+type MachinesController struct {
+	AuthenticatedController
+	machineService *services.MachineService
+}
+
+// GetMachinesControllerDefaultInstance returns the default instance of MachinesController.
+func GetMachinesControllerDefaultInstance() *MachinesController {
+	return GetControllersDefaultInstance().Machines
+}
+
+// NewMachineController create a new instance of a machine controller using the supplied machine service, responder and authentication provider
+func NewMachineController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, machineService *services.MachineService) *MachinesController {
+	return newMachineController(newAuthenticatedController(api.CmpController, responder, statelessAuthenticationProvider), machineService)
+}
+
+func newMachineController(authenticatedController AuthenticatedController, machineService *services.MachineService) *MachinesController {
+	return &MachinesController{
+		AuthenticatedController: authenticatedController,
+		machineService:          machineService,
+	}
+}
+
+// GetAllMachines returns all machines
+func (c *MachinesController) GetAllMachines(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetMachines, r.Header.Get("X-Request-Id"))
+	machines, err := c.machineService.GetAllMachines()
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrGetMachines, err), http.StatusBadRequest)
+		return
+	}
+
+	if err := render.Render(w, r, machines); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// GetMachineByID returns the requested machine by id, with its slots
+func (c *MachinesController) GetMachineByID(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetMachine, r.Header.Get("X-Request-Id"))
+	machineID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid machineId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	machine, err := c.machineService.GetMachineByID(machineID)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrMachineNotFound, errors.New("no machine with that id")), http.StatusNotFound)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrGetMachine, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, machine); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// CreateMachine creates a new machine operated by the current user
+func (c *MachinesController) CreateMachine(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxCreateMachine, r.Header.Get("X-Request-Id"))
+	machine := &payloads.CreateMachinePayload{}
+	if err := json.NewDecoder(r.Body).Decode(machine); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode machine")), http.StatusBadRequest)
+		return
+	}
+
+	if err := machine.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	defer r.Body.Close()
+
+	createdMachine, err := c.machineService.CreateMachine(ctx, machine, userContext.ID)
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreateMachine, err), http.StatusBadRequest)
+		return
+	}
+
+	c.responder.JSON(w, r, createdMachine, http.StatusCreated)
+}
+
+// AssignSlot puts a product into the slot with the requested code of the requested machine
+func (c *MachinesController) AssignSlot(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxAssignSlot, r.Header.Get("X-Request-Id"))
+	machineID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid machineId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	slot := &payloads.AssignSlotPayload{}
+	if err := json.NewDecoder(r.Body).Decode(slot); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode slot")), http.StatusBadRequest)
+		return
+	}
+	slot.Code = strings.ToUpper(chi.URLParam(r, "code"))
+
+	if err := slot.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	defer r.Body.Close()
+
+	assignedSlot, err := c.machineService.AssignSlot(ctx, machineID, slot, userContext)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrMachineNotFound, errors.New("no machine or product with that id")), http.StatusNotFound)
+		} else if err == db.ErrUserForbidden {
+			c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrAssignSlot, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, assignedSlot); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,134 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/controllers"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/go-chi/chi"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestMachineController(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+
+	ctrl := a.Controllers
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	secondSeller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateMachine(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create machine: %+v", err)
+	}
+	machineReadOptions := controllers.RequirePermissions(auth.PermMachineRead)
+	machineCreateOptions := controllers.RequirePermissions(auth.PermMachineCreate)
+	machineWriteOptions := controllers.RequirePermissions(auth.PermMachineWrite.Own(), auth.PermMachineWrite.Any())
+
+	t.Run("create machine", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Post("/api/v1/machines", ctrl.AuthenticationRequired(ctrl.Machines.AuthenticatedController, api.CtxCreateMachine, ctrl.Machines.CreateMachine, machineCreateOptions))
+
+		t.Run("as buyer", func(t *testing.T) {
+			bBuf := bytes.NewBuffer([]byte(`{"name":"Lobby","location":"Ground floor"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/machines", bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			ExpectStatusCode(t, res, http.StatusForbidden)
+		})
+		t.Run("as seller", func(t *testing.T) {
+			bBuf := bytes.NewBuffer([]byte(`{"name":"Lobby","location":"Ground floor"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/machines", bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			ExpectStatusCode(t, res, http.StatusCreated)
+			ExpectJson(t, res)
+		})
+	})
+
+	t.Run("assign slot", func(t *testing.T) {
+		r := chi.NewRouter()
+		URL := fmt.Sprintf("/api/v1/machines/%s/slots/a1", machine.ID.String())
+		r.Put("/api/v1/machines/{id}/slots/{code}", ctrl.AuthenticationRequired(ctrl.Machines.AuthenticatedController, api.CtxAssignSlot, ctrl.Machines.AssignSlot, machineWriteOptions))
+
+		t.Run("as operator", func(t *testing.T) {
+			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"product_id":"%s","capacity":10,"quantity":5}`, product.ID.String())))
+			req := httptest.NewRequest(http.MethodPut, URL, bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			ExpectStatusCode(t, res, http.StatusOK)
+			slot := &models.Slot{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(slot); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if slot.Code != "A1" || slot.ProductID != product.ID || slot.Quantity != 5 {
+				t.Fatalf("unexpected slot, got: %+v", slot)
+			}
+		})
+		t.Run("as seller not operating the machine", func(t *testing.T) {
+			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"product_id":"%s","capacity":10,"quantity":5}`, product.ID.String())))
+			req := httptest.NewRequest(http.MethodPut, URL, bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondSeller.Token))
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			ExpectStatusCode(t, res, http.StatusForbidden)
+		})
+	})
+
+	t.Run("get machine", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Get("/api/v1/machines/{id}", ctrl.AuthenticationRequired(ctrl.Machines.AuthenticatedController, api.CtxGetMachine, ctrl.Machines.GetMachineByID, machineReadOptions))
+
+		t.Run("existing machine", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/machines/%s", machine.ID.String()), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			ExpectStatusCode(t, res, http.StatusOK)
+			returnedMachine := &models.Machine{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(returnedMachine); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if returnedMachine.ID != machine.ID || len(returnedMachine.Slots) != 1 {
+				t.Fatalf("expected the machine with its slot, got: %+v", returnedMachine)
+			}
+		})
+		t.Run("non-existing machine", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/machines/%s", uuid.NewV4().String()), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			ExpectStatusCode(t, res, http.StatusNotFound)
+		})
+	})
+}
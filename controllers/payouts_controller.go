@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// A PayoutsController handles HTTP requests that deal with payouts.
+type PayoutsController struct {
+	AuthenticatedController
+	payoutService *services.PayoutService
+}
+
+// GetPayoutsControllerDefaultInstance returns the default instance of PayoutsController.
+func GetPayoutsControllerDefaultInstance() *PayoutsController {
+	return GetControllersDefaultInstance().Payouts
+}
+
+// NewPayoutController create a new instance of a payout controller using the supplied payout service, responder and authentication provider
+func NewPayoutController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, payoutService *services.PayoutService) *PayoutsController {
+	return newPayoutController(newAuthenticatedController(api.CmpController, responder, statelessAuthenticationProvider), payoutService)
+}
+
+func newPayoutController(authenticatedController AuthenticatedController, payoutService *services.PayoutService) *PayoutsController {
+	return &PayoutsController{
+		AuthenticatedController: authenticatedController,
+		payoutService:           payoutService,
+	}
+}
+
+// GetPayouts returns the payouts visible to the current user
+func (c *PayoutsController) GetPayouts(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetPayouts, r.Header.Get("X-Request-Id"))
+	payouts, err := c.payoutService.GetPayouts(userContext)
+	if err != nil {
+		c.payoutError(w, errCtx, api.ErrGetPayouts, err)
+		return
+	}
+
+	if err := render.Render(w, r, payouts); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// GetPayoutByID returns the requested payout by id
+func (c *PayoutsController) GetPayoutByID(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetPayout, r.Header.Get("X-Request-Id"))
+	payoutID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid payoutId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	payout, err := c.payoutService.GetPayoutByID(payoutID, userContext)
+	if err != nil {
+		c.payoutError(w, errCtx, api.ErrGetPayout, err)
+		return
+	}
+
+	if err := render.Render(w, r, payout); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// GetPayoutStatement returns the requested payout by id with the sales it includes, as JSON or, with the
+// `format=csv` query parameter, as a CSV file of the sales
+func (c *PayoutsController) GetPayoutStatement(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetPayoutStatement, r.Header.Get("X-Request-Id"))
+	payoutID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid payoutId, %v", err)), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, errors.New("format must be json or csv")), http.StatusBadRequest)
+		return
+	}
+
+	statement, err := c.payoutService.GetPayoutStatement(payoutID, userContext)
+	if err != nil {
+		c.payoutError(w, errCtx, api.ErrGetPayoutStatement, err)
+		return
+	}
+
+	if format == "csv" {
+		buf := &bytes.Buffer{}
+		if err := statement.WriteCSV(buf); err != nil {
+			c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="payout-%s.csv"`, payoutID))
+		if _, err := buf.WriteTo(w); err != nil {
+			logrus.Errorf("Error writing CSV response: %+v", err)
+		}
+		return
+	}
+	if err := render.Render(w, r, statement); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// RequestPayout requests a payout of the revenue of the current seller that was not paid out yet
+func (c *PayoutsController) RequestPayout(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxRequestPayout, r.Header.Get("X-Request-Id"))
+	payout, err := c.payoutService.RequestPayout(r.Context(), userContext.ID)
+	if err != nil {
+		c.payoutError(w, errCtx, api.ErrRequestPayout, err)
+		return
+	}
+
+	c.responder.JSON(w, r, payout, http.StatusCreated)
+}
+
+// ApprovePayout approves the requested payout by id and sends it to the seller
+func (c *PayoutsController) ApprovePayout(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	c.decidePayout(w, r, userContext, api.CtxApprovePayout, api.ErrApprovePayout, c.payoutService.ApprovePayout)
+}
+
+// RejectPayout rejects the requested payout by id
+func (c *PayoutsController) RejectPayout(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	c.decidePayout(w, r, userContext, api.CtxRejectPayout, api.ErrRejectPayout, c.payoutService.RejectPayout)
+}
+
+// payoutDecision approves or rejects a payout
+type payoutDecision func(context.Context, uuid.UUID, *payloads.DecidePayoutPayload, auth.UserContext) (*models.Payout, error)
+
+// decidePayout decodes the decision on the requested payout by id and records it
+func (c *PayoutsController) decidePayout(w http.ResponseWriter, r *http.Request, userContext auth.UserContext, ctx api.ErrorContext, responseErr *api.ResponseError, decide payoutDecision) {
+	errCtx := c.errCmp(ctx, r.Header.Get("X-Request-Id"))
+	payoutID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid payoutId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	decision := &payloads.DecidePayoutPayload{}
+	if err := json.NewDecoder(r.Body).Decode(decision); err != nil && err != io.EOF {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode decision")), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := decision.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+
+	payout, err := decide(r.Context(), payoutID, decision, userContext)
+	if err != nil {
+		c.payoutError(w, errCtx, responseErr, err)
+		return
+	}
+
+	if err := render.Render(w, r, payout); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// payoutError responds with the status matching the error of a payout request
+func (c *PayoutsController) payoutError(w http.ResponseWriter, errCtx api.ErrorContextFn, responseErr *api.ResponseError, err error) {
+	switch err {
+	case db.ErrNoMatch:
+		c.responder.Error(w, errCtx(api.ErrPayoutNotFound, errors.New("no payout with that id")), http.StatusNotFound)
+	case db.ErrUserForbidden:
+		c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+	case services.ErrPayoutPending:
+		c.responder.Error(w, errCtx(api.ErrPayoutPending, err), http.StatusConflict)
+	case services.ErrNothingToPayOut:
+		c.responder.Error(w, errCtx(api.ErrNothingToPayOut, err), http.StatusConflict)
+	case services.ErrPayoutDecided:
+		c.responder.Error(w, errCtx(api.ErrPayoutDecided, err), http.StatusConflict)
+	default:
+		c.responder.Error(w, errCtx(responseErr, err), http.StatusBadRequest)
+	}
+}
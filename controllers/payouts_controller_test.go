@@ -0,0 +1,189 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/controllers"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/go-chi/chi"
+)
+
+func TestPayoutController(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+
+	ctrl := a.Controllers
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	admin, err := fixture.User.CreateAdminUser()
+	if err != nil {
+		t.Fatalf("could not create admin: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	report, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, buyer.ID)
+	if err != nil {
+		t.Fatalf("could not create purchase: %+v", err)
+	}
+	purchase := report.Purchases[0]
+	sellerContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+	if _, err := a.Services.Users.ConfirmPurchase(context.Background(), purchase.ID, sellerContext); err != nil {
+		t.Fatalf("confirm purchase failed: %+v", err)
+	}
+	payoutReadOptions := controllers.RequirePermissions(auth.PermPayoutRead.Own(), auth.PermPayoutRead.Any())
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/payouts", ctrl.AuthenticationRequired(ctrl.Payouts.AuthenticatedController, api.CtxRequestPayout, ctrl.Payouts.RequestPayout, controllers.RequirePermissions(auth.PermPayoutRequest)))
+	r.Get("/api/v1/payouts/{id}/statement", ctrl.AuthenticationRequired(ctrl.Payouts.AuthenticatedController, api.CtxGetPayoutStatement, ctrl.Payouts.GetPayoutStatement, payoutReadOptions))
+	r.Post("/api/v1/admin/payouts/{id}/approve", ctrl.AuthenticationRequired(ctrl.Payouts.AuthenticatedController, api.CtxApprovePayout, ctrl.Payouts.ApprovePayout, controllers.RequirePermissions(auth.PermPayoutApprove)))
+
+	payout := &models.Payout{}
+	t.Run("request payout", func(t *testing.T) {
+		t.Run("as buyer", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/payouts", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("as seller", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/payouts", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusCreated {
+				t.Fatalf("expected http status code of 201 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(payout); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if payout.Amount != int64(purchase.Total-purchase.PlatformFee) || payout.Status != models.PayoutStatusRequested {
+				t.Fatalf("expected a requested payout of the purchase, got: %+v", payout)
+			}
+		})
+		t.Run("while pending", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/payouts", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusConflict {
+				t.Fatalf("expected http status code of 409 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+
+	t.Run("approve payout", func(t *testing.T) {
+		t.Run("as seller", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/admin/payouts/%s/approve", payout.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("as admin", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/admin/payouts/%s/approve", payout.ID), strings.NewReader(`{"note":"paid"}`))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", admin.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			approved := &models.Payout{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(approved); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if approved.Status != models.PayoutStatusApproved || approved.Note != "paid" {
+				t.Fatalf("expected the payout to be approved, got: %+v", approved)
+			}
+		})
+	})
+
+	t.Run("get payout statement", func(t *testing.T) {
+		t.Run("as json", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/payouts/%s/statement", payout.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			statement := &payloads.PayoutStatement{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(statement); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if len(statement.Sales) != 1 || statement.Sales[0].PurchaseID != purchase.ID {
+				t.Fatalf("expected the purchase in the statement, got: %+v", statement.Sales)
+			}
+		})
+		t.Run("as csv", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/payouts/%s/statement?format=csv", payout.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			if contentType := res.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+				t.Fatalf("expected a CSV response, got: %s", contentType)
+			}
+			lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+			if len(lines) != 2 || !strings.HasPrefix(lines[0], "purchase_id,") || !strings.HasPrefix(lines[1], purchase.ID.String()) {
+				t.Fatalf("expected a header and one sale, got: %s", res.Body.String())
+			}
+		})
+		t.Run("as another seller", func(t *testing.T) {
+			otherSeller, err := fixture.User.CreateSellerUser()
+			if err != nil {
+				t.Fatalf("could not create seller: %+v", err)
+			}
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/payouts/%s/statement", payout.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", otherSeller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+}
@@ -6,11 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/dhurimkelmendi/vending_machine/api"
 	"github.com/dhurimkelmendi/vending_machine/auth"
 	"github.com/dhurimkelmendi/vending_machine/db"
-	"github.com/dhurimkelmendi/vending_machine/models"
 	"github.com/dhurimkelmendi/vending_machine/payloads"
 	"github.com/dhurimkelmendi/vending_machine/services"
 	"github.com/go-chi/chi"
@@ -22,44 +22,72 @@ import (
 type ProductsController struct {
 	AuthenticatedController
 	productService *services.ProductService
+	priceService   *services.ProductPriceService
 	userService    *services.UserService
 }
 
-var productsControllerDefaultInstance *ProductsController
-
 // GetProductsControllerDefaultInstance returns the default instance of ProductController.
 func GetProductsControllerDefaultInstance() *ProductsController {
-	if productsControllerDefaultInstance == nil {
-		productsControllerDefaultInstance = NewProductController(services.GetProductServiceDefaultInstance(), services.GetUserServiceDefaultInstance())
-	}
-
-	return productsControllerDefaultInstance
+	return GetControllersDefaultInstance().Products
 }
 
-// NewProductController create a new instance of a product controller using the supplied services
-func NewProductController(productService *services.ProductService, userService *services.UserService) *ProductsController {
-	controller := Controller{
-		errCmp:    api.NewErrorComponent(api.CmpController),
-		responder: api.GetResponderDefaultInstance(),
-	}
-	authenticatedController := AuthenticatedController{
-		Controller:                      controller,
-		statelessAuthenticationProvider: auth.GetStatelessAuthenticationProviderDefaultInstance(),
-	}
+// NewProductController create a new instance of a product controller using the supplied services, responder and authentication provider
+func NewProductController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, productService *services.ProductService, priceService *services.ProductPriceService, userService *services.UserService) *ProductsController {
+	return newProductController(newAuthenticatedController(api.CmpController, responder, statelessAuthenticationProvider), productService, priceService, userService)
+}
 
+func newProductController(authenticatedController AuthenticatedController, productService *services.ProductService, priceService *services.ProductPriceService, userService *services.UserService) *ProductsController {
 	return &ProductsController{
 		AuthenticatedController: authenticatedController,
 		productService:          productService,
+		priceService:            priceService,
 		userService:             userService,
 	}
 }
 
-// GetAllProducts returns all active (non-deleted) products
+// GetAllProducts returns a page of the products matching the `name`, `min_cost`, `max_cost`, `seller_id`,
+// `in_stock`, `category_id` and `tag` query parameters, sorted by `name` or `cost`. Pages are requested with
+// `limit` and `cursor`
 func (c *ProductsController) GetAllProducts(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
 	errCtx := c.errCmp(api.CtxGetProducts, r.Header.Get("X-Request-Id"))
-	products, err := c.productService.GetAllProducts()
+	filter, err := payloads.ParseProductFilter(r.URL.Query())
 	if err != nil {
-		c.responder.Error(w, errCtx(api.ErrGetProducts, err), http.StatusBadRequest)
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, err), http.StatusBadRequest)
+		return
+	}
+
+	products, err := c.productService.GetAllProducts(filter)
+	if err != nil {
+		if err == services.ErrInvalidListParams {
+			c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, err), http.StatusBadRequest)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrGetProducts, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, products); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// SearchProducts returns the products best matching the `q` query parameter, at most `limit` of them
+func (c *ProductsController) SearchProducts(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxSearchProduct, r.Header.Get("X-Request-Id"))
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	if text == "" {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, errors.New("q is a required parameter")), http.StatusBadRequest)
+		return
+	}
+	listParams, err := payloads.ParseListParams(r.URL.Query())
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, err), http.StatusBadRequest)
+		return
+	}
+
+	products, err := c.productService.SearchProducts(text, listParams.Limit)
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrSearchProducts, err), http.StatusBadRequest)
 		return
 	}
 
@@ -96,11 +124,6 @@ func (c *ProductsController) GetProductByID(w http.ResponseWriter, r *http.Reque
 // CreateProduct creates a new product and returns product details with an authentication token
 func (c *ProductsController) CreateProduct(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
 	errCtx := c.errCmp(api.CtxCreateProduct, r.Header.Get("X-Request-Id"))
-	currentUser, err := c.userService.GetUserByID(userContext.ID)
-	if currentUser.Role != models.UserRoleSeller {
-		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("access denied for non-seller users")), http.StatusForbidden)
-		return
-	}
 	product := &payloads.CreateProductPayload{}
 	if err := json.NewDecoder(r.Body).Decode(product); err != nil {
 		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot decode product")), http.StatusBadRequest)
@@ -108,13 +131,17 @@ func (c *ProductsController) CreateProduct(w http.ResponseWriter, r *http.Reques
 	}
 
 	if err := product.Validate(); err != nil {
-		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("request body not valid, missing required fields")), http.StatusBadRequest)
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, fmt.Errorf("request body not valid, %v", err)), http.StatusBadRequest)
 		return
 	}
 
 	createdProduct, err := c.productService.CreateProduct(context.Background(), product, userContext.ID)
 	if err != nil {
-		c.responder.Error(w, errCtx(api.ErrCreateProduct, err), http.StatusBadRequest)
+		if err == services.ErrUnknownCategory {
+			c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrCreateProduct, err), http.StatusBadRequest)
+		}
 		return
 	}
 	defer r.Body.Close()
@@ -133,7 +160,7 @@ func (c *ProductsController) UpdateProduct(w http.ResponseWriter, r *http.Reques
 	}
 
 	if err := product.Validate(); err != nil {
-		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("request body not valid")), http.StatusBadRequest)
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, fmt.Errorf("request body not valid, %v", err)), http.StatusBadRequest)
 		return
 	}
 
@@ -142,7 +169,11 @@ func (c *ProductsController) UpdateProduct(w http.ResponseWriter, r *http.Reques
 
 	updatedProduct, err := c.productService.UpdateProduct(ctx, product, userContext)
 	if err != nil {
-		c.responder.Error(w, errCtx(api.ErrUpdateProduct, err), http.StatusBadRequest)
+		if err == services.ErrUnknownCategory {
+			c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrUpdateProduct, err), http.StatusBadRequest)
+		}
 		return
 	}
 
@@ -168,6 +199,8 @@ func (c *ProductsController) DeleteProduct(w http.ResponseWriter, r *http.Reques
 			c.responder.Error(w, errCtx(api.ErrProductNotFound, errors.New("no product with that id")), http.StatusNotFound)
 		} else if err == db.ErrUserForbidden {
 			c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+		} else if err == services.ErrProductHasPurchases {
+			c.responder.Error(w, errCtx(api.ErrProductHasPurchases, err), http.StatusConflict)
 		} else {
 			c.responder.Error(w, errCtx(api.ErrDeleteProduct, err), http.StatusBadRequest)
 		}
@@ -175,3 +208,92 @@ func (c *ProductsController) DeleteProduct(w http.ResponseWriter, r *http.Reques
 	}
 	c.responder.NoContent(w)
 }
+
+// GetProductPrices returns the past, current and scheduled prices of the requested product by id
+func (c *ProductsController) GetProductPrices(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetProductPrices, r.Header.Get("X-Request-Id"))
+	productID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid productId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	prices, err := c.priceService.GetPriceHistory(productID)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrProductNotFound, errors.New("no product with that id")), http.StatusNotFound)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrGetProductPrices, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, prices); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// ScheduleProductPrice schedules a future change of the cost of the requested product by id
+func (c *ProductsController) ScheduleProductPrice(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxScheduleProductPrice, r.Header.Get("X-Request-Id"))
+	productID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid productId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	price := &payloads.SchedulePricePayload{}
+	if err := json.NewDecoder(r.Body).Decode(price); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode price")), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := price.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+
+	scheduledPrice, err := c.priceService.SchedulePrice(context.Background(), productID, price, userContext)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrProductNotFound, errors.New("no product with that id")), http.StatusNotFound)
+		} else if err == db.ErrUserForbidden {
+			c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrScheduleProductPrice, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	c.responder.JSON(w, r, scheduledPrice, http.StatusCreated)
+}
+
+// CancelProductPrice removes a scheduled price of the requested product by id that is not effective yet
+func (c *ProductsController) CancelProductPrice(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxCancelProductPrice, r.Header.Get("X-Request-Id"))
+	productID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid productId, %v", err)), http.StatusBadRequest)
+		return
+	}
+	priceID, err := uuid.FromString(chi.URLParam(r, "priceId"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid priceId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.priceService.CancelScheduledPrice(context.Background(), productID, priceID, userContext); err != nil {
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrPriceNotFound, errors.New("no product or price with that id")), http.StatusNotFound)
+		} else if err == db.ErrUserForbidden {
+			c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+		} else if err == services.ErrPriceNotScheduled {
+			c.responder.Error(w, errCtx(api.ErrPriceNotScheduled, err), http.StatusConflict)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrCancelProductPrice, err), http.StatusBadRequest)
+		}
+		return
+	}
+	c.responder.NoContent(w)
+}
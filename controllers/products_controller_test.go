@@ -8,39 +8,51 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit"
 	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
 	"github.com/dhurimkelmendi/vending_machine/controllers"
-	"github.com/dhurimkelmendi/vending_machine/fixtures"
 	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
 	"github.com/go-chi/chi"
 	uuid "github.com/satori/go.uuid"
 )
 
 func TestProductController(t *testing.T) {
 	t.Parallel()
-	fixture := fixtures.GetFixturesDefaultInstance()
-
-	ctrl := controllers.GetControllersDefaultInstance()
-	seller := fixture.User.CreateSellerUser(t)
-	buyer := fixture.User.CreateBuyerUser(t)
-	secondSeller := fixture.User.CreateSellerUser(t)
-	product := fixture.Product.CreateProduct(t, seller.ID)
-	allUserOptions := controllers.AuthorizationOptions{
-		AllowedUserRoles: []models.UserRole{models.UserRoleSeller, models.UserRoleBuyer},
+	a, fixture := newTestApp(t)
+
+	ctrl := a.Controllers
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	secondSeller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
 	}
-	buyerOnlyOptions := controllers.AuthorizationOptions{
-		AllowedUserRoles: []models.UserRole{models.UserRoleBuyer},
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
 	}
+	productReadOptions := controllers.RequirePermissions(auth.PermProductRead)
+	productCreateOptions := controllers.RequirePermissions(auth.PermProductCreate)
+	productWriteOptions := controllers.RequirePermissions(auth.PermProductWrite.Own(), auth.PermProductWrite.Any())
+	productBuyOptions := controllers.RequirePermissions(auth.PermProductBuy)
 
 	t.Run("create product", func(t *testing.T) {
 		t.Run("as buyer", func(t *testing.T) {
 			r := chi.NewRouter()
-			r.Post("/api/v1/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxCreateProduct, ctrl.Products.CreateProduct, allUserOptions))
+			r.Post("/api/v1/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxCreateProduct, ctrl.Products.CreateProduct, productCreateOptions))
 
-			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"name":"%s", "seller_id":"%s", "cost": %d, "amount_available": %d}`,
-				strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18], seller.ID.String(), gofakeit.Uint32(), gofakeit.Uint32())))
+			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"name":"%s", "seller_id":"%s", "cost": %d}`,
+				strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18], seller.ID.String(), gofakeit.Number(1, 1000))))
 			req := httptest.NewRequest(http.MethodPost, "/api/v1/products", bBuf)
 			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
 
@@ -53,10 +65,10 @@ func TestProductController(t *testing.T) {
 		})
 		t.Run("as seller", func(t *testing.T) {
 			r := chi.NewRouter()
-			r.Post("/api/v1/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxCreateProduct, ctrl.Products.CreateProduct, allUserOptions))
+			r.Post("/api/v1/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxCreateProduct, ctrl.Products.CreateProduct, productCreateOptions))
 
-			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"name":"%s", "seller_id":"%s", "cost": %d, "amount_available": %d}`,
-				strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18], seller.ID.String(), gofakeit.Uint32(), gofakeit.Uint32())))
+			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"name":"%s", "seller_id":"%s", "cost": %d}`,
+				strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18], seller.ID.String(), gofakeit.Number(1, 1000))))
 			req := httptest.NewRequest(http.MethodPost, "/api/v1/products", bBuf)
 			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
 
@@ -72,7 +84,7 @@ func TestProductController(t *testing.T) {
 	t.Run("get product", func(t *testing.T) {
 		r := chi.NewRouter()
 		URL := fmt.Sprintf("/api/v1/products/%s", product.ID.String())
-		r.Get("/api/v1/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxGetProduct, ctrl.Products.GetProductByID, allUserOptions))
+		r.Get("/api/v1/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxGetProduct, ctrl.Products.GetProductByID, productReadOptions))
 
 		req := httptest.NewRequest(http.MethodGet, URL, nil)
 		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
@@ -87,7 +99,7 @@ func TestProductController(t *testing.T) {
 
 	t.Run("get all products", func(t *testing.T) {
 		r := chi.NewRouter()
-		r.Get("/api/v1/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxGetProducts, ctrl.Products.GetAllProducts, allUserOptions))
+		r.Get("/api/v1/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxGetProducts, ctrl.Products.GetAllProducts, productReadOptions))
 		URL := "/api/v1/products"
 
 		req := httptest.NewRequest(http.MethodGet, URL, nil)
@@ -99,12 +111,99 @@ func TestProductController(t *testing.T) {
 		if res.Code != http.StatusOK {
 			t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
 		}
+
+		t.Run("paged by seller", func(t *testing.T) {
+			if _, err := fixture.Product.CreateProduct(seller.ID); err != nil {
+				t.Fatalf("could not create product: %+v", err)
+			}
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s?seller_id=%s&limit=1&sort=-name", URL, seller.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			productList := &payloads.ProductList{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(productList); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if len(productList.Products) != 1 || productList.Total < 2 || productList.NextCursor == "" {
+				t.Fatalf("expected a single product with a next cursor, got: %+v", productList)
+			}
+		})
+		t.Run("by category and tag", func(t *testing.T) {
+			category, err := fixture.Category.CreateCategory(uuid.Nil)
+			if err != nil {
+				t.Fatalf("could not create category: %+v", err)
+			}
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s?category_id=%s&tag=vegan&tag=cold", URL, category.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("with invalid category", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, URL+"?category_id=drinks", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected http status code of 400 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("with invalid limit", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, URL+"?limit=1000", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected http status code of 400 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+
+	t.Run("search products", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Get("/api/v1/products/search", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxSearchProduct, ctrl.Products.SearchProducts, productReadOptions))
+
+		t.Run("with text", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/products/search?q=%s", product.Name[0:8]), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("without text", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/products/search?q=", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected http status code of 400 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
 	})
 
 	t.Run("update product", func(t *testing.T) {
 		r := chi.NewRouter()
 		URL := fmt.Sprintf("/api/v1/products")
-		r.Patch("/api/v1/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxUpdateProduct, ctrl.Products.UpdateProduct, allUserOptions))
+		r.Patch("/api/v1/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxUpdateProduct, ctrl.Products.UpdateProduct, productWriteOptions))
 
 		t.Run("without permission", func(t *testing.T) {
 			newDepositAmount := gofakeit.Uint32()
@@ -134,7 +233,7 @@ func TestProductController(t *testing.T) {
 		})
 
 		t.Run("with basic attributes", func(t *testing.T) {
-			newCost := gofakeit.Uint32()
+			newCost := gofakeit.Number(1, 1000)
 			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"id":"%s","cost":%d}`, product.ID.String(), newCost)))
 			req := httptest.NewRequest(http.MethodPatch, URL, bBuf)
 			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
@@ -160,12 +259,104 @@ func TestProductController(t *testing.T) {
 		})
 	})
 
+	t.Run("product prices", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Get("/api/v1/products/{id}/prices", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxGetProductPrices, ctrl.Products.GetProductPrices, productReadOptions))
+		r.Post("/api/v1/products/{id}/prices", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxScheduleProductPrice, ctrl.Products.ScheduleProductPrice, productWriteOptions))
+		r.Delete("/api/v1/products/{id}/prices/{priceId}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxCancelProductPrice, ctrl.Products.CancelProductPrice, productWriteOptions))
+		pricedProduct, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		URL := fmt.Sprintf("/api/v1/products/%s/prices", pricedProduct.ID)
+		effectiveFrom := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+
+		t.Run("schedule as another seller", func(t *testing.T) {
+			bBuf := bytes.NewBufferString(fmt.Sprintf(`{"cost":100,"effective_from":"%s"}`, effectiveFrom))
+			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondSeller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("schedule in the past", func(t *testing.T) {
+			bBuf := bytes.NewBufferString(fmt.Sprintf(`{"cost":100,"effective_from":"%s"}`, time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)))
+			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected http status code of 400 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("schedule and cancel", func(t *testing.T) {
+			bBuf := bytes.NewBufferString(fmt.Sprintf(`{"cost":100,"effective_from":"%s"}`, effectiveFrom))
+			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusCreated {
+				t.Fatalf("expected http status code of 201 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			scheduledPrice := &models.ProductPrice{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(scheduledPrice); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+
+			req = httptest.NewRequest(http.MethodGet, URL, nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res = httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			priceList := &payloads.ProductPriceList{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(priceList); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if len(priceList.Prices) != 2 || priceList.Prices[1].ID != scheduledPrice.ID {
+				t.Fatalf("expected the current and the scheduled price, got: %+v", priceList.Prices)
+			}
+
+			req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%s", URL, scheduledPrice.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res = httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusNoContent {
+				t.Fatalf("expected http status code of 204 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("of a non-existing product", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/products/%s/prices", uuid.NewV4()), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusNotFound {
+				t.Fatalf("expected http status code of 404 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+
 	t.Run("delete product", func(t *testing.T) {
 		r := chi.NewRouter()
 
 		t.Run("without permission", func(t *testing.T) {
 			URL := fmt.Sprintf("/api/v1/products/%s", product.ID.String())
-			r.Delete("/api/v1/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxDeleteProduct, ctrl.Products.DeleteProduct, allUserOptions))
+			r.Delete("/api/v1/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxDeleteProduct, ctrl.Products.DeleteProduct, productWriteOptions))
 			req := httptest.NewRequest(http.MethodDelete, URL, nil)
 			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondSeller.Token))
 
@@ -178,7 +369,7 @@ func TestProductController(t *testing.T) {
 		})
 		t.Run("non-existing product", func(t *testing.T) {
 			URL := fmt.Sprintf("/api/v1/products/%s", gofakeit.UUID())
-			r.Delete("/api/v1/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxDeleteProduct, ctrl.Products.DeleteProduct, allUserOptions))
+			r.Delete("/api/v1/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxDeleteProduct, ctrl.Products.DeleteProduct, productWriteOptions))
 			req := httptest.NewRequest(http.MethodDelete, URL, nil)
 			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondSeller.Token))
 
@@ -192,7 +383,7 @@ func TestProductController(t *testing.T) {
 
 		t.Run("existing product", func(t *testing.T) {
 			URL := fmt.Sprintf("/api/v1/products/%s", product.ID.String())
-			r.Delete("/api/v1/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxDeleteProduct, ctrl.Products.DeleteProduct, allUserOptions))
+			r.Delete("/api/v1/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxDeleteProduct, ctrl.Products.DeleteProduct, productWriteOptions))
 			t.Run("without permission", func(t *testing.T) {
 				req := httptest.NewRequest(http.MethodDelete, URL, nil)
 				req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondSeller.Token))
@@ -233,9 +424,16 @@ func TestProductController(t *testing.T) {
 		t.Run("as buyer", func(t *testing.T) {
 			r := chi.NewRouter()
 			URL := "/api/v1/buy"
-			r.Patch("/api/v1/buy", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxBuyProduct, ctrl.Users.BuyProduct, buyerOnlyOptions))
-			productToBuy := fixture.Product.CreateProduct(t, seller.ID)
-			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"user_id": "%s", "product_id": "%s", "amount":%d}`, buyer.ID.String(), productToBuy.ID.String(), 1)))
+			r.Patch("/api/v1/buy", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxBuyProduct, ctrl.Users.BuyProduct, productBuyOptions))
+			productToBuy, err := fixture.Product.CreateProduct(seller.ID)
+			if err != nil {
+				t.Fatalf("could not create product: %+v", err)
+			}
+			machine, err := fixture.Machine.CreateStockedMachine(seller.ID, productToBuy)
+			if err != nil {
+				t.Fatalf("could not create stocked machine: %+v", err)
+			}
+			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"machine_id": "%s", "product_id": "%s", "amount":%d}`, machine.ID.String(), productToBuy.ID.String(), 1)))
 			req := httptest.NewRequest(http.MethodPatch, URL, bBuf)
 			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
 
@@ -249,8 +447,11 @@ func TestProductController(t *testing.T) {
 		t.Run("as seller", func(t *testing.T) {
 			r := chi.NewRouter()
 			URL := "/api/v1/buy"
-			r.Patch("/api/v1/buy", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxBuyProduct, ctrl.Users.BuyProduct, buyerOnlyOptions))
-			productToBuy := fixture.Product.CreateProduct(t, secondSeller.ID)
+			r.Patch("/api/v1/buy", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxBuyProduct, ctrl.Users.BuyProduct, productBuyOptions))
+			productToBuy, err := fixture.Product.CreateProduct(secondSeller.ID)
+			if err != nil {
+				t.Fatalf("could not create product: %+v", err)
+			}
 			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"user_id": "%s", "product_id": "%s", "amount":%d}`, secondSeller.ID.String(), productToBuy.ID.String(), gofakeit.Uint16())))
 			req := httptest.NewRequest(http.MethodPatch, URL, bBuf)
 			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondSeller.Token))
@@ -263,4 +464,60 @@ func TestProductController(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("user checks out products", func(t *testing.T) {
+		r := chi.NewRouter()
+		URL := "/api/v1/checkout"
+		r.Post("/api/v1/checkout", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxCheckout, ctrl.Users.Checkout, productBuyOptions))
+		firstProduct, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		secondProduct, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		machine, err := fixture.Machine.CreateStockedMachine(seller.ID, firstProduct, secondProduct)
+		if err != nil {
+			t.Fatalf("could not create stocked machine: %+v", err)
+		}
+
+		t.Run("without items", func(t *testing.T) {
+			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"machine_id": "%s", "items": []}`, machine.ID)))
+			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected http status code of 400 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("with several items", func(t *testing.T) {
+			checkoutBuyer, err := fixture.User.CreateBuyerUser()
+			if err != nil {
+				t.Fatalf("could not create buyer: %+v", err)
+			}
+			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"machine_id": "%s", "items": [{"product_id": "%s", "amount": 1}, {"product_id": "%s", "amount": 2}]}`,
+				machine.ID, firstProduct.ID, secondProduct.ID)))
+			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", checkoutBuyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			receipt := &payloads.CheckoutReceipt{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(receipt); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			expectedTotal := firstProduct.Cost + 2*secondProduct.Cost
+			if len(receipt.Lines) != 2 || receipt.Total != expectedTotal || receipt.ChangeReturned != checkoutBuyer.Deposit-expectedTotal {
+				t.Fatalf("expected two lines totalling %d, got: %+v", expectedTotal, receipt)
+			}
+		})
+	})
 }
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	uuid "github.com/satori/go.uuid"
+)
+
+// A PromotionsController handles HTTP requests that deal with promotions.
+type PromotionsController struct {
+	AuthenticatedController
+	promotionService *services.PromotionService
+}
+
+// GetPromotionsControllerDefaultInstance returns the default instance of PromotionsController.
+func GetPromotionsControllerDefaultInstance() *PromotionsController {
+	return GetControllersDefaultInstance().Promotions
+}
+
+// NewPromotionController create a new instance of a promotion controller using the supplied promotion service, responder and authentication provider
+func NewPromotionController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, promotionService *services.PromotionService) *PromotionsController {
+	return newPromotionController(newAuthenticatedController(api.CmpController, responder, statelessAuthenticationProvider), promotionService)
+}
+
+func newPromotionController(authenticatedController AuthenticatedController, promotionService *services.PromotionService) *PromotionsController {
+	return &PromotionsController{
+		AuthenticatedController: authenticatedController,
+		promotionService:        promotionService,
+	}
+}
+
+// GetPromotions returns the promotions matching the `seller_id`, `product_id` and `active` query parameters
+func (c *PromotionsController) GetPromotions(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetPromotions, r.Header.Get("X-Request-Id"))
+	filter, err := payloads.ParsePromotionFilter(r.URL.Query())
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, err), http.StatusBadRequest)
+		return
+	}
+
+	promotions, err := c.promotionService.GetPromotions(filter)
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrGetPromotions, err), http.StatusBadRequest)
+		return
+	}
+
+	if err := render.Render(w, r, promotions); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// GetPromotionByID returns the requested promotion by id
+func (c *PromotionsController) GetPromotionByID(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetPromotion, r.Header.Get("X-Request-Id"))
+	promotionID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid promotionId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	promotion, err := c.promotionService.GetPromotionByID(promotionID)
+	if err != nil {
+		c.promotionError(w, errCtx, api.ErrGetPromotion, err)
+		return
+	}
+
+	if err := render.Render(w, r, promotion); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// CreatePromotion creates a new promotion of the current user on their own products
+func (c *PromotionsController) CreatePromotion(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxCreatePromotion, r.Header.Get("X-Request-Id"))
+	promotion := &payloads.PromotionPayload{}
+	if err := json.NewDecoder(r.Body).Decode(promotion); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode promotion")), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := promotion.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+
+	createdPromotion, err := c.promotionService.CreatePromotion(context.Background(), promotion, userContext)
+	if err != nil {
+		c.promotionError(w, errCtx, api.ErrCreatePromotion, err)
+		return
+	}
+
+	c.responder.JSON(w, r, createdPromotion, http.StatusCreated)
+}
+
+// UpdatePromotion replaces the requested promotion by id
+func (c *PromotionsController) UpdatePromotion(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxUpdatePromotion, r.Header.Get("X-Request-Id"))
+	promotionID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid promotionId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	promotion := &payloads.PromotionPayload{}
+	if err := json.NewDecoder(r.Body).Decode(promotion); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode promotion")), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := promotion.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+
+	updatedPromotion, err := c.promotionService.UpdatePromotion(context.Background(), promotionID, promotion, userContext)
+	if err != nil {
+		c.promotionError(w, errCtx, api.ErrUpdatePromotion, err)
+		return
+	}
+
+	if err := render.Render(w, r, updatedPromotion); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// DeletePromotion deletes the requested promotion by id
+func (c *PromotionsController) DeletePromotion(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxDeletePromotion, r.Header.Get("X-Request-Id"))
+	promotionID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid promotionId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.promotionService.DeletePromotion(context.Background(), promotionID, userContext); err != nil {
+		c.promotionError(w, errCtx, api.ErrDeletePromotion, err)
+		return
+	}
+	c.responder.NoContent(w)
+}
+
+// promotionError responds with the status matching the error of the promotion service
+func (c *PromotionsController) promotionError(w http.ResponseWriter, errCtx api.ErrorContextFn, responseErr *api.ResponseError, err error) {
+	switch err {
+	case db.ErrNoMatch:
+		c.responder.Error(w, errCtx(api.ErrPromotionNotFound, errors.New("no promotion with that id")), http.StatusNotFound)
+	case db.ErrUserForbidden:
+		c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+	case services.ErrPromotionProductNotOwned:
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+	default:
+		c.responder.Error(w, errCtx(responseErr, err), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,191 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/controllers"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/go-chi/chi"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestPromotionController(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+
+	ctrl := a.Controllers
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	secondSeller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	productReadOptions := controllers.RequirePermissions(auth.PermProductRead)
+	promotionWriteOptions := controllers.RequirePermissions(auth.PermPromotionWrite.Own(), auth.PermPromotionWrite.Any())
+
+	r := chi.NewRouter()
+	r.Get("/api/v1/promotions", ctrl.AuthenticationRequired(ctrl.Promotions.AuthenticatedController, api.CtxGetPromotions, ctrl.Promotions.GetPromotions, productReadOptions))
+	r.Get("/api/v1/promotions/{id}", ctrl.AuthenticationRequired(ctrl.Promotions.AuthenticatedController, api.CtxGetPromotion, ctrl.Promotions.GetPromotionByID, productReadOptions))
+	r.Post("/api/v1/promotions", ctrl.AuthenticationRequired(ctrl.Promotions.AuthenticatedController, api.CtxCreatePromotion, ctrl.Promotions.CreatePromotion, promotionWriteOptions))
+	r.Put("/api/v1/promotions/{id}", ctrl.AuthenticationRequired(ctrl.Promotions.AuthenticatedController, api.CtxUpdatePromotion, ctrl.Promotions.UpdatePromotion, promotionWriteOptions))
+	r.Delete("/api/v1/promotions/{id}", ctrl.AuthenticationRequired(ctrl.Promotions.AuthenticatedController, api.CtxDeletePromotion, ctrl.Promotions.DeletePromotion, promotionWriteOptions))
+
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	promotionBody := fmt.Sprintf(`{"name":"happy hour","type":"percentage","product_ids":["%s"],"value":15,"happy_hour_from":"16:00","happy_hour_to":"18:00"}`, product.ID)
+
+	t.Run("create promotion", func(t *testing.T) {
+		t.Run("as buyer", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/promotions", bytes.NewBufferString(promotionBody))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("invalid type", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/promotions", bytes.NewBufferString(fmt.Sprintf(`{"name":"sale","type":"free","product_ids":["%s"]}`, product.ID)))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected http status code of 400 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("on another seller's product", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/promotions", bytes.NewBufferString(promotionBody))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondSeller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected http status code of 400 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("as seller", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/promotions", bytes.NewBufferString(promotionBody))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusCreated {
+				t.Fatalf("expected http status code of 201 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			promotion := &models.Promotion{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(promotion); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if promotion.SellerID != seller.ID || promotion.HappyHourFrom == "" {
+				t.Fatalf("expected a happy hour promotion of the seller, got: %+v", promotion)
+			}
+		})
+	})
+
+	t.Run("get promotions", func(t *testing.T) {
+		promotion, err := fixture.Promotion.CreatePercentagePromotion(seller, 10, product.ID)
+		if err != nil {
+			t.Fatalf("could not create promotion: %+v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/promotions?seller_id=%s&product_id=%s", seller.ID, product.ID), nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+		}
+		promotionList := &payloads.PromotionList{}
+		if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(promotionList); err != nil {
+			t.Fatalf("error decoding response body: %+v", err)
+		}
+		found := false
+		for _, p := range promotionList.Promotions {
+			found = found || p.ID == promotion.ID
+		}
+		if !found {
+			t.Fatalf("expected promotion %s in the list, got: %+v", promotion.ID, promotionList.Promotions)
+		}
+	})
+
+	t.Run("get promotion by id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/promotions/%s", uuid.NewV4()), nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusNotFound {
+			t.Fatalf("expected http status code of 404 but got: %+v, %+v", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("update promotion", func(t *testing.T) {
+		promotion, err := fixture.Promotion.CreatePercentagePromotion(seller, 10, product.ID)
+		if err != nil {
+			t.Fatalf("could not create promotion: %+v", err)
+		}
+		t.Run("of another seller", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/v1/promotions/%s", promotion.ID), bytes.NewBufferString(promotionBody))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondSeller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("own", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/v1/promotions/%s", promotion.ID), bytes.NewBufferString(promotionBody))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+
+	t.Run("delete promotion", func(t *testing.T) {
+		promotion, err := fixture.Promotion.CreatePercentagePromotion(seller, 10, product.ID)
+		if err != nil {
+			t.Fatalf("could not create promotion: %+v", err)
+		}
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/promotions/%s", promotion.ID), nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusNoContent {
+			t.Fatalf("expected http status code of 204 but got: %+v, %+v", res.Code, res.Body.String())
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	uuid "github.com/satori/go.uuid"
+)
+
+// A PurchasesController handles HTTP requests that deal with the purchases ledger.
+type PurchasesController struct {
+	AuthenticatedController
+	purchaseService *services.PurchaseService
+	userService     *services.UserService
+}
+
+// GetPurchasesControllerDefaultInstance returns the default instance of PurchasesController.
+func GetPurchasesControllerDefaultInstance() *PurchasesController {
+	return GetControllersDefaultInstance().Purchases
+}
+
+// NewPurchaseController create a new instance of a purchase controller using the supplied purchase and user services, responder and authentication provider
+func NewPurchaseController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, purchaseService *services.PurchaseService, userService *services.UserService) *PurchasesController {
+	return newPurchaseController(newAuthenticatedController(api.CmpController, responder, statelessAuthenticationProvider), purchaseService, userService)
+}
+
+func newPurchaseController(authenticatedController AuthenticatedController, purchaseService *services.PurchaseService, userService *services.UserService) *PurchasesController {
+	return &PurchasesController{
+		AuthenticatedController: authenticatedController,
+		purchaseService:         purchaseService,
+		userService:             userService,
+	}
+}
+
+// GetPurchases returns the purchases of the current buyer, or the sales of the current seller's products
+func (c *PurchasesController) GetPurchases(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetPurchases, r.Header.Get("X-Request-Id"))
+	purchases, err := c.purchaseService.GetPurchases(userContext)
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrGetPurchases, err), http.StatusBadRequest)
+		return
+	}
+
+	if err := render.Render(w, r, purchases); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// RefundPurchase reverses the requested purchase by id, the body is optional and refunds the whole purchase without it
+func (c *PurchasesController) RefundPurchase(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxRefundPurchase, r.Header.Get("X-Request-Id"))
+	purchaseID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid purchaseId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	refund := &payloads.RefundPurchasePayload{}
+	if err := json.NewDecoder(r.Body).Decode(refund); err != nil && err != io.EOF {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode refund")), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := refund.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+	refund.RequestID = r.Header.Get("X-Request-Id")
+
+	receipt, err := c.userService.RefundPurchase(r.Context(), purchaseID, refund, userContext)
+	if err != nil {
+		switch err {
+		case db.ErrNoMatch:
+			c.responder.Error(w, errCtx(api.ErrPurchaseNotFound, errors.New("no purchase with that id")), http.StatusNotFound)
+		case db.ErrUserForbidden:
+			c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+		case services.ErrRefundWindowExpired:
+			c.responder.Error(w, errCtx(api.ErrRefundWindowExpired, err), http.StatusForbidden)
+		case services.ErrPurchaseRefunded:
+			c.responder.Error(w, errCtx(api.ErrPurchaseRefunded, err), http.StatusConflict)
+		case services.ErrRefundQuantity, services.ErrRefundNotRefundable:
+			c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		default:
+			c.responder.Error(w, errCtx(api.ErrRefundPurchase, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, receipt); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// DispensePurchase records that the machine started to vend the requested purchase by id
+func (c *PurchasesController) DispensePurchase(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	c.transitionPurchase(w, r, userContext, api.CtxDispensePurchase, api.ErrDispensePurchase, c.userService.DispensePurchase)
+}
+
+// ConfirmPurchase records that the machine vended the requested purchase by id
+func (c *PurchasesController) ConfirmPurchase(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	c.transitionPurchase(w, r, userContext, api.CtxConfirmPurchase, api.ErrConfirmPurchase, c.userService.ConfirmPurchase)
+}
+
+func (c *PurchasesController) transitionPurchase(w http.ResponseWriter, r *http.Request, userContext auth.UserContext, ctx api.ErrorContext, responseErr *api.ResponseError,
+	transition func(context.Context, uuid.UUID, auth.UserContext) (*models.Purchase, error)) {
+	errCtx := c.errCmp(ctx, r.Header.Get("X-Request-Id"))
+	purchaseID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid purchaseId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	purchase, err := transition(context.Background(), purchaseID, userContext)
+	if err != nil {
+		c.vendError(w, errCtx, responseErr, err)
+		return
+	}
+
+	if err := render.Render(w, r, purchase); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// FailPurchase records that the machine could not vend the requested purchase by id, which returns its stock and
+// money. The body is optional
+func (c *PurchasesController) FailPurchase(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxFailPurchase, r.Header.Get("X-Request-Id"))
+	purchaseID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid purchaseId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	failure := &payloads.FailPurchasePayload{}
+	if err := json.NewDecoder(r.Body).Decode(failure); err != nil && err != io.EOF {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode failure")), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := failure.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+	failure.RequestID = r.Header.Get("X-Request-Id")
+
+	receipt, err := c.userService.FailPurchase(r.Context(), purchaseID, failure, userContext)
+	if err != nil {
+		c.vendError(w, errCtx, api.ErrFailPurchase, err)
+		return
+	}
+
+	if err := render.Render(w, r, receipt); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// vendError responds with the status matching the error of a vend status change
+func (c *PurchasesController) vendError(w http.ResponseWriter, errCtx api.ErrorContextFn, responseErr *api.ResponseError, err error) {
+	switch err {
+	case db.ErrNoMatch:
+		c.responder.Error(w, errCtx(api.ErrPurchaseNotFound, errors.New("no purchase with that id")), http.StatusNotFound)
+	case db.ErrUserForbidden:
+		c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+	case services.ErrPurchaseTransition:
+		c.responder.Error(w, errCtx(api.ErrPurchaseTransition, err), http.StatusConflict)
+	case services.ErrPurchaseRefunded:
+		c.responder.Error(w, errCtx(api.ErrPurchaseRefunded, err), http.StatusConflict)
+	default:
+		c.responder.Error(w, errCtx(responseErr, err), http.StatusBadRequest)
+	}
+}
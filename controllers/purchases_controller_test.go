@@ -0,0 +1,229 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/controllers"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/go-chi/chi"
+)
+
+func TestPurchaseController(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+
+	ctrl := a.Controllers
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	if _, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, buyer.ID); err != nil {
+		t.Fatalf("could not create purchase: %+v", err)
+	}
+	purchaseReadOptions := controllers.RequirePermissions(auth.PermPurchaseRead.Own(), auth.PermPurchaseRead.Any(), auth.PermSaleRead)
+
+	r := chi.NewRouter()
+	URL := "/api/v1/purchases"
+	r.Get("/api/v1/purchases", ctrl.AuthenticationRequired(ctrl.Purchases.AuthenticatedController, api.CtxGetPurchases, ctrl.Purchases.GetPurchases, purchaseReadOptions))
+
+	t.Run("get purchases", func(t *testing.T) {
+		t.Run("as buyer", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, URL, nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+
+			purchaseList := &payloads.PurchaseList{}
+			dec := json.NewDecoder(strings.NewReader(res.Body.String()))
+			if err := dec.Decode(purchaseList); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if len(purchaseList.Purchases) != 1 || purchaseList.Purchases[0].ProductID != product.ID {
+				t.Fatalf("expected a single purchase of product %s, got: %+v", product.ID, purchaseList.Purchases)
+			}
+		})
+		t.Run("as seller", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, URL, nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+
+			purchaseList := &payloads.PurchaseList{}
+			dec := json.NewDecoder(strings.NewReader(res.Body.String()))
+			if err := dec.Decode(purchaseList); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if len(purchaseList.Purchases) != 1 || purchaseList.Purchases[0].UserID != buyer.ID {
+				t.Fatalf("expected a single sale to buyer %s, got: %+v", buyer.ID, purchaseList.Purchases)
+			}
+		})
+	})
+
+	t.Run("refund purchase", func(t *testing.T) {
+		refundOptions := controllers.RequirePermissions(auth.PermPurchaseRefund.Own(), auth.PermPurchaseRefund.Any(), auth.PermSaleRefund)
+		r.Post("/api/v1/purchases/{id}/refund", ctrl.AuthenticationRequired(ctrl.Purchases.AuthenticatedController, api.CtxRefundPurchase, ctrl.Purchases.RefundPurchase, refundOptions))
+		refundBuyer, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		report, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, refundBuyer.ID)
+		if err != nil {
+			t.Fatalf("could not create purchase: %+v", err)
+		}
+		refundURL := fmt.Sprintf("/api/v1/purchases/%s/refund", report.Purchases[0].ID)
+
+		t.Run("as another buyer", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, refundURL, nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("as buyer", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, refundURL, strings.NewReader(`{"reason":"nothing came out"}`))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", refundBuyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			receipt := &payloads.RefundReceipt{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(receipt); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if receipt.Refund.Total != -product.Cost || receipt.DepositCredited != product.Cost {
+				t.Fatalf("expected %d refunded to the deposit, got: %+v, %+v", product.Cost, receipt, receipt.Refund)
+			}
+		})
+		t.Run("twice", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, refundURL, nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusConflict {
+				t.Fatalf("expected http status code of 409 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+	})
+
+	t.Run("vend purchase", func(t *testing.T) {
+		vendOptions := controllers.RequirePermissions(auth.PermPurchaseVend.Own(), auth.PermPurchaseVend.Any())
+		r.Post("/api/v1/purchases/{id}/confirm", ctrl.AuthenticationRequired(ctrl.Purchases.AuthenticatedController, api.CtxConfirmPurchase, ctrl.Purchases.ConfirmPurchase, vendOptions))
+		r.Post("/api/v1/purchases/{id}/fail", ctrl.AuthenticationRequired(ctrl.Purchases.AuthenticatedController, api.CtxFailPurchase, ctrl.Purchases.FailPurchase, vendOptions))
+		vendBuyer, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		failBuyer, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		confirmedReport, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, vendBuyer.ID)
+		if err != nil {
+			t.Fatalf("could not create purchase: %+v", err)
+		}
+		failedReport, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, failBuyer.ID)
+		if err != nil {
+			t.Fatalf("could not create purchase: %+v", err)
+		}
+		confirmedPurchase := confirmedReport.Purchases[0]
+		failedPurchase := failedReport.Purchases[0]
+
+		t.Run("confirm as buyer", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/purchases/%s/confirm", confirmedPurchase.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", vendBuyer.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("confirm as seller", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/purchases/%s/confirm", confirmedPurchase.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			purchase := &models.Purchase{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(purchase); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if purchase.Status != models.PurchaseStatusCompleted {
+				t.Fatalf("expected the purchase to be completed, got: %+v", purchase)
+			}
+		})
+		t.Run("fail confirmed", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/purchases/%s/fail", confirmedPurchase.ID), nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusConflict {
+				t.Fatalf("expected http status code of 409 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+		t.Run("fail reserved", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/purchases/%s/fail", failedPurchase.ID), strings.NewReader(`{"reason":"product stuck"}`))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", seller.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected http status code of 200 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+			receipt := &payloads.RefundReceipt{}
+			if err := json.NewDecoder(strings.NewReader(res.Body.String())).Decode(receipt); err != nil {
+				t.Fatalf("error decoding response body: %+v", err)
+			}
+			if receipt.Purchase.Status != models.PurchaseStatusFailed || receipt.Refund.RefundOf != failedPurchase.ID {
+				t.Fatalf("expected the purchase to fail and be reversed, got: %+v, %+v", receipt.Purchase, receipt.Refund)
+			}
+		})
+	})
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	uuid "github.com/satori/go.uuid"
+)
+
+// A SyncController handles HTTP requests of machines syncing with the central server.
+type SyncController struct {
+	AuthenticatedController
+	syncService *services.SyncService
+}
+
+// GetSyncControllerDefaultInstance returns the default instance of SyncController.
+func GetSyncControllerDefaultInstance() *SyncController {
+	return GetControllersDefaultInstance().Sync
+}
+
+// NewSyncController create a new instance of a sync controller using the supplied sync service, responder and authentication provider
+func NewSyncController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, syncService *services.SyncService) *SyncController {
+	return newSyncController(newAuthenticatedController(api.CmpController, responder, statelessAuthenticationProvider), syncService)
+}
+
+func newSyncController(authenticatedController AuthenticatedController, syncService *services.SyncService) *SyncController {
+	return &SyncController{
+		AuthenticatedController: authenticatedController,
+		syncService:             syncService,
+	}
+}
+
+// PushBatch applies the events a machine recorded offline and responds with the conflict report of the batch.
+// Pushing a batch again responds with the outcome the events had the first time
+func (c *SyncController) PushBatch(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxPushSyncBatch, r.Header.Get("X-Request-Id"))
+	batch := &payloads.SyncBatchPayload{}
+	if err := json.NewDecoder(r.Body).Decode(batch); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode sync batch")), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := batch.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+	batch.RequestID = r.Header.Get("X-Request-Id")
+
+	report, err := c.syncService.ApplyBatch(context.Background(), batch, userContext)
+	if err != nil {
+		switch err {
+		case db.ErrNoMatch:
+			c.responder.Error(w, errCtx(api.ErrMachineNotFound, errors.New("no machine with that id")), http.StatusNotFound)
+		case db.ErrUserForbidden:
+			c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+		case services.ErrSyncOutOfOrder:
+			c.responder.Error(w, errCtx(api.ErrSyncOutOfOrder, err), http.StatusConflict)
+		case services.ErrSyncEventReused:
+			c.responder.Error(w, errCtx(api.ErrSyncEventReused, err), http.StatusConflict)
+		default:
+			c.responder.Error(w, errCtx(api.ErrPushSyncBatch, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, report); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// GetCatalogue returns the slots of the requested machine by id with their products and scheduled prices
+func (c *SyncController) GetCatalogue(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetSyncCatalogue, r.Header.Get("X-Request-Id"))
+	machineID, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid machineId, %v", err)), http.StatusBadRequest)
+		return
+	}
+
+	catalogue, err := c.syncService.GetCatalogue(context.Background(), machineID)
+	if err != nil {
+		switch err {
+		case db.ErrNoMatch:
+			c.responder.Error(w, errCtx(api.ErrMachineNotFound, errors.New("no machine with that id")), http.StatusNotFound)
+		default:
+			c.responder.Error(w, errCtx(api.ErrGetSyncCatalogue, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := render.Render(w, r, catalogue); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
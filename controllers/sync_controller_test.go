@@ -0,0 +1,207 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/app"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/controllers"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/machinesync"
+	"github.com/dhurimkelmendi/vending_machine/migrations"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/go-chi/chi"
+	uuid "github.com/satori/go.uuid"
+)
+
+// newCentralServer starts a central server with its own sync controller, sharing the store of the app with the other
+// central servers of the test
+func newCentralServer(t *testing.T, a *app.App) *httptest.Server {
+	ctrl := a.Controllers
+	syncController := controllers.NewSyncController(a.Responder, a.Stateless, a.Services.Sync)
+	machineWriteOptions := controllers.RequirePermissions(auth.PermMachineWrite.Own(), auth.PermMachineWrite.Any())
+	r := chi.NewRouter()
+	r.Post("/public/api/v1/users/refresh", ctrl.Users.RefreshToken)
+	r.Post("/api/v1/sync/batches", ctrl.AuthenticationRequired(syncController.AuthenticatedController, api.CtxPushSyncBatch, syncController.PushBatch, machineWriteOptions))
+	r.Get("/api/v1/sync/machines/{id}/catalogue", ctrl.AuthenticationRequired(syncController.AuthenticatedController, api.CtxGetSyncCatalogue, syncController.GetCatalogue, controllers.RequirePermissions(auth.PermMachineRead)))
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// pushBatch pushes the batch to the central server, it is called from several goroutines so it does not stop the test
+func pushBatch(t *testing.T, serverURL string, token string, batch *payloads.SyncBatchPayload) (int, *payloads.SyncBatchReport) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		t.Errorf("error while encoding batch %+v", err)
+		return 0, nil
+	}
+	req, err := http.NewRequest(http.MethodPost, serverURL+"/api/v1/sync/batches", bytes.NewReader(body))
+	if err != nil {
+		t.Errorf("error while creating request %+v", err)
+		return 0, nil
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("error while pushing batch %+v", err)
+		return 0, nil
+	}
+	defer res.Body.Close()
+	report := &payloads.SyncBatchReport{}
+	if res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(report); err != nil {
+			t.Errorf("error while decoding report %+v", err)
+		}
+	}
+	return res.StatusCode, report
+}
+
+func TestSyncController(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	ctx := context.Background()
+
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	product, err := a.Services.Products.CreateProduct(ctx, &payloads.CreateProductPayload{
+		Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+		Cost: 40,
+	}, seller.ID)
+	if err != nil {
+		t.Fatalf("error while creating product %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	if _, err := a.Services.Users.ResetDeposit(ctx, buyer.ID); err != nil {
+		t.Fatalf("error while resetting deposit %+v", err)
+	}
+
+	// the machine records its events offline in its own database
+	sqlite, err := db.OpenSQLite(filepath.Join(t.TempDir(), "machine.db"))
+	if err != nil {
+		t.Fatalf("error while opening database %+v", err)
+	}
+	defer sqlite.Close()
+	if _, _, err := migrations.RunSQLite(sqlite, "up"); err != nil {
+		t.Fatalf("error while migrating database %+v", err)
+	}
+	outbox := machinesync.NewStore(sqlite)
+	offline := []*payloads.SyncEvent{
+		{Kind: models.SyncEventKindDeposit, UserID: buyer.ID, Amount: 50},
+		{Kind: models.SyncEventKindPurchase, UserID: buyer.ID, ProductID: product.ID, Quantity: 1, UnitPrice: 40, ChangeReturned: 10},
+		{Kind: models.SyncEventKindStock, SlotCode: "A1", Quantity: -1},
+	}
+	for _, event := range offline {
+		if _, err := outbox.Enqueue(event); err != nil {
+			t.Fatalf("error while enqueueing event %+v", err)
+		}
+	}
+	events, err := outbox.Pending(payloads.MaxSyncBatchEvents)
+	if err != nil {
+		t.Fatalf("error while reading pending events %+v", err)
+	}
+
+	first := newCentralServer(t, a)
+	second := newCentralServer(t, a)
+
+	t.Run("push batch to two servers at once", func(t *testing.T) {
+		batch := &payloads.SyncBatchPayload{BatchID: uuid.NewV4(), MachineID: machine.ID, Events: events}
+		reports := make([]*payloads.SyncBatchReport, 2)
+		statuses := make([]int, 2)
+		var wg sync.WaitGroup
+		for i, server := range []*httptest.Server{first, second} {
+			wg.Add(1)
+			go func(i int, serverURL string) {
+				defer wg.Done()
+				statuses[i], reports[i] = pushBatch(t, serverURL, seller.Token, batch)
+			}(i, server.URL)
+		}
+		wg.Wait()
+
+		if statuses[0] != http.StatusOK || statuses[1] != http.StatusOK {
+			t.Fatalf("expected both servers to respond with 200, got: %v", statuses)
+		}
+		// the batches are applied one after the other, so one server applies the events and the other reports them
+		// as duplicates with the same outcome
+		if reports[0].Applied+reports[1].Applied != len(events) || reports[0].Duplicates+reports[1].Duplicates != len(events) {
+			t.Fatalf("expected the events to be applied once, got: %+v %+v", reports[0], reports[1])
+		}
+		for i := range events {
+			if reports[0].Events[i].Status != reports[1].Events[i].Status || len(reports[0].Events[i].Conflicts) != len(reports[1].Events[i].Conflicts) {
+				t.Fatalf("expected both servers to report event %d the same, got: %+v %+v", i, reports[0].Events[i], reports[1].Events[i])
+			}
+		}
+
+		purchases, err := a.Services.Purchases.GetPurchasesByUserID(buyer.ID)
+		if err != nil {
+			t.Fatalf("error while getting purchases %+v", err)
+		}
+		if len(purchases) != 1 {
+			t.Fatalf("expected the purchase to be recorded once, got: %+v", purchases)
+		}
+	})
+
+	t.Run("sync machine", func(t *testing.T) {
+		// the machine syncs in a session of its own, so refreshing its tokens leaves the access token of the operator valid
+		operator, err := a.Services.Users.LoginUser(ctx, &payloads.LoginUserPayload{Username: seller.Username, Password: "password"})
+		if err != nil {
+			t.Fatalf("error while logging in operator %+v", err)
+		}
+		// the machine did not get a report, so it pushes its events again, this time to the other server
+		client := machinesync.NewClient(outbox, second.URL, operator.RefreshToken, machine.ID)
+		reports, err := client.Sync(ctx)
+		if err != nil {
+			t.Fatalf("error while syncing %+v", err)
+		}
+		if len(reports) != 1 || reports[0].Duplicates != len(events) {
+			t.Fatalf("expected the events to be reported as duplicates, got: %+v", reports)
+		}
+		if pending, _ := outbox.Pending(payloads.MaxSyncBatchEvents); len(pending) != 0 {
+			t.Fatalf("expected no pending events after syncing, got: %+v", pending)
+		}
+		catalogue, err := outbox.Catalogue(machine.ID)
+		if err != nil {
+			t.Fatalf("error while reading catalogue %+v", err)
+		}
+		// the slot held 1000 units, one was sold and one taken out by the operator
+		if len(catalogue.Slots) != 1 || catalogue.Slots[0].Quantity != 998 {
+			t.Fatalf("expected the catalogue to include the synced stock, got: %+v", catalogue.Slots)
+		}
+	})
+
+	t.Run("push events out of order", func(t *testing.T) {
+		event := &payloads.SyncEvent{ID: uuid.NewV4(), Sequence: events[0].Sequence, Kind: models.SyncEventKindDeposit, OccurredAt: time.Now(), UserID: buyer.ID, Amount: 50}
+		batch := &payloads.SyncBatchPayload{BatchID: uuid.NewV4(), MachineID: machine.ID, Events: []*payloads.SyncEvent{event}}
+		if status, _ := pushBatch(t, first.URL, seller.Token, batch); status != http.StatusConflict {
+			t.Fatalf("expected http status code of 409 but got: %+v", status)
+		}
+	})
+
+	t.Run("push batch as buyer", func(t *testing.T) {
+		batch := &payloads.SyncBatchPayload{BatchID: uuid.NewV4(), MachineID: machine.ID, Events: events}
+		if status, _ := pushBatch(t, first.URL, buyer.Token, batch); status != http.StatusForbidden {
+			t.Fatalf("expected http status code of 403 but got: %+v", status)
+		}
+	})
+}
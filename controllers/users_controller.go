@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/dhurimkelmendi/vending_machine/api"
 	"github.com/dhurimkelmendi/vending_machine/auth"
@@ -20,34 +23,25 @@ import (
 // A UsersController handles HTTP requests that deal with user.
 type UsersController struct {
 	AuthenticatedController
-	userService *services.UserService
+	userService  *services.UserService
+	tokenService *services.TokenService
 }
 
-var usersControllerDefaultInstance *UsersController
-
 // GetUsersControllerDefaultInstance returns the default instance of UserController.
 func GetUsersControllerDefaultInstance() *UsersController {
-	if usersControllerDefaultInstance == nil {
-		usersControllerDefaultInstance = NewUserController(services.GetUserServiceDefaultInstance())
-	}
-
-	return usersControllerDefaultInstance
+	return GetControllersDefaultInstance().Users
 }
 
-// NewUserController create a new instance of a user controller using the supplied user service
-func NewUserController(userService *services.UserService) *UsersController {
-	controller := Controller{
-		errCmp:    api.NewErrorComponent(api.CmpController),
-		responder: api.GetResponderDefaultInstance(),
-	}
-	authenticatedController := AuthenticatedController{
-		Controller:                      controller,
-		statelessAuthenticationProvider: auth.GetStatelessAuthenticationProviderDefaultInstance(),
-	}
+// NewUserController create a new instance of a user controller using the supplied user and token services, responder and authentication provider
+func NewUserController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider, userService *services.UserService, tokenService *services.TokenService) *UsersController {
+	return newUserController(newAuthenticatedController(api.CmpController, responder, statelessAuthenticationProvider), userService, tokenService)
+}
 
+func newUserController(authenticatedController AuthenticatedController, userService *services.UserService, tokenService *services.TokenService) *UsersController {
 	return &UsersController{
 		AuthenticatedController: authenticatedController,
 		userService:             userService,
+		tokenService:            tokenService,
 	}
 }
 
@@ -64,6 +58,7 @@ func (c *UsersController) CreateUser(w http.ResponseWriter, r *http.Request) {
 		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("request body not valid, missing required fields")), http.StatusBadRequest)
 		return
 	}
+	user.Client = sessionClient(r)
 
 	createdUser, err := c.userService.CreateUser(context.Background(), user)
 	if err != nil {
@@ -75,7 +70,8 @@ func (c *UsersController) CreateUser(w http.ResponseWriter, r *http.Request) {
 	c.responder.JSON(w, r, createdUser, http.StatusCreated)
 }
 
-// LoginUser returns the user found from the given username&password combination
+// LoginUser returns the user found from the given username&password combination, with new auth tokens
+// and a flag telling whether the user already had an active session
 func (c *UsersController) LoginUser(w http.ResponseWriter, r *http.Request) {
 	errCtx := c.errCmp(api.CtxLoginUser, r.Header.Get("X-Request-Id"))
 
@@ -84,10 +80,14 @@ func (c *UsersController) LoginUser(w http.ResponseWriter, r *http.Request) {
 		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode user")), http.StatusBadRequest)
 		return
 	}
+	loginUser.Client = sessionClient(r)
+
 	user, err := c.userService.LoginUser(context.Background(), loginUser)
 	if err != nil {
 		if err == db.ErrNoMatch {
 			c.responder.Error(w, errCtx(api.ErrUserNotFound, errors.New("incorrect username or password")), http.StatusNotFound)
+		} else if err == services.ErrUserDisabled {
+			c.responder.Error(w, errCtx(api.ErrUserDisabled, err), http.StatusForbidden)
 		}
 		return
 	}
@@ -98,12 +98,106 @@ func (c *UsersController) LoginUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GetAllUsers returns all active (non-deleted) users
+// RefreshToken exchanges a refresh token for a new access token and refresh token
+func (c *UsersController) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	errCtx := c.errCmp(api.CtxRefreshToken, r.Header.Get("X-Request-Id"))
+
+	refresh := &payloads.RefreshTokenPayload{}
+	if err := json.NewDecoder(r.Body).Decode(refresh); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode refresh token")), http.StatusBadRequest)
+		return
+	}
+
+	if err := refresh.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, err), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	defer r.Body.Close()
+
+	tokens, err := c.tokenService.RefreshTokens(ctx, refresh)
+	if err != nil {
+		if err == services.ErrInvalidRefreshToken {
+			c.responder.Error(w, errCtx(api.ErrInvalidRefreshToken, err), http.StatusUnauthorized)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrRefreshToken, err))
+		}
+		return
+	}
+
+	if err := render.Render(w, r, tokens); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// LogoutUser revokes the access token of the request and the supplied refresh token,
+// or all refresh tokens of the current user if none is supplied
+func (c *UsersController) LogoutUser(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxLogoutUser, r.Header.Get("X-Request-Id"))
+
+	logout := &payloads.RefreshTokenPayload{}
+	if err := json.NewDecoder(r.Body).Decode(logout); err != nil && err != io.EOF {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("cannot decode refresh token")), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	defer r.Body.Close()
+
+	if err := c.tokenService.Logout(ctx, logout, userContext); err != nil {
+		if err == services.ErrInvalidRefreshToken {
+			c.responder.Error(w, errCtx(api.ErrInvalidRefreshToken, err), http.StatusUnauthorized)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrLogoutUser, err))
+		}
+		return
+	}
+	c.responder.NoContent(w)
+}
+
+// GetSessions returns the active sessions of the current user
+func (c *UsersController) GetSessions(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxGetSessions, r.Header.Get("X-Request-Id"))
+	sessions, err := c.tokenService.GetSessions(userContext)
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrGetSessions, err), http.StatusBadRequest)
+		return
+	}
+
+	if err := render.Render(w, r, sessions); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// LogoutOtherSessions ends all sessions of the current user, except the one making the request
+func (c *UsersController) LogoutOtherSessions(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxLogoutOthers, r.Header.Get("X-Request-Id"))
+
+	if err := c.tokenService.LogoutOtherSessions(context.Background(), userContext); err != nil {
+		c.responder.Error(w, errCtx(api.ErrLogoutUser, err))
+		return
+	}
+	c.responder.NoContent(w)
+}
+
+// GetAllUsers returns a page of the users matching the `username` and `role` query parameters, sorted by
+// `username` or `deposit`. Pages are requested with `limit` and `cursor`
 func (c *UsersController) GetAllUsers(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
 	errCtx := c.errCmp(api.CtxGetUsers, r.Header.Get("X-Request-Id"))
-	users, err := c.userService.GetAllUsers()
+	filter, err := payloads.ParseUserFilter(r.URL.Query())
 	if err != nil {
-		c.responder.Error(w, errCtx(api.ErrGetUsers, err), http.StatusBadRequest)
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, err), http.StatusBadRequest)
+		return
+	}
+
+	users, err := c.userService.GetAllUsers(filter)
+	if err != nil {
+		if err == services.ErrInvalidListParams {
+			c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, err), http.StatusBadRequest)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrGetUsers, err), http.StatusBadRequest)
+		}
 		return
 	}
 
@@ -188,12 +282,18 @@ func (c *UsersController) DepositMoney(w http.ResponseWriter, r *http.Request, u
 		return
 	}
 
-	ctx := context.Background()
+	ctx := r.Context()
 	defer r.Body.Close()
 
 	updatedUser, err := c.userService.DepositMoney(ctx, depositMoney, userContext.ID)
 	if err != nil {
-		c.responder.Error(w, errCtx(api.ErrDepositMoney, err), http.StatusBadRequest)
+		if err == db.ErrNoMatch {
+			c.responder.Error(w, errCtx(api.ErrMachineNotFound, errors.New("no machine with that id")), http.StatusNotFound)
+		} else if err == services.ErrDepositHeldByAnotherMachine {
+			c.responder.Error(w, errCtx(api.ErrDepositHeldByAnotherMachine, err), http.StatusConflict)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrDepositMoney, err), http.StatusBadRequest)
+		}
 		return
 	}
 
@@ -212,7 +312,11 @@ func (c *UsersController) ResetDeposit(w http.ResponseWriter, r *http.Request, u
 
 	updatedUser, err := c.userService.ResetDeposit(ctx, userContext.ID)
 	if err != nil {
-		c.responder.Error(w, errCtx(api.ErrResetDeposit, err), http.StatusBadRequest)
+		if err == services.ErrExactChangeOnly {
+			c.responder.Error(w, errCtx(api.ErrExactChangeOnly, err), http.StatusConflict)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrResetDeposit, err), http.StatusBadRequest)
+		}
 		return
 	}
 
@@ -222,17 +326,25 @@ func (c *UsersController) ResetDeposit(w http.ResponseWriter, r *http.Request, u
 	}
 }
 
-// DeleteUser deletes the currently authenticated user
+// DeleteUser deletes the requested user by id, users may only delete themselves unless they are an admin
 func (c *UsersController) DeleteUser(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
 	errCtx := c.errCmp(api.CtxDeleteUser, r.Header.Get("X-Request-Id"))
+	urlUserID := chi.URLParam(r, "id")
+	userID, err := uuid.FromString(urlUserID)
+	if err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestParameter, fmt.Errorf("invalid userId, %v", err)), http.StatusBadRequest)
+		return
+	}
 
 	ctx := context.Background()
 
-	if err := c.userService.DeleteUser(ctx, userContext.ID); err != nil {
+	if err := c.userService.DeleteUser(ctx, userID, userContext); err != nil {
 		if err == db.ErrNoMatch {
 			c.responder.Error(w, errCtx(api.ErrUserNotFound, errors.New("no user with that id")), http.StatusNotFound)
 		} else if err == db.ErrUserForbidden {
 			c.responder.Error(w, errCtx(api.ErrUserForbidden, err), http.StatusForbidden)
+		} else if err == services.ErrUserHasPurchases {
+			c.responder.Error(w, errCtx(api.ErrUserHasPurchases, err), http.StatusConflict)
 		} else {
 			c.responder.Error(w, errCtx(api.ErrDeleteUser, err), http.StatusBadRequest)
 		}
@@ -256,13 +368,20 @@ func (c *UsersController) BuyProduct(w http.ResponseWriter, r *http.Request, use
 		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, errors.New("request body not valid, missing required fields")), http.StatusBadRequest)
 		return
 	}
+	userProduct.RequestID = r.Header.Get("X-Request-Id")
 
-	ctx := context.Background()
+	ctx := r.Context()
 	defer r.Body.Close()
 
 	userReport, err := c.userService.BuyProduct(ctx, userProduct, userContext.ID)
 	if err != nil {
-		c.responder.Error(w, errCtx(api.ErrBuyProduct, err), http.StatusBadRequest)
+		if err == services.ErrExactChangeOnly {
+			c.responder.Error(w, errCtx(api.ErrExactChangeOnly, err), http.StatusConflict)
+		} else if err == services.ErrDepositHeldByAnotherMachine {
+			c.responder.Error(w, errCtx(api.ErrDepositHeldByAnotherMachine, err), http.StatusConflict)
+		} else {
+			c.responder.Error(w, errCtx(api.ErrBuyProduct, err), http.StatusBadRequest)
+		}
 		return
 	}
 	if err := render.Render(w, r, userReport); err != nil {
@@ -270,3 +389,55 @@ func (c *UsersController) BuyProduct(w http.ResponseWriter, r *http.Request, use
 		return
 	}
 }
+
+// Checkout buys all line items of the request from the machine at once and returns a single receipt
+func (c *UsersController) Checkout(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+	errCtx := c.errCmp(api.CtxCheckout, r.Header.Get("X-Request-Id"))
+
+	checkout := &payloads.CheckoutPayload{}
+	if err := json.NewDecoder(r.Body).Decode(checkout); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, fmt.Errorf("cannot decode checkout payload: %v", err)), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := checkout.Validate(); err != nil {
+		c.responder.Error(w, errCtx(api.ErrInvalidRequestPayload, fmt.Errorf("request body not valid, %v", err)), http.StatusBadRequest)
+		return
+	}
+	checkout.RequestID = r.Header.Get("X-Request-Id")
+
+	receipt, err := c.userService.Checkout(r.Context(), checkout, userContext.ID)
+	if err != nil {
+		switch err {
+		case db.ErrNoMatch:
+			c.responder.Error(w, errCtx(api.ErrProductNotFound, errors.New("no product with that id")), http.StatusNotFound)
+		case services.ErrExactChangeOnly:
+			c.responder.Error(w, errCtx(api.ErrExactChangeOnly, err), http.StatusConflict)
+		case services.ErrDepositHeldByAnotherMachine:
+			c.responder.Error(w, errCtx(api.ErrDepositHeldByAnotherMachine, err), http.StatusConflict)
+		default:
+			c.responder.Error(w, errCtx(api.ErrCheckout, err), http.StatusBadRequest)
+		}
+		return
+	}
+	if err := render.Render(w, r, receipt); err != nil {
+		c.responder.Error(w, errCtx(api.ErrCreatePayload, errors.New("cannot serialize result")), http.StatusBadRequest)
+	}
+}
+
+// sessionClient describes the client making the request, for the session started by it
+func sessionClient(r *http.Request) payloads.SessionClient {
+	ipAddress := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ipAddress = host
+	}
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		ipAddress = strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+	}
+
+	return payloads.SessionClient{
+		UserAgent: r.UserAgent(),
+		IPAddress: ipAddress,
+	}
+}
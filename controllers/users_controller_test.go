@@ -2,6 +2,7 @@ package controllers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -11,33 +12,48 @@ import (
 	"testing"
 
 	"github.com/dhurimkelmendi/vending_machine/api"
-	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/auth"
 	"github.com/dhurimkelmendi/vending_machine/controllers"
-	"github.com/dhurimkelmendi/vending_machine/fixtures"
 	"github.com/dhurimkelmendi/vending_machine/models"
 	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
 	"github.com/go-chi/chi"
 	uuid "github.com/satori/go.uuid"
 )
 
 func TestUserController(t *testing.T) {
 	t.Parallel()
-	fixture := fixtures.GetFixturesDefaultInstance()
-
-	ctrl := controllers.GetControllersDefaultInstance()
-	buyerUser := fixture.User.CreateBuyerUser(t)
-	secondBuyerUser := fixture.User.CreateBuyerUser(t)
-	sellerUser := fixture.User.CreateSellerUser(t)
-	product := fixture.Product.CreateProduct(t, sellerUser.ID)
-	allUserOptions := controllers.AuthorizationOptions{
-		AllowedUserRoles: []models.UserRole{models.UserRoleSeller, models.UserRoleBuyer},
+	a, fixture := newTestApp(t)
+
+	ctrl := a.Controllers
+	buyerUser, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	secondBuyerUser, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	sellerUser, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
 	}
-	buyerOnlyOptions := controllers.AuthorizationOptions{
-		AllowedUserRoles: []models.UserRole{models.UserRoleBuyer},
+	product, err := fixture.Product.CreateProduct(sellerUser.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
 	}
+	machine, err := fixture.Machine.CreateStockedMachine(sellerUser.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	authenticatedOptions := controllers.AuthorizationOptions{}
+	userReadOptions := controllers.RequirePermissions(auth.PermUserRead)
+	userWriteOptions := controllers.RequirePermissions(auth.PermUserWrite.Own(), auth.PermUserWrite.Any())
+	depositWriteOptions := controllers.RequirePermissions(auth.PermDepositWrite)
+	productBuyOptions := controllers.RequirePermissions(auth.PermProductBuy)
 
 	// generate non-existing user token by using user.ID = -1, which doesn't exist because user.ID is autoincrement
-	invalidUserToken, _ := GetInvalidAuthToken()
+	invalidUserToken, _ := GetInvalidAuthToken(a.Stateless)
 
 	t.Run("create user", func(t *testing.T) {
 		r := chi.NewRouter()
@@ -58,7 +74,7 @@ func TestUserController(t *testing.T) {
 	t.Run("get user", func(t *testing.T) {
 		r := chi.NewRouter()
 		URL := fmt.Sprintf("/api/v1/users/%s", buyerUser.ID.String())
-		r.Get("/api/v1/users/{id}", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetUser, ctrl.Users.GetUserByID, allUserOptions))
+		r.Get("/api/v1/users/{id}", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetUser, ctrl.Users.GetUserByID, userReadOptions))
 
 		req := httptest.NewRequest(http.MethodGet, URL, nil)
 		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyerUser.Token))
@@ -90,7 +106,7 @@ func TestUserController(t *testing.T) {
 
 	t.Run("get all users", func(t *testing.T) {
 		r := chi.NewRouter()
-		r.Get("/api/v1/users", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetUsers, ctrl.Users.GetAllUsers, allUserOptions))
+		r.Get("/api/v1/users", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetUsers, ctrl.Users.GetAllUsers, userReadOptions))
 		URL := "/api/v1/users"
 
 		req := httptest.NewRequest(http.MethodGet, URL, nil)
@@ -107,7 +123,7 @@ func TestUserController(t *testing.T) {
 	t.Run("update user", func(t *testing.T) {
 		r := chi.NewRouter()
 		URL := fmt.Sprintf("/api/v1/user")
-		r.Patch("/api/v1/user", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxUpdateUser, ctrl.Users.UpdateUser, allUserOptions))
+		r.Patch("/api/v1/user", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxUpdateUser, ctrl.Users.UpdateUser, userWriteOptions))
 
 		t.Run("without permission", func(t *testing.T) {
 			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"id":"%s","username":"%s"}`, buyerUser.ID, strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18])))
@@ -164,10 +180,10 @@ func TestUserController(t *testing.T) {
 	t.Run("deposit money", func(t *testing.T) {
 		r := chi.NewRouter()
 		URL := fmt.Sprintf("/api/v1/deposit")
-		r.Post("/api/v1/deposit", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, ctrl.Users.DepositMoney, buyerOnlyOptions))
+		r.Post("/api/v1/deposit", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, ctrl.Users.DepositMoney, depositWriteOptions))
 
 		t.Run("as seller(without permission)", func(t *testing.T) {
-			acceptableDepositAmountValues := config.GetDefaultInstance().AcceptableDepositAmountValues
+			acceptableDepositAmountValues := a.Config.AcceptableDepositAmountValues
 			newDepositAmount := acceptableDepositAmountValues[rand.Intn(len(acceptableDepositAmountValues))]
 			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"deposit":%d}`, newDepositAmount)))
 			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
@@ -182,9 +198,9 @@ func TestUserController(t *testing.T) {
 		})
 		t.Run("as buyer", func(t *testing.T) {
 			t.Run("acceptable amount", func(t *testing.T) {
-				acceptableDepositAmountValues := config.GetDefaultInstance().AcceptableDepositAmountValues
+				acceptableDepositAmountValues := a.Config.AcceptableDepositAmountValues
 				newDepositAmount := acceptableDepositAmountValues[rand.Intn(len(acceptableDepositAmountValues))]
-				bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"deposit_amount":%d}`, newDepositAmount)))
+				bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"machine_id":"%s","deposit_amount":%d}`, machine.ID.String(), newDepositAmount)))
 				req := httptest.NewRequest(http.MethodPost, URL, bBuf)
 				req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyerUser.Token))
 				oldDepositAmount := buyerUser.Deposit
@@ -207,9 +223,122 @@ func TestUserController(t *testing.T) {
 					t.Fatalf("unexpected deposit amount, got: %+v", deposit)
 				}
 			})
+			t.Run("while the deposit is held by another machine", func(t *testing.T) {
+				otherMachine, err := fixture.Machine.CreateStockedMachine(sellerUser.ID)
+				if err != nil {
+					t.Fatalf("could not create stocked machine: %+v", err)
+				}
+				acceptableDepositAmountValues := a.Config.AcceptableDepositAmountValues
+				bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"machine_id":"%s","deposit_amount":%d}`, otherMachine.ID.String(), acceptableDepositAmountValues[0])))
+				req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+				req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyerUser.Token))
+				res := httptest.NewRecorder()
+				r.ServeHTTP(res, req)
+
+				ExpectStatusCode(t, res, http.StatusConflict)
+			})
+			t.Run("retried with the same idempotency key", func(t *testing.T) {
+				idempotentRouter := chi.NewRouter()
+				idempotentRouter.Post("/api/v1/deposit", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, ctrl.Idempotent(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, ctrl.Users.DepositMoney), depositWriteOptions))
+				idempotencyKey := uuid.NewV4().String()
+				deposit := func(depositAmount int32) *httptest.ResponseRecorder {
+					bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"machine_id":"%s","deposit_amount":%d}`, machine.ID.String(), depositAmount)))
+					req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+					req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondBuyerUser.Token))
+					req.Header.Add(controllers.IdempotencyKeyHeader, idempotencyKey)
+					res := httptest.NewRecorder()
+					idempotentRouter.ServeHTTP(res, req)
+					return res
+				}
+
+				acceptableDepositAmountValues := a.Config.AcceptableDepositAmountValues
+				newDepositAmount := acceptableDepositAmountValues[0]
+				firstRes := deposit(newDepositAmount)
+				ExpectStatusCode(t, firstRes, http.StatusOK)
+
+				retryRes := deposit(newDepositAmount)
+				ExpectStatusCode(t, retryRes, http.StatusOK)
+				if retryRes.Header().Get(controllers.IdempotentReplayedHeader) != "true" || retryRes.Body.String() != firstRes.Body.String() {
+					t.Fatalf("expected the first response to be replayed, got: %+v", retryRes.Body.String())
+				}
+
+				user, err := a.Services.Users.GetUserByID(secondBuyerUser.ID)
+				if err != nil {
+					t.Fatalf("could not retrieve user: %+v", err)
+				}
+				if user.Deposit != secondBuyerUser.Deposit+newDepositAmount {
+					t.Fatalf("expected deposit to be credited once, got: %+v", user.Deposit)
+				}
+
+				ExpectStatusCode(t, deposit(acceptableDepositAmountValues[1]), http.StatusConflict)
+			})
+			t.Run("retried after the handler failed", func(t *testing.T) {
+				send := func(idempotencyKey string, handler controllers.AuthenticatedHandlerFunc) (res *httptest.ResponseRecorder, panicked bool) {
+					idempotentRouter := chi.NewRouter()
+					idempotentRouter.Post("/api/v1/deposit", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, ctrl.Idempotent(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, handler), depositWriteOptions))
+					req := httptest.NewRequest(http.MethodPost, URL, bytes.NewBuffer([]byte("{}")))
+					req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", secondBuyerUser.Token))
+					req.Header.Add(controllers.IdempotencyKeyHeader, idempotencyKey)
+					res = httptest.NewRecorder()
+					defer func() {
+						panicked = recover() != nil
+					}()
+					idempotentRouter.ServeHTTP(res, req)
+					return res, false
+				}
+				depositAmount := a.Config.AcceptableDepositAmountValues[0]
+				depositThenFail := func(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+					depositMoney := &payloads.DepositMoneyPayload{MachineID: machine.ID, DepositAmount: depositAmount}
+					if _, err := a.Services.Users.DepositMoney(r.Context(), depositMoney, userContext.ID); err != nil {
+						t.Fatalf("could not deposit money: %+v", err)
+					}
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+
+				t.Run("keeps the key once it has committed", func(t *testing.T) {
+					user, err := a.Services.Users.GetUserByID(secondBuyerUser.ID)
+					if err != nil {
+						t.Fatalf("could not retrieve user: %+v", err)
+					}
+					idempotencyKey := uuid.NewV4().String()
+					res, _ := send(idempotencyKey, depositThenFail)
+					ExpectStatusCode(t, res, http.StatusInternalServerError)
+
+					retryRes, _ := send(idempotencyKey, depositThenFail)
+					ExpectStatusCode(t, retryRes, http.StatusInternalServerError)
+					if retryRes.Header().Get(controllers.IdempotentReplayedHeader) != "true" {
+						t.Fatalf("expected the failed response to be replayed")
+					}
+
+					updatedUser, err := a.Services.Users.GetUserByID(secondBuyerUser.ID)
+					if err != nil {
+						t.Fatalf("could not retrieve user: %+v", err)
+					}
+					if updatedUser.Deposit != user.Deposit+depositAmount {
+						t.Fatalf("expected deposit to be credited once, got: %+v", updatedUser.Deposit)
+					}
+				})
+				t.Run("releases the key after a panic", func(t *testing.T) {
+					idempotencyKey := uuid.NewV4().String()
+					_, panicked := send(idempotencyKey, func(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+						panic("handler failed")
+					})
+					if !panicked {
+						t.Fatalf("expected the panic to be passed on")
+					}
+
+					retryRes, _ := send(idempotencyKey, func(w http.ResponseWriter, r *http.Request, userContext auth.UserContext) {
+						w.WriteHeader(http.StatusOK)
+					})
+					ExpectStatusCode(t, retryRes, http.StatusOK)
+					if retryRes.Header().Get(controllers.IdempotentReplayedHeader) == "true" {
+						t.Fatalf("expected the request to run again")
+					}
+				})
+			})
 			t.Run("unacceptable amount", func(t *testing.T) {
 				newDepositAmount := 222
-				bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"deposit_amount":%d}`, newDepositAmount)))
+				bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"machine_id":"%s","deposit_amount":%d}`, machine.ID.String(), newDepositAmount)))
 				req := httptest.NewRequest(http.MethodPost, URL, bBuf)
 				req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyerUser.Token))
 
@@ -231,7 +360,7 @@ func TestUserController(t *testing.T) {
 	t.Run("reset deposit", func(t *testing.T) {
 		r := chi.NewRouter()
 		URL := fmt.Sprintf("/api/v1/reset")
-		r.Post("/api/v1/reset", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, ctrl.Users.ResetDeposit, buyerOnlyOptions))
+		r.Post("/api/v1/reset", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, ctrl.Users.ResetDeposit, depositWriteOptions))
 
 		t.Run("as seller(without permission)", func(t *testing.T) {
 			bBuf := bytes.NewBuffer([]byte(""))
@@ -272,26 +401,40 @@ func TestUserController(t *testing.T) {
 
 	t.Run("delete user", func(t *testing.T) {
 		r := chi.NewRouter()
+		r.Delete("/api/v1/users/{id}", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDeleteUser, ctrl.Users.DeleteUser, userWriteOptions))
 
-		t.Run("without permission / non-existing user", func(t *testing.T) {
-			URL := "/api/v1/user"
-			r.Delete("/api/v1/user", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDeleteUser, ctrl.Users.DeleteUser, allUserOptions))
+		t.Run("without permission", func(t *testing.T) {
+			URL := fmt.Sprintf("/api/v1/users/%s", secondBuyerUser.ID)
 			req := httptest.NewRequest(http.MethodDelete, URL, nil)
-			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", invalidUserToken))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyerUser.Token))
+
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("expected http status code of 403 but got: %+v, %+v", res.Code, res.Body.String())
+			}
+		})
+
+		t.Run("with invalid id", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/users/invalid", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyerUser.Token))
 
 			res := httptest.NewRecorder()
 			r.ServeHTTP(res, req)
 
-			if res.Code != http.StatusNotFound {
-				t.Fatalf("expected http status code of 404 but got: %+v, %+v", res.Code, res.Body.String())
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected http status code of 400 but got: %+v, %+v", res.Code, res.Body.String())
 			}
 		})
 
 		t.Run("existing user", func(t *testing.T) {
-			newUser := fixture.User.CreateBuyerUser(t)
+			newUser, err := fixture.User.CreateBuyerUser()
+			if err != nil {
+				t.Fatalf("could not create buyer: %+v", err)
+			}
 
-			URL := "/api/v1/user"
-			r.Delete("/api/v1/user", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDeleteUser, ctrl.Users.DeleteUser, allUserOptions))
+			URL := fmt.Sprintf("/api/v1/users/%s", newUser.ID)
 			req := httptest.NewRequest(http.MethodDelete, URL, nil)
 			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", newUser.Token))
 
@@ -318,13 +461,13 @@ func TestUserController(t *testing.T) {
 	t.Run("user buys product", func(t *testing.T) {
 		r := chi.NewRouter()
 		URL := fmt.Sprintf("/api/v1/deposit")
-		r.Post("/api/v1/deposit", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxBuyProduct, ctrl.Users.BuyProduct, buyerOnlyOptions))
+		r.Post("/api/v1/deposit", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxBuyProduct, ctrl.Users.BuyProduct, productBuyOptions))
 		t.Run("with sufficient deposit", func(t *testing.T) {
 			productAmount := 1
 			oldDepositAmount := buyerUser.Deposit
 			newDepositAmount := oldDepositAmount
 
-			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"user_id":"%s","product_id":"%s","amount":%d}`, buyerUser.ID.String(), product.ID.String(), productAmount)))
+			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"machine_id":"%s","product_id":"%s","amount":%d}`, machine.ID.String(), product.ID.String(), productAmount)))
 			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
 			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", buyerUser.Token))
 			res := httptest.NewRecorder()
@@ -346,4 +489,130 @@ func TestUserController(t *testing.T) {
 			}
 		})
 	})
+	t.Run("refresh token", func(t *testing.T) {
+		user, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		r := chi.NewRouter()
+		URL := "/public/api/v1/users/refresh"
+		r.Post(URL, ctrl.Users.RefreshToken)
+
+		refresh := func(refreshToken string) *httptest.ResponseRecorder {
+			bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"refresh_token":"%s"}`, refreshToken)))
+			req := httptest.NewRequest(http.MethodPost, URL, bBuf)
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+			return res
+		}
+
+		res := refresh(user.RefreshToken)
+		ExpectStatusCode(t, res, http.StatusOK)
+		ExpectJson(t, res)
+		tokens := &payloads.AuthTokens{}
+		if err := json.NewDecoder(res.Body).Decode(tokens); err != nil {
+			t.Fatalf("error decoding response body: %+v", err)
+		}
+		if tokens.Token == "" || tokens.RefreshToken == "" || tokens.RefreshToken == user.RefreshToken {
+			t.Fatalf("expected a new access token and refresh token, got: %+v", tokens)
+		}
+
+		t.Run("used refresh token", func(t *testing.T) {
+			ExpectStatusCode(t, refresh(user.RefreshToken), http.StatusUnauthorized)
+		})
+		t.Run("unknown refresh token", func(t *testing.T) {
+			ExpectStatusCode(t, refresh(uuid.NewV4().String()), http.StatusUnauthorized)
+		})
+	})
+
+	t.Run("logout user", func(t *testing.T) {
+		user, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		stateless := a.Stateless
+		r := chi.NewRouter()
+		r.Use(stateless.Verifier)
+		r.Use(stateless.Authenticator)
+		r.Post("/api/v1/users/logout", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxLogoutUser, ctrl.Users.LogoutUser, authenticatedOptions))
+		r.Get("/api/v1/users", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetUsers, ctrl.Users.GetAllUsers, userReadOptions))
+
+		bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"refresh_token":"%s"}`, user.RefreshToken)))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users/logout", bBuf)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", user.Token))
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		ExpectStatusCode(t, res, http.StatusNoContent)
+
+		t.Run("access token is revoked", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", user.Token))
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+			ExpectStatusCode(t, res, http.StatusUnauthorized)
+		})
+
+		t.Run("refresh token is revoked", func(t *testing.T) {
+			_, err := a.Services.Tokens.RefreshTokens(context.Background(), &payloads.RefreshTokenPayload{RefreshToken: user.RefreshToken})
+			if err != services.ErrInvalidRefreshToken {
+				t.Fatalf("expected %v, got %+v", services.ErrInvalidRefreshToken, err)
+			}
+		})
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		user, err := fixture.User.CreateSellerUser()
+		if err != nil {
+			t.Fatalf("could not create seller: %+v", err)
+		}
+		stateless := a.Stateless
+		r := chi.NewRouter()
+		r.Post("/public/api/v1/users/login", ctrl.Users.LoginUser)
+		r.Group(func(r chi.Router) {
+			r.Use(stateless.Verifier)
+			r.Use(stateless.Authenticator)
+			r.Get("/api/v1/sessions", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetSessions, ctrl.Users.GetSessions, authenticatedOptions))
+			r.Post("/api/v1/logout/all", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxLogoutOthers, ctrl.Users.LogoutOtherSessions, authenticatedOptions))
+		})
+
+		bBuf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"username":"%s","password":"password"}`, user.Username)))
+		req := httptest.NewRequest(http.MethodPost, "/public/api/v1/users/login", bBuf)
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		ExpectStatusCode(t, res, http.StatusOK)
+		loggedInUser := &models.User{}
+		if err := json.NewDecoder(res.Body).Decode(loggedInUser); err != nil {
+			t.Fatalf("error decoding response body: %+v", err)
+		}
+		if !loggedInUser.HasActiveSession {
+			t.Fatalf("expected login to report the already active session, got: %+v", loggedInUser)
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", loggedInUser.Token))
+		res = httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		ExpectStatusCode(t, res, http.StatusOK)
+		sessions := &payloads.SessionList{}
+		if err := json.NewDecoder(res.Body).Decode(sessions); err != nil {
+			t.Fatalf("error decoding response body: %+v", err)
+		}
+		if len(sessions.Sessions) != 2 {
+			t.Fatalf("expected two active sessions, got: %+v", sessions.Sessions)
+		}
+
+		req = httptest.NewRequest(http.MethodPost, "/api/v1/logout/all", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", loggedInUser.Token))
+		res = httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		ExpectStatusCode(t, res, http.StatusNoContent)
+
+		t.Run("token of the other session is rejected", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", user.Token))
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+			ExpectStatusCode(t, res, http.StatusUnauthorized)
+		})
+	})
 }
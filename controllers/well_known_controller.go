@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+)
+
+// A WellKnownController handles HTTP requests for the public metadata of the API under /.well-known.
+type WellKnownController struct {
+	Controller
+	statelessAuthenticationProvider *auth.StatelessAuthenticationProvider
+}
+
+// GetWellKnownControllerDefaultInstance returns the default instance of WellKnownController.
+func GetWellKnownControllerDefaultInstance() *WellKnownController {
+	return GetControllersDefaultInstance().WellKnown
+}
+
+// NewWellKnownController create a new instance of a well-known controller using the supplied responder and authentication provider
+func NewWellKnownController(responder *api.Responder, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider) *WellKnownController {
+	return newWellKnownController(newController(api.CmpController, responder), statelessAuthenticationProvider)
+}
+
+func newWellKnownController(controller Controller, statelessAuthenticationProvider *auth.StatelessAuthenticationProvider) *WellKnownController {
+	return &WellKnownController{
+		Controller:                      controller,
+		statelessAuthenticationProvider: statelessAuthenticationProvider,
+	}
+}
+
+// GetJWKS returns the public keys access tokens can be verified with, as a JSON Web Key Set
+func (c *WellKnownController) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	c.responder.JSON(w, r, c.statelessAuthenticationProvider.PublicKeys())
+}
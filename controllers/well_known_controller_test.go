@@ -0,0 +1,42 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestWellKnownController(t *testing.T) {
+	t.Parallel()
+	a, _ := newTestApp(t)
+	ctrl := a.Controllers
+
+	t.Run("get jwks", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Get("/.well-known/jwks.json", ctrl.WellKnown.GetJWKS)
+
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		ExpectStatusCode(t, res, http.StatusOK)
+		ExpectJson(t, res)
+
+		body := make(map[string][]map[string]interface{})
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("error decoding response body: %+v", err)
+		}
+		keys, ok := body["keys"]
+		if !ok {
+			t.Fatalf("expected a key set, got: %+v", body)
+		}
+		for _, key := range keys {
+			if key["kty"] == "oct" || key["d"] != nil {
+				t.Fatalf("expected only public keys to be published, got: %+v", key)
+			}
+		}
+	})
+}
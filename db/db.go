@@ -1,17 +1,22 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"net/url"
+	"sync"
 
 	"github.com/dhurimkelmendi/vending_machine/config"
-	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/sirupsen/logrus"
 
 	"github.com/go-pg/pg/extra/pgdebug"
 	"github.com/go-pg/pg/v10"
-	"github.com/go-pg/pg/v10/orm"
 
 	//blank import pq
 	_ "github.com/lib/pq"
+	//blank import go-sqlite3, registering the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
 )
 
 // ErrNoMatch is returned when we request a row that doesn't exist
@@ -24,34 +29,97 @@ var ErrUserForbidden = fmt.Errorf("user is forbidden")
 type Database struct {
 	config *config.Config
 	db     *pg.DB
+	sqlite *sql.DB
 }
 
-var defaultInstance *Database
+var (
+	defaultInstance     *Database
+	defaultInstanceOnce sync.Once
+)
 
-// GetDefaultInstance returns the default instance of Database
+// GetDefaultInstance returns the default instance of Database, connected with the default config
 func GetDefaultInstance() *Database {
-	if defaultInstance == nil {
-		defaultInstance = &Database{
-			config: config.GetDefaultInstance(),
+	defaultInstanceOnce.Do(func() {
+		database, err := New(config.GetDefaultInstance())
+		if err != nil {
+			logrus.Fatalf("Could not connect to database: %+v", err)
 		}
-		defaultInstance.connect()
-		// register all many-to-many relationships
-		orm.RegisterTable((*models.UsersProduct)(nil))
-	}
+		defaultInstance = database
+	})
 	return defaultInstance
 }
 
-// GetDB returns the *pg.DB connection
+// New creates a Database connected with the given config. The connection to Postgres is only made once it is
+// first used, SQLite databases are opened right away and the memory driver connects to nothing
+func New(cfg *config.Config) (*Database, error) {
+	d := &Database{
+		config: cfg,
+	}
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// GetDB returns the *pg.DB connection, or nil unless the postgres driver is configured
 func (d *Database) GetDB() *pg.DB {
 	return d.db
 }
-func (d *Database) connect() {
-	d.db = pg.Connect(&pg.Options{
+
+// GetSQLite returns the connection to the SQLite database, or nil unless the sqlite driver is configured
+func (d *Database) GetSQLite() *sql.DB {
+	return d.sqlite
+}
+
+// IsSQLite returns true if all records are kept in SQLite, in which case there is no connection to Postgres
+func (d *Database) IsSQLite() bool {
+	return d.sqlite != nil
+}
+
+// IsMemory returns true if all records are kept in memory, in which case there are no connections
+func (d *Database) IsMemory() bool {
+	return d.config.DatabaseDriver == config.DatabaseDriverMemory
+}
+
+// Close closes the connections of the database
+func (d *Database) Close() error {
+	if d.sqlite != nil {
+		if err := d.sqlite.Close(); err != nil {
+			return err
+		}
+	}
+	if d.db == nil {
+		return nil
+	}
+	return d.db.Close()
+}
+
+func (d *Database) connect() error {
+	if d.IsMemory() {
+		return nil
+	}
+	if d.config.DatabaseDriver == config.DatabaseDriverSQLite {
+		sqlite, err := OpenSQLite(d.config.DatabasePath)
+		if err != nil {
+			return fmt.Errorf("could not open SQLite database %s: %w", d.config.DatabasePath, err)
+		}
+		d.sqlite = sqlite
+		return nil
+	}
+
+	options := &pg.Options{
 		Addr:     d.config.DatabaseHost + ":" + d.config.DatabasePort,
 		Database: d.config.DatabaseName,
 		User:     d.config.DatabaseUsername,
 		Password: d.config.DatabasePassword,
-	})
+	}
+	if schema := d.config.DatabaseSchema; schema != "" {
+		options.OnConnect = func(ctx context.Context, cn *pg.Conn) error {
+			_, err := cn.ExecContext(ctx, "SET search_path = ?, public", pg.Ident(schema))
+			return err
+		}
+	}
+	d.db = pg.Connect(options)
 
 	if d.config.DebugDatabase {
 		// Print all queries.
@@ -59,4 +127,23 @@ func (d *Database) connect() {
 			Verbose: true,
 		})
 	}
+	return nil
+}
+
+// OpenSQLite opens the SQLite database at the given path, creating it if it does not exist. Foreign keys are
+// enforced, and transactions take the write lock when they begin, so that concurrent transactions wait for each
+// other instead of failing when they start to write
+func OpenSQLite(path string) (*sql.DB, error) {
+	options := url.Values{}
+	options.Set("_foreign_keys", "on")
+	options.Set("_busy_timeout", "5000")
+	options.Set("_txlock", "immediate")
+	sqlite, err := sql.Open("sqlite3", "file:"+path+"?"+options.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlite.Ping(); err != nil {
+		return nil, err
+	}
+	return sqlite, nil
 }
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-pg/pg/v10/types"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Nullable uuid columns, such as the machine holding a deposit, are scanned into uuid.UUID fields. go-pg scans
+// NULL by calling Scan(nil), which uuid.UUID rejects, so NULL is scanned as uuid.Nil instead
+func init() {
+	types.RegisterScanner(uuid.UUID{}, scanUUID)
+}
+
+func scanUUID(v reflect.Value, rd types.Reader, n int) error {
+	if !v.CanSet() {
+		return fmt.Errorf("pg: Scan(non-settable %s)", v.Type())
+	}
+	if n == -1 {
+		v.Set(reflect.ValueOf(uuid.Nil))
+		return nil
+	}
+	tmp, err := rd.ReadFullTemp()
+	if err != nil {
+		return err
+	}
+	return v.Addr().Interface().(*uuid.UUID).Scan(tmp)
+}
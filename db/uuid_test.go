@@ -0,0 +1,21 @@
+package db_test
+
+import (
+	"reflect"
+	"testing"
+
+	_ "github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/go-pg/pg/v10/types"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestScanNullUUID(t *testing.T) {
+	scan := types.Scanner(reflect.TypeOf(uuid.UUID{}))
+	id := uuid.NewV4()
+	if err := scan(reflect.ValueOf(&id).Elem(), nil, -1); err != nil {
+		t.Fatalf("scan of NULL failed: %+v", err)
+	}
+	if id != uuid.Nil {
+		t.Fatalf("expected NULL to scan as uuid.Nil, got: %s", id)
+	}
+}
@@ -0,0 +1,25 @@
+package fixtures
+
+import (
+	"context"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+// CategoryFixture is a struct that contains a reference to the CategoryService
+type CategoryFixture struct {
+	categoryService *services.CategoryService
+}
+
+// CreateCategory creates a category with a random name under the given parent, uuid.Nil creates a root category
+func (f *CategoryFixture) CreateCategory(parentID uuid.UUID) (*models.Category, error) {
+	category := &payloads.CategoryPayload{
+		Name:     uuid.NewV4().String(),
+		ParentID: parentID,
+	}
+
+	return f.categoryService.CreateCategory(context.Background(), category)
+}
@@ -0,0 +1,27 @@
+package fixtures
+
+import (
+	"context"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+)
+
+// CoinInventoryFixture is a struct that contains references to the CoinInventoryService and the accepted denominations
+type CoinInventoryFixture struct {
+	coinInventoryService *services.CoinInventoryService
+	denominations        []int32
+}
+
+// StockCoins refills the machine with enough coins of every denomination to pay out the change of fixture users
+func (f *CoinInventoryFixture) StockCoins(machine *models.Machine) (*payloads.CoinInventoryList, error) {
+	refillCoins := &payloads.RefillCoinsPayload{Coins: map[int32]int32{}}
+	for _, denomination := range f.denominations {
+		refillCoins.Coins[denomination] = 1000
+	}
+	ctx := context.Background()
+	operatorContext := auth.UserContext{ID: machine.OperatorID, Role: models.UserRoleSeller}
+	return f.coinInventoryService.RefillCoins(ctx, machine.ID, refillCoins, operatorContext)
+}
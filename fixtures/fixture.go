@@ -1,27 +1,37 @@
 package fixtures
 
-import "github.com/dhurimkelmendi/vending_machine/db"
+import (
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/services"
+)
 
 // Fixtures is a struct that contains references to all fixture instances.
 type Fixtures struct {
-	User        *UserFixture
-	Product     *ProductFixture
-	UserProduct *UserProductFixture
+	User          *UserFixture
+	Product       *ProductFixture
+	Category      *CategoryFixture
+	Promotion     *PromotionFixture
+	Purchase      *PurchaseFixture
+	CoinInventory *CoinInventoryFixture
+	Machine       *MachineFixture
 }
 
-var fixturesDefaultInstance *Fixtures
-
-// GetFixturesDefaultInstance returns the default instance of Fixtures
-func GetFixturesDefaultInstance() *Fixtures {
-	if fixturesDefaultInstance == nil {
-		// Purposeful pre-initialize
-		_ = db.GetDefaultInstance()
-
-		fixturesDefaultInstance = &Fixtures{
-			User:        GetUserFixtureDefaultInstance(),
-			Product:     GetProductFixtureDefaultInstance(),
-			UserProduct: GetUserProductFixtureDefaultInstance(),
-		}
+// New creates fixtures that create their records with the given services
+func New(cfg *config.Config, svc *services.Services) *Fixtures {
+	coinInventory := &CoinInventoryFixture{
+		coinInventoryService: svc.CoinInventory,
+		denominations:        cfg.AcceptableDepositAmountValues,
+	}
+	return &Fixtures{
+		User:          &UserFixture{userService: svc.Users},
+		Product:       &ProductFixture{productService: svc.Products},
+		Category:      &CategoryFixture{categoryService: svc.Categories},
+		Promotion:     &PromotionFixture{promotionService: svc.Promotions},
+		Purchase:      &PurchaseFixture{userService: svc.Users},
+		CoinInventory: coinInventory,
+		Machine: &MachineFixture{
+			machineService: svc.Machines,
+			coinInventory:  coinInventory,
+		},
 	}
-	return fixturesDefaultInstance
 }
@@ -0,0 +1,60 @@
+package fixtures
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+// MachineFixture is a struct that contains references to the MachineService and the CoinInventoryFixture
+type MachineFixture struct {
+	machineService *services.MachineService
+	coinInventory  *CoinInventoryFixture
+}
+
+// CreateMachine creates an empty machine operated by the given seller
+func (f *MachineFixture) CreateMachine(operatorID uuid.UUID) (*models.Machine, error) {
+	machine := &payloads.CreateMachinePayload{}
+	machine.Name = strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
+	machine.Location = "Fixture location"
+
+	ctx := context.Background()
+	return f.machineService.CreateMachine(ctx, machine, operatorID)
+}
+
+// StockProduct fills the slot with the given code with the product
+func (f *MachineFixture) StockProduct(machine *models.Machine, code string, productID uuid.UUID, quantity int32) (*models.Slot, error) {
+	slot := &payloads.AssignSlotPayload{
+		Code:      code,
+		ProductID: productID,
+		Capacity:  quantity,
+		Quantity:  quantity,
+	}
+	ctx := context.Background()
+	operatorContext := auth.UserContext{ID: machine.OperatorID, Role: models.UserRoleSeller}
+	return f.machineService.AssignSlot(ctx, machine.ID, slot, operatorContext)
+}
+
+// CreateStockedMachine creates a machine holding enough coins to pay out the change of fixture users,
+// with a slot of 1000 units for each of the given products
+func (f *MachineFixture) CreateStockedMachine(operatorID uuid.UUID, products ...*models.Product) (*models.Machine, error) {
+	machine, err := f.CreateMachine(operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.coinInventory.StockCoins(machine); err != nil {
+		return nil, err
+	}
+	for i, product := range products {
+		if _, err := f.StockProduct(machine, fmt.Sprintf("A%d", i+1), product.ID, 1000); err != nil {
+			return nil, err
+		}
+	}
+	return machine, nil
+}
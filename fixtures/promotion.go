@@ -0,0 +1,29 @@
+package fixtures
+
+import (
+	"context"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+// PromotionFixture is a struct that contains a reference to the PromotionService
+type PromotionFixture struct {
+	promotionService *services.PromotionService
+}
+
+// CreatePercentagePromotion creates a promotion of the seller taking the percentage off the products
+func (f *PromotionFixture) CreatePercentagePromotion(seller *models.User, percentage int32, productIDs ...uuid.UUID) (*models.Promotion, error) {
+	promotion := &payloads.PromotionPayload{
+		Name:       uuid.NewV4().String(),
+		Type:       models.PromotionTypePercentage,
+		ProductIDs: productIDs,
+		Value:      percentage,
+	}
+
+	userContext := auth.UserContext{ID: seller.ID, Role: seller.Role}
+	return f.promotionService.CreatePromotion(context.Background(), promotion, userContext)
+}
@@ -0,0 +1,23 @@
+package fixtures
+
+import (
+	"context"
+
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+// PurchaseFixture is a struct that contains a reference to the UserService
+type PurchaseFixture struct {
+	userService *services.UserService
+}
+
+// CreatePurchase buys a single unit of the given product from the given machine for the given user
+func (f *PurchaseFixture) CreatePurchase(machineID uuid.UUID, productID uuid.UUID, userID uuid.UUID) (*payloads.UserBuysReport, error) {
+	purchase := &payloads.UserProductPurchase{}
+	purchase.MachineID = machineID
+	purchase.ProductID = productID
+	purchase.Amount = 1
+	return f.userService.BuyProduct(context.Background(), purchase, userID)
+}
@@ -4,65 +4,34 @@ import (
 	"context"
 	"math/rand"
 	"strings"
-	"testing"
 
 	"github.com/brianvoe/gofakeit"
-	"github.com/dhurimkelmendi/vending_machine/db"
 	"github.com/dhurimkelmendi/vending_machine/models"
 	"github.com/dhurimkelmendi/vending_machine/payloads"
 	"github.com/dhurimkelmendi/vending_machine/services"
-	"github.com/go-pg/pg/v10"
 	uuid "github.com/satori/go.uuid"
 )
 
-// UserFixture is a struct that contains references to the db and UserService
+// UserFixture is a struct that contains a reference to the UserService
 type UserFixture struct {
-	db          *pg.DB
 	userService *services.UserService
 }
 
-var userFixtureDefaultInstance *UserFixture
-
-// GetUserFixtureDefaultInstance returns the default instance of UserFixture
-func GetUserFixtureDefaultInstance() *UserFixture {
-	if userFixtureDefaultInstance == nil {
-		userFixtureDefaultInstance = &UserFixture{
-			db:          db.GetDefaultInstance().GetDB(),
-			userService: services.GetUserServiceDefaultInstance(),
-		}
-	}
-
-	if userFixtureDefaultInstance.userService == nil {
-		userFixtureDefaultInstance.userService = services.GetUserServiceDefaultInstance()
-	}
-
-	return userFixtureDefaultInstance
-}
-
 // CreateBuyerUser creates a user with fake data with buyer role
-func (f *UserFixture) CreateBuyerUser(t *testing.T) *models.User {
+func (f *UserFixture) CreateBuyerUser() (*models.User, error) {
 	user := &payloads.CreateUserPayload{}
 	user.Username = strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
 	user.Password = gofakeit.Password(true, false, false, false, false, 10)
 	user.Role = models.UserRoleBuyer
 
-	user.Deposit = int32(rand.Intn(1000)+rand.Intn(1000)) * 5
-
-	ctx := context.Background()
+	// enough to buy a few units of any fixture product
+	user.Deposit = int32(rand.Intn(1000)+1000) * 5
 
-	if f.userService == nil {
-		t.Log("CreateBuyerUser: fixture.UserService is nil!")
-	}
-
-	createdUser, err := f.userService.CreateUser(ctx, user)
-	if err != nil {
-		return nil
-	}
-	return createdUser
+	return f.userService.CreateUser(context.Background(), user)
 }
 
 // CreateSellerUser creates a user with fake data with seller role
-func (f *UserFixture) CreateSellerUser(t *testing.T) *models.User {
+func (f *UserFixture) CreateSellerUser() (*models.User, error) {
 	user := &payloads.CreateUserPayload{}
 	user.Username = strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
 	user.Password = "password"
@@ -70,14 +39,23 @@ func (f *UserFixture) CreateSellerUser(t *testing.T) *models.User {
 
 	user.Deposit = int32(rand.Intn(1000)+rand.Intn(1000)) * 5
 
-	ctx := context.Background()
+	return f.userService.CreateUser(context.Background(), user)
+}
 
-	if f.userService == nil {
-		t.Log("CreateSellerUser: fixture.UserService is nil!")
-	}
+// CreateAdminUser creates a user with fake data, promotes it to the admin role and logs it in again
+func (f *UserFixture) CreateAdminUser() (*models.User, error) {
+	user := &payloads.CreateUserPayload{}
+	user.Username = strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
+	user.Password = "password"
+	user.Role = models.UserRoleSeller
+
+	ctx := context.Background()
 	createdUser, err := f.userService.CreateUser(ctx, user)
 	if err != nil {
-		return nil
+		return nil, err
+	}
+	if _, err := f.userService.UpdateUserRole(ctx, createdUser.ID, &payloads.UpdateUserRolePayload{Role: models.UserRoleAdmin}); err != nil {
+		return nil, err
 	}
-	return createdUser
+	return f.userService.LoginUser(ctx, &payloads.LoginUserPayload{Username: user.Username, Password: user.Password})
 }
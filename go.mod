@@ -14,6 +14,7 @@ require (
 	github.com/go-pg/pg/v10 v10.10.5
 	github.com/lestrrat-go/jwx v1.2.6
 	github.com/lib/pq v1.10.3
+	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/satori/go.uuid v1.2.0
 	github.com/segmentio/ksuid v1.0.4
 	github.com/sirupsen/logrus v1.8.1
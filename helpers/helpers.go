@@ -2,20 +2,8 @@ package helpers
 
 import (
 	"fmt"
-
-	"github.com/dhurimkelmendi/vending_machine/models"
 )
 
-// UserRolesContains checks if a slice of type models.UserRole contains a given UserRole
-func UserRolesContains(r []models.UserRole, role models.UserRole) bool {
-	for _, v := range r {
-		if v == role {
-			return true
-		}
-	}
-	return false
-}
-
 // StringsContains checks if a slice of type string contains a given string
 func StringsContains(s []string, str string) bool {
 	for _, v := range s {
@@ -0,0 +1,135 @@
+// Package dbtest gives every test an empty database of its own. Tests keep their records in memory unless
+// TEST_DB_DRIVER selects the postgres or sqlite driver, in which case each of them gets a migrated Postgres schema or
+// SQLite file that is dropped once it ends.
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/migrations"
+	"github.com/go-pg/pg/v10"
+	uuid "github.com/satori/go.uuid"
+)
+
+// DriverEnv is the environment variable selecting the driver tests run on
+const DriverEnv = "TEST_DB_DRIVER"
+
+// Driver returns the driver tests run on, the memory driver unless TEST_DB_DRIVER is set
+func Driver() string {
+	if driver := os.Getenv(DriverEnv); driver != "" {
+		return driver
+	}
+	return config.DatabaseDriverMemory
+}
+
+// SkipUnlessPostgres skips the test unless tests run on Postgres, e.g. for tests of its row locks, which the other
+// drivers do not need since they run one transaction at a time
+func SkipUnlessPostgres(t *testing.T) {
+	if Driver() != config.DatabaseDriverPostgres {
+		t.Skipf("%s=%s runs tests on Postgres", DriverEnv, config.DatabaseDriverPostgres)
+	}
+}
+
+// Configure points the config at an empty database of the driver tests run on
+func Configure(t *testing.T, cfg *config.Config) {
+	switch driver := Driver(); driver {
+	case config.DatabaseDriverMemory:
+		cfg.DatabaseDriver = driver
+	case config.DatabaseDriverSQLite:
+		ConfigureSQLite(t, cfg)
+	case config.DatabaseDriverPostgres:
+		ConfigurePostgres(t, cfg)
+	default:
+		t.Fatalf("%s must be %s, %s or %s, got: %q", DriverEnv, config.DatabaseDriverMemory,
+			config.DatabaseDriverSQLite, config.DatabaseDriverPostgres, driver)
+	}
+}
+
+// ConfigureSQLite points the config at a migrated SQLite file in a directory removed once the test ends
+func ConfigureSQLite(t *testing.T, cfg *config.Config) {
+	cfg.DatabaseDriver = config.DatabaseDriverSQLite
+	cfg.DatabasePath = filepath.Join(t.TempDir(), "test.db")
+	sqlite, err := db.OpenSQLite(cfg.DatabasePath)
+	if err != nil {
+		t.Fatalf("error while opening database %+v", err)
+	}
+	defer sqlite.Close()
+	if _, _, err := migrations.RunSQLite(sqlite, "up"); err != nil {
+		t.Fatalf("error while migrating database %+v", err)
+	}
+}
+
+// ConfigurePostgres points the config at a migrated schema of the Postgres database of the config, which is dropped
+// once the test ends. The extensions are installed in the public schema, so that every schema finds them on its
+// search path
+func ConfigurePostgres(t *testing.T, cfg *config.Config) {
+	cfg.DatabaseDriver = config.DatabaseDriverPostgres
+	cfg.DatabaseSchema = ""
+	database, err := db.New(cfg)
+	if err != nil {
+		t.Fatalf("error while connecting to database %+v", err)
+	}
+	defer database.Close()
+	if err := installExtensions(database.GetDB()); err != nil {
+		t.Fatalf("error while installing extensions %+v", err)
+	}
+	schema := "test_" + strings.Replace(uuid.NewV4().String(), "-", "", -1)
+	if _, err := database.GetDB().Exec("CREATE SCHEMA ?", pg.Ident(schema)); err != nil {
+		t.Fatalf("error while creating schema %+v", err)
+	}
+	t.Cleanup(func() {
+		if err := dropSchema(cfg, schema); err != nil {
+			t.Errorf("error while dropping schema %s %+v", schema, err)
+		}
+	})
+
+	cfg.DatabaseSchema = schema
+	migrated, err := db.New(cfg)
+	if err != nil {
+		t.Fatalf("error while connecting to database %+v", err)
+	}
+	defer migrated.Close()
+	if _, _, err := migrations.Run(migrated.GetDB(), schema, "up"); err != nil {
+		t.Fatalf("error while migrating schema %s %+v", schema, err)
+	}
+}
+
+// extensionsLock is the key of the advisory lock taken while installing the extensions
+const extensionsLock = 7265676
+
+// installExtensions installs the extensions the migrations use in the public schema. Tests installing them at the
+// same time would conflict, so they wait for each other on an advisory lock, also across test binaries
+func installExtensions(database *pg.DB) error {
+	return database.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(?)", extensionsLock); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			CREATE EXTENSION IF NOT EXISTS "uuid-ossp" SCHEMA public;
+			CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public;
+			CREATE EXTENSION IF NOT EXISTS btree_gist SCHEMA public;`)
+		return err
+	})
+}
+
+// dropSchema drops the schema with everything in it
+func dropSchema(cfg *config.Config, schema string) error {
+	dropCfg := *cfg
+	dropCfg.DatabaseSchema = ""
+	database, err := db.New(&dropCfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	if _, err := database.GetDB().Exec("DROP SCHEMA ? CASCADE", pg.Ident(schema)); err != nil {
+		return fmt.Errorf("could not drop schema: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package machinesync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrUnauthorized is returned when the central server rejects the refresh token of the machine, e.g. because the
+// machine was offline for longer than refresh tokens live, and the machine has to be set up with a new one
+var ErrUnauthorized = errors.New("the central server rejected the refresh token of the machine")
+
+// refreshPath is the path of the endpoint exchanging a refresh token for new tokens
+const refreshPath = "/public/api/v1/users/refresh"
+
+// Client syncs the machine with the central server, authenticated as the operator of the machine. Access tokens
+// expire long before a machine that was offline comes back, so the client refreshes them once the central server
+// rejects one, and keeps the tokens it got in the store
+type Client struct {
+	store        *Store
+	baseURL      string
+	refreshToken string
+	machineID    uuid.UUID
+	httpClient   *http.Client
+	// mu keeps requests from refreshing at the same time, as the refresh token is rotated on every refresh
+	mu sync.Mutex
+}
+
+// NewClient creates a Client syncing the queued events and the catalogue of the machine with the central server at
+// the base URL, e.g. https://vending.example.com. The refresh token the machine was set up with is only used until
+// the client saved the tokens of its first refresh in the store
+func NewClient(store *Store, baseURL string, refreshToken string, machineID uuid.UUID) *Client {
+	return &Client{
+		store:        store,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		refreshToken: refreshToken,
+		machineID:    machineID,
+		httpClient:   http.DefaultClient,
+	}
+}
+
+// Push pushes the oldest events that were not pushed yet as one batch and marks them as pushed with the outcome the
+// central server reported. A nil report is returned when there is nothing to push. If the machine goes offline
+// before it gets the report, the events are pushed again with the next batch and reported as duplicates
+func (c *Client) Push(ctx context.Context) (*payloads.SyncBatchReport, error) {
+	events, err := c.store.Pending(payloads.MaxSyncBatchEvents)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	batch := &payloads.SyncBatchPayload{BatchID: uuid.NewV4(), MachineID: c.machineID, Events: events}
+	report := &payloads.SyncBatchReport{}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/sync/batches", batch, report); err != nil {
+		return nil, err
+	}
+	if err := c.store.Acknowledge(report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// Pull pulls the catalogue of the machine from the central server and keeps it for the machine to sell from
+func (c *Client) Pull(ctx context.Context) (*payloads.SyncCatalogue, error) {
+	catalogue := &payloads.SyncCatalogue{}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/sync/machines/"+c.machineID.String()+"/catalogue", nil, catalogue); err != nil {
+		return nil, err
+	}
+	if err := c.store.SaveCatalogue(catalogue); err != nil {
+		return nil, err
+	}
+	return catalogue, nil
+}
+
+// Sync pushes all events that were not pushed yet, batch by batch, and then pulls the catalogue, so the catalogue
+// includes the stock the events changed. The reports of the batches are returned in the order they were pushed
+func (c *Client) Sync(ctx context.Context) ([]*payloads.SyncBatchReport, error) {
+	reports := make([]*payloads.SyncBatchReport, 0)
+	for {
+		report, err := c.Push(ctx)
+		if err != nil {
+			return reports, err
+		}
+		if report == nil {
+			break
+		}
+		reports = append(reports, report)
+	}
+	if _, err := c.Pull(ctx); err != nil {
+		return reports, err
+	}
+	return reports, nil
+}
+
+// do sends the request to the central server and decodes its response into out. A request the central server
+// rejects as unauthorized is sent once more with refreshed tokens
+func (c *Client) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := c.send(ctx, method, path, token, body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		res.Body.Close()
+		if token, err = c.refresh(ctx, token); err != nil {
+			return err
+		}
+		if res, err = c.send(ctx, method, path, token, body); err != nil {
+			return err
+		}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return responseError(method, path, res)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// send sends the request to the central server with the access token
+func (c *Client) send(ctx context.Context, method string, path string, token string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	return c.httpClient.Do(req)
+}
+
+// token returns the access token the client saved last, refreshing the tokens first if it saved none yet
+func (c *Client) token(ctx context.Context) (string, error) {
+	tokens, err := c.store.Credentials(c.machineID)
+	if err == ErrNoCredentials {
+		return c.refresh(ctx, "")
+	}
+	if err != nil {
+		return "", err
+	}
+	return tokens.Token, nil
+}
+
+// refresh exchanges the refresh token the client saved last for new tokens and saves them, unless the access token
+// was already replaced by a request refreshing meanwhile. The new access token is returned
+func (c *Client) refresh(ctx context.Context, rejectedToken string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tokens, err := c.store.Credentials(c.machineID)
+	switch {
+	case err == ErrNoCredentials:
+		tokens.RefreshToken = c.refreshToken
+	case err != nil:
+		return "", err
+	case tokens.Token != rejectedToken:
+		return tokens.Token, nil
+	}
+
+	body, err := json.Marshal(&payloads.RefreshTokenPayload{RefreshToken: tokens.RefreshToken})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+refreshPath, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized {
+		return "", ErrUnauthorized
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", responseError(http.MethodPost, refreshPath, res)
+	}
+
+	refreshed := &payloads.AuthTokens{}
+	if err := json.NewDecoder(res.Body).Decode(refreshed); err != nil {
+		return "", err
+	}
+	if err := c.store.SaveCredentials(c.machineID, refreshed); err != nil {
+		return "", err
+	}
+	return refreshed.Token, nil
+}
+
+// responseError returns the error the central server responded to the request with
+func responseError(method string, path string, res *http.Response) error {
+	message, _ := io.ReadAll(res.Body)
+	return fmt.Errorf("%s %s responded %d: %s", method, path, res.StatusCode, strings.TrimSpace(string(message)))
+}
@@ -0,0 +1,220 @@
+package machinesync_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/machinesync"
+	"github.com/dhurimkelmendi/vending_machine/migrations"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+func openStore(t *testing.T) *machinesync.Store {
+	sqlite, err := db.OpenSQLite(filepath.Join(t.TempDir(), "machine.db"))
+	if err != nil {
+		t.Fatalf("error while opening database %+v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if _, _, err := migrations.RunSQLite(sqlite, "up"); err != nil {
+		t.Fatalf("error while migrating database %+v", err)
+	}
+	return machinesync.NewStore(sqlite)
+}
+
+// centralStub answers pushed batches like the central server, rejecting stock events of slot Z9, and records the
+// batches it received. Like the central server it accepts only the access token it issued last, and rotates the
+// refresh token on every refresh
+type centralStub struct {
+	batches      []*payloads.SyncBatchPayload
+	failPush     bool
+	catalogue    *payloads.SyncCatalogue
+	token        string
+	refreshToken string
+	refreshes    int
+}
+
+func (c *centralStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/public/api/v1/users/refresh" {
+		refresh := &payloads.RefreshTokenPayload{}
+		if err := json.NewDecoder(r.Body).Decode(refresh); err != nil || refresh.RefreshToken != c.refreshToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		c.refreshes++
+		c.token, c.refreshToken = fmt.Sprintf("token %d", c.refreshes), fmt.Sprintf("refresh %d", c.refreshes)
+		json.NewEncoder(w).Encode(&payloads.AuthTokens{Token: c.token, RefreshToken: c.refreshToken})
+		return
+	}
+	if c.token == "" || r.Header.Get("Authorization") != "Bearer "+c.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(c.catalogue)
+		return
+	}
+	if c.failPush {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	batch := &payloads.SyncBatchPayload{}
+	if err := json.NewDecoder(r.Body).Decode(batch); err != nil || batch.Validate() != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.batches = append(c.batches, batch)
+	report := &payloads.SyncBatchReport{BatchID: batch.BatchID, MachineID: batch.MachineID}
+	for _, event := range batch.Events {
+		synced := &models.SyncEvent{ID: event.ID, Sequence: event.Sequence, Kind: event.Kind, Status: models.SyncEventStatusApplied, Conflicts: make([]*models.SyncConflict, 0)}
+		if event.SlotCode == "Z9" {
+			synced.Status = models.SyncEventStatusRejected
+			synced.Conflicts = append(synced.Conflicts, &models.SyncConflict{Type: models.SyncConflictUnknownSlot, Resolution: models.SyncResolutionRejected, Machine: int64(event.Quantity)})
+			report.Rejected++
+		} else {
+			report.Applied++
+		}
+		report.Conflicts += len(synced.Conflicts)
+		report.Events = append(report.Events, synced)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func TestMachineSync(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	machineID := uuid.NewV4()
+	userID := uuid.NewV4()
+
+	t.Run("enqueue numbers events in order", func(t *testing.T) {
+		store := openStore(t)
+		first, err := store.Enqueue(&payloads.SyncEvent{Kind: models.SyncEventKindDeposit, UserID: userID, Amount: 50})
+		if err != nil {
+			t.Fatalf("error while enqueueing event %+v", err)
+		}
+		second, err := store.Enqueue(&payloads.SyncEvent{Kind: models.SyncEventKindStock, SlotCode: "A1", Quantity: -2})
+		if err != nil {
+			t.Fatalf("error while enqueueing event %+v", err)
+		}
+		if first.ID == uuid.Nil || first.OccurredAt.IsZero() || second.Sequence <= first.Sequence {
+			t.Fatalf("expected events to get ids, times and increasing sequences, got: %+v %+v", first, second)
+		}
+		if _, err := store.Enqueue(&payloads.SyncEvent{Kind: models.SyncEventKindPurchase, UserID: userID}); err == nil {
+			t.Fatalf("expected a purchase without product to be invalid")
+		}
+
+		pending, err := store.Pending(10)
+		if err != nil {
+			t.Fatalf("error while reading pending events %+v", err)
+		}
+		if len(pending) != 2 || pending[0].ID != first.ID || pending[1].Sequence != second.Sequence {
+			t.Fatalf("expected the two valid events oldest first, got: %+v", pending)
+		}
+	})
+
+	t.Run("sync pushes pending events and pulls the catalogue", func(t *testing.T) {
+		store := openStore(t)
+		central := &centralStub{
+			catalogue:    &payloads.SyncCatalogue{MachineID: machineID, Slots: []*models.Slot{{Code: "A1", Capacity: 10, Quantity: 4}}},
+			refreshToken: "refresh",
+		}
+		server := httptest.NewServer(central)
+		defer server.Close()
+		client := machinesync.NewClient(store, server.URL+"/", "refresh", machineID)
+
+		if _, err := store.Enqueue(&payloads.SyncEvent{Kind: models.SyncEventKindDeposit, UserID: userID, Amount: 50}); err != nil {
+			t.Fatalf("error while enqueueing event %+v", err)
+		}
+		rejected, err := store.Enqueue(&payloads.SyncEvent{Kind: models.SyncEventKindStock, SlotCode: "Z9", Quantity: 3})
+		if err != nil {
+			t.Fatalf("error while enqueueing event %+v", err)
+		}
+
+		central.failPush = true
+		if _, err := client.Sync(ctx); err == nil {
+			t.Fatalf("expected sync to fail while the central server is unavailable")
+		}
+		if pending, _ := store.Pending(10); len(pending) != 2 {
+			t.Fatalf("expected events to stay queued after a failed push, got: %+v", pending)
+		}
+		if _, err := store.Catalogue(machineID); err != machinesync.ErrNoCatalogue {
+			t.Fatalf("expected no catalogue before pulling one, got: %+v", err)
+		}
+
+		central.failPush = false
+		reports, err := client.Sync(ctx)
+		if err != nil {
+			t.Fatalf("error while syncing %+v", err)
+		}
+		if len(reports) != 1 || reports[0].Applied != 1 || reports[0].Rejected != 1 {
+			t.Fatalf("expected one batch with an applied and a rejected event, got: %+v", reports)
+		}
+		if len(central.batches) != 1 || central.batches[0].MachineID != machineID || len(central.batches[0].Events) != 2 {
+			t.Fatalf("expected the central server to receive both events of the machine, got: %+v", central.batches)
+		}
+		if pending, _ := store.Pending(10); len(pending) != 0 {
+			t.Fatalf("expected no pending events after syncing, got: %+v", pending)
+		}
+		status, conflicts, err := store.Conflicts(rejected.ID)
+		if err != nil {
+			t.Fatalf("error while reading conflicts %+v", err)
+		}
+		if status != models.SyncEventStatusRejected || len(conflicts) != 1 || conflicts[0].Type != models.SyncConflictUnknownSlot {
+			t.Fatalf("expected the stock event to be rejected for an unknown slot, got: %s %+v", status, conflicts)
+		}
+
+		catalogue, err := store.Catalogue(machineID)
+		if err != nil {
+			t.Fatalf("error while reading catalogue %+v", err)
+		}
+		if len(catalogue.Slots) != 1 || catalogue.Slots[0].Quantity != 4 {
+			t.Fatalf("expected the pulled catalogue, got: %+v", catalogue)
+		}
+
+		reports, err = client.Sync(ctx)
+		if err != nil || len(reports) != 0 || len(central.batches) != 1 {
+			t.Fatalf("expected nothing to push on the next sync, got: %+v %+v", reports, err)
+		}
+	})
+	t.Run("expired access tokens are refreshed", func(t *testing.T) {
+		store := openStore(t)
+		central := &centralStub{catalogue: &payloads.SyncCatalogue{MachineID: machineID}, refreshToken: "refresh"}
+		server := httptest.NewServer(central)
+		defer server.Close()
+		client := machinesync.NewClient(store, server.URL, "refresh", machineID)
+
+		if _, err := client.Pull(ctx); err != nil {
+			t.Fatalf("error while pulling catalogue %+v", err)
+		}
+		if central.refreshes != 1 {
+			t.Fatalf("expected the first request to get tokens for the refresh token, got %d refreshes", central.refreshes)
+		}
+
+		central.token = "token of another session"
+		if _, err := client.Pull(ctx); err != nil {
+			t.Fatalf("error while pulling catalogue with an expired access token %+v", err)
+		}
+		tokens, err := store.Credentials(machineID)
+		if err != nil || central.refreshes != 2 || tokens.Token != central.token || tokens.RefreshToken != central.refreshToken {
+			t.Fatalf("expected the refreshed tokens to be saved, got: %+v %+v", tokens, err)
+		}
+
+		// a restarted machine is set up with the refresh token it was given at first, which was rotated since
+		restarted := machinesync.NewClient(store, server.URL, "refresh", machineID)
+		if _, err := restarted.Pull(ctx); err != nil || central.refreshes != 2 {
+			t.Fatalf("expected the saved tokens to be used after a restart, got %d refreshes: %+v", central.refreshes, err)
+		}
+
+		central.token, central.refreshToken = "", "refresh of another session"
+		if _, err := client.Pull(ctx); err != machinesync.ErrUnauthorized {
+			t.Fatalf("expected error %+v, got: %+v", machinesync.ErrUnauthorized, err)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+// Package machinesync keeps a vending machine working while it is offline. The
+// machine queues the deposits, purchases and stock changes it records in its
+// SQLite database, pushes them to the central server in the order they were
+// recorded once it is online, and keeps the last catalogue it pulled to sell
+// from in the meantime.
+package machinesync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrNoCatalogue is returned when the machine did not pull a catalogue yet
+var ErrNoCatalogue = errors.New("no catalogue was pulled yet")
+
+// ErrNoCredentials is returned when the machine did not save the tokens it syncs with yet
+var ErrNoCredentials = errors.New("no credentials were saved yet")
+
+// Store keeps the events the machine did not push yet, the last catalogue it pulled and the tokens it syncs with in
+// the SQLite database of the machine, migrated with migrations.RunSQLite
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a Store on the SQLite database of the machine
+func NewStore(database *sql.DB) *Store {
+	return &Store{db: database}
+}
+
+// Enqueue queues the event to be pushed. The event is numbered after the events queued before it, and is given an
+// id and the current time when it has none
+func (s *Store) Enqueue(event *payloads.SyncEvent) (*payloads.SyncEvent, error) {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.NewV4()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	// the sequence is assigned by the database, so the event is validated once it is numbered and not queued if
+	// it is invalid
+	data, err := json.Marshal(event)
+	if err != nil {
+		return event, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return event, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO sync_outbox (id, event) VALUES (?, ?)`, event.ID.String(), string(data))
+	if err != nil {
+		return event, err
+	}
+	if event.Sequence, err = result.LastInsertId(); err != nil {
+		return event, err
+	}
+	if err := event.Validate(); err != nil {
+		return event, fmt.Errorf("invalid %s event: %v", event.Kind, err)
+	}
+	return event, tx.Commit()
+}
+
+// Pending returns up to limit of the events that were not pushed yet, oldest first
+func (s *Store) Pending(limit int) ([]*payloads.SyncEvent, error) {
+	rows, err := s.db.Query(`SELECT sequence, event FROM sync_outbox WHERE pushed_at IS NULL ORDER BY sequence LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*payloads.SyncEvent, 0)
+	for rows.Next() {
+		var sequence int64
+		var data string
+		if err := rows.Scan(&sequence, &data); err != nil {
+			return nil, err
+		}
+		event := &payloads.SyncEvent{}
+		if err := json.Unmarshal([]byte(data), event); err != nil {
+			return nil, err
+		}
+		event.Sequence = sequence
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Acknowledge marks the events of the report as pushed, with the outcome the central server reported for them
+func (s *Store) Acknowledge(report *payloads.SyncBatchReport) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pushedAt := time.Now().UTC()
+	for _, event := range report.Events {
+		conflicts, err := json.Marshal(event.Conflicts)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE sync_outbox SET pushed_at = ?, status = ?, conflicts = ? WHERE id = ?`,
+			pushedAt, string(event.Status), string(conflicts), event.ID.String())
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Conflicts returns the conflicts the central server reported for the pushed event by id, and whether it applied it
+func (s *Store) Conflicts(eventID uuid.UUID) (models.SyncEventStatus, []*models.SyncConflict, error) {
+	var status, data sql.NullString
+	err := s.db.QueryRow(`SELECT status, conflicts FROM sync_outbox WHERE id = ?`, eventID.String()).Scan(&status, &data)
+	if err != nil {
+		return "", nil, err
+	}
+	conflicts := make([]*models.SyncConflict, 0)
+	if data.Valid {
+		if err := json.Unmarshal([]byte(data.String), &conflicts); err != nil {
+			return "", nil, err
+		}
+	}
+	return models.SyncEventStatus(status.String), conflicts, nil
+}
+
+// SaveCatalogue replaces the catalogue of the machine with the one pulled from the central server
+func (s *Store) SaveCatalogue(catalogue *payloads.SyncCatalogue) error {
+	data, err := json.Marshal(catalogue)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO sync_catalogue (machine_id, catalogue, pulled_at) VALUES (?, ?, ?)
+		ON CONFLICT (machine_id) DO UPDATE SET catalogue = excluded.catalogue, pulled_at = excluded.pulled_at`,
+		catalogue.MachineID.String(), string(data), time.Now().UTC())
+	return err
+}
+
+// Catalogue returns the last catalogue pulled for the machine, ErrNoCatalogue is returned if none was pulled yet
+func (s *Store) Catalogue(machineID uuid.UUID) (*payloads.SyncCatalogue, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT catalogue FROM sync_catalogue WHERE machine_id = ?`, machineID.String()).Scan(&data)
+	if err == sql.ErrNoRows {
+		return &payloads.SyncCatalogue{}, ErrNoCatalogue
+	}
+	if err != nil {
+		return &payloads.SyncCatalogue{}, err
+	}
+	catalogue := &payloads.SyncCatalogue{}
+	if err := json.Unmarshal([]byte(data), catalogue); err != nil {
+		return &payloads.SyncCatalogue{}, err
+	}
+	return catalogue, nil
+}
+
+// SaveCredentials replaces the tokens the machine syncs with by the ones the central server issued last
+func (s *Store) SaveCredentials(machineID uuid.UUID, tokens *payloads.AuthTokens) error {
+	_, err := s.db.Exec(`INSERT INTO sync_credentials (machine_id, token, refresh_token, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (machine_id) DO UPDATE SET token = excluded.token, refresh_token = excluded.refresh_token,
+			updated_at = excluded.updated_at`,
+		machineID.String(), tokens.Token, tokens.RefreshToken, time.Now().UTC())
+	return err
+}
+
+// Credentials returns the tokens the machine saved last, ErrNoCredentials is returned if it saved none yet
+func (s *Store) Credentials(machineID uuid.UUID) (*payloads.AuthTokens, error) {
+	tokens := &payloads.AuthTokens{}
+	err := s.db.QueryRow(`SELECT token, refresh_token FROM sync_credentials WHERE machine_id = ?`, machineID.String()).
+		Scan(&tokens.Token, &tokens.RefreshToken)
+	if err == sql.ErrNoRows {
+		return tokens, ErrNoCredentials
+	}
+	return tokens, err
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"os"
 
+	"github.com/dhurimkelmendi/vending_machine/app"
 	"github.com/dhurimkelmendi/vending_machine/config"
 	"github.com/dhurimkelmendi/vending_machine/db"
 	"github.com/dhurimkelmendi/vending_machine/migrations"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
 	"github.com/dhurimkelmendi/vending_machine/server"
 	"github.com/sirupsen/logrus"
 )
@@ -22,6 +26,12 @@ func main() {
 			} else {
 				logrus.Fatal("Missing migration action.")
 			}
+		} else if action == "promote-admin" {
+			if len(os.Args) > 2 {
+				promoteAdmin(os.Args[2])
+			} else {
+				logrus.Fatal("Missing username.")
+			}
 		} else {
 			logrus.Fatalf("Unknown action: %s", action)
 		}
@@ -31,9 +41,17 @@ func main() {
 }
 
 func run() {
-	config.GetDefaultInstance().SetLogLevel()
-	config.GetDefaultInstance().LogConfigs()
-	server.GetDefaultInstance().Start()
+	cfg := config.GetDefaultInstance()
+	cfg.SetLogLevel()
+	cfg.LogConfigs()
+	if err := cfg.Validate(); err != nil {
+		logrus.Fatalf("Refusing to start: %+v", err)
+	}
+	a, err := app.New(cfg)
+	if err != nil {
+		logrus.Fatalf("Could not start: %+v", err)
+	}
+	server.NewServer(a).Start()
 }
 
 func migrate(action string) {
@@ -43,9 +61,32 @@ func migrate(action string) {
 
 	dbConn := db.GetDefaultInstance()
 
-	if action == "reset" {
-		migrations.Reset(dbConn.GetDB())
+	if dbConn.IsSQLite() {
+		migrations.MigrateSQLite(action, dbConn.GetSQLite())
+	} else if action == "reset" {
+		migrations.Reset(dbConn.GetDB(), config.GetDefaultInstance().DatabaseSchema)
 	} else {
-		migrations.Migrate(action, dbConn.GetDB())
+		migrations.Migrate(action, dbConn.GetDB(), config.GetDefaultInstance().DatabaseSchema)
+	}
+}
+
+// promoteAdmin gives the admin role to an existing user, so the first admin can be created without an admin
+func promoteAdmin(username string) {
+	cfg := config.GetDefaultInstance()
+	cfg.SetLogLevel()
+	a, err := app.New(cfg)
+	if err != nil {
+		logrus.Fatalf("Could not start: %+v", err)
+	}
+	defer a.Close()
+
+	userService := a.Services.Users
+	user, err := userService.GetUserByUsername(username)
+	if err != nil {
+		logrus.Fatalf("Unable to find user %s: %+v", username, err)
+	}
+	if _, err := userService.UpdateUserRole(context.Background(), user.ID, &payloads.UpdateUserRolePayload{Role: models.UserRoleAdmin}); err != nil {
+		logrus.Fatalf("Unable to promote user %s: %+v", username, err)
 	}
+	logrus.Infof("User %s is now an admin", username)
 }
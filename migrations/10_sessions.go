@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating sessions table")
+		// refresh tokens issued before sessions were tracked cannot be tied to one, so their users have to log in again
+		_, err := db.Exec(`
+		CREATE TABLE sessions (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			jti text UNIQUE NOT NULL,
+			user_agent text,
+			ip_address text,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			last_seen_at timestamptz NOT NULL DEFAULT now(),
+			expires_at timestamptz NOT NULL,
+			ended_at timestamptz
+		);
+		CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+		DELETE FROM refresh_tokens;
+		ALTER TABLE refresh_tokens
+			ADD COLUMN session_id uuid REFERENCES sessions(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping sessions table")
+		_, err := db.Exec(`
+			ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS session_id;
+			DROP TABLE IF EXISTS sessions CASCADE;
+		`)
+		return err
+	})
+
+	// SQLite cannot add a column that is a foreign key and not null, the refresh tokens are deleted anyway, so their
+	// table is created again with the column
+	registerSQLite(`
+		CREATE TABLE sessions (
+			id text PRIMARY KEY,
+			user_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			jti text UNIQUE NOT NULL,
+			user_agent text,
+			ip_address text,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_seen_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at timestamp NOT NULL,
+			ended_at timestamp
+		);
+		CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+		DROP TABLE refresh_tokens;
+		CREATE TABLE refresh_tokens (
+			id text PRIMARY KEY,
+			user_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			token_hash text UNIQUE NOT NULL,
+			expires_at timestamp NOT NULL,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			revoked_at timestamp,
+			session_id text REFERENCES sessions(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL
+		);
+		CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);`, `
+		CREATE TABLE session_refresh_tokens (
+			id text PRIMARY KEY,
+			user_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			token_hash text UNIQUE NOT NULL,
+			expires_at timestamp NOT NULL,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			revoked_at timestamp
+		);
+		INSERT INTO session_refresh_tokens (id, user_id, token_hash, expires_at, created_at, revoked_at)
+		SELECT id, user_id, token_hash, expires_at, created_at, revoked_at FROM refresh_tokens;
+		DROP TABLE refresh_tokens;
+		ALTER TABLE session_refresh_tokens RENAME TO refresh_tokens;
+		CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+		DROP TABLE IF EXISTS sessions;`)
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Adding disabled_at to users table")
+		_, err := db.Exec(`
+		ALTER TABLE users ADD COLUMN disabled_at timestamptz;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping disabled_at from users table")
+		_, err := db.Exec(`
+			ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
+		`)
+		return err
+	})
+
+	registerSQLite(`
+		ALTER TABLE users ADD COLUMN disabled_at timestamp;`, `
+		ALTER TABLE users DROP COLUMN disabled_at;`)
+}
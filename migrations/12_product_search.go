@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Adding description and full-text search to products table")
+		_, err := db.Exec(`
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+		ALTER TABLE products ADD COLUMN description text NOT NULL DEFAULT '';
+		ALTER TABLE products ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', description), 'B')
+		) STORED;
+
+		CREATE INDEX products_search_vector_idx ON products USING gin (search_vector);
+		CREATE INDEX products_name_trgm_idx ON products USING gin (name gin_trgm_ops);`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping description and full-text search from products table")
+		_, err := db.Exec(`
+			DROP INDEX IF EXISTS products_name_trgm_idx;
+			DROP INDEX IF EXISTS products_search_vector_idx;
+			ALTER TABLE products DROP COLUMN IF EXISTS search_vector;
+			ALTER TABLE products DROP COLUMN IF EXISTS description;
+		`)
+		return err
+	})
+
+	registerSQLite(`
+		ALTER TABLE products ADD COLUMN description text NOT NULL DEFAULT '';`, `
+		ALTER TABLE products DROP COLUMN description;`)
+}
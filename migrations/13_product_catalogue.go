@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating categories table and adding catalogue metadata to products table")
+		// root categories have no parent, so the uniqueness of names per parent compares them with the nil uuid
+		_, err := db.Exec(`
+		CREATE TABLE categories (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			parent_id uuid REFERENCES categories(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+			name text NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE UNIQUE INDEX categories_parent_id_name_idx
+			ON categories (COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'::uuid), lower(name));
+
+		ALTER TABLE products
+			ADD COLUMN category_id uuid REFERENCES categories(id) ON UPDATE CASCADE ON DELETE SET NULL,
+			ADD COLUMN tags text[] NOT NULL DEFAULT '{}',
+			ADD COLUMN calories integer CHECK (calories >= 0),
+			ADD COLUMN allergens text[] NOT NULL DEFAULT '{}',
+			ADD COLUMN ean text,
+			ADD COLUMN image_url text;
+
+		CREATE INDEX products_category_id_idx ON products (category_id);
+		CREATE INDEX products_tags_idx ON products USING gin (tags);`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping categories table and catalogue metadata from products table")
+		_, err := db.Exec(`
+			DROP INDEX IF EXISTS products_tags_idx;
+			DROP INDEX IF EXISTS products_category_id_idx;
+			ALTER TABLE products
+				DROP COLUMN IF EXISTS image_url,
+				DROP COLUMN IF EXISTS ean,
+				DROP COLUMN IF EXISTS allergens,
+				DROP COLUMN IF EXISTS calories,
+				DROP COLUMN IF EXISTS tags,
+				DROP COLUMN IF EXISTS category_id;
+			DROP TABLE IF EXISTS categories;
+		`)
+		return err
+	})
+
+	// SQLite cannot drop a column with a foreign key, so deleting a category leaves its products without one by a
+	// trigger. Tags and allergens are stored as JSON arrays
+	registerSQLite(`
+		CREATE TABLE categories (
+			id text PRIMARY KEY,
+			parent_id text REFERENCES categories(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+			name text NOT NULL,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE UNIQUE INDEX categories_parent_id_name_idx ON categories (coalesce(parent_id, ''), lower(name));
+
+		ALTER TABLE products ADD COLUMN category_id text;
+		ALTER TABLE products ADD COLUMN tags text NOT NULL DEFAULT '[]';
+		ALTER TABLE products ADD COLUMN calories integer CHECK (calories >= 0);
+		ALTER TABLE products ADD COLUMN allergens text NOT NULL DEFAULT '[]';
+		ALTER TABLE products ADD COLUMN ean text;
+		ALTER TABLE products ADD COLUMN image_url text;
+
+		CREATE INDEX products_category_id_idx ON products (category_id);
+		CREATE TRIGGER categories_set_null_products AFTER DELETE ON categories
+		BEGIN
+			UPDATE products SET category_id = NULL WHERE category_id = OLD.id;
+		END;`, `
+		DROP TRIGGER IF EXISTS categories_set_null_products;
+		DROP INDEX IF EXISTS products_category_id_idx;
+		ALTER TABLE products DROP COLUMN image_url;
+		ALTER TABLE products DROP COLUMN ean;
+		ALTER TABLE products DROP COLUMN allergens;
+		ALTER TABLE products DROP COLUMN calories;
+		ALTER TABLE products DROP COLUMN tags;
+		ALTER TABLE products DROP COLUMN category_id;
+		DROP TABLE IF EXISTS categories;`)
+}
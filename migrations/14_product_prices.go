@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating product_prices table")
+		// the prices of a product cover consecutive ranges, the current and scheduled prices of existing products
+		// start with their current cost
+		_, err := db.Exec(`
+		CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+		CREATE TABLE product_prices (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			product_id uuid REFERENCES products(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			cost integer NOT NULL CHECK (cost > 0),
+			effective_from timestamptz NOT NULL,
+			effective_to timestamptz,
+			created_by uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			CHECK (effective_to > effective_from),
+			EXCLUDE USING gist (product_id WITH =, tstzrange(effective_from, effective_to) WITH &&)
+		);
+		CREATE INDEX product_prices_effective_from_idx ON product_prices (effective_from);
+
+		INSERT INTO product_prices (product_id, cost, effective_from, created_by)
+			SELECT id, cost, now(), seller_id FROM products WHERE cost > 0;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping product_prices table")
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS product_prices;
+		`)
+		return err
+	})
+
+	// SQLite has no exclusion constraints, so triggers keep the prices of a product from overlapping
+	registerSQLite(`
+		CREATE TABLE product_prices (
+			id text PRIMARY KEY,
+			product_id text REFERENCES products(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			cost integer NOT NULL CHECK (cost > 0),
+			effective_from timestamp NOT NULL,
+			effective_to timestamp,
+			created_by text REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			CHECK (effective_to > effective_from)
+		);
+		CREATE INDEX product_prices_product_id_idx ON product_prices (product_id, effective_from);
+		CREATE INDEX product_prices_effective_from_idx ON product_prices (effective_from);
+
+		CREATE TRIGGER product_prices_exclude_insert BEFORE INSERT ON product_prices
+		WHEN EXISTS (
+			SELECT 1 FROM product_prices p
+			WHERE p.product_id = NEW.product_id
+				AND (p.effective_to IS NULL OR p.effective_to > NEW.effective_from)
+				AND (NEW.effective_to IS NULL OR NEW.effective_to > p.effective_from)
+		)
+		BEGIN
+			SELECT RAISE(ABORT, 'price overlaps another price of the product');
+		END;
+
+		CREATE TRIGGER product_prices_exclude_update BEFORE UPDATE ON product_prices
+		WHEN EXISTS (
+			SELECT 1 FROM product_prices p
+			WHERE p.product_id = NEW.product_id AND p.id <> NEW.id
+				AND (p.effective_to IS NULL OR p.effective_to > NEW.effective_from)
+				AND (NEW.effective_to IS NULL OR NEW.effective_to > p.effective_from)
+		)
+		BEGIN
+			SELECT RAISE(ABORT, 'price overlaps another price of the product');
+		END;
+
+		INSERT INTO product_prices (id, product_id, cost, effective_from, created_by)
+			SELECT `+sqliteNewUUID+`, id, cost, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), seller_id
+			FROM products WHERE cost > 0;`, `
+		DROP TABLE IF EXISTS product_prices;`)
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating promotions table")
+		// purchases keep the id of the promotion they were discounted by, even after the promotion is deleted,
+		// so promotion_id has no foreign key
+		_, err := db.Exec(`
+		CREATE TABLE promotions (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			seller_id uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			name text NOT NULL,
+			type text NOT NULL CHECK (type IN ('percentage', 'fixed', 'buy_x_get_y', 'bundle')),
+			product_ids uuid[] NOT NULL,
+			value integer NOT NULL DEFAULT 0 CHECK (value >= 0),
+			buy_quantity integer NOT NULL DEFAULT 0 CHECK (buy_quantity >= 0),
+			free_quantity integer NOT NULL DEFAULT 0 CHECK (free_quantity >= 0),
+			starts_at timestamptz,
+			ends_at timestamptz,
+			happy_hour_from time,
+			happy_hour_to time,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			CHECK (ends_at > starts_at),
+			CHECK ((happy_hour_from IS NULL) = (happy_hour_to IS NULL))
+		);
+		CREATE INDEX promotions_seller_id_idx ON promotions (seller_id);
+		CREATE INDEX promotions_product_ids_idx ON promotions USING gin (product_ids);
+
+		ALTER TABLE purchases
+			ADD COLUMN original_price integer,
+			ADD COLUMN discount integer NOT NULL DEFAULT 0,
+			ADD COLUMN promotion_id uuid;
+		UPDATE purchases SET original_price = total;
+		ALTER TABLE purchases ALTER COLUMN original_price SET NOT NULL;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping promotions table")
+		_, err := db.Exec(`
+			ALTER TABLE purchases
+				DROP COLUMN IF EXISTS original_price,
+				DROP COLUMN IF EXISTS discount,
+				DROP COLUMN IF EXISTS promotion_id;
+			DROP TABLE IF EXISTS promotions;
+		`)
+		return err
+	})
+
+	// the products of a promotion are stored as a JSON array
+	registerSQLite(`
+		CREATE TABLE promotions (
+			id text PRIMARY KEY,
+			seller_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			name text NOT NULL,
+			type text NOT NULL CHECK (type IN ('percentage', 'fixed', 'buy_x_get_y', 'bundle')),
+			product_ids text NOT NULL DEFAULT '[]',
+			value integer NOT NULL DEFAULT 0 CHECK (value >= 0),
+			buy_quantity integer NOT NULL DEFAULT 0 CHECK (buy_quantity >= 0),
+			free_quantity integer NOT NULL DEFAULT 0 CHECK (free_quantity >= 0),
+			starts_at timestamp,
+			ends_at timestamp,
+			happy_hour_from text,
+			happy_hour_to text,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			CHECK (ends_at > starts_at),
+			CHECK ((happy_hour_from IS NULL) = (happy_hour_to IS NULL))
+		);
+		CREATE INDEX promotions_seller_id_idx ON promotions (seller_id);
+
+		ALTER TABLE purchases ADD COLUMN original_price integer NOT NULL DEFAULT 0;
+		ALTER TABLE purchases ADD COLUMN discount integer NOT NULL DEFAULT 0;
+		ALTER TABLE purchases ADD COLUMN promotion_id text;
+		UPDATE purchases SET original_price = total;`, `
+		ALTER TABLE purchases DROP COLUMN promotion_id;
+		ALTER TABLE purchases DROP COLUMN discount;
+		ALTER TABLE purchases DROP COLUMN original_price;
+		DROP TABLE IF EXISTS promotions;`)
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Adding checkout_id to purchases")
+		// every line of a checkout is a purchase, the lines of a checkout share its checkout_id
+		_, err := db.Exec(`
+		ALTER TABLE purchases ADD COLUMN checkout_id uuid;
+		CREATE INDEX purchases_checkout_id_idx ON purchases (checkout_id) WHERE checkout_id IS NOT NULL;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Removing checkout_id from purchases")
+		_, err := db.Exec(`
+			ALTER TABLE purchases DROP COLUMN IF EXISTS checkout_id;
+		`)
+		return err
+	})
+
+	registerSQLite(`
+		ALTER TABLE purchases ADD COLUMN checkout_id text;
+		CREATE INDEX purchases_checkout_id_idx ON purchases (checkout_id) WHERE checkout_id IS NOT NULL;`, `
+		DROP INDEX IF EXISTS purchases_checkout_id_idx;
+		ALTER TABLE purchases DROP COLUMN checkout_id;`)
+}
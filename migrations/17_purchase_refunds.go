@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Adding refunds to purchases")
+		// a refund reverses a purchase with negative quantity and amounts, so ledger sums stay net of refunds
+		_, err := db.Exec(`
+		ALTER TABLE purchases
+			ADD COLUMN refund_of uuid REFERENCES purchases(id) ON UPDATE CASCADE ON DELETE CASCADE,
+			ADD COLUMN change_owed integer NOT NULL DEFAULT 0 CHECK (change_owed >= 0),
+			ADD COLUMN reason text;
+		CREATE INDEX purchases_refund_of_idx ON purchases (refund_of) WHERE refund_of IS NOT NULL;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Removing refunds from purchases")
+		_, err := db.Exec(`
+			DELETE FROM purchases WHERE refund_of IS NOT NULL;
+			ALTER TABLE purchases
+				DROP COLUMN IF EXISTS refund_of,
+				DROP COLUMN IF EXISTS change_owed,
+				DROP COLUMN IF EXISTS reason;
+		`)
+		return err
+	})
+
+	// SQLite cannot drop a column with a foreign key, refunds are deleted with the purchase by its user and product
+	registerSQLite(`
+		ALTER TABLE purchases ADD COLUMN refund_of text;
+		ALTER TABLE purchases ADD COLUMN change_owed integer NOT NULL DEFAULT 0 CHECK (change_owed >= 0);
+		ALTER TABLE purchases ADD COLUMN reason text;
+		CREATE INDEX purchases_refund_of_idx ON purchases (refund_of) WHERE refund_of IS NOT NULL;`, `
+		DELETE FROM purchases WHERE refund_of IS NOT NULL;
+		DROP INDEX IF EXISTS purchases_refund_of_idx;
+		ALTER TABLE purchases DROP COLUMN reason;
+		ALTER TABLE purchases DROP COLUMN change_owed;
+		ALTER TABLE purchases DROP COLUMN refund_of;`)
+}
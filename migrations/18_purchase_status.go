@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Adding vend status to purchases")
+		// purchases made before vends were confirmed were dispensed right away, so they are completed
+		_, err := db.Exec(`
+		ALTER TABLE purchases
+			ADD COLUMN status text NOT NULL DEFAULT 'completed'
+				CHECK (status IN ('reserved', 'dispensing', 'completed', 'failed'));
+		CREATE INDEX purchases_reserved_idx ON purchases (created_at) WHERE status = 'reserved';`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Removing vend status from purchases")
+		_, err := db.Exec(`
+			ALTER TABLE purchases DROP COLUMN IF EXISTS status;
+		`)
+		return err
+	})
+
+	registerSQLite(`
+		ALTER TABLE purchases ADD COLUMN status text NOT NULL DEFAULT 'completed'
+			CHECK (status IN ('reserved', 'dispensing', 'completed', 'failed'));
+		CREATE INDEX purchases_reserved_idx ON purchases (created_at) WHERE status = 'reserved';`, `
+		DROP INDEX IF EXISTS purchases_reserved_idx;
+		ALTER TABLE purchases DROP COLUMN status;`)
+}
@@ -0,0 +1,125 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating accounts and journal tables")
+		// the balances from before the journal are posted as one opening transaction, deposits held by a machine
+		// against its cash box and everything else against the external account
+		_, err := db.Exec(`
+		CREATE TABLE accounts (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			type text NOT NULL CHECK (type IN ('buyer_wallet', 'change_owed', 'machine_cash', 'seller_revenue', 'platform_fee', 'external')),
+			owner_id uuid NOT NULL,
+			balance bigint NOT NULL DEFAULT 0,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			UNIQUE (type, owner_id)
+		);
+
+		CREATE TABLE journal_transactions (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			kind text NOT NULL CHECK (kind IN ('opening', 'deposit', 'withdrawal', 'purchase', 'change', 'refund', 'payout')),
+			reference_id uuid,
+			request_id text,
+			created_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE INDEX journal_transactions_reference_id_idx ON journal_transactions (reference_id) WHERE reference_id IS NOT NULL;
+
+		CREATE TABLE journal_entries (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			transaction_id uuid REFERENCES journal_transactions(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			account_id uuid REFERENCES accounts(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			amount bigint NOT NULL CHECK (amount <> 0),
+			created_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE INDEX journal_entries_account_id_idx ON journal_entries (account_id, created_at);
+		CREATE INDEX journal_entries_transaction_id_idx ON journal_entries (transaction_id);
+
+		WITH balances AS (
+			SELECT 'buyer_wallet' AS type, id AS owner_id, -deposit::bigint AS amount FROM users WHERE deposit > 0
+			UNION ALL
+			SELECT 'machine_cash', machine_id, sum(deposit) FROM users WHERE deposit > 0 AND machine_id IS NOT NULL GROUP BY machine_id
+			UNION ALL
+			SELECT 'change_owed', user_id, -sum(change_owed) FROM purchases GROUP BY user_id HAVING sum(change_owed) > 0
+			UNION ALL
+			SELECT 'seller_revenue', seller_id, -sum(total) FROM purchases WHERE seller_id IS NOT NULL GROUP BY seller_id HAVING sum(total) <> 0
+		), opening AS (
+			SELECT type, owner_id, amount FROM balances
+			UNION ALL
+			SELECT 'external', '00000000-0000-0000-0000-000000000000'::uuid, -sum(amount) FROM balances HAVING sum(amount) <> 0
+		), opening_accounts AS (
+			INSERT INTO accounts (type, owner_id, balance) SELECT type, owner_id, amount FROM opening RETURNING id, balance
+		), opening_transaction AS (
+			INSERT INTO journal_transactions (kind) SELECT 'opening' WHERE EXISTS (SELECT 1 FROM opening) RETURNING id
+		)
+		INSERT INTO journal_entries (transaction_id, account_id, amount)
+			SELECT opening_transaction.id, opening_accounts.id, opening_accounts.balance FROM opening_transaction, opening_accounts;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping accounts and journal tables")
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS journal_entries;
+			DROP TABLE IF EXISTS journal_transactions;
+			DROP TABLE IF EXISTS accounts;
+		`)
+		return err
+	})
+
+	// SQLite has no data-modifying common table expressions, so the opening transaction is posted statement by
+	// statement. All accounts and transactions are new at this point, so they are all part of it
+	registerSQLite(`
+		CREATE TABLE accounts (
+			id text PRIMARY KEY,
+			type text NOT NULL CHECK (type IN ('buyer_wallet', 'change_owed', 'machine_cash', 'seller_revenue', 'platform_fee', 'external')),
+			owner_id text NOT NULL,
+			balance integer NOT NULL DEFAULT 0,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (type, owner_id)
+		);
+
+		CREATE TABLE journal_transactions (
+			id text PRIMARY KEY,
+			kind text NOT NULL CHECK (kind IN ('opening', 'deposit', 'withdrawal', 'purchase', 'change', 'refund', 'payout')),
+			reference_id text,
+			request_id text,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX journal_transactions_reference_id_idx ON journal_transactions (reference_id) WHERE reference_id IS NOT NULL;
+
+		CREATE TABLE journal_entries (
+			id text PRIMARY KEY,
+			transaction_id text REFERENCES journal_transactions(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			account_id text REFERENCES accounts(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			amount integer NOT NULL CHECK (amount <> 0),
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX journal_entries_account_id_idx ON journal_entries (account_id, created_at);
+		CREATE INDEX journal_entries_transaction_id_idx ON journal_entries (transaction_id);
+
+		INSERT INTO accounts (id, type, owner_id, balance)
+		SELECT `+sqliteNewUUID+`, type, owner_id, amount FROM (
+			SELECT 'buyer_wallet' AS type, id AS owner_id, -deposit AS amount FROM users WHERE deposit > 0
+			UNION ALL
+			SELECT 'machine_cash', machine_id, sum(deposit) FROM users WHERE deposit > 0 AND machine_id IS NOT NULL GROUP BY machine_id
+			UNION ALL
+			SELECT 'change_owed', user_id, -sum(change_owed) FROM purchases GROUP BY user_id HAVING sum(change_owed) > 0
+			UNION ALL
+			SELECT 'seller_revenue', seller_id, -sum(total) FROM purchases WHERE seller_id IS NOT NULL GROUP BY seller_id HAVING sum(total) <> 0
+		);
+		INSERT INTO accounts (id, type, owner_id, balance)
+		SELECT `+sqliteNewUUID+`, 'external', '00000000-0000-0000-0000-000000000000', -total FROM (
+			SELECT sum(balance) AS total FROM accounts
+		) WHERE total <> 0;
+
+		INSERT INTO journal_transactions (id, kind)
+		SELECT `+sqliteNewUUID+`, 'opening' WHERE EXISTS (SELECT 1 FROM accounts);
+		INSERT INTO journal_entries (id, transaction_id, account_id, amount)
+		SELECT `+sqliteNewUUID+`, journal_transactions.id, accounts.id, accounts.balance FROM journal_transactions, accounts;`, `
+		DROP TABLE IF EXISTS journal_entries;
+		DROP TABLE IF EXISTS journal_transactions;
+		DROP TABLE IF EXISTS accounts;`)
+}
@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating payouts tables and adding platform fees to purchases")
+		// sales made before the platform fee was introduced were not charged one
+		_, err := db.Exec(`
+		ALTER TABLE purchases ADD COLUMN platform_fee integer NOT NULL DEFAULT 0;
+
+		CREATE TABLE payouts (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			seller_id uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			amount bigint NOT NULL CHECK (amount > 0),
+			sales integer NOT NULL DEFAULT 0,
+			status text NOT NULL DEFAULT 'requested' CHECK (status IN ('requested', 'approved', 'rejected')),
+			provider_reference text,
+			note text,
+			decided_by uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+			decided_at timestamptz,
+			created_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE INDEX payouts_seller_id_idx ON payouts (seller_id, created_at);
+
+		CREATE TABLE payout_items (
+			payout_id uuid REFERENCES payouts(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			purchase_id uuid REFERENCES purchases(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			PRIMARY KEY (payout_id, purchase_id)
+		);
+		CREATE INDEX payout_items_purchase_id_idx ON payout_items (purchase_id);`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping payouts tables and removing platform fees from purchases")
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS payout_items;
+			DROP TABLE IF EXISTS payouts;
+			ALTER TABLE purchases DROP COLUMN IF EXISTS platform_fee;
+		`)
+		return err
+	})
+
+	registerSQLite(`
+		ALTER TABLE purchases ADD COLUMN platform_fee integer NOT NULL DEFAULT 0;
+
+		CREATE TABLE payouts (
+			id text PRIMARY KEY,
+			seller_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			amount integer NOT NULL CHECK (amount > 0),
+			sales integer NOT NULL DEFAULT 0,
+			status text NOT NULL DEFAULT 'requested' CHECK (status IN ('requested', 'approved', 'rejected')),
+			provider_reference text,
+			note text,
+			decided_by text REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+			decided_at timestamp,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX payouts_seller_id_idx ON payouts (seller_id, created_at);
+
+		CREATE TABLE payout_items (
+			payout_id text REFERENCES payouts(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			purchase_id text REFERENCES purchases(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			PRIMARY KEY (payout_id, purchase_id)
+		);
+		CREATE INDEX payout_items_purchase_id_idx ON payout_items (purchase_id);`, `
+		DROP TABLE IF EXISTS payout_items;
+		DROP TABLE IF EXISTS payouts;
+		ALTER TABLE purchases DROP COLUMN platform_fee;`)
+}
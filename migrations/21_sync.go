@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating sync_events table")
+		// the sequence of an event is numbered by the machine, so every machine applies its events in its own order
+		_, err := db.Exec(`
+		CREATE TABLE sync_events (
+			id uuid PRIMARY KEY,
+			machine_id uuid REFERENCES machines(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			batch_id uuid NOT NULL,
+			sequence bigint NOT NULL,
+			kind text NOT NULL CHECK (kind IN ('deposit', 'purchase', 'stock')),
+			occurred_at timestamptz NOT NULL,
+			status text NOT NULL CHECK (status IN ('applied', 'rejected')),
+			conflicts jsonb NOT NULL DEFAULT '[]',
+			applied_at timestamptz NOT NULL DEFAULT now(),
+			UNIQUE (machine_id, sequence)
+		);`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping sync_events table")
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS sync_events;
+		`)
+		return err
+	})
+
+	// the central server keeps the events it applied, machines keep the events they could not push yet and the last
+	// catalogue they pulled. The conflicts of an event are stored as a JSON array
+	registerSQLite(`
+		CREATE TABLE sync_events (
+			id text PRIMARY KEY,
+			machine_id text REFERENCES machines(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			batch_id text NOT NULL,
+			sequence integer NOT NULL,
+			kind text NOT NULL CHECK (kind IN ('deposit', 'purchase', 'stock')),
+			occurred_at timestamp NOT NULL,
+			status text NOT NULL CHECK (status IN ('applied', 'rejected')),
+			conflicts text NOT NULL DEFAULT '[]',
+			applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (machine_id, sequence)
+		);
+
+		CREATE TABLE sync_outbox (
+			sequence integer PRIMARY KEY AUTOINCREMENT,
+			id text UNIQUE NOT NULL,
+			event text NOT NULL,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			pushed_at timestamp,
+			status text,
+			conflicts text
+		);
+		CREATE INDEX sync_outbox_pending_idx ON sync_outbox (sequence) WHERE pushed_at IS NULL;
+
+		CREATE TABLE sync_catalogue (
+			machine_id text PRIMARY KEY,
+			catalogue text NOT NULL,
+			pulled_at timestamp NOT NULL
+		);`, `
+		DROP TABLE IF EXISTS sync_catalogue;
+		DROP TABLE IF EXISTS sync_outbox;
+		DROP TABLE IF EXISTS sync_events;`)
+}
@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Restricting the deletion of rows referenced by purchases and payouts")
+		// purchases and payouts are the ledger of the machine, deleting a user, product or machine must not delete
+		// them with it
+		_, err := db.Exec(`
+		ALTER TABLE purchases
+			DROP CONSTRAINT purchases_user_id_fkey,
+			DROP CONSTRAINT purchases_product_id_fkey,
+			DROP CONSTRAINT purchases_seller_id_fkey,
+			DROP CONSTRAINT purchases_machine_id_fkey,
+			DROP CONSTRAINT purchases_refund_of_fkey,
+			ADD CONSTRAINT purchases_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+			ADD CONSTRAINT purchases_product_id_fkey FOREIGN KEY (product_id) REFERENCES products(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+			ADD CONSTRAINT purchases_seller_id_fkey FOREIGN KEY (seller_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+			ADD CONSTRAINT purchases_machine_id_fkey FOREIGN KEY (machine_id) REFERENCES machines(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+			ADD CONSTRAINT purchases_refund_of_fkey FOREIGN KEY (refund_of) REFERENCES purchases(id) ON UPDATE CASCADE ON DELETE RESTRICT;
+
+		ALTER TABLE payouts
+			DROP CONSTRAINT payouts_seller_id_fkey,
+			ADD CONSTRAINT payouts_seller_id_fkey FOREIGN KEY (seller_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE RESTRICT;
+
+		ALTER TABLE payout_items
+			DROP CONSTRAINT payout_items_purchase_id_fkey,
+			ADD CONSTRAINT payout_items_purchase_id_fkey FOREIGN KEY (purchase_id) REFERENCES purchases(id) ON UPDATE CASCADE ON DELETE RESTRICT;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Deleting purchases and payouts with the rows they reference")
+		_, err := db.Exec(`
+			ALTER TABLE payout_items
+				DROP CONSTRAINT payout_items_purchase_id_fkey,
+				ADD CONSTRAINT payout_items_purchase_id_fkey FOREIGN KEY (purchase_id) REFERENCES purchases(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+			ALTER TABLE payouts
+				DROP CONSTRAINT payouts_seller_id_fkey,
+				ADD CONSTRAINT payouts_seller_id_fkey FOREIGN KEY (seller_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+			ALTER TABLE purchases
+				DROP CONSTRAINT purchases_user_id_fkey,
+				DROP CONSTRAINT purchases_product_id_fkey,
+				DROP CONSTRAINT purchases_seller_id_fkey,
+				DROP CONSTRAINT purchases_machine_id_fkey,
+				DROP CONSTRAINT purchases_refund_of_fkey,
+				ADD CONSTRAINT purchases_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+				ADD CONSTRAINT purchases_product_id_fkey FOREIGN KEY (product_id) REFERENCES products(id) ON UPDATE CASCADE ON DELETE CASCADE,
+				ADD CONSTRAINT purchases_seller_id_fkey FOREIGN KEY (seller_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+				ADD CONSTRAINT purchases_machine_id_fkey FOREIGN KEY (machine_id) REFERENCES machines(id) ON UPDATE CASCADE ON DELETE SET NULL,
+				ADD CONSTRAINT purchases_refund_of_fkey FOREIGN KEY (refund_of) REFERENCES purchases(id) ON UPDATE CASCADE ON DELETE CASCADE;
+		`)
+		return err
+	})
+
+	// SQLite cannot change the actions of a foreign key without copying the table, so the deletes are restricted
+	// by triggers, which run before the foreign keys of the purchases and payouts delete them
+	registerSQLite(`
+		CREATE TRIGGER purchases_restrict_user_delete BEFORE DELETE ON users
+		WHEN EXISTS (SELECT 1 FROM purchases WHERE user_id = OLD.id OR seller_id = OLD.id)
+			OR EXISTS (SELECT 1 FROM payouts WHERE seller_id = OLD.id)
+		BEGIN
+			SELECT RAISE(ABORT, 'user is referenced by purchases or payouts');
+		END;
+
+		CREATE TRIGGER payout_items_restrict_purchase_delete BEFORE DELETE ON purchases
+		WHEN EXISTS (SELECT 1 FROM payout_items WHERE purchase_id = OLD.id)
+		BEGIN
+			SELECT RAISE(ABORT, 'purchase is referenced by payouts');
+		END;
+
+		CREATE TRIGGER purchases_restrict_product_delete BEFORE DELETE ON products
+		WHEN EXISTS (SELECT 1 FROM purchases WHERE product_id = OLD.id)
+		BEGIN
+			SELECT RAISE(ABORT, 'product is referenced by purchases');
+		END;`, `
+		DROP TRIGGER IF EXISTS purchases_restrict_product_delete;
+		DROP TRIGGER IF EXISTS payout_items_restrict_purchase_delete;
+		DROP TRIGGER IF EXISTS purchases_restrict_user_delete;`)
+}
@@ -0,0 +1,14 @@
+package migrations
+
+func init() {
+	// only machines keep the tokens they sync with. The central server rotates the refresh token on every refresh,
+	// so the machine stores the one it got last instead of the one it was set up with
+	registerSQLite(`
+		CREATE TABLE sync_credentials (
+			machine_id text PRIMARY KEY,
+			token text NOT NULL,
+			refresh_token text NOT NULL,
+			updated_at timestamp NOT NULL
+		);`, `
+		DROP TABLE IF EXISTS sync_credentials;`)
+}
@@ -28,4 +28,15 @@ func init() {
 		`)
 		return err
 	})
+
+	registerSQLite(`
+		CREATE TABLE users (
+			id text PRIMARY KEY,
+			username varchar(100) UNIQUE NOT NULL,
+			password varchar(100) NOT NULL,
+			role varchar(100) NOT NULL,
+			token text,
+			deposit integer
+		);`, `
+		DROP TABLE IF EXISTS users;`)
 }
@@ -24,4 +24,14 @@ func init() {
 		`)
 		return err
 	})
+
+	registerSQLite(`
+		CREATE TABLE products (
+			id text PRIMARY KEY,
+			name text UNIQUE NOT NULL,
+			seller_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			amount_available integer NOT NULL,
+			cost integer NOT NULL
+		);`, `
+		DROP TABLE IF EXISTS products;`)
 }
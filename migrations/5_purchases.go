@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating purchases table")
+		_, err := db.Exec(`
+		CREATE TABLE purchases (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			product_id uuid REFERENCES products(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			seller_id uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			quantity int NOT NULL,
+			unit_price int NOT NULL,
+			total int NOT NULL,
+			change_returned int NOT NULL DEFAULT 0,
+			request_id text,
+			created_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE INDEX purchases_user_id_idx ON purchases(user_id, created_at);
+		CREATE INDEX purchases_seller_id_idx ON purchases(seller_id, created_at);
+
+		INSERT INTO purchases (user_id, product_id, seller_id, quantity, unit_price, total)
+		SELECT up.user_id, up.product_id, p.seller_id, up.amount, p.cost, up.amount * p.cost
+		FROM users_products up
+		JOIN products p ON p.id = up.product_id;
+
+		DROP TABLE IF EXISTS users_products CASCADE;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping purchases table")
+		_, err := db.Exec(`
+			CREATE TABLE users_products (
+				id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+				user_id uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+				product_id uuid REFERENCES products(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+				amount int NOT NULL,
+				UNIQUE(user_id, product_id)
+			);
+
+			INSERT INTO users_products (user_id, product_id, amount)
+			SELECT user_id, product_id, SUM(quantity)
+			FROM purchases
+			GROUP BY user_id, product_id;
+
+			DROP TABLE IF EXISTS purchases CASCADE;
+		`)
+		return err
+	})
+
+	// the purchases of the users_products table, which SQLite never had, are not carried over
+	registerSQLite(`
+		CREATE TABLE purchases (
+			id text PRIMARY KEY,
+			user_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			product_id text REFERENCES products(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			seller_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			quantity integer NOT NULL,
+			unit_price integer NOT NULL,
+			total integer NOT NULL,
+			change_returned integer NOT NULL DEFAULT 0,
+			request_id text,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX purchases_user_id_idx ON purchases(user_id, created_at);
+		CREATE INDEX purchases_seller_id_idx ON purchases(seller_id, created_at);`, `
+		DROP TABLE IF EXISTS purchases;`)
+}
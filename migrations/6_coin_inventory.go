@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating coin_inventory table")
+		_, err := db.Exec(`
+		CREATE TABLE coin_inventory (
+			denomination int PRIMARY KEY,
+			count int NOT NULL DEFAULT 0 CHECK (count >= 0)
+		);
+
+		INSERT INTO coin_inventory (denomination, count)
+		VALUES (5, 0), (10, 0), (20, 0), (50, 0), (100, 0);`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping coin_inventory table")
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS coin_inventory CASCADE;
+		`)
+		return err
+	})
+
+	registerSQLite(`
+		CREATE TABLE coin_inventory (
+			denomination integer PRIMARY KEY,
+			count integer NOT NULL DEFAULT 0 CHECK (count >= 0)
+		);
+
+		INSERT INTO coin_inventory (denomination, count)
+		VALUES (5, 0), (10, 0), (20, 0), (50, 0), (100, 0);`, `
+		DROP TABLE IF EXISTS coin_inventory;`)
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating idempotency_keys table")
+		_, err := db.Exec(`
+		CREATE TABLE idempotency_keys (
+			user_id uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			idempotency_key varchar(255) NOT NULL,
+			request_hash text NOT NULL,
+			status int,
+			content_type text,
+			body bytea,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			completed_at timestamptz,
+			PRIMARY KEY (user_id, idempotency_key)
+		);`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping idempotency_keys table")
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS idempotency_keys CASCADE;
+		`)
+		return err
+	})
+
+	registerSQLite(`
+		CREATE TABLE idempotency_keys (
+			user_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			idempotency_key varchar(255) NOT NULL,
+			request_hash text NOT NULL,
+			status integer,
+			content_type text,
+			body blob,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			completed_at timestamp,
+			PRIMARY KEY (user_id, idempotency_key)
+		);`, `
+		DROP TABLE IF EXISTS idempotency_keys;`)
+}
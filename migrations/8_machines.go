@@ -0,0 +1,146 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating machines and slots tables")
+		_, err := db.Exec(`
+		CREATE TABLE machines (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			operator_id uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+			name text NOT NULL,
+			location text,
+			created_at timestamptz NOT NULL DEFAULT now()
+		);
+
+		CREATE TABLE slots (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			machine_id uuid REFERENCES machines(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			code varchar(8) NOT NULL,
+			product_id uuid REFERENCES products(id) ON UPDATE CASCADE ON DELETE SET NULL,
+			capacity int NOT NULL CHECK (capacity > 0),
+			quantity int NOT NULL DEFAULT 0 CHECK (quantity >= 0 AND quantity <= capacity),
+			UNIQUE(machine_id, code)
+		);
+		CREATE INDEX slots_product_id_idx ON slots(product_id);
+
+		-- everything that existed so far was held by a single machine, which takes over the stock and the coins
+		INSERT INTO machines (id, name)
+		SELECT uuid_generate_v4(), 'Default machine'
+		WHERE EXISTS (SELECT 1 FROM products) OR EXISTS (SELECT 1 FROM coin_inventory WHERE count > 0);
+
+		INSERT INTO slots (machine_id, code, product_id, capacity, quantity)
+		SELECT m.id, 'S' || row_number() OVER (ORDER BY p.name, p.id), p.id, GREATEST(p.amount_available, 1), GREATEST(p.amount_available, 0)
+		FROM products p
+		CROSS JOIN machines m;
+
+		ALTER TABLE coin_inventory ADD COLUMN machine_id uuid REFERENCES machines(id) ON UPDATE CASCADE ON DELETE CASCADE;
+		UPDATE coin_inventory SET machine_id = (SELECT id FROM machines LIMIT 1);
+		DELETE FROM coin_inventory WHERE machine_id IS NULL;
+		ALTER TABLE coin_inventory ALTER COLUMN machine_id SET NOT NULL;
+		ALTER TABLE coin_inventory DROP CONSTRAINT coin_inventory_pkey;
+		ALTER TABLE coin_inventory ADD PRIMARY KEY (machine_id, denomination);
+
+		ALTER TABLE users ADD COLUMN machine_id uuid REFERENCES machines(id) ON UPDATE CASCADE ON DELETE SET NULL;
+		ALTER TABLE purchases ADD COLUMN machine_id uuid REFERENCES machines(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+		ALTER TABLE products DROP COLUMN amount_available;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping machines and slots tables")
+		_, err := db.Exec(`
+			ALTER TABLE products ADD COLUMN amount_available int NOT NULL DEFAULT 0;
+			UPDATE products p SET amount_available = COALESCE((SELECT SUM(s.quantity) FROM slots s WHERE s.product_id = p.id), 0);
+
+			ALTER TABLE purchases DROP COLUMN machine_id;
+			ALTER TABLE users DROP COLUMN machine_id;
+
+			CREATE TABLE coin_inventory_totals AS
+			SELECT denomination, SUM(count)::int AS count FROM coin_inventory GROUP BY denomination;
+			DROP TABLE coin_inventory;
+			CREATE TABLE coin_inventory (
+				denomination int PRIMARY KEY,
+				count int NOT NULL DEFAULT 0 CHECK (count >= 0)
+			);
+			INSERT INTO coin_inventory (denomination, count)
+			VALUES (5, 0), (10, 0), (20, 0), (50, 0), (100, 0);
+			UPDATE coin_inventory c SET count = t.count FROM coin_inventory_totals t WHERE t.denomination = c.denomination;
+			DROP TABLE coin_inventory_totals;
+
+			DROP TABLE IF EXISTS slots CASCADE;
+			DROP TABLE IF EXISTS machines CASCADE;
+		`)
+		return err
+	})
+
+	// SQLite cannot change the primary key of a table or drop a column with a foreign key, so the coin inventory is
+	// copied into a new table and the machine ids of users and purchases are not foreign keys
+	registerSQLite(`
+		CREATE TABLE machines (
+			id text PRIMARY KEY,
+			operator_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+			name text NOT NULL,
+			location text,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE slots (
+			id text PRIMARY KEY,
+			machine_id text REFERENCES machines(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			code varchar(8) NOT NULL,
+			product_id text REFERENCES products(id) ON UPDATE CASCADE ON DELETE SET NULL,
+			capacity integer NOT NULL CHECK (capacity > 0),
+			quantity integer NOT NULL DEFAULT 0 CHECK (quantity >= 0 AND quantity <= capacity),
+			UNIQUE(machine_id, code)
+		);
+		CREATE INDEX slots_product_id_idx ON slots(product_id);
+
+		INSERT INTO machines (id, name)
+		SELECT `+sqliteNewUUID+`, 'Default machine'
+		WHERE EXISTS (SELECT 1 FROM products) OR EXISTS (SELECT 1 FROM coin_inventory WHERE count > 0);
+
+		INSERT INTO slots (id, machine_id, code, product_id, capacity, quantity)
+		SELECT `+sqliteNewUUID+`, m.id, 'S' || row_number() OVER (ORDER BY p.name, p.id), p.id,
+			max(p.amount_available, 1), max(p.amount_available, 0)
+		FROM products p
+		CROSS JOIN machines m;
+
+		CREATE TABLE machine_coin_inventory (
+			machine_id text REFERENCES machines(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			denomination integer NOT NULL,
+			count integer NOT NULL DEFAULT 0 CHECK (count >= 0),
+			PRIMARY KEY (machine_id, denomination)
+		);
+		INSERT INTO machine_coin_inventory (machine_id, denomination, count)
+		SELECT m.id, c.denomination, c.count FROM coin_inventory c CROSS JOIN (SELECT id FROM machines LIMIT 1) m;
+		DROP TABLE coin_inventory;
+		ALTER TABLE machine_coin_inventory RENAME TO coin_inventory;
+
+		ALTER TABLE users ADD COLUMN machine_id text;
+		ALTER TABLE purchases ADD COLUMN machine_id text;
+
+		ALTER TABLE products DROP COLUMN amount_available;`, `
+		ALTER TABLE products ADD COLUMN amount_available integer NOT NULL DEFAULT 0;
+		UPDATE products SET amount_available = coalesce((SELECT sum(s.quantity) FROM slots s WHERE s.product_id = products.id), 0);
+
+		ALTER TABLE purchases DROP COLUMN machine_id;
+		ALTER TABLE users DROP COLUMN machine_id;
+
+		CREATE TABLE coin_inventory_totals (
+			denomination integer PRIMARY KEY,
+			count integer NOT NULL DEFAULT 0 CHECK (count >= 0)
+		);
+		INSERT INTO coin_inventory_totals (denomination, count)
+		VALUES (5, 0), (10, 0), (20, 0), (50, 0), (100, 0);
+		UPDATE coin_inventory_totals SET count = coalesce(
+			(SELECT sum(c.count) FROM coin_inventory c WHERE c.denomination = coin_inventory_totals.denomination), 0);
+		DROP TABLE coin_inventory;
+		ALTER TABLE coin_inventory_totals RENAME TO coin_inventory;
+
+		DROP TABLE IF EXISTS slots;
+		DROP TABLE IF EXISTS machines;`)
+}
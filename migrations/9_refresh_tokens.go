@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	migrations.Register(func(db migrations.DB) error {
+		logrus.Infoln("Creating refresh_tokens and revoked_tokens tables")
+		_, err := db.Exec(`
+		CREATE TABLE refresh_tokens (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id uuid REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			token_hash text UNIQUE NOT NULL,
+			expires_at timestamptz NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			revoked_at timestamptz
+		);
+		CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+		CREATE TABLE revoked_tokens (
+			jti text PRIMARY KEY,
+			expires_at timestamptz NOT NULL
+		);
+
+		ALTER TABLE users DROP COLUMN token;`)
+		return err
+	}, func(db migrations.DB) error {
+		logrus.Infoln("Dropping refresh_tokens and revoked_tokens tables")
+		_, err := db.Exec(`
+			ALTER TABLE users ADD COLUMN token text;
+			DROP TABLE IF EXISTS revoked_tokens CASCADE;
+			DROP TABLE IF EXISTS refresh_tokens CASCADE;
+		`)
+		return err
+	})
+
+	registerSQLite(`
+		CREATE TABLE refresh_tokens (
+			id text PRIMARY KEY,
+			user_id text REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+			token_hash text UNIQUE NOT NULL,
+			expires_at timestamp NOT NULL,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			revoked_at timestamp
+		);
+		CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+		CREATE TABLE revoked_tokens (
+			jti text PRIMARY KEY,
+			expires_at timestamp NOT NULL
+		);
+
+		ALTER TABLE users DROP COLUMN token;`, `
+		ALTER TABLE users ADD COLUMN token text;
+		DROP TABLE IF EXISTS revoked_tokens;
+		DROP TABLE IF EXISTS refresh_tokens;`)
+}
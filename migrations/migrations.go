@@ -4,18 +4,15 @@ package migrations
 import (
 	"github.com/dhurimkelmendi/vending_machine/internal/trace"
 	"github.com/go-pg/migrations/v8"
+	"github.com/go-pg/pg/v10"
 	"github.com/sirupsen/logrus"
 )
 
-// Migrate executes the intended migration action on the provided DB. It will
-// also report any changes in the migration version, or if there are no
-// changes.
-func Migrate(action string, db migrations.DB) {
-	if _, _, err := migrations.Run(db, "init"); err != nil {
-		logrus.Info("Initial migration has already been run")
-	}
-
-	oldVersion, newVersion, err := migrations.Run(db, action)
+// Migrate executes the intended migration action on the provided DB, recording
+// the applied migrations in the given schema. It will also report any changes
+// in the migration version, or if there are no changes.
+func Migrate(action string, db migrations.DB, schema string) {
+	oldVersion, newVersion, err := Run(db, schema, action)
 	if err != nil {
 		logrus.Fatalf("%s: Failed to migrate database: %+v", trace.Getfl(), err)
 	}
@@ -27,9 +24,26 @@ func Migrate(action string, db migrations.DB) {
 	}
 }
 
-// Reset attempts to undo all of the database migrations. It is only called in
-// the database test teardown method, and is intended as a utility method.
-func Reset(db migrations.DB) {
+// Run runs the migration action on the Postgres database like Migrate, returning the error instead of exiting. The
+// applied migrations are recorded in the given schema, or in the public schema when it is empty, so that a schema
+// searched before public can be migrated on its own
+func Run(db migrations.DB, schema string, action string) (oldVersion int64, newVersion int64, err error) {
+	collection := migrations.DefaultCollection
+	if schema != "" {
+		collection = migrations.NewCollection(migrations.RegisteredMigrations()...).
+			SetTableName(schema + ".gopg_migrations").
+			DisableSQLAutodiscover(true)
+	}
+	if _, _, err := collection.Run(db, "init"); err != nil {
+		return 0, 0, err
+	}
+	return collection.Run(db, action)
+}
+
+// Reset attempts to undo all of the database migrations in the given schema, or
+// in the public schema when it is empty. It is only called in the database test
+// teardown method, and is intended as a utility method.
+func Reset(db migrations.DB, schema string) {
 	// We can't really use `Migrate("reset", db)` because it's too nice in that it tries to roll
 	// back the migrations back to the beginning and then reapply all of them. The problem with
 	// that is if some tests fails and leaves data in the table, those left over data would cause
@@ -37,7 +51,10 @@ func Reset(db migrations.DB) {
 	// Since the ultimate goal here is just to get the database back to a consistent initial state,
 	// we can simply drop the schema and recreate it and that would let us start over with a blank
 	// database.
-	_, err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public;")
+	if schema == "" {
+		schema = "public"
+	}
+	_, err := db.Exec("DROP SCHEMA ? CASCADE; CREATE SCHEMA ?;", pg.Ident(schema), pg.Ident(schema))
 	if err != nil {
 		logrus.Fatalf("Failed to reset database: %v", err)
 	}
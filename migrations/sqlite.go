@@ -0,0 +1,140 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dhurimkelmendi/vending_machine/internal/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// sqliteMigration translates the Postgres migration with the same version for SQLite, along with the tables a machine
+// keeps to sync with the central server
+type sqliteMigration struct {
+	version int64
+	up      string
+	down    string
+}
+
+var sqliteMigrations []*sqliteMigration
+
+// sqliteNewUUID generates a random version 4 uuid as text, for the rows data migrations create, SQLite has no
+// function for it
+const sqliteNewUUID = `lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) ||
+	'-' || substr('89ab', 1 + (random() & 3), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))`
+
+// registerSQLite registers the SQLite translation of the migration of the calling file, which is numbered by the
+// prefix of the file name like go-pg/migrations numbers the Postgres migrations
+func registerSQLite(up string, down string) {
+	_, file, _, _ := runtime.Caller(1)
+	prefix := strings.SplitN(filepath.Base(file), "_", 2)[0]
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("migration file %s is not prefixed with its version", file))
+	}
+	sqliteMigrations = append(sqliteMigrations, &sqliteMigration{version: version, up: up, down: down})
+	sort.Slice(sqliteMigrations, func(a, b int) bool {
+		return sqliteMigrations[a].version < sqliteMigrations[b].version
+	})
+}
+
+// MigrateSQLite executes the intended migration action on the provided SQLite database, like Migrate does
+// on Postgres
+func MigrateSQLite(action string, db *sql.DB) {
+	oldVersion, newVersion, err := RunSQLite(db, action)
+	if err != nil {
+		logrus.Fatalf("%s: Failed to migrate database: %+v", trace.Getfl(), err)
+	}
+
+	if newVersion != oldVersion {
+		logrus.Infof("Migrated database from version %d to %d", oldVersion, newVersion)
+	} else {
+		logrus.Infof("No migrations to execute, current version is %d", oldVersion)
+	}
+}
+
+// RunSQLite runs the migration action on the SQLite database: `up` applies all pending migrations, `down` rolls
+// back the last one, `reset` rolls back all of them and `version` only reports the current version
+func RunSQLite(db *sql.DB, action string) (oldVersion int64, newVersion int64, err error) {
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer NOT NULL,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`)
+	if err != nil {
+		return 0, 0, err
+	}
+	oldVersion, err = sqliteVersion(db)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	newVersion = oldVersion
+	switch action {
+	case "up":
+		for _, migration := range sqliteMigrations {
+			if migration.version <= newVersion {
+				continue
+			}
+			if err := runSQLiteMigration(db, migration.up, migration.version); err != nil {
+				return oldVersion, newVersion, fmt.Errorf("migration %d: %w", migration.version, err)
+			}
+			newVersion = migration.version
+		}
+	case "down", "reset":
+		for i := len(sqliteMigrations) - 1; i >= 0; i-- {
+			migration := sqliteMigrations[i]
+			if migration.version > newVersion {
+				continue
+			}
+			previous := int64(0)
+			if i > 0 {
+				previous = sqliteMigrations[i-1].version
+			}
+			if err := runSQLiteMigration(db, migration.down, previous); err != nil {
+				return oldVersion, newVersion, fmt.Errorf("migration %d: %w", migration.version, err)
+			}
+			newVersion = previous
+			if action == "down" {
+				break
+			}
+		}
+	case "version":
+	default:
+		return oldVersion, newVersion, fmt.Errorf("unsupported command: %q", action)
+	}
+	return oldVersion, newVersion, nil
+}
+
+// sqliteVersion returns the version of the last migration applied to the database
+func sqliteVersion(db *sql.DB) (int64, error) {
+	var version int64
+	err := db.QueryRow("SELECT version FROM schema_migrations ORDER BY rowid DESC LIMIT 1").Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// runSQLiteMigration runs the statements of a migration and records the version they leave the database at in
+// the same transaction
+func runSQLiteMigration(db *sql.DB, statements string, version int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(statements); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
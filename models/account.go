@@ -0,0 +1,101 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// AccountType is the kind of money an account keeps track of
+type AccountType string
+
+// The accounts money moves between. Buyer wallets hold the deposits of buyers, change owed what refunds could not
+// credit to a deposit, machine cash boxes the coins inside a machine, seller revenue what sellers earned and the
+// platform fee what the platform keeps of it. The external account is the counterpart of money entering or leaving
+// without a machine, such as the initial deposit of a new user
+const (
+	AccountTypeBuyerWallet   AccountType = "buyer_wallet"
+	AccountTypeChangeOwed    AccountType = "change_owed"
+	AccountTypeMachineCash   AccountType = "machine_cash"
+	AccountTypeSellerRevenue AccountType = "seller_revenue"
+	AccountTypePlatformFee   AccountType = "platform_fee"
+	AccountTypeExternal      AccountType = "external"
+)
+
+// IsCreditNormal returns true for accounts whose balance is money owed to someone, which grows with credits
+func (t AccountType) IsCreditNormal() bool {
+	return t != AccountTypeMachineCash && t != AccountTypeExternal
+}
+
+// JournalKind is the money movement a journal transaction records
+type JournalKind string
+
+// The money movements recorded in the journal
+const (
+	JournalKindOpening    JournalKind = "opening"
+	JournalKindDeposit    JournalKind = "deposit"
+	JournalKindWithdrawal JournalKind = "withdrawal"
+	JournalKindPurchase   JournalKind = "purchase"
+	JournalKindChange     JournalKind = "change"
+	JournalKindRefund     JournalKind = "refund"
+	JournalKindPayout     JournalKind = "payout"
+)
+
+// Account is a struct that represents a db row of the Accounts table. An account is identified by its type and
+// owner, the user or machine it belongs to, platform wide accounts are owned by uuid.Nil. Balance is the sum of its
+// journal entries, debits are positive and credits negative
+type Account struct {
+	tableName struct{}    `pg:"accounts"`
+	ID        uuid.UUID   `json:"id" pg:"id,pk,type:uuid"`
+	Type      AccountType `json:"type"`
+	OwnerID   uuid.UUID   `json:"owner_id" pg:"owner_id,type:uuid,use_zero"`
+	Balance   int64       `json:"balance" pg:",use_zero"`
+	CreatedAt time.Time   `json:"created_at" pg:"default:now()"`
+}
+
+// NormalBalance returns the balance of the account with the sign of its normal side, so the money owed to the owner
+// of a credit normal account is positive
+func (a *Account) NormalBalance() int64 {
+	if a.Type.IsCreditNormal() {
+		return -a.Balance
+	}
+	return a.Balance
+}
+
+// Render is used by go-chi/renderer
+func (a *Account) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// JournalTransaction is a struct that represents a db row of the JournalTransactions table, a single money movement
+// whose entries add up to zero. ReferenceID is the purchase, refund or payout it records, if any
+type JournalTransaction struct {
+	tableName   struct{}        `pg:"journal_transactions"`
+	ID          uuid.UUID       `json:"id" pg:"id,pk,type:uuid"`
+	Kind        JournalKind     `json:"kind"`
+	ReferenceID uuid.UUID       `json:"reference_id,omitempty" pg:"reference_id,type:uuid"`
+	RequestID   string          `json:"request_id,omitempty"`
+	CreatedAt   time.Time       `json:"created_at" pg:"default:now()"`
+	Entries     []*JournalEntry `json:"entries,omitempty" pg:"rel:has-many,join_fk:transaction_id"`
+}
+
+// IsBalanced returns true if the debits and credits of the transaction add up to zero
+func (t *JournalTransaction) IsBalanced() bool {
+	var sum int64
+	for _, entry := range t.Entries {
+		sum += entry.Amount
+	}
+	return sum == 0
+}
+
+// JournalEntry is a struct that represents a db row of the JournalEntries table, the debit, if positive, or credit,
+// if negative, of an account by a journal transaction
+type JournalEntry struct {
+	tableName     struct{}  `pg:"journal_entries"`
+	ID            uuid.UUID `json:"id" pg:"id,pk,type:uuid"`
+	TransactionID uuid.UUID `json:"transaction_id" pg:"transaction_id,type:uuid"`
+	AccountID     uuid.UUID `json:"account_id" pg:"account_id,type:uuid"`
+	Amount        int64     `json:"amount"`
+	CreatedAt     time.Time `json:"created_at" pg:"default:now()"`
+}
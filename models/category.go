@@ -0,0 +1,24 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Category is a struct that represents a db row of the Categories table. Categories form a tree,
+// e.g. Drinks > Soda, where root categories have no parent
+type Category struct {
+	tableName struct{}    `pg:"categories"`
+	ID        uuid.UUID   `json:"id" pg:"id,pk,type:uuid"`
+	ParentID  uuid.UUID   `json:"parent_id,omitempty" pg:"parent_id,type:uuid"`
+	Name      string      `json:"name"`
+	CreatedAt time.Time   `json:"created_at" pg:"default:now()"`
+	Children  []*Category `json:"children,omitempty" pg:"-"`
+}
+
+// Render is used by go-chi/renderer
+func (c *Category) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"net/http"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// CoinInventory is a struct that represents a db row of the CoinInventory table,
+// holding the number of coins of a single denomination that are in a machine
+type CoinInventory struct {
+	tableName    struct{}  `pg:"coin_inventory"`
+	MachineID    uuid.UUID `json:"machine_id" pg:"machine_id,pk,type:uuid"`
+	Denomination int32     `json:"denomination" pg:"denomination,pk"`
+	Count        int32     `json:"count" pg:"count,use_zero"`
+}
+
+// Render is used by go-chi/renderer
+func (c *CoinInventory) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
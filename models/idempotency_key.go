@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// IdempotencyKey is a struct that represents a db row of the IdempotencyKeys table,
+// holding the response of the first request made by a user with a given Idempotency-Key header
+type IdempotencyKey struct {
+	tableName      struct{}   `pg:"idempotency_keys"`
+	UserID         uuid.UUID  `pg:"user_id,pk,type:uuid"`
+	IdempotencyKey string     `pg:"idempotency_key,pk"`
+	RequestHash    string     `pg:"request_hash"`
+	Status         int        `pg:"status"`
+	ContentType    string     `pg:"content_type"`
+	Body           []byte     `pg:"body"`
+	CreatedAt      time.Time  `pg:"created_at,default:now()"`
+	CompletedAt    *time.Time `pg:"completed_at"`
+}
+
+// IsCompleted returns true once the response of the request has been stored
+func (k *IdempotencyKey) IsCompleted() bool {
+	return k.CompletedAt != nil
+}
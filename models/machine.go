@@ -0,0 +1,56 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Machine is a struct that represents a db row of the Machines table, a physical vending machine
+type Machine struct {
+	tableName  struct{}  `pg:"machines"`
+	ID         uuid.UUID `json:"id" pg:"id,pk,type:uuid"`
+	OperatorID uuid.UUID `json:"operator_id" pg:"operator_id,type:uuid"`
+	Name       string    `json:"name"`
+	Location   string    `json:"location"`
+	CreatedAt  time.Time `json:"created_at" pg:"default:now()"`
+	Slots      []*Slot   `json:"slots,omitempty" pg:"rel:has-many"`
+}
+
+// IsOperatedBy returns true if the user is allowed to manage the slots and coins of the machine.
+// Machines without an operator can be managed by every seller
+func (m *Machine) IsOperatedBy(userID uuid.UUID) bool {
+	return m.OperatorID == uuid.Nil || m.OperatorID == userID
+}
+
+// OwnerFor returns the id of the user owning the machine for permission checks, which is the given user
+// when they operate it
+func (m *Machine) OwnerFor(userID uuid.UUID) uuid.UUID {
+	if m.IsOperatedBy(userID) {
+		return userID
+	}
+	return m.OperatorID
+}
+
+// Render is used by go-chi/renderer
+func (m *Machine) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Slot is a struct that represents a db row of the Slots table, a spiral of a machine holding a single product
+type Slot struct {
+	tableName struct{}  `pg:"slots"`
+	ID        uuid.UUID `json:"id" pg:"id,pk,type:uuid"`
+	MachineID uuid.UUID `json:"machine_id" pg:"machine_id,type:uuid"`
+	Code      string    `json:"code"`
+	ProductID uuid.UUID `json:"product_id" pg:"product_id,type:uuid"`
+	Capacity  int32     `json:"capacity"`
+	Quantity  int32     `json:"quantity" pg:",use_zero"`
+	Product   *Product  `json:"product,omitempty" pg:"rel:has-one"`
+}
+
+// Render is used by go-chi/renderer
+func (s *Slot) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// PayoutStatus is the state of a payout, a payout is requested by the seller and then approved or rejected by an admin
+type PayoutStatus string
+
+// The states of a payout
+const (
+	PayoutStatusRequested PayoutStatus = "requested"
+	PayoutStatusApproved  PayoutStatus = "approved"
+	PayoutStatusRejected  PayoutStatus = "rejected"
+)
+
+// Payout is a struct that represents a db row of the Payouts table.
+// A payout pays the seller the revenue of the purchases and refunds listed as its items, which is their Total minus
+// the PlatformFee. The items of a rejected payout are released, so they can be included in the next payout
+type Payout struct {
+	tableName         struct{}     `pg:"payouts"`
+	ID                uuid.UUID    `json:"id" pg:"id,pk,type:uuid"`
+	SellerID          uuid.UUID    `json:"seller_id" pg:"seller_id,type:uuid"`
+	Amount            int64        `json:"amount" pg:",use_zero"`
+	Sales             int32        `json:"sales" pg:",use_zero"`
+	Status            PayoutStatus `json:"status"`
+	ProviderReference string       `json:"provider_reference,omitempty"`
+	Note              string       `json:"note,omitempty"`
+	DecidedBy         uuid.UUID    `json:"decided_by,omitempty" pg:"decided_by,type:uuid"`
+	DecidedAt         *time.Time   `json:"decided_at,omitempty"`
+	CreatedAt         time.Time    `json:"created_at" pg:"default:now()"`
+}
+
+// Render is used by go-chi/renderer
+func (p *Payout) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// PayoutItem is a struct that represents a db row of the PayoutItems table, a purchase included in a payout
+type PayoutItem struct {
+	tableName  struct{}  `pg:"payout_items"`
+	PayoutID   uuid.UUID `pg:"payout_id,pk,type:uuid"`
+	PurchaseID uuid.UUID `pg:"purchase_id,pk,type:uuid"`
+}
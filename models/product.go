@@ -8,12 +8,27 @@ import (
 
 // Product is a struct that represents a db row of the Products table
 type Product struct {
-	tableName       struct{}  `pg:"products"`
-	ID              uuid.UUID `pg:"id,pk,type:uuid"`
-	SellerID        uuid.UUID `json:"seller_id" pg:"seller_id,fk,type:uuid"`
-	Name            string    `json:"name"`
-	AmountAvailable int32     `json:"amount_available"`
-	Cost            int32     `json:"cost"`
+	tableName struct{}  `pg:"products"`
+	ID        uuid.UUID `pg:"id,pk,type:uuid"`
+	SellerID  uuid.UUID `json:"seller_id" pg:"seller_id,fk,type:uuid"`
+	Name      string    `json:"name"`
+	Cost      int32     `json:"cost"`
+	// Description is searched together with the name by ProductService.SearchProducts
+	Description string    `json:"description" pg:",use_zero"`
+	CategoryID  uuid.UUID `json:"category_id,omitempty" pg:"category_id,type:uuid"`
+	Tags        []string  `json:"tags" pg:"tags,array"`
+	// Calories is the energy of a single item in kcal, nil when unknown
+	Calories  *int32   `json:"calories,omitempty"`
+	Allergens []string `json:"allergens" pg:"allergens,array"`
+	// EAN is the barcode of the product, an EAN-8, UPC-A or EAN-13 number
+	EAN      string `json:"ean,omitempty" pg:"ean"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// Allergens are the allergens that products may declare
+var Allergens = []string{
+	"celery", "crustaceans", "eggs", "fish", "gluten", "lupin", "milk",
+	"molluscs", "mustard", "nuts", "peanuts", "sesame", "soy", "sulphites",
 }
 
 // Merge merges two instances of type Product into one
@@ -24,12 +39,30 @@ func (p *Product) Merge(secondProduct Product) {
 	if p.Name == "" {
 		p.Name = secondProduct.Name
 	}
-	if p.AmountAvailable == 0 {
-		p.AmountAvailable = secondProduct.AmountAvailable
-	}
 	if p.Cost == 0 {
 		p.Cost = secondProduct.Cost
 	}
+	if p.Description == "" {
+		p.Description = secondProduct.Description
+	}
+	if p.CategoryID == uuid.Nil {
+		p.CategoryID = secondProduct.CategoryID
+	}
+	if p.Tags == nil {
+		p.Tags = secondProduct.Tags
+	}
+	if p.Calories == nil {
+		p.Calories = secondProduct.Calories
+	}
+	if p.Allergens == nil {
+		p.Allergens = secondProduct.Allergens
+	}
+	if p.EAN == "" {
+		p.EAN = secondProduct.EAN
+	}
+	if p.ImageURL == "" {
+		p.ImageURL = secondProduct.ImageURL
+	}
 }
 
 // Equals compares two instances of type Product
@@ -40,9 +73,6 @@ func (p *Product) Equals(secondProduct *Product) bool {
 	if p.Name != secondProduct.Name {
 		return false
 	}
-	if p.AmountAvailable != secondProduct.AmountAvailable {
-		return false
-	}
 	if p.Cost != secondProduct.Cost {
 		return false
 	}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ProductPrice is a struct that represents a db row of the ProductPrices table, the cost of a product from
+// EffectiveFrom until EffectiveTo. The prices of a product cover consecutive ranges, the last one has no end
+type ProductPrice struct {
+	tableName     struct{}   `pg:"product_prices"`
+	ID            uuid.UUID  `json:"id" pg:"id,pk,type:uuid"`
+	ProductID     uuid.UUID  `json:"product_id" pg:"product_id,type:uuid"`
+	Cost          int32      `json:"cost"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to"`
+	CreatedBy     uuid.UUID  `json:"created_by,omitempty" pg:"created_by,type:uuid"`
+	CreatedAt     time.Time  `json:"created_at" pg:"default:now()"`
+}
+
+// IsEffectiveAt returns true if the price is the cost of the product at the given time
+func (p *ProductPrice) IsEffectiveAt(t time.Time) bool {
+	return !p.EffectiveFrom.After(t) && (p.EffectiveTo == nil || p.EffectiveTo.After(t))
+}
+
+// Render is used by go-chi/renderer
+func (p *ProductPrice) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
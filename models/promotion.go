@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// PromotionType is the kind of discount a promotion gives
+type PromotionType string
+
+// The available promotion types
+const (
+	// PromotionTypePercentage takes Value percent off every unit of the products
+	PromotionTypePercentage PromotionType = "percentage"
+	// PromotionTypeFixed takes Value off every unit of the products, at most the unit price
+	PromotionTypeFixed PromotionType = "fixed"
+	// PromotionTypeBuyXGetY gives FreeQuantity units for free for every BuyQuantity units bought of a product
+	PromotionTypeBuyXGetY PromotionType = "buy_x_get_y"
+	// PromotionTypeBundle sells the products together for Value, ProductIDs lists a product once for every unit in the bundle
+	PromotionTypeBundle PromotionType = "bundle"
+)
+
+// PromotionTypes lists the available promotion types
+var PromotionTypes = []PromotionType{
+	PromotionTypePercentage, PromotionTypeFixed, PromotionTypeBuyXGetY, PromotionTypeBundle,
+}
+
+// Promotion is a struct that represents a db row of the Promotions table, a discount a seller gives on their products.
+// A promotion applies between StartsAt and EndsAt when they are set, and only during the daily happy hour
+// from HappyHourFrom until HappyHourTo when those are set
+type Promotion struct {
+	tableName     struct{}      `pg:"promotions"`
+	ID            uuid.UUID     `json:"id" pg:"id,pk,type:uuid"`
+	SellerID      uuid.UUID     `json:"seller_id" pg:"seller_id,type:uuid"`
+	Name          string        `json:"name"`
+	Type          PromotionType `json:"type"`
+	ProductIDs    []uuid.UUID   `json:"product_ids" pg:"product_ids,array,type:uuid[]"`
+	Value         int32         `json:"value" pg:",use_zero"`
+	BuyQuantity   int32         `json:"buy_quantity" pg:",use_zero"`
+	FreeQuantity  int32         `json:"free_quantity" pg:",use_zero"`
+	StartsAt      *time.Time    `json:"starts_at"`
+	EndsAt        *time.Time    `json:"ends_at"`
+	HappyHourFrom string        `json:"happy_hour_from,omitempty" pg:"happy_hour_from"`
+	HappyHourTo   string        `json:"happy_hour_to,omitempty" pg:"happy_hour_to"`
+	CreatedAt     time.Time     `json:"created_at" pg:"default:now()"`
+}
+
+// IsActiveAt returns true if the promotion applies at the given time, happy hours are compared
+// to the clock in the location of the time
+func (p *Promotion) IsActiveAt(t time.Time) bool {
+	if p.StartsAt != nil && t.Before(*p.StartsAt) {
+		return false
+	}
+	if p.EndsAt != nil && !t.Before(*p.EndsAt) {
+		return false
+	}
+	if p.HappyHourFrom == "" || p.HappyHourTo == "" {
+		return true
+	}
+
+	from, err := ParseClock(p.HappyHourFrom)
+	if err != nil {
+		return false
+	}
+	to, err := ParseClock(p.HappyHourTo)
+	if err != nil {
+		return false
+	}
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if from <= to {
+		return clock >= from && clock < to
+	}
+	// the happy hour lasts past midnight
+	return clock >= from || clock < to
+}
+
+// ParseClock parses a time of day such as `16:30` or `16:30:00` into the time since midnight
+func ParseClock(value string) (time.Duration, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a time of day, expected HH:MM", value)
+}
+
+// Render is used by go-chi/renderer
+func (p *Promotion) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
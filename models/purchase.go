@@ -0,0 +1,100 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// PurchaseStatus is the state of vending a purchase. A purchase is reserved when it is paid for, dispensing once
+// the machine started to vend it, and ends up completed or failed
+type PurchaseStatus string
+
+// The states a purchase goes through while it is vended
+const (
+	PurchaseStatusReserved   PurchaseStatus = "reserved"
+	PurchaseStatusDispensing PurchaseStatus = "dispensing"
+	PurchaseStatusCompleted  PurchaseStatus = "completed"
+	PurchaseStatusFailed     PurchaseStatus = "failed"
+)
+
+// purchaseTransitions are the states each state of a purchase can move on to
+var purchaseTransitions = map[PurchaseStatus][]PurchaseStatus{
+	PurchaseStatusReserved:   {PurchaseStatusDispensing, PurchaseStatusCompleted, PurchaseStatusFailed},
+	PurchaseStatusDispensing: {PurchaseStatusCompleted, PurchaseStatusFailed},
+}
+
+// CanTransitionTo returns true if a purchase in the status can move on to the next status
+func (s PurchaseStatus) CanTransitionTo(next PurchaseStatus) bool {
+	for _, status := range purchaseTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Purchase is a struct that represents a db row of the Purchases table.
+// Purchases are append-only, every buy of a product is recorded as a new row and only its Status changes while the
+// machine vends it. Total is the OriginalPrice, the quantity at the unit price, minus the Discount of the promotion
+// by PromotionID, if any. The platform keeps the PlatformFee of the Total and the seller earns the rest. The lines
+// of a checkout share its CheckoutID and the change of the checkout is recorded on its last line. A refund is
+// recorded as a reversal of the purchase by RefundOf, with negative quantity and amounts
+type Purchase struct {
+	tableName      struct{}       `pg:"purchases"`
+	ID             uuid.UUID      `json:"id" pg:"id,pk,type:uuid"`
+	UserID         uuid.UUID      `json:"user_id" pg:"user_id,type:uuid"`
+	ProductID      uuid.UUID      `json:"product_id" pg:"product_id,type:uuid"`
+	SellerID       uuid.UUID      `json:"seller_id" pg:"seller_id,type:uuid"`
+	MachineID      uuid.UUID      `json:"machine_id" pg:"machine_id,type:uuid"`
+	Quantity       int32          `json:"quantity"`
+	UnitPrice      int32          `json:"unit_price" pg:",use_zero"`
+	OriginalPrice  int32          `json:"original_price" pg:",use_zero"`
+	Discount       int32          `json:"discount" pg:",use_zero"`
+	PromotionID    uuid.UUID      `json:"promotion_id,omitempty" pg:"promotion_id,type:uuid"`
+	Total          int32          `json:"total" pg:",use_zero"`
+	PlatformFee    int32          `json:"platform_fee" pg:",use_zero"`
+	ChangeReturned int32          `json:"change_returned" pg:",use_zero"`
+	RequestID      string         `json:"request_id"`
+	CheckoutID     uuid.UUID      `json:"checkout_id,omitempty" pg:"checkout_id,type:uuid"`
+	RefundOf       uuid.UUID      `json:"refund_of,omitempty" pg:"refund_of,type:uuid"`
+	ChangeOwed     int32          `json:"change_owed" pg:",use_zero"`
+	Reason         string         `json:"reason,omitempty"`
+	Status         PurchaseStatus `json:"status" pg:"default:'completed'"`
+	CreatedAt      time.Time      `json:"created_at" pg:"default:now()"`
+	Product        *Product       `json:"product,omitempty" pg:"rel:has-one"`
+}
+
+// IsRefund returns true if the purchase is the refund of another purchase
+func (p *Purchase) IsRefund() bool {
+	return p.RefundOf != uuid.Nil
+}
+
+// Equals compares two instances of type Purchase
+func (p *Purchase) Equals(secondPurchase *Purchase) bool {
+	if p.ID != secondPurchase.ID {
+		return false
+	}
+	if p.UserID != secondPurchase.UserID {
+		return false
+	}
+	if p.ProductID != secondPurchase.ProductID {
+		return false
+	}
+	if p.Quantity != secondPurchase.Quantity {
+		return false
+	}
+	if p.UnitPrice != secondPurchase.UnitPrice {
+		return false
+	}
+	if p.Total != secondPurchase.Total {
+		return false
+	}
+	return true
+}
+
+// Render is used by go-chi/renderer
+func (p *Purchase) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
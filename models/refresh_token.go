@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// RefreshToken is a struct that represents a db row of the RefreshTokens table.
+// Only the hash of the token is stored, the token itself is handed to the user once
+type RefreshToken struct {
+	tableName struct{}   `pg:"refresh_tokens"`
+	ID        uuid.UUID  `pg:"id,pk,type:uuid"`
+	UserID    uuid.UUID  `pg:"user_id,type:uuid"`
+	SessionID uuid.UUID  `pg:"session_id,type:uuid"`
+	TokenHash string     `pg:"token_hash"`
+	ExpiresAt time.Time  `pg:"expires_at"`
+	CreatedAt time.Time  `pg:"created_at,default:now()"`
+	RevokedAt *time.Time `pg:"revoked_at"`
+}
+
+// IsRevoked returns true once the refresh token has been used or the user logged out
+func (t *RefreshToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
+
+// IsExpired returns true if the refresh token can no longer be used at the given time
+func (t *RefreshToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// RevokedToken is a struct that represents a db row of the RevokedTokens table,
+// the denylist of access tokens that were revoked before they expired
+type RevokedToken struct {
+	tableName struct{}  `pg:"revoked_tokens"`
+	JTI       string    `pg:"jti,pk"`
+	ExpiresAt time.Time `pg:"expires_at"`
+}
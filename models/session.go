@@ -0,0 +1,36 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Session is a struct that represents a db row of the Sessions table.
+// A session starts on registration or login and lasts as long as its refresh tokens,
+// JTI is the id of the latest access token issued for it
+type Session struct {
+	tableName  struct{}   `pg:"sessions"`
+	ID         uuid.UUID  `json:"id" pg:"id,pk,type:uuid"`
+	UserID     uuid.UUID  `json:"-" pg:"user_id,type:uuid"`
+	JTI        string     `json:"-" pg:"jti"`
+	UserAgent  string     `json:"user_agent" pg:"user_agent"`
+	IPAddress  string     `json:"ip_address" pg:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at" pg:"created_at,default:now()"`
+	LastSeenAt time.Time  `json:"last_seen_at" pg:"last_seen_at,default:now()"`
+	ExpiresAt  time.Time  `json:"expires_at" pg:"expires_at"`
+	EndedAt    *time.Time `json:"-" pg:"ended_at"`
+	// Current is set when listing sessions, for the session of the request
+	Current bool `json:"current" pg:"-"`
+}
+
+// IsActive returns true if the session has not ended or expired at the given time
+func (s *Session) IsActive(now time.Time) bool {
+	return s.EndedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// Render is used by go-chi/renderer
+func (s *Session) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// SyncEventKind is what happened at a machine while it was offline
+type SyncEventKind string
+
+// The events a machine records offline: a coin inserted as deposit, a sale paid from the deposit and a change of the
+// stock of a slot by the operator
+const (
+	SyncEventKindDeposit  SyncEventKind = "deposit"
+	SyncEventKindPurchase SyncEventKind = "purchase"
+	SyncEventKindStock    SyncEventKind = "stock"
+)
+
+// SyncEventStatus is whether the central server applied an event of a machine
+type SyncEventStatus string
+
+// The outcomes of applying an event, an event is rejected when a conflict prevents applying it at all
+const (
+	SyncEventStatusApplied  SyncEventStatus = "applied"
+	SyncEventStatusRejected SyncEventStatus = "rejected"
+)
+
+// SyncConflictType is the way an event of a machine disagrees with the central state
+type SyncConflictType string
+
+// The conflicts between the events of a machine and the central state
+const (
+	SyncConflictUnknownUser          SyncConflictType = "unknown_user"
+	SyncConflictUnknownProduct       SyncConflictType = "unknown_product"
+	SyncConflictUnknownSlot          SyncConflictType = "unknown_slot"
+	SyncConflictUserForbidden        SyncConflictType = "user_forbidden"
+	SyncConflictDepositHeldElsewhere SyncConflictType = "deposit_held_by_another_machine"
+	SyncConflictDepositNotInMachine  SyncConflictType = "deposit_not_in_machine"
+	SyncConflictInsufficientDeposit  SyncConflictType = "insufficient_deposit"
+	SyncConflictPriceMismatch        SyncConflictType = "price_mismatch"
+	SyncConflictStockShortfall       SyncConflictType = "stock_shortfall"
+	SyncConflictCapacityExceeded     SyncConflictType = "capacity_exceeded"
+	SyncConflictChangeMismatch       SyncConflictType = "change_mismatch"
+	SyncConflictInsufficientCoins    SyncConflictType = "insufficient_coins"
+	SyncConflictInvalidDepositAmount SyncConflictType = "invalid_deposit_amount"
+)
+
+// SyncResolution is how a conflict was resolved
+type SyncResolution string
+
+// The resolutions of conflicts. The machine is kept for what physically happened at it, such as the price a buyer
+// paid, the central state is kept for what the central server keeps track of, such as deposits, stock is clamped to
+// what the slots can hold and events that cannot be applied at all are rejected
+const (
+	SyncResolutionMachineKept SyncResolution = "machine_kept"
+	SyncResolutionCentralKept SyncResolution = "central_kept"
+	SyncResolutionClamped     SyncResolution = "clamped"
+	SyncResolutionRejected    SyncResolution = "rejected"
+)
+
+// SyncConflict is a conflict found while applying an event. Machine is the value reported by the machine and
+// Central the value the central server holds, e.g. the price charged and the price of the product at the time
+type SyncConflict struct {
+	Type       SyncConflictType `json:"type"`
+	Resolution SyncResolution   `json:"resolution"`
+	Machine    int64            `json:"machine"`
+	Central    int64            `json:"central"`
+}
+
+// SyncEvent is a struct that represents a db row of the SyncEvents table, an event of a machine applied by the
+// central server. Events are numbered by the machine with increasing sequence numbers
+type SyncEvent struct {
+	tableName  struct{}        `pg:"sync_events"`
+	ID         uuid.UUID       `json:"id" pg:"id,pk,type:uuid"`
+	MachineID  uuid.UUID       `json:"machine_id" pg:"machine_id,type:uuid"`
+	BatchID    uuid.UUID       `json:"batch_id" pg:"batch_id,type:uuid"`
+	Sequence   int64           `json:"sequence"`
+	Kind       SyncEventKind   `json:"kind"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Status     SyncEventStatus `json:"status"`
+	Conflicts  []*SyncConflict `json:"conflicts" pg:"conflicts,type:jsonb"`
+	AppliedAt  time.Time       `json:"applied_at" pg:"default:now()"`
+	// Duplicate is set when the event was applied by an earlier batch, which the event shows the outcome of
+	Duplicate bool `json:"duplicate,omitempty" pg:"-"`
+}
+
+// Render is used by go-chi/renderer
+func (e *SyncEvent) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"net/http"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -13,18 +14,33 @@ type UserRole string
 const (
 	UserRoleSeller UserRole = "seller"
 	UserRoleBuyer  UserRole = "buyer"
+	// UserRoleAdmin manages all users and products, admins can only be appointed by other admins
+	UserRoleAdmin UserRole = "admin"
 )
 
 // User is a struct that represents a db row of the Users table
 type User struct {
-	tableName struct{}   `pg:"users"`
-	ID        uuid.UUID  `pg:"id,pk,type:uuid"`
-	Username  string     `json:"username"`
-	Password  string     `json:"password"`
-	Token     string     `json:"token"`
-	Role      UserRole   `json:"role"`
-	Deposit   int32      `json:"deposit"`
-	Products  []*Product `pg:"many2many:users_products"`
+	tableName struct{}  `pg:"users"`
+	ID        uuid.UUID `pg:"id,pk,type:uuid"`
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	Role      UserRole  `json:"role"`
+	// Deposit mirrors the balance of the buyer wallet of the user in the journal, it is kept on the user so purchases
+	// can lock it with the user row
+	Deposit int32 `json:"deposit"`
+	// MachineID is the machine holding the coins of the deposit, it is empty while there is no deposit
+	MachineID uuid.UUID `json:"machine_id" pg:"machine_id,type:uuid"`
+	// DisabledAt is set while an admin has disabled the user, who then cannot log in
+	DisabledAt *time.Time `json:"disabled_at,omitempty" pg:"disabled_at"`
+
+	// Token is the access token issued on registration and login, it is not stored
+	Token string `json:"token,omitempty" pg:"-"`
+	// TokenExpiresAt is when the access token stops being accepted
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty" pg:"-"`
+	// RefreshToken is exchanged for a new access token, only its hash is stored
+	RefreshToken string `json:"refresh_token,omitempty" pg:"-"`
+	// HasActiveSession is set on login when the user already had another active session
+	HasActiveSession bool `json:"has_active_session,omitempty" pg:"-"`
 }
 
 // Merge merges two instances of type User into one
@@ -41,6 +57,17 @@ func (u *User) Merge(secondUser User) {
 	if u.Deposit == 0 {
 		u.Deposit = secondUser.Deposit
 	}
+	if u.MachineID == uuid.Nil {
+		u.MachineID = secondUser.MachineID
+	}
+	if u.DisabledAt == nil {
+		u.DisabledAt = secondUser.DisabledAt
+	}
+}
+
+// IsDisabled returns true while the user is disabled
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
 }
 
 // Equals compares two instances of type User
@@ -0,0 +1,54 @@
+package payloads
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// RevenueEntry is a movement of the revenue of a seller, positive when the seller earned money and negative when
+// it was refunded or paid out
+type RevenueEntry struct {
+	TransactionID uuid.UUID          `json:"transaction_id"`
+	Kind          models.JournalKind `json:"kind"`
+	ReferenceID   uuid.UUID          `json:"reference_id,omitempty"`
+	Amount        int64              `json:"amount"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// RevenueStatement contains the revenue balance of a seller, what they earned and was not paid out yet, with the
+// latest movements of it, newest first
+type RevenueStatement struct {
+	SellerID uuid.UUID       `json:"seller_id"`
+	Balance  int64           `json:"balance"`
+	Entries  []*RevenueEntry `json:"entries"`
+}
+
+// Render is used by go-chi/renderer
+func (rs *RevenueStatement) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// DepositMismatch is a user whose deposit differs from the balance of their wallet in the journal
+type DepositMismatch struct {
+	UserID        uuid.UUID `json:"user_id"`
+	Deposit       int64     `json:"deposit"`
+	WalletBalance int64     `json:"wallet_balance"`
+}
+
+// Reconciliation contains the differences between the journal and the balances kept outside of it. The journal
+// reconciles when there are none
+type Reconciliation struct {
+	Reconciled             bool               `json:"reconciled"`
+	DepositMismatches      []*DepositMismatch `json:"deposit_mismatches"`
+	UnbalancedTransactions []uuid.UUID        `json:"unbalanced_transactions"`
+	// MisstatedAccounts are the accounts whose balance differs from the sum of their entries
+	MisstatedAccounts []uuid.UUID `json:"misstated_accounts"`
+}
+
+// Render is used by go-chi/renderer
+func (rc *Reconciliation) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,51 @@
+package payloads
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// CategoryList is a struct that contains the root categories, each with its subcategories
+type CategoryList struct {
+	Categories []*models.Category `json:"categories"`
+}
+
+// Render is used by go-chi/renderer
+func (cl *CategoryList) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// CategoryPayload is a struct that represents the payload that is expected when creating or updating a category.
+// A category without a parent is a root category
+type CategoryPayload struct {
+	Name     string    `json:"name"`
+	ParentID uuid.UUID `json:"parent_id"`
+}
+
+// ToCategoryModel converts an instance of type *CategoryPayload to *models.Category type
+func (p *CategoryPayload) ToCategoryModel() *models.Category {
+	return &models.Category{
+		Name:     strings.TrimSpace(p.Name),
+		ParentID: p.ParentID,
+	}
+}
+
+// Validate ensures that all the required fields are present in an instance of *CategoryPayload
+func (p *CategoryPayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name is a required field")
+	}
+	return nil
+}
+
+// Render is used by go-chi/renderer
+func (p *CategoryPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
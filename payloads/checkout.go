@@ -0,0 +1,84 @@
+package payloads
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/change"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// MaxCheckoutItems is the largest number of line items in a single checkout
+const MaxCheckoutItems = 20
+
+// CheckoutItem is a line item of a checkout, the amount of a single product
+type CheckoutItem struct {
+	ProductID uuid.UUID `json:"product_id"`
+	Amount    int32     `json:"amount"`
+}
+
+// CheckoutPayload is a struct that represents the payload for buying several products from a machine at once
+type CheckoutPayload struct {
+	MachineID uuid.UUID       `json:"machine_id"`
+	Items     []*CheckoutItem `json:"items"`
+	// RequestID is the X-Request-Id of the request that triggered the checkout, it is stored in the purchase ledger
+	RequestID string `json:"-"`
+}
+
+// Validate ensures that all the required fields are present in an instance of *CheckoutPayload
+// and that every product is listed once
+func (p *CheckoutPayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if p.MachineID == uuid.Nil {
+		return fmt.Errorf("machine_id cannot be null")
+	}
+	if len(p.Items) == 0 {
+		return fmt.Errorf("items cannot be empty")
+	}
+	if len(p.Items) > MaxCheckoutItems {
+		return fmt.Errorf("a checkout can have at most %d items", MaxCheckoutItems)
+	}
+
+	seenProducts := make(map[uuid.UUID]bool, len(p.Items))
+	for i, item := range p.Items {
+		if item == nil || item.ProductID == uuid.Nil {
+			return fmt.Errorf("product_id of item %d cannot be null", i)
+		}
+		if item.Amount <= 0 {
+			return fmt.Errorf("amount of item %d must be positive", i)
+		}
+		if seenProducts[item.ProductID] {
+			return fmt.Errorf("product %s is listed more than once", item.ProductID)
+		}
+		seenProducts[item.ProductID] = true
+	}
+	return nil
+}
+
+// Render is used by go-chi/renderer
+func (p *CheckoutPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// CheckoutReceipt is a struct that represents the receipt of a checkout, with a purchase for every line item
+// in the order of the items. The totals sum those of the lines, the change is paid out once for the checkout
+type CheckoutReceipt struct {
+	CheckoutID     uuid.UUID          `json:"checkout_id"`
+	UserID         uuid.UUID          `json:"user_id"`
+	MachineID      uuid.UUID          `json:"machine_id"`
+	Lines          []*models.Purchase `json:"lines"`
+	OriginalPrice  int32              `json:"original_price"`
+	Discount       int32              `json:"discount"`
+	PromotionID    uuid.UUID          `json:"promotion_id,omitempty"`
+	Total          int32              `json:"total"`
+	ChangeReturned int32              `json:"change_returned"`
+	Change         change.Coins       `json:"change"`
+}
+
+// Render is used by go-chi/renderer
+func (p *CheckoutReceipt) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,52 @@
+package payloads
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/change"
+	"github.com/dhurimkelmendi/vending_machine/helpers"
+	"github.com/dhurimkelmendi/vending_machine/models"
+)
+
+// CoinInventoryList is a struct that contains a reference to a slice of type *models.CoinInventory
+type CoinInventoryList struct {
+	Coins []*models.CoinInventory `json:"coins"`
+	Total int32                   `json:"total"`
+}
+
+// Render is used by go-chi/renderer
+func (cl *CoinInventoryList) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// RefillCoinsPayload is a struct that represents the payload that is expected when refilling the coin tubes,
+// mapping each denomination to the number of coins that are added
+type RefillCoinsPayload struct {
+	Coins change.Coins `json:"coins"`
+}
+
+// Validate ensures that all the required fields are present in an instance of *RefillCoinsPayload and that all
+// of its coins are of the given denominations
+func (p *RefillCoinsPayload) Validate(acceptableDepositAmountValues []int32) error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if len(p.Coins) == 0 {
+		return fmt.Errorf("coins is a required field")
+	}
+	for denomination, count := range p.Coins {
+		if !helpers.Int32sCointains(acceptableDepositAmountValues, denomination) {
+			return fmt.Errorf("coin denomination can be one of: %v", acceptableDepositAmountValues)
+		}
+		if count <= 0 {
+			return fmt.Errorf("coin count must be positive")
+		}
+	}
+	return nil
+}
+
+// Render is used by go-chi/renderer
+func (p *RefillCoinsPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,135 @@
+package payloads
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// DefaultListLimit is the page size of list endpoints when no limit is requested
+const DefaultListLimit = 50
+
+// MaxListLimit is the largest page size list endpoints return
+const MaxListLimit = 200
+
+// ListParams contains the pagination and sort parameters of a list request
+type ListParams struct {
+	// Limit is the maximum number of rows in the page
+	Limit int
+	// Cursor is the next_cursor of the previous page, empty for the first page
+	Cursor string
+	// Sort is the field the list is sorted on, prefixed with "-" to sort descending
+	Sort string
+}
+
+// Page contains the pagination details of a list response
+type Page struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+}
+
+// ProductFilter contains the parameters of a product list request
+type ProductFilter struct {
+	ListParams
+	// Name matches products whose name contains it, ignoring case
+	Name     string
+	MinCost  *int32
+	MaxCost  *int32
+	SellerID uuid.UUID
+	// InStock only matches products available in a slot of any machine
+	InStock bool
+	// CategoryID matches products of the category and of all of its subcategories
+	CategoryID uuid.UUID
+	// Tags matches products having all of the tags
+	Tags []string
+}
+
+// UserFilter contains the parameters of a user list request
+type UserFilter struct {
+	ListParams
+	// Username matches users whose username contains it, ignoring case
+	Username string
+	Role     models.UserRole
+}
+
+// ParseListParams reads the `limit`, `cursor` and `sort` query parameters
+func ParseListParams(query url.Values) (ListParams, error) {
+	params := ListParams{
+		Limit:  DefaultListLimit,
+		Cursor: query.Get("cursor"),
+		Sort:   query.Get("sort"),
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxListLimit {
+			return params, fmt.Errorf("limit must be a number between 1 and %d", MaxListLimit)
+		}
+		params.Limit = limit
+	}
+	return params, nil
+}
+
+// ParseProductFilter reads the pagination parameters and the `name`, `min_cost`, `max_cost`, `seller_id`,
+// `in_stock`, `category_id` and repeated `tag` query parameters
+func ParseProductFilter(query url.Values) (*ProductFilter, error) {
+	listParams, err := ParseListParams(query)
+	if err != nil {
+		return nil, err
+	}
+	filter := &ProductFilter{
+		ListParams: listParams,
+		Name:       query.Get("name"),
+		Tags:       normalizeTags(query["tag"]),
+	}
+	if filter.MinCost, err = parseCost(query, "min_cost"); err != nil {
+		return nil, err
+	}
+	if filter.MaxCost, err = parseCost(query, "max_cost"); err != nil {
+		return nil, err
+	}
+	if value := query.Get("seller_id"); value != "" {
+		if filter.SellerID, err = uuid.FromString(value); err != nil {
+			return nil, fmt.Errorf("seller_id must be a valid id")
+		}
+	}
+	if value := query.Get("in_stock"); value != "" {
+		if filter.InStock, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("in_stock must be true or false")
+		}
+	}
+	if value := query.Get("category_id"); value != "" {
+		if filter.CategoryID, err = uuid.FromString(value); err != nil {
+			return nil, fmt.Errorf("category_id must be a valid id")
+		}
+	}
+	return filter, nil
+}
+
+func parseCost(query url.Values, key string) (*int32, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	cost, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || cost < 0 {
+		return nil, fmt.Errorf("%s must be a positive number", key)
+	}
+	cost32 := int32(cost)
+	return &cost32, nil
+}
+
+// ParseUserFilter reads the pagination parameters and the `username` and `role` query parameters
+func ParseUserFilter(query url.Values) (*UserFilter, error) {
+	listParams, err := ParseListParams(query)
+	if err != nil {
+		return nil, err
+	}
+	return &UserFilter{
+		ListParams: listParams,
+		Username:   query.Get("username"),
+		Role:       models.UserRole(query.Get("role")),
+	}, nil
+}
@@ -0,0 +1,97 @@
+package payloads
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+var slotCodePattern = regexp.MustCompile(`^[A-Z][0-9]{1,2}$`)
+
+// MachineList is a struct that contains a reference to a slice of type *models.Machine
+type MachineList struct {
+	Machines []*models.Machine `json:"machines"`
+}
+
+// Render is used by go-chi/renderer
+func (ml *MachineList) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// CreateMachinePayload for registering a new machine
+type CreateMachinePayload struct {
+	Name     string `json:"name"`
+	Location string `json:"location"`
+}
+
+// ToMachineModel converts an instance of type *CreateMachinePayload to *models.Machine type
+func (p *CreateMachinePayload) ToMachineModel() *models.Machine {
+	return &models.Machine{
+		Name:     p.Name,
+		Location: p.Location,
+	}
+}
+
+// Validate ensures that all the required fields are present in an instance of *CreateMachinePayload
+func (p *CreateMachinePayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if p.Name == "" {
+		return fmt.Errorf("name is a required field")
+	}
+	return nil
+}
+
+// Render is used by go-chi/renderer
+func (p *CreateMachinePayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// AssignSlotPayload is a struct that represents the payload that is expected when assigning a product to a slot.
+// A slot without a product must be empty
+type AssignSlotPayload struct {
+	Code      string    `json:"-"`
+	ProductID uuid.UUID `json:"product_id"`
+	Capacity  int32     `json:"capacity"`
+	Quantity  int32     `json:"quantity"`
+}
+
+// ToSlotModel converts an instance of type *AssignSlotPayload to *models.Slot type
+func (p *AssignSlotPayload) ToSlotModel(machineID uuid.UUID) *models.Slot {
+	return &models.Slot{
+		MachineID: machineID,
+		Code:      p.Code,
+		ProductID: p.ProductID,
+		Capacity:  p.Capacity,
+		Quantity:  p.Quantity,
+	}
+}
+
+// Validate ensures that all the required fields are present in an instance of *AssignSlotPayload
+func (p *AssignSlotPayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if !slotCodePattern.MatchString(p.Code) {
+		return fmt.Errorf("slot code must be a letter followed by a number, like A3")
+	}
+	if p.Capacity <= 0 {
+		return fmt.Errorf("capacity must be positive")
+	}
+	if p.Quantity < 0 || p.Quantity > p.Capacity {
+		return fmt.Errorf("quantity must be between 0 and the capacity of the slot")
+	}
+	if p.ProductID == uuid.Nil && p.Quantity > 0 {
+		return fmt.Errorf("product_id is required for a slot that is not empty")
+	}
+	return nil
+}
+
+// Render is used by go-chi/renderer
+func (p *AssignSlotPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,95 @@
+package payloads
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// PayoutList is a struct that contains a reference to a slice of type *models.Payout
+type PayoutList struct {
+	Payouts []*models.Payout `json:"payouts"`
+}
+
+// Render is used by go-chi/renderer
+func (pl *PayoutList) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// DecidePayoutPayload is a struct that represents the payload of approving or rejecting a payout
+type DecidePayoutPayload struct {
+	Note string `json:"note"`
+}
+
+// Validate ensures that the fields of an instance of *DecidePayoutPayload are valid
+func (p *DecidePayoutPayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if len(p.Note) > 500 {
+		return fmt.Errorf("note cannot be longer than 500 characters")
+	}
+	return nil
+}
+
+// PayoutSale is a purchase, or the refund of one, included in a payout. Net is what the seller earns of it, the
+// Total minus the PlatformFee, it is negative for refunds
+type PayoutSale struct {
+	PurchaseID  uuid.UUID `json:"purchase_id"`
+	ProductID   uuid.UUID `json:"product_id"`
+	RefundOf    uuid.UUID `json:"refund_of,omitempty"`
+	Quantity    int32     `json:"quantity"`
+	Total       int32     `json:"total"`
+	PlatformFee int32     `json:"platform_fee"`
+	Net         int32     `json:"net"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PayoutStatement contains a payout with the sales it includes, oldest first
+type PayoutStatement struct {
+	Payout *models.Payout `json:"payout"`
+	Sales  []*PayoutSale  `json:"sales"`
+}
+
+// Render is used by go-chi/renderer
+func (ps *PayoutStatement) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// payoutStatementHeader are the columns of a payout statement exported as CSV
+var payoutStatementHeader = []string{"purchase_id", "product_id", "refund_of", "quantity", "total", "platform_fee", "net", "created_at"}
+
+// WriteCSV writes the sales of the statement as CSV, one row per sale after a header row
+func (ps *PayoutStatement) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(payoutStatementHeader); err != nil {
+		return err
+	}
+	for _, sale := range ps.Sales {
+		refundOf := ""
+		if sale.RefundOf != uuid.Nil {
+			refundOf = sale.RefundOf.String()
+		}
+		err := writer.Write([]string{
+			sale.PurchaseID.String(),
+			sale.ProductID.String(),
+			refundOf,
+			strconv.Itoa(int(sale.Quantity)),
+			strconv.Itoa(int(sale.Total)),
+			strconv.Itoa(int(sale.PlatformFee)),
+			strconv.Itoa(int(sale.Net)),
+			sale.CreatedAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -3,13 +3,23 @@ package payloads
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
 )
 
+// MaxProductTags is the largest number of tags of a product
+const MaxProductTags = 20
+
+// maxTagLength is the largest number of characters of a tag
+const maxTagLength = 32
+
 // ProductList is a struct that contains a reference to a slice of type *models.Product
 type ProductList struct {
 	Products []*models.Product `json:"products"`
+	Page
 }
 
 // Render is used by go-chi/renderer
@@ -19,34 +29,47 @@ func (pl *ProductList) Render(w http.ResponseWriter, r *http.Request) error {
 
 // CreateProductPayload for registering a new product
 type CreateProductPayload struct {
-	tableName       struct{} `pg:"products"`
-	Name            string   `json:"name"`
-	AmountAvailable int32    `json:"amount_available"`
-	Cost            int32    `json:"cost"`
+	tableName   struct{}  `pg:"products"`
+	Name        string    `json:"name"`
+	Cost        int32     `json:"cost"`
+	Description string    `json:"description"`
+	CategoryID  uuid.UUID `json:"category_id"`
+	Tags        []string  `json:"tags"`
+	Calories    *int32    `json:"calories"`
+	Allergens   []string  `json:"allergens"`
+	EAN         string    `json:"ean"`
+	ImageURL    string    `json:"image_url"`
 }
 
 // ToProductModel converts an instance of type *RegisterProductPayload to *models.Product type
 func (p *CreateProductPayload) ToProductModel() *models.Product {
 	return &models.Product{
-		Name:            p.Name,
-		AmountAvailable: p.AmountAvailable,
-		Cost:            p.Cost,
+		Name:        p.Name,
+		Cost:        p.Cost,
+		Description: p.Description,
+		CategoryID:  p.CategoryID,
+		Tags:        normalizeTags(p.Tags),
+		Calories:    p.Calories,
+		Allergens:   normalizeTags(p.Allergens),
+		EAN:         p.EAN,
+		ImageURL:    p.ImageURL,
 	}
 }
 
 // Validate ensures that all the required fields are present in an instance of *RegisterProductPayload
+// and that the metadata of the product is well formed
 func (p *CreateProductPayload) Validate() error {
 	if p.Name == "" {
 		return fmt.Errorf("name is a required field")
 	}
-	if p.AmountAvailable == 0 {
-		return fmt.Errorf("amount_available is a required field")
-	}
 	if p.Cost == 0 {
 		return fmt.Errorf("cost is a required field")
 	}
+	if p.Cost < 0 {
+		return fmt.Errorf("cost must be positive")
+	}
 
-	return nil
+	return validateProductMetadata(p.ToProductModel())
 }
 
 // Render is used by go-chi/renderer
@@ -63,22 +86,111 @@ type UpdateProductPayload struct {
 // ToProductModel converts an instance of type *UpdateProductPayload to *models.Product type
 func (p *UpdateProductPayload) ToProductModel() *models.Product {
 	return &models.Product{
-		ID:              p.ID,
-		Name:            p.Name,
-		AmountAvailable: p.AmountAvailable,
-		Cost:            p.Cost,
+		ID:          p.ID,
+		Name:        p.Name,
+		Cost:        p.Cost,
+		Description: p.Description,
+		CategoryID:  p.CategoryID,
+		Tags:        normalizeTags(p.Tags),
+		Calories:    p.Calories,
+		Allergens:   normalizeTags(p.Allergens),
+		EAN:         p.EAN,
+		ImageURL:    p.ImageURL,
 	}
 }
 
 // Validate ensures that all the required fields are present in an instance of *UpdateProductPayload
+// and that the metadata of the product is well formed
 func (p *UpdateProductPayload) Validate() error {
 	if p == nil {
 		return fmt.Errorf("request body cannot be null")
 	}
-	return nil
+	if p.Cost < 0 {
+		return fmt.Errorf("cost must be positive")
+	}
+	return validateProductMetadata(p.ToProductModel())
 }
 
 // Render is used by go-chi/renderer
 func (p *UpdateProductPayload) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
+
+// normalizeTags trims and lowercases the tags and removes empty and repeated ones, keeping a nil slice nil
+// so that an update without tags keeps the existing ones
+func normalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// validateProductMetadata ensures that the tags, calories, allergens, EAN and image URL of the product are
+// well formed, fields that are not set are valid
+func validateProductMetadata(product *models.Product) error {
+	if len(product.Tags) > MaxProductTags {
+		return fmt.Errorf("a product can have at most %d tags", MaxProductTags)
+	}
+	for _, tag := range product.Tags {
+		if len(tag) > maxTagLength {
+			return fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+	}
+	if product.Calories != nil && *product.Calories < 0 {
+		return fmt.Errorf("calories cannot be negative")
+	}
+	for _, allergen := range product.Allergens {
+		if !isAllergen(allergen) {
+			return fmt.Errorf("unknown allergen %q, allergens must be one of %s", allergen, strings.Join(models.Allergens, ", "))
+		}
+	}
+	if product.EAN != "" && !isValidEAN(product.EAN) {
+		return fmt.Errorf("ean must be an EAN-8, UPC-A or EAN-13 number with a valid check digit")
+	}
+	if product.ImageURL != "" {
+		imageURL, err := url.Parse(product.ImageURL)
+		if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") || imageURL.Host == "" {
+			return fmt.Errorf("image_url must be an absolute http or https URL")
+		}
+	}
+	return nil
+}
+
+func isAllergen(value string) bool {
+	for _, allergen := range models.Allergens {
+		if value == allergen {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidEAN checks the length and the check digit of a barcode. From the right, the digits before the check digit
+// are weighted 3, 1, 3, ... and the check digit completes their sum to a multiple of 10
+func isValidEAN(ean string) bool {
+	if len(ean) != 8 && len(ean) != 12 && len(ean) != 13 {
+		return false
+	}
+	sum := 0
+	for i := len(ean) - 1; i >= 0; i-- {
+		if ean[i] < '0' || ean[i] > '9' {
+			return false
+		}
+		digit := int(ean[i] - '0')
+		if (len(ean)-1-i)%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
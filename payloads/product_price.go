@@ -0,0 +1,51 @@
+package payloads
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ProductPriceList is a struct that contains the past, current and scheduled prices of a product
+type ProductPriceList struct {
+	ProductID uuid.UUID              `json:"product_id"`
+	Prices    []*models.ProductPrice `json:"prices"`
+}
+
+// Render is used by go-chi/renderer
+func (pl *ProductPriceList) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// SchedulePricePayload is a struct that represents the payload that is expected when scheduling a price change.
+// The price applies from EffectiveFrom until the next scheduled price, if any
+type SchedulePricePayload struct {
+	Cost          int32     `json:"cost"`
+	EffectiveFrom time.Time `json:"effective_from"`
+}
+
+// Validate ensures that all the required fields are present in an instance of *SchedulePricePayload
+// and that the price change is in the future
+func (p *SchedulePricePayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if p.Cost <= 0 {
+		return fmt.Errorf("cost must be positive")
+	}
+	if p.EffectiveFrom.IsZero() {
+		return fmt.Errorf("effective_from is a required field")
+	}
+	if !p.EffectiveFrom.After(time.Now()) {
+		return fmt.Errorf("effective_from must be in the future")
+	}
+	return nil
+}
+
+// Render is used by go-chi/renderer
+func (p *SchedulePricePayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
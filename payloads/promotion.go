@@ -0,0 +1,159 @@
+package payloads
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// PromotionList is a struct that contains the promotions matching a promotion list request
+type PromotionList struct {
+	Promotions []*models.Promotion `json:"promotions"`
+}
+
+// Render is used by go-chi/renderer
+func (pl *PromotionList) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// PromotionFilter contains the parameters of a promotion list request
+type PromotionFilter struct {
+	SellerID uuid.UUID
+	// ProductID matches promotions that apply to the product
+	ProductID uuid.UUID
+	// Active only matches promotions that apply now
+	Active bool
+}
+
+// ParsePromotionFilter reads the `seller_id`, `product_id` and `active` query parameters
+func ParsePromotionFilter(query url.Values) (*PromotionFilter, error) {
+	filter := &PromotionFilter{}
+	var err error
+	if value := query.Get("seller_id"); value != "" {
+		if filter.SellerID, err = uuid.FromString(value); err != nil {
+			return nil, fmt.Errorf("seller_id must be a valid id")
+		}
+	}
+	if value := query.Get("product_id"); value != "" {
+		if filter.ProductID, err = uuid.FromString(value); err != nil {
+			return nil, fmt.Errorf("product_id must be a valid id")
+		}
+	}
+	if value := query.Get("active"); value != "" {
+		if filter.Active, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("active must be true or false")
+		}
+	}
+	return filter, nil
+}
+
+// PromotionPayload is a struct that represents the payload that is expected when creating or updating a promotion.
+// Value is the percentage off for `percentage` promotions, the amount off every unit for `fixed` promotions and the
+// price of the bundle for `bundle` promotions, which list a product once for every unit of it in the bundle
+type PromotionPayload struct {
+	Name          string               `json:"name"`
+	Type          models.PromotionType `json:"type"`
+	ProductIDs    []uuid.UUID          `json:"product_ids"`
+	Value         int32                `json:"value"`
+	BuyQuantity   int32                `json:"buy_quantity"`
+	FreeQuantity  int32                `json:"free_quantity"`
+	StartsAt      *time.Time           `json:"starts_at"`
+	EndsAt        *time.Time           `json:"ends_at"`
+	HappyHourFrom string               `json:"happy_hour_from"`
+	HappyHourTo   string               `json:"happy_hour_to"`
+}
+
+// ToPromotionModel converts an instance of type *PromotionPayload to *models.Promotion type
+func (p *PromotionPayload) ToPromotionModel(sellerID uuid.UUID) *models.Promotion {
+	return &models.Promotion{
+		SellerID:      sellerID,
+		Name:          strings.TrimSpace(p.Name),
+		Type:          p.Type,
+		ProductIDs:    p.ProductIDs,
+		Value:         p.Value,
+		BuyQuantity:   p.BuyQuantity,
+		FreeQuantity:  p.FreeQuantity,
+		StartsAt:      p.StartsAt,
+		EndsAt:        p.EndsAt,
+		HappyHourFrom: p.HappyHourFrom,
+		HappyHourTo:   p.HappyHourTo,
+	}
+}
+
+// Validate ensures that all the required fields are present in an instance of *PromotionPayload
+// and that they fit the type of the promotion
+func (p *PromotionPayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name is a required field")
+	}
+	if len(p.ProductIDs) == 0 {
+		return fmt.Errorf("product_ids is a required field")
+	}
+	for _, productID := range p.ProductIDs {
+		if productID == uuid.Nil {
+			return fmt.Errorf("product_ids must be valid ids")
+		}
+	}
+	if p.Value < 0 || p.BuyQuantity < 0 || p.FreeQuantity < 0 {
+		return fmt.Errorf("value, buy_quantity and free_quantity cannot be negative")
+	}
+
+	switch p.Type {
+	case models.PromotionTypePercentage:
+		if p.Value < 1 || p.Value > 100 {
+			return fmt.Errorf("value of a percentage promotion must be between 1 and 100")
+		}
+	case models.PromotionTypeFixed:
+		if p.Value == 0 {
+			return fmt.Errorf("value of a fixed promotion must be positive")
+		}
+	case models.PromotionTypeBuyXGetY:
+		if p.BuyQuantity == 0 || p.FreeQuantity == 0 {
+			return fmt.Errorf("buy_quantity and free_quantity of a buy_x_get_y promotion must be positive")
+		}
+	case models.PromotionTypeBundle:
+		if len(p.ProductIDs) < 2 {
+			return fmt.Errorf("a bundle must contain at least two units")
+		}
+		if p.Value == 0 {
+			return fmt.Errorf("value of a bundle promotion must be positive")
+		}
+	default:
+		return fmt.Errorf("type must be one of %v", models.PromotionTypes)
+	}
+
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	if (p.HappyHourFrom == "") != (p.HappyHourTo == "") {
+		return fmt.Errorf("happy_hour_from and happy_hour_to must be set together")
+	}
+	if p.HappyHourFrom != "" {
+		from, err := models.ParseClock(p.HappyHourFrom)
+		if err != nil {
+			return fmt.Errorf("happy_hour_from is invalid, %v", err)
+		}
+		to, err := models.ParseClock(p.HappyHourTo)
+		if err != nil {
+			return fmt.Errorf("happy_hour_to is invalid, %v", err)
+		}
+		if from == to {
+			return fmt.Errorf("happy_hour_to must differ from happy_hour_from")
+		}
+	}
+	return nil
+}
+
+// Render is used by go-chi/renderer
+func (p *PromotionPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,98 @@
+package payloads
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// PurchaseList is a struct that contains a reference to a slice of type *models.Purchase
+type PurchaseList struct {
+	Purchases []*models.Purchase `json:"purchases"`
+}
+
+// Render is used by go-chi/renderer
+func (pl *PurchaseList) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// ProductSales contains the sales totals of a single product
+type ProductSales struct {
+	ProductID uuid.UUID `json:"product_id"`
+	SellerID  uuid.UUID `json:"seller_id"`
+	Purchases int64     `json:"purchases"`
+	ItemsSold int64     `json:"items_sold"`
+	Revenue   int64     `json:"revenue"`
+}
+
+// SalesReport contains the totals of all purchases and a breakdown per product
+type SalesReport struct {
+	Purchases      int64           `json:"purchases"`
+	ItemsSold      int64           `json:"items_sold"`
+	Revenue        int64           `json:"revenue"`
+	ChangeReturned int64           `json:"change_returned"`
+	Products       []*ProductSales `json:"products" pg:"-"`
+}
+
+// Render is used by go-chi/renderer
+func (sr *SalesReport) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// RefundPurchasePayload is a struct that represents the payload of a refund request. A zero Quantity refunds
+// everything of the purchase that was not refunded yet
+type RefundPurchasePayload struct {
+	Quantity int32  `json:"quantity"`
+	Reason   string `json:"reason"`
+	// RequestID is the X-Request-Id of the request that triggered the refund, it is stored in the purchase ledger
+	RequestID string `json:"-"`
+}
+
+// Validate ensures that the fields of an instance of *RefundPurchasePayload are valid
+func (p *RefundPurchasePayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if p.Quantity < 0 {
+		return fmt.Errorf("quantity cannot be negative")
+	}
+	if len(p.Reason) > 500 {
+		return fmt.Errorf("reason can have at most 500 characters")
+	}
+	return nil
+}
+
+// FailPurchasePayload is a struct that represents the payload a machine reports a failed vend with
+type FailPurchasePayload struct {
+	Reason string `json:"reason"`
+	// RequestID is the X-Request-Id of the request that reported the failure, it is stored in the purchase ledger
+	RequestID string `json:"-"`
+}
+
+// Validate ensures that the fields of an instance of *FailPurchasePayload are valid
+func (p *FailPurchasePayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if len(p.Reason) > 500 {
+		return fmt.Errorf("reason can have at most 500 characters")
+	}
+	return nil
+}
+
+// RefundReceipt contains the purchase, the refund entry recorded in the ledger, how many units went back into the
+// slots of the machine and how much was credited to the deposit of the buyer. What could not be credited is the
+// change_owed of the refund. A failed vend of a purchase that was refunded already has no refund entry
+type RefundReceipt struct {
+	Purchase        *models.Purchase `json:"purchase"`
+	Refund          *models.Purchase `json:"refund"`
+	Restocked       int32            `json:"restocked"`
+	DepositCredited int32            `json:"deposit_credited"`
+}
+
+// Render is used by go-chi/renderer
+func (rr *RefundReceipt) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+package payloads
+
+import (
+	"net/http"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+)
+
+// SessionClient describes the client a session is started from, it is taken from the request
+type SessionClient struct {
+	UserAgent string
+	IPAddress string
+}
+
+// SessionList is a struct that contains a reference to a slice of type *models.Session
+type SessionList struct {
+	Sessions []*models.Session `json:"sessions"`
+}
+
+// Render is used by go-chi/renderer
+func (sl *SessionList) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
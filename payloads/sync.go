@@ -0,0 +1,153 @@
+package payloads
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// MaxSyncBatchEvents is the maximum number of events a machine can push in a single batch
+const MaxSyncBatchEvents = 500
+
+// SyncEvent is an event recorded by a machine while it was offline. A deposit event has the UserID and the Amount of
+// the coin, a purchase event the UserID, the ProductID, the Quantity sold at the UnitPrice the machine charged and
+// the ChangeReturned, a stock event the SlotCode and the Quantity added to it, negative when units were removed
+type SyncEvent struct {
+	ID             uuid.UUID            `json:"id"`
+	Sequence       int64                `json:"sequence"`
+	Kind           models.SyncEventKind `json:"kind"`
+	OccurredAt     time.Time            `json:"occurred_at"`
+	UserID         uuid.UUID            `json:"user_id,omitempty"`
+	ProductID      uuid.UUID            `json:"product_id,omitempty"`
+	SlotCode       string               `json:"slot_code,omitempty"`
+	Quantity       int32                `json:"quantity,omitempty"`
+	UnitPrice      int32                `json:"unit_price,omitempty"`
+	Amount         int32                `json:"amount,omitempty"`
+	ChangeReturned int32                `json:"change_returned,omitempty"`
+}
+
+// Validate ensures that the fields the kind of an instance of *SyncEvent needs are present
+func (e *SyncEvent) Validate() error {
+	if e == nil {
+		return fmt.Errorf("event cannot be null")
+	}
+	if e.ID == uuid.Nil {
+		return fmt.Errorf("id is a required field")
+	}
+	if e.Sequence <= 0 {
+		return fmt.Errorf("sequence must be positive")
+	}
+	if e.OccurredAt.IsZero() {
+		return fmt.Errorf("occurred_at is a required field")
+	}
+	switch e.Kind {
+	case models.SyncEventKindDeposit:
+		if e.UserID == uuid.Nil {
+			return fmt.Errorf("user_id is required for deposits")
+		}
+		if e.Amount <= 0 {
+			return fmt.Errorf("amount of a deposit must be positive")
+		}
+	case models.SyncEventKindPurchase:
+		if e.UserID == uuid.Nil || e.ProductID == uuid.Nil {
+			return fmt.Errorf("user_id and product_id are required for purchases")
+		}
+		if e.Quantity <= 0 {
+			return fmt.Errorf("quantity of a purchase must be positive")
+		}
+		if e.UnitPrice <= 0 {
+			return fmt.Errorf("unit_price of a purchase must be positive")
+		}
+		if e.ChangeReturned < 0 {
+			return fmt.Errorf("change_returned cannot be negative")
+		}
+	case models.SyncEventKindStock:
+		if !slotCodePattern.MatchString(e.SlotCode) {
+			return fmt.Errorf("slot code must be a letter followed by a number, like A3")
+		}
+		if e.Quantity == 0 {
+			return fmt.Errorf("quantity of a stock change cannot be zero")
+		}
+	default:
+		return fmt.Errorf("kind must be one of %s, %s or %s", models.SyncEventKindDeposit, models.SyncEventKindPurchase, models.SyncEventKindStock)
+	}
+	return nil
+}
+
+// SyncBatchPayload is a struct that represents the payload of a machine pushing the events it recorded offline,
+// ordered by their sequence
+type SyncBatchPayload struct {
+	BatchID   uuid.UUID    `json:"batch_id"`
+	MachineID uuid.UUID    `json:"machine_id"`
+	Events    []*SyncEvent `json:"events"`
+	// RequestID is the X-Request-Id of the request that pushed the batch, it is stored in the purchase ledger
+	RequestID string `json:"-"`
+}
+
+// Validate ensures that all the required fields are present in an instance of *SyncBatchPayload and that its events
+// are valid and ordered by increasing sequence numbers
+func (p *SyncBatchPayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if p.BatchID == uuid.Nil {
+		return fmt.Errorf("batch_id is a required field")
+	}
+	if p.MachineID == uuid.Nil {
+		return fmt.Errorf("machine_id is a required field")
+	}
+	if len(p.Events) == 0 {
+		return fmt.Errorf("events cannot be empty")
+	}
+	if len(p.Events) > MaxSyncBatchEvents {
+		return fmt.Errorf("a batch cannot have more than %d events", MaxSyncBatchEvents)
+	}
+	for i, event := range p.Events {
+		if err := event.Validate(); err != nil {
+			return fmt.Errorf("event %d: %v", i, err)
+		}
+		if i > 0 && event.Sequence <= p.Events[i-1].Sequence {
+			return fmt.Errorf("events must be ordered by increasing sequence")
+		}
+	}
+	return nil
+}
+
+// Render is used by go-chi/renderer
+func (p *SyncBatchPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// SyncBatchReport is the outcome of applying a batch: every event with the conflicts found while applying it,
+// and how many events were applied, rejected or applied by an earlier batch already
+type SyncBatchReport struct {
+	BatchID    uuid.UUID           `json:"batch_id"`
+	MachineID  uuid.UUID           `json:"machine_id"`
+	Applied    int                 `json:"applied"`
+	Rejected   int                 `json:"rejected"`
+	Duplicates int                 `json:"duplicates"`
+	Conflicts  int                 `json:"conflicts"`
+	Events     []*models.SyncEvent `json:"events"`
+}
+
+// Render is used by go-chi/renderer
+func (br *SyncBatchReport) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// SyncCatalogue is what a machine sells: its slots with their products at their current cost, and the prices
+// scheduled for those products, so the machine can switch prices at the right time while it is offline
+type SyncCatalogue struct {
+	MachineID       uuid.UUID              `json:"machine_id"`
+	GeneratedAt     time.Time              `json:"generated_at"`
+	Slots           []*models.Slot         `json:"slots"`
+	ScheduledPrices []*models.ProductPrice `json:"scheduled_prices"`
+}
+
+// Render is used by go-chi/renderer
+func (c *SyncCatalogue) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,42 @@
+package payloads
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RefreshTokenPayload is a struct that represents the payload that is expected when refreshing an access token
+// or logging out
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Validate ensures that all the required fields are present in an instance of *RefreshTokenPayload
+func (p *RefreshTokenPayload) Validate() error {
+	if p == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if p.RefreshToken == "" {
+		return fmt.Errorf("refresh_token is a required field")
+	}
+	return nil
+}
+
+// Render is used by go-chi/renderer
+func (p *RefreshTokenPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// AuthTokens is the response to a token refresh, holding a new access token and the refresh token replacing
+// the one that was used
+type AuthTokens struct {
+	Token          string    `json:"token"`
+	TokenExpiresAt time.Time `json:"token_expires_at"`
+	RefreshToken   string    `json:"refresh_token"`
+}
+
+// Render is used by go-chi/renderer
+func (t *AuthTokens) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
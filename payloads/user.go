@@ -3,8 +3,8 @@ package payloads
 import (
 	"fmt"
 	"net/http"
+	"time"
 
-	"github.com/dhurimkelmendi/vending_machine/config"
 	"github.com/dhurimkelmendi/vending_machine/helpers"
 	"github.com/dhurimkelmendi/vending_machine/models"
 	uuid "github.com/satori/go.uuid"
@@ -13,14 +13,16 @@ import (
 // UserList is a struct that contains a reference to a slice of type *models.UserDetails
 type UserList struct {
 	Users []*UserDetails `json:"users"`
+	Page
 }
 
 // UserDetails simple response object
 type UserDetails struct {
-	ID       uuid.UUID       `json:"id"`
-	Username string          `json:"username"`
-	Role     models.UserRole `json:"role"`
-	Deposit  int32           `json:"deposit"`
+	ID         uuid.UUID       `json:"id"`
+	Username   string          `json:"username"`
+	Role       models.UserRole `json:"role"`
+	Deposit    int32           `json:"deposit"`
+	DisabledAt *time.Time      `json:"disabled_at,omitempty"`
 }
 
 // Render is used by go-chi/renderer
@@ -31,10 +33,11 @@ func (u *UserDetails) Render(w http.ResponseWriter, r *http.Request) error {
 // MapUserToUserDetails convert a user model to a payload response
 func MapUserToUserDetails(user *models.User) *UserDetails {
 	return &UserDetails{
-		ID:       user.ID,
-		Username: user.Username,
-		Role:     user.Role,
-		Deposit:  user.Deposit,
+		ID:         user.ID,
+		Username:   user.Username,
+		Role:       user.Role,
+		Deposit:    user.Deposit,
+		DisabledAt: user.DisabledAt,
 	}
 }
 
@@ -43,12 +46,16 @@ func (ul *UserList) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// MaxSignUpDeposit is the largest deposit a user can start with, it bounds the change a machine may be asked to make
+const MaxSignUpDeposit int32 = 10000
+
 // CreateUserPayload for registering a new user
 type CreateUserPayload struct {
 	Username string          `json:"username"`
 	Password string          `json:"password"`
 	Role     models.UserRole `json:"role"`
 	Deposit  int32           `json:"deposit"`
+	Client   SessionClient   `json:"-"`
 }
 
 // ToUserModel converts an instance of type *RegisterUserPayload to *models.User type
@@ -75,6 +82,12 @@ func (u *CreateUserPayload) Validate() error {
 	if u.Role == "" {
 		return fmt.Errorf("role is a required field")
 	}
+	if u.Role != models.UserRoleBuyer && u.Role != models.UserRoleSeller {
+		return fmt.Errorf("role can be one of: %s, %s", models.UserRoleBuyer, models.UserRoleSeller)
+	}
+	if u.Deposit < 0 || u.Deposit > MaxSignUpDeposit {
+		return fmt.Errorf("deposit must be between 0 and %d", MaxSignUpDeposit)
+	}
 
 	return nil
 }
@@ -86,9 +99,10 @@ func (u *CreateUserPayload) Render(w http.ResponseWriter, r *http.Request) error
 
 // LoginUserPayload is a struct that represents the payload that is expected when logging a user in
 type LoginUserPayload struct {
-	ID       uuid.UUID `json:"id"`
-	Username string    `json:"username"`
-	Password string    `json:"password"`
+	ID       uuid.UUID     `json:"id"`
+	Username string        `json:"username"`
+	Password string        `json:"password"`
+	Client   SessionClient `json:"-"`
 }
 
 // Validate ensures that all the required fields are present in an instance of *LoginUserPayload
@@ -133,18 +147,22 @@ func (u *UpdateUserPayload) Render(w http.ResponseWriter, r *http.Request) error
 
 // DepositMoneyPayload is a struct that represents the payload that is expected when updating a user
 type DepositMoneyPayload struct {
-	DepositAmount int32 `json:"deposit_amount"`
+	MachineID     uuid.UUID `json:"machine_id"`
+	DepositAmount int32     `json:"deposit_amount"`
 }
 
-// Validate ensures that all the required fields are present in an instance of DepositMoneyPayload*
-func (u *DepositMoneyPayload) Validate() error {
+// Validate ensures that all the required fields are present in an instance of DepositMoneyPayload* and that the
+// deposit is one of the given coins
+func (u *DepositMoneyPayload) Validate(acceptableDepositAmountValues []int32) error {
 	if u == nil {
 		return fmt.Errorf("request body cannot be null")
 	}
+	if u.MachineID == uuid.Nil {
+		return fmt.Errorf("machine_id is a required field")
+	}
 	if u.DepositAmount == 0 {
 		return fmt.Errorf("deposit_amount is a required field")
 	}
-	acceptableDepositAmountValues := config.GetDefaultInstance().AcceptableDepositAmountValues
 	if !helpers.Int32sCointains(acceptableDepositAmountValues, u.DepositAmount) {
 		return fmt.Errorf("deposit_amount can be one of: %v", acceptableDepositAmountValues)
 	}
@@ -155,3 +173,24 @@ func (u *DepositMoneyPayload) Validate() error {
 func (u *DepositMoneyPayload) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
+
+// UpdateUserRolePayload is a struct that represents the payload that is expected when an admin changes the role of a user
+type UpdateUserRolePayload struct {
+	Role models.UserRole `json:"role"`
+}
+
+// Validate ensures that all the required fields are present in an instance of *UpdateUserRolePayload
+func (u *UpdateUserRolePayload) Validate() error {
+	if u == nil {
+		return fmt.Errorf("request body cannot be null")
+	}
+	if u.Role == "" {
+		return fmt.Errorf("role is required")
+	}
+	return nil
+}
+
+// Render is used by go-chi/renderer
+func (u *UpdateUserRolePayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
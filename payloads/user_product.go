@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/dhurimkelmendi/vending_machine/change"
 	"github.com/dhurimkelmendi/vending_machine/models"
 	uuid "github.com/satori/go.uuid"
 )
@@ -13,41 +14,15 @@ type UserProductBuyList struct {
 	UserProductList []*UserProductPurchase `json:"users_products"`
 }
 
-// UserChange is a struct that represents the change for a user broken down in coins of 5,10,20,100 cents
-type UserChange struct {
-	HundredCentCoins int32 `json:"hundred_cent_coins"`
-	FiftyCentCoins   int32 `json:"fifty_cent_coins"`
-	TwentyCentCoins  int32 `json:"twenty_cent_coins"`
-	TenCentCoins     int32 `json:"ten_cent_coins"`
-	FiveCentCoins    int32 `json:"five_cent_coins"`
-}
-
-// Equals compares two instances of type UserChange
-func (p *UserChange) Equals(secondProduct *UserChange) bool {
-	if p.HundredCentCoins != secondProduct.HundredCentCoins {
-		return false
-	}
-	if p.FiftyCentCoins != secondProduct.FiftyCentCoins {
-		return false
-	}
-	if p.TwentyCentCoins != secondProduct.TwentyCentCoins {
-		return false
-	}
-	if p.TenCentCoins != secondProduct.TenCentCoins {
-		return false
-	}
-	if p.FiveCentCoins != secondProduct.FiveCentCoins {
-		return false
-	}
-	return true
-}
-
-// UserBuysReport is a struct that represents the products bought from a user
+// UserBuysReport is a struct that represents the products bought from a user. AmountDiscounted sums the
+// promotion discounts, every purchase shows its original price, discount and promotion id
 type UserBuysReport struct {
-	UserID      uuid.UUID         `json:"user_id"`
-	AmountSpent int32             `json:"amount_spent"`
-	Change      UserChange        `json:"change"`
-	Products    []*models.Product `json:"products"`
+	UserID           uuid.UUID          `json:"user_id"`
+	AmountSpent      int32              `json:"amount_spent"`
+	AmountDiscounted int32              `json:"amount_discounted"`
+	Change           change.Coins       `json:"change"`
+	Products         []*models.Product  `json:"products"`
+	Purchases        []*models.Purchase `json:"purchases"`
 }
 
 // Render is used by go-chi/renderer
@@ -57,8 +32,11 @@ func (p *UserBuysReport) Render(w http.ResponseWriter, r *http.Request) error {
 
 // UserProductPurchase is a struct that represents the payload for linking a single product to a user
 type UserProductPurchase struct {
+	MachineID uuid.UUID `json:"machine_id"`
 	ProductID uuid.UUID `json:"product_id"`
 	Amount    int32     `json:"amount"`
+	// RequestID is the X-Request-Id of the request that triggered the purchase, it is stored in the purchase ledger
+	RequestID string `json:"-"`
 }
 
 // Validate ensures that all the required fields are present in an instance of *UserProductBuy
@@ -66,12 +44,18 @@ func (p *UserProductPurchase) Validate() error {
 	if p == nil {
 		return fmt.Errorf("request body cannot be null")
 	}
+	if p.MachineID == uuid.Nil {
+		return fmt.Errorf("machine_id cannot be null")
+	}
 	if p.ProductID == uuid.Nil {
 		return fmt.Errorf("product_id cannot be null")
 	}
 	if p.Amount == 0 {
 		return fmt.Errorf("amount cannot be null")
 	}
+	if p.Amount < 0 {
+		return fmt.Errorf("amount must be positive")
+	}
 
 	return nil
 }
@@ -0,0 +1,166 @@
+// Package promotion evaluates the promotions of sellers against the items of a purchase. Promotions do not
+// stack, the promotion giving the largest discount on all items together is applied.
+package promotion
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Item is a product bought in a purchase, items of a purchase are expected to be of distinct products
+type Item struct {
+	ProductID uuid.UUID
+	Quantity  int32
+	UnitPrice int32
+}
+
+// Price returns the price of the item before any discount
+func (i Item) Price() int64 {
+	return int64(i.UnitPrice) * int64(i.Quantity)
+}
+
+// Discount is the result of applying a promotion to the items of a purchase
+type Discount struct {
+	// PromotionID is the id of the applied promotion, uuid.Nil when no promotion applies
+	PromotionID uuid.UUID
+	// Items holds the discount on every item, in the order of the items
+	Items []int32
+	// Total is the sum of the discounts on the items
+	Total int64
+}
+
+// Best returns the discount of the promotion active at the given time that takes the most off the items.
+// Ties go to the promotion created first, so the result does not depend on the order of the promotions
+func Best(promotions []*models.Promotion, items []Item, at time.Time) Discount {
+	best := Discount{Items: make([]int32, len(items))}
+	var bestPromotion *models.Promotion
+	for _, p := range promotions {
+		if !p.IsActiveAt(at) {
+			continue
+		}
+		discounts := Apply(p, items)
+		var total int64
+		for _, discount := range discounts {
+			total += int64(discount)
+		}
+		if total == 0 || total < best.Total {
+			continue
+		}
+		if total == best.Total && !createdBefore(p, bestPromotion) {
+			continue
+		}
+		best = Discount{PromotionID: p.ID, Items: discounts, Total: total}
+		bestPromotion = p
+	}
+	return best
+}
+
+// Apply returns the discount the promotion gives on every item, in the order of the items,
+// regardless of whether the promotion is active
+func Apply(p *models.Promotion, items []Item) []int32 {
+	discounts := make([]int32, len(items))
+	eligible := make(map[uuid.UUID]bool, len(p.ProductIDs))
+	for _, productID := range p.ProductIDs {
+		eligible[productID] = true
+	}
+
+	switch p.Type {
+	case models.PromotionTypePercentage:
+		for i, item := range items {
+			if eligible[item.ProductID] {
+				discounts[i] = int32(item.Price() * int64(min32(p.Value, 100)) / 100)
+			}
+		}
+	case models.PromotionTypeFixed:
+		for i, item := range items {
+			if eligible[item.ProductID] {
+				discounts[i] = int32(int64(min32(p.Value, item.UnitPrice)) * int64(item.Quantity))
+			}
+		}
+	case models.PromotionTypeBuyXGetY:
+		if p.BuyQuantity <= 0 || p.FreeQuantity <= 0 {
+			break
+		}
+		for i, item := range items {
+			if eligible[item.ProductID] {
+				groups := int64(item.Quantity / (p.BuyQuantity + p.FreeQuantity))
+				discounts[i] = int32(groups * int64(p.FreeQuantity) * int64(item.UnitPrice))
+			}
+		}
+	case models.PromotionTypeBundle:
+		applyBundle(p, items, discounts)
+	}
+	return discounts
+}
+
+// applyBundle sets the discount of the bundle on the items, spread over the items in proportion to their price
+func applyBundle(p *models.Promotion, items []Item, discounts []int32) {
+	required := make(map[uuid.UUID]int64, len(p.ProductIDs))
+	for _, productID := range p.ProductIDs {
+		required[productID]++
+	}
+	if len(required) == 0 {
+		return
+	}
+
+	// the index of the item of every product of the bundle
+	indexes := make(map[uuid.UUID]int, len(required))
+	for i, item := range items {
+		if _, ok := required[item.ProductID]; ok {
+			if _, seen := indexes[item.ProductID]; !seen {
+				indexes[item.ProductID] = i
+			}
+		}
+	}
+	if len(indexes) < len(required) {
+		return
+	}
+
+	bundles := int64(-1)
+	var bundlePrice int64
+	for productID, quantity := range required {
+		item := items[indexes[productID]]
+		if n := int64(item.Quantity) / quantity; bundles == -1 || n < bundles {
+			bundles = n
+		}
+		bundlePrice += quantity * int64(item.UnitPrice)
+	}
+	if bundles <= 0 || bundlePrice <= int64(p.Value) {
+		return
+	}
+
+	total := bundles * (bundlePrice - int64(p.Value))
+	var spread int64
+	first := len(items)
+	for productID, quantity := range required {
+		i := indexes[productID]
+		discount := total * quantity * int64(items[i].UnitPrice) / bundlePrice
+		discounts[i] = int32(discount)
+		spread += discount
+		if i < first {
+			first = i
+		}
+	}
+	// the rounding remainder goes to the first item of the bundle
+	discounts[first] += int32(total - spread)
+}
+
+func createdBefore(p *models.Promotion, other *models.Promotion) bool {
+	if other == nil {
+		return true
+	}
+	if !p.CreatedAt.Equal(other.CreatedAt) {
+		return p.CreatedAt.Before(other.CreatedAt)
+	}
+	return bytes.Compare(p.ID.Bytes(), other.ID.Bytes()) < 0
+}
+
+func min32(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
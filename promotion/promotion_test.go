@@ -0,0 +1,208 @@
+package promotion_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/promotion"
+	uuid "github.com/satori/go.uuid"
+)
+
+func newPromotion(promotionType models.PromotionType, value int32, productIDs ...uuid.UUID) *models.Promotion {
+	return &models.Promotion{
+		ID:         uuid.NewV4(),
+		Type:       promotionType,
+		Value:      value,
+		ProductIDs: productIDs,
+		CreatedAt:  time.Now(),
+	}
+}
+
+func equalDiscounts(a []int32, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+	soda := uuid.NewV4()
+	chips := uuid.NewV4()
+	candy := uuid.NewV4()
+
+	cases := []struct {
+		name      string
+		promotion *models.Promotion
+		items     []promotion.Item
+		expected  []int32
+	}{
+		{
+			name:      "percentage of eligible products",
+			promotion: newPromotion(models.PromotionTypePercentage, 25, soda),
+			items:     []promotion.Item{{ProductID: soda, Quantity: 3, UnitPrice: 100}, {ProductID: chips, Quantity: 1, UnitPrice: 80}},
+			expected:  []int32{75, 0},
+		},
+		{
+			name:      "percentage rounds down",
+			promotion: newPromotion(models.PromotionTypePercentage, 10, soda),
+			items:     []promotion.Item{{ProductID: soda, Quantity: 1, UnitPrice: 55}},
+			expected:  []int32{5},
+		},
+		{
+			name:      "fixed per unit",
+			promotion: newPromotion(models.PromotionTypeFixed, 20, soda, chips),
+			items:     []promotion.Item{{ProductID: soda, Quantity: 2, UnitPrice: 100}, {ProductID: chips, Quantity: 1, UnitPrice: 80}},
+			expected:  []int32{40, 20},
+		},
+		{
+			name:      "fixed at most the unit price",
+			promotion: newPromotion(models.PromotionTypeFixed, 500, soda),
+			items:     []promotion.Item{{ProductID: soda, Quantity: 2, UnitPrice: 100}},
+			expected:  []int32{200},
+		},
+		{
+			name: "buy 2 get 1",
+			promotion: &models.Promotion{
+				ID: uuid.NewV4(), Type: models.PromotionTypeBuyXGetY, BuyQuantity: 2, FreeQuantity: 1, ProductIDs: []uuid.UUID{soda},
+			},
+			items:    []promotion.Item{{ProductID: soda, Quantity: 7, UnitPrice: 100}},
+			expected: []int32{200},
+		},
+		{
+			name: "buy 2 get 1 without enough units",
+			promotion: &models.Promotion{
+				ID: uuid.NewV4(), Type: models.PromotionTypeBuyXGetY, BuyQuantity: 2, FreeQuantity: 1, ProductIDs: []uuid.UUID{soda},
+			},
+			items:    []promotion.Item{{ProductID: soda, Quantity: 2, UnitPrice: 100}},
+			expected: []int32{0},
+		},
+		{
+			name:      "bundle spread by price",
+			promotion: newPromotion(models.PromotionTypeBundle, 150, soda, chips),
+			items:     []promotion.Item{{ProductID: chips, Quantity: 1, UnitPrice: 100}, {ProductID: soda, Quantity: 1, UnitPrice: 100}},
+			expected:  []int32{25, 25},
+		},
+		{
+			name:      "bundle applies as often as complete",
+			promotion: newPromotion(models.PromotionTypeBundle, 250, soda, soda, chips),
+			items:     []promotion.Item{{ProductID: soda, Quantity: 5, UnitPrice: 100}, {ProductID: chips, Quantity: 3, UnitPrice: 100}},
+			expected:  []int32{67, 33},
+		},
+		{
+			name:      "bundle of a single product",
+			promotion: newPromotion(models.PromotionTypeBundle, 200, soda, soda, soda),
+			items:     []promotion.Item{{ProductID: soda, Quantity: 4, UnitPrice: 100}},
+			expected:  []int32{100},
+		},
+		{
+			name:      "incomplete bundle",
+			promotion: newPromotion(models.PromotionTypeBundle, 150, soda, candy),
+			items:     []promotion.Item{{ProductID: soda, Quantity: 1, UnitPrice: 100}},
+			expected:  []int32{0},
+		},
+		{
+			name:      "bundle more expensive than its products",
+			promotion: newPromotion(models.PromotionTypeBundle, 300, soda, chips),
+			items:     []promotion.Item{{ProductID: soda, Quantity: 1, UnitPrice: 100}, {ProductID: chips, Quantity: 1, UnitPrice: 100}},
+			expected:  []int32{0, 0},
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			discounts := promotion.Apply(c.promotion, c.items)
+			if !equalDiscounts(discounts, c.expected) {
+				t.Fatalf("expected discounts %v, received %v", c.expected, discounts)
+			}
+		})
+	}
+}
+
+func TestBest(t *testing.T) {
+	t.Parallel()
+	soda := uuid.NewV4()
+	items := []promotion.Item{{ProductID: soda, Quantity: 3, UnitPrice: 100}}
+
+	t.Run("largest discount wins", func(t *testing.T) {
+		percentage := newPromotion(models.PromotionTypePercentage, 10, soda)
+		fixed := newPromotion(models.PromotionTypeFixed, 50, soda)
+		discount := promotion.Best([]*models.Promotion{percentage, fixed}, items, time.Now())
+		if discount.PromotionID != fixed.ID {
+			t.Fatalf("expected promotion %v, received %v", fixed.ID, discount.PromotionID)
+		}
+		if discount.Total != 150 || !equalDiscounts(discount.Items, []int32{150}) {
+			t.Fatalf("expected a discount of 150, received %+v", discount)
+		}
+	})
+	t.Run("ties go to the oldest promotion", func(t *testing.T) {
+		older := newPromotion(models.PromotionTypeFixed, 10, soda)
+		older.CreatedAt = time.Now().Add(-time.Hour)
+		newer := newPromotion(models.PromotionTypePercentage, 10, soda)
+		for _, promotions := range [][]*models.Promotion{{older, newer}, {newer, older}} {
+			discount := promotion.Best(promotions, items, time.Now())
+			if discount.PromotionID != older.ID {
+				t.Fatalf("expected promotion %v, received %v", older.ID, discount.PromotionID)
+			}
+		}
+	})
+	t.Run("no applicable promotion", func(t *testing.T) {
+		other := newPromotion(models.PromotionTypePercentage, 50, uuid.NewV4())
+		discount := promotion.Best([]*models.Promotion{other}, items, time.Now())
+		if discount.PromotionID != uuid.Nil || discount.Total != 0 || !equalDiscounts(discount.Items, []int32{0}) {
+			t.Fatalf("expected no discount, received %+v", discount)
+		}
+	})
+	t.Run("inactive promotions are skipped", func(t *testing.T) {
+		ended := newPromotion(models.PromotionTypePercentage, 50, soda)
+		endsAt := time.Now().Add(-time.Minute)
+		ended.EndsAt = &endsAt
+		discount := promotion.Best([]*models.Promotion{ended}, items, time.Now())
+		if discount.PromotionID != uuid.Nil {
+			t.Fatalf("expected no discount, received %+v", discount)
+		}
+	})
+}
+
+func TestIsActiveAt(t *testing.T) {
+	t.Parallel()
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", "2024-05-01 "+clock)
+		return t
+	}
+	startsAt := at("12:00")
+	endsAt := at("20:00")
+
+	cases := []struct {
+		name     string
+		from     string
+		to       string
+		clock    string
+		expected bool
+	}{
+		{name: "without happy hour", clock: "13:00", expected: true},
+		{name: "inside happy hour", from: "16:00", to: "18:00", clock: "16:00", expected: true},
+		{name: "end of happy hour", from: "16:00", to: "18:00", clock: "18:00", expected: false},
+		{name: "before happy hour", from: "16:00", to: "18:00", clock: "15:59", expected: false},
+		{name: "happy hour past midnight", from: "19:00", to: "02:00", clock: "19:30", expected: true},
+		{name: "outside happy hour past midnight", from: "19:00", to: "02:00", clock: "18:30", expected: false},
+		{name: "before start", clock: "11:59", expected: false},
+		{name: "at end", clock: "20:00", expected: false},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			p := &models.Promotion{StartsAt: &startsAt, EndsAt: &endsAt, HappyHourFrom: c.from, HappyHourTo: c.to}
+			if active := p.IsActiveAt(at(c.clock)); active != c.expected {
+				t.Fatalf("expected active %v at %s, received %v", c.expected, c.clock, active)
+			}
+		})
+	}
+}
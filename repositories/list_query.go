@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// listQuery pages through a table with keyset pagination: rows are ordered by the sort column and then by id,
+// and the cursor holds the sort value and the id of the last row of the previous page. The next page starts after
+// that position, so pages stay consistent while rows are inserted or deleted in between, including the last row
+type listQuery struct {
+	// table is the name of the table, alias its alias in the query
+	table string
+	alias string
+	// sortColumns maps the allowed sort fields to their columns
+	sortColumns map[string]string
+	// defaultSort is the sort field used when none is requested
+	defaultSort string
+}
+
+// selectPage counts the rows matching the filters already applied to the query, then selects the page of
+// rows following the cursor into the model of the query, which must be a pointer to a slice of pointers to
+// structs with an ID field of type uuid.UUID
+func (l *listQuery) selectPage(query *orm.Query, model interface{}, params payloads.ListParams) (payloads.Page, error) {
+	page := payloads.Page{}
+	if !validLimit(params.Limit) {
+		return page, ErrInvalidListParams
+	}
+
+	sort := params.Sort
+	if sort == "" {
+		sort = l.defaultSort
+	}
+	direction, comparison := "ASC", ">"
+	if strings.HasPrefix(sort, "-") {
+		sort = strings.TrimPrefix(sort, "-")
+		direction, comparison = "DESC", "<"
+	}
+	column, ok := l.sortColumns[sort]
+	if !ok {
+		return page, ErrInvalidListParams
+	}
+
+	total, err := query.Count()
+	if err != nil {
+		return page, err
+	}
+	page.Total = total
+
+	field, ok := query.TableModel().Table().FieldsMap[column]
+	if !ok {
+		return page, fmt.Errorf("%s has no column %s", l.table, column)
+	}
+	if params.Cursor != "" {
+		key, cursorID, err := decodeCursor(params.Cursor, params.Sort)
+		if err != nil || !cursorKeyMatches(key, field.Type.Kind()) {
+			return page, ErrInvalidListParams
+		}
+		query = query.Where(fmt.Sprintf("(%s.%s, %s.id) %s (?, ?)", l.alias, column, l.alias, comparison), key, cursorID)
+	}
+
+	err = query.
+		OrderExpr(fmt.Sprintf("%s.%s %s, %s.id %s", l.alias, column, direction, l.alias, direction)).
+		Limit(params.Limit + 1).
+		Select()
+	if err != nil && err != pg.ErrNoRows {
+		return page, err
+	}
+
+	rows := reflect.ValueOf(model).Elem()
+	if rows.Len() > params.Limit {
+		rows.SetLen(params.Limit)
+		last := rows.Index(params.Limit - 1).Elem()
+		lastID := last.FieldByName("ID").Interface().(uuid.UUID)
+		page.NextCursor = encodeCursor(params.Sort, field.Value(last).Interface(), lastID)
+	}
+	return page, nil
+}
+
+// validLimit returns true if the page size is one the list endpoints accept, the stores check it themselves since
+// not every caller parses the params from a request
+func validLimit(limit int) bool {
+	return limit >= 1 && limit <= payloads.MaxListLimit
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, so that the value only matches itself
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// listCursor is the position of the last row of a page: the sort it was listed with, the value of its sort field
+// and its id. Integer sort values are kept as int64, like the sort keys of memoryRow
+type listCursor struct {
+	Sort string      `json:"s"`
+	Key  interface{} `json:"k"`
+	ID   uuid.UUID   `json:"id"`
+}
+
+func encodeCursor(sort string, key interface{}, id uuid.UUID) string {
+	value := reflect.ValueOf(key)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		key = value.Int()
+	}
+	b, _ := json.Marshal(&listCursor{Sort: sort, Key: key, ID: id})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns the sort value and the id of the cursor, which must have been made for the same sort
+func decodeCursor(cursor string, sort string) (interface{}, uuid.UUID, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	c := &listCursor{}
+	if err := decoder.Decode(c); err != nil {
+		return nil, uuid.Nil, err
+	}
+	if c.Sort != sort {
+		return nil, uuid.Nil, fmt.Errorf("cursor was made for sort %q", c.Sort)
+	}
+	switch key := c.Key.(type) {
+	case string:
+		return key, c.ID, nil
+	case json.Number:
+		n, err := key.Int64()
+		return n, c.ID, err
+	default:
+		return nil, uuid.Nil, fmt.Errorf("cursor has an invalid sort value")
+	}
+}
+
+// cursorKeyMatches returns true if the sort value of a cursor can be compared with a column of the kind
+func cursorKeyMatches(key interface{}, kind reflect.Kind) bool {
+	switch key.(type) {
+	case string:
+		return kind == reflect.String
+	case int64:
+		return kind >= reflect.Int && kind <= reflect.Int64
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memoryCategoryRepository is the CategoryRepository kept in a MemoryStore
+type memoryCategoryRepository struct {
+	session *memorySession
+}
+
+// GetByID returns the category by id
+func (r *memoryCategoryRepository) GetByID(categoryID uuid.UUID) (*models.Category, error) {
+	category := &models.Category{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.categories[categoryID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		category = copyCategory(stored)
+		return nil
+	})
+	return category, err
+}
+
+// List returns all categories ordered by name ignoring case
+func (r *memoryCategoryRepository) List() ([]*models.Category, error) {
+	categories := make([]*models.Category, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for _, category := range d.categories {
+			categories = append(categories, copyCategory(category))
+		}
+		return nil
+	})
+	if err != nil {
+		return categories, err
+	}
+
+	sort.Slice(categories, func(a, b int) bool {
+		return strings.ToLower(categories[a].Name) < strings.ToLower(categories[b].Name)
+	})
+	return categories, nil
+}
+
+// LockTree does nothing, the transaction holds the whole store already
+func (r *memoryCategoryRepository) LockTree() error {
+	return nil
+}
+
+// Insert adds the category, ErrConflict is returned if its parent has a category with the same name
+func (r *memoryCategoryRepository) Insert(category *models.Category) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.categories[category.ID]; ok {
+			return ErrConflict
+		}
+		if err := checkCategory(d, category); err != nil {
+			return err
+		}
+		if category.CreatedAt.IsZero() {
+			category.CreatedAt = time.Now()
+		}
+		d.categories[category.ID] = copyCategory(category)
+		return nil
+	})
+}
+
+// Update writes the name and the parent of the category
+func (r *memoryCategoryRepository) Update(category *models.Category) error {
+	return r.session.write(func(d *memoryData) error {
+		stored, ok := d.categories[category.ID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		if err := checkCategory(d, category); err != nil {
+			return err
+		}
+		stored.Name = category.Name
+		stored.ParentID = category.ParentID
+		category.CreatedAt = stored.CreatedAt
+		return nil
+	})
+}
+
+// Delete deletes the category by id, leaving its products without a category. ErrReferenced is returned if it
+// has subcategories
+func (r *memoryCategoryRepository) Delete(categoryID uuid.UUID) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.categories[categoryID]; !ok {
+			return db.ErrNoMatch
+		}
+		for _, category := range d.categories {
+			if category.ParentID == categoryID {
+				return ErrReferenced
+			}
+		}
+		delete(d.categories, categoryID)
+		for _, product := range d.products {
+			if product.CategoryID == categoryID {
+				product.CategoryID = uuid.Nil
+			}
+		}
+		return nil
+	})
+}
+
+// checkCategory stands in for the foreign key to the parent and the unique index on the names of the children of
+// a parent, which ignores case
+func checkCategory(d *memoryData, category *models.Category) error {
+	if category.ParentID != uuid.Nil {
+		if _, ok := d.categories[category.ParentID]; !ok {
+			return ErrReferenced
+		}
+	}
+	for _, stored := range d.categories {
+		if stored.ID != category.ID && stored.ParentID == category.ParentID &&
+			strings.EqualFold(stored.Name, category.Name) {
+			return ErrConflict
+		}
+	}
+	return nil
+}
+
+// subcategoryIDs returns the ids of the category and all categories below it
+func subcategoryIDs(d *memoryData, categoryID uuid.UUID) map[uuid.UUID]bool {
+	ids := make(map[uuid.UUID]bool)
+	if _, ok := d.categories[categoryID]; !ok {
+		return ids
+	}
+	ids[categoryID] = true
+	for added := true; added; {
+		added = false
+		for _, category := range d.categories {
+			if !ids[category.ID] && ids[category.ParentID] {
+				ids[category.ID] = true
+				added = true
+			}
+		}
+	}
+	return ids
+}
+
+// copyCategory copies the columns of the category, leaving out its children
+func copyCategory(category *models.Category) *models.Category {
+	c := *category
+	c.Children = nil
+	return &c
+}
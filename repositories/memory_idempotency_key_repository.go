@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memoryIdempotencyKeyRepository is the IdempotencyKeyRepository kept in a MemoryStore
+type memoryIdempotencyKeyRepository struct {
+	session *memorySession
+}
+
+// Get returns the idempotency key of the user
+func (r *memoryIdempotencyKeyRepository) Get(userID uuid.UUID, key string) (*models.IdempotencyKey, error) {
+	idempotencyKey := &models.IdempotencyKey{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.idempotencyKeys[memoryIdempotencyKey{userID: userID, key: key}]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		idempotencyKey = copyIdempotencyKey(stored)
+		return nil
+	})
+	return idempotencyKey, err
+}
+
+// Insert claims the key, returning false if the user claimed it already
+func (r *memoryIdempotencyKeyRepository) Insert(idempotencyKey *models.IdempotencyKey) (bool, error) {
+	inserted := false
+	err := r.session.write(func(d *memoryData) error {
+		key := memoryIdempotencyKey{userID: idempotencyKey.UserID, key: idempotencyKey.IdempotencyKey}
+		if _, ok := d.idempotencyKeys[key]; ok {
+			return nil
+		}
+		if _, ok := d.users[idempotencyKey.UserID]; !ok {
+			return ErrReferenced
+		}
+		if idempotencyKey.CreatedAt.IsZero() {
+			idempotencyKey.CreatedAt = time.Now()
+		}
+		d.idempotencyKeys[key] = copyIdempotencyKey(idempotencyKey)
+		inserted = true
+		return nil
+	})
+	return inserted, err
+}
+
+// Complete stores the response of the key
+func (r *memoryIdempotencyKeyRepository) Complete(idempotencyKey *models.IdempotencyKey) error {
+	return r.session.write(func(d *memoryData) error {
+		stored, ok := d.idempotencyKeys[memoryIdempotencyKey{userID: idempotencyKey.UserID, key: idempotencyKey.IdempotencyKey}]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		completedAt := time.Now()
+		stored.Status = idempotencyKey.Status
+		stored.ContentType = idempotencyKey.ContentType
+		stored.Body = append([]byte(nil), idempotencyKey.Body...)
+		stored.CompletedAt = &completedAt
+		idempotencyKey.CompletedAt = copyTime(&completedAt)
+		return nil
+	})
+}
+
+// Delete deletes the idempotency key of the user
+func (r *memoryIdempotencyKeyRepository) Delete(userID uuid.UUID, key string) error {
+	return r.session.write(func(d *memoryData) error {
+		delete(d.idempotencyKeys, memoryIdempotencyKey{userID: userID, key: key})
+		return nil
+	})
+}
+
+// DeleteCreatedBefore deletes the keys of the user created before the time
+func (r *memoryIdempotencyKeyRepository) DeleteCreatedBefore(userID uuid.UUID, before time.Time) error {
+	return r.session.write(func(d *memoryData) error {
+		for key, idempotencyKey := range d.idempotencyKeys {
+			if key.userID == userID && idempotencyKey.CreatedAt.Before(before) {
+				delete(d.idempotencyKeys, key)
+			}
+		}
+		return nil
+	})
+}
+
+// copyIdempotencyKey copies the key with its response
+func copyIdempotencyKey(idempotencyKey *models.IdempotencyKey) *models.IdempotencyKey {
+	c := *idempotencyKey
+	if idempotencyKey.Body != nil {
+		c.Body = append([]byte{}, idempotencyKey.Body...)
+	}
+	c.CompletedAt = copyTime(idempotencyKey.CompletedAt)
+	return &c
+}
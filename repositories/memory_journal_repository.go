@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memoryJournalRepository is the JournalRepository kept in a MemoryStore
+type memoryJournalRepository struct {
+	session *memorySession
+}
+
+// GetAccount returns the account of the type and owner
+func (r *memoryJournalRepository) GetAccount(accountType models.AccountType, ownerID uuid.UUID) (*models.Account, error) {
+	account := &models.Account{}
+	err := r.session.read(func(d *memoryData) error {
+		stored := findAccount(d, accountType, ownerID)
+		if stored == nil {
+			return db.ErrNoMatch
+		}
+		copied := *stored
+		account = &copied
+		return nil
+	})
+	return account, err
+}
+
+// GetOrCreateAccount returns the account of the type and owner, creating it if it does not exist yet
+func (r *memoryJournalRepository) GetOrCreateAccount(accountType models.AccountType, ownerID uuid.UUID) (*models.Account, error) {
+	account := &models.Account{}
+	err := r.session.write(func(d *memoryData) error {
+		stored := findAccount(d, accountType, ownerID)
+		if stored == nil {
+			stored = &models.Account{ID: uuid.NewV4(), Type: accountType, OwnerID: ownerID, CreatedAt: time.Now()}
+			d.accounts[stored.ID] = stored
+		}
+		copied := *stored
+		account = &copied
+		return nil
+	})
+	return account, err
+}
+
+// InsertTransaction appends the transaction with its entries and adds them to the balances of their accounts
+func (r *memoryJournalRepository) InsertTransaction(transaction *models.JournalTransaction) error {
+	return r.session.write(func(d *memoryData) error {
+		for _, entry := range transaction.Entries {
+			if entry.Amount == 0 {
+				return fmt.Errorf("entry %s of transaction %s has no amount", entry.ID, transaction.ID)
+			}
+			if _, ok := d.accounts[entry.AccountID]; !ok {
+				return ErrReferenced
+			}
+		}
+
+		now := time.Now()
+		if transaction.CreatedAt.IsZero() {
+			transaction.CreatedAt = now
+		}
+		stored := *transaction
+		stored.Entries = nil
+		d.journalTransactions = append(d.journalTransactions, &stored)
+		for _, entry := range transaction.Entries {
+			d.accounts[entry.AccountID].Balance += entry.Amount
+			if entry.CreatedAt.IsZero() {
+				entry.CreatedAt = now
+			}
+			copied := *entry
+			d.journalEntries = append(d.journalEntries, &copied)
+		}
+		return nil
+	})
+}
+
+// ListRevenueEntries returns the latest entries of the account with the transactions they belong to
+func (r *memoryJournalRepository) ListRevenueEntries(accountID uuid.UUID, limit int) ([]*payloads.RevenueEntry, error) {
+	entries := make([]*payloads.RevenueEntry, 0)
+	err := r.session.read(func(d *memoryData) error {
+		transactions := make(map[uuid.UUID]*models.JournalTransaction, len(d.journalTransactions))
+		for _, transaction := range d.journalTransactions {
+			transactions[transaction.ID] = transaction
+		}
+		// the entries are appended in the order they are created, so the latest come last
+		for i := len(d.journalEntries) - 1; i >= 0 && len(entries) < limit; i-- {
+			entry := d.journalEntries[i]
+			if entry.AccountID != accountID {
+				continue
+			}
+			transaction := transactions[entry.TransactionID]
+			entries = append(entries, &payloads.RevenueEntry{
+				TransactionID: entry.TransactionID,
+				Kind:          transaction.Kind,
+				ReferenceID:   transaction.ReferenceID,
+				Amount:        -entry.Amount,
+				CreatedAt:     entry.CreatedAt,
+			})
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Reconcile compares the deposits with the wallets, and the transactions and the accounts with their entries
+func (r *memoryJournalRepository) Reconcile() (*payloads.Reconciliation, error) {
+	reconciliation := &payloads.Reconciliation{
+		DepositMismatches:      make([]*payloads.DepositMismatch, 0),
+		UnbalancedTransactions: make([]uuid.UUID, 0),
+		MisstatedAccounts:      make([]uuid.UUID, 0),
+	}
+	err := r.session.read(func(d *memoryData) error {
+		for _, user := range d.users {
+			var walletBalance int64
+			if wallet := findAccount(d, models.AccountTypeBuyerWallet, user.ID); wallet != nil {
+				walletBalance = -wallet.Balance
+			}
+			if int64(user.Deposit) != walletBalance {
+				reconciliation.DepositMismatches = append(reconciliation.DepositMismatches, &payloads.DepositMismatch{
+					UserID:        user.ID,
+					Deposit:       int64(user.Deposit),
+					WalletBalance: walletBalance,
+				})
+			}
+		}
+
+		transactionSums := make(map[uuid.UUID]int64)
+		accountSums := make(map[uuid.UUID]int64)
+		for _, entry := range d.journalEntries {
+			transactionSums[entry.TransactionID] += entry.Amount
+			accountSums[entry.AccountID] += entry.Amount
+		}
+		for transactionID, sum := range transactionSums {
+			if sum != 0 {
+				reconciliation.UnbalancedTransactions = append(reconciliation.UnbalancedTransactions, transactionID)
+			}
+		}
+		for accountID, account := range d.accounts {
+			if account.Balance != accountSums[accountID] {
+				reconciliation.MisstatedAccounts = append(reconciliation.MisstatedAccounts, accountID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return reconciliation, err
+	}
+
+	sort.Slice(reconciliation.DepositMismatches, func(a, b int) bool {
+		return bytes.Compare(reconciliation.DepositMismatches[a].UserID.Bytes(), reconciliation.DepositMismatches[b].UserID.Bytes()) < 0
+	})
+	sortUUIDs(reconciliation.UnbalancedTransactions)
+	sortUUIDs(reconciliation.MisstatedAccounts)
+	return reconciliation, nil
+}
+
+// findAccount returns the account of the type and owner, or nil
+func findAccount(d *memoryData, accountType models.AccountType, ownerID uuid.UUID) *models.Account {
+	for _, account := range d.accounts {
+		if account.Type == accountType && account.OwnerID == ownerID {
+			return account
+		}
+	}
+	return nil
+}
+
+// sortUUIDs sorts the ids by their bytes, like Postgres orders uuid columns
+func sortUUIDs(ids []uuid.UUID) {
+	sort.Slice(ids, func(a, b int) bool {
+		return bytes.Compare(ids[a].Bytes(), ids[b].Bytes()) < 0
+	})
+}
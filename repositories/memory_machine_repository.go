@@ -0,0 +1,270 @@
+package repositories
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memoryMachineRepository is the MachineRepository kept in a MemoryStore
+type memoryMachineRepository struct {
+	session *memorySession
+}
+
+// GetByID returns the machine by id, without its slots
+func (r *memoryMachineRepository) GetByID(machineID uuid.UUID) (*models.Machine, error) {
+	machine := &models.Machine{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.machines[machineID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		machine = copyMachine(stored)
+		return nil
+	})
+	return machine, err
+}
+
+// GetWithSlots returns the machine by id with its slots and the products they hold
+func (r *memoryMachineRepository) GetWithSlots(machineID uuid.UUID) (*models.Machine, error) {
+	machine := &models.Machine{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.machines[machineID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		machine = copyMachine(stored)
+		machine.Slots = listSlots(d, machineID)
+		return nil
+	})
+	return machine, err
+}
+
+// GetForUpdate returns the machine by id, the transaction holds the whole store already
+func (r *memoryMachineRepository) GetForUpdate(machineID uuid.UUID) (*models.Machine, error) {
+	return r.GetByID(machineID)
+}
+
+// List returns all machines, oldest first
+func (r *memoryMachineRepository) List() ([]*models.Machine, error) {
+	machines := make([]*models.Machine, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for _, machine := range d.machines {
+			machines = append(machines, copyMachine(machine))
+		}
+		return nil
+	})
+	if err != nil {
+		return machines, err
+	}
+
+	sort.Slice(machines, func(a, b int) bool {
+		return machines[a].CreatedAt.Before(machines[b].CreatedAt)
+	})
+	return machines, nil
+}
+
+// Insert adds the machine, filling in its creation time
+func (r *memoryMachineRepository) Insert(machine *models.Machine) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.machines[machine.ID]; ok {
+			return ErrConflict
+		}
+		if machine.CreatedAt.IsZero() {
+			machine.CreatedAt = time.Now()
+		}
+		d.machines[machine.ID] = copyMachine(machine)
+		return nil
+	})
+}
+
+// memorySlotRepository is the SlotRepository kept in a MemoryStore
+type memorySlotRepository struct {
+	session *memorySession
+}
+
+// List returns the slots of the machine ordered by code, with the products they hold
+func (r *memorySlotRepository) List(machineID uuid.UUID) ([]*models.Slot, error) {
+	slots := make([]*models.Slot, 0)
+	err := r.session.read(func(d *memoryData) error {
+		slots = listSlots(d, machineID)
+		return nil
+	})
+	return slots, err
+}
+
+// ListProductForUpdate returns the slots of the machine holding the product ordered by code
+func (r *memorySlotRepository) ListProductForUpdate(machineID uuid.UUID, productID uuid.UUID) ([]*models.Slot, error) {
+	slots := make([]*models.Slot, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for _, slot := range d.slots {
+			if slot.MachineID == machineID && slot.ProductID == productID {
+				slots = append(slots, copySlot(slot))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return slots, err
+	}
+
+	sort.Slice(slots, func(a, b int) bool {
+		return slots[a].Code < slots[b].Code
+	})
+	return slots, nil
+}
+
+// GetByCodeForUpdate returns the slot of the machine with the code
+func (r *memorySlotRepository) GetByCodeForUpdate(machineID uuid.UUID, code string) (*models.Slot, error) {
+	slot := &models.Slot{}
+	err := r.session.read(func(d *memoryData) error {
+		stored := findSlot(d, machineID, code)
+		if stored == nil {
+			return db.ErrNoMatch
+		}
+		slot = copySlot(stored)
+		return nil
+	})
+	return slot, err
+}
+
+// Upsert puts the slot into its machine, replacing the slot with the same code and reading back its id
+func (r *memorySlotRepository) Upsert(slot *models.Slot) error {
+	if err := checkSlotQuantity(slot); err != nil {
+		return err
+	}
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.machines[slot.MachineID]; !ok {
+			return ErrReferenced
+		}
+		if stored := findSlot(d, slot.MachineID, slot.Code); stored != nil {
+			slot.ID = stored.ID
+		} else if slot.ID == uuid.Nil {
+			slot.ID = uuid.NewV4()
+		}
+		d.slots[slot.ID] = copySlot(slot)
+		return nil
+	})
+}
+
+// SetQuantity writes the quantity of the slot
+func (r *memorySlotRepository) SetQuantity(slot *models.Slot) error {
+	return r.session.write(func(d *memoryData) error {
+		stored, ok := d.slots[slot.ID]
+		if !ok {
+			return nil
+		}
+		if slot.Quantity < 0 || slot.Quantity > stored.Capacity {
+			return fmt.Errorf("quantity %d of slot %s is outside of 0 to %d", slot.Quantity, stored.Code, stored.Capacity)
+		}
+		stored.Quantity = slot.Quantity
+		return nil
+	})
+}
+
+// listSlots returns the slots of the machine ordered by code, with the products they hold
+func listSlots(d *memoryData, machineID uuid.UUID) []*models.Slot {
+	slots := make([]*models.Slot, 0)
+	for _, stored := range d.slots {
+		if stored.MachineID != machineID {
+			continue
+		}
+		slot := copySlot(stored)
+		if product, ok := d.products[slot.ProductID]; ok {
+			slot.Product = copyProduct(product)
+		}
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(a, b int) bool {
+		return slots[a].Code < slots[b].Code
+	})
+	return slots
+}
+
+// findSlot returns the slot of the machine with the code, or nil
+func findSlot(d *memoryData, machineID uuid.UUID, code string) *models.Slot {
+	for _, slot := range d.slots {
+		if slot.MachineID == machineID && slot.Code == code {
+			return slot
+		}
+	}
+	return nil
+}
+
+// checkSlotQuantity stands in for the check constraints of the slots table
+func checkSlotQuantity(slot *models.Slot) error {
+	if slot.Capacity <= 0 {
+		return fmt.Errorf("capacity %d of slot %s is not positive", slot.Capacity, slot.Code)
+	}
+	if slot.Quantity < 0 || slot.Quantity > slot.Capacity {
+		return fmt.Errorf("quantity %d of slot %s is outside of 0 to %d", slot.Quantity, slot.Code, slot.Capacity)
+	}
+	return nil
+}
+
+// copyMachine copies the columns of the machine, leaving out its slots
+func copyMachine(machine *models.Machine) *models.Machine {
+	c := *machine
+	c.Slots = nil
+	return &c
+}
+
+// copySlot copies the columns of the slot, leaving out its product
+func copySlot(slot *models.Slot) *models.Slot {
+	c := *slot
+	c.Product = nil
+	return &c
+}
+
+// memoryCoinRepository is the CoinRepository kept in a MemoryStore
+type memoryCoinRepository struct {
+	session *memorySession
+}
+
+// List returns the coins of the machine, highest denomination first
+func (r *memoryCoinRepository) List(machineID uuid.UUID) ([]*models.CoinInventory, error) {
+	coins := make([]*models.CoinInventory, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for key, coin := range d.coins {
+			if key.machineID == machineID {
+				copied := *coin
+				coins = append(coins, &copied)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return coins, err
+	}
+
+	sort.Slice(coins, func(a, b int) bool {
+		return coins[a].Denomination > coins[b].Denomination
+	})
+	return coins, nil
+}
+
+// ListForUpdate returns the coins of the machine, the transaction holds the whole store already
+func (r *memoryCoinRepository) ListForUpdate(machineID uuid.UUID) ([]*models.CoinInventory, error) {
+	return r.List(machineID)
+}
+
+// Add adds the coins to the tube of the denomination in the machine, creating it if it does not exist
+func (r *memoryCoinRepository) Add(machineID uuid.UUID, denomination int32, count int32) error {
+	return r.session.write(func(d *memoryData) error {
+		key := memoryCoinKey{machineID: machineID, denomination: denomination}
+		coin, ok := d.coins[key]
+		if !ok {
+			coin = &models.CoinInventory{MachineID: machineID, Denomination: denomination}
+		}
+		if coin.Count+count < 0 {
+			return fmt.Errorf("machine %s has %d coins of %d, cannot take %d", machineID, coin.Count, denomination, -count)
+		}
+		coin.Count += count
+		d.coins[key] = coin
+		return nil
+	})
+}
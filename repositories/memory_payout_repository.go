@@ -0,0 +1,184 @@
+package repositories
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memoryPayoutRepository is the PayoutRepository kept in a MemoryStore
+type memoryPayoutRepository struct {
+	session *memorySession
+}
+
+// GetByID returns the payout by id
+func (r *memoryPayoutRepository) GetByID(payoutID uuid.UUID) (*models.Payout, error) {
+	payout := &models.Payout{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.payouts[payoutID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		copied := *stored
+		payout = &copied
+		return nil
+	})
+	return payout, err
+}
+
+// GetForUpdate returns the payout by id, the transaction holds the whole store already
+func (r *memoryPayoutRepository) GetForUpdate(payoutID uuid.UUID) (*models.Payout, error) {
+	return r.GetByID(payoutID)
+}
+
+// List returns the payouts of the seller, or all payouts for uuid.Nil, newest first
+func (r *memoryPayoutRepository) List(sellerID uuid.UUID) ([]*models.Payout, error) {
+	payouts := make([]*models.Payout, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for _, payout := range d.payouts {
+			if sellerID == uuid.Nil || payout.SellerID == sellerID {
+				copied := *payout
+				payouts = append(payouts, &copied)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return payouts, err
+	}
+
+	sort.Slice(payouts, func(a, b int) bool {
+		if !payouts[a].CreatedAt.Equal(payouts[b].CreatedAt) {
+			return payouts[a].CreatedAt.After(payouts[b].CreatedAt)
+		}
+		return payouts[a].ID.String() > payouts[b].ID.String()
+	})
+	return payouts, nil
+}
+
+// HasRequested returns true if the seller has a payout waiting for approval
+func (r *memoryPayoutRepository) HasRequested(sellerID uuid.UUID) (bool, error) {
+	requested := false
+	err := r.session.read(func(d *memoryData) error {
+		for _, payout := range d.payouts {
+			if payout.SellerID == sellerID && payout.Status == models.PayoutStatusRequested {
+				requested = true
+			}
+		}
+		return nil
+	})
+	return requested, err
+}
+
+// ListUnpaidSales returns the completed and failed purchases of the seller that no payout includes, except rejected
+// ones, with their id, total and platform fee
+func (r *memoryPayoutRepository) ListUnpaidSales(sellerID uuid.UUID) ([]*models.Purchase, error) {
+	sales := make([]*models.Purchase, 0)
+	err := r.session.read(func(d *memoryData) error {
+		paid := make(map[uuid.UUID]bool)
+		for _, item := range d.payoutItems {
+			if payout, ok := d.payouts[item.PayoutID]; ok && payout.Status != models.PayoutStatusRejected {
+				paid[item.PurchaseID] = true
+			}
+		}
+		for _, purchase := range d.purchases {
+			if purchase.SellerID != sellerID || paid[purchase.ID] {
+				continue
+			}
+			if purchase.Status != models.PurchaseStatusCompleted && purchase.Status != models.PurchaseStatusFailed {
+				continue
+			}
+			sales = append(sales, &models.Purchase{
+				ID:          purchase.ID,
+				Total:       purchase.Total,
+				PlatformFee: purchase.PlatformFee,
+			})
+		}
+		return nil
+	})
+	return sales, err
+}
+
+// Insert adds the payout with its items, filling in its creation time
+func (r *memoryPayoutRepository) Insert(payout *models.Payout, purchaseIDs []uuid.UUID) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.payouts[payout.ID]; ok {
+			return ErrConflict
+		}
+		if _, ok := d.users[payout.SellerID]; !ok {
+			return ErrReferenced
+		}
+		for _, purchaseID := range purchaseIDs {
+			if _, ok := d.purchases[purchaseID]; !ok {
+				return ErrReferenced
+			}
+		}
+		if payout.Status == "" {
+			payout.Status = models.PayoutStatusRequested
+		}
+		if payout.CreatedAt.IsZero() {
+			payout.CreatedAt = time.Now()
+		}
+		copied := *payout
+		d.payouts[payout.ID] = &copied
+		for _, purchaseID := range purchaseIDs {
+			d.payoutItems = append(d.payoutItems, &models.PayoutItem{PayoutID: payout.ID, PurchaseID: purchaseID})
+		}
+		return nil
+	})
+}
+
+// UpdateDecision writes the decision on the payout
+func (r *memoryPayoutRepository) UpdateDecision(payout *models.Payout) error {
+	return r.session.write(func(d *memoryData) error {
+		stored, ok := d.payouts[payout.ID]
+		if !ok {
+			return nil
+		}
+		stored.Status = payout.Status
+		stored.ProviderReference = payout.ProviderReference
+		stored.Note = payout.Note
+		stored.DecidedBy = payout.DecidedBy
+		stored.DecidedAt = copyTime(payout.DecidedAt)
+		return nil
+	})
+}
+
+// ListSales returns the purchases that are items of the payout with their net revenue, oldest first
+func (r *memoryPayoutRepository) ListSales(payoutID uuid.UUID) ([]*payloads.PayoutSale, error) {
+	sales := make([]*payloads.PayoutSale, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for _, item := range d.payoutItems {
+			if item.PayoutID != payoutID {
+				continue
+			}
+			purchase := d.purchases[item.PurchaseID]
+			sales = append(sales, &payloads.PayoutSale{
+				PurchaseID:  purchase.ID,
+				ProductID:   purchase.ProductID,
+				RefundOf:    purchase.RefundOf,
+				Quantity:    purchase.Quantity,
+				Total:       purchase.Total,
+				PlatformFee: purchase.PlatformFee,
+				Net:         purchase.Total - purchase.PlatformFee,
+				CreatedAt:   purchase.CreatedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return sales, err
+	}
+
+	sort.Slice(sales, func(a, b int) bool {
+		if !sales[a].CreatedAt.Equal(sales[b].CreatedAt) {
+			return sales[a].CreatedAt.Before(sales[b].CreatedAt)
+		}
+		return sales[a].PurchaseID.String() < sales[b].PurchaseID.String()
+	})
+	return sales, nil
+}
@@ -0,0 +1,160 @@
+package repositories
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memoryPriceRepository is the PriceRepository kept in a MemoryStore
+type memoryPriceRepository struct {
+	session *memorySession
+}
+
+// List returns the prices of the product, oldest first
+func (r *memoryPriceRepository) List(productID uuid.UUID) ([]*models.ProductPrice, error) {
+	return r.list(func(price *models.ProductPrice) bool {
+		return price.ProductID == productID
+	})
+}
+
+// GetAt returns the price of the product effective at the time
+func (r *memoryPriceRepository) GetAt(productID uuid.UUID, at time.Time) (*models.ProductPrice, error) {
+	prices, err := r.list(func(price *models.ProductPrice) bool {
+		return price.ProductID == productID && price.IsEffectiveAt(at)
+	})
+	if err != nil {
+		return &models.ProductPrice{}, err
+	}
+	if len(prices) == 0 {
+		return &models.ProductPrice{}, db.ErrNoMatch
+	}
+	return prices[0], nil
+}
+
+// ListBetween returns the prices of the product effective at any time from from until to, oldest first
+func (r *memoryPriceRepository) ListBetween(productID uuid.UUID, from time.Time, to time.Time) ([]*models.ProductPrice, error) {
+	return r.list(func(price *models.ProductPrice) bool {
+		return price.ProductID == productID && !price.EffectiveFrom.After(to) &&
+			(price.EffectiveTo == nil || price.EffectiveTo.After(from))
+	})
+}
+
+// ListScheduled returns the prices of the products that become effective after the time
+func (r *memoryPriceRepository) ListScheduled(productIDs []uuid.UUID, after time.Time) ([]*models.ProductPrice, error) {
+	prices, err := r.list(func(price *models.ProductPrice) bool {
+		return containsUUID(productIDs, price.ProductID) && price.EffectiveFrom.After(after)
+	})
+	if err != nil {
+		return prices, err
+	}
+
+	sort.SliceStable(prices, func(a, b int) bool {
+		return bytes.Compare(prices[a].ProductID.Bytes(), prices[b].ProductID.Bytes()) < 0
+	})
+	return prices, nil
+}
+
+// Insert adds the price, filling in its creation time
+func (r *memoryPriceRepository) Insert(price *models.ProductPrice) error {
+	if err := checkPrice(price); err != nil {
+		return err
+	}
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.prices[price.ID]; ok {
+			return ErrConflict
+		}
+		if _, ok := d.products[price.ProductID]; !ok {
+			return ErrReferenced
+		}
+		if price.CreatedAt.IsZero() {
+			price.CreatedAt = time.Now()
+		}
+		copied := *price
+		d.prices[price.ID] = &copied
+		return nil
+	})
+}
+
+// Update writes the cost, the end and the creator of the price
+func (r *memoryPriceRepository) Update(price *models.ProductPrice) error {
+	return r.session.write(func(d *memoryData) error {
+		stored, ok := d.prices[price.ID]
+		if !ok {
+			return nil
+		}
+		updated := *stored
+		updated.Cost = price.Cost
+		updated.EffectiveTo = copyTime(price.EffectiveTo)
+		updated.CreatedBy = price.CreatedBy
+		if err := checkPrice(&updated); err != nil {
+			return err
+		}
+		d.prices[price.ID] = &updated
+		return nil
+	})
+}
+
+// Delete deletes the price by id
+func (r *memoryPriceRepository) Delete(priceID uuid.UUID) error {
+	return r.session.write(func(d *memoryData) error {
+		delete(d.prices, priceID)
+		return nil
+	})
+}
+
+// ActivatePrices sets the cost of the products whose price effective at the time differs from it
+func (r *memoryPriceRepository) ActivatePrices(at time.Time) (int, error) {
+	activated := 0
+	err := r.session.write(func(d *memoryData) error {
+		for _, price := range d.prices {
+			if !price.IsEffectiveAt(at) {
+				continue
+			}
+			if product, ok := d.products[price.ProductID]; ok && product.Cost != price.Cost {
+				product.Cost = price.Cost
+				activated++
+			}
+		}
+		return nil
+	})
+	return activated, err
+}
+
+// list returns the prices matching the predicate, oldest first
+func (r *memoryPriceRepository) list(matches func(price *models.ProductPrice) bool) ([]*models.ProductPrice, error) {
+	prices := make([]*models.ProductPrice, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for _, price := range d.prices {
+			if matches(price) {
+				copied := *price
+				prices = append(prices, &copied)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return prices, err
+	}
+
+	sort.Slice(prices, func(a, b int) bool {
+		return prices[a].EffectiveFrom.Before(prices[b].EffectiveFrom)
+	})
+	return prices, nil
+}
+
+// checkPrice stands in for the check constraints of the product_prices table
+func checkPrice(price *models.ProductPrice) error {
+	if price.Cost <= 0 {
+		return fmt.Errorf("cost %d of price %s is not positive", price.Cost, price.ID)
+	}
+	if price.EffectiveTo != nil && !price.EffectiveTo.After(price.EffectiveFrom) {
+		return fmt.Errorf("price %s ends before it starts", price.ID)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package repositories
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memoryProductListQuery pages through products in memory, sorted by name by default
+var memoryProductListQuery = &memoryListQuery{
+	sortFields:  map[string]bool{"name": true, "cost": true},
+	defaultSort: "name",
+}
+
+// memoryProductRepository is the ProductRepository kept in a MemoryStore
+type memoryProductRepository struct {
+	session *memorySession
+}
+
+// GetByID returns the product by id
+func (r *memoryProductRepository) GetByID(productID uuid.UUID) (*models.Product, error) {
+	product := &models.Product{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.products[productID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		product = copyProduct(stored)
+		return nil
+	})
+	return product, err
+}
+
+// GetForUpdate returns the product by id, the transaction holds the whole store already
+func (r *memoryProductRepository) GetForUpdate(productID uuid.UUID) (*models.Product, error) {
+	return r.GetByID(productID)
+}
+
+// List returns the page of products matching the filter with the pagination details
+func (r *memoryProductRepository) List(filter *payloads.ProductFilter) ([]*models.Product, payloads.Page, error) {
+	products := make([]*models.Product, 0)
+	var page payloads.Page
+	err := r.session.read(func(d *memoryData) error {
+		var categoryIDs map[uuid.UUID]bool
+		if filter.CategoryID != uuid.Nil {
+			categoryIDs = subcategoryIDs(d, filter.CategoryID)
+		}
+		rows := make([]*memoryRow, 0, len(d.products))
+		for _, product := range d.products {
+			matches := productMatches(product, filter)
+			if matches && filter.InStock {
+				matches = productInStock(d, product.ID)
+			}
+			if matches && categoryIDs != nil {
+				matches = categoryIDs[product.CategoryID]
+			}
+			rows = append(rows, &memoryRow{
+				id:      product.ID,
+				keys:    map[string]interface{}{"name": product.Name, "cost": int64(product.Cost)},
+				matches: matches,
+			})
+		}
+
+		ids, p, err := memoryProductListQuery.selectPage(rows, filter.ListParams)
+		if err != nil {
+			return err
+		}
+		page = p
+		for _, id := range ids {
+			products = append(products, copyProduct(d.products[id]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, page, err
+	}
+	return products, page, nil
+}
+
+// productMatches returns true if the product matches the name, cost, seller and tags of the filter
+func productMatches(product *models.Product, filter *payloads.ProductFilter) bool {
+	if filter.Name != "" && !containsFold(product.Name, filter.Name) {
+		return false
+	}
+	if filter.MinCost != nil && product.Cost < *filter.MinCost {
+		return false
+	}
+	if filter.MaxCost != nil && product.Cost > *filter.MaxCost {
+		return false
+	}
+	if filter.SellerID != uuid.Nil && product.SellerID != filter.SellerID {
+		return false
+	}
+	for _, tag := range filter.Tags {
+		if !containsString(product.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// productInStock returns true if a slot of any machine holds the product
+func productInStock(d *memoryData, productID uuid.UUID) bool {
+	for _, slot := range d.slots {
+		if slot.ProductID == productID && slot.Quantity > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns the products whose name or description has a word starting with each word of the search text, or
+// whose name is similar to the text, the most similar first and then by name
+func (r *memoryProductRepository) Search(text string, limit int) ([]*models.Product, int, error) {
+	products := make([]*models.Product, 0)
+	words := searchWords(text)
+	if len(words) == 0 {
+		return products, 0, nil
+	}
+
+	similarities := make(map[uuid.UUID]float64)
+	err := r.session.read(func(d *memoryData) error {
+		for _, product := range d.products {
+			productWords := searchWords(product.Name + " " + product.Description)
+			similarity := wordSimilarity(words, searchWords(product.Name))
+			if matchesPrefixes(productWords, words) || similarity >= memoryWordSimilarityThreshold {
+				products = append(products, copyProduct(product))
+				similarities[product.ID] = similarity
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort.Slice(products, func(a, b int) bool {
+		if similarities[products[a].ID] != similarities[products[b].ID] {
+			return similarities[products[a].ID] > similarities[products[b].ID]
+		}
+		return products[a].Name < products[b].Name
+	})
+	total := len(products)
+	if len(products) > limit {
+		products = products[:limit]
+	}
+	return products, total, nil
+}
+
+// memoryWordSimilarityThreshold is the default pg_trgm.word_similarity_threshold, above which Postgres matches a
+// name with a misspelled search
+const memoryWordSimilarityThreshold = 0.6
+
+// wordSimilarity stands in for the word_similarity of pg_trgm: the greatest share of trigrams that the words of the
+// search have in common with a run of consecutive words of the name
+func wordSimilarity(words []string, nameWords []string) float64 {
+	searchTrigrams := trigrams(words)
+	best := 0.0
+	for from := range nameWords {
+		for to := from + 1; to <= len(nameWords); to++ {
+			nameTrigrams := trigrams(nameWords[from:to])
+			common := 0
+			for trigram := range searchTrigrams {
+				if nameTrigrams[trigram] {
+					common++
+				}
+			}
+			similarity := float64(common) / float64(len(searchTrigrams)+len(nameTrigrams)-common)
+			if similarity > best {
+				best = similarity
+			}
+		}
+	}
+	return best
+}
+
+// trigrams returns the trigrams of the words the way pg_trgm makes them, each word padded with two spaces in front
+// and one behind
+func trigrams(words []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// matchesPrefixes returns true if each prefix starts one of the words
+func matchesPrefixes(words []string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Insert inserts the product, ErrConflict is returned if the id or the name is taken
+func (r *memoryProductRepository) Insert(product *models.Product) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.products[product.ID]; ok {
+			return ErrConflict
+		}
+		for _, stored := range d.products {
+			if stored.Name == product.Name {
+				return ErrConflict
+			}
+		}
+		d.products[product.ID] = copyProduct(product)
+		return nil
+	})
+}
+
+// Update writes all columns of the product
+func (r *memoryProductRepository) Update(product *models.Product) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.products[product.ID]; !ok {
+			return db.ErrNoMatch
+		}
+		for _, stored := range d.products {
+			if stored.ID != product.ID && stored.Name == product.Name {
+				return ErrConflict
+			}
+		}
+		d.products[product.ID] = copyProduct(product)
+		return nil
+	})
+}
+
+// Delete deletes the product by id, unless it was purchased
+func (r *memoryProductRepository) Delete(productID uuid.UUID) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.products[productID]; !ok {
+			return db.ErrNoMatch
+		}
+		for _, purchase := range d.purchases {
+			if purchase.ProductID == productID {
+				return ErrReferenced
+			}
+		}
+		deleteProduct(d, productID)
+		return nil
+	})
+}
+
+// deleteProduct deletes the product with its prices, emptying the slots holding it like the foreign keys do
+func deleteProduct(d *memoryData, productID uuid.UUID) {
+	delete(d.products, productID)
+	for id, price := range d.prices {
+		if price.ProductID == productID {
+			delete(d.prices, id)
+		}
+	}
+	for _, slot := range d.slots {
+		if slot.ProductID == productID {
+			slot.ProductID = uuid.Nil
+		}
+	}
+}
+
+// copyProduct copies the product with its tags and allergens
+func copyProduct(product *models.Product) *models.Product {
+	c := *product
+	c.Tags = copyStrings(product.Tags)
+	c.Allergens = copyStrings(product.Allergens)
+	if product.Calories != nil {
+		calories := *product.Calories
+		c.Calories = &calories
+	}
+	return &c
+}
+
+// copyStrings returns a copy of the strings, or nil
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
+
+// containsString returns true if the value is one of the values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memoryPromotionRepository is the PromotionRepository kept in a MemoryStore
+type memoryPromotionRepository struct {
+	session *memorySession
+}
+
+// GetByID returns the promotion by id
+func (r *memoryPromotionRepository) GetByID(promotionID uuid.UUID) (*models.Promotion, error) {
+	promotion := &models.Promotion{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.promotions[promotionID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		promotion = copyPromotion(stored)
+		return nil
+	})
+	return promotion, err
+}
+
+// GetForUpdate returns the promotion by id, the transaction holds the whole store already
+func (r *memoryPromotionRepository) GetForUpdate(promotionID uuid.UUID) (*models.Promotion, error) {
+	return r.GetByID(promotionID)
+}
+
+// List returns the promotions matching the filter, oldest first
+func (r *memoryPromotionRepository) List(filter PromotionFilter) ([]*models.Promotion, error) {
+	promotions := make([]*models.Promotion, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for _, promotion := range d.promotions {
+			if filter.SellerID != uuid.Nil && promotion.SellerID != filter.SellerID {
+				continue
+			}
+			if filter.ProductID != uuid.Nil && !containsUUID(promotion.ProductIDs, filter.ProductID) {
+				continue
+			}
+			promotions = append(promotions, copyPromotion(promotion))
+		}
+		return nil
+	})
+	if err != nil {
+		return promotions, err
+	}
+
+	sortPromotions(promotions)
+	return promotions, nil
+}
+
+// ListEffective returns the promotions including any of the products that have started and not ended at the time
+func (r *memoryPromotionRepository) ListEffective(productIDs []uuid.UUID, at time.Time) ([]*models.Promotion, error) {
+	promotions := make([]*models.Promotion, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for _, promotion := range d.promotions {
+			if promotion.StartsAt != nil && promotion.StartsAt.After(at) {
+				continue
+			}
+			if promotion.EndsAt != nil && !promotion.EndsAt.After(at) {
+				continue
+			}
+			for _, productID := range productIDs {
+				if containsUUID(promotion.ProductIDs, productID) {
+					promotions = append(promotions, copyPromotion(promotion))
+					break
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return promotions, err
+	}
+
+	sortPromotions(promotions)
+	return promotions, nil
+}
+
+// Insert adds the promotion, filling in its creation time
+func (r *memoryPromotionRepository) Insert(promotion *models.Promotion) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.promotions[promotion.ID]; ok {
+			return ErrConflict
+		}
+		if _, ok := d.users[promotion.SellerID]; !ok {
+			return ErrReferenced
+		}
+		if promotion.CreatedAt.IsZero() {
+			promotion.CreatedAt = time.Now()
+		}
+		d.promotions[promotion.ID] = copyPromotion(promotion)
+		return nil
+	})
+}
+
+// Update writes the columns of the promotion that can change
+func (r *memoryPromotionRepository) Update(promotion *models.Promotion) error {
+	return r.session.write(func(d *memoryData) error {
+		stored, ok := d.promotions[promotion.ID]
+		if !ok {
+			return nil
+		}
+		updated := copyPromotion(promotion)
+		updated.SellerID = stored.SellerID
+		updated.CreatedAt = stored.CreatedAt
+		d.promotions[promotion.ID] = updated
+		promotion.SellerID = stored.SellerID
+		promotion.CreatedAt = stored.CreatedAt
+		return nil
+	})
+}
+
+// Delete deletes the promotion by id
+func (r *memoryPromotionRepository) Delete(promotionID uuid.UUID) error {
+	return r.session.write(func(d *memoryData) error {
+		delete(d.promotions, promotionID)
+		return nil
+	})
+}
+
+// sortPromotions orders the promotions oldest first
+func sortPromotions(promotions []*models.Promotion) {
+	sort.Slice(promotions, func(a, b int) bool {
+		if !promotions[a].CreatedAt.Equal(promotions[b].CreatedAt) {
+			return promotions[a].CreatedAt.Before(promotions[b].CreatedAt)
+		}
+		return promotions[a].ID.String() < promotions[b].ID.String()
+	})
+}
+
+// copyPromotion copies the promotion with its products
+func copyPromotion(promotion *models.Promotion) *models.Promotion {
+	c := *promotion
+	if promotion.ProductIDs != nil {
+		c.ProductIDs = append([]uuid.UUID{}, promotion.ProductIDs...)
+	}
+	c.StartsAt = copyTime(promotion.StartsAt)
+	c.EndsAt = copyTime(promotion.EndsAt)
+	return &c
+}
+
+// containsUUID returns true if the id is one of the ids
+func containsUUID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
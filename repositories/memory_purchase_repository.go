@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memoryPurchaseRepository is the PurchaseRepository kept in a MemoryStore
+type memoryPurchaseRepository struct {
+	session *memorySession
+}
+
+// GetByID returns the purchase by id
+func (r *memoryPurchaseRepository) GetByID(purchaseID uuid.UUID) (*models.Purchase, error) {
+	purchase := &models.Purchase{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.purchases[purchaseID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		purchase = copyPurchase(stored)
+		return nil
+	})
+	return purchase, err
+}
+
+// GetForUpdate returns the purchase by id, the transaction holds the whole store already
+func (r *memoryPurchaseRepository) GetForUpdate(purchaseID uuid.UUID) (*models.Purchase, error) {
+	return r.GetByID(purchaseID)
+}
+
+// List returns the purchases matching the filter with their products, newest first
+func (r *memoryPurchaseRepository) List(filter PurchaseFilter) ([]*models.Purchase, error) {
+	purchases := make([]*models.Purchase, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for _, stored := range d.purchases {
+			if filter.UserID != uuid.Nil && stored.UserID != filter.UserID {
+				continue
+			}
+			if filter.SellerID != uuid.Nil && stored.SellerID != filter.SellerID {
+				continue
+			}
+			purchase := copyPurchase(stored)
+			if product, ok := d.products[purchase.ProductID]; ok {
+				purchase.Product = copyProduct(product)
+			}
+			purchases = append(purchases, purchase)
+		}
+		return nil
+	})
+	if err != nil {
+		return purchases, err
+	}
+
+	sort.Slice(purchases, func(a, b int) bool {
+		return purchases[a].CreatedAt.After(purchases[b].CreatedAt)
+	})
+	return purchases, nil
+}
+
+// ListReserved returns up to limit purchases reserved before the given time, oldest first
+func (r *memoryPurchaseRepository) ListReserved(before time.Time, limit int) ([]*models.Purchase, error) {
+	purchases := make([]*models.Purchase, 0)
+	err := r.session.read(func(d *memoryData) error {
+		for _, stored := range d.purchases {
+			if stored.Status == models.PurchaseStatusReserved && stored.CreatedAt.Before(before) {
+				purchases = append(purchases, copyPurchase(stored))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return purchases, err
+	}
+
+	sort.Slice(purchases, func(a, b int) bool {
+		return purchases[a].CreatedAt.Before(purchases[b].CreatedAt)
+	})
+	if len(purchases) > limit {
+		purchases = purchases[:limit]
+	}
+	return purchases, nil
+}
+
+// Insert appends the purchase to the ledger, filling in the defaults of its status and creation time
+func (r *memoryPurchaseRepository) Insert(purchase *models.Purchase) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.purchases[purchase.ID]; ok {
+			return ErrConflict
+		}
+		if purchase.Status == "" {
+			purchase.Status = models.PurchaseStatusCompleted
+		}
+		if purchase.CreatedAt.IsZero() {
+			purchase.CreatedAt = time.Now()
+		}
+		d.purchases[purchase.ID] = copyPurchase(purchase)
+		return nil
+	})
+}
+
+// SetStatus writes the status of the purchase
+func (r *memoryPurchaseRepository) SetStatus(purchase *models.Purchase, status models.PurchaseStatus) error {
+	err := r.session.write(func(d *memoryData) error {
+		if stored, ok := d.purchases[purchase.ID]; ok {
+			stored.Status = status
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	purchase.Status = status
+	return nil
+}
+
+// RefundedAmounts adds up the refund entries of the purchase by id
+func (r *memoryPurchaseRepository) RefundedAmounts(purchaseID uuid.UUID) (RefundedAmounts, error) {
+	refunded := RefundedAmounts{}
+	err := r.session.read(func(d *memoryData) error {
+		for _, purchase := range d.purchases {
+			if purchase.RefundOf != purchaseID {
+				continue
+			}
+			refunded.Quantity -= int64(purchase.Quantity)
+			refunded.OriginalPrice -= int64(purchase.OriginalPrice)
+			refunded.Total -= int64(purchase.Total)
+			refunded.PlatformFee -= int64(purchase.PlatformFee)
+		}
+		return nil
+	})
+	return refunded, err
+}
+
+// SalesReport returns the totals of all purchases net of refunds, with a breakdown per product ordered by revenue
+func (r *memoryPurchaseRepository) SalesReport() (*payloads.SalesReport, error) {
+	report := &payloads.SalesReport{Products: make([]*payloads.ProductSales, 0)}
+	err := r.session.read(func(d *memoryData) error {
+		sales := make(map[[2]uuid.UUID]*payloads.ProductSales)
+		for _, purchase := range d.purchases {
+			key := [2]uuid.UUID{purchase.ProductID, purchase.SellerID}
+			productSales, ok := sales[key]
+			if !ok {
+				productSales = &payloads.ProductSales{ProductID: purchase.ProductID, SellerID: purchase.SellerID}
+				sales[key] = productSales
+				report.Products = append(report.Products, productSales)
+			}
+			if !purchase.IsRefund() {
+				report.Purchases++
+				productSales.Purchases++
+			}
+			report.ItemsSold += int64(purchase.Quantity)
+			report.Revenue += int64(purchase.Total)
+			report.ChangeReturned += int64(purchase.ChangeReturned)
+			productSales.ItemsSold += int64(purchase.Quantity)
+			productSales.Revenue += int64(purchase.Total)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report.Products, func(a, b int) bool {
+		return report.Products[a].Revenue > report.Products[b].Revenue
+	})
+	return report, nil
+}
+
+// copyPurchase copies the columns of the purchase, leaving out its product
+func copyPurchase(purchase *models.Purchase) *models.Purchase {
+	c := *purchase
+	c.Product = nil
+	return &c
+}
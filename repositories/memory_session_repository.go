@@ -0,0 +1,280 @@
+package repositories
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memorySessionRepository is the SessionRepository kept in a MemoryStore
+type memorySessionRepository struct {
+	session *memorySession
+}
+
+// GetForUpdate returns the session by id, the transaction holds the whole store already
+func (r *memorySessionRepository) GetForUpdate(sessionID uuid.UUID) (*models.Session, error) {
+	session := &models.Session{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.sessions[sessionID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		session = copySession(stored)
+		return nil
+	})
+	return session, err
+}
+
+// ListActive returns the active sessions of the user, most recently seen first
+func (r *memorySessionRepository) ListActive(userID uuid.UUID) ([]*models.Session, error) {
+	sessions := make([]*models.Session, 0)
+	now := time.Now()
+	err := r.session.read(func(d *memoryData) error {
+		for _, session := range d.sessions {
+			if session.UserID == userID && session.IsActive(now) {
+				sessions = append(sessions, copySession(session))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return sessions, err
+	}
+
+	sort.Slice(sessions, func(a, b int) bool {
+		return sessions[a].LastSeenAt.After(sessions[b].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// HasActive returns true if the user has an active session
+func (r *memorySessionRepository) HasActive(userID uuid.UUID) (bool, error) {
+	sessions, err := r.ListActive(userID)
+	return len(sessions) > 0, err
+}
+
+// Insert adds the session, filling in its creation and last seen times
+func (r *memorySessionRepository) Insert(session *models.Session) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.sessions[session.ID]; ok {
+			return ErrConflict
+		}
+		if _, ok := d.users[session.UserID]; !ok {
+			return ErrReferenced
+		}
+		for _, stored := range d.sessions {
+			if stored.JTI == session.JTI {
+				return ErrConflict
+			}
+		}
+		now := time.Now()
+		if session.CreatedAt.IsZero() {
+			session.CreatedAt = now
+		}
+		if session.LastSeenAt.IsZero() {
+			session.LastSeenAt = now
+		}
+		d.sessions[session.ID] = copySession(session)
+		return nil
+	})
+}
+
+// Refresh writes the access token id and the expiry of the session and marks it as seen now
+func (r *memorySessionRepository) Refresh(session *models.Session) error {
+	return r.session.write(func(d *memoryData) error {
+		stored, ok := d.sessions[session.ID]
+		if !ok {
+			return nil
+		}
+		for _, other := range d.sessions {
+			if other.ID != session.ID && other.JTI == session.JTI {
+				return ErrConflict
+			}
+		}
+		stored.JTI = session.JTI
+		stored.ExpiresAt = session.ExpiresAt
+		stored.LastSeenAt = time.Now()
+		session.LastSeenAt = stored.LastSeenAt
+		return nil
+	})
+}
+
+// End ends the session by id, if it has not ended yet
+func (r *memorySessionRepository) End(sessionID uuid.UUID) error {
+	return r.end(func(session *models.Session) bool {
+		return session.ID == sessionID
+	})
+}
+
+// EndByJTI ends the session of the user the access token was issued for
+func (r *memorySessionRepository) EndByJTI(userID uuid.UUID, jti string) error {
+	return r.end(func(session *models.Session) bool {
+		return session.UserID == userID && session.JTI == jti
+	})
+}
+
+// EndAll ends all sessions of the user, except the one of the access token with the given id, if any
+func (r *memorySessionRepository) EndAll(userID uuid.UUID, exceptJTI string) error {
+	return r.end(func(session *models.Session) bool {
+		return session.UserID == userID && (exceptJTI == "" || session.JTI != exceptJTI)
+	})
+}
+
+// TouchSession updates the last seen time of the active session the access token was issued for
+func (r *memorySessionRepository) TouchSession(jti string) (bool, error) {
+	touched := false
+	now := time.Now()
+	err := r.session.write(func(d *memoryData) error {
+		for _, session := range d.sessions {
+			if session.JTI == jti && session.IsActive(now) {
+				session.LastSeenAt = now
+				touched = true
+			}
+		}
+		return nil
+	})
+	return touched, err
+}
+
+// end ends the sessions matching the predicate that have not ended yet
+func (r *memorySessionRepository) end(matches func(session *models.Session) bool) error {
+	now := time.Now()
+	return r.session.write(func(d *memoryData) error {
+		for _, session := range d.sessions {
+			if session.EndedAt == nil && matches(session) {
+				endedAt := now
+				session.EndedAt = &endedAt
+			}
+		}
+		return nil
+	})
+}
+
+// copySession copies the columns of the session
+func copySession(session *models.Session) *models.Session {
+	c := *session
+	c.EndedAt = copyTime(session.EndedAt)
+	c.Current = false
+	return &c
+}
+
+// memoryRefreshTokenRepository is the RefreshTokenRepository kept in a MemoryStore
+type memoryRefreshTokenRepository struct {
+	session *memorySession
+}
+
+// GetByHashForUpdate returns the refresh token with the hash, the transaction holds the whole store already
+func (r *memoryRefreshTokenRepository) GetByHashForUpdate(tokenHash string) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+	err := r.session.read(func(d *memoryData) error {
+		stored := findRefreshToken(d, tokenHash)
+		if stored == nil {
+			return db.ErrNoMatch
+		}
+		copied := *stored
+		copied.RevokedAt = copyTime(stored.RevokedAt)
+		token = &copied
+		return nil
+	})
+	return token, err
+}
+
+// Insert adds the refresh token, filling in its creation time
+func (r *memoryRefreshTokenRepository) Insert(token *models.RefreshToken) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.refreshTokens[token.ID]; ok {
+			return ErrConflict
+		}
+		if findRefreshToken(d, token.TokenHash) != nil {
+			return ErrConflict
+		}
+		if _, ok := d.sessions[token.SessionID]; !ok {
+			return ErrReferenced
+		}
+		if token.CreatedAt.IsZero() {
+			token.CreatedAt = time.Now()
+		}
+		copied := *token
+		copied.RevokedAt = copyTime(token.RevokedAt)
+		d.refreshTokens[token.ID] = &copied
+		return nil
+	})
+}
+
+// Revoke revokes the refresh token now
+func (r *memoryRefreshTokenRepository) Revoke(token *models.RefreshToken) error {
+	return r.session.write(func(d *memoryData) error {
+		stored, ok := d.refreshTokens[token.ID]
+		if !ok {
+			return nil
+		}
+		revokedAt := time.Now()
+		stored.RevokedAt = &revokedAt
+		token.RevokedAt = copyTime(&revokedAt)
+		return nil
+	})
+}
+
+// RevokeByHash revokes the refresh token of the user with the hash, keeping the time it was revoked before
+func (r *memoryRefreshTokenRepository) RevokeByHash(userID uuid.UUID, tokenHash string) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+	err := r.session.write(func(d *memoryData) error {
+		stored := findRefreshToken(d, tokenHash)
+		if stored == nil || stored.UserID != userID {
+			return db.ErrNoMatch
+		}
+		if stored.RevokedAt == nil {
+			revokedAt := time.Now()
+			stored.RevokedAt = &revokedAt
+		}
+		copied := *stored
+		copied.RevokedAt = copyTime(stored.RevokedAt)
+		token = &copied
+		return nil
+	})
+	return token, err
+}
+
+// findRefreshToken returns the refresh token with the hash, or nil
+func findRefreshToken(d *memoryData, tokenHash string) *models.RefreshToken {
+	for _, token := range d.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return token
+		}
+	}
+	return nil
+}
+
+// memoryRevokedTokenRepository is the RevokedTokenRepository kept in a MemoryStore
+type memoryRevokedTokenRepository struct {
+	session *memorySession
+}
+
+// Revoke puts the access token on the denylist, dropping the entries of expired tokens
+func (r *memoryRevokedTokenRepository) Revoke(jti string, expiresAt time.Time) error {
+	now := time.Now()
+	return r.session.write(func(d *memoryData) error {
+		for storedJTI, token := range d.revokedTokens {
+			if token.ExpiresAt.Before(now) {
+				delete(d.revokedTokens, storedJTI)
+			}
+		}
+		if _, ok := d.revokedTokens[jti]; !ok {
+			d.revokedTokens[jti] = &models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}
+		}
+		return nil
+	})
+}
+
+// IsRevoked returns true if the access token with the given id is on the denylist
+func (r *memoryRevokedTokenRepository) IsRevoked(jti string) (bool, error) {
+	revoked := false
+	err := r.session.read(func(d *memoryData) error {
+		_, revoked = d.revokedTokens[jti]
+		return nil
+	})
+	return revoked, err
+}
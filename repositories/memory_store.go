@@ -0,0 +1,472 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// MemoryStore is a Store kept in memory, so the services using it run without a database, e.g. in tests.
+// A transaction works on a copy of the store that replaces it when the transaction commits. Transactions run one
+// at a time, which stands in for the row locks of Postgres, so a transaction must only use the Session it is given
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data *memoryData
+}
+
+// NewMemoryStore creates an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: &memoryData{
+		users:           make(map[uuid.UUID]*models.User),
+		products:        make(map[uuid.UUID]*models.Product),
+		purchases:       make(map[uuid.UUID]*models.Purchase),
+		machines:        make(map[uuid.UUID]*models.Machine),
+		slots:           make(map[uuid.UUID]*models.Slot),
+		coins:           make(map[memoryCoinKey]*models.CoinInventory),
+		accounts:        make(map[uuid.UUID]*models.Account),
+		promotions:      make(map[uuid.UUID]*models.Promotion),
+		prices:          make(map[uuid.UUID]*models.ProductPrice),
+		categories:      make(map[uuid.UUID]*models.Category),
+		payouts:         make(map[uuid.UUID]*models.Payout),
+		sessions:        make(map[uuid.UUID]*models.Session),
+		refreshTokens:   make(map[uuid.UUID]*models.RefreshToken),
+		revokedTokens:   make(map[string]*models.RevokedToken),
+		idempotencyKeys: make(map[memoryIdempotencyKey]*models.IdempotencyKey),
+		syncEvents:      make(map[uuid.UUID]*models.SyncEvent),
+	}}
+}
+
+// Users returns the users of the store
+func (s *MemoryStore) Users() UserRepository {
+	return s.session().Users()
+}
+
+// Products returns the products of the store
+func (s *MemoryStore) Products() ProductRepository {
+	return s.session().Products()
+}
+
+// Purchases returns the purchases of the store
+func (s *MemoryStore) Purchases() PurchaseRepository {
+	return s.session().Purchases()
+}
+
+// Machines returns the machines of the store
+func (s *MemoryStore) Machines() MachineRepository {
+	return s.session().Machines()
+}
+
+// Slots returns the slots of the store
+func (s *MemoryStore) Slots() SlotRepository {
+	return s.session().Slots()
+}
+
+// Coins returns the coin tubes of the store
+func (s *MemoryStore) Coins() CoinRepository {
+	return s.session().Coins()
+}
+
+// Journal returns the journal of the store
+func (s *MemoryStore) Journal() JournalRepository {
+	return s.session().Journal()
+}
+
+// Promotions returns the promotions of the store
+func (s *MemoryStore) Promotions() PromotionRepository {
+	return s.session().Promotions()
+}
+
+// Prices returns the price history of the store
+func (s *MemoryStore) Prices() PriceRepository {
+	return s.session().Prices()
+}
+
+// Categories returns the categories of the store
+func (s *MemoryStore) Categories() CategoryRepository {
+	return s.session().Categories()
+}
+
+// Payouts returns the payouts of the store
+func (s *MemoryStore) Payouts() PayoutRepository {
+	return s.session().Payouts()
+}
+
+// Sessions returns the user sessions of the store
+func (s *MemoryStore) Sessions() SessionRepository {
+	return s.session().Sessions()
+}
+
+// RefreshTokens returns the refresh tokens of the store
+func (s *MemoryStore) RefreshTokens() RefreshTokenRepository {
+	return s.session().RefreshTokens()
+}
+
+// RevokedTokens returns the denylist of the store
+func (s *MemoryStore) RevokedTokens() RevokedTokenRepository {
+	return s.session().RevokedTokens()
+}
+
+// IdempotencyKeys returns the idempotency keys of the store
+func (s *MemoryStore) IdempotencyKeys() IdempotencyKeyRepository {
+	return s.session().IdempotencyKeys()
+}
+
+// SyncEvents returns the synced events of the store
+func (s *MemoryStore) SyncEvents() SyncEventRepository {
+	return s.session().SyncEvents()
+}
+
+// session returns the session running every call on the store on its own
+func (s *MemoryStore) session() *memorySession {
+	return &memorySession{store: s}
+}
+
+// RunInTransaction runs fn on a copy of the store, which replaces the store if fn returns nil
+func (s *MemoryStore) RunInTransaction(ctx context.Context, fn func(tx Session) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tx := &memorySession{store: s, data: s.data.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.data = tx.data
+	notifyCommit(ctx)
+	return nil
+}
+
+// memoryCoinKey identifies the coin tube of a denomination in a machine
+type memoryCoinKey struct {
+	machineID    uuid.UUID
+	denomination int32
+}
+
+// memoryIdempotencyKey identifies an idempotency key of a user
+type memoryIdempotencyKey struct {
+	userID uuid.UUID
+	key    string
+}
+
+// memoryData are the tables of a MemoryStore. The journal entries and payout items are never changed once they are
+// appended, so copies of the tables share them
+type memoryData struct {
+	users               map[uuid.UUID]*models.User
+	products            map[uuid.UUID]*models.Product
+	purchases           map[uuid.UUID]*models.Purchase
+	machines            map[uuid.UUID]*models.Machine
+	slots               map[uuid.UUID]*models.Slot
+	coins               map[memoryCoinKey]*models.CoinInventory
+	accounts            map[uuid.UUID]*models.Account
+	journalTransactions []*models.JournalTransaction
+	journalEntries      []*models.JournalEntry
+	promotions          map[uuid.UUID]*models.Promotion
+	prices              map[uuid.UUID]*models.ProductPrice
+	categories          map[uuid.UUID]*models.Category
+	payouts             map[uuid.UUID]*models.Payout
+	payoutItems         []*models.PayoutItem
+	sessions            map[uuid.UUID]*models.Session
+	refreshTokens       map[uuid.UUID]*models.RefreshToken
+	revokedTokens       map[string]*models.RevokedToken
+	idempotencyKeys     map[memoryIdempotencyKey]*models.IdempotencyKey
+	syncEvents          map[uuid.UUID]*models.SyncEvent
+}
+
+// clone returns a copy of the tables that shares no rows with them, except the rows that never change
+func (d *memoryData) clone() *memoryData {
+	c := &memoryData{
+		users:               make(map[uuid.UUID]*models.User, len(d.users)),
+		products:            make(map[uuid.UUID]*models.Product, len(d.products)),
+		purchases:           make(map[uuid.UUID]*models.Purchase, len(d.purchases)),
+		machines:            make(map[uuid.UUID]*models.Machine, len(d.machines)),
+		slots:               make(map[uuid.UUID]*models.Slot, len(d.slots)),
+		coins:               make(map[memoryCoinKey]*models.CoinInventory, len(d.coins)),
+		accounts:            make(map[uuid.UUID]*models.Account, len(d.accounts)),
+		journalTransactions: append([]*models.JournalTransaction(nil), d.journalTransactions...),
+		journalEntries:      append([]*models.JournalEntry(nil), d.journalEntries...),
+		promotions:          make(map[uuid.UUID]*models.Promotion, len(d.promotions)),
+		prices:              make(map[uuid.UUID]*models.ProductPrice, len(d.prices)),
+		categories:          make(map[uuid.UUID]*models.Category, len(d.categories)),
+		payouts:             make(map[uuid.UUID]*models.Payout, len(d.payouts)),
+		payoutItems:         append([]*models.PayoutItem(nil), d.payoutItems...),
+		sessions:            make(map[uuid.UUID]*models.Session, len(d.sessions)),
+		refreshTokens:       make(map[uuid.UUID]*models.RefreshToken, len(d.refreshTokens)),
+		revokedTokens:       make(map[string]*models.RevokedToken, len(d.revokedTokens)),
+		idempotencyKeys:     make(map[memoryIdempotencyKey]*models.IdempotencyKey, len(d.idempotencyKeys)),
+		syncEvents:          make(map[uuid.UUID]*models.SyncEvent, len(d.syncEvents)),
+	}
+	for id, user := range d.users {
+		c.users[id] = copyUser(user)
+	}
+	for id, product := range d.products {
+		c.products[id] = copyProduct(product)
+	}
+	for id, purchase := range d.purchases {
+		c.purchases[id] = copyPurchase(purchase)
+	}
+	for id, machine := range d.machines {
+		c.machines[id] = copyMachine(machine)
+	}
+	for id, slot := range d.slots {
+		c.slots[id] = copySlot(slot)
+	}
+	for key, coin := range d.coins {
+		copied := *coin
+		c.coins[key] = &copied
+	}
+	for id, account := range d.accounts {
+		copied := *account
+		c.accounts[id] = &copied
+	}
+	for id, promotion := range d.promotions {
+		c.promotions[id] = copyPromotion(promotion)
+	}
+	for id, price := range d.prices {
+		copied := *price
+		c.prices[id] = &copied
+	}
+	for id, category := range d.categories {
+		c.categories[id] = copyCategory(category)
+	}
+	for id, payout := range d.payouts {
+		copied := *payout
+		c.payouts[id] = &copied
+	}
+	for id, session := range d.sessions {
+		c.sessions[id] = copySession(session)
+	}
+	for id, token := range d.refreshTokens {
+		copied := *token
+		c.refreshTokens[id] = &copied
+	}
+	for jti, token := range d.revokedTokens {
+		copied := *token
+		c.revokedTokens[jti] = &copied
+	}
+	for key, idempotencyKey := range d.idempotencyKeys {
+		c.idempotencyKeys[key] = copyIdempotencyKey(idempotencyKey)
+	}
+	for id, event := range d.syncEvents {
+		c.syncEvents[id] = copySyncEvent(event)
+	}
+	return c
+}
+
+// memorySession runs the repositories on the tables of a transaction, or on the store when data is nil
+type memorySession struct {
+	store *MemoryStore
+	data  *memoryData
+}
+
+// Users returns the users of the transaction
+func (s *memorySession) Users() UserRepository {
+	return &memoryUserRepository{session: s}
+}
+
+// Products returns the products of the transaction
+func (s *memorySession) Products() ProductRepository {
+	return &memoryProductRepository{session: s}
+}
+
+// Purchases returns the purchases of the transaction
+func (s *memorySession) Purchases() PurchaseRepository {
+	return &memoryPurchaseRepository{session: s}
+}
+
+// Machines returns the machines of the transaction
+func (s *memorySession) Machines() MachineRepository {
+	return &memoryMachineRepository{session: s}
+}
+
+// Slots returns the slots of the transaction
+func (s *memorySession) Slots() SlotRepository {
+	return &memorySlotRepository{session: s}
+}
+
+// Coins returns the coin tubes of the transaction
+func (s *memorySession) Coins() CoinRepository {
+	return &memoryCoinRepository{session: s}
+}
+
+// Journal returns the journal of the transaction
+func (s *memorySession) Journal() JournalRepository {
+	return &memoryJournalRepository{session: s}
+}
+
+// Promotions returns the promotions of the transaction
+func (s *memorySession) Promotions() PromotionRepository {
+	return &memoryPromotionRepository{session: s}
+}
+
+// Prices returns the price history of the transaction
+func (s *memorySession) Prices() PriceRepository {
+	return &memoryPriceRepository{session: s}
+}
+
+// Categories returns the categories of the transaction
+func (s *memorySession) Categories() CategoryRepository {
+	return &memoryCategoryRepository{session: s}
+}
+
+// Payouts returns the payouts of the transaction
+func (s *memorySession) Payouts() PayoutRepository {
+	return &memoryPayoutRepository{session: s}
+}
+
+// Sessions returns the user sessions of the transaction
+func (s *memorySession) Sessions() SessionRepository {
+	return &memorySessionRepository{session: s}
+}
+
+// RefreshTokens returns the refresh tokens of the transaction
+func (s *memorySession) RefreshTokens() RefreshTokenRepository {
+	return &memoryRefreshTokenRepository{session: s}
+}
+
+// RevokedTokens returns the denylist of the transaction
+func (s *memorySession) RevokedTokens() RevokedTokenRepository {
+	return &memoryRevokedTokenRepository{session: s}
+}
+
+// IdempotencyKeys returns the idempotency keys of the transaction
+func (s *memorySession) IdempotencyKeys() IdempotencyKeyRepository {
+	return &memoryIdempotencyKeyRepository{session: s}
+}
+
+// SyncEvents returns the synced events of the transaction
+func (s *memorySession) SyncEvents() SyncEventRepository {
+	return &memorySyncEventRepository{session: s}
+}
+
+// read runs fn on the tables of the transaction, or on the tables of the store while no transaction changes them
+func (s *memorySession) read(fn func(d *memoryData) error) error {
+	if s.data != nil {
+		return fn(s.data)
+	}
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+	return fn(s.store.data)
+}
+
+// write runs fn on the tables of the transaction, or on the tables of the store while nothing else uses them
+func (s *memorySession) write(fn func(d *memoryData) error) error {
+	if s.data != nil {
+		return fn(s.data)
+	}
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	return fn(s.store.data)
+}
+
+// memoryRow is a row of a table in memory with the values of its sort fields, which are strings or int64s
+type memoryRow struct {
+	id      uuid.UUID
+	keys    map[string]interface{}
+	matches bool
+}
+
+// memoryListQuery pages through the rows of a table in memory like listQuery does in Postgres. Strings are
+// ordered by their bytes rather than by the collation of the database
+type memoryListQuery struct {
+	sortFields  map[string]bool
+	defaultSort string
+}
+
+// selectPage returns the ids of the page of matching rows following the cursor, ordered by the sort field and
+// then by id. The cursor holds the position of its row, which may have been changed or deleted since
+func (l *memoryListQuery) selectPage(rows []*memoryRow, params payloads.ListParams) ([]uuid.UUID, payloads.Page, error) {
+	page := payloads.Page{}
+	if !validLimit(params.Limit) {
+		return nil, page, ErrInvalidListParams
+	}
+
+	field := params.Sort
+	if field == "" {
+		field = l.defaultSort
+	}
+	descending := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+	if !l.sortFields[field] {
+		return nil, page, ErrInvalidListParams
+	}
+	less := func(a, b *memoryRow) bool {
+		c := compareKeys(a.keys[field], b.keys[field])
+		if c == 0 {
+			c = bytes.Compare(a.id.Bytes(), b.id.Bytes())
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	}
+
+	var cursor *memoryRow
+	if params.Cursor != "" {
+		key, cursorID, err := decodeCursor(params.Cursor, params.Sort)
+		if err != nil {
+			return nil, page, ErrInvalidListParams
+		}
+		for _, row := range rows {
+			if reflect.TypeOf(row.keys[field]) != reflect.TypeOf(key) {
+				return nil, page, ErrInvalidListParams
+			}
+		}
+		cursor = &memoryRow{id: cursorID, keys: map[string]interface{}{field: key}}
+	}
+
+	matching := make([]*memoryRow, 0, len(rows))
+	for _, row := range rows {
+		if row.matches {
+			matching = append(matching, row)
+		}
+	}
+	page.Total = len(matching)
+	sort.Slice(matching, func(a, b int) bool {
+		return less(matching[a], matching[b])
+	})
+
+	ids := make([]uuid.UUID, 0, params.Limit)
+	var last *memoryRow
+	for _, row := range matching {
+		if cursor != nil && !less(cursor, row) {
+			continue
+		}
+		if len(ids) == params.Limit {
+			page.NextCursor = encodeCursor(params.Sort, last.keys[field], last.id)
+			break
+		}
+		ids = append(ids, row.id)
+		last = row
+	}
+	return ids, page, nil
+}
+
+// compareKeys compares two values of a sort field
+func compareKeys(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case int64:
+		switch b := b.(int64); {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
+
+// containsFold returns true if value contains substr, ignoring case like ILIKE
+func containsFold(value string, substr string) bool {
+	return strings.Contains(strings.ToLower(value), strings.ToLower(substr))
+}
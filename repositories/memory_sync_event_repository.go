@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memorySyncEventRepository is the SyncEventRepository kept in a MemoryStore
+type memorySyncEventRepository struct {
+	session *memorySession
+}
+
+// GetByID returns the event by id
+func (r *memorySyncEventRepository) GetByID(eventID uuid.UUID) (*models.SyncEvent, error) {
+	event := &models.SyncEvent{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.syncEvents[eventID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		event = copySyncEvent(stored)
+		return nil
+	})
+	return event, err
+}
+
+// LastApplied returns the last sequence of the machine and the time its last event was applied
+func (r *memorySyncEventRepository) LastApplied(machineID uuid.UUID) (int64, *time.Time, error) {
+	var lastSequence int64
+	var appliedAt *time.Time
+	err := r.session.read(func(d *memoryData) error {
+		for _, event := range d.syncEvents {
+			if event.MachineID != machineID {
+				continue
+			}
+			if event.Sequence > lastSequence {
+				lastSequence = event.Sequence
+			}
+			if appliedAt == nil || event.AppliedAt.After(*appliedAt) {
+				appliedAt = copyTime(&event.AppliedAt)
+			}
+		}
+		return nil
+	})
+	return lastSequence, appliedAt, err
+}
+
+// Insert appends the event, filling in the time it was applied
+func (r *memorySyncEventRepository) Insert(event *models.SyncEvent) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.syncEvents[event.ID]; ok {
+			return ErrConflict
+		}
+		if _, ok := d.machines[event.MachineID]; !ok {
+			return ErrReferenced
+		}
+		for _, stored := range d.syncEvents {
+			if stored.MachineID == event.MachineID && stored.Sequence == event.Sequence {
+				return ErrConflict
+			}
+		}
+		if event.AppliedAt.IsZero() {
+			event.AppliedAt = time.Now()
+		}
+		d.syncEvents[event.ID] = copySyncEvent(event)
+		return nil
+	})
+}
+
+// copySyncEvent copies the columns of the event with its conflicts
+func copySyncEvent(event *models.SyncEvent) *models.SyncEvent {
+	c := *event
+	if event.Conflicts != nil {
+		c.Conflicts = make([]*models.SyncConflict, len(event.Conflicts))
+		for i, conflict := range event.Conflicts {
+			copied := *conflict
+			c.Conflicts[i] = &copied
+		}
+	}
+	c.Duplicate = false
+	return &c
+}
@@ -0,0 +1,242 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// memoryUserListQuery pages through users in memory, sorted by username by default
+var memoryUserListQuery = &memoryListQuery{
+	sortFields:  map[string]bool{"username": true, "deposit": true},
+	defaultSort: "username",
+}
+
+// memoryUserRepository is the UserRepository kept in a MemoryStore
+type memoryUserRepository struct {
+	session *memorySession
+}
+
+// GetByID returns the user by id
+func (r *memoryUserRepository) GetByID(userID uuid.UUID) (*models.User, error) {
+	user := &models.User{}
+	err := r.session.read(func(d *memoryData) error {
+		stored, ok := d.users[userID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		user = copyUser(stored)
+		return nil
+	})
+	return user, err
+}
+
+// GetByUsername returns the user by username
+func (r *memoryUserRepository) GetByUsername(username string) (*models.User, error) {
+	user := &models.User{}
+	err := r.session.read(func(d *memoryData) error {
+		for _, stored := range d.users {
+			if stored.Username == username {
+				user = copyUser(stored)
+				return nil
+			}
+		}
+		return db.ErrNoMatch
+	})
+	return user, err
+}
+
+// GetForUpdate returns the user by id, the transaction holds the whole store already
+func (r *memoryUserRepository) GetForUpdate(userID uuid.UUID) (*models.User, error) {
+	return r.GetByID(userID)
+}
+
+// List returns the page of users matching the filter
+func (r *memoryUserRepository) List(filter *payloads.UserFilter) ([]*models.User, payloads.Page, error) {
+	users := make([]*models.User, 0)
+	var page payloads.Page
+	err := r.session.read(func(d *memoryData) error {
+		rows := make([]*memoryRow, 0, len(d.users))
+		for _, user := range d.users {
+			rows = append(rows, &memoryRow{
+				id:   user.ID,
+				keys: map[string]interface{}{"username": user.Username, "deposit": int64(user.Deposit)},
+				matches: (filter.Username == "" || containsFold(user.Username, filter.Username)) &&
+					(filter.Role == "" || user.Role == filter.Role),
+			})
+		}
+
+		ids, p, err := memoryUserListQuery.selectPage(rows, filter.ListParams)
+		if err != nil {
+			return err
+		}
+		page = p
+		for _, id := range ids {
+			users = append(users, copyUser(d.users[id]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, page, err
+	}
+	return users, page, nil
+}
+
+// Insert inserts the user, ErrConflict is returned if the id or the username is taken
+func (r *memoryUserRepository) Insert(user *models.User) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.users[user.ID]; ok {
+			return ErrConflict
+		}
+		for _, stored := range d.users {
+			if stored.Username == user.Username {
+				return ErrConflict
+			}
+		}
+		d.users[user.ID] = copyUser(user)
+		return nil
+	})
+}
+
+// UpdateUsername writes the username of the given user, leaving all other columns untouched
+func (r *memoryUserRepository) UpdateUsername(user *models.User) error {
+	return r.session.write(func(d *memoryData) error {
+		stored, ok := d.users[user.ID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		for _, other := range d.users {
+			if other.ID != user.ID && other.Username == user.Username {
+				return ErrConflict
+			}
+		}
+		stored.Username = user.Username
+		return nil
+	})
+}
+
+// UpdateDeposit writes the deposit of the given user and the machine holding it, leaving all other columns untouched
+func (r *memoryUserRepository) UpdateDeposit(user *models.User) error {
+	return r.session.write(func(d *memoryData) error {
+		stored, ok := d.users[user.ID]
+		if !ok {
+			return db.ErrNoMatch
+		}
+		stored.Deposit = user.Deposit
+		stored.MachineID = user.MachineID
+		return nil
+	})
+}
+
+// UpdateRole writes the role of the user
+func (r *memoryUserRepository) UpdateRole(user *models.User) error {
+	return r.session.write(func(d *memoryData) error {
+		if stored, ok := d.users[user.ID]; ok {
+			stored.Role = user.Role
+		}
+		return nil
+	})
+}
+
+// SetDisabledAt writes when the user was disabled, or enables them when disabledAt is nil
+func (r *memoryUserRepository) SetDisabledAt(user *models.User, disabledAt *time.Time) error {
+	user.DisabledAt = disabledAt
+	return r.session.write(func(d *memoryData) error {
+		if stored, ok := d.users[user.ID]; ok {
+			stored.DisabledAt = copyTime(disabledAt)
+		}
+		return nil
+	})
+}
+
+// Delete deletes the user by id with their products, unless they made or sold purchases
+func (r *memoryUserRepository) Delete(userID uuid.UUID) error {
+	return r.session.write(func(d *memoryData) error {
+		if _, ok := d.users[userID]; !ok {
+			return db.ErrNoMatch
+		}
+		for _, purchase := range d.purchases {
+			if purchase.UserID == userID || purchase.SellerID == userID {
+				return ErrReferenced
+			}
+		}
+		for _, payout := range d.payouts {
+			if payout.SellerID == userID {
+				return ErrReferenced
+			}
+		}
+		deleteUser(d, userID)
+		return nil
+	})
+}
+
+// deleteUser deletes the user with the rows the foreign keys delete with them, and clears the references the
+// foreign keys set to null
+func deleteUser(d *memoryData, userID uuid.UUID) {
+	delete(d.users, userID)
+	for id, product := range d.products {
+		if product.SellerID == userID {
+			deleteProduct(d, id)
+		}
+	}
+	for id, promotion := range d.promotions {
+		if promotion.SellerID == userID {
+			delete(d.promotions, id)
+		}
+	}
+	for _, price := range d.prices {
+		if price.CreatedBy == userID {
+			price.CreatedBy = uuid.Nil
+		}
+	}
+	for _, payout := range d.payouts {
+		if payout.DecidedBy == userID {
+			payout.DecidedBy = uuid.Nil
+		}
+	}
+	for _, machine := range d.machines {
+		if machine.OperatorID == userID {
+			machine.OperatorID = uuid.Nil
+		}
+	}
+	for id, session := range d.sessions {
+		if session.UserID == userID {
+			delete(d.sessions, id)
+		}
+	}
+	for id, token := range d.refreshTokens {
+		if token.UserID == userID {
+			delete(d.refreshTokens, id)
+		}
+	}
+	for key := range d.idempotencyKeys {
+		if key.userID == userID {
+			delete(d.idempotencyKeys, key)
+		}
+	}
+}
+
+// copyUser copies the columns of the user, leaving out the session fields that are not stored
+func copyUser(user *models.User) *models.User {
+	return &models.User{
+		ID:         user.ID,
+		Username:   user.Username,
+		Password:   user.Password,
+		Role:       user.Role,
+		Deposit:    user.Deposit,
+		MachineID:  user.MachineID,
+		DisabledAt: copyTime(user.DisabledAt),
+	}
+}
+
+// copyTime returns a copy of the time, or nil
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgCategoryRepository is the CategoryRepository kept in Postgres
+type pgCategoryRepository struct {
+	db orm.DB
+}
+
+// GetByID returns the category by id
+func (r *pgCategoryRepository) GetByID(categoryID uuid.UUID) (*models.Category, error) {
+	category := &models.Category{}
+	switch err := r.db.Model(category).Where("id = ?", categoryID).Select(); err {
+	case pg.ErrNoRows:
+		return category, db.ErrNoMatch
+	default:
+		return category, err
+	}
+}
+
+// List returns all categories ordered by name ignoring case
+func (r *pgCategoryRepository) List() ([]*models.Category, error) {
+	categories := make([]*models.Category, 0)
+	if err := r.db.Model(&categories).OrderExpr("lower(name) ASC").Select(); err != nil {
+		return categories, err
+	}
+	return categories, nil
+}
+
+// LockTree locks the categories table against changes by other transactions
+func (r *pgCategoryRepository) LockTree() error {
+	_, err := r.db.Exec("LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE")
+	return err
+}
+
+// Insert adds the category, ErrConflict is returned if its parent has a category with the same name
+func (r *pgCategoryRepository) Insert(category *models.Category) error {
+	_, err := r.db.Model(category).Returning("*").Insert()
+	return conflictError(err)
+}
+
+// Update writes the name and the parent of the category
+func (r *pgCategoryRepository) Update(category *models.Category) error {
+	result, err := r.db.Model(category).
+		Set("name = ?name").
+		Set("parent_id = ?parent_id").
+		WherePK().
+		Returning("*").
+		Update()
+	if err != nil {
+		if err == pg.ErrNoRows {
+			return db.ErrNoMatch
+		}
+		return conflictError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return db.ErrNoMatch
+	}
+	return nil
+}
+
+// Delete deletes the category by id, the foreign key of the products leaves them without a category while the one
+// of its subcategories restricts it
+func (r *pgCategoryRepository) Delete(categoryID uuid.UUID) error {
+	result, err := r.db.Model(&models.Category{ID: categoryID}).WherePK().Delete()
+	if err != nil {
+		return referencedError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return db.ErrNoMatch
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgIdempotencyKeyRepository is the IdempotencyKeyRepository kept in Postgres
+type pgIdempotencyKeyRepository struct {
+	db orm.DB
+}
+
+// Get returns the idempotency key of the user
+func (r *pgIdempotencyKeyRepository) Get(userID uuid.UUID, key string) (*models.IdempotencyKey, error) {
+	idempotencyKey := &models.IdempotencyKey{}
+	err := r.db.Model(idempotencyKey).
+		Where("user_id = ?", userID).
+		Where("idempotency_key = ?", key).
+		Select()
+	switch err {
+	case pg.ErrNoRows:
+		return idempotencyKey, db.ErrNoMatch
+	default:
+		return idempotencyKey, err
+	}
+}
+
+// Insert claims the key, a concurrent transaction claiming the same key waits for this one on the primary key. A key
+// that is already claimed returns no row to read the creation time back into
+func (r *pgIdempotencyKeyRepository) Insert(idempotencyKey *models.IdempotencyKey) (bool, error) {
+	switch _, err := r.db.Model(idempotencyKey).OnConflict("DO NOTHING").Returning("created_at").Insert(); err {
+	case nil:
+		return true, nil
+	case pg.ErrNoRows:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Complete stores the response of the key
+func (r *pgIdempotencyKeyRepository) Complete(idempotencyKey *models.IdempotencyKey) error {
+	res, err := r.db.Model(idempotencyKey).
+		Set("status = ?status").
+		Set("content_type = ?content_type").
+		Set("body = ?body").
+		Set("completed_at = now()").
+		WherePK().
+		Returning("completed_at").
+		Update()
+	if err == pg.ErrNoRows || (err == nil && res.RowsAffected() == 0) {
+		return db.ErrNoMatch
+	}
+	return err
+}
+
+// Delete deletes the idempotency key of the user
+func (r *pgIdempotencyKeyRepository) Delete(userID uuid.UUID, key string) error {
+	_, err := r.db.Model((*models.IdempotencyKey)(nil)).
+		Where("user_id = ?", userID).
+		Where("idempotency_key = ?", key).
+		Delete()
+	return err
+}
+
+// DeleteCreatedBefore deletes the keys of the user created before the time
+func (r *pgIdempotencyKeyRepository) DeleteCreatedBefore(userID uuid.UUID, before time.Time) error {
+	_, err := r.db.Model((*models.IdempotencyKey)(nil)).
+		Where("user_id = ?", userID).
+		Where("created_at < ?", before).
+		Delete()
+	return err
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgJournalRepository is the JournalRepository kept in Postgres
+type pgJournalRepository struct {
+	db orm.DB
+}
+
+// GetAccount returns the account of the type and owner
+func (r *pgJournalRepository) GetAccount(accountType models.AccountType, ownerID uuid.UUID) (*models.Account, error) {
+	account := &models.Account{}
+	switch err := r.db.Model(account).Where("type = ?", accountType).Where("owner_id = ?", ownerID).Select(); err {
+	case pg.ErrNoRows:
+		return account, db.ErrNoMatch
+	default:
+		return account, err
+	}
+}
+
+// GetOrCreateAccount returns the account of the type and owner, creating it if it does not exist yet. Concurrent
+// transactions creating the same account wait for each other on its unique index
+func (r *pgJournalRepository) GetOrCreateAccount(accountType models.AccountType, ownerID uuid.UUID) (*models.Account, error) {
+	account := &models.Account{ID: uuid.NewV4(), Type: accountType, OwnerID: ownerID}
+	if _, err := r.db.Model(account).OnConflict("(type, owner_id) DO NOTHING").Insert(); err != nil {
+		return account, err
+	}
+	return r.GetAccount(accountType, ownerID)
+}
+
+// InsertTransaction appends the transaction with its entries and adds them to the balances of their accounts,
+// locking the accounts in the order of the entries
+func (r *pgJournalRepository) InsertTransaction(transaction *models.JournalTransaction) error {
+	if _, err := r.db.Model(transaction).Returning("created_at").Insert(); err != nil {
+		return err
+	}
+	for _, entry := range transaction.Entries {
+		_, err := r.db.Model((*models.Account)(nil)).
+			Set("balance = balance + ?", entry.Amount).
+			Where("id = ?", entry.AccountID).
+			Update()
+		if err != nil {
+			return err
+		}
+	}
+	if len(transaction.Entries) == 0 {
+		return nil
+	}
+	_, err := r.db.Model(&transaction.Entries).Returning("created_at").Insert()
+	return err
+}
+
+// ListRevenueEntries returns the latest entries of the account with the transactions they belong to
+func (r *pgJournalRepository) ListRevenueEntries(accountID uuid.UUID, limit int) ([]*payloads.RevenueEntry, error) {
+	entries := make([]*payloads.RevenueEntry, 0)
+	err := r.db.Model((*models.JournalEntry)(nil)).
+		ColumnExpr("journal_entry.transaction_id, journal_transaction.kind, journal_transaction.reference_id").
+		ColumnExpr("-journal_entry.amount AS amount, journal_entry.created_at").
+		Join("JOIN journal_transactions AS journal_transaction ON journal_transaction.id = journal_entry.transaction_id").
+		Where("journal_entry.account_id = ?", accountID).
+		Order("journal_entry.created_at DESC").
+		Limit(limit).
+		Select(&entries)
+	if err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
+// Reconcile compares the deposits with the wallets, and the transactions and the accounts with their entries
+func (r *pgJournalRepository) Reconcile() (*payloads.Reconciliation, error) {
+	reconciliation := &payloads.Reconciliation{
+		DepositMismatches:      make([]*payloads.DepositMismatch, 0),
+		UnbalancedTransactions: make([]uuid.UUID, 0),
+		MisstatedAccounts:      make([]uuid.UUID, 0),
+	}
+	_, err := r.db.Query(&reconciliation.DepositMismatches, `
+		SELECT u.id AS user_id, u.deposit, coalesce(-a.balance, 0) AS wallet_balance
+		FROM users AS u
+		LEFT JOIN accounts AS a ON a.type = ? AND a.owner_id = u.id
+		WHERE u.deposit <> coalesce(-a.balance, 0)
+		ORDER BY u.id`, models.AccountTypeBuyerWallet)
+	if err != nil {
+		return reconciliation, err
+	}
+	_, err = r.db.Query(pg.Scan(pg.Array(&reconciliation.UnbalancedTransactions)), `
+		SELECT coalesce(array_agg(transaction_id ORDER BY transaction_id), '{}') FROM (
+			SELECT transaction_id FROM journal_entries GROUP BY transaction_id HAVING sum(amount) <> 0
+		) AS unbalanced`)
+	if err != nil {
+		return reconciliation, err
+	}
+	_, err = r.db.Query(pg.Scan(pg.Array(&reconciliation.MisstatedAccounts)), `
+		SELECT coalesce(array_agg(id ORDER BY id), '{}') FROM (
+			SELECT a.id FROM accounts AS a
+			LEFT JOIN journal_entries AS e ON e.account_id = a.id
+			GROUP BY a.id, a.balance
+			HAVING a.balance <> coalesce(sum(e.amount), 0)
+		) AS misstated`)
+	if err != nil {
+		return reconciliation, err
+	}
+	return reconciliation, nil
+}
@@ -0,0 +1,178 @@
+package repositories
+
+import (
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgMachineRepository is the MachineRepository kept in Postgres
+type pgMachineRepository struct {
+	db orm.DB
+}
+
+// GetByID returns the machine by id, without its slots
+func (r *pgMachineRepository) GetByID(machineID uuid.UUID) (*models.Machine, error) {
+	machine := &models.Machine{}
+	switch err := r.db.Model(machine).Where("id = ?", machineID).Select(); err {
+	case pg.ErrNoRows:
+		return machine, db.ErrNoMatch
+	default:
+		return machine, err
+	}
+}
+
+// GetWithSlots returns the machine by id with its slots and the products they hold
+func (r *pgMachineRepository) GetWithSlots(machineID uuid.UUID) (*models.Machine, error) {
+	machine := &models.Machine{}
+	err := r.db.Model(machine).
+		Relation("Slots", func(q *orm.Query) (*orm.Query, error) {
+			return q.Order("code"), nil
+		}).
+		Relation("Slots.Product").
+		Where("machine.id = ?", machineID).
+		Select()
+	switch err {
+	case pg.ErrNoRows:
+		return machine, db.ErrNoMatch
+	default:
+		return machine, err
+	}
+}
+
+// GetForUpdate returns the machine by id, locking its row until the end of the transaction. NO KEY UPDATE still
+// lets concurrent purchases reference the machine
+func (r *pgMachineRepository) GetForUpdate(machineID uuid.UUID) (*models.Machine, error) {
+	machine := &models.Machine{}
+	switch err := r.db.Model(machine).Where("id = ?", machineID).For("NO KEY UPDATE").Select(); err {
+	case pg.ErrNoRows:
+		return machine, db.ErrNoMatch
+	default:
+		return machine, err
+	}
+}
+
+// List returns all machines, oldest first
+func (r *pgMachineRepository) List() ([]*models.Machine, error) {
+	machines := make([]*models.Machine, 0)
+	if err := r.db.Model(&machines).Order("created_at").Select(); err != nil {
+		return machines, err
+	}
+	return machines, nil
+}
+
+// Insert adds the machine, reading back the defaults of its columns
+func (r *pgMachineRepository) Insert(machine *models.Machine) error {
+	_, err := r.db.Model(machine).Returning("*").Insert()
+	return err
+}
+
+// pgSlotRepository is the SlotRepository kept in Postgres
+type pgSlotRepository struct {
+	db orm.DB
+}
+
+// List returns the slots of the machine ordered by code, with the products they hold
+func (r *pgSlotRepository) List(machineID uuid.UUID) ([]*models.Slot, error) {
+	slots := make([]*models.Slot, 0)
+	err := r.db.Model(&slots).
+		Relation("Product").
+		Where("slot.machine_id = ?", machineID).
+		Order("slot.code").
+		Select()
+	if err != nil {
+		return slots, err
+	}
+	return slots, nil
+}
+
+// ListProductForUpdate returns the slots of the machine holding the product ordered by code, locking their rows
+// until the end of the transaction
+func (r *pgSlotRepository) ListProductForUpdate(machineID uuid.UUID, productID uuid.UUID) ([]*models.Slot, error) {
+	slots := make([]*models.Slot, 0)
+	err := r.db.Model(&slots).
+		Where("machine_id = ?", machineID).
+		Where("product_id = ?", productID).
+		Order("code").
+		For("UPDATE").
+		Select()
+	if err != nil {
+		return slots, err
+	}
+	return slots, nil
+}
+
+// GetByCodeForUpdate returns the slot of the machine with the code, locking its row until the end of the transaction
+func (r *pgSlotRepository) GetByCodeForUpdate(machineID uuid.UUID, code string) (*models.Slot, error) {
+	slot := &models.Slot{}
+	err := r.db.Model(slot).
+		Where("machine_id = ?", machineID).
+		Where("code = ?", code).
+		For("UPDATE").
+		Select()
+	switch err {
+	case pg.ErrNoRows:
+		return slot, db.ErrNoMatch
+	default:
+		return slot, err
+	}
+}
+
+// Upsert puts the slot into its machine, replacing the slot with the same code and reading back its id
+func (r *pgSlotRepository) Upsert(slot *models.Slot) error {
+	_, err := r.db.Model(slot).
+		OnConflict("(machine_id, code) DO UPDATE").
+		Set("product_id = EXCLUDED.product_id").
+		Set("capacity = EXCLUDED.capacity").
+		Set("quantity = EXCLUDED.quantity").
+		Returning("*").
+		Insert()
+	return err
+}
+
+// SetQuantity writes the quantity of the slot
+func (r *pgSlotRepository) SetQuantity(slot *models.Slot) error {
+	_, err := r.db.Model(slot).Set("quantity = ?quantity").WherePK().Update()
+	return err
+}
+
+// pgCoinRepository is the CoinRepository kept in Postgres
+type pgCoinRepository struct {
+	db orm.DB
+}
+
+// List returns the coins of the machine, highest denomination first
+func (r *pgCoinRepository) List(machineID uuid.UUID) ([]*models.CoinInventory, error) {
+	coins := make([]*models.CoinInventory, 0)
+	if err := r.db.Model(&coins).Where("machine_id = ?", machineID).Order("denomination DESC").Select(); err != nil {
+		return coins, err
+	}
+	return coins, nil
+}
+
+// ListForUpdate returns the coins of the machine, locking their rows until the end of the transaction
+func (r *pgCoinRepository) ListForUpdate(machineID uuid.UUID) ([]*models.CoinInventory, error) {
+	coins := make([]*models.CoinInventory, 0)
+	err := r.db.Model(&coins).Where("machine_id = ?", machineID).Order("denomination DESC").For("UPDATE").Select()
+	if err != nil {
+		return coins, err
+	}
+	return coins, nil
+}
+
+// Add adds the coins to the tube of the denomination in the machine, creating it if it does not exist
+func (r *pgCoinRepository) Add(machineID uuid.UUID, denomination int32, count int32) error {
+	coin := &models.CoinInventory{
+		MachineID:    machineID,
+		Denomination: denomination,
+		Count:        count,
+	}
+	_, err := r.db.Model(coin).
+		OnConflict("(machine_id, denomination) DO UPDATE").
+		Set("count = coin_inventory.count + EXCLUDED.count").
+		Insert()
+	return err
+}
@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgPayoutRepository is the PayoutRepository kept in Postgres
+type pgPayoutRepository struct {
+	db orm.DB
+}
+
+// GetByID returns the payout by id
+func (r *pgPayoutRepository) GetByID(payoutID uuid.UUID) (*models.Payout, error) {
+	payout := &models.Payout{}
+	switch err := r.db.Model(payout).Where("id = ?", payoutID).Select(); err {
+	case pg.ErrNoRows:
+		return payout, db.ErrNoMatch
+	default:
+		return payout, err
+	}
+}
+
+// GetForUpdate returns the payout by id, locking its row until the end of the transaction
+func (r *pgPayoutRepository) GetForUpdate(payoutID uuid.UUID) (*models.Payout, error) {
+	payout := &models.Payout{}
+	switch err := r.db.Model(payout).Where("id = ?", payoutID).For("UPDATE").Select(); err {
+	case pg.ErrNoRows:
+		return payout, db.ErrNoMatch
+	default:
+		return payout, err
+	}
+}
+
+// List returns the payouts of the seller, or all payouts for uuid.Nil, newest first
+func (r *pgPayoutRepository) List(sellerID uuid.UUID) ([]*models.Payout, error) {
+	payouts := make([]*models.Payout, 0)
+	query := r.db.Model(&payouts)
+	if sellerID != uuid.Nil {
+		query.Where("seller_id = ?", sellerID)
+	}
+	if err := query.Order("created_at DESC", "id DESC").Select(); err != nil {
+		return payouts, err
+	}
+	return payouts, nil
+}
+
+// HasRequested returns true if the seller has a payout waiting for approval
+func (r *pgPayoutRepository) HasRequested(sellerID uuid.UUID) (bool, error) {
+	return r.db.Model((*models.Payout)(nil)).
+		Where("seller_id = ?", sellerID).
+		Where("status = ?", models.PayoutStatusRequested).
+		Exists()
+}
+
+// ListUnpaidSales returns the completed and failed purchases of the seller that no payout includes, except rejected
+// ones, with their id, total and platform fee
+func (r *pgPayoutRepository) ListUnpaidSales(sellerID uuid.UUID) ([]*models.Purchase, error) {
+	sales := make([]*models.Purchase, 0)
+	err := r.db.Model(&sales).
+		Column("id", "total", "platform_fee").
+		Where("seller_id = ?", sellerID).
+		Where("status IN (?, ?)", models.PurchaseStatusCompleted, models.PurchaseStatusFailed).
+		Where(`NOT EXISTS (
+			SELECT 1 FROM payout_items AS item
+			JOIN payouts AS payout ON payout.id = item.payout_id
+			WHERE item.purchase_id = purchase.id AND payout.status <> ?
+		)`, models.PayoutStatusRejected).
+		Select()
+	if err != nil {
+		return sales, err
+	}
+	return sales, nil
+}
+
+// Insert adds the payout with its items, reading back its creation time
+func (r *pgPayoutRepository) Insert(payout *models.Payout, purchaseIDs []uuid.UUID) error {
+	if _, err := r.db.Model(payout).Returning("created_at").Insert(); err != nil {
+		return err
+	}
+	if len(purchaseIDs) == 0 {
+		return nil
+	}
+	items := make([]*models.PayoutItem, len(purchaseIDs))
+	for i, purchaseID := range purchaseIDs {
+		items[i] = &models.PayoutItem{PayoutID: payout.ID, PurchaseID: purchaseID}
+	}
+	_, err := r.db.Model(&items).Insert()
+	return err
+}
+
+// UpdateDecision writes the decision on the payout
+func (r *pgPayoutRepository) UpdateDecision(payout *models.Payout) error {
+	_, err := r.db.Model(payout).
+		Column("status", "provider_reference", "note", "decided_by", "decided_at").
+		WherePK().
+		Update()
+	return err
+}
+
+// ListSales returns the purchases that are items of the payout with their net revenue, oldest first
+func (r *pgPayoutRepository) ListSales(payoutID uuid.UUID) ([]*payloads.PayoutSale, error) {
+	sales := make([]*payloads.PayoutSale, 0)
+	err := r.db.Model((*models.Purchase)(nil)).
+		ColumnExpr("purchase.id AS purchase_id, purchase.product_id, purchase.refund_of, purchase.quantity").
+		ColumnExpr("purchase.total, purchase.platform_fee, purchase.total - purchase.platform_fee AS net, purchase.created_at").
+		Join("JOIN payout_items AS item ON item.purchase_id = purchase.id").
+		Where("item.payout_id = ?", payoutID).
+		Order("purchase.created_at ASC", "purchase.id ASC").
+		Select(&sales)
+	if err != nil {
+		return sales, err
+	}
+	return sales, nil
+}
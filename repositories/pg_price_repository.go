@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgPriceRepository is the PriceRepository kept in Postgres
+type pgPriceRepository struct {
+	db orm.DB
+}
+
+// List returns the prices of the product, oldest first
+func (r *pgPriceRepository) List(productID uuid.UUID) ([]*models.ProductPrice, error) {
+	prices := make([]*models.ProductPrice, 0)
+	if err := r.db.Model(&prices).Where("product_id = ?", productID).Order("effective_from ASC").Select(); err != nil {
+		return prices, err
+	}
+	return prices, nil
+}
+
+// GetAt returns the price of the product effective at the time
+func (r *pgPriceRepository) GetAt(productID uuid.UUID, at time.Time) (*models.ProductPrice, error) {
+	price := &models.ProductPrice{}
+	err := r.db.Model(price).
+		Where("product_id = ?", productID).
+		Where("effective_from <= ?", at).
+		Where("effective_to IS NULL OR effective_to > ?", at).
+		Select()
+	switch err {
+	case pg.ErrNoRows:
+		return price, db.ErrNoMatch
+	default:
+		return price, err
+	}
+}
+
+// ListBetween returns the prices of the product effective at any time from from until to, oldest first
+func (r *pgPriceRepository) ListBetween(productID uuid.UUID, from time.Time, to time.Time) ([]*models.ProductPrice, error) {
+	prices := make([]*models.ProductPrice, 0)
+	err := r.db.Model(&prices).
+		Where("product_id = ?", productID).
+		Where("effective_from <= ?", to).
+		Where("effective_to IS NULL OR effective_to > ?", from).
+		Order("effective_from ASC").
+		Select()
+	if err != nil {
+		return prices, err
+	}
+	return prices, nil
+}
+
+// ListScheduled returns the prices of the products that become effective after the time
+func (r *pgPriceRepository) ListScheduled(productIDs []uuid.UUID, after time.Time) ([]*models.ProductPrice, error) {
+	prices := make([]*models.ProductPrice, 0)
+	if len(productIDs) == 0 {
+		return prices, nil
+	}
+	err := r.db.Model(&prices).
+		Where("product_id IN (?)", pg.In(productIDs)).
+		Where("effective_from > ?", after).
+		Order("product_id", "effective_from").
+		Select()
+	if err != nil {
+		return prices, err
+	}
+	return prices, nil
+}
+
+// Insert adds the price, reading back the defaults of its columns
+func (r *pgPriceRepository) Insert(price *models.ProductPrice) error {
+	_, err := r.db.Model(price).Returning("*").Insert()
+	return err
+}
+
+// Update writes the cost, the end and the creator of the price
+func (r *pgPriceRepository) Update(price *models.ProductPrice) error {
+	_, err := r.db.Model(price).Column("cost", "effective_to", "created_by").WherePK().Update()
+	return err
+}
+
+// Delete deletes the price by id
+func (r *pgPriceRepository) Delete(priceID uuid.UUID) error {
+	_, err := r.db.Model((*models.ProductPrice)(nil)).Where("id = ?", priceID).Delete()
+	return err
+}
+
+// ActivatePrices sets the cost of the products whose price effective at the time differs from it
+func (r *pgPriceRepository) ActivatePrices(at time.Time) (int, error) {
+	result, err := r.db.Exec(`
+		UPDATE products SET cost = product_prices.cost
+		FROM product_prices
+		WHERE product_prices.product_id = products.id
+			AND product_prices.effective_from <= ?0
+			AND (product_prices.effective_to IS NULL OR product_prices.effective_to > ?0)
+			AND products.cost <> product_prices.cost`, at)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,168 @@
+package repositories
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// productListQuery pages through products, sorted by name by default
+var productListQuery = &listQuery{
+	table:       "products",
+	alias:       "product",
+	sortColumns: map[string]string{"name": "name", "cost": "cost"},
+	defaultSort: "name",
+}
+
+// pgProductRepository is the ProductRepository kept in Postgres
+type pgProductRepository struct {
+	db orm.DB
+}
+
+// GetByID returns the product by id
+func (r *pgProductRepository) GetByID(productID uuid.UUID) (*models.Product, error) {
+	product := &models.Product{}
+	switch err := r.db.Model(product).Where("id = ?", productID).Select(); err {
+	case pg.ErrNoRows:
+		return product, db.ErrNoMatch
+	default:
+		return product, err
+	}
+}
+
+// GetForUpdate returns the product by id, locking its row until the end of the transaction
+func (r *pgProductRepository) GetForUpdate(productID uuid.UUID) (*models.Product, error) {
+	product := &models.Product{}
+	switch err := r.db.Model(product).Where("id = ?", productID).For("UPDATE").Select(); err {
+	case pg.ErrNoRows:
+		return product, db.ErrNoMatch
+	default:
+		return product, err
+	}
+}
+
+// List returns the page of products matching the filter
+func (r *pgProductRepository) List(filter *payloads.ProductFilter) ([]*models.Product, payloads.Page, error) {
+	products := make([]*models.Product, 0)
+
+	query := r.db.Model(&products)
+	if filter.Name != "" {
+		query = query.Where("product.name ILIKE ?", "%"+escapeLike(filter.Name)+"%")
+	}
+	if filter.MinCost != nil {
+		query = query.Where("product.cost >= ?", *filter.MinCost)
+	}
+	if filter.MaxCost != nil {
+		query = query.Where("product.cost <= ?", *filter.MaxCost)
+	}
+	if filter.SellerID != uuid.Nil {
+		query = query.Where("product.seller_id = ?", filter.SellerID)
+	}
+	if filter.InStock {
+		query = query.Where("EXISTS (SELECT 1 FROM slots WHERE slots.product_id = product.id AND slots.quantity > 0)")
+	}
+	if filter.CategoryID != uuid.Nil {
+		query = query.Where(`product.category_id IN (
+			WITH RECURSIVE subcategories AS (
+				SELECT id FROM categories WHERE id = ?
+				UNION ALL
+				SELECT categories.id FROM categories JOIN subcategories ON categories.parent_id = subcategories.id
+			)
+			SELECT id FROM subcategories)`, filter.CategoryID)
+	}
+	if len(filter.Tags) > 0 {
+		query = query.Where("product.tags @> ?", pg.Array(filter.Tags))
+	}
+
+	page, err := productListQuery.selectPage(query, &products, filter.ListParams)
+	if err != nil {
+		return nil, page, err
+	}
+	return products, page, nil
+}
+
+// Search returns the products best matching the search text, ranked by how well their name and description
+// match. Every word of the text matches as a prefix, e.g. "choc bar" finds "Chocolate Bar", and names that are
+// similar to the text, e.g. "choclate", are matched as well to tolerate typos
+func (r *pgProductRepository) Search(text string, limit int) ([]*models.Product, int, error) {
+	products := make([]*models.Product, 0)
+	tsQuery := prefixTSQuery(text)
+	if tsQuery == "" {
+		return products, 0, nil
+	}
+
+	query := r.db.Model(&products).
+		Where("product.search_vector @@ to_tsquery('simple', ?) OR ? <% product.name", tsQuery, text)
+	total, err := query.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.
+		OrderExpr("ts_rank(product.search_vector, to_tsquery('simple', ?)) + word_similarity(?, product.name) DESC", tsQuery, text).
+		OrderExpr("product.name ASC").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, 0, err
+	}
+	return products, total, nil
+}
+
+// prefixTSQuery turns the words of the text into a tsquery matching all of them as prefixes, e.g. "choc:* & bar:*".
+// Only letters and digits are kept, so that the text cannot inject tsquery operators
+func prefixTSQuery(text string) string {
+	words := searchWords(text)
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// searchWords splits the text into its lower case words of letters and digits
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Insert inserts the product, ErrConflict is returned if the name is taken
+func (r *pgProductRepository) Insert(product *models.Product) error {
+	if _, err := r.db.Model(product).Insert(); err != nil {
+		return conflictError(err)
+	}
+	return nil
+}
+
+// Update writes all columns of the product
+func (r *pgProductRepository) Update(product *models.Product) error {
+	if _, err := r.db.Model(product).Where("id = ?", product.ID).Update(); err != nil {
+		if err == pg.ErrNoRows {
+			return db.ErrNoMatch
+		}
+		return conflictError(err)
+	}
+	return nil
+}
+
+// Delete deletes the product by id, its purchases restrict it by the foreign keys
+func (r *pgProductRepository) Delete(productID uuid.UUID) error {
+	result, err := r.db.Model(&models.Product{ID: productID}).WherePK().Delete()
+	if err != nil {
+		if err == pg.ErrNoRows {
+			return db.ErrNoMatch
+		}
+		return referencedError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return db.ErrNoMatch
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgPromotionRepository is the PromotionRepository kept in Postgres
+type pgPromotionRepository struct {
+	db orm.DB
+}
+
+// GetByID returns the promotion by id
+func (r *pgPromotionRepository) GetByID(promotionID uuid.UUID) (*models.Promotion, error) {
+	promotion := &models.Promotion{}
+	switch err := r.db.Model(promotion).Where("id = ?", promotionID).Select(); err {
+	case pg.ErrNoRows:
+		return promotion, db.ErrNoMatch
+	default:
+		return promotion, err
+	}
+}
+
+// GetForUpdate returns the promotion by id, locking its row until the end of the transaction
+func (r *pgPromotionRepository) GetForUpdate(promotionID uuid.UUID) (*models.Promotion, error) {
+	promotion := &models.Promotion{}
+	switch err := r.db.Model(promotion).Where("id = ?", promotionID).For("UPDATE").Select(); err {
+	case pg.ErrNoRows:
+		return promotion, db.ErrNoMatch
+	default:
+		return promotion, err
+	}
+}
+
+// List returns the promotions matching the filter, oldest first
+func (r *pgPromotionRepository) List(filter PromotionFilter) ([]*models.Promotion, error) {
+	promotions := make([]*models.Promotion, 0)
+	query := r.db.Model(&promotions)
+	if filter.SellerID != uuid.Nil {
+		query.Where("seller_id = ?", filter.SellerID)
+	}
+	if filter.ProductID != uuid.Nil {
+		query.Where("product_ids @> ?", pg.Array([]uuid.UUID{filter.ProductID}))
+	}
+	if err := query.Order("created_at ASC", "id ASC").Select(); err != nil {
+		return promotions, err
+	}
+	return promotions, nil
+}
+
+// ListEffective returns the promotions including any of the products that have started and not ended at the time
+func (r *pgPromotionRepository) ListEffective(productIDs []uuid.UUID, at time.Time) ([]*models.Promotion, error) {
+	promotions := make([]*models.Promotion, 0)
+	err := r.db.Model(&promotions).
+		Where("product_ids && ?", pg.Array(productIDs)).
+		Where("starts_at IS NULL OR starts_at <= ?", at).
+		Where("ends_at IS NULL OR ends_at > ?", at).
+		Select()
+	if err != nil {
+		return promotions, err
+	}
+	return promotions, nil
+}
+
+// Insert adds the promotion, reading back the defaults of its columns
+func (r *pgPromotionRepository) Insert(promotion *models.Promotion) error {
+	_, err := r.db.Model(promotion).Returning("*").Insert()
+	return err
+}
+
+// Update writes the columns of the promotion that can change
+func (r *pgPromotionRepository) Update(promotion *models.Promotion) error {
+	_, err := r.db.Model(promotion).
+		Column("name", "type", "product_ids", "value", "buy_quantity", "free_quantity",
+			"starts_at", "ends_at", "happy_hour_from", "happy_hour_to").
+		WherePK().
+		Returning("*").
+		Update()
+	return err
+}
+
+// Delete deletes the promotion by id
+func (r *pgPromotionRepository) Delete(promotionID uuid.UUID) error {
+	_, err := r.db.Model((*models.Promotion)(nil)).Where("id = ?", promotionID).Delete()
+	return err
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgPurchaseRepository is the PurchaseRepository kept in Postgres
+type pgPurchaseRepository struct {
+	db orm.DB
+}
+
+// GetByID returns the purchase by id
+func (r *pgPurchaseRepository) GetByID(purchaseID uuid.UUID) (*models.Purchase, error) {
+	purchase := &models.Purchase{}
+	switch err := r.db.Model(purchase).Where("id = ?", purchaseID).Select(); err {
+	case pg.ErrNoRows:
+		return purchase, db.ErrNoMatch
+	default:
+		return purchase, err
+	}
+}
+
+// GetForUpdate returns the purchase by id, locking its row until the end of the transaction
+func (r *pgPurchaseRepository) GetForUpdate(purchaseID uuid.UUID) (*models.Purchase, error) {
+	purchase := &models.Purchase{}
+	switch err := r.db.Model(purchase).Where("id = ?", purchaseID).For("UPDATE").Select(); err {
+	case pg.ErrNoRows:
+		return purchase, db.ErrNoMatch
+	default:
+		return purchase, err
+	}
+}
+
+// List returns the purchases matching the filter with their products, newest first
+func (r *pgPurchaseRepository) List(filter PurchaseFilter) ([]*models.Purchase, error) {
+	purchases := make([]*models.Purchase, 0)
+
+	query := r.db.Model(&purchases).Relation("Product")
+	if filter.UserID != uuid.Nil {
+		query = query.Where("purchase.user_id = ?", filter.UserID)
+	}
+	if filter.SellerID != uuid.Nil {
+		query = query.Where("purchase.seller_id = ?", filter.SellerID)
+	}
+	if err := query.Order("purchase.created_at DESC").Select(); err != nil {
+		return purchases, err
+	}
+	return purchases, nil
+}
+
+// ListReserved returns up to limit purchases reserved before the given time, oldest first
+func (r *pgPurchaseRepository) ListReserved(before time.Time, limit int) ([]*models.Purchase, error) {
+	purchases := make([]*models.Purchase, 0)
+	err := r.db.Model(&purchases).
+		Where("status = ?", models.PurchaseStatusReserved).
+		Where("created_at < ?", before).
+		Order("created_at").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return purchases, err
+	}
+	return purchases, nil
+}
+
+// Insert appends the purchase to the ledger, reading back the defaults of its columns
+func (r *pgPurchaseRepository) Insert(purchase *models.Purchase) error {
+	_, err := r.db.Model(purchase).Returning("*").Insert()
+	return err
+}
+
+// SetStatus writes the status of the purchase
+func (r *pgPurchaseRepository) SetStatus(purchase *models.Purchase, status models.PurchaseStatus) error {
+	if _, err := r.db.Model(purchase).Set("status = ?", status).WherePK().Update(); err != nil {
+		return err
+	}
+	purchase.Status = status
+	return nil
+}
+
+// RefundedAmounts adds up the refund entries of the purchase by id
+func (r *pgPurchaseRepository) RefundedAmounts(purchaseID uuid.UUID) (RefundedAmounts, error) {
+	refunded := RefundedAmounts{}
+	err := r.db.Model((*models.Purchase)(nil)).
+		ColumnExpr("coalesce(-sum(quantity), 0), coalesce(-sum(original_price), 0), coalesce(-sum(total), 0)").
+		ColumnExpr("coalesce(-sum(platform_fee), 0)").
+		Where("refund_of = ?", purchaseID).
+		Select(&refunded.Quantity, &refunded.OriginalPrice, &refunded.Total, &refunded.PlatformFee)
+	return refunded, err
+}
+
+// SalesReport returns the totals of all purchases net of refunds, with a breakdown per product ordered by revenue
+func (r *pgPurchaseRepository) SalesReport() (*payloads.SalesReport, error) {
+	report := &payloads.SalesReport{}
+	err := r.db.Model((*models.Purchase)(nil)).
+		ColumnExpr("count(*) FILTER (WHERE refund_of IS NULL) AS purchases").
+		ColumnExpr("coalesce(sum(quantity), 0) AS items_sold").
+		ColumnExpr("coalesce(sum(total), 0) AS revenue").
+		ColumnExpr("coalesce(sum(change_returned), 0) AS change_returned").
+		Select(report)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Products = make([]*payloads.ProductSales, 0)
+	err = r.db.Model((*models.Purchase)(nil)).
+		ColumnExpr("purchase.product_id, purchase.seller_id").
+		ColumnExpr("count(*) FILTER (WHERE refund_of IS NULL) AS purchases").
+		ColumnExpr("sum(purchase.quantity) AS items_sold").
+		ColumnExpr("sum(purchase.total) AS revenue").
+		Group("purchase.product_id", "purchase.seller_id").
+		Order("revenue DESC").
+		Select(&report.Products)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
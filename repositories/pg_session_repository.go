@@ -0,0 +1,188 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgSessionRepository is the SessionRepository kept in Postgres
+type pgSessionRepository struct {
+	db orm.DB
+}
+
+// GetForUpdate returns the session by id, locking its row until the end of the transaction
+func (r *pgSessionRepository) GetForUpdate(sessionID uuid.UUID) (*models.Session, error) {
+	session := &models.Session{}
+	switch err := r.db.Model(session).Where("id = ?", sessionID).For("UPDATE").Select(); err {
+	case pg.ErrNoRows:
+		return session, db.ErrNoMatch
+	default:
+		return session, err
+	}
+}
+
+// ListActive returns the active sessions of the user, most recently seen first
+func (r *pgSessionRepository) ListActive(userID uuid.UUID) ([]*models.Session, error) {
+	sessions := make([]*models.Session, 0)
+	err := r.db.Model(&sessions).
+		Where("user_id = ?", userID).
+		Where("ended_at IS NULL").
+		Where("expires_at > now()").
+		Order("last_seen_at DESC").
+		Select()
+	if err != nil {
+		return sessions, err
+	}
+	return sessions, nil
+}
+
+// HasActive returns true if the user has an active session
+func (r *pgSessionRepository) HasActive(userID uuid.UUID) (bool, error) {
+	return r.db.Model((*models.Session)(nil)).
+		Where("user_id = ?", userID).
+		Where("ended_at IS NULL").
+		Where("expires_at > now()").
+		Exists()
+}
+
+// Insert adds the session, reading back the defaults of its columns
+func (r *pgSessionRepository) Insert(session *models.Session) error {
+	_, err := r.db.Model(session).Returning("created_at, last_seen_at").Insert()
+	return err
+}
+
+// Refresh writes the access token id and the expiry of the session and marks it as seen now
+func (r *pgSessionRepository) Refresh(session *models.Session) error {
+	_, err := r.db.Model(session).
+		Set("jti = ?jti").
+		Set("expires_at = ?expires_at").
+		Set("last_seen_at = now()").
+		WherePK().
+		Returning("last_seen_at").
+		Update()
+	return err
+}
+
+// End ends the session by id, if it has not ended yet
+func (r *pgSessionRepository) End(sessionID uuid.UUID) error {
+	_, err := r.db.Model((*models.Session)(nil)).
+		Set("ended_at = now()").
+		Where("id = ?", sessionID).
+		Where("ended_at IS NULL").
+		Update()
+	return err
+}
+
+// EndByJTI ends the session of the user the access token was issued for
+func (r *pgSessionRepository) EndByJTI(userID uuid.UUID, jti string) error {
+	_, err := r.db.Model((*models.Session)(nil)).
+		Set("ended_at = now()").
+		Where("jti = ?", jti).
+		Where("user_id = ?", userID).
+		Where("ended_at IS NULL").
+		Update()
+	return err
+}
+
+// EndAll ends all sessions of the user, except the one of the access token with the given id, if any
+func (r *pgSessionRepository) EndAll(userID uuid.UUID, exceptJTI string) error {
+	query := r.db.Model((*models.Session)(nil)).
+		Set("ended_at = now()").
+		Where("user_id = ?", userID).
+		Where("ended_at IS NULL")
+	if exceptJTI != "" {
+		query = query.Where("jti <> ?", exceptJTI)
+	}
+	_, err := query.Update()
+	return err
+}
+
+// TouchSession updates the last seen time of the active session the access token was issued for
+func (r *pgSessionRepository) TouchSession(jti string) (bool, error) {
+	res, err := r.db.Model((*models.Session)(nil)).
+		Set("last_seen_at = now()").
+		Where("jti = ?", jti).
+		Where("ended_at IS NULL").
+		Where("expires_at > now()").
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// pgRefreshTokenRepository is the RefreshTokenRepository kept in Postgres
+type pgRefreshTokenRepository struct {
+	db orm.DB
+}
+
+// GetByHashForUpdate returns the refresh token with the hash, locking its row until the end of the transaction
+func (r *pgRefreshTokenRepository) GetByHashForUpdate(tokenHash string) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+	switch err := r.db.Model(token).Where("token_hash = ?", tokenHash).For("UPDATE").Select(); err {
+	case pg.ErrNoRows:
+		return token, db.ErrNoMatch
+	default:
+		return token, err
+	}
+}
+
+// Insert adds the refresh token
+func (r *pgRefreshTokenRepository) Insert(token *models.RefreshToken) error {
+	_, err := r.db.Model(token).Returning("created_at").Insert()
+	return err
+}
+
+// Revoke revokes the refresh token now
+func (r *pgRefreshTokenRepository) Revoke(token *models.RefreshToken) error {
+	_, err := r.db.Model(token).Set("revoked_at = now()").WherePK().Returning("revoked_at").Update()
+	return err
+}
+
+// RevokeByHash revokes the refresh token of the user with the hash, keeping the time it was revoked before
+func (r *pgRefreshTokenRepository) RevokeByHash(userID uuid.UUID, tokenHash string) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+	res, err := r.db.Model(token).
+		Set("revoked_at = COALESCE(revoked_at, now())").
+		Where("token_hash = ?", tokenHash).
+		Where("user_id = ?", userID).
+		Returning("*").
+		Update()
+	if err == pg.ErrNoRows || (err == nil && res.RowsAffected() == 0) {
+		return token, db.ErrNoMatch
+	}
+	return token, err
+}
+
+// pgRevokedTokenRepository is the RevokedTokenRepository kept in Postgres
+type pgRevokedTokenRepository struct {
+	db orm.DB
+}
+
+// Revoke puts the access token on the denylist, dropping the entries of expired tokens
+func (r *pgRevokedTokenRepository) Revoke(jti string, expiresAt time.Time) error {
+	_, err := r.db.Model((*models.RevokedToken)(nil)).
+		Where("expires_at < now()").
+		Delete()
+	if err != nil {
+		return err
+	}
+
+	revokedToken := &models.RevokedToken{
+		JTI:       jti,
+		ExpiresAt: expiresAt,
+	}
+	_, err = r.db.Model(revokedToken).OnConflict("DO NOTHING").Insert()
+	return err
+}
+
+// IsRevoked returns true if the access token with the given id is on the denylist
+func (r *pgRevokedTokenRepository) IsRevoked(jti string) (bool, error) {
+	return r.db.Model((*models.RevokedToken)(nil)).Where("jti = ?", jti).Exists()
+}
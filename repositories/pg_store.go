@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// PGStore is the Store kept in Postgres
+type PGStore struct {
+	pgSession
+	db *pg.DB
+}
+
+// NewPGStore creates a store on the given database
+func NewPGStore(db *pg.DB) *PGStore {
+	return &PGStore{pgSession: pgSession{db: db}, db: db}
+}
+
+// RunInTransaction runs fn in a database transaction
+func (s *PGStore) RunInTransaction(ctx context.Context, fn func(tx Session) error) error {
+	err := s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		return fn(&pgSession{db: tx})
+	})
+	if err != nil {
+		return err
+	}
+	notifyCommit(ctx)
+	return nil
+}
+
+// pgSession runs the repositories on the database, or on a transaction of it
+type pgSession struct {
+	db orm.DB
+}
+
+// Users returns the users of the session
+func (s *pgSession) Users() UserRepository {
+	return &pgUserRepository{db: s.db}
+}
+
+// Products returns the products of the session
+func (s *pgSession) Products() ProductRepository {
+	return &pgProductRepository{db: s.db}
+}
+
+// Purchases returns the purchases of the session
+func (s *pgSession) Purchases() PurchaseRepository {
+	return &pgPurchaseRepository{db: s.db}
+}
+
+// Machines returns the machines of the session
+func (s *pgSession) Machines() MachineRepository {
+	return &pgMachineRepository{db: s.db}
+}
+
+// Slots returns the slots of the session
+func (s *pgSession) Slots() SlotRepository {
+	return &pgSlotRepository{db: s.db}
+}
+
+// Coins returns the coin tubes of the session
+func (s *pgSession) Coins() CoinRepository {
+	return &pgCoinRepository{db: s.db}
+}
+
+// Journal returns the journal of the session
+func (s *pgSession) Journal() JournalRepository {
+	return &pgJournalRepository{db: s.db}
+}
+
+// Promotions returns the promotions of the session
+func (s *pgSession) Promotions() PromotionRepository {
+	return &pgPromotionRepository{db: s.db}
+}
+
+// Prices returns the price history of the session
+func (s *pgSession) Prices() PriceRepository {
+	return &pgPriceRepository{db: s.db}
+}
+
+// Categories returns the categories of the session
+func (s *pgSession) Categories() CategoryRepository {
+	return &pgCategoryRepository{db: s.db}
+}
+
+// Payouts returns the payouts of the session
+func (s *pgSession) Payouts() PayoutRepository {
+	return &pgPayoutRepository{db: s.db}
+}
+
+// Sessions returns the user sessions of the session
+func (s *pgSession) Sessions() SessionRepository {
+	return &pgSessionRepository{db: s.db}
+}
+
+// RefreshTokens returns the refresh tokens of the session
+func (s *pgSession) RefreshTokens() RefreshTokenRepository {
+	return &pgRefreshTokenRepository{db: s.db}
+}
+
+// RevokedTokens returns the denylist of the session
+func (s *pgSession) RevokedTokens() RevokedTokenRepository {
+	return &pgRevokedTokenRepository{db: s.db}
+}
+
+// IdempotencyKeys returns the idempotency keys of the session
+func (s *pgSession) IdempotencyKeys() IdempotencyKeyRepository {
+	return &pgIdempotencyKeyRepository{db: s.db}
+}
+
+// SyncEvents returns the synced events of the session
+func (s *pgSession) SyncEvents() SyncEventRepository {
+	return &pgSyncEventRepository{db: s.db}
+}
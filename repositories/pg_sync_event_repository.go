@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgSyncEventRepository is the SyncEventRepository kept in Postgres
+type pgSyncEventRepository struct {
+	db orm.DB
+}
+
+// GetByID returns the event by id
+func (r *pgSyncEventRepository) GetByID(eventID uuid.UUID) (*models.SyncEvent, error) {
+	event := &models.SyncEvent{}
+	switch err := r.db.Model(event).Where("id = ?", eventID).Select(); err {
+	case pg.ErrNoRows:
+		return event, db.ErrNoMatch
+	default:
+		return event, err
+	}
+}
+
+// LastApplied returns the last sequence of the machine and the time its last event was applied
+func (r *pgSyncEventRepository) LastApplied(machineID uuid.UUID) (int64, *time.Time, error) {
+	var lastSequence int64
+	var appliedAt *time.Time
+	err := r.db.Model((*models.SyncEvent)(nil)).
+		ColumnExpr("coalesce(max(sequence), 0), max(applied_at)").
+		Where("machine_id = ?", machineID).
+		Select(&lastSequence, &appliedAt)
+	return lastSequence, appliedAt, err
+}
+
+// Insert appends the event, reading back the time it was applied
+func (r *pgSyncEventRepository) Insert(event *models.SyncEvent) error {
+	_, err := r.db.Model(event).Returning("applied_at").Insert()
+	return referencedError(conflictError(err))
+}
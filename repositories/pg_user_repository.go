@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgUniqueViolation is the code of the error Postgres returns when a unique constraint is violated
+const pgUniqueViolation = "23505"
+
+// pgForeignKeyViolation is the code of the error Postgres returns when a foreign key constraint is violated
+const pgForeignKeyViolation = "23503"
+
+// userListQuery pages through users, sorted by username by default. The alias of the users table is quoted,
+// as user is a reserved word
+var userListQuery = &listQuery{
+	table:       "users",
+	alias:       `"user"`,
+	sortColumns: map[string]string{"username": "username", "deposit": "deposit"},
+	defaultSort: "username",
+}
+
+// pgUserRepository is the UserRepository kept in Postgres
+type pgUserRepository struct {
+	db orm.DB
+}
+
+// GetByID returns the user by id
+func (r *pgUserRepository) GetByID(userID uuid.UUID) (*models.User, error) {
+	user := &models.User{}
+	switch err := r.db.Model(user).Where("id = ?", userID).Select(); err {
+	case pg.ErrNoRows:
+		return user, db.ErrNoMatch
+	default:
+		return user, err
+	}
+}
+
+// GetByUsername returns the user by username
+func (r *pgUserRepository) GetByUsername(username string) (*models.User, error) {
+	user := &models.User{}
+	switch err := r.db.Model(user).Where("username = ?", username).Select(); err {
+	case pg.ErrNoRows:
+		return user, db.ErrNoMatch
+	default:
+		return user, err
+	}
+}
+
+// GetForUpdate returns the user by id, locking its row until the end of the transaction
+func (r *pgUserRepository) GetForUpdate(userID uuid.UUID) (*models.User, error) {
+	user := &models.User{}
+	switch err := r.db.Model(user).Where("id = ?", userID).For("UPDATE").Select(); err {
+	case pg.ErrNoRows:
+		return user, db.ErrNoMatch
+	default:
+		return user, err
+	}
+}
+
+// List returns the page of users matching the filter
+func (r *pgUserRepository) List(filter *payloads.UserFilter) ([]*models.User, payloads.Page, error) {
+	users := make([]*models.User, 0)
+
+	query := r.db.Model(&users)
+	if filter.Username != "" {
+		query = query.Where(`"user".username ILIKE ?`, "%"+escapeLike(filter.Username)+"%")
+	}
+	if filter.Role != "" {
+		query = query.Where(`"user".role = ?`, filter.Role)
+	}
+
+	page, err := userListQuery.selectPage(query, &users, filter.ListParams)
+	if err != nil {
+		return nil, page, err
+	}
+	return users, page, nil
+}
+
+// Insert inserts the user, ErrConflict is returned if the username is taken
+func (r *pgUserRepository) Insert(user *models.User) error {
+	if _, err := r.db.Model(user).Insert(); err != nil {
+		return conflictError(err)
+	}
+	return nil
+}
+
+// UpdateUsername writes the username of the given user, leaving all other columns untouched
+func (r *pgUserRepository) UpdateUsername(user *models.User) error {
+	result, err := r.db.Model(user).Set("username = ?username").WherePK().Update()
+	if err != nil {
+		if err == pg.ErrNoRows {
+			return db.ErrNoMatch
+		}
+		return conflictError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return db.ErrNoMatch
+	}
+	return nil
+}
+
+// UpdateDeposit writes the deposit of the given user and the machine holding it, leaving all other columns untouched
+func (r *pgUserRepository) UpdateDeposit(user *models.User) error {
+	var machineID interface{}
+	if user.MachineID != uuid.Nil {
+		machineID = user.MachineID
+	}
+	result, err := r.db.Model(user).
+		Set("deposit = ?", user.Deposit).
+		Set("machine_id = ?", machineID).
+		WherePK().
+		Update()
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return db.ErrNoMatch
+	}
+	return nil
+}
+
+// UpdateRole writes the role of the user
+func (r *pgUserRepository) UpdateRole(user *models.User) error {
+	_, err := r.db.Model(user).Set("role = ?role").WherePK().Update()
+	return err
+}
+
+// SetDisabledAt writes when the user was disabled, or enables them when disabledAt is nil
+func (r *pgUserRepository) SetDisabledAt(user *models.User, disabledAt *time.Time) error {
+	user.DisabledAt = disabledAt
+	_, err := r.db.Model(user).Set("disabled_at = ?disabled_at").WherePK().Update()
+	return err
+}
+
+// Delete deletes the user by id, their products are deleted by the foreign keys while their purchases restrict it
+func (r *pgUserRepository) Delete(userID uuid.UUID) error {
+	result, err := r.db.Model(&models.User{ID: userID}).WherePK().Delete()
+	if err != nil {
+		if err == pg.ErrNoRows {
+			return db.ErrNoMatch
+		}
+		return referencedError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return db.ErrNoMatch
+	}
+	return nil
+}
+
+// referencedError returns ErrReferenced for foreign key violations and any other error unchanged
+func referencedError(err error) error {
+	if pgErr, ok := err.(pg.Error); ok && pgErr.Field('C') == pgForeignKeyViolation {
+		return ErrReferenced
+	}
+	return err
+}
+
+// conflictError returns ErrConflict for unique violations and any other error unchanged
+func conflictError(err error) error {
+	if pgErr, ok := err.(pg.Error); ok && pgErr.Field('C') == pgUniqueViolation {
+		return ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,372 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrInvalidListParams is returned when a list is requested with a page size out of range, an unknown sort field or
+// a malformed cursor
+var ErrInvalidListParams = fmt.Errorf("invalid limit, sort or cursor")
+
+// ErrConflict is returned when a row conflicts with an existing one, e.g. a user with a username that is taken
+var ErrConflict = fmt.Errorf("record conflicts with an existing one")
+
+// ErrReferenced is returned when deleting a row that other rows still reference, e.g. a product with purchases.
+// Purchases are the ledger of the machine, so they are never deleted with the users and products they refer to
+var ErrReferenced = fmt.Errorf("record is still referenced by other records")
+
+// UserRepository reads and writes the users. Lookups of missing users return db.ErrNoMatch
+type UserRepository interface {
+	GetByID(userID uuid.UUID) (*models.User, error)
+	GetByUsername(username string) (*models.User, error)
+	// GetForUpdate returns the user by id, locking it until the end of the transaction
+	GetForUpdate(userID uuid.UUID) (*models.User, error)
+	// List returns the page of users matching the filter with the pagination details
+	List(filter *payloads.UserFilter) ([]*models.User, payloads.Page, error)
+	Insert(user *models.User) error
+	// UpdateUsername writes the username of the user, ErrConflict is returned if it is taken
+	UpdateUsername(user *models.User) error
+	// UpdateDeposit writes the deposit of the user and the machine holding it
+	UpdateDeposit(user *models.User) error
+	UpdateRole(user *models.User) error
+	// SetDisabledAt disables the user at the given time, or enables them when it is nil
+	SetDisabledAt(user *models.User, disabledAt *time.Time) error
+	// Delete deletes the user by id with their products, ErrReferenced is returned if they made or sold purchases
+	Delete(userID uuid.UUID) error
+}
+
+// ProductRepository reads and writes the products. Lookups of missing products return db.ErrNoMatch
+type ProductRepository interface {
+	GetByID(productID uuid.UUID) (*models.Product, error)
+	// GetForUpdate returns the product by id, locking it until the end of the transaction
+	GetForUpdate(productID uuid.UUID) (*models.Product, error)
+	// List returns the page of products matching the filter with the pagination details
+	List(filter *payloads.ProductFilter) ([]*models.Product, payloads.Page, error)
+	// Search returns up to limit products matching the search text, best match first, and the number of matches
+	Search(text string, limit int) ([]*models.Product, int, error)
+	Insert(product *models.Product) error
+	// Update writes all columns of the product
+	Update(product *models.Product) error
+	// Delete deletes the product by id, ErrReferenced is returned if it was purchased
+	Delete(productID uuid.UUID) error
+}
+
+// PurchaseFilter selects purchases by buyer and seller, an empty id matches all purchases
+type PurchaseFilter struct {
+	UserID   uuid.UUID
+	SellerID uuid.UUID
+}
+
+// RefundedAmounts are the amounts of a purchase that were refunded, as positive numbers
+type RefundedAmounts struct {
+	Quantity      int64
+	OriginalPrice int64
+	Total         int64
+	PlatformFee   int64
+}
+
+// PurchaseRepository reads and appends to the purchases ledger. Lookups of missing purchases return db.ErrNoMatch
+type PurchaseRepository interface {
+	GetByID(purchaseID uuid.UUID) (*models.Purchase, error)
+	// GetForUpdate returns the purchase by id, locking it until the end of the transaction
+	GetForUpdate(purchaseID uuid.UUID) (*models.Purchase, error)
+	// List returns the purchases matching the filter with their products, newest first
+	List(filter PurchaseFilter) ([]*models.Purchase, error)
+	// ListReserved returns up to limit purchases that were reserved before the given time, oldest first
+	ListReserved(before time.Time, limit int) ([]*models.Purchase, error)
+	// Insert appends the purchase to the ledger, filling in its defaults
+	Insert(purchase *models.Purchase) error
+	SetStatus(purchase *models.Purchase, status models.PurchaseStatus) error
+	// RefundedAmounts returns what was refunded of the purchase by id so far
+	RefundedAmounts(purchaseID uuid.UUID) (RefundedAmounts, error)
+	// SalesReport returns the totals of all purchases net of refunds, with a breakdown per product by revenue
+	SalesReport() (*payloads.SalesReport, error)
+}
+
+// MachineRepository reads and writes the machines. Lookups of missing machines return db.ErrNoMatch
+type MachineRepository interface {
+	// GetByID returns the machine by id, without its slots
+	GetByID(machineID uuid.UUID) (*models.Machine, error)
+	// GetWithSlots returns the machine by id with its slots, ordered by code, and the products they hold
+	GetWithSlots(machineID uuid.UUID) (*models.Machine, error)
+	// GetForUpdate returns the machine by id, locking it until the end of the transaction. The lock still lets
+	// other transactions record purchases of the machine
+	GetForUpdate(machineID uuid.UUID) (*models.Machine, error)
+	// List returns all machines without their slots, oldest first
+	List() ([]*models.Machine, error)
+	// Insert adds the machine, filling in its creation time
+	Insert(machine *models.Machine) error
+}
+
+// SlotRepository reads and writes the slots of the machines. Lookups of missing slots return db.ErrNoMatch
+type SlotRepository interface {
+	// List returns the slots of the machine ordered by code, with the products they hold
+	List(machineID uuid.UUID) ([]*models.Slot, error)
+	// ListProductForUpdate returns the slots of the machine holding the product ordered by code, locking them until
+	// the end of the transaction
+	ListProductForUpdate(machineID uuid.UUID, productID uuid.UUID) ([]*models.Slot, error)
+	// GetByCodeForUpdate returns the slot of the machine with the code, locking it until the end of the transaction
+	GetByCodeForUpdate(machineID uuid.UUID, code string) (*models.Slot, error)
+	// Upsert puts the slot into its machine, replacing the product, capacity and quantity of the slot with the same
+	// code if there is one, whose id is then set on the slot
+	Upsert(slot *models.Slot) error
+	// SetQuantity writes the quantity of the slot
+	SetQuantity(slot *models.Slot) error
+}
+
+// CoinRepository reads and writes the coin tubes of the machines
+type CoinRepository interface {
+	// List returns the coins of the machine, highest denomination first
+	List(machineID uuid.UUID) ([]*models.CoinInventory, error)
+	// ListForUpdate returns the coins of the machine like List, locking them until the end of the transaction
+	ListForUpdate(machineID uuid.UUID) ([]*models.CoinInventory, error)
+	// Add adds the number of coins of the denomination to the machine, creating its tube if it has none. A negative
+	// count removes coins
+	Add(machineID uuid.UUID, denomination int32, count int32) error
+}
+
+// JournalRepository reads and appends to the journal of accounts. Lookups of missing accounts return db.ErrNoMatch
+type JournalRepository interface {
+	// GetAccount returns the account of the type and owner
+	GetAccount(accountType models.AccountType, ownerID uuid.UUID) (*models.Account, error)
+	// GetOrCreateAccount returns the account of the type and owner, creating it with a zero balance if it does not
+	// exist yet
+	GetOrCreateAccount(accountType models.AccountType, ownerID uuid.UUID) (*models.Account, error)
+	// InsertTransaction appends the transaction with its entries to the journal and adds the entries to the balances
+	// of their accounts in their order
+	InsertTransaction(transaction *models.JournalTransaction) error
+	// ListRevenueEntries returns up to limit entries of the account, newest first, with their amount credited to
+	// the account as a positive number
+	ListRevenueEntries(accountID uuid.UUID, limit int) ([]*payloads.RevenueEntry, error)
+	// Reconcile returns the users whose deposit differs from the balance of their wallet, the transactions that do
+	// not balance and the accounts whose balance differs from the sum of their entries, each ordered by id
+	Reconcile() (*payloads.Reconciliation, error)
+}
+
+// PromotionFilter selects promotions by seller and by a product they include, an empty id matches all promotions
+type PromotionFilter struct {
+	SellerID  uuid.UUID
+	ProductID uuid.UUID
+}
+
+// PromotionRepository reads and writes the promotions. Lookups of missing promotions return db.ErrNoMatch
+type PromotionRepository interface {
+	GetByID(promotionID uuid.UUID) (*models.Promotion, error)
+	// GetForUpdate returns the promotion by id, locking it until the end of the transaction
+	GetForUpdate(promotionID uuid.UUID) (*models.Promotion, error)
+	// List returns the promotions matching the filter, oldest first
+	List(filter PromotionFilter) ([]*models.Promotion, error)
+	// ListEffective returns the promotions including any of the products that have started and not ended at the
+	// time, regardless of their happy hours
+	ListEffective(productIDs []uuid.UUID, at time.Time) ([]*models.Promotion, error)
+	// Insert adds the promotion, filling in its creation time
+	Insert(promotion *models.Promotion) error
+	// Update writes all columns of the promotion except its seller and creation time, which are read back
+	Update(promotion *models.Promotion) error
+	Delete(promotionID uuid.UUID) error
+}
+
+// PriceRepository reads and writes the price history of the products
+type PriceRepository interface {
+	// List returns the prices of the product, oldest first
+	List(productID uuid.UUID) ([]*models.ProductPrice, error)
+	// GetAt returns the price of the product effective at the time, db.ErrNoMatch if none was recorded for it
+	GetAt(productID uuid.UUID, at time.Time) (*models.ProductPrice, error)
+	// ListBetween returns the prices of the product effective at any time from from until to, oldest first
+	ListBetween(productID uuid.UUID, from time.Time, to time.Time) ([]*models.ProductPrice, error)
+	// ListScheduled returns the prices of the products that become effective after the time, ordered by product
+	// and then by the time they become effective
+	ListScheduled(productIDs []uuid.UUID, after time.Time) ([]*models.ProductPrice, error)
+	// Insert adds the price, filling in its creation time
+	Insert(price *models.ProductPrice) error
+	// Update writes the cost, the end and the creator of the price
+	Update(price *models.ProductPrice) error
+	Delete(priceID uuid.UUID) error
+	// ActivatePrices sets the cost of every product to its price effective at the time, if it differs, and returns
+	// the number of products that were updated
+	ActivatePrices(at time.Time) (int, error)
+}
+
+// CategoryRepository reads and writes the category tree. Lookups of missing categories return db.ErrNoMatch
+type CategoryRepository interface {
+	GetByID(categoryID uuid.UUID) (*models.Category, error)
+	// List returns all categories without their children, ordered by name ignoring case
+	List() ([]*models.Category, error)
+	// LockTree keeps other transactions from changing the categories until the end of the transaction
+	LockTree() error
+	// Insert adds the category, ErrConflict is returned if its parent has a category with the same name
+	Insert(category *models.Category) error
+	// Update writes the name and the parent of the category and reads back the other columns, ErrConflict is
+	// returned if the parent has another category with the same name
+	Update(category *models.Category) error
+	// Delete deletes the category by id, leaving its products without a category. ErrReferenced is returned if it
+	// has subcategories
+	Delete(categoryID uuid.UUID) error
+}
+
+// PayoutRepository reads and writes the payouts of the sellers. Lookups of missing payouts return db.ErrNoMatch
+type PayoutRepository interface {
+	GetByID(payoutID uuid.UUID) (*models.Payout, error)
+	// GetForUpdate returns the payout by id, locking it until the end of the transaction
+	GetForUpdate(payoutID uuid.UUID) (*models.Payout, error)
+	// List returns the payouts of the seller, or all payouts for uuid.Nil, newest first
+	List(sellerID uuid.UUID) ([]*models.Payout, error)
+	// HasRequested returns true if the seller has a payout waiting for approval
+	HasRequested(sellerID uuid.UUID) (bool, error)
+	// ListUnpaidSales returns the completed and failed purchases of the seller that are not items of a payout
+	// unless the payout was rejected
+	ListUnpaidSales(sellerID uuid.UUID) ([]*models.Purchase, error)
+	// Insert adds the payout with the purchases by id as its items, filling in its creation time
+	Insert(payout *models.Payout, purchaseIDs []uuid.UUID) error
+	// UpdateDecision writes the status, the provider reference, the note and the decider of the payout
+	UpdateDecision(payout *models.Payout) error
+	// ListSales returns the purchases that are items of the payout, oldest first
+	ListSales(payoutID uuid.UUID) ([]*payloads.PayoutSale, error)
+}
+
+// SessionRepository reads and writes the sessions of the users. Lookups of missing sessions return db.ErrNoMatch
+type SessionRepository interface {
+	// GetForUpdate returns the session by id, locking it until the end of the transaction
+	GetForUpdate(sessionID uuid.UUID) (*models.Session, error)
+	// ListActive returns the sessions of the user that have not ended or expired, most recently seen first
+	ListActive(userID uuid.UUID) ([]*models.Session, error)
+	// HasActive returns true if the user has a session that has not ended or expired
+	HasActive(userID uuid.UUID) (bool, error)
+	// Insert adds the session, filling in its creation and last seen times
+	Insert(session *models.Session) error
+	// Refresh writes the access token id and the expiry of the session and marks it as seen now
+	Refresh(session *models.Session) error
+	// End ends the session by id, if it has not ended yet
+	End(sessionID uuid.UUID) error
+	// EndByJTI ends the session of the user the access token with the given id was issued for
+	EndByJTI(userID uuid.UUID, jti string) error
+	// EndAll ends all sessions of the user, except the one of the access token with the given id, if any
+	EndAll(userID uuid.UUID, exceptJTI string) error
+	// TouchSession marks the active session of the access token with the given id as seen, returning false if
+	// there is no such session or it has ended or expired
+	TouchSession(jti string) (bool, error)
+}
+
+// RefreshTokenRepository reads and writes the refresh tokens of the sessions, which are looked up by their hash.
+// Lookups of missing tokens return db.ErrNoMatch
+type RefreshTokenRepository interface {
+	// GetByHashForUpdate returns the refresh token with the hash, locking it until the end of the transaction
+	GetByHashForUpdate(tokenHash string) (*models.RefreshToken, error)
+	Insert(token *models.RefreshToken) error
+	// Revoke revokes the refresh token now
+	Revoke(token *models.RefreshToken) error
+	// RevokeByHash revokes the refresh token of the user with the hash, unless it was revoked before, and returns it
+	RevokeByHash(userID uuid.UUID, tokenHash string) (*models.RefreshToken, error)
+}
+
+// RevokedTokenRepository keeps the denylist of access tokens that were revoked before they expired
+type RevokedTokenRepository interface {
+	// Revoke puts the access token with the given id on the denylist until it expires, dropping the entries of
+	// tokens that have expired in the meantime
+	Revoke(jti string, expiresAt time.Time) error
+	// IsRevoked returns true if the access token with the given id is on the denylist
+	IsRevoked(jti string) (bool, error)
+}
+
+// IdempotencyKeyRepository reads and writes the idempotency keys of the users with the responses they stored.
+// Lookups of missing keys return db.ErrNoMatch
+type IdempotencyKeyRepository interface {
+	Get(userID uuid.UUID, key string) (*models.IdempotencyKey, error)
+	// Insert claims the key for its user, filling in its creation time. It returns false without changing anything
+	// if the user has the key already
+	Insert(idempotencyKey *models.IdempotencyKey) (bool, error)
+	// Complete stores the status, content type and body of the key as its response, completed now
+	Complete(idempotencyKey *models.IdempotencyKey) error
+	Delete(userID uuid.UUID, key string) error
+	// DeleteCreatedBefore deletes the keys of the user that were created before the time
+	DeleteCreatedBefore(userID uuid.UUID, before time.Time) error
+}
+
+// SyncEventRepository reads and appends to the events that machines synced. Lookups of missing events return
+// db.ErrNoMatch
+type SyncEventRepository interface {
+	GetByID(eventID uuid.UUID) (*models.SyncEvent, error)
+	// LastApplied returns the sequence of the last event of the machine and the time the last event was applied,
+	// zero and nil if the machine has not synced any event yet
+	LastApplied(machineID uuid.UUID) (int64, *time.Time, error)
+	// Insert appends the event, filling in the time it was applied
+	Insert(event *models.SyncEvent) error
+}
+
+// Session gives access to the repositories, either on the whole store or within a transaction
+type Session interface {
+	Users() UserRepository
+	Products() ProductRepository
+	Purchases() PurchaseRepository
+	Machines() MachineRepository
+	Slots() SlotRepository
+	Coins() CoinRepository
+	Journal() JournalRepository
+	Promotions() PromotionRepository
+	Prices() PriceRepository
+	Categories() CategoryRepository
+	Payouts() PayoutRepository
+	Sessions() SessionRepository
+	RefreshTokens() RefreshTokenRepository
+	RevokedTokens() RevokedTokenRepository
+	IdempotencyKeys() IdempotencyKeyRepository
+	SyncEvents() SyncEventRepository
+}
+
+// Store holds all records of the application. Used as a Session every call runs on its own, RunInTransaction
+// runs several calls in a transaction that is committed when fn returns nil and rolled back otherwise, calling the
+// commit notifier of ctx once it has committed
+type Store interface {
+	Session
+	RunInTransaction(ctx context.Context, fn func(tx Session) error) error
+}
+
+// commitNotifierKey is the context key of the function stores call once a transaction has committed
+type commitNotifierKey struct{}
+
+// WithCommitNotifier returns a copy of ctx on which every store calls notify once a transaction run with it has
+// committed, e.g. for callers that need to know whether a request changed anything before it failed
+func WithCommitNotifier(ctx context.Context, notify func()) context.Context {
+	return context.WithValue(ctx, commitNotifierKey{}, notify)
+}
+
+// notifyCommit calls the commit notifier of ctx, if it has one
+func notifyCommit(ctx context.Context) {
+	if notify, ok := ctx.Value(commitNotifierKey{}).(func()); ok {
+		notify()
+	}
+}
+
+// NewStore returns the store of the database, the SQLite store when the sqlite driver is configured, an empty
+// MemoryStore for the memory driver and the Postgres store otherwise
+func NewStore(database *db.Database) Store {
+	if database.IsMemory() {
+		return NewMemoryStore()
+	}
+	if database.IsSQLite() {
+		return NewSQLiteStore(database.GetSQLite())
+	}
+	return NewPGStore(database.GetDB())
+}
+
+var (
+	storeDefaultInstance     Store
+	storeDefaultInstanceOnce sync.Once
+)
+
+// GetStoreDefaultInstance returns the store of the default database, shared by the default authentication and
+// services so that the memory driver keeps one set of data
+func GetStoreDefaultInstance() Store {
+	storeDefaultInstanceOnce.Do(func() {
+		storeDefaultInstance = NewStore(db.GetDefaultInstance())
+	})
+	return storeDefaultInstance
+}
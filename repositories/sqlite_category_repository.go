@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqliteCategoryColumns are the columns scanned by scanCategory
+const sqliteCategoryColumns = "id, parent_id, name, created_at"
+
+// sqliteCategoryRepository is the CategoryRepository kept in SQLite
+type sqliteCategoryRepository struct {
+	db sqliteDB
+}
+
+// scanCategory scans a row of the category columns
+func scanCategory(row sqliteRow) (*models.Category, error) {
+	category := &models.Category{}
+	err := row.Scan(sqliteUUID{&category.ID}, sqliteUUID{&category.ParentID}, &category.Name, &category.CreatedAt)
+	if err == sql.ErrNoRows {
+		return category, db.ErrNoMatch
+	}
+	return category, err
+}
+
+// GetByID returns the category by id
+func (r *sqliteCategoryRepository) GetByID(categoryID uuid.UUID) (*models.Category, error) {
+	return scanCategory(r.db.QueryRow("SELECT "+sqliteCategoryColumns+" FROM categories WHERE id = ?",
+		categoryID.String()))
+}
+
+// List returns all categories ordered by name ignoring case
+func (r *sqliteCategoryRepository) List() ([]*models.Category, error) {
+	categories := make([]*models.Category, 0)
+	rows, err := r.db.Query("SELECT " + sqliteCategoryColumns + " FROM categories ORDER BY lower(name)")
+	if err != nil {
+		return categories, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return categories, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// LockTree does nothing, the transaction locks the whole database already
+func (r *sqliteCategoryRepository) LockTree() error {
+	return nil
+}
+
+// Insert adds the category, ErrConflict is returned if its parent has a category with the same name
+func (r *sqliteCategoryRepository) Insert(category *models.Category) error {
+	if category.CreatedAt.IsZero() {
+		category.CreatedAt = time.Now()
+	}
+	_, err := r.db.Exec("INSERT INTO categories ("+sqliteCategoryColumns+") VALUES (?, ?, ?, ?)",
+		category.ID.String(), nullUUID(category.ParentID), category.Name, category.CreatedAt.UTC())
+	return sqliteReferencedError(sqliteConflictError(err))
+}
+
+// Update writes the name and the parent of the category and reads back its creation time
+func (r *sqliteCategoryRepository) Update(category *models.Category) error {
+	result, err := r.db.Exec("UPDATE categories SET name = ?, parent_id = ? WHERE id = ?",
+		category.Name, nullUUID(category.ParentID), category.ID.String())
+	if err != nil {
+		return sqliteReferencedError(sqliteConflictError(err))
+	}
+	if err := affectedRow(result); err != nil {
+		return err
+	}
+	return r.db.QueryRow("SELECT created_at FROM categories WHERE id = ?", category.ID.String()).
+		Scan(&category.CreatedAt)
+}
+
+// Delete deletes the category by id, the trigger on the categories leaves its products without a category while
+// the foreign key of its subcategories restricts it
+func (r *sqliteCategoryRepository) Delete(categoryID uuid.UUID) error {
+	result, err := r.db.Exec("DELETE FROM categories WHERE id = ?", categoryID.String())
+	if err != nil {
+		return sqliteReferencedError(err)
+	}
+	return affectedRow(result)
+}
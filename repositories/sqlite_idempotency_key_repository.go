@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqliteIdempotencyKeyRepository is the IdempotencyKeyRepository kept in SQLite
+type sqliteIdempotencyKeyRepository struct {
+	db sqliteDB
+}
+
+// Get returns the idempotency key of the user
+func (r *sqliteIdempotencyKeyRepository) Get(userID uuid.UUID, key string) (*models.IdempotencyKey, error) {
+	idempotencyKey := &models.IdempotencyKey{}
+	err := r.db.QueryRow(`
+		SELECT user_id, idempotency_key, request_hash, coalesce(status, 0), coalesce(content_type, ''), body,
+			created_at, completed_at
+		FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?`, userID.String(), key).
+		Scan(sqliteUUID{&idempotencyKey.UserID}, &idempotencyKey.IdempotencyKey, &idempotencyKey.RequestHash,
+			&idempotencyKey.Status, &idempotencyKey.ContentType, &idempotencyKey.Body, &idempotencyKey.CreatedAt,
+			&idempotencyKey.CompletedAt)
+	if err == sql.ErrNoRows {
+		return idempotencyKey, db.ErrNoMatch
+	}
+	return idempotencyKey, err
+}
+
+// Insert claims the key, the transaction locks the whole database already so a concurrent claim of the same key
+// sees this one
+func (r *sqliteIdempotencyKeyRepository) Insert(idempotencyKey *models.IdempotencyKey) (bool, error) {
+	createdAt := idempotencyKey.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	result, err := r.db.Exec(`
+		INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, idempotency_key) DO NOTHING`,
+		idempotencyKey.UserID.String(), idempotencyKey.IdempotencyKey, idempotencyKey.RequestHash, createdAt.UTC())
+	if err != nil {
+		return false, sqliteReferencedError(err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil || inserted == 0 {
+		return false, err
+	}
+	idempotencyKey.CreatedAt = createdAt
+	return true, nil
+}
+
+// Complete stores the response of the key
+func (r *sqliteIdempotencyKeyRepository) Complete(idempotencyKey *models.IdempotencyKey) error {
+	completedAt := time.Now()
+	result, err := r.db.Exec(`
+		UPDATE idempotency_keys SET status = ?, content_type = ?, body = ?, completed_at = ?
+		WHERE user_id = ? AND idempotency_key = ?`,
+		idempotencyKey.Status, idempotencyKey.ContentType, idempotencyKey.Body, completedAt.UTC(),
+		idempotencyKey.UserID.String(), idempotencyKey.IdempotencyKey)
+	if err != nil {
+		return err
+	}
+	if err := affectedRow(result); err != nil {
+		return err
+	}
+	idempotencyKey.CompletedAt = &completedAt
+	return nil
+}
+
+// Delete deletes the idempotency key of the user
+func (r *sqliteIdempotencyKeyRepository) Delete(userID uuid.UUID, key string) error {
+	_, err := r.db.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?", userID.String(), key)
+	return err
+}
+
+// DeleteCreatedBefore deletes the keys of the user created before the time
+func (r *sqliteIdempotencyKeyRepository) DeleteCreatedBefore(userID uuid.UUID, before time.Time) error {
+	_, err := r.db.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND created_at < ?", userID.String(), before.UTC())
+	return err
+}
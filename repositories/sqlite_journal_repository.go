@@ -0,0 +1,167 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqliteJournalRepository is the JournalRepository kept in SQLite
+type sqliteJournalRepository struct {
+	db sqliteDB
+}
+
+// GetAccount returns the account of the type and owner
+func (r *sqliteJournalRepository) GetAccount(accountType models.AccountType, ownerID uuid.UUID) (*models.Account, error) {
+	account := &models.Account{}
+	err := r.db.QueryRow("SELECT id, type, owner_id, balance, created_at FROM accounts WHERE type = ? AND owner_id = ?",
+		accountType, ownerID.String()).
+		Scan(sqliteUUID{&account.ID}, &account.Type, sqliteUUID{&account.OwnerID}, &account.Balance, &account.CreatedAt)
+	if err == sql.ErrNoRows {
+		return account, db.ErrNoMatch
+	}
+	return account, err
+}
+
+// GetOrCreateAccount returns the account of the type and owner, creating it if it does not exist yet
+func (r *sqliteJournalRepository) GetOrCreateAccount(accountType models.AccountType, ownerID uuid.UUID) (*models.Account, error) {
+	_, err := r.db.Exec(`
+		INSERT INTO accounts (id, type, owner_id, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (type, owner_id) DO NOTHING`,
+		uuid.NewV4().String(), accountType, ownerID.String(), time.Now().UTC())
+	if err != nil {
+		return &models.Account{}, err
+	}
+	return r.GetAccount(accountType, ownerID)
+}
+
+// InsertTransaction appends the transaction with its entries and adds them to the balances of their accounts in the
+// order of the entries
+func (r *sqliteJournalRepository) InsertTransaction(transaction *models.JournalTransaction) error {
+	now := time.Now()
+	if transaction.ID == uuid.Nil {
+		transaction.ID = uuid.NewV4()
+	}
+	if transaction.CreatedAt.IsZero() {
+		transaction.CreatedAt = now
+	}
+	_, err := r.db.Exec("INSERT INTO journal_transactions (id, kind, reference_id, request_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		transaction.ID.String(), transaction.Kind, nullUUID(transaction.ReferenceID), nullString(transaction.RequestID),
+		transaction.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range transaction.Entries {
+		if entry.ID == uuid.Nil {
+			entry.ID = uuid.NewV4()
+		}
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = now
+		}
+		entry.TransactionID = transaction.ID
+		_, err := r.db.Exec("INSERT INTO journal_entries (id, transaction_id, account_id, amount, created_at) VALUES (?, ?, ?, ?, ?)",
+			entry.ID.String(), entry.TransactionID.String(), entry.AccountID.String(), entry.Amount, entry.CreatedAt.UTC())
+		if err != nil {
+			return sqliteReferencedError(err)
+		}
+		if _, err := r.db.Exec("UPDATE accounts SET balance = balance + ? WHERE id = ?", entry.Amount, entry.AccountID.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListRevenueEntries returns the latest entries of the account with the transactions they belong to
+func (r *sqliteJournalRepository) ListRevenueEntries(accountID uuid.UUID, limit int) ([]*payloads.RevenueEntry, error) {
+	entries := make([]*payloads.RevenueEntry, 0)
+	rows, err := r.db.Query(`
+		SELECT journal_entries.transaction_id, journal_transactions.kind, journal_transactions.reference_id,
+			-journal_entries.amount, journal_entries.created_at
+		FROM journal_entries
+		JOIN journal_transactions ON journal_transactions.id = journal_entries.transaction_id
+		WHERE journal_entries.account_id = ?
+		ORDER BY journal_entries.created_at DESC, journal_entries.rowid DESC
+		LIMIT ?`, accountID.String(), limit)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry := &payloads.RevenueEntry{}
+		err := rows.Scan(sqliteUUID{&entry.TransactionID}, &entry.Kind, sqliteUUID{&entry.ReferenceID}, &entry.Amount,
+			&entry.CreatedAt)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Reconcile compares the deposits with the wallets, and the transactions and the accounts with their entries. Ids
+// are stored as text, which orders them like their bytes
+func (r *sqliteJournalRepository) Reconcile() (*payloads.Reconciliation, error) {
+	reconciliation := &payloads.Reconciliation{
+		DepositMismatches:      make([]*payloads.DepositMismatch, 0),
+		UnbalancedTransactions: make([]uuid.UUID, 0),
+		MisstatedAccounts:      make([]uuid.UUID, 0),
+	}
+	rows, err := r.db.Query(`
+		SELECT u.id, coalesce(u.deposit, 0), coalesce(-a.balance, 0)
+		FROM users AS u
+		LEFT JOIN accounts AS a ON a.type = ? AND a.owner_id = u.id
+		WHERE coalesce(u.deposit, 0) <> coalesce(-a.balance, 0)
+		ORDER BY u.id`, models.AccountTypeBuyerWallet)
+	if err != nil {
+		return reconciliation, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		mismatch := &payloads.DepositMismatch{}
+		if err := rows.Scan(sqliteUUID{&mismatch.UserID}, &mismatch.Deposit, &mismatch.WalletBalance); err != nil {
+			return reconciliation, err
+		}
+		reconciliation.DepositMismatches = append(reconciliation.DepositMismatches, mismatch)
+	}
+	if err := rows.Err(); err != nil {
+		return reconciliation, err
+	}
+
+	reconciliation.UnbalancedTransactions, err = r.selectIDs(`
+		SELECT transaction_id FROM journal_entries
+		GROUP BY transaction_id HAVING sum(amount) <> 0
+		ORDER BY transaction_id`)
+	if err != nil {
+		return reconciliation, err
+	}
+	reconciliation.MisstatedAccounts, err = r.selectIDs(`
+		SELECT a.id FROM accounts AS a
+		LEFT JOIN journal_entries AS e ON e.account_id = a.id
+		GROUP BY a.id, a.balance
+		HAVING a.balance <> coalesce(sum(e.amount), 0)
+		ORDER BY a.id`)
+	return reconciliation, err
+}
+
+// selectIDs returns the ids selected by the query
+func (r *sqliteJournalRepository) selectIDs(query string) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0)
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(sqliteUUID{&id}); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,227 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqliteMachineColumns are the columns scanned by scanMachine
+const sqliteMachineColumns = "id, operator_id, name, coalesce(location, ''), created_at"
+
+// sqliteMachineRepository is the MachineRepository kept in SQLite
+type sqliteMachineRepository struct {
+	db sqliteDB
+}
+
+// scanMachine scans a row of the machine columns
+func scanMachine(row sqliteRow) (*models.Machine, error) {
+	machine := &models.Machine{}
+	err := row.Scan(sqliteUUID{&machine.ID}, sqliteUUID{&machine.OperatorID}, &machine.Name, &machine.Location,
+		&machine.CreatedAt)
+	if err == sql.ErrNoRows {
+		return machine, db.ErrNoMatch
+	}
+	return machine, err
+}
+
+// GetByID returns the machine by id, without its slots
+func (r *sqliteMachineRepository) GetByID(machineID uuid.UUID) (*models.Machine, error) {
+	return scanMachine(r.db.QueryRow("SELECT "+sqliteMachineColumns+" FROM machines WHERE id = ?", machineID.String()))
+}
+
+// GetWithSlots returns the machine by id with its slots and the products they hold
+func (r *sqliteMachineRepository) GetWithSlots(machineID uuid.UUID) (*models.Machine, error) {
+	machine, err := r.GetByID(machineID)
+	if err != nil {
+		return machine, err
+	}
+	machine.Slots, err = (&sqliteSlotRepository{db: r.db}).List(machineID)
+	return machine, err
+}
+
+// GetForUpdate returns the machine by id, the transaction locks the whole database already
+func (r *sqliteMachineRepository) GetForUpdate(machineID uuid.UUID) (*models.Machine, error) {
+	return r.GetByID(machineID)
+}
+
+// List returns all machines, oldest first
+func (r *sqliteMachineRepository) List() ([]*models.Machine, error) {
+	machines := make([]*models.Machine, 0)
+	rows, err := r.db.Query("SELECT " + sqliteMachineColumns + " FROM machines ORDER BY created_at, id")
+	if err != nil {
+		return machines, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		machine, err := scanMachine(rows)
+		if err != nil {
+			return machines, err
+		}
+		machines = append(machines, machine)
+	}
+	return machines, rows.Err()
+}
+
+// Insert adds the machine, filling in its creation time
+func (r *sqliteMachineRepository) Insert(machine *models.Machine) error {
+	if machine.CreatedAt.IsZero() {
+		machine.CreatedAt = time.Now()
+	}
+	_, err := r.db.Exec("INSERT INTO machines (id, operator_id, name, location, created_at) VALUES (?, ?, ?, ?, ?)",
+		machine.ID.String(), nullUUID(machine.OperatorID), machine.Name, nullString(machine.Location),
+		machine.CreatedAt.UTC())
+	return sqliteConflictError(err)
+}
+
+// sqliteSlotColumns are the columns scanned by scanSlot
+const sqliteSlotColumns = "id, machine_id, code, product_id, capacity, quantity"
+
+// sqliteSlotRepository is the SlotRepository kept in SQLite
+type sqliteSlotRepository struct {
+	db sqliteDB
+}
+
+// scanSlot scans a row of the slot columns
+func scanSlot(row sqliteRow) (*models.Slot, error) {
+	slot := &models.Slot{}
+	err := row.Scan(sqliteUUID{&slot.ID}, sqliteUUID{&slot.MachineID}, &slot.Code, sqliteUUID{&slot.ProductID},
+		&slot.Capacity, &slot.Quantity)
+	if err == sql.ErrNoRows {
+		return slot, db.ErrNoMatch
+	}
+	return slot, err
+}
+
+// selectSlots returns the slots selected by the query
+func (r *sqliteSlotRepository) selectSlots(query string, args ...interface{}) ([]*models.Slot, error) {
+	slots := make([]*models.Slot, 0)
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return slots, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		slot, err := scanSlot(rows)
+		if err != nil {
+			return slots, err
+		}
+		slots = append(slots, slot)
+	}
+	return slots, rows.Err()
+}
+
+// List returns the slots of the machine ordered by code, with the products they hold
+func (r *sqliteSlotRepository) List(machineID uuid.UUID) ([]*models.Slot, error) {
+	slots, err := r.selectSlots("SELECT "+sqliteSlotColumns+" FROM slots WHERE machine_id = ? ORDER BY code",
+		machineID.String())
+	if err != nil {
+		return slots, err
+	}
+
+	rows, err := r.db.Query("SELECT "+sqliteProductColumns+" FROM products "+
+		"WHERE id IN (SELECT product_id FROM slots WHERE machine_id = ?)", machineID.String())
+	if err != nil {
+		return slots, err
+	}
+	defer rows.Close()
+	products := make(map[uuid.UUID]*models.Product)
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return slots, err
+		}
+		products[product.ID] = product
+	}
+	for _, slot := range slots {
+		slot.Product = products[slot.ProductID]
+	}
+	return slots, rows.Err()
+}
+
+// ListProductForUpdate returns the slots of the machine holding the product ordered by code, the transaction locks
+// the whole database already
+func (r *sqliteSlotRepository) ListProductForUpdate(machineID uuid.UUID, productID uuid.UUID) ([]*models.Slot, error) {
+	return r.selectSlots("SELECT "+sqliteSlotColumns+" FROM slots WHERE machine_id = ? AND product_id = ? ORDER BY code",
+		machineID.String(), productID.String())
+}
+
+// GetByCodeForUpdate returns the slot of the machine with the code, the transaction locks the whole database already
+func (r *sqliteSlotRepository) GetByCodeForUpdate(machineID uuid.UUID, code string) (*models.Slot, error) {
+	return scanSlot(r.db.QueryRow("SELECT "+sqliteSlotColumns+" FROM slots WHERE machine_id = ? AND code = ?",
+		machineID.String(), code))
+}
+
+// Upsert puts the slot into its machine, replacing the slot with the same code and reading back its id
+func (r *sqliteSlotRepository) Upsert(slot *models.Slot) error {
+	if slot.ID == uuid.Nil {
+		slot.ID = uuid.NewV4()
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO slots (id, machine_id, code, product_id, capacity, quantity)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (machine_id, code) DO UPDATE
+		SET product_id = excluded.product_id, capacity = excluded.capacity, quantity = excluded.quantity`,
+		slot.ID.String(), slot.MachineID.String(), slot.Code, nullUUID(slot.ProductID), slot.Capacity, slot.Quantity)
+	if err != nil {
+		return sqliteReferencedError(err)
+	}
+	return r.db.QueryRow("SELECT id FROM slots WHERE machine_id = ? AND code = ?", slot.MachineID.String(), slot.Code).
+		Scan(sqliteUUID{&slot.ID})
+}
+
+// SetQuantity writes the quantity of the slot
+func (r *sqliteSlotRepository) SetQuantity(slot *models.Slot) error {
+	_, err := r.db.Exec("UPDATE slots SET quantity = ? WHERE id = ?", slot.Quantity, slot.ID.String())
+	return err
+}
+
+// sqliteCoinRepository is the CoinRepository kept in SQLite
+type sqliteCoinRepository struct {
+	db sqliteDB
+}
+
+// List returns the coins of the machine, highest denomination first
+func (r *sqliteCoinRepository) List(machineID uuid.UUID) ([]*models.CoinInventory, error) {
+	coins := make([]*models.CoinInventory, 0)
+	rows, err := r.db.Query("SELECT machine_id, denomination, count FROM coin_inventory WHERE machine_id = ? "+
+		"ORDER BY denomination DESC", machineID.String())
+	if err != nil {
+		return coins, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		coin := &models.CoinInventory{}
+		if err := rows.Scan(sqliteUUID{&coin.MachineID}, &coin.Denomination, &coin.Count); err != nil {
+			return coins, err
+		}
+		coins = append(coins, coin)
+	}
+	return coins, rows.Err()
+}
+
+// ListForUpdate returns the coins of the machine, the transaction locks the whole database already
+func (r *sqliteCoinRepository) ListForUpdate(machineID uuid.UUID) ([]*models.CoinInventory, error) {
+	return r.List(machineID)
+}
+
+// Add adds the coins to the tube of the denomination in the machine, creating it if it does not exist. SQLite checks
+// the count of the inserted row before it updates the existing one, so coins are taken by an update
+func (r *sqliteCoinRepository) Add(machineID uuid.UUID, denomination int32, count int32) error {
+	if count < 0 {
+		result, err := r.db.Exec("UPDATE coin_inventory SET count = count + ? WHERE machine_id = ? AND denomination = ?",
+			count, machineID.String(), denomination)
+		if err != nil {
+			return err
+		}
+		return affectedRow(result)
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO coin_inventory (machine_id, denomination, count) VALUES (?, ?, ?)
+		ON CONFLICT (machine_id, denomination) DO UPDATE SET count = count + excluded.count`,
+		machineID.String(), denomination, count)
+	return err
+}
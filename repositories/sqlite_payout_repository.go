@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqlitePayoutColumns are the columns scanned by scanPayout
+const sqlitePayoutColumns = "id, seller_id, amount, sales, status, coalesce(provider_reference, ''), coalesce(note, ''), " +
+	"decided_by, decided_at, created_at"
+
+// sqlitePayoutRepository is the PayoutRepository kept in SQLite
+type sqlitePayoutRepository struct {
+	db sqliteDB
+}
+
+// scanPayout scans a row of the payout columns
+func scanPayout(row sqliteRow) (*models.Payout, error) {
+	payout := &models.Payout{}
+	err := row.Scan(sqliteUUID{&payout.ID}, sqliteUUID{&payout.SellerID}, &payout.Amount, &payout.Sales, &payout.Status,
+		&payout.ProviderReference, &payout.Note, sqliteUUID{&payout.DecidedBy}, &payout.DecidedAt, &payout.CreatedAt)
+	if err == sql.ErrNoRows {
+		return payout, db.ErrNoMatch
+	}
+	return payout, err
+}
+
+// GetByID returns the payout by id
+func (r *sqlitePayoutRepository) GetByID(payoutID uuid.UUID) (*models.Payout, error) {
+	return scanPayout(r.db.QueryRow("SELECT "+sqlitePayoutColumns+" FROM payouts WHERE id = ?", payoutID.String()))
+}
+
+// GetForUpdate returns the payout by id, the transaction locks the whole database already
+func (r *sqlitePayoutRepository) GetForUpdate(payoutID uuid.UUID) (*models.Payout, error) {
+	return r.GetByID(payoutID)
+}
+
+// List returns the payouts of the seller, or all payouts for uuid.Nil, newest first
+func (r *sqlitePayoutRepository) List(sellerID uuid.UUID) ([]*models.Payout, error) {
+	payouts := make([]*models.Payout, 0)
+	rows, err := r.db.Query("SELECT "+sqlitePayoutColumns+" FROM payouts WHERE ? IS NULL OR seller_id = ? "+
+		"ORDER BY created_at DESC, id DESC", nullUUID(sellerID), nullUUID(sellerID))
+	if err != nil {
+		return payouts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		payout, err := scanPayout(rows)
+		if err != nil {
+			return payouts, err
+		}
+		payouts = append(payouts, payout)
+	}
+	return payouts, rows.Err()
+}
+
+// HasRequested returns true if the seller has a payout waiting for approval
+func (r *sqlitePayoutRepository) HasRequested(sellerID uuid.UUID) (bool, error) {
+	var requested bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM payouts WHERE seller_id = ? AND status = ?)",
+		sellerID.String(), models.PayoutStatusRequested).Scan(&requested)
+	return requested, err
+}
+
+// ListUnpaidSales returns the completed and failed purchases of the seller that no payout includes, except rejected
+// ones, with their id, total and platform fee
+func (r *sqlitePayoutRepository) ListUnpaidSales(sellerID uuid.UUID) ([]*models.Purchase, error) {
+	sales := make([]*models.Purchase, 0)
+	rows, err := r.db.Query(`
+		SELECT purchase.id, purchase.total, purchase.platform_fee FROM purchases AS purchase
+		WHERE purchase.seller_id = ? AND purchase.status IN (?, ?)
+			AND NOT EXISTS (
+				SELECT 1 FROM payout_items AS item
+				JOIN payouts AS payout ON payout.id = item.payout_id
+				WHERE item.purchase_id = purchase.id AND payout.status <> ?
+			)`,
+		sellerID.String(), models.PurchaseStatusCompleted, models.PurchaseStatusFailed, models.PayoutStatusRejected)
+	if err != nil {
+		return sales, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		sale := &models.Purchase{}
+		if err := rows.Scan(sqliteUUID{&sale.ID}, &sale.Total, &sale.PlatformFee); err != nil {
+			return sales, err
+		}
+		sales = append(sales, sale)
+	}
+	return sales, rows.Err()
+}
+
+// Insert adds the payout with its items, filling in its status and creation time
+func (r *sqlitePayoutRepository) Insert(payout *models.Payout, purchaseIDs []uuid.UUID) error {
+	if payout.Status == "" {
+		payout.Status = models.PayoutStatusRequested
+	}
+	if payout.CreatedAt.IsZero() {
+		payout.CreatedAt = time.Now()
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO payouts (id, seller_id, amount, sales, status, provider_reference, note, decided_by, decided_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		payout.ID.String(), payout.SellerID.String(), payout.Amount, payout.Sales, payout.Status,
+		nullString(payout.ProviderReference), nullString(payout.Note), nullUUID(payout.DecidedBy),
+		utcTime(payout.DecidedAt), payout.CreatedAt.UTC())
+	if err != nil {
+		return sqliteReferencedError(sqliteConflictError(err))
+	}
+	for _, purchaseID := range purchaseIDs {
+		_, err := r.db.Exec("INSERT INTO payout_items (payout_id, purchase_id) VALUES (?, ?)",
+			payout.ID.String(), purchaseID.String())
+		if err != nil {
+			return sqliteReferencedError(err)
+		}
+	}
+	return nil
+}
+
+// UpdateDecision writes the decision on the payout
+func (r *sqlitePayoutRepository) UpdateDecision(payout *models.Payout) error {
+	_, err := r.db.Exec(`
+		UPDATE payouts SET status = ?, provider_reference = ?, note = ?, decided_by = ?, decided_at = ?
+		WHERE id = ?`,
+		payout.Status, nullString(payout.ProviderReference), nullString(payout.Note), nullUUID(payout.DecidedBy),
+		utcTime(payout.DecidedAt), payout.ID.String())
+	return err
+}
+
+// ListSales returns the purchases that are items of the payout with their net revenue, oldest first
+func (r *sqlitePayoutRepository) ListSales(payoutID uuid.UUID) ([]*payloads.PayoutSale, error) {
+	sales := make([]*payloads.PayoutSale, 0)
+	rows, err := r.db.Query(`
+		SELECT purchase.id, purchase.product_id, purchase.refund_of, purchase.quantity, purchase.total,
+			purchase.platform_fee, purchase.total - purchase.platform_fee, purchase.created_at
+		FROM purchases AS purchase
+		JOIN payout_items AS item ON item.purchase_id = purchase.id
+		WHERE item.payout_id = ?
+		ORDER BY purchase.created_at, purchase.id`, payoutID.String())
+	if err != nil {
+		return sales, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		sale := &payloads.PayoutSale{}
+		err := rows.Scan(sqliteUUID{&sale.PurchaseID}, sqliteUUID{&sale.ProductID}, sqliteUUID{&sale.RefundOf},
+			&sale.Quantity, &sale.Total, &sale.PlatformFee, &sale.Net, &sale.CreatedAt)
+		if err != nil {
+			return sales, err
+		}
+		sales = append(sales, sale)
+	}
+	return sales, rows.Err()
+}
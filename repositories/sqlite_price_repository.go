@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqlitePriceColumns are the columns scanned by scanPrice
+const sqlitePriceColumns = "id, product_id, cost, effective_from, effective_to, created_by, created_at"
+
+// sqlitePriceRepository is the PriceRepository kept in SQLite
+type sqlitePriceRepository struct {
+	db sqliteDB
+}
+
+// scanPrice scans a row of the price columns
+func scanPrice(row sqliteRow) (*models.ProductPrice, error) {
+	price := &models.ProductPrice{}
+	err := row.Scan(sqliteUUID{&price.ID}, sqliteUUID{&price.ProductID}, &price.Cost, &price.EffectiveFrom,
+		&price.EffectiveTo, sqliteUUID{&price.CreatedBy}, &price.CreatedAt)
+	if err == sql.ErrNoRows {
+		return price, db.ErrNoMatch
+	}
+	return price, err
+}
+
+// selectPrices returns the prices selected by the query
+func (r *sqlitePriceRepository) selectPrices(query string, args ...interface{}) ([]*models.ProductPrice, error) {
+	prices := make([]*models.ProductPrice, 0)
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return prices, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		price, err := scanPrice(rows)
+		if err != nil {
+			return prices, err
+		}
+		prices = append(prices, price)
+	}
+	return prices, rows.Err()
+}
+
+// List returns the prices of the product, oldest first
+func (r *sqlitePriceRepository) List(productID uuid.UUID) ([]*models.ProductPrice, error) {
+	return r.selectPrices("SELECT "+sqlitePriceColumns+" FROM product_prices WHERE product_id = ? ORDER BY effective_from",
+		productID.String())
+}
+
+// GetAt returns the price of the product effective at the time
+func (r *sqlitePriceRepository) GetAt(productID uuid.UUID, at time.Time) (*models.ProductPrice, error) {
+	return scanPrice(r.db.QueryRow("SELECT "+sqlitePriceColumns+" FROM product_prices "+
+		"WHERE product_id = ? AND effective_from <= ? AND (effective_to IS NULL OR effective_to > ?)",
+		productID.String(), at.UTC(), at.UTC()))
+}
+
+// ListBetween returns the prices of the product effective at any time from from until to, oldest first
+func (r *sqlitePriceRepository) ListBetween(productID uuid.UUID, from time.Time, to time.Time) ([]*models.ProductPrice, error) {
+	return r.selectPrices("SELECT "+sqlitePriceColumns+" FROM product_prices "+
+		"WHERE product_id = ? AND effective_from <= ? AND (effective_to IS NULL OR effective_to > ?) "+
+		"ORDER BY effective_from", productID.String(), to.UTC(), from.UTC())
+}
+
+// ListScheduled returns the prices of the products that become effective after the time
+func (r *sqlitePriceRepository) ListScheduled(productIDs []uuid.UUID, after time.Time) ([]*models.ProductPrice, error) {
+	if len(productIDs) == 0 {
+		return make([]*models.ProductPrice, 0), nil
+	}
+	placeholders := make([]string, len(productIDs))
+	args := make([]interface{}, 0, len(productIDs)+1)
+	for i, productID := range productIDs {
+		placeholders[i] = "?"
+		args = append(args, productID.String())
+	}
+	return r.selectPrices("SELECT "+sqlitePriceColumns+" FROM product_prices "+
+		"WHERE product_id IN ("+strings.Join(placeholders, ", ")+") AND effective_from > ? "+
+		"ORDER BY product_id, effective_from", append(args, after.UTC())...)
+}
+
+// Insert adds the price, filling in its creation time
+func (r *sqlitePriceRepository) Insert(price *models.ProductPrice) error {
+	if price.CreatedAt.IsZero() {
+		price.CreatedAt = time.Now()
+	}
+	_, err := r.db.Exec("INSERT INTO product_prices ("+sqlitePriceColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		price.ID.String(), price.ProductID.String(), price.Cost, price.EffectiveFrom.UTC(), utcTime(price.EffectiveTo),
+		nullUUID(price.CreatedBy), price.CreatedAt.UTC())
+	return sqliteConflictError(err)
+}
+
+// Update writes the cost, the end and the creator of the price
+func (r *sqlitePriceRepository) Update(price *models.ProductPrice) error {
+	_, err := r.db.Exec("UPDATE product_prices SET cost = ?, effective_to = ?, created_by = ? WHERE id = ?",
+		price.Cost, utcTime(price.EffectiveTo), nullUUID(price.CreatedBy), price.ID.String())
+	return err
+}
+
+// Delete deletes the price by id
+func (r *sqlitePriceRepository) Delete(priceID uuid.UUID) error {
+	_, err := r.db.Exec("DELETE FROM product_prices WHERE id = ?", priceID.String())
+	return err
+}
+
+// ActivatePrices sets the cost of the products whose price effective at the time differs from it
+func (r *sqlitePriceRepository) ActivatePrices(at time.Time) (int, error) {
+	result, err := r.db.Exec(`
+		UPDATE products SET cost = (
+			SELECT product_prices.cost FROM product_prices
+			WHERE product_prices.product_id = products.id
+				AND product_prices.effective_from <= ?1
+				AND (product_prices.effective_to IS NULL OR product_prices.effective_to > ?1)
+		)
+		WHERE EXISTS (
+			SELECT 1 FROM product_prices
+			WHERE product_prices.product_id = products.id
+				AND product_prices.effective_from <= ?1
+				AND (product_prices.effective_to IS NULL OR product_prices.effective_to > ?1)
+				AND products.cost <> product_prices.cost
+		)`, at.UTC())
+	if err != nil {
+		return 0, err
+	}
+	activated, err := result.RowsAffected()
+	return int(activated), err
+}
@@ -0,0 +1,213 @@
+package repositories
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqliteProductColumns are the columns scanned by scanProduct
+const sqliteProductColumns = "id, seller_id, name, cost, description, category_id, tags, calories, allergens, " +
+	"coalesce(ean, ''), coalesce(image_url, '')"
+
+// sqliteProductListQuery pages through products, sorted by name by default
+var sqliteProductListQuery = &sqliteListQuery{
+	table:       "products",
+	columns:     sqliteProductColumns,
+	sortColumns: map[string]string{"name": "name", "cost": "cost"},
+	defaultSort: "name",
+}
+
+// sqliteProductRepository is the ProductRepository kept in SQLite
+type sqliteProductRepository struct {
+	db sqliteDB
+}
+
+// scanProduct scans a row of the product columns
+func scanProduct(row sqliteRow) (*models.Product, error) {
+	product := &models.Product{}
+	var calories sql.NullInt32
+	err := row.Scan(sqliteUUID{&product.ID}, sqliteUUID{&product.SellerID}, &product.Name, &product.Cost,
+		&product.Description, sqliteUUID{&product.CategoryID}, sqliteStrings{&product.Tags}, &calories,
+		sqliteStrings{&product.Allergens}, &product.EAN, &product.ImageURL)
+	if err == sql.ErrNoRows {
+		return product, db.ErrNoMatch
+	}
+	if calories.Valid {
+		product.Calories = &calories.Int32
+	}
+	return product, err
+}
+
+// GetByID returns the product by id
+func (r *sqliteProductRepository) GetByID(productID uuid.UUID) (*models.Product, error) {
+	return scanProduct(r.db.QueryRow("SELECT "+sqliteProductColumns+" FROM products WHERE id = ?", productID.String()))
+}
+
+// GetForUpdate returns the product by id, the transaction locks the whole database already
+func (r *sqliteProductRepository) GetForUpdate(productID uuid.UUID) (*models.Product, error) {
+	return r.GetByID(productID)
+}
+
+// List returns the page of products matching the filter
+func (r *sqliteProductRepository) List(filter *payloads.ProductFilter) ([]*models.Product, payloads.Page, error) {
+	products := make([]*models.Product, 0)
+
+	conditions, args := []string{}, []interface{}{}
+	if filter.Name != "" {
+		conditions = append(conditions, `name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(filter.Name)+"%")
+	}
+	if filter.MinCost != nil {
+		conditions = append(conditions, "cost >= ?")
+		args = append(args, *filter.MinCost)
+	}
+	if filter.MaxCost != nil {
+		conditions = append(conditions, "cost <= ?")
+		args = append(args, *filter.MaxCost)
+	}
+	if filter.SellerID != uuid.Nil {
+		conditions = append(conditions, "seller_id = ?")
+		args = append(args, filter.SellerID.String())
+	}
+	if filter.InStock {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM slots WHERE slots.product_id = products.id AND slots.quantity > 0)")
+	}
+	if filter.CategoryID != uuid.Nil {
+		conditions = append(conditions, `category_id IN (
+			WITH RECURSIVE subcategories AS (
+				SELECT id FROM categories WHERE id = ?
+				UNION ALL
+				SELECT categories.id FROM categories JOIN subcategories ON categories.parent_id = subcategories.id
+			)
+			SELECT id FROM subcategories)`)
+		args = append(args, filter.CategoryID.String())
+	}
+	for _, tag := range filter.Tags {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(products.tags) WHERE json_each.value = ?)")
+		args = append(args, tag)
+	}
+
+	page, err := sqliteProductListQuery.selectPage(r.db, conditions, args, filter.ListParams, func(row sqliteRow) (uuid.UUID, map[string]interface{}, error) {
+		product, err := scanProduct(row)
+		products = append(products, product)
+		return product.ID, map[string]interface{}{"name": product.Name, "cost": product.Cost}, err
+	})
+	if err != nil {
+		return nil, page, err
+	}
+	return products, page, nil
+}
+
+// Search returns the products whose name or description has a word starting with each word of the search text, or
+// whose name is similar to the text, the most similar first and then by name. SQLite has no full text search or
+// trigrams without an extension, so the words are matched while scanning the products like the MemoryStore does
+func (r *sqliteProductRepository) Search(text string, limit int) ([]*models.Product, int, error) {
+	products := make([]*models.Product, 0)
+	words := searchWords(text)
+	if len(words) == 0 {
+		return products, 0, nil
+	}
+
+	rows, err := r.db.Query("SELECT " + sqliteProductColumns + " FROM products ORDER BY name")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	similarities := make(map[uuid.UUID]float64)
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		similarity := wordSimilarity(words, searchWords(product.Name))
+		if matchesPrefixes(searchWords(product.Name+" "+product.Description), words) || similarity >= memoryWordSimilarityThreshold {
+			products = append(products, product)
+			similarities[product.ID] = similarity
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	sort.SliceStable(products, func(a, b int) bool {
+		return similarities[products[a].ID] > similarities[products[b].ID]
+	})
+
+	total := len(products)
+	if len(products) > limit {
+		products = products[:limit]
+	}
+	return products, total, nil
+}
+
+// productValues returns the values of the columns of the product after its id, in the order of the insert
+func productValues(product *models.Product) ([]interface{}, error) {
+	tags, err := jsonStrings(product.Tags)
+	if err != nil {
+		return nil, err
+	}
+	allergens, err := jsonStrings(product.Allergens)
+	if err != nil {
+		return nil, err
+	}
+	var calories interface{}
+	if product.Calories != nil {
+		calories = *product.Calories
+	}
+	return []interface{}{
+		product.SellerID.String(), product.Name, product.Cost, product.Description, nullUUID(product.CategoryID),
+		tags, calories, allergens, nullString(product.EAN), nullString(product.ImageURL),
+	}, nil
+}
+
+// Insert inserts the product, ErrConflict is returned if the name is taken
+func (r *sqliteProductRepository) Insert(product *models.Product) error {
+	values, err := productValues(product)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`
+		INSERT INTO products (id, seller_id, name, cost, description, category_id, tags, calories, allergens, ean, image_url)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		append([]interface{}{product.ID.String()}, values...)...)
+	return sqliteConflictError(err)
+}
+
+// Update writes all columns of the product
+func (r *sqliteProductRepository) Update(product *models.Product) error {
+	values, err := productValues(product)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.Exec(`
+		UPDATE products SET seller_id = ?, name = ?, cost = ?, description = ?, category_id = ?, tags = ?,
+			calories = ?, allergens = ?, ean = ?, image_url = ?
+		WHERE id = ?`,
+		append(values, product.ID.String())...)
+	if err != nil {
+		return sqliteConflictError(err)
+	}
+	return affectedRow(result)
+}
+
+// Delete deletes the product by id, its purchases restrict it by the triggers of the purchases table
+func (r *sqliteProductRepository) Delete(productID uuid.UUID) error {
+	result, err := r.db.Exec("DELETE FROM products WHERE id = ?", productID.String())
+	if err != nil {
+		return sqliteReferencedError(err)
+	}
+	return affectedRow(result)
+}
+
+// nullString returns the string, or NULL if it is empty
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,165 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqlitePromotionColumns are the columns scanned by scanPromotion
+const sqlitePromotionColumns = "id, seller_id, name, type, product_ids, value, buy_quantity, free_quantity, starts_at, " +
+	"ends_at, coalesce(happy_hour_from, ''), coalesce(happy_hour_to, ''), created_at"
+
+// sqlitePromotionRepository is the PromotionRepository kept in SQLite
+type sqlitePromotionRepository struct {
+	db sqliteDB
+}
+
+// scanPromotion scans a row of the promotion columns
+func scanPromotion(row sqliteRow) (*models.Promotion, error) {
+	promotion := &models.Promotion{}
+	var productIDs []string
+	err := row.Scan(sqliteUUID{&promotion.ID}, sqliteUUID{&promotion.SellerID}, &promotion.Name, &promotion.Type,
+		sqliteStrings{&productIDs}, &promotion.Value, &promotion.BuyQuantity, &promotion.FreeQuantity,
+		&promotion.StartsAt, &promotion.EndsAt, &promotion.HappyHourFrom, &promotion.HappyHourTo, &promotion.CreatedAt)
+	if err == sql.ErrNoRows {
+		return promotion, db.ErrNoMatch
+	}
+	if err != nil {
+		return promotion, err
+	}
+	promotion.ProductIDs = make([]uuid.UUID, len(productIDs))
+	for i, productID := range productIDs {
+		if promotion.ProductIDs[i], err = uuid.FromString(productID); err != nil {
+			return promotion, err
+		}
+	}
+	return promotion, nil
+}
+
+// selectPromotions returns the promotions selected by the query, oldest first
+func (r *sqlitePromotionRepository) selectPromotions(where string, args ...interface{}) ([]*models.Promotion, error) {
+	promotions := make([]*models.Promotion, 0)
+	rows, err := r.db.Query("SELECT "+sqlitePromotionColumns+" FROM promotions WHERE "+where+
+		" ORDER BY created_at, id", args...)
+	if err != nil {
+		return promotions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return promotions, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	return promotions, rows.Err()
+}
+
+// GetByID returns the promotion by id
+func (r *sqlitePromotionRepository) GetByID(promotionID uuid.UUID) (*models.Promotion, error) {
+	return scanPromotion(r.db.QueryRow("SELECT "+sqlitePromotionColumns+" FROM promotions WHERE id = ?",
+		promotionID.String()))
+}
+
+// GetForUpdate returns the promotion by id, the transaction locks the whole database already
+func (r *sqlitePromotionRepository) GetForUpdate(promotionID uuid.UUID) (*models.Promotion, error) {
+	return r.GetByID(promotionID)
+}
+
+// List returns the promotions matching the filter, oldest first
+func (r *sqlitePromotionRepository) List(filter PromotionFilter) ([]*models.Promotion, error) {
+	conditions, args := []string{"TRUE"}, []interface{}{}
+	if filter.SellerID != uuid.Nil {
+		conditions = append(conditions, "seller_id = ?")
+		args = append(args, filter.SellerID.String())
+	}
+	if filter.ProductID != uuid.Nil {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(promotions.product_ids) WHERE json_each.value = ?)")
+		args = append(args, filter.ProductID.String())
+	}
+	return r.selectPromotions(strings.Join(conditions, " AND "), args...)
+}
+
+// ListEffective returns the promotions including any of the products that have started and not ended at the time
+func (r *sqlitePromotionRepository) ListEffective(productIDs []uuid.UUID, at time.Time) ([]*models.Promotion, error) {
+	if len(productIDs) == 0 {
+		return make([]*models.Promotion, 0), nil
+	}
+	placeholders := make([]string, len(productIDs))
+	args := make([]interface{}, 0, len(productIDs)+2)
+	for i, productID := range productIDs {
+		placeholders[i] = "?"
+		args = append(args, productID.String())
+	}
+	args = append(args, at.UTC(), at.UTC())
+	return r.selectPromotions("EXISTS (SELECT 1 FROM json_each(promotions.product_ids) WHERE json_each.value IN ("+
+		strings.Join(placeholders, ", ")+")) AND (starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)",
+		args...)
+}
+
+// promotionValues returns the values of the columns of the promotion that can change, in the order of the update
+func promotionValues(promotion *models.Promotion) ([]interface{}, error) {
+	productIDs := make([]string, len(promotion.ProductIDs))
+	for i, productID := range promotion.ProductIDs {
+		productIDs[i] = productID.String()
+	}
+	encoded, err := jsonStrings(productIDs)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		promotion.Name, promotion.Type, encoded, promotion.Value, promotion.BuyQuantity, promotion.FreeQuantity,
+		utcTime(promotion.StartsAt), utcTime(promotion.EndsAt), nullString(promotion.HappyHourFrom),
+		nullString(promotion.HappyHourTo),
+	}, nil
+}
+
+// Insert adds the promotion, filling in its creation time
+func (r *sqlitePromotionRepository) Insert(promotion *models.Promotion) error {
+	values, err := promotionValues(promotion)
+	if err != nil {
+		return err
+	}
+	if promotion.CreatedAt.IsZero() {
+		promotion.CreatedAt = time.Now()
+	}
+	_, err = r.db.Exec(`
+		INSERT INTO promotions (name, type, product_ids, value, buy_quantity, free_quantity, starts_at, ends_at,
+			happy_hour_from, happy_hour_to, id, seller_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		append(values, promotion.ID.String(), promotion.SellerID.String(), promotion.CreatedAt.UTC())...)
+	return sqliteReferencedError(sqliteConflictError(err))
+}
+
+// Update writes the columns of the promotion that can change, reading back its seller and creation time
+func (r *sqlitePromotionRepository) Update(promotion *models.Promotion) error {
+	values, err := promotionValues(promotion)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`
+		UPDATE promotions SET name = ?, type = ?, product_ids = ?, value = ?, buy_quantity = ?, free_quantity = ?,
+			starts_at = ?, ends_at = ?, happy_hour_from = ?, happy_hour_to = ?
+		WHERE id = ?`,
+		append(values, promotion.ID.String())...)
+	if err != nil {
+		return err
+	}
+	err = r.db.QueryRow("SELECT seller_id, created_at FROM promotions WHERE id = ?", promotion.ID.String()).
+		Scan(sqliteUUID{&promotion.SellerID}, &promotion.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// Delete deletes the promotion by id
+func (r *sqlitePromotionRepository) Delete(promotionID uuid.UUID) error {
+	_, err := r.db.Exec("DELETE FROM promotions WHERE id = ?", promotionID.String())
+	return err
+}
@@ -0,0 +1,189 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqlitePurchaseColumns are the columns scanned by scanPurchase
+const sqlitePurchaseColumns = "id, user_id, product_id, seller_id, machine_id, quantity, unit_price, original_price, " +
+	"discount, promotion_id, total, platform_fee, change_returned, coalesce(request_id, ''), checkout_id, refund_of, " +
+	"change_owed, coalesce(reason, ''), status, created_at"
+
+// sqlitePurchaseRepository is the PurchaseRepository kept in SQLite
+type sqlitePurchaseRepository struct {
+	db sqliteDB
+}
+
+// scanPurchase scans a row of the purchase columns
+func scanPurchase(row sqliteRow) (*models.Purchase, error) {
+	purchase := &models.Purchase{}
+	err := row.Scan(sqliteUUID{&purchase.ID}, sqliteUUID{&purchase.UserID}, sqliteUUID{&purchase.ProductID},
+		sqliteUUID{&purchase.SellerID}, sqliteUUID{&purchase.MachineID}, &purchase.Quantity, &purchase.UnitPrice,
+		&purchase.OriginalPrice, &purchase.Discount, sqliteUUID{&purchase.PromotionID}, &purchase.Total,
+		&purchase.PlatformFee, &purchase.ChangeReturned, &purchase.RequestID, sqliteUUID{&purchase.CheckoutID},
+		sqliteUUID{&purchase.RefundOf}, &purchase.ChangeOwed, &purchase.Reason, &purchase.Status, &purchase.CreatedAt)
+	if err == sql.ErrNoRows {
+		return purchase, db.ErrNoMatch
+	}
+	return purchase, err
+}
+
+// selectPurchases returns the purchases selected by the query
+func (r *sqlitePurchaseRepository) selectPurchases(query string, args ...interface{}) ([]*models.Purchase, error) {
+	purchases := make([]*models.Purchase, 0)
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return purchases, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		purchase, err := scanPurchase(rows)
+		if err != nil {
+			return purchases, err
+		}
+		purchases = append(purchases, purchase)
+	}
+	return purchases, rows.Err()
+}
+
+// GetByID returns the purchase by id
+func (r *sqlitePurchaseRepository) GetByID(purchaseID uuid.UUID) (*models.Purchase, error) {
+	return scanPurchase(r.db.QueryRow("SELECT "+sqlitePurchaseColumns+" FROM purchases WHERE id = ?", purchaseID.String()))
+}
+
+// GetForUpdate returns the purchase by id, the transaction locks the whole database already
+func (r *sqlitePurchaseRepository) GetForUpdate(purchaseID uuid.UUID) (*models.Purchase, error) {
+	return r.GetByID(purchaseID)
+}
+
+// List returns the purchases matching the filter with their products, newest first
+func (r *sqlitePurchaseRepository) List(filter PurchaseFilter) ([]*models.Purchase, error) {
+	conditions, args := []string{"TRUE"}, []interface{}{}
+	if filter.UserID != uuid.Nil {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID.String())
+	}
+	if filter.SellerID != uuid.Nil {
+		conditions = append(conditions, "seller_id = ?")
+		args = append(args, filter.SellerID.String())
+	}
+	where := strings.Join(conditions, " AND ")
+
+	purchases, err := r.selectPurchases("SELECT "+sqlitePurchaseColumns+" FROM purchases WHERE "+where+
+		" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return purchases, err
+	}
+
+	rows, err := r.db.Query("SELECT "+sqliteProductColumns+" FROM products "+
+		"WHERE id IN (SELECT product_id FROM purchases WHERE "+where+")", args...)
+	if err != nil {
+		return purchases, err
+	}
+	defer rows.Close()
+	products := make(map[uuid.UUID]*models.Product)
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return purchases, err
+		}
+		products[product.ID] = product
+	}
+	for _, purchase := range purchases {
+		purchase.Product = products[purchase.ProductID]
+	}
+	return purchases, rows.Err()
+}
+
+// ListReserved returns up to limit purchases reserved before the given time, oldest first
+func (r *sqlitePurchaseRepository) ListReserved(before time.Time, limit int) ([]*models.Purchase, error) {
+	return r.selectPurchases("SELECT "+sqlitePurchaseColumns+" FROM purchases "+
+		"WHERE status = ? AND created_at < ? ORDER BY created_at LIMIT ?",
+		models.PurchaseStatusReserved, before.UTC(), limit)
+}
+
+// Insert appends the purchase to the ledger, filling in the defaults of its status and creation time
+func (r *sqlitePurchaseRepository) Insert(purchase *models.Purchase) error {
+	if purchase.Status == "" {
+		purchase.Status = models.PurchaseStatusCompleted
+	}
+	if purchase.CreatedAt.IsZero() {
+		purchase.CreatedAt = time.Now()
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO purchases (id, user_id, product_id, seller_id, machine_id, quantity, unit_price, original_price,
+			discount, promotion_id, total, platform_fee, change_returned, request_id, checkout_id, refund_of,
+			change_owed, reason, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		purchase.ID.String(), purchase.UserID.String(), purchase.ProductID.String(), purchase.SellerID.String(),
+		nullUUID(purchase.MachineID), purchase.Quantity, purchase.UnitPrice, purchase.OriginalPrice,
+		purchase.Discount, nullUUID(purchase.PromotionID), purchase.Total, purchase.PlatformFee,
+		purchase.ChangeReturned, nullString(purchase.RequestID), nullUUID(purchase.CheckoutID),
+		nullUUID(purchase.RefundOf), purchase.ChangeOwed, nullString(purchase.Reason), purchase.Status,
+		purchase.CreatedAt.UTC())
+	return sqliteConflictError(err)
+}
+
+// SetStatus writes the status of the purchase
+func (r *sqlitePurchaseRepository) SetStatus(purchase *models.Purchase, status models.PurchaseStatus) error {
+	if _, err := r.db.Exec("UPDATE purchases SET status = ? WHERE id = ?", status, purchase.ID.String()); err != nil {
+		return err
+	}
+	purchase.Status = status
+	return nil
+}
+
+// RefundedAmounts adds up the refund entries of the purchase by id
+func (r *sqlitePurchaseRepository) RefundedAmounts(purchaseID uuid.UUID) (RefundedAmounts, error) {
+	refunded := RefundedAmounts{}
+	err := r.db.QueryRow(`
+		SELECT coalesce(-sum(quantity), 0), coalesce(-sum(original_price), 0), coalesce(-sum(total), 0),
+			coalesce(-sum(platform_fee), 0)
+		FROM purchases WHERE refund_of = ?`, purchaseID.String()).
+		Scan(&refunded.Quantity, &refunded.OriginalPrice, &refunded.Total, &refunded.PlatformFee)
+	return refunded, err
+}
+
+// SalesReport returns the totals of all purchases net of refunds, with a breakdown per product ordered by revenue
+func (r *sqlitePurchaseRepository) SalesReport() (*payloads.SalesReport, error) {
+	report := &payloads.SalesReport{}
+	err := r.db.QueryRow(`
+		SELECT count(*) FILTER (WHERE refund_of IS NULL), coalesce(sum(quantity), 0), coalesce(sum(total), 0),
+			coalesce(sum(change_returned), 0)
+		FROM purchases`).
+		Scan(&report.Purchases, &report.ItemsSold, &report.Revenue, &report.ChangeReturned)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Products = make([]*payloads.ProductSales, 0)
+	rows, err := r.db.Query(`
+		SELECT product_id, seller_id, count(*) FILTER (WHERE refund_of IS NULL), sum(quantity), sum(total) AS revenue
+		FROM purchases
+		GROUP BY product_id, seller_id
+		ORDER BY revenue DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		sales := &payloads.ProductSales{}
+		err := rows.Scan(sqliteUUID{&sales.ProductID}, sqliteUUID{&sales.SellerID}, &sales.Purchases, &sales.ItemsSold,
+			&sales.Revenue)
+		if err != nil {
+			return nil, err
+		}
+		report.Products = append(report.Products, sales)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,207 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqliteSessionColumns are the columns scanned by scanSession
+const sqliteSessionColumns = "id, user_id, jti, coalesce(user_agent, ''), coalesce(ip_address, ''), created_at, " +
+	"last_seen_at, expires_at, ended_at"
+
+// sqliteSessionRepository is the SessionRepository kept in SQLite. Times are compared as text, so the current time
+// is passed in UTC instead of using the functions of SQLite, which format it differently
+type sqliteSessionRepository struct {
+	db sqliteDB
+}
+
+// scanSession scans a row of the session columns
+func scanSession(row sqliteRow) (*models.Session, error) {
+	session := &models.Session{}
+	err := row.Scan(sqliteUUID{&session.ID}, sqliteUUID{&session.UserID}, &session.JTI, &session.UserAgent,
+		&session.IPAddress, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.EndedAt)
+	if err == sql.ErrNoRows {
+		return session, db.ErrNoMatch
+	}
+	return session, err
+}
+
+// GetForUpdate returns the session by id, the transaction locks the whole database already
+func (r *sqliteSessionRepository) GetForUpdate(sessionID uuid.UUID) (*models.Session, error) {
+	return scanSession(r.db.QueryRow("SELECT "+sqliteSessionColumns+" FROM sessions WHERE id = ?", sessionID.String()))
+}
+
+// ListActive returns the active sessions of the user, most recently seen first
+func (r *sqliteSessionRepository) ListActive(userID uuid.UUID) ([]*models.Session, error) {
+	sessions := make([]*models.Session, 0)
+	rows, err := r.db.Query("SELECT "+sqliteSessionColumns+" FROM sessions "+
+		"WHERE user_id = ? AND ended_at IS NULL AND expires_at > ? ORDER BY last_seen_at DESC",
+		userID.String(), time.Now().UTC())
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// HasActive returns true if the user has an active session
+func (r *sqliteSessionRepository) HasActive(userID uuid.UUID) (bool, error) {
+	var active bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM sessions WHERE user_id = ? AND ended_at IS NULL AND expires_at > ?)",
+		userID.String(), time.Now().UTC()).Scan(&active)
+	return active, err
+}
+
+// Insert adds the session, filling in its creation and last seen times
+func (r *sqliteSessionRepository) Insert(session *models.Session) error {
+	now := time.Now()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+	if session.LastSeenAt.IsZero() {
+		session.LastSeenAt = now
+	}
+	_, err := r.db.Exec("INSERT INTO sessions (id, user_id, jti, user_agent, ip_address, created_at, last_seen_at, "+
+		"expires_at, ended_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		session.ID.String(), session.UserID.String(), session.JTI, nullString(session.UserAgent),
+		nullString(session.IPAddress), session.CreatedAt.UTC(), session.LastSeenAt.UTC(), session.ExpiresAt.UTC(),
+		utcTime(session.EndedAt))
+	return sqliteReferencedError(sqliteConflictError(err))
+}
+
+// Refresh writes the access token id and the expiry of the session and marks it as seen now
+func (r *sqliteSessionRepository) Refresh(session *models.Session) error {
+	lastSeenAt := time.Now()
+	_, err := r.db.Exec("UPDATE sessions SET jti = ?, expires_at = ?, last_seen_at = ? WHERE id = ?",
+		session.JTI, session.ExpiresAt.UTC(), lastSeenAt.UTC(), session.ID.String())
+	if err != nil {
+		return sqliteConflictError(err)
+	}
+	session.LastSeenAt = lastSeenAt
+	return nil
+}
+
+// End ends the session by id, if it has not ended yet
+func (r *sqliteSessionRepository) End(sessionID uuid.UUID) error {
+	_, err := r.db.Exec("UPDATE sessions SET ended_at = ? WHERE id = ? AND ended_at IS NULL",
+		time.Now().UTC(), sessionID.String())
+	return err
+}
+
+// EndByJTI ends the session of the user the access token was issued for
+func (r *sqliteSessionRepository) EndByJTI(userID uuid.UUID, jti string) error {
+	_, err := r.db.Exec("UPDATE sessions SET ended_at = ? WHERE jti = ? AND user_id = ? AND ended_at IS NULL",
+		time.Now().UTC(), jti, userID.String())
+	return err
+}
+
+// EndAll ends all sessions of the user, except the one of the access token with the given id, if any
+func (r *sqliteSessionRepository) EndAll(userID uuid.UUID, exceptJTI string) error {
+	_, err := r.db.Exec("UPDATE sessions SET ended_at = ? WHERE user_id = ? AND ended_at IS NULL AND jti <> ?",
+		time.Now().UTC(), userID.String(), exceptJTI)
+	return err
+}
+
+// TouchSession updates the last seen time of the active session the access token was issued for
+func (r *sqliteSessionRepository) TouchSession(jti string) (bool, error) {
+	now := time.Now().UTC()
+	result, err := r.db.Exec("UPDATE sessions SET last_seen_at = ? WHERE jti = ? AND ended_at IS NULL AND expires_at > ?",
+		now, jti, now)
+	if err != nil {
+		return false, err
+	}
+	touched, err := result.RowsAffected()
+	return touched > 0, err
+}
+
+// sqliteRefreshTokenColumns are the columns scanned by scanRefreshToken
+const sqliteRefreshTokenColumns = "id, user_id, session_id, token_hash, expires_at, created_at, revoked_at"
+
+// sqliteRefreshTokenRepository is the RefreshTokenRepository kept in SQLite
+type sqliteRefreshTokenRepository struct {
+	db sqliteDB
+}
+
+// scanRefreshToken scans a row of the refresh token columns
+func scanRefreshToken(row sqliteRow) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+	err := row.Scan(sqliteUUID{&token.ID}, sqliteUUID{&token.UserID}, sqliteUUID{&token.SessionID}, &token.TokenHash,
+		&token.ExpiresAt, &token.CreatedAt, &token.RevokedAt)
+	if err == sql.ErrNoRows {
+		return token, db.ErrNoMatch
+	}
+	return token, err
+}
+
+// GetByHashForUpdate returns the refresh token with the hash, the transaction locks the whole database already
+func (r *sqliteRefreshTokenRepository) GetByHashForUpdate(tokenHash string) (*models.RefreshToken, error) {
+	return scanRefreshToken(r.db.QueryRow("SELECT "+sqliteRefreshTokenColumns+" FROM refresh_tokens WHERE token_hash = ?",
+		tokenHash))
+}
+
+// Insert adds the refresh token, filling in its creation time
+func (r *sqliteRefreshTokenRepository) Insert(token *models.RefreshToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	_, err := r.db.Exec("INSERT INTO refresh_tokens ("+sqliteRefreshTokenColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		token.ID.String(), token.UserID.String(), token.SessionID.String(), token.TokenHash, token.ExpiresAt.UTC(),
+		token.CreatedAt.UTC(), utcTime(token.RevokedAt))
+	return sqliteReferencedError(sqliteConflictError(err))
+}
+
+// Revoke revokes the refresh token now
+func (r *sqliteRefreshTokenRepository) Revoke(token *models.RefreshToken) error {
+	revokedAt := time.Now()
+	if _, err := r.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE id = ?", revokedAt.UTC(), token.ID.String()); err != nil {
+		return err
+	}
+	token.RevokedAt = &revokedAt
+	return nil
+}
+
+// RevokeByHash revokes the refresh token of the user with the hash, keeping the time it was revoked before
+func (r *sqliteRefreshTokenRepository) RevokeByHash(userID uuid.UUID, tokenHash string) (*models.RefreshToken, error) {
+	result, err := r.db.Exec("UPDATE refresh_tokens SET revoked_at = coalesce(revoked_at, ?) WHERE token_hash = ? AND user_id = ?",
+		time.Now().UTC(), tokenHash, userID.String())
+	if err != nil {
+		return &models.RefreshToken{}, err
+	}
+	if err := affectedRow(result); err != nil {
+		return &models.RefreshToken{}, err
+	}
+	return r.GetByHashForUpdate(tokenHash)
+}
+
+// sqliteRevokedTokenRepository is the RevokedTokenRepository kept in SQLite
+type sqliteRevokedTokenRepository struct {
+	db sqliteDB
+}
+
+// Revoke puts the access token on the denylist, dropping the entries of expired tokens
+func (r *sqliteRevokedTokenRepository) Revoke(jti string, expiresAt time.Time) error {
+	if _, err := r.db.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now().UTC()); err != nil {
+		return err
+	}
+	_, err := r.db.Exec("INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?) ON CONFLICT (jti) DO NOTHING",
+		jti, expiresAt.UTC())
+	return err
+}
+
+// IsRevoked returns true if the access token with the given id is on the denylist
+func (r *sqliteRevokedTokenRepository) IsRevoked(jti string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?)", jti).Scan(&revoked)
+	return revoked, err
+}
@@ -0,0 +1,295 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/mattn/go-sqlite3"
+	uuid "github.com/satori/go.uuid"
+)
+
+// SQLiteStore is the Store kept in a SQLite database, for machines that cannot reach a central Postgres. Its schema
+// is created by the SQLite translations of the migrations, the database should be opened with db.OpenSQLite
+type SQLiteStore struct {
+	sqliteSession
+	db *sql.DB
+}
+
+// NewSQLiteStore creates a store on the given SQLite database
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{sqliteSession: sqliteSession{db: db}, db: db}
+}
+
+// RunInTransaction runs fn in a database transaction, which is committed if fn returns nil
+func (s *SQLiteStore) RunInTransaction(ctx context.Context, fn func(tx Session) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&sqliteSession{db: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	notifyCommit(ctx)
+	return nil
+}
+
+// sqliteDB runs queries on the database or on a transaction of it
+type sqliteDB interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqliteSession runs the repositories on the database, or on a transaction of it
+type sqliteSession struct {
+	db sqliteDB
+}
+
+// Users returns the users of the session
+func (s *sqliteSession) Users() UserRepository {
+	return &sqliteUserRepository{db: s.db}
+}
+
+// Products returns the products of the session
+func (s *sqliteSession) Products() ProductRepository {
+	return &sqliteProductRepository{db: s.db}
+}
+
+// Purchases returns the purchases of the session
+func (s *sqliteSession) Purchases() PurchaseRepository {
+	return &sqlitePurchaseRepository{db: s.db}
+}
+
+// Machines returns the machines of the session
+func (s *sqliteSession) Machines() MachineRepository {
+	return &sqliteMachineRepository{db: s.db}
+}
+
+// Slots returns the slots of the session
+func (s *sqliteSession) Slots() SlotRepository {
+	return &sqliteSlotRepository{db: s.db}
+}
+
+// Coins returns the coin tubes of the session
+func (s *sqliteSession) Coins() CoinRepository {
+	return &sqliteCoinRepository{db: s.db}
+}
+
+// Journal returns the journal of the session
+func (s *sqliteSession) Journal() JournalRepository {
+	return &sqliteJournalRepository{db: s.db}
+}
+
+// Promotions returns the promotions of the session
+func (s *sqliteSession) Promotions() PromotionRepository {
+	return &sqlitePromotionRepository{db: s.db}
+}
+
+// Prices returns the price history of the session
+func (s *sqliteSession) Prices() PriceRepository {
+	return &sqlitePriceRepository{db: s.db}
+}
+
+// Categories returns the categories of the session
+func (s *sqliteSession) Categories() CategoryRepository {
+	return &sqliteCategoryRepository{db: s.db}
+}
+
+// Payouts returns the payouts of the session
+func (s *sqliteSession) Payouts() PayoutRepository {
+	return &sqlitePayoutRepository{db: s.db}
+}
+
+// Sessions returns the user sessions of the session
+func (s *sqliteSession) Sessions() SessionRepository {
+	return &sqliteSessionRepository{db: s.db}
+}
+
+// RefreshTokens returns the refresh tokens of the session
+func (s *sqliteSession) RefreshTokens() RefreshTokenRepository {
+	return &sqliteRefreshTokenRepository{db: s.db}
+}
+
+// RevokedTokens returns the denylist of the session
+func (s *sqliteSession) RevokedTokens() RevokedTokenRepository {
+	return &sqliteRevokedTokenRepository{db: s.db}
+}
+
+// IdempotencyKeys returns the idempotency keys of the session
+func (s *sqliteSession) IdempotencyKeys() IdempotencyKeyRepository {
+	return &sqliteIdempotencyKeyRepository{db: s.db}
+}
+
+// SyncEvents returns the synced events of the session
+func (s *sqliteSession) SyncEvents() SyncEventRepository {
+	return &sqliteSyncEventRepository{db: s.db}
+}
+
+// sqliteRow is a row of a query result, either *sql.Row or *sql.Rows
+type sqliteRow interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqliteListQuery pages through a table like listQuery does in Postgres, ids are stored as text, which orders
+// them like their bytes
+type sqliteListQuery struct {
+	table       string
+	columns     string
+	sortColumns map[string]string
+	defaultSort string
+}
+
+// selectPage counts the rows matching the conditions, then selects the page of rows following the cursor. Each
+// row is scanned by scan, which returns the id of the row and the values of its sort fields
+func (l *sqliteListQuery) selectPage(db sqliteDB, conditions []string, args []interface{}, params payloads.ListParams, scan func(row sqliteRow) (uuid.UUID, map[string]interface{}, error)) (payloads.Page, error) {
+	page := payloads.Page{}
+	if !validLimit(params.Limit) {
+		return page, ErrInvalidListParams
+	}
+
+	sort := params.Sort
+	if sort == "" {
+		sort = l.defaultSort
+	}
+	direction, comparison := "ASC", ">"
+	if strings.HasPrefix(sort, "-") {
+		sort = strings.TrimPrefix(sort, "-")
+		direction, comparison = "DESC", "<"
+	}
+	column, ok := l.sortColumns[sort]
+	if !ok {
+		return page, ErrInvalidListParams
+	}
+
+	where := "TRUE"
+	if len(conditions) > 0 {
+		where = strings.Join(conditions, " AND ")
+	}
+	if err := db.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", l.table, where), args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	if params.Cursor != "" {
+		key, cursorID, err := decodeCursor(params.Cursor, params.Sort)
+		if err != nil {
+			return page, ErrInvalidListParams
+		}
+		where += fmt.Sprintf(" AND (%s, id) %s (?, ?)", column, comparison)
+		args = append(args, key, cursorID.String())
+	}
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s %s, id %s LIMIT ?",
+		l.columns, l.table, where, column, direction, direction), append(args, params.Limit+1)...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var lastID uuid.UUID
+	var lastKeys map[string]interface{}
+	for count := 0; rows.Next(); count++ {
+		if count == params.Limit {
+			page.NextCursor = encodeCursor(params.Sort, lastKeys[sort], lastID)
+			break
+		}
+		if lastID, lastKeys, err = scan(rows); err != nil {
+			return page, err
+		}
+	}
+	return page, rows.Err()
+}
+
+// sqliteUUID scans a text column into a uuid, NULL is scanned as uuid.Nil
+type sqliteUUID struct {
+	id *uuid.UUID
+}
+
+// Scan implements sql.Scanner
+func (u sqliteUUID) Scan(src interface{}) error {
+	if src == nil {
+		*u.id = uuid.Nil
+		return nil
+	}
+	return u.id.Scan(src)
+}
+
+// nullUUID returns the uuid as text, or NULL for uuid.Nil
+func nullUUID(id uuid.UUID) driver.Value {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id.String()
+}
+
+// sqliteStrings scans a JSON array column into a slice of strings
+type sqliteStrings struct {
+	values *[]string
+}
+
+// Scan implements sql.Scanner
+func (s sqliteStrings) Scan(src interface{}) error {
+	*s.values = []string{}
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), s.values)
+	case []byte:
+		return json.Unmarshal(src, s.values)
+	default:
+		return fmt.Errorf("cannot scan %T into strings", src)
+	}
+}
+
+// jsonStrings returns the strings as a JSON array
+func jsonStrings(values []string) (string, error) {
+	if values == nil {
+		values = []string{}
+	}
+	b, err := json.Marshal(values)
+	return string(b), err
+}
+
+// sqliteConflictError returns ErrConflict for unique violations and any other error unchanged
+func sqliteConflictError(err error) error {
+	if sqliteErr, ok := err.(sqlite3.Error); ok {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return ErrConflict
+		}
+	}
+	return err
+}
+
+// sqliteReferencedError returns ErrReferenced for foreign key violations, including the ones raised by triggers,
+// and any other error unchanged
+func sqliteReferencedError(err error) error {
+	if sqliteErr, ok := err.(sqlite3.Error); ok {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintForeignKey, sqlite3.ErrConstraintTrigger:
+			return ErrReferenced
+		}
+	}
+	return err
+}
+
+// affectedRow returns db.ErrNoMatch if the statement did not change a row
+func affectedRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return db.ErrNoMatch
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqliteSyncEventRepository is the SyncEventRepository kept in SQLite
+type sqliteSyncEventRepository struct {
+	db sqliteDB
+}
+
+// sqliteConflicts scans a JSON array column into the conflicts of an event
+type sqliteConflicts struct {
+	conflicts *[]*models.SyncConflict
+}
+
+// Scan implements sql.Scanner
+func (c sqliteConflicts) Scan(src interface{}) error {
+	*c.conflicts = nil
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), c.conflicts)
+	case []byte:
+		return json.Unmarshal(src, c.conflicts)
+	default:
+		return fmt.Errorf("cannot scan %T into conflicts", src)
+	}
+}
+
+// GetByID returns the event by id
+func (r *sqliteSyncEventRepository) GetByID(eventID uuid.UUID) (*models.SyncEvent, error) {
+	event := &models.SyncEvent{}
+	err := r.db.QueryRow(`
+		SELECT id, machine_id, batch_id, sequence, kind, occurred_at, status, conflicts, applied_at
+		FROM sync_events WHERE id = ?`, eventID.String()).
+		Scan(sqliteUUID{&event.ID}, sqliteUUID{&event.MachineID}, sqliteUUID{&event.BatchID}, &event.Sequence,
+			&event.Kind, &event.OccurredAt, &event.Status, sqliteConflicts{&event.Conflicts}, &event.AppliedAt)
+	if err == sql.ErrNoRows {
+		return event, db.ErrNoMatch
+	}
+	return event, err
+}
+
+// LastApplied returns the last sequence of the machine and the time its last event was applied. The time is read
+// from the latest row, as SQLite returns the maximum of a column as text
+func (r *sqliteSyncEventRepository) LastApplied(machineID uuid.UUID) (int64, *time.Time, error) {
+	var lastSequence int64
+	err := r.db.QueryRow("SELECT coalesce(max(sequence), 0) FROM sync_events WHERE machine_id = ?", machineID.String()).
+		Scan(&lastSequence)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var appliedAt time.Time
+	err = r.db.QueryRow("SELECT applied_at FROM sync_events WHERE machine_id = ? ORDER BY applied_at DESC LIMIT 1",
+		machineID.String()).Scan(&appliedAt)
+	switch err {
+	case nil:
+		return lastSequence, &appliedAt, nil
+	case sql.ErrNoRows:
+		return lastSequence, nil, nil
+	default:
+		return lastSequence, nil, err
+	}
+}
+
+// Insert appends the event, filling in the time it was applied
+func (r *sqliteSyncEventRepository) Insert(event *models.SyncEvent) error {
+	conflicts := event.Conflicts
+	if conflicts == nil {
+		conflicts = []*models.SyncConflict{}
+	}
+	encoded, err := json.Marshal(conflicts)
+	if err != nil {
+		return err
+	}
+	if event.AppliedAt.IsZero() {
+		event.AppliedAt = time.Now()
+	}
+	_, err = r.db.Exec(`
+		INSERT INTO sync_events (id, machine_id, batch_id, sequence, kind, occurred_at, status, conflicts, applied_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.ID.String(), event.MachineID.String(), event.BatchID.String(), event.Sequence, event.Kind,
+		event.OccurredAt.UTC(), event.Status, string(encoded), event.AppliedAt.UTC())
+	return sqliteReferencedError(sqliteConflictError(err))
+}
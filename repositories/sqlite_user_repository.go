@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sqliteUserColumns are the columns scanned by scanUser
+const sqliteUserColumns = "id, username, password, role, coalesce(deposit, 0), machine_id, disabled_at"
+
+// sqliteUserListQuery pages through users, sorted by username by default
+var sqliteUserListQuery = &sqliteListQuery{
+	table:       "users",
+	columns:     sqliteUserColumns,
+	sortColumns: map[string]string{"username": "username", "deposit": "deposit"},
+	defaultSort: "username",
+}
+
+// sqliteUserRepository is the UserRepository kept in SQLite
+type sqliteUserRepository struct {
+	db sqliteDB
+}
+
+// scanUser scans a row of the user columns
+func scanUser(row sqliteRow) (*models.User, error) {
+	user := &models.User{}
+	var disabledAt sql.NullTime
+	err := row.Scan(sqliteUUID{&user.ID}, &user.Username, &user.Password, &user.Role, &user.Deposit,
+		sqliteUUID{&user.MachineID}, &disabledAt)
+	if err == sql.ErrNoRows {
+		return user, db.ErrNoMatch
+	}
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+	return user, err
+}
+
+// GetByID returns the user by id
+func (r *sqliteUserRepository) GetByID(userID uuid.UUID) (*models.User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+sqliteUserColumns+" FROM users WHERE id = ?", userID.String()))
+}
+
+// GetByUsername returns the user by username
+func (r *sqliteUserRepository) GetByUsername(username string) (*models.User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+sqliteUserColumns+" FROM users WHERE username = ?", username))
+}
+
+// GetForUpdate returns the user by id. Transactions on SQLite lock the whole database when they begin, so
+// there is no row to lock
+func (r *sqliteUserRepository) GetForUpdate(userID uuid.UUID) (*models.User, error) {
+	return r.GetByID(userID)
+}
+
+// List returns the page of users matching the filter
+func (r *sqliteUserRepository) List(filter *payloads.UserFilter) ([]*models.User, payloads.Page, error) {
+	users := make([]*models.User, 0)
+
+	conditions, args := []string{}, []interface{}{}
+	if filter.Username != "" {
+		conditions = append(conditions, `username LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(filter.Username)+"%")
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, "role = ?")
+		args = append(args, filter.Role)
+	}
+
+	page, err := sqliteUserListQuery.selectPage(r.db, conditions, args, filter.ListParams, func(row sqliteRow) (uuid.UUID, map[string]interface{}, error) {
+		user, err := scanUser(row)
+		users = append(users, user)
+		return user.ID, map[string]interface{}{"username": user.Username, "deposit": user.Deposit}, err
+	})
+	if err != nil {
+		return nil, page, err
+	}
+	return users, page, nil
+}
+
+// Insert inserts the user, ErrConflict is returned if the username is taken
+func (r *sqliteUserRepository) Insert(user *models.User) error {
+	_, err := r.db.Exec(`
+		INSERT INTO users (id, username, password, role, deposit, machine_id, disabled_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		user.ID.String(), user.Username, user.Password, user.Role, user.Deposit, nullUUID(user.MachineID),
+		utcTime(user.DisabledAt))
+	return sqliteConflictError(err)
+}
+
+// UpdateUsername writes the username of the given user, leaving all other columns untouched
+func (r *sqliteUserRepository) UpdateUsername(user *models.User) error {
+	result, err := r.db.Exec("UPDATE users SET username = ? WHERE id = ?", user.Username, user.ID.String())
+	if err != nil {
+		return sqliteConflictError(err)
+	}
+	return affectedRow(result)
+}
+
+// UpdateDeposit writes the deposit of the given user and the machine holding it, leaving all other columns untouched
+func (r *sqliteUserRepository) UpdateDeposit(user *models.User) error {
+	result, err := r.db.Exec("UPDATE users SET deposit = ?, machine_id = ? WHERE id = ?",
+		user.Deposit, nullUUID(user.MachineID), user.ID.String())
+	if err != nil {
+		return err
+	}
+	return affectedRow(result)
+}
+
+// UpdateRole writes the role of the user
+func (r *sqliteUserRepository) UpdateRole(user *models.User) error {
+	_, err := r.db.Exec("UPDATE users SET role = ? WHERE id = ?", user.Role, user.ID.String())
+	return err
+}
+
+// SetDisabledAt writes when the user was disabled, or enables them when disabledAt is nil
+func (r *sqliteUserRepository) SetDisabledAt(user *models.User, disabledAt *time.Time) error {
+	user.DisabledAt = disabledAt
+	_, err := r.db.Exec("UPDATE users SET disabled_at = ? WHERE id = ?", utcTime(disabledAt), user.ID.String())
+	return err
+}
+
+// Delete deletes the user by id, their products are deleted by the foreign keys while their purchases restrict it
+func (r *sqliteUserRepository) Delete(userID uuid.UUID) error {
+	result, err := r.db.Exec("DELETE FROM users WHERE id = ?", userID.String())
+	if err != nil {
+		return sqliteReferencedError(err)
+	}
+	return affectedRow(result)
+}
+
+// utcTime returns the time in UTC, or NULL for nil. SQLite compares times as text, so they are all stored in UTC
+func utcTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
@@ -0,0 +1,592 @@
+package repositories_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/internal/dbtest"
+	"github.com/dhurimkelmendi/vending_machine/migrations"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, func(t *testing.T) repositories.Store {
+		return repositories.NewMemoryStore()
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, func(t *testing.T) repositories.Store {
+		cfg := config.Load()
+		dbtest.ConfigureSQLite(t, cfg)
+		database, err := db.New(cfg)
+		if err != nil {
+			t.Fatalf("error while opening database %+v", err)
+		}
+		t.Cleanup(func() { database.Close() })
+		return repositories.NewSQLiteStore(database.GetSQLite())
+	})
+
+	t.Run("migrations roll back", func(t *testing.T) {
+		sqlite, err := db.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("error while opening database %+v", err)
+		}
+		defer sqlite.Close()
+		_, latest, err := migrations.RunSQLite(sqlite, "up")
+		if err != nil {
+			t.Fatalf("error while migrating database %+v", err)
+		}
+		if _, version, err := migrations.RunSQLite(sqlite, "reset"); err != nil || version != 0 {
+			t.Fatalf("expected the database to be reset to version 0, got: %d %+v", version, err)
+		}
+		if _, version, err := migrations.RunSQLite(sqlite, "up"); err != nil || version != latest {
+			t.Fatalf("expected the database to be migrated to version %d again, got: %d %+v", latest, version, err)
+		}
+	})
+}
+
+func TestPGStore(t *testing.T) {
+	dbtest.SkipUnlessPostgres(t)
+	t.Parallel()
+	testStore(t, func(t *testing.T) repositories.Store {
+		cfg := config.Load()
+		dbtest.ConfigurePostgres(t, cfg)
+		database, err := db.New(cfg)
+		if err != nil {
+			t.Fatalf("error while connecting to database %+v", err)
+		}
+		t.Cleanup(func() { database.Close() })
+		return repositories.NewPGStore(database.GetDB())
+	})
+}
+
+// testStore runs the tests every store has to pass on stores created by open
+func testStore(t *testing.T, open func(t *testing.T) repositories.Store) {
+	ctx := context.Background()
+
+	newStore := func(t *testing.T) (repositories.Store, *models.User, []*models.Product) {
+		store := open(t)
+		seller := &models.User{ID: uuid.NewV4(), Username: "seller", Role: models.UserRoleSeller}
+		if err := store.Users().Insert(seller); err != nil {
+			t.Fatalf("error while inserting seller %+v", err)
+		}
+		products := make([]*models.Product, 5)
+		for i := range products {
+			products[i] = &models.Product{
+				ID:          uuid.NewV4(),
+				SellerID:    seller.ID,
+				Name:        fmt.Sprintf("product %d", i),
+				Cost:        int32(50 - i*10),
+				Description: "chocolate bar",
+				Tags:        []string{"snack"},
+			}
+			if err := store.Products().Insert(products[i]); err != nil {
+				t.Fatalf("error while inserting product %+v", err)
+			}
+		}
+		return store, seller, products
+	}
+
+	t.Run("users", func(t *testing.T) {
+		store, seller, _ := newStore(t)
+
+		t.Run("get by id and username", func(t *testing.T) {
+			user, err := store.Users().GetByID(seller.ID)
+			if err != nil {
+				t.Fatalf("error while getting user by id %+v", err)
+			}
+			if !user.Equals(seller) {
+				t.Fatalf("expected user %+v, got: %+v", seller, user)
+			}
+			user, err = store.Users().GetByUsername(seller.Username)
+			if err != nil || user.ID != seller.ID {
+				t.Fatalf("expected user %s by username, got: %+v %+v", seller.ID, user, err)
+			}
+			if _, err := store.Users().GetByID(uuid.NewV4()); err != db.ErrNoMatch {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+			}
+		})
+		t.Run("returns copies", func(t *testing.T) {
+			user, _ := store.Users().GetByID(seller.ID)
+			user.Deposit = 100
+			stored, _ := store.Users().GetByID(seller.ID)
+			if stored.Deposit != 0 {
+				t.Fatalf("expected the stored user to be unchanged, got deposit %d", stored.Deposit)
+			}
+		})
+		t.Run("insert with taken username", func(t *testing.T) {
+			user := &models.User{ID: uuid.NewV4(), Username: seller.Username, Role: models.UserRoleBuyer}
+			if err := store.Users().Insert(user); err != repositories.ErrConflict {
+				t.Fatalf("expected error %+v, got: %+v", repositories.ErrConflict, err)
+			}
+		})
+		t.Run("update deposit", func(t *testing.T) {
+			machine := &models.Machine{ID: uuid.NewV4(), OperatorID: seller.ID, Name: "hallway"}
+			if err := store.Machines().Insert(machine); err != nil {
+				t.Fatalf("error while inserting machine %+v", err)
+			}
+			if err := store.Users().UpdateDeposit(&models.User{ID: seller.ID, Deposit: 35, MachineID: machine.ID}); err != nil {
+				t.Fatalf("error while updating deposit %+v", err)
+			}
+			user, _ := store.Users().GetByID(seller.ID)
+			if user.Deposit != 35 || user.MachineID != machine.ID || user.Username != seller.Username {
+				t.Fatalf("expected only the deposit and machine to change, got: %+v", user)
+			}
+		})
+		t.Run("update username", func(t *testing.T) {
+			buyer := &models.User{ID: uuid.NewV4(), Username: "buyer", Role: models.UserRoleBuyer, Deposit: 20}
+			if err := store.Users().Insert(buyer); err != nil {
+				t.Fatalf("error while inserting buyer %+v", err)
+			}
+			if err := store.Users().UpdateUsername(&models.User{ID: buyer.ID, Username: "renamed buyer"}); err != nil {
+				t.Fatalf("error while updating username %+v", err)
+			}
+			user, _ := store.Users().GetByID(buyer.ID)
+			if user.Username != "renamed buyer" || user.Deposit != 20 || user.Role != models.UserRoleBuyer {
+				t.Fatalf("expected only the username to change, got: %+v", user)
+			}
+			if err := store.Users().UpdateUsername(&models.User{ID: buyer.ID, Username: seller.Username}); err != repositories.ErrConflict {
+				t.Fatalf("expected error %+v, got: %+v", repositories.ErrConflict, err)
+			}
+			if err := store.Users().UpdateUsername(&models.User{ID: uuid.NewV4(), Username: "unknown"}); err != db.ErrNoMatch {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+			}
+			if err := store.Users().Delete(buyer.ID); err != nil {
+				t.Fatalf("error while deleting buyer %+v", err)
+			}
+		})
+		t.Run("filter by role", func(t *testing.T) {
+			users, page, err := store.Users().List(&payloads.UserFilter{
+				ListParams: payloads.ListParams{Limit: 10},
+				Role:       models.UserRoleBuyer,
+			})
+			if err != nil {
+				t.Fatalf("error while listing users %+v", err)
+			}
+			if len(users) != 0 || page.Total != 0 {
+				t.Fatalf("expected no buyers, got: %+v", users)
+			}
+		})
+	})
+
+	t.Run("list products", func(t *testing.T) {
+		store, _, products := newStore(t)
+
+		t.Run("pages through all products", func(t *testing.T) {
+			params := payloads.ListParams{Limit: 2, Sort: "cost"}
+			names := make([]string, 0)
+			for {
+				page, pagination, err := store.Products().List(&payloads.ProductFilter{ListParams: params})
+				if err != nil {
+					t.Fatalf("error while listing products %+v", err)
+				}
+				if pagination.Total != len(products) {
+					t.Fatalf("expected total %d, got: %d", len(products), pagination.Total)
+				}
+				for _, product := range page {
+					names = append(names, product.Name)
+				}
+				if pagination.NextCursor == "" {
+					break
+				}
+				params.Cursor = pagination.NextCursor
+			}
+			expected := []string{"product 4", "product 3", "product 2", "product 1", "product 0"}
+			if fmt.Sprint(names) != fmt.Sprint(expected) {
+				t.Fatalf("expected products %v, got: %v", expected, names)
+			}
+		})
+		t.Run("continues after the last row of the page was deleted", func(t *testing.T) {
+			store, _, _ := newStore(t)
+			params := payloads.ListParams{Limit: 2, Sort: "-cost"}
+			first, pagination, err := store.Products().List(&payloads.ProductFilter{ListParams: params})
+			if err != nil {
+				t.Fatalf("error while listing products %+v", err)
+			}
+			if err := store.Products().Delete(first[len(first)-1].ID); err != nil {
+				t.Fatalf("error while deleting product %+v", err)
+			}
+			params.Cursor = pagination.NextCursor
+			next, _, err := store.Products().List(&payloads.ProductFilter{ListParams: params})
+			if err != nil {
+				t.Fatalf("error while listing products %+v", err)
+			}
+			if len(next) != 2 || next[0].Cost >= first[len(first)-1].Cost {
+				t.Fatalf("expected the products after the deleted one, got: %+v", next)
+			}
+		})
+		t.Run("with a cursor of another sort", func(t *testing.T) {
+			_, pagination, err := store.Products().List(&payloads.ProductFilter{ListParams: payloads.ListParams{Limit: 1, Sort: "name"}})
+			if err != nil {
+				t.Fatalf("error while listing products %+v", err)
+			}
+			_, _, err = store.Products().List(&payloads.ProductFilter{ListParams: payloads.ListParams{Limit: 1, Sort: "cost", Cursor: pagination.NextCursor}})
+			if err != repositories.ErrInvalidListParams {
+				t.Fatalf("expected error %+v, got: %+v", repositories.ErrInvalidListParams, err)
+			}
+		})
+		t.Run("sorted descending and filtered by cost", func(t *testing.T) {
+			maxCost := int32(30)
+			page, pagination, err := store.Products().List(&payloads.ProductFilter{
+				ListParams: payloads.ListParams{Limit: 10, Sort: "-name"},
+				MaxCost:    &maxCost,
+			})
+			if err != nil {
+				t.Fatalf("error while listing products %+v", err)
+			}
+			if pagination.Total != 3 || len(page) != 3 || page[0].Name != "product 4" {
+				t.Fatalf("expected products 4, 3 and 2, got: %+v", page)
+			}
+		})
+		t.Run("with unknown sort field", func(t *testing.T) {
+			_, _, err := store.Products().List(&payloads.ProductFilter{ListParams: payloads.ListParams{Limit: 10, Sort: "seller"}})
+			if err != repositories.ErrInvalidListParams {
+				t.Fatalf("expected error %+v, got: %+v", repositories.ErrInvalidListParams, err)
+			}
+		})
+		t.Run("with a page size out of range", func(t *testing.T) {
+			for _, limit := range []int{0, -1, payloads.MaxListLimit + 1} {
+				_, _, err := store.Products().List(&payloads.ProductFilter{ListParams: payloads.ListParams{Limit: limit}})
+				if err != repositories.ErrInvalidListParams {
+					t.Fatalf("expected error %+v for limit %d, got: %+v", repositories.ErrInvalidListParams, limit, err)
+				}
+				_, _, err = store.Users().List(&payloads.UserFilter{ListParams: payloads.ListParams{Limit: limit}})
+				if err != repositories.ErrInvalidListParams {
+					t.Fatalf("expected error %+v for limit %d, got: %+v", repositories.ErrInvalidListParams, limit, err)
+				}
+			}
+		})
+		t.Run("search by word prefixes", func(t *testing.T) {
+			found, total, err := store.Products().Search("choc prod", 2)
+			if err != nil {
+				t.Fatalf("error while searching products %+v", err)
+			}
+			if total != len(products) || len(found) != 2 {
+				t.Fatalf("expected 2 of %d products, got %d of %d", len(products), len(found), total)
+			}
+			if _, total, _ := store.Products().Search("caramel", 2); total != 0 {
+				t.Fatalf("expected no products, got: %d", total)
+			}
+		})
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		store, seller, products := newStore(t)
+
+		t.Run("roll back on error", func(t *testing.T) {
+			rollback := fmt.Errorf("rollback")
+			err := store.RunInTransaction(ctx, func(tx repositories.Session) error {
+				if err := tx.Products().Delete(products[0].ID); err != nil {
+					return err
+				}
+				if _, err := tx.Products().GetByID(products[0].ID); err != db.ErrNoMatch {
+					t.Fatalf("expected the transaction to see the deletion, got: %+v", err)
+				}
+				return rollback
+			})
+			if err != rollback {
+				t.Fatalf("expected error %+v, got: %+v", rollback, err)
+			}
+			if _, err := store.Products().GetByID(products[0].ID); err != nil {
+				t.Fatalf("expected the product to be kept, got: %+v", err)
+			}
+		})
+		t.Run("commit", func(t *testing.T) {
+			purchase := &models.Purchase{ID: uuid.NewV4(), UserID: seller.ID, ProductID: products[1].ID, SellerID: seller.ID, Quantity: 1}
+			err := store.RunInTransaction(ctx, func(tx repositories.Session) error {
+				return tx.Purchases().Insert(purchase)
+			})
+			if err != nil {
+				t.Fatalf("error while inserting purchase %+v", err)
+			}
+			if purchase.Status != models.PurchaseStatusCompleted || purchase.CreatedAt.IsZero() {
+				t.Fatalf("expected the defaults of the purchase to be filled in, got: %+v", purchase)
+			}
+			purchases, err := store.Purchases().List(repositories.PurchaseFilter{SellerID: seller.ID})
+			if err != nil {
+				t.Fatalf("error while listing purchases %+v", err)
+			}
+			if len(purchases) != 1 || purchases[0].Product == nil || purchases[0].Product.ID != products[1].ID {
+				t.Fatalf("expected the purchase with its product, got: %+v", purchases)
+			}
+		})
+		t.Run("canceled context", func(t *testing.T) {
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			err := store.RunInTransaction(canceled, func(tx repositories.Session) error {
+				t.Fatalf("expected the transaction not to run")
+				return nil
+			})
+			if err != context.Canceled {
+				t.Fatalf("expected error %+v, got: %+v", context.Canceled, err)
+			}
+		})
+	})
+
+	t.Run("purchases", func(t *testing.T) {
+		store, seller, products := newStore(t)
+		purchase := &models.Purchase{
+			ID:        uuid.NewV4(),
+			UserID:    seller.ID,
+			ProductID: products[0].ID,
+			SellerID:  seller.ID,
+			Quantity:  3,
+			Total:     150,
+			Status:    models.PurchaseStatusReserved,
+			CreatedAt: time.Now().Add(-time.Hour),
+		}
+		refund := &models.Purchase{
+			ID:        uuid.NewV4(),
+			UserID:    seller.ID,
+			ProductID: products[0].ID,
+			SellerID:  seller.ID,
+			Quantity:  -1,
+			Total:     -50,
+			RefundOf:  purchase.ID,
+		}
+		for _, p := range []*models.Purchase{purchase, refund} {
+			if err := store.Purchases().Insert(p); err != nil {
+				t.Fatalf("error while inserting purchase %+v", err)
+			}
+		}
+
+		t.Run("refunded amounts", func(t *testing.T) {
+			refunded, err := store.Purchases().RefundedAmounts(purchase.ID)
+			if err != nil {
+				t.Fatalf("error while adding up refunds %+v", err)
+			}
+			if refunded.Quantity != 1 || refunded.Total != 50 {
+				t.Fatalf("expected 1 unit and 50 refunded, got: %+v", refunded)
+			}
+		})
+		t.Run("stale reservations", func(t *testing.T) {
+			reserved, err := store.Purchases().ListReserved(time.Now().Add(-time.Minute), 10)
+			if err != nil {
+				t.Fatalf("error while listing reservations %+v", err)
+			}
+			if len(reserved) != 1 || reserved[0].ID != purchase.ID {
+				t.Fatalf("expected the reserved purchase, got: %+v", reserved)
+			}
+		})
+		t.Run("sales report", func(t *testing.T) {
+			report, err := store.Purchases().SalesReport()
+			if err != nil {
+				t.Fatalf("error while creating sales report %+v", err)
+			}
+			if report.Purchases != 1 || report.ItemsSold != 2 || report.Revenue != 100 || len(report.Products) != 1 {
+				t.Fatalf("expected 1 purchase of 2 items for 100, got: %+v", report)
+			}
+		})
+		t.Run("purchases restrict deleting their product and seller", func(t *testing.T) {
+			if err := store.Products().Delete(products[0].ID); err != repositories.ErrReferenced {
+				t.Fatalf("expected error %+v, got: %+v", repositories.ErrReferenced, err)
+			}
+			if err := store.Users().Delete(seller.ID); err != repositories.ErrReferenced {
+				t.Fatalf("expected error %+v, got: %+v", repositories.ErrReferenced, err)
+			}
+			if _, err := store.Purchases().GetByID(purchase.ID); err != nil {
+				t.Fatalf("expected the purchase to be kept, got: %+v", err)
+			}
+			if err := store.Products().Delete(products[1].ID); err != nil {
+				t.Fatalf("error while deleting a product without purchases %+v", err)
+			}
+		})
+	})
+
+	t.Run("machines", func(t *testing.T) {
+		store, seller, products := newStore(t)
+		machine := &models.Machine{ID: uuid.NewV4(), OperatorID: seller.ID, Name: "lobby"}
+		if err := store.Machines().Insert(machine); err != nil {
+			t.Fatalf("error while inserting machine %+v", err)
+		}
+
+		t.Run("slots with their products", func(t *testing.T) {
+			slot := &models.Slot{MachineID: machine.ID, Code: "A1", ProductID: products[0].ID, Capacity: 10, Quantity: 4}
+			if err := store.Slots().Upsert(slot); err != nil {
+				t.Fatalf("error while putting slot %+v", err)
+			}
+			replaced := &models.Slot{MachineID: machine.ID, Code: "A1", ProductID: products[1].ID, Capacity: 10, Quantity: 2}
+			if err := store.Slots().Upsert(replaced); err != nil {
+				t.Fatalf("error while replacing slot %+v", err)
+			}
+			if replaced.ID != slot.ID {
+				t.Fatalf("expected the slot with the same code to be replaced, got id %s instead of %s", replaced.ID, slot.ID)
+			}
+			withSlots, err := store.Machines().GetWithSlots(machine.ID)
+			if err != nil {
+				t.Fatalf("error while getting machine %+v", err)
+			}
+			if len(withSlots.Slots) != 1 || withSlots.Slots[0].Product == nil || withSlots.Slots[0].Product.ID != products[1].ID {
+				t.Fatalf("expected one slot holding product %s, got: %+v", products[1].ID, withSlots.Slots)
+			}
+		})
+		t.Run("filter products in stock", func(t *testing.T) {
+			inStock, _, err := store.Products().List(&payloads.ProductFilter{ListParams: payloads.ListParams{Limit: 10}, InStock: true})
+			if err != nil {
+				t.Fatalf("error while listing products %+v", err)
+			}
+			if len(inStock) != 1 || inStock[0].ID != products[1].ID {
+				t.Fatalf("expected product %s in stock, got: %+v", products[1].ID, inStock)
+			}
+		})
+		t.Run("coins", func(t *testing.T) {
+			if err := store.Coins().Add(machine.ID, 20, 3); err != nil {
+				t.Fatalf("error while adding coins %+v", err)
+			}
+			if err := store.Coins().Add(machine.ID, 20, -2); err != nil {
+				t.Fatalf("error while taking coins %+v", err)
+			}
+			if err := store.Coins().Add(machine.ID, 20, -2); err == nil {
+				t.Fatalf("expected an error while taking more coins than the tube holds")
+			}
+			coins, err := store.Coins().List(machine.ID)
+			if err != nil {
+				t.Fatalf("error while listing coins %+v", err)
+			}
+			if len(coins) != 1 || coins[0].Denomination != 20 || coins[0].Count != 1 {
+				t.Fatalf("expected one coin of 20, got: %+v", coins)
+			}
+		})
+		t.Run("sync events", func(t *testing.T) {
+			if sequence, appliedAt, err := store.SyncEvents().LastApplied(machine.ID); err != nil || sequence != 0 || appliedAt != nil {
+				t.Fatalf("expected no events, got: %d %v %+v", sequence, appliedAt, err)
+			}
+			event := &models.SyncEvent{
+				ID:         uuid.NewV4(),
+				MachineID:  machine.ID,
+				BatchID:    uuid.NewV4(),
+				Sequence:   7,
+				Kind:       models.SyncEventKindDeposit,
+				OccurredAt: time.Now(),
+				Status:     models.SyncEventStatusApplied,
+			}
+			if err := store.SyncEvents().Insert(event); err != nil {
+				t.Fatalf("error while inserting event %+v", err)
+			}
+			duplicate := *event
+			duplicate.ID = uuid.NewV4()
+			if err := store.SyncEvents().Insert(&duplicate); err != repositories.ErrConflict {
+				t.Fatalf("expected error %+v, got: %+v", repositories.ErrConflict, err)
+			}
+			sequence, appliedAt, err := store.SyncEvents().LastApplied(machine.ID)
+			if err != nil || sequence != 7 || appliedAt == nil || !appliedAt.Equal(event.AppliedAt) {
+				t.Fatalf("expected sequence 7 applied at %v, got: %d %v %+v", event.AppliedAt, sequence, appliedAt, err)
+			}
+		})
+	})
+
+	t.Run("categories", func(t *testing.T) {
+		store, _, products := newStore(t)
+		parent := &models.Category{ID: uuid.NewV4(), Name: "Snacks"}
+		child := &models.Category{ID: uuid.NewV4(), ParentID: parent.ID, Name: "Chocolate"}
+		for _, category := range []*models.Category{parent, child} {
+			if err := store.Categories().Insert(category); err != nil {
+				t.Fatalf("error while inserting category %+v", err)
+			}
+		}
+		products[0].CategoryID = child.ID
+		if err := store.Products().Update(products[0]); err != nil {
+			t.Fatalf("error while updating product %+v", err)
+		}
+
+		t.Run("insert with taken name", func(t *testing.T) {
+			category := &models.Category{ID: uuid.NewV4(), ParentID: parent.ID, Name: "chocolate"}
+			if err := store.Categories().Insert(category); err != repositories.ErrConflict {
+				t.Fatalf("expected error %+v, got: %+v", repositories.ErrConflict, err)
+			}
+		})
+		t.Run("filter products by category with subcategories", func(t *testing.T) {
+			filtered, _, err := store.Products().List(&payloads.ProductFilter{ListParams: payloads.ListParams{Limit: 10}, CategoryID: parent.ID})
+			if err != nil {
+				t.Fatalf("error while listing products %+v", err)
+			}
+			if len(filtered) != 1 || filtered[0].ID != products[0].ID {
+				t.Fatalf("expected product %s in the category, got: %+v", products[0].ID, filtered)
+			}
+		})
+		t.Run("delete", func(t *testing.T) {
+			if err := store.Categories().Delete(parent.ID); err != repositories.ErrReferenced {
+				t.Fatalf("expected error %+v, got: %+v", repositories.ErrReferenced, err)
+			}
+			if err := store.Categories().Delete(child.ID); err != nil {
+				t.Fatalf("error while deleting category %+v", err)
+			}
+			product, _ := store.Products().GetByID(products[0].ID)
+			if product.CategoryID != uuid.Nil {
+				t.Fatalf("expected the product to be left without a category, got: %+v", product)
+			}
+			if err := store.Categories().Delete(child.ID); err != db.ErrNoMatch {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+			}
+		})
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		store, seller, _ := newStore(t)
+		session := &models.Session{ID: uuid.NewV4(), UserID: seller.ID, JTI: "first", ExpiresAt: time.Now().Add(time.Hour)}
+		if err := store.Sessions().Insert(session); err != nil {
+			t.Fatalf("error while inserting session %+v", err)
+		}
+		token := &models.RefreshToken{ID: uuid.NewV4(), UserID: seller.ID, SessionID: session.ID, TokenHash: "hash",
+			ExpiresAt: time.Now().Add(time.Hour)}
+		if err := store.RefreshTokens().Insert(token); err != nil {
+			t.Fatalf("error while inserting refresh token %+v", err)
+		}
+
+		t.Run("touch and end", func(t *testing.T) {
+			if touched, err := store.Sessions().TouchSession("first"); err != nil || !touched {
+				t.Fatalf("expected the session to be touched, got: %v %+v", touched, err)
+			}
+			if err := store.Sessions().EndAll(seller.ID, ""); err != nil {
+				t.Fatalf("error while ending sessions %+v", err)
+			}
+			if touched, err := store.Sessions().TouchSession("first"); err != nil || touched {
+				t.Fatalf("expected the ended session not to be touched, got: %v %+v", touched, err)
+			}
+			if active, err := store.Sessions().HasActive(seller.ID); err != nil || active {
+				t.Fatalf("expected no active session, got: %v %+v", active, err)
+			}
+		})
+		t.Run("revoke refresh token by hash", func(t *testing.T) {
+			if _, err := store.RefreshTokens().RevokeByHash(uuid.NewV4(), "hash"); err != db.ErrNoMatch {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+			}
+			revoked, err := store.RefreshTokens().RevokeByHash(seller.ID, "hash")
+			if err != nil || revoked.RevokedAt == nil {
+				t.Fatalf("expected the refresh token to be revoked, got: %+v %+v", revoked, err)
+			}
+			again, err := store.RefreshTokens().RevokeByHash(seller.ID, "hash")
+			if err != nil || again.RevokedAt == nil || !again.RevokedAt.Equal(*revoked.RevokedAt) {
+				t.Fatalf("expected the time it was revoked to be kept, got: %+v %+v", again, err)
+			}
+		})
+		t.Run("idempotency keys", func(t *testing.T) {
+			key := &models.IdempotencyKey{UserID: seller.ID, IdempotencyKey: "key", RequestHash: "request"}
+			if inserted, err := store.IdempotencyKeys().Insert(key); err != nil || !inserted {
+				t.Fatalf("expected the key to be claimed, got: %v %+v", inserted, err)
+			}
+			if inserted, err := store.IdempotencyKeys().Insert(&models.IdempotencyKey{UserID: seller.ID, IdempotencyKey: "key"}); err != nil || inserted {
+				t.Fatalf("expected the claimed key not to be claimed again, got: %v %+v", inserted, err)
+			}
+			key.Status, key.ContentType, key.Body = 201, "application/json", []byte("{}")
+			if err := store.IdempotencyKeys().Complete(key); err != nil {
+				t.Fatalf("error while completing key %+v", err)
+			}
+			stored, err := store.IdempotencyKeys().Get(seller.ID, "key")
+			if err != nil || !stored.IsCompleted() || stored.Status != 201 || string(stored.Body) != "{}" {
+				t.Fatalf("expected the stored response, got: %+v %+v", stored, err)
+			}
+		})
+	})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/app"
+	"github.com/sirupsen/logrus"
+)
+
+// A job is work the server repeats in the background while it handles requests. run returns the number
+// of records it processed
+type job struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) (int, error)
+}
+
+// backgroundJobs returns the jobs the server runs for the app, jobs with an interval of zero are disabled
+func backgroundJobs(a *app.App) []job {
+	return []job{
+		{
+			name:     "activate scheduled prices",
+			interval: a.Config.PriceActivationInterval,
+			run:      a.Services.ProductPrices.ActivateScheduledPrices,
+		},
+		{
+			name:     "expire vend reservations",
+			interval: a.Config.VendExpiryInterval,
+			run:      a.Services.Users.ExpireReservations,
+		},
+	}
+}
+
+// startJobs runs every job on its interval until the context is cancelled. The returned WaitGroup is done
+// once every job stopped
+func startJobs(ctx context.Context, jobs []job) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+	for _, j := range jobs {
+		if j.interval <= 0 {
+			logrus.Infof("Background job %q is disabled", j.name)
+			continue
+		}
+		wg.Add(1)
+		go func(j job) {
+			defer wg.Done()
+			ticker := time.NewTicker(j.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					processed, err := j.run(ctx)
+					if err != nil {
+						logrus.Errorf("Background job %q failed: %+v", j.name, err)
+					} else if processed > 0 {
+						logrus.Infof("Background job %q processed %d records", j.name, processed)
+					}
+				}
+			}
+		}(j)
+	}
+	return wg
+}
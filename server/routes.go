@@ -6,14 +6,13 @@ import (
 	"time"
 
 	"github.com/dhurimkelmendi/vending_machine/api"
+	"github.com/dhurimkelmendi/vending_machine/app"
 	"github.com/dhurimkelmendi/vending_machine/auth"
 	"github.com/dhurimkelmendi/vending_machine/config"
 	"github.com/dhurimkelmendi/vending_machine/controllers"
 	"github.com/dhurimkelmendi/vending_machine/internal/trace"
-	"github.com/dhurimkelmendi/vending_machine/models"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/cors"
-	"github.com/go-chi/jwtauth/v5"
 	"github.com/segmentio/ksuid"
 	"github.com/sirupsen/logrus"
 )
@@ -70,9 +69,7 @@ func requestIDAdder(prefix string) func(http.Handler) http.Handler {
 	}
 }
 
-func getCORSHandler() func(http.Handler) http.Handler {
-	cfg := config.GetDefaultInstance()
-
+func getCORSHandler(cfg *config.Config) func(http.Handler) http.Handler {
 	allowAllOrigins := cfg.AllowAllCORSOrigins
 	allowedOrigins := strings.Split(cfg.CORSOrigins, ",")
 
@@ -90,50 +87,117 @@ func getCORSHandler() func(http.Handler) http.Handler {
 	}).Handler
 }
 
-// Routes returns the registered HTTP endpoints for the web application.
+// Routes returns the registered HTTP endpoints for the default app.
 func Routes() http.Handler {
+	return New(app.GetDefaultInstance())
+}
+
+// New returns the registered HTTP endpoints for the given app.
+func New(a *app.App) http.Handler {
 	r := chi.NewRouter()
-	r.Use(getCORSHandler())
+	r.Use(getCORSHandler(a.Config))
 	r.Use(logRequest)
 
-	ctrl := controllers.GetControllersDefaultInstance()
-	stateless := auth.GetStatelessAuthenticationProviderDefaultInstance()
+	ctrl := a.Controllers
+	stateless := a.Stateless
+
+	r.Get("/.well-known/jwks.json", ctrl.WellKnown.GetJWKS)
 
 	// Public routes
 	r.Route("/public/api/v1", func(r chi.Router) {
 		r.Post("/users", ctrl.Users.CreateUser)
 		r.Post("/users/login", ctrl.Users.LoginUser)
+		r.Post("/users/refresh", ctrl.Users.RefreshToken)
 	})
 
 	// Protected routes - Requires authentication
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Use(jwtauth.Verifier(stateless.TokenAuth))
+		r.Use(stateless.Verifier)
 		r.Use(stateless.Authenticator)
-		allUserRolesOptions := controllers.AuthorizationOptions{
-			AllowedUserRoles: []models.UserRole{models.UserRoleBuyer, models.UserRoleSeller},
-		}
-		sellerOnlyOptions := controllers.AuthorizationOptions{
-			AllowedUserRoles: []models.UserRole{models.UserRoleSeller},
-		}
-		buyerOnlyOptions := controllers.AuthorizationOptions{
-			AllowedUserRoles: []models.UserRole{models.UserRoleBuyer},
-		}
+		authenticatedOptions := controllers.AuthorizationOptions{}
 
 		// users
-		r.Put("/users", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxUpdateUser, ctrl.Users.UpdateUser, allUserRolesOptions))
-		r.Delete("/users/{id}", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDeleteUser, ctrl.Users.DeleteUser, allUserRolesOptions))
-		r.Get("/users", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetUsers, ctrl.Users.GetAllUsers, allUserRolesOptions))
-		r.Get("/users/{id}", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetUser, ctrl.Users.GetUserByID, allUserRolesOptions))
-		r.Post("/deposit", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, ctrl.Users.DepositMoney, buyerOnlyOptions))
-		r.Post("/reset", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxResetDeposit, ctrl.Users.ResetDeposit, buyerOnlyOptions))
-		r.Post("/buy", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxBuyProduct, ctrl.Users.BuyProduct, buyerOnlyOptions))
+		r.Post("/users/logout", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxLogoutUser, ctrl.Users.LogoutUser, authenticatedOptions))
+		r.Post("/logout/all", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxLogoutOthers, ctrl.Users.LogoutOtherSessions, authenticatedOptions))
+		r.Get("/sessions", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetSessions, ctrl.Users.GetSessions, authenticatedOptions))
+		r.Put("/users", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxUpdateUser, ctrl.Users.UpdateUser, controllers.RequirePermissions(auth.PermUserWrite.Own(), auth.PermUserWrite.Any())))
+		r.Delete("/users/{id}", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDeleteUser, ctrl.Users.DeleteUser, controllers.RequirePermissions(auth.PermUserWrite.Own(), auth.PermUserWrite.Any())))
+		r.Get("/users", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetUsers, ctrl.Users.GetAllUsers, controllers.RequirePermissions(auth.PermUserRead)))
+		r.Get("/users/{id}", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxGetUser, ctrl.Users.GetUserByID, controllers.RequirePermissions(auth.PermUserRead)))
+		r.Post("/deposit", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, ctrl.Idempotent(ctrl.Users.AuthenticatedController, api.CtxDepositMoney, ctrl.Users.DepositMoney), controllers.RequirePermissions(auth.PermDepositWrite)))
+		r.Post("/reset", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxResetDeposit, ctrl.Users.ResetDeposit, controllers.RequirePermissions(auth.PermDepositWrite)))
+		r.Post("/buy", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxBuyProduct, ctrl.Idempotent(ctrl.Users.AuthenticatedController, api.CtxBuyProduct, ctrl.Users.BuyProduct), controllers.RequirePermissions(auth.PermProductBuy)))
+		r.Post("/checkout", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxCheckout, ctrl.Idempotent(ctrl.Users.AuthenticatedController, api.CtxCheckout, ctrl.Users.Checkout), controllers.RequirePermissions(auth.PermProductBuy)))
 
 		// products
-		r.Get("/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxGetProducts, ctrl.Products.GetAllProducts, allUserRolesOptions))
-		r.Get("/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxGetProduct, ctrl.Products.GetProductByID, allUserRolesOptions))
-		r.Post("/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxCreateProduct, ctrl.Products.CreateProduct, sellerOnlyOptions))
-		r.Put("/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxUpdateProduct, ctrl.Products.UpdateProduct, sellerOnlyOptions))
-		r.Delete("/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxDeleteProduct, ctrl.Products.DeleteProduct, sellerOnlyOptions))
+		r.Get("/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxGetProducts, ctrl.Products.GetAllProducts, controllers.RequirePermissions(auth.PermProductRead)))
+		r.Get("/products/search", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxSearchProduct, ctrl.Products.SearchProducts, controllers.RequirePermissions(auth.PermProductRead)))
+		r.Get("/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxGetProduct, ctrl.Products.GetProductByID, controllers.RequirePermissions(auth.PermProductRead)))
+		r.Post("/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxCreateProduct, ctrl.Products.CreateProduct, controllers.RequirePermissions(auth.PermProductCreate)))
+		r.Put("/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxUpdateProduct, ctrl.Products.UpdateProduct, controllers.RequirePermissions(auth.PermProductWrite.Own(), auth.PermProductWrite.Any())))
+		r.Delete("/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxDeleteProduct, ctrl.Products.DeleteProduct, controllers.RequirePermissions(auth.PermProductWrite.Own(), auth.PermProductWrite.Any())))
+		r.Get("/products/{id}/prices", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxGetProductPrices, ctrl.Products.GetProductPrices, controllers.RequirePermissions(auth.PermProductRead)))
+		r.Post("/products/{id}/prices", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxScheduleProductPrice, ctrl.Products.ScheduleProductPrice, controllers.RequirePermissions(auth.PermProductWrite.Own(), auth.PermProductWrite.Any())))
+		r.Delete("/products/{id}/prices/{priceId}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxCancelProductPrice, ctrl.Products.CancelProductPrice, controllers.RequirePermissions(auth.PermProductWrite.Own(), auth.PermProductWrite.Any())))
+
+		// categories
+		r.Get("/categories", ctrl.AuthenticationRequired(ctrl.Categories.AuthenticatedController, api.CtxGetCategories, ctrl.Categories.GetCategoryTree, controllers.RequirePermissions(auth.PermProductRead)))
+		r.Get("/categories/{id}", ctrl.AuthenticationRequired(ctrl.Categories.AuthenticatedController, api.CtxGetCategory, ctrl.Categories.GetCategoryByID, controllers.RequirePermissions(auth.PermProductRead)))
+		r.Post("/categories", ctrl.AuthenticationRequired(ctrl.Categories.AuthenticatedController, api.CtxCreateCategory, ctrl.Categories.CreateCategory, controllers.RequirePermissions(auth.PermCategoryWrite)))
+		r.Put("/categories/{id}", ctrl.AuthenticationRequired(ctrl.Categories.AuthenticatedController, api.CtxUpdateCategory, ctrl.Categories.UpdateCategory, controllers.RequirePermissions(auth.PermCategoryWrite)))
+		r.Delete("/categories/{id}", ctrl.AuthenticationRequired(ctrl.Categories.AuthenticatedController, api.CtxDeleteCategory, ctrl.Categories.DeleteCategory, controllers.RequirePermissions(auth.PermCategoryWrite)))
+
+		// promotions
+		r.Get("/promotions", ctrl.AuthenticationRequired(ctrl.Promotions.AuthenticatedController, api.CtxGetPromotions, ctrl.Promotions.GetPromotions, controllers.RequirePermissions(auth.PermProductRead)))
+		r.Get("/promotions/{id}", ctrl.AuthenticationRequired(ctrl.Promotions.AuthenticatedController, api.CtxGetPromotion, ctrl.Promotions.GetPromotionByID, controllers.RequirePermissions(auth.PermProductRead)))
+		r.Post("/promotions", ctrl.AuthenticationRequired(ctrl.Promotions.AuthenticatedController, api.CtxCreatePromotion, ctrl.Promotions.CreatePromotion, controllers.RequirePermissions(auth.PermPromotionWrite.Own(), auth.PermPromotionWrite.Any())))
+		r.Put("/promotions/{id}", ctrl.AuthenticationRequired(ctrl.Promotions.AuthenticatedController, api.CtxUpdatePromotion, ctrl.Promotions.UpdatePromotion, controllers.RequirePermissions(auth.PermPromotionWrite.Own(), auth.PermPromotionWrite.Any())))
+		r.Delete("/promotions/{id}", ctrl.AuthenticationRequired(ctrl.Promotions.AuthenticatedController, api.CtxDeletePromotion, ctrl.Promotions.DeletePromotion, controllers.RequirePermissions(auth.PermPromotionWrite.Own(), auth.PermPromotionWrite.Any())))
+
+		// purchases
+		r.Get("/purchases", ctrl.AuthenticationRequired(ctrl.Purchases.AuthenticatedController, api.CtxGetPurchases, ctrl.Purchases.GetPurchases, controllers.RequirePermissions(auth.PermPurchaseRead.Own(), auth.PermPurchaseRead.Any(), auth.PermSaleRead)))
+		r.Post("/purchases/{id}/refund", ctrl.AuthenticationRequired(ctrl.Purchases.AuthenticatedController, api.CtxRefundPurchase, ctrl.Idempotent(ctrl.Purchases.AuthenticatedController, api.CtxRefundPurchase, ctrl.Purchases.RefundPurchase), controllers.RequirePermissions(auth.PermPurchaseRefund.Own(), auth.PermPurchaseRefund.Any(), auth.PermSaleRefund)))
+		r.Post("/purchases/{id}/dispense", ctrl.AuthenticationRequired(ctrl.Purchases.AuthenticatedController, api.CtxDispensePurchase, ctrl.Purchases.DispensePurchase, controllers.RequirePermissions(auth.PermPurchaseVend.Own(), auth.PermPurchaseVend.Any())))
+		r.Post("/purchases/{id}/confirm", ctrl.AuthenticationRequired(ctrl.Purchases.AuthenticatedController, api.CtxConfirmPurchase, ctrl.Purchases.ConfirmPurchase, controllers.RequirePermissions(auth.PermPurchaseVend.Own(), auth.PermPurchaseVend.Any())))
+		r.Post("/purchases/{id}/fail", ctrl.AuthenticationRequired(ctrl.Purchases.AuthenticatedController, api.CtxFailPurchase, ctrl.Idempotent(ctrl.Purchases.AuthenticatedController, api.CtxFailPurchase, ctrl.Purchases.FailPurchase), controllers.RequirePermissions(auth.PermPurchaseVend.Own(), auth.PermPurchaseVend.Any())))
+
+		// accounts
+		r.Get("/accounts/revenue", ctrl.AuthenticationRequired(ctrl.Accounts.AuthenticatedController, api.CtxGetRevenue, ctrl.Accounts.GetRevenue, controllers.RequirePermissions(auth.PermSaleRead)))
+
+		// payouts
+		r.Get("/payouts", ctrl.AuthenticationRequired(ctrl.Payouts.AuthenticatedController, api.CtxGetPayouts, ctrl.Payouts.GetPayouts, controllers.RequirePermissions(auth.PermPayoutRead.Own(), auth.PermPayoutRead.Any())))
+		r.Get("/payouts/{id}", ctrl.AuthenticationRequired(ctrl.Payouts.AuthenticatedController, api.CtxGetPayout, ctrl.Payouts.GetPayoutByID, controllers.RequirePermissions(auth.PermPayoutRead.Own(), auth.PermPayoutRead.Any())))
+		r.Get("/payouts/{id}/statement", ctrl.AuthenticationRequired(ctrl.Payouts.AuthenticatedController, api.CtxGetPayoutStatement, ctrl.Payouts.GetPayoutStatement, controllers.RequirePermissions(auth.PermPayoutRead.Own(), auth.PermPayoutRead.Any())))
+		r.Post("/payouts", ctrl.AuthenticationRequired(ctrl.Payouts.AuthenticatedController, api.CtxRequestPayout, ctrl.Idempotent(ctrl.Payouts.AuthenticatedController, api.CtxRequestPayout, ctrl.Payouts.RequestPayout), controllers.RequirePermissions(auth.PermPayoutRequest)))
+
+		// machines
+		r.Get("/machines", ctrl.AuthenticationRequired(ctrl.Machines.AuthenticatedController, api.CtxGetMachines, ctrl.Machines.GetAllMachines, controllers.RequirePermissions(auth.PermMachineRead)))
+		r.Get("/machines/{id}", ctrl.AuthenticationRequired(ctrl.Machines.AuthenticatedController, api.CtxGetMachine, ctrl.Machines.GetMachineByID, controllers.RequirePermissions(auth.PermMachineRead)))
+		r.Post("/machines", ctrl.AuthenticationRequired(ctrl.Machines.AuthenticatedController, api.CtxCreateMachine, ctrl.Machines.CreateMachine, controllers.RequirePermissions(auth.PermMachineCreate)))
+		r.Put("/machines/{id}/slots/{code}", ctrl.AuthenticationRequired(ctrl.Machines.AuthenticatedController, api.CtxAssignSlot, ctrl.Machines.AssignSlot, controllers.RequirePermissions(auth.PermMachineWrite.Own(), auth.PermMachineWrite.Any())))
+
+		// coin inventory
+		r.Get("/machines/{id}/coins", ctrl.AuthenticationRequired(ctrl.Coins.AuthenticatedController, api.CtxGetCoinInventory, ctrl.Coins.GetCoinInventory, controllers.RequirePermissions(auth.PermMachineWrite.Own(), auth.PermMachineWrite.Any())))
+		r.Post("/machines/{id}/coins/refill", ctrl.AuthenticationRequired(ctrl.Coins.AuthenticatedController, api.CtxRefillCoins, ctrl.Coins.RefillCoins, controllers.RequirePermissions(auth.PermMachineWrite.Own(), auth.PermMachineWrite.Any())))
+
+		// sync
+		r.Post("/sync/batches", ctrl.AuthenticationRequired(ctrl.Sync.AuthenticatedController, api.CtxPushSyncBatch, ctrl.Sync.PushBatch, controllers.RequirePermissions(auth.PermMachineWrite.Own(), auth.PermMachineWrite.Any())))
+		r.Get("/sync/machines/{id}/catalogue", ctrl.AuthenticationRequired(ctrl.Sync.AuthenticatedController, api.CtxGetSyncCatalogue, ctrl.Sync.GetCatalogue, controllers.RequirePermissions(auth.PermMachineRead)))
+
+		// admin
+		r.Get("/admin/users", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxGetUsers, ctrl.Admin.GetAllUsers, controllers.RequirePermissions(auth.PermUserManage)))
+		r.Post("/admin/users/{id}/disable", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxDisableUser, ctrl.Admin.DisableUser, controllers.RequirePermissions(auth.PermUserManage)))
+		r.Post("/admin/users/{id}/enable", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxEnableUser, ctrl.Admin.EnableUser, controllers.RequirePermissions(auth.PermUserManage)))
+		r.Post("/admin/users/{id}/reset", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxResetDeposit, ctrl.Admin.ResetDeposit, controllers.RequirePermissions(auth.PermDepositReset)))
+		r.Put("/admin/users/{id}/role", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxUpdateUserRole, ctrl.Admin.UpdateUserRole, controllers.RequirePermissions(auth.PermUserManage)))
+		r.Delete("/admin/users/{id}", ctrl.AuthenticationRequired(ctrl.Users.AuthenticatedController, api.CtxDeleteUser, ctrl.Users.DeleteUser, controllers.RequirePermissions(auth.PermUserWrite.Any())))
+		r.Put("/admin/products", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxUpdateProduct, ctrl.Products.UpdateProduct, controllers.RequirePermissions(auth.PermProductWrite.Any())))
+		r.Delete("/admin/products/{id}", ctrl.AuthenticationRequired(ctrl.Products.AuthenticatedController, api.CtxDeleteProduct, ctrl.Products.DeleteProduct, controllers.RequirePermissions(auth.PermProductWrite.Any())))
+		r.Get("/admin/purchases", ctrl.AuthenticationRequired(ctrl.Purchases.AuthenticatedController, api.CtxGetPurchases, ctrl.Purchases.GetPurchases, controllers.RequirePermissions(auth.PermPurchaseRead.Any())))
+		r.Get("/admin/accounts/reconciliation", ctrl.AuthenticationRequired(ctrl.Accounts.AuthenticatedController, api.CtxReconcile, ctrl.Accounts.Reconcile, controllers.RequirePermissions(auth.PermReportRead)))
+		r.Post("/admin/payouts/{id}/approve", ctrl.AuthenticationRequired(ctrl.Payouts.AuthenticatedController, api.CtxApprovePayout, ctrl.Idempotent(ctrl.Payouts.AuthenticatedController, api.CtxApprovePayout, ctrl.Payouts.ApprovePayout), controllers.RequirePermissions(auth.PermPayoutApprove)))
+		r.Post("/admin/payouts/{id}/reject", ctrl.AuthenticationRequired(ctrl.Payouts.AuthenticatedController, api.CtxRejectPayout, ctrl.Payouts.RejectPayout, controllers.RequirePermissions(auth.PermPayoutApprove)))
+		r.Get("/admin/reports/sales", ctrl.AuthenticationRequired(ctrl.Admin.AuthenticatedController, api.CtxGetSalesReport, ctrl.Admin.GetSalesReport, controllers.RequirePermissions(auth.PermReportRead)))
 	})
 	return r
 }
@@ -5,9 +5,10 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 
-	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/app"
 	"github.com/dhurimkelmendi/vending_machine/internal/trace"
 	"github.com/go-chi/chi"
 	"github.com/sirupsen/logrus"
@@ -15,34 +16,47 @@ import (
 
 // Server is the main API server class.
 type Server struct {
+	app        *app.App
 	httpServer *http.Server
 	done       chan bool
 	quit       chan os.Signal
+	stopJobs   context.CancelFunc
+	jobs       *sync.WaitGroup
 }
 
-var defaultInstance *Server
+var (
+	defaultInstance     *Server
+	defaultInstanceOnce sync.Once
+)
 
 // GetDefaultInstance returns the default instance of Server
 func GetDefaultInstance() *Server {
-	if defaultInstance == nil {
-		defaultInstance = &Server{}
-	}
+	defaultInstanceOnce.Do(func() {
+		defaultInstance = NewServer(app.GetDefaultInstance())
+	})
 	return defaultInstance
 }
 
+// NewServer creates a server handling the requests of the given app
+func NewServer(a *app.App) *Server {
+	return &Server{app: a}
+}
+
 // Start starts the server
 func (s *Server) Start() {
-	cfg := config.GetDefaultInstance()
-
-	s.httpServer = &http.Server{Addr: cfg.HTTPAddr}
+	s.httpServer = &http.Server{Addr: s.app.Config.HTTPAddr}
 	s.done = make(chan bool, 1)
 	s.quit = make(chan os.Signal, 1)
 
-	h, ok := Routes().(*chi.Mux)
+	h, ok := New(s.app).(*chi.Mux)
 	if !ok {
 		logrus.Errorf("%s: Router is not an instance of a *chi.Mux, static files will not be served", trace.Getfl())
 	}
 	s.httpServer.Handler = h
+
+	var jobsCtx context.Context
+	jobsCtx, s.stopJobs = context.WithCancel(context.Background())
+	s.jobs = startJobs(jobsCtx, backgroundJobs(s.app))
 	go s.listenForShutdown()
 
 	signal.Notify(s.quit, os.Interrupt)
@@ -72,6 +86,8 @@ func (s *Server) listenForShutdown() {
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		logrus.Errorf("Could not gracefully shutdown the server: %+v", err)
 	}
+	s.stopJobs()
+	s.jobs.Wait()
 
 	// Inform the main goroutine that shutdown is complete.
 	s.done <- true
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrUnbalancedJournal is returned when posting a journal transaction whose debits and credits do not add up
+var ErrUnbalancedJournal = fmt.Errorf("journal transaction is not balanced")
+
+// revenueStatementEntries is the number of latest movements listed in a revenue statement
+const revenueStatementEntries = 50
+
+// AccountService is a struct that contains a reference to the store
+type AccountService struct {
+	store repositories.Store
+}
+
+// GetAccountServiceDefaultInstance returns the default instance of AccountService
+func GetAccountServiceDefaultInstance() *AccountService {
+	return GetDefaultInstance().Accounts
+}
+
+// NewAccountService creates an AccountService keeping the journal in the given store
+func NewAccountService(store repositories.Store) *AccountService {
+	return &AccountService{
+		store: store,
+	}
+}
+
+// accountRef identifies an account by its type and owner, the account is created when it is first posted to
+type accountRef struct {
+	accountType models.AccountType
+	ownerID     uuid.UUID
+}
+
+func buyerWallet(userID uuid.UUID) accountRef {
+	return accountRef{accountType: models.AccountTypeBuyerWallet, ownerID: userID}
+}
+func changeOwed(userID uuid.UUID) accountRef {
+	return accountRef{accountType: models.AccountTypeChangeOwed, ownerID: userID}
+}
+func machineCash(machineID uuid.UUID) accountRef {
+	return accountRef{accountType: models.AccountTypeMachineCash, ownerID: machineID}
+}
+func sellerRevenue(sellerID uuid.UUID) accountRef {
+	return accountRef{accountType: models.AccountTypeSellerRevenue, ownerID: sellerID}
+}
+
+var externalAccount = accountRef{accountType: models.AccountTypeExternal, ownerID: uuid.Nil}
+var platformFeeAccount = accountRef{accountType: models.AccountTypePlatformFee, ownerID: uuid.Nil}
+
+// posting is the amount an account is debited with, or credited with when it is negative
+type posting struct {
+	account accountRef
+	amount  int64
+}
+
+// transfer returns the postings moving the amount from the credited account to the debited account
+func transfer(amount int64, debit accountRef, credit accountRef) []posting {
+	return []posting{{account: debit, amount: amount}, {account: credit, amount: -amount}}
+}
+
+// salePostings returns the postings paying the sellers of the purchases and the platform fee from the wallet of the buyer
+func salePostings(buyerID uuid.UUID, purchases []*models.Purchase) []posting {
+	postings := make([]posting, 0, 3*len(purchases))
+	for _, purchase := range purchases {
+		postings = append(postings,
+			posting{account: buyerWallet(buyerID), amount: int64(purchase.Total)},
+			posting{account: sellerRevenue(purchase.SellerID), amount: -int64(purchase.Total - purchase.PlatformFee)},
+			posting{account: platformFeeAccount, amount: -int64(purchase.PlatformFee)},
+		)
+	}
+	return postings
+}
+
+// GetRevenue returns the revenue balance of the seller with its latest movements
+func (s *AccountService) GetRevenue(sellerID uuid.UUID) (*payloads.RevenueStatement, error) {
+	statement := &payloads.RevenueStatement{SellerID: sellerID, Entries: make([]*payloads.RevenueEntry, 0)}
+	ref := sellerRevenue(sellerID)
+	account, err := s.store.Journal().GetAccount(ref.accountType, ref.ownerID)
+	switch err {
+	case nil:
+	case db.ErrNoMatch:
+		// nothing was sold yet
+		return statement, nil
+	default:
+		return statement, err
+	}
+	statement.Balance = account.NormalBalance()
+
+	statement.Entries, err = s.store.Journal().ListRevenueEntries(account.ID, revenueStatementEntries)
+	if err != nil {
+		return statement, err
+	}
+	return statement, nil
+}
+
+// Reconcile compares the journal with the balances kept outside of it: the deposit of every user must equal the
+// balance of their wallet, every transaction must balance and every account balance must equal the sum of its entries
+func (s *AccountService) Reconcile() (*payloads.Reconciliation, error) {
+	reconciliation, err := s.store.Journal().Reconcile()
+	if err != nil {
+		return reconciliation, err
+	}
+
+	reconciliation.Reconciled = len(reconciliation.DepositMismatches) == 0 &&
+		len(reconciliation.UnbalancedTransactions) == 0 &&
+		len(reconciliation.MisstatedAccounts) == 0
+	return reconciliation, nil
+}
+
+// post records the postings as a journal transaction of the given kind and adds them to the account balances.
+// Postings to the same account are added up and zero amounts are left out, nothing is recorded if no amount is left.
+// The accounts are locked ordered by id, after all other rows of the transaction, so concurrent postings cannot deadlock
+func (s *AccountService) post(tx repositories.Session, kind models.JournalKind, referenceID uuid.UUID, requestID string, postings ...posting) (*models.JournalTransaction, error) {
+	amounts := make(map[accountRef]int64, len(postings))
+	refs := make([]accountRef, 0, len(postings))
+	var sum int64
+	for _, p := range postings {
+		if _, ok := amounts[p.account]; !ok {
+			refs = append(refs, p.account)
+		}
+		amounts[p.account] += p.amount
+		sum += p.amount
+	}
+	if sum != 0 {
+		return nil, ErrUnbalancedJournal
+	}
+
+	accounts := make([]*models.Account, 0, len(refs))
+	for _, ref := range refs {
+		if amounts[ref] == 0 {
+			continue
+		}
+		account, err := tx.Journal().GetOrCreateAccount(ref.accountType, ref.ownerID)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	if len(accounts) == 0 {
+		return nil, nil
+	}
+	sort.Slice(accounts, func(a, b int) bool {
+		return bytes.Compare(accounts[a].ID.Bytes(), accounts[b].ID.Bytes()) < 0
+	})
+
+	transaction := &models.JournalTransaction{
+		ID:          uuid.NewV4(),
+		Kind:        kind,
+		ReferenceID: referenceID,
+		RequestID:   requestID,
+		Entries:     make([]*models.JournalEntry, 0, len(accounts)),
+	}
+	for _, account := range accounts {
+		transaction.Entries = append(transaction.Entries, &models.JournalEntry{
+			ID:            uuid.NewV4(),
+			TransactionID: transaction.ID,
+			AccountID:     account.ID,
+			Amount:        amounts[accountRef{accountType: account.Type, ownerID: account.OwnerID}],
+		})
+	}
+	if err := tx.Journal().InsertTransaction(transaction); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
@@ -0,0 +1,119 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestAccountService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.Accounts
+	userService := a.Services.Users
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	sellerContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+	ctx := context.Background()
+
+	productToCreate := &payloads.CreateProductPayload{
+		Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+		Cost: 35,
+	}
+	product, err := a.Services.Products.CreateProduct(ctx, productToCreate, seller.ID)
+	if err != nil {
+		t.Fatalf("error while creating product %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	buyer, err := userService.CreateUser(ctx, &payloads.CreateUserPayload{
+		Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+		Password: "password",
+		Role:     models.UserRoleBuyer,
+	})
+	if err != nil {
+		t.Fatalf("error while creating user %+v", err)
+	}
+
+	t.Run("revenue of a new seller", func(t *testing.T) {
+		newSeller, err := fixture.User.CreateSellerUser()
+		if err != nil {
+			t.Fatalf("could not create seller: %+v", err)
+		}
+		statement, err := service.GetRevenue(newSeller.ID)
+		if err != nil {
+			t.Fatalf("get revenue failed: %+v", err)
+		}
+		if statement.Balance != 0 || len(statement.Entries) != 0 {
+			t.Fatalf("expected no revenue, got: %+v", statement)
+		}
+	})
+
+	var purchase *models.Purchase
+	t.Run("revenue of a purchase", func(t *testing.T) {
+		for _, coin := range []int32{50, 20} {
+			if _, err := userService.DepositMoney(ctx, &payloads.DepositMoneyPayload{MachineID: machine.ID, DepositAmount: coin}, buyer.ID); err != nil {
+				t.Fatalf("deposit money failed: %+v", err)
+			}
+		}
+		productPurchase := &payloads.UserProductPurchase{MachineID: machine.ID, ProductID: product.ID, Amount: 1}
+		report, err := userService.BuyProduct(ctx, productPurchase, buyer.ID)
+		if err != nil {
+			t.Fatalf("buy product failed: %+v", err)
+		}
+		purchase = report.Purchases[0]
+
+		statement, err := service.GetRevenue(seller.ID)
+		if err != nil {
+			t.Fatalf("get revenue failed: %+v", err)
+		}
+		// the platform fee is rounded down
+		if fee := product.Cost * a.Config.PlatformFeePercent / 100; purchase.PlatformFee != fee {
+			t.Fatalf("expected a platform fee of %d, got: %+v", fee, purchase)
+		}
+		revenue := int64(purchase.Total - purchase.PlatformFee)
+		if statement.Balance != revenue || len(statement.Entries) != 1 {
+			t.Fatalf("expected a revenue of %d from one purchase, got: %+v", revenue, statement)
+		}
+		if entry := statement.Entries[0]; entry.Kind != models.JournalKindPurchase || entry.Amount != revenue || entry.ReferenceID != purchase.CheckoutID {
+			t.Fatalf("expected the purchase in the revenue entries, got: %+v", entry)
+		}
+	})
+
+	t.Run("revenue of a refund", func(t *testing.T) {
+		if _, err := userService.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{}, sellerContext); err != nil {
+			t.Fatalf("refund purchase failed: %+v", err)
+		}
+		statement, err := service.GetRevenue(seller.ID)
+		if err != nil {
+			t.Fatalf("get revenue failed: %+v", err)
+		}
+		if statement.Balance != 0 || len(statement.Entries) != 2 || statement.Entries[0].Kind != models.JournalKindRefund {
+			t.Fatalf("expected the refund to take back the revenue, got: %+v", statement)
+		}
+	})
+
+	t.Run("reconcile", func(t *testing.T) {
+		reconciliation, err := service.Reconcile()
+		if err != nil {
+			t.Fatalf("reconcile failed: %+v", err)
+		}
+		for _, mismatch := range reconciliation.DepositMismatches {
+			if mismatch.UserID == buyer.ID {
+				t.Fatalf("expected the deposit of the buyer to match their wallet, got: %+v", mismatch)
+			}
+		}
+		if len(reconciliation.UnbalancedTransactions) != 0 || len(reconciliation.MisstatedAccounts) != 0 {
+			t.Fatalf("expected a balanced journal, got: %+v", reconciliation)
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrUnknownCategory is returned when a product or a category refers to a category that does not exist
+var ErrUnknownCategory = fmt.Errorf("unknown category")
+
+// ErrCategoryCycle is returned when a category would become a subcategory of itself
+var ErrCategoryCycle = fmt.Errorf("category cannot be moved into itself or one of its subcategories")
+
+// ErrCategoryExists is returned when the parent of a category already has a subcategory with the same name
+var ErrCategoryExists = fmt.Errorf("category with that name already exists")
+
+// ErrCategoryHasChildren is returned when deleting a category that still has subcategories
+var ErrCategoryHasChildren = fmt.Errorf("category has subcategories")
+
+// CategoryService is a struct that contains references to the store
+type CategoryService struct {
+	store repositories.Store
+}
+
+// GetCategoryServiceDefaultInstance returns the default instance of CategoryService
+func GetCategoryServiceDefaultInstance() *CategoryService {
+	return GetDefaultInstance().Categories
+}
+
+// NewCategoryService creates a CategoryService keeping the categories in the given store
+func NewCategoryService(store repositories.Store) *CategoryService {
+	return &CategoryService{
+		store: store,
+	}
+}
+
+// GetCategoryTree returns the root categories, each with its subcategories, sorted by name
+func (s *CategoryService) GetCategoryTree() (*payloads.CategoryList, error) {
+	categories, err := s.getCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	categoryList := &payloads.CategoryList{Categories: make([]*models.Category, 0)}
+	for _, category := range categories {
+		if category.ParentID == uuid.Nil {
+			categoryList.Categories = append(categoryList.Categories, category)
+		}
+	}
+	return categoryList, nil
+}
+
+// GetCategoryByID returns the requested category by id, with its subcategories
+func (s *CategoryService) GetCategoryByID(categoryID uuid.UUID) (*models.Category, error) {
+	categories, err := s.getCategories()
+	if err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		if category.ID == categoryID {
+			return category, nil
+		}
+	}
+	return &models.Category{}, db.ErrNoMatch
+}
+
+// getCategories returns all categories sorted by name, with the subcategories of each linked as its children.
+// Catalogues hold few categories, so the tree is built from a single query
+func (s *CategoryService) getCategories() ([]*models.Category, error) {
+	categories, err := s.store.Categories().List()
+	if err != nil {
+		return nil, err
+	}
+
+	categoriesByID := make(map[uuid.UUID]*models.Category, len(categories))
+	for _, category := range categories {
+		categoriesByID[category.ID] = category
+	}
+	for _, category := range categories {
+		if parent, ok := categoriesByID[category.ParentID]; ok {
+			parent.Children = append(parent.Children, category)
+		}
+	}
+	return categories, nil
+}
+
+// CreateCategory creates a category using the provided payload, under its parent when one is given
+func (s *CategoryService) CreateCategory(ctx context.Context, createCategory *payloads.CategoryPayload) (*models.Category, error) {
+	category := &models.Category{}
+	if err := createCategory.Validate(); err != nil {
+		return category, err
+	}
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		category, err = s.createCategory(tx, createCategory)
+		return err
+	})
+	if err != nil {
+		return category, err
+	}
+	return category, nil
+}
+func (s *CategoryService) createCategory(tx repositories.Session, createCategory *payloads.CategoryPayload) (*models.Category, error) {
+	category := createCategory.ToCategoryModel()
+	category.ID = uuid.NewV4()
+	if err := checkCategoryExists(tx, category.ParentID); err != nil {
+		return category, err
+	}
+
+	if err := tx.Categories().Insert(category); err != nil {
+		return category, categoryError(err)
+	}
+	return category, nil
+}
+
+// UpdateCategory renames the category by id and moves it under the parent of the payload
+func (s *CategoryService) UpdateCategory(ctx context.Context, categoryID uuid.UUID, updateCategory *payloads.CategoryPayload) (*models.Category, error) {
+	category := &models.Category{}
+	if err := updateCategory.Validate(); err != nil {
+		return category, err
+	}
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		category, err = s.updateCategory(tx, categoryID, updateCategory)
+		return err
+	})
+	if err != nil {
+		return category, err
+	}
+	return category, nil
+}
+func (s *CategoryService) updateCategory(tx repositories.Session, categoryID uuid.UUID, updateCategory *payloads.CategoryPayload) (*models.Category, error) {
+	category := updateCategory.ToCategoryModel()
+	category.ID = categoryID
+
+	// two categories moved into each other concurrently would both pass the cycle check,
+	// so the tree cannot change until the end of the transaction
+	if err := tx.Categories().LockTree(); err != nil {
+		return category, err
+	}
+	if err := checkCategoryExists(tx, category.ParentID); err != nil {
+		return category, err
+	}
+	visited := make(map[uuid.UUID]bool)
+	for ancestorID := category.ParentID; ancestorID != uuid.Nil && !visited[ancestorID]; {
+		if ancestorID == category.ID {
+			return category, ErrCategoryCycle
+		}
+		visited[ancestorID] = true
+		ancestor, err := tx.Categories().GetByID(ancestorID)
+		if err != nil {
+			return category, err
+		}
+		ancestorID = ancestor.ParentID
+	}
+
+	if err := tx.Categories().Update(category); err != nil {
+		return category, categoryError(err)
+	}
+	return category, nil
+}
+
+// DeleteCategory deletes the category by id, its products are left without a category.
+// Categories with subcategories cannot be deleted
+func (s *CategoryService) DeleteCategory(ctx context.Context, categoryID uuid.UUID) error {
+	return s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		return categoryError(tx.Categories().Delete(categoryID))
+	})
+}
+
+// checkCategoryExists returns ErrUnknownCategory if the category does not exist, no category always exists
+func checkCategoryExists(session repositories.Session, categoryID uuid.UUID) error {
+	if categoryID == uuid.Nil {
+		return nil
+	}
+	_, err := session.Categories().GetByID(categoryID)
+	if err == db.ErrNoMatch {
+		return ErrUnknownCategory
+	}
+	return err
+}
+
+// categoryError maps the constraint violations of the categories table to their errors
+func categoryError(err error) error {
+	switch err {
+	case repositories.ErrConflict:
+		return ErrCategoryExists
+	case repositories.ErrReferenced:
+		return ErrCategoryHasChildren
+	default:
+		return err
+	}
+}
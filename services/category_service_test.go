@@ -0,0 +1,106 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestCategoryService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.Categories
+	ctx := context.Background()
+
+	drinks, err := fixture.Category.CreateCategory(uuid.Nil)
+	if err != nil {
+		t.Fatalf("could not create category: %+v", err)
+	}
+	soda, err := fixture.Category.CreateCategory(drinks.ID)
+	if err != nil {
+		t.Fatalf("could not create category: %+v", err)
+	}
+
+	t.Run("create category", func(t *testing.T) {
+		t.Run("without name", func(t *testing.T) {
+			if _, err := service.CreateCategory(ctx, &payloads.CategoryPayload{Name: " "}); err == nil {
+				t.Fatal("expected create category to fail without name, create was allowed")
+			}
+		})
+		t.Run("with unknown parent", func(t *testing.T) {
+			_, err := service.CreateCategory(ctx, &payloads.CategoryPayload{Name: "Juice", ParentID: uuid.NewV4()})
+			if err != services.ErrUnknownCategory {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrUnknownCategory, err)
+			}
+		})
+		t.Run("with existing name under the same parent", func(t *testing.T) {
+			_, err := service.CreateCategory(ctx, &payloads.CategoryPayload{Name: soda.Name, ParentID: drinks.ID})
+			if err != services.ErrCategoryExists {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrCategoryExists, err)
+			}
+		})
+	})
+
+	t.Run("get category tree", func(t *testing.T) {
+		categoryList, err := service.GetCategoryTree()
+		if err != nil {
+			t.Fatalf("could not retreive categories: %+v", err)
+		}
+		for _, category := range categoryList.Categories {
+			if category.ID == soda.ID {
+				t.Fatalf("expected only root categories, got: %+v", category)
+			}
+			if category.ID == drinks.ID && (len(category.Children) != 1 || category.Children[0].ID != soda.ID) {
+				t.Fatalf("expected category with its subcategory, got: %+v", category)
+			}
+		}
+	})
+
+	t.Run("get category by id", func(t *testing.T) {
+		if _, err := service.GetCategoryByID(uuid.NewV4()); err != db.ErrNoMatch {
+			t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+		}
+	})
+
+	t.Run("update category", func(t *testing.T) {
+		t.Run("into its subcategory", func(t *testing.T) {
+			_, err := service.UpdateCategory(ctx, drinks.ID, &payloads.CategoryPayload{Name: drinks.Name, ParentID: soda.ID})
+			if err != services.ErrCategoryCycle {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrCategoryCycle, err)
+			}
+		})
+		t.Run("to a root category", func(t *testing.T) {
+			category, err := fixture.Category.CreateCategory(drinks.ID)
+			if err != nil {
+				t.Fatalf("could not create category: %+v", err)
+			}
+			updatedCategory, err := service.UpdateCategory(ctx, category.ID, &payloads.CategoryPayload{Name: category.Name + " moved"})
+			if err != nil {
+				t.Fatalf("update category failed: %+v", err)
+			}
+			if updatedCategory.ParentID != uuid.Nil || updatedCategory.Name != category.Name+" moved" {
+				t.Fatalf("expected renamed root category, got: %+v", updatedCategory)
+			}
+		})
+	})
+
+	t.Run("delete category", func(t *testing.T) {
+		t.Run("with subcategories", func(t *testing.T) {
+			if err := service.DeleteCategory(ctx, drinks.ID); err != services.ErrCategoryHasChildren {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrCategoryHasChildren, err)
+			}
+		})
+		t.Run("without subcategories", func(t *testing.T) {
+			if err := service.DeleteCategory(ctx, soda.ID); err != nil {
+				t.Fatalf("delete category failed: %+v", err)
+			}
+			if err := service.DeleteCategory(ctx, soda.ID); err != db.ErrNoMatch {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+			}
+		})
+	})
+}
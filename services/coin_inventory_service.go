@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/change"
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrExactChangeOnly is returned when the change cannot be paid out from the coins held by the machine
+var ErrExactChangeOnly = fmt.Errorf("exact change only")
+
+// CoinInventoryService is a struct that contains references to the store and the permission policy
+type CoinInventoryService struct {
+	store                         repositories.Store
+	policy                        *auth.Policy
+	acceptableDepositAmountValues []int32
+}
+
+// GetCoinInventoryServiceDefaultInstance returns the default instance of CoinInventoryService
+func GetCoinInventoryServiceDefaultInstance() *CoinInventoryService {
+	return GetDefaultInstance().CoinInventory
+}
+
+// NewCoinInventoryService creates a CoinInventoryService keeping the coin tubes of the machines in the given store,
+// accepting the coins of the config
+func NewCoinInventoryService(store repositories.Store, policy *auth.Policy, cfg *config.Config) *CoinInventoryService {
+	return &CoinInventoryService{
+		store:                         store,
+		policy:                        policy,
+		acceptableDepositAmountValues: cfg.AcceptableDepositAmountValues,
+	}
+}
+
+// GetCoinInventory returns the number of coins of each denomination held by the machine
+func (s *CoinInventoryService) GetCoinInventory(machineID uuid.UUID) (*payloads.CoinInventoryList, error) {
+	if _, err := selectMachine(s.store, machineID); err != nil {
+		return nil, err
+	}
+	coins, err := s.store.Coins().List(machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapCoinsToCoinInventoryList(coins), nil
+}
+
+// RefillCoins adds the provided coins to the coin tubes of the machine.
+// The user needs `machine:write:own` to refill the machines they operate or `machine:write:any` to refill any machine
+func (s *CoinInventoryService) RefillCoins(ctx context.Context, machineID uuid.UUID, refillCoins *payloads.RefillCoinsPayload, userContext auth.UserContext) (*payloads.CoinInventoryList, error) {
+	if err := refillCoins.Validate(s.acceptableDepositAmountValues); err != nil {
+		return nil, err
+	}
+	machine, err := selectMachine(s.store, machineID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Authorize(userContext, auth.PermMachineWrite, machine.OwnerFor(userContext.ID)); err != nil {
+		return nil, err
+	}
+
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		for denomination, count := range refillCoins.Coins {
+			if err := tx.Coins().Add(machineID, denomination, count); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCoinInventory(machineID)
+}
+
+// dispenseChange removes the coins needed to pay out the given amount from the coin tubes of the machine.
+// ErrExactChangeOnly is returned if the amount cannot be paid out from the available coins
+func (s *CoinInventoryService) dispenseChange(tx repositories.Session, machineID uuid.UUID, amount int32) (change.Coins, error) {
+	if amount <= 0 {
+		return change.Coins{}, nil
+	}
+
+	coins, err := tx.Coins().ListForUpdate(machineID)
+	if err != nil {
+		return change.Coins{}, err
+	}
+
+	inventory := make(change.Coins, len(coins))
+	for _, coin := range coins {
+		inventory[coin.Denomination] = coin.Count
+	}
+	dispensedCoins, err := change.NewInventoryChangeMaker(inventory).MakeChange(amount)
+	if err == change.ErrCannotMakeChange {
+		return change.Coins{}, ErrExactChangeOnly
+	}
+	if err != nil {
+		return change.Coins{}, err
+	}
+
+	for denomination, count := range dispensedCoins {
+		if err := tx.Coins().Add(machineID, denomination, -count); err != nil {
+			return change.Coins{}, err
+		}
+	}
+
+	return dispensedCoins, nil
+}
+
+func mapCoinsToCoinInventoryList(coins []*models.CoinInventory) *payloads.CoinInventoryList {
+	coinList := &payloads.CoinInventoryList{}
+	coinList.Coins = coins
+	for _, coin := range coins {
+		coinList.Total += coin.Denomination * coin.Count
+	}
+	return coinList
+}
@@ -0,0 +1,104 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestCoinInventoryService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.CoinInventory
+	userService := a.Services.Users
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	operatorContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+	ctx := context.Background()
+
+	t.Run("get coin inventory", func(t *testing.T) {
+		coinList, err := service.GetCoinInventory(machine.ID)
+		if err != nil {
+			t.Fatalf("could not retreive coin inventory: %+v", err)
+		}
+		if len(coinList.Coins) == 0 || coinList.Total <= 0 {
+			t.Fatalf("expected coin inventory to be stocked, got: %+v", coinList)
+		}
+	})
+
+	t.Run("refill coins", func(t *testing.T) {
+		t.Run("with acceptable denominations", func(t *testing.T) {
+			oldCoinList, err := service.GetCoinInventory(machine.ID)
+			if err != nil {
+				t.Fatalf("could not retreive coin inventory: %+v", err)
+			}
+			refillCoins := &payloads.RefillCoinsPayload{Coins: map[int32]int32{50: 4}}
+			coinList, err := service.RefillCoins(ctx, machine.ID, refillCoins, operatorContext)
+			if err != nil {
+				t.Fatalf("refill coins failed: %+v", err)
+			}
+			if coinList.Total != oldCoinList.Total+200 {
+				t.Fatalf("expected coin inventory total to increase by 200, was %d, got %d", oldCoinList.Total, coinList.Total)
+			}
+		})
+		t.Run("with unacceptable denomination", func(t *testing.T) {
+			refillCoins := &payloads.RefillCoinsPayload{Coins: map[int32]int32{3: 4}}
+			if _, err := service.RefillCoins(ctx, machine.ID, refillCoins, operatorContext); err == nil {
+				t.Fatal("expected refill to fail with unacceptable denomination, refill was allowed")
+			}
+		})
+		t.Run("by a seller not operating the machine", func(t *testing.T) {
+			secondSeller, err := fixture.User.CreateSellerUser()
+			if err != nil {
+				t.Fatalf("could not create seller: %+v", err)
+			}
+			sellerContext := auth.UserContext{ID: secondSeller.ID, Role: models.UserRoleSeller}
+			refillCoins := &payloads.RefillCoinsPayload{Coins: map[int32]int32{50: 4}}
+			if _, err := service.RefillCoins(ctx, machine.ID, refillCoins, sellerContext); err != db.ErrUserForbidden {
+				t.Fatalf("expected refill to fail with %v, got: %+v", db.ErrUserForbidden, err)
+			}
+		})
+	})
+
+	t.Run("buy product", func(t *testing.T) {
+		t.Run("when change cannot be paid out", func(t *testing.T) {
+			userToCreate := &payloads.CreateUserPayload{
+				Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+				Password: "password",
+				Role:     models.UserRoleBuyer,
+				// no coin smaller than 5 cents exists, so 3 cents of change can never be paid out
+				Deposit: product.Cost + 3,
+			}
+			buyer, err := userService.CreateUser(ctx, userToCreate)
+			if err != nil {
+				t.Fatalf("error while creating user %+v", err)
+			}
+			productPurchase := &payloads.UserProductPurchase{
+				MachineID: machine.ID,
+				ProductID: product.ID,
+				Amount:    1,
+			}
+			_, err = userService.BuyProduct(ctx, productPurchase, buyer.ID)
+			if err != services.ErrExactChangeOnly {
+				t.Fatalf("expected purchase to fail with %v, got: %+v", services.ErrExactChangeOnly, err)
+			}
+		})
+	})
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request
+var ErrIdempotencyKeyReused = fmt.Errorf("idempotency key was already used for a different request")
+
+// ErrIdempotencyKeyInProgress is returned when a request with the same idempotency key has not completed yet
+var ErrIdempotencyKeyInProgress = fmt.Errorf("a request with this idempotency key is still in progress")
+
+// IdempotencyService is a struct that contains references to the store and the time responses are kept for
+type IdempotencyService struct {
+	store repositories.Store
+	ttl   time.Duration
+}
+
+// GetIdempotencyServiceDefaultInstance returns the default instance of IdempotencyService
+func GetIdempotencyServiceDefaultInstance() *IdempotencyService {
+	return GetDefaultInstance().Idempotency
+}
+
+// NewIdempotencyService creates an IdempotencyService keeping the responses in the given store for the idempotency
+// key TTL of the config
+func NewIdempotencyService(store repositories.Store, cfg *config.Config) *IdempotencyService {
+	return &IdempotencyService{
+		store: store,
+		ttl:   cfg.IdempotencyKeyTTL,
+	}
+}
+
+// BeginRequest claims the idempotency key of the user for the request with the given hash.
+// If the key was already used for the same request, its stored response is returned to be replayed
+// and the request must not be executed again. A nil response means the caller owns the key and must
+// either complete or release it
+func (s *IdempotencyService) BeginRequest(ctx context.Context, userID uuid.UUID, key string, requestHash string) (*models.IdempotencyKey, error) {
+	var storedResponse *models.IdempotencyKey
+	err := s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		var err error
+		storedResponse, err = s.beginRequest(tx, userID, key, requestHash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return storedResponse, nil
+}
+
+func (s *IdempotencyService) beginRequest(tx repositories.Session, userID uuid.UUID, key string, requestHash string) (*models.IdempotencyKey, error) {
+	if err := tx.IdempotencyKeys().DeleteCreatedBefore(userID, time.Now().Add(-s.ttl)); err != nil {
+		return nil, err
+	}
+
+	idempotencyKey := &models.IdempotencyKey{
+		UserID:         userID,
+		IdempotencyKey: key,
+		RequestHash:    requestHash,
+	}
+	inserted, err := tx.IdempotencyKeys().Insert(idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	if inserted {
+		return nil, nil
+	}
+
+	storedResponse, err := tx.IdempotencyKeys().Get(userID, key)
+	if err != nil {
+		return nil, err
+	}
+	if storedResponse.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !storedResponse.IsCompleted() {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	return storedResponse, nil
+}
+
+// CompleteRequest stores the response of the request that claimed the idempotency key, to be replayed for retries
+func (s *IdempotencyService) CompleteRequest(ctx context.Context, userID uuid.UUID, key string, status int, contentType string, body []byte) error {
+	return s.store.IdempotencyKeys().Complete(&models.IdempotencyKey{
+		UserID:         userID,
+		IdempotencyKey: key,
+		Status:         status,
+		ContentType:    contentType,
+		Body:           body,
+	})
+}
+
+// ReleaseRequest frees the idempotency key without storing a response, so the request can be retried
+func (s *IdempotencyService) ReleaseRequest(ctx context.Context, userID uuid.UUID, key string) error {
+	return s.store.IdempotencyKeys().Delete(userID, key)
+}
@@ -0,0 +1,86 @@
+package services_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestIdempotencyService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.Idempotency
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	ctx := context.Background()
+
+	t.Run("first request claims the key", func(t *testing.T) {
+		key := uuid.NewV4().String()
+		storedResponse, err := service.BeginRequest(ctx, buyer.ID, key, "hash")
+		if err != nil {
+			t.Fatalf("begin request failed: %+v", err)
+		}
+		if storedResponse != nil {
+			t.Fatalf("expected no stored response for a new key, got: %+v", storedResponse)
+		}
+
+		t.Run("retry while in progress", func(t *testing.T) {
+			if _, err := service.BeginRequest(ctx, buyer.ID, key, "hash"); err != services.ErrIdempotencyKeyInProgress {
+				t.Fatalf("expected %v, got %+v", services.ErrIdempotencyKeyInProgress, err)
+			}
+		})
+
+		t.Run("retry after completion replays the response", func(t *testing.T) {
+			if err := service.CompleteRequest(ctx, buyer.ID, key, http.StatusOK, "application/json", []byte(`{"deposit":5}`)); err != nil {
+				t.Fatalf("complete request failed: %+v", err)
+			}
+			storedResponse, err := service.BeginRequest(ctx, buyer.ID, key, "hash")
+			if err != nil {
+				t.Fatalf("begin request failed: %+v", err)
+			}
+			if storedResponse == nil || storedResponse.Status != http.StatusOK || string(storedResponse.Body) != `{"deposit":5}` {
+				t.Fatalf("expected the stored response to be replayed, got: %+v", storedResponse)
+			}
+		})
+
+		t.Run("reuse with a different request", func(t *testing.T) {
+			if _, err := service.BeginRequest(ctx, buyer.ID, key, "another hash"); err != services.ErrIdempotencyKeyReused {
+				t.Fatalf("expected %v, got %+v", services.ErrIdempotencyKeyReused, err)
+			}
+		})
+	})
+
+	t.Run("keys are scoped per user", func(t *testing.T) {
+		secondBuyer, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		key := uuid.NewV4().String()
+		if _, err := service.BeginRequest(ctx, buyer.ID, key, "hash"); err != nil {
+			t.Fatalf("begin request failed: %+v", err)
+		}
+		storedResponse, err := service.BeginRequest(ctx, secondBuyer.ID, key, "another hash")
+		if err != nil || storedResponse != nil {
+			t.Fatalf("expected the key to be free for another user, got: %+v, %+v", storedResponse, err)
+		}
+	})
+
+	t.Run("released key can be claimed again", func(t *testing.T) {
+		key := uuid.NewV4().String()
+		if _, err := service.BeginRequest(ctx, buyer.ID, key, "hash"); err != nil {
+			t.Fatalf("begin request failed: %+v", err)
+		}
+		if err := service.ReleaseRequest(ctx, buyer.ID, key); err != nil {
+			t.Fatalf("release request failed: %+v", err)
+		}
+		storedResponse, err := service.BeginRequest(ctx, buyer.ID, key, "hash")
+		if err != nil || storedResponse != nil {
+			t.Fatalf("expected the released key to be claimed again, got: %+v, %+v", storedResponse, err)
+		}
+	})
+}
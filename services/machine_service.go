@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// MachineService is a struct that contains references to the store and the permission policy
+type MachineService struct {
+	store  repositories.Store
+	policy *auth.Policy
+	// acceptableDepositAmountValues are the coins a machine has coin tubes for
+	acceptableDepositAmountValues []int32
+}
+
+// GetMachineServiceDefaultInstance returns the default instance of MachineService
+func GetMachineServiceDefaultInstance() *MachineService {
+	return GetDefaultInstance().Machines
+}
+
+// NewMachineService creates a MachineService keeping the machines in the given store, their coin tubes are created
+// for the coins of the config
+func NewMachineService(store repositories.Store, policy *auth.Policy, cfg *config.Config) *MachineService {
+	return &MachineService{
+		store:                         store,
+		policy:                        policy,
+		acceptableDepositAmountValues: cfg.AcceptableDepositAmountValues,
+	}
+}
+
+// GetAllMachines returns all machines, without their slots
+func (s *MachineService) GetAllMachines() (*payloads.MachineList, error) {
+	machines, err := s.store.Machines().List()
+	if err != nil {
+		return nil, err
+	}
+
+	machineList := &payloads.MachineList{}
+	machineList.Machines = machines
+
+	return machineList, nil
+}
+
+// GetMachineByID returns the requested machine by id, with its slots and the products they hold
+func (s *MachineService) GetMachineByID(machineID uuid.UUID) (*models.Machine, error) {
+	return s.store.Machines().GetWithSlots(machineID)
+}
+
+// CreateMachine creates a machine operated by the given user, with empty coin tubes for every accepted coin
+func (s *MachineService) CreateMachine(ctx context.Context, createMachine *payloads.CreateMachinePayload, operatorID uuid.UUID) (*models.Machine, error) {
+	machine := &models.Machine{}
+	if err := createMachine.Validate(); err != nil {
+		return machine, err
+	}
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		machine, err = s.createMachine(tx, createMachine, operatorID)
+		return err
+	})
+	if err != nil {
+		return machine, err
+	}
+	return machine, nil
+}
+func (s *MachineService) createMachine(tx repositories.Session, createMachine *payloads.CreateMachinePayload, operatorID uuid.UUID) (*models.Machine, error) {
+	machine := createMachine.ToMachineModel()
+	machine.ID = uuid.NewV4()
+	machine.OperatorID = operatorID
+	if err := tx.Machines().Insert(machine); err != nil {
+		return machine, err
+	}
+
+	for _, denomination := range s.acceptableDepositAmountValues {
+		if err := tx.Coins().Add(machine.ID, denomination, 0); err != nil {
+			return machine, err
+		}
+	}
+	return machine, nil
+}
+
+// AssignSlot puts the product into the slot of the machine with the given code, creating the slot if it does not
+// exist yet. The user needs `machine:write:own` to assign slots of the machines they operate or `machine:write:any`
+// to assign slots of any machine
+func (s *MachineService) AssignSlot(ctx context.Context, machineID uuid.UUID, assignSlot *payloads.AssignSlotPayload, userContext auth.UserContext) (*models.Slot, error) {
+	slot := &models.Slot{}
+	if err := assignSlot.Validate(); err != nil {
+		return slot, err
+	}
+	machine, err := selectMachine(s.store, machineID)
+	if err != nil {
+		return slot, err
+	}
+	if err := s.policy.Authorize(userContext, auth.PermMachineWrite, machine.OwnerFor(userContext.ID)); err != nil {
+		return slot, err
+	}
+
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		slot, err = s.assignSlot(tx, machine, assignSlot)
+		return err
+	})
+	if err != nil {
+		return slot, err
+	}
+	return slot, nil
+}
+func (s *MachineService) assignSlot(tx repositories.Session, machine *models.Machine, assignSlot *payloads.AssignSlotPayload) (*models.Slot, error) {
+	slot := assignSlot.ToSlotModel(machine.ID)
+	slot.ID = uuid.NewV4()
+	if slot.ProductID != uuid.Nil {
+		if _, err := tx.Products().GetByID(slot.ProductID); err != nil {
+			return slot, err
+		}
+	}
+
+	if err := tx.Slots().Upsert(slot); err != nil {
+		return slot, err
+	}
+	return slot, nil
+}
+
+// dispenseProduct removes the given amount of the product from the slots of the machine holding it.
+// The slots are locked until the end of the transaction, ErrInsufficientProductAmount is returned if the machine
+// does not hold enough of the product
+func (s *MachineService) dispenseProduct(tx repositories.Session, machineID uuid.UUID, productID uuid.UUID, amount int32) error {
+	slots, err := tx.Slots().ListProductForUpdate(machineID, productID)
+	if err != nil {
+		return err
+	}
+
+	var available int64
+	for _, slot := range slots {
+		available += int64(slot.Quantity)
+	}
+	if available < int64(amount) {
+		return ErrInsufficientProductAmount
+	}
+
+	_, err = s.takeFromSlots(tx, slots, amount)
+	return err
+}
+
+// takeProduct removes up to the given amount of the product from the slots of the machine holding it, and returns
+// the number of units that the slots held
+func (s *MachineService) takeProduct(tx repositories.Session, machineID uuid.UUID, productID uuid.UUID, amount int32) (int32, error) {
+	slots, err := tx.Slots().ListProductForUpdate(machineID, productID)
+	if err != nil {
+		return 0, err
+	}
+	return s.takeFromSlots(tx, slots, amount)
+}
+
+// takeFromSlots removes up to the given amount from the locked slots in their order, and returns the number of
+// units taken
+func (s *MachineService) takeFromSlots(tx repositories.Session, slots []*models.Slot, amount int32) (int32, error) {
+	var taken int32
+	for _, slot := range slots {
+		if taken == amount {
+			break
+		}
+		if slot.Quantity == 0 {
+			continue
+		}
+		dispensed := slot.Quantity
+		if dispensed > amount-taken {
+			dispensed = amount - taken
+		}
+		slot.Quantity -= dispensed
+		if err := tx.Slots().SetQuantity(slot); err != nil {
+			return taken, err
+		}
+		taken += dispensed
+	}
+	return taken, nil
+}
+
+// adjustSlot adds the amount to the quantity of the slot with the given code, negative amounts remove units. The
+// quantity is kept between zero and the capacity of the slot, the slot and the amount that was added are returned
+func (s *MachineService) adjustSlot(tx repositories.Session, machineID uuid.UUID, code string, amount int32) (*models.Slot, int32, error) {
+	slot, err := tx.Slots().GetByCodeForUpdate(machineID, code)
+	if err != nil {
+		return slot, 0, err
+	}
+
+	quantity := int64(slot.Quantity) + int64(amount)
+	if quantity < 0 {
+		quantity = 0
+	}
+	if quantity > int64(slot.Capacity) {
+		quantity = int64(slot.Capacity)
+	}
+	added := int32(quantity) - slot.Quantity
+	if added == 0 {
+		return slot, 0, nil
+	}
+	slot.Quantity = int32(quantity)
+	if err := tx.Slots().SetQuantity(slot); err != nil {
+		return slot, 0, err
+	}
+	return slot, added, nil
+}
+
+// selectMachine returns the machine by id, without its slots
+func selectMachine(session repositories.Session, machineID uuid.UUID) (*models.Machine, error) {
+	return session.Machines().GetByID(machineID)
+}
+
+// restockProduct puts the amount of the product back into the slots of the machine holding it, as far as their
+// capacity allows, and returns the number of units that fit
+func (s *MachineService) restockProduct(tx repositories.Session, machineID uuid.UUID, productID uuid.UUID, amount int32) (int32, error) {
+	slots, err := tx.Slots().ListProductForUpdate(machineID, productID)
+	if err != nil {
+		return 0, err
+	}
+
+	var restocked int32
+	for _, slot := range slots {
+		if restocked == amount {
+			break
+		}
+		added := slot.Capacity - slot.Quantity
+		if added > amount-restocked {
+			added = amount - restocked
+		}
+		if added <= 0 {
+			continue
+		}
+		slot.Quantity += added
+		if err := tx.Slots().SetQuantity(slot); err != nil {
+			return restocked, err
+		}
+		restocked += added
+	}
+	return restocked, nil
+}
@@ -0,0 +1,134 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestMachineService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.Machines
+	userService := a.Services.Users
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	secondSeller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	operatorContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+	ctx := context.Background()
+
+	t.Run("create machine", func(t *testing.T) {
+		t.Run("with all fields", func(t *testing.T) {
+			machineToCreate := &payloads.CreateMachinePayload{Name: "Lobby", Location: "Ground floor"}
+			machine, err := service.CreateMachine(ctx, machineToCreate, seller.ID)
+			if err != nil {
+				t.Fatalf("error while creating machine %+v", err)
+			}
+			if machine.OperatorID != seller.ID || machine.Name != machineToCreate.Name {
+				t.Fatalf("create machine failed: %+v", machine)
+			}
+		})
+		t.Run("without name", func(t *testing.T) {
+			if _, err := service.CreateMachine(ctx, &payloads.CreateMachinePayload{}, seller.ID); err == nil {
+				t.Fatal("expected create machine to fail without name, create was allowed")
+			}
+		})
+	})
+
+	t.Run("assign slot", func(t *testing.T) {
+		machine, err := fixture.Machine.CreateMachine(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create machine: %+v", err)
+		}
+		t.Run("as operator", func(t *testing.T) {
+			slotToAssign := &payloads.AssignSlotPayload{Code: "A3", ProductID: product.ID, Capacity: 10, Quantity: 4}
+			if _, err := service.AssignSlot(ctx, machine.ID, slotToAssign, operatorContext); err != nil {
+				t.Fatalf("assign slot failed: %+v", err)
+			}
+			slotToAssign.Quantity = 7
+			if _, err := service.AssignSlot(ctx, machine.ID, slotToAssign, operatorContext); err != nil {
+				t.Fatalf("reassign slot failed: %+v", err)
+			}
+			updatedMachine, err := service.GetMachineByID(machine.ID)
+			if err != nil {
+				t.Fatalf("could not retreive machine: %+v", err)
+			}
+			if len(updatedMachine.Slots) != 1 || updatedMachine.Slots[0].Quantity != 7 || updatedMachine.Slots[0].Product == nil {
+				t.Fatalf("expected a single slot holding 7 units of the product, got: %+v", updatedMachine.Slots)
+			}
+		})
+		t.Run("with quantity above capacity", func(t *testing.T) {
+			slotToAssign := &payloads.AssignSlotPayload{Code: "A4", ProductID: product.ID, Capacity: 10, Quantity: 11}
+			if _, err := service.AssignSlot(ctx, machine.ID, slotToAssign, operatorContext); err == nil {
+				t.Fatal("expected assign slot to fail with quantity above capacity, assign was allowed")
+			}
+		})
+		t.Run("with product that does not exist", func(t *testing.T) {
+			slotToAssign := &payloads.AssignSlotPayload{Code: "A5", ProductID: uuid.NewV4(), Capacity: 10, Quantity: 1}
+			if _, err := service.AssignSlot(ctx, machine.ID, slotToAssign, operatorContext); err != db.ErrNoMatch {
+				t.Fatalf("expected assign slot to fail with %v, got: %+v", db.ErrNoMatch, err)
+			}
+		})
+		t.Run("as seller not operating the machine", func(t *testing.T) {
+			sellerContext := auth.UserContext{ID: secondSeller.ID, Role: models.UserRoleSeller}
+			slotToAssign := &payloads.AssignSlotPayload{Code: "B1", ProductID: product.ID, Capacity: 10, Quantity: 1}
+			if _, err := service.AssignSlot(ctx, machine.ID, slotToAssign, sellerContext); err != db.ErrUserForbidden {
+				t.Fatalf("expected assign slot to fail with %v, got: %+v", db.ErrUserForbidden, err)
+			}
+		})
+	})
+
+	t.Run("buy product held by several slots", func(t *testing.T) {
+		machine, err := fixture.Machine.CreateStockedMachine(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create stocked machine: %+v", err)
+		}
+		if _, err := fixture.Machine.StockProduct(machine, "A1", product.ID, 2); err != nil {
+			t.Fatalf("could not stock product: %+v", err)
+		}
+		if _, err := fixture.Machine.StockProduct(machine, "A2", product.ID, 2); err != nil {
+			t.Fatalf("could not stock product: %+v", err)
+		}
+		buyer, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		deposit := &payloads.DepositMoneyPayload{MachineID: machine.ID, DepositAmount: 100}
+		for buyer.Deposit < product.Cost*3 {
+			var err error
+			if buyer, err = userService.DepositMoney(ctx, deposit, buyer.ID); err != nil {
+				t.Fatalf("deposit money failed: %+v", err)
+			}
+		}
+
+		productPurchase := &payloads.UserProductPurchase{MachineID: machine.ID, ProductID: product.ID, Amount: 3}
+		if _, err := userService.BuyProduct(ctx, productPurchase, buyer.ID); err != nil {
+			t.Fatalf("product purchase failed: %+v", err)
+		}
+		updatedMachine, err := service.GetMachineByID(machine.ID)
+		if err != nil {
+			t.Fatalf("could not retreive machine: %+v", err)
+		}
+		var remaining int32
+		for _, slot := range updatedMachine.Slots {
+			remaining += slot.Quantity
+		}
+		if remaining != 1 {
+			t.Fatalf("expected 1 unit to be left in the slots, got: %d", remaining)
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrPayoutPending is returned when a seller requests a payout while another one is waiting for approval
+var ErrPayoutPending = fmt.Errorf("seller already has a payout waiting for approval")
+
+// ErrNothingToPayOut is returned when a seller requests a payout without any revenue that was not paid out yet
+var ErrNothingToPayOut = fmt.Errorf("seller has no revenue to pay out")
+
+// ErrPayoutDecided is returned when approving or rejecting a payout that was already approved or rejected
+var ErrPayoutDecided = fmt.Errorf("payout was already approved or rejected")
+
+// PayoutProvider sends approved payouts to the sellers, it returns the reference of the transfer at the provider
+type PayoutProvider interface {
+	SendPayout(ctx context.Context, payout *models.Payout) (string, error)
+}
+
+// LocalPayoutProvider is a PayoutProvider that does not move any money, payouts are settled outside of the
+// application until a payment provider is integrated
+type LocalPayoutProvider struct{}
+
+// SendPayout returns a reference derived from the payout id
+func (LocalPayoutProvider) SendPayout(ctx context.Context, payout *models.Payout) (string, error) {
+	return "local-" + payout.ID.String(), nil
+}
+
+// PayoutService is a struct that contains references to the store, the journal and the provider sending payouts
+type PayoutService struct {
+	store          repositories.Store
+	accountService *AccountService
+	provider       PayoutProvider
+	policy         *auth.Policy
+}
+
+// GetPayoutServiceDefaultInstance returns the default instance of PayoutService
+func GetPayoutServiceDefaultInstance() *PayoutService {
+	return GetDefaultInstance().Payouts
+}
+
+// NewPayoutService creates a PayoutService keeping the payouts in the given store and sending them with the provider
+func NewPayoutService(store repositories.Store, accountService *AccountService, provider PayoutProvider, policy *auth.Policy) *PayoutService {
+	return &PayoutService{
+		store:          store,
+		accountService: accountService,
+		provider:       provider,
+		policy:         policy,
+	}
+}
+
+// GetPayouts returns all payouts with `payout:read:any`, and otherwise the payouts of the user, newest first
+func (s *PayoutService) GetPayouts(userContext auth.UserContext) (*payloads.PayoutList, error) {
+	sellerID := uuid.Nil
+	if !s.policy.Allows(userContext.Role, auth.PermPayoutRead.Any()) {
+		if !s.policy.Allows(userContext.Role, auth.PermPayoutRead.Own()) {
+			return nil, db.ErrUserForbidden
+		}
+		sellerID = userContext.ID
+	}
+	payouts, err := s.store.Payouts().List(sellerID)
+	if err != nil {
+		return nil, err
+	}
+	return &payloads.PayoutList{Payouts: payouts}, nil
+}
+
+// GetPayoutByID returns the requested payout by id, if the user may read it
+func (s *PayoutService) GetPayoutByID(payoutID uuid.UUID, userContext auth.UserContext) (*models.Payout, error) {
+	payout, err := s.store.Payouts().GetByID(payoutID)
+	if err != nil {
+		return payout, err
+	}
+	if err := s.policy.Authorize(userContext, auth.PermPayoutRead, payout.SellerID); err != nil {
+		return payout, err
+	}
+	return payout, nil
+}
+
+// GetPayoutStatement returns the requested payout by id with the sales it includes
+func (s *PayoutService) GetPayoutStatement(payoutID uuid.UUID, userContext auth.UserContext) (*payloads.PayoutStatement, error) {
+	payout, err := s.GetPayoutByID(payoutID, userContext)
+	if err != nil {
+		return &payloads.PayoutStatement{}, err
+	}
+	statement := &payloads.PayoutStatement{Payout: payout}
+	statement.Sales, err = s.store.Payouts().ListSales(payout.ID)
+	if err != nil {
+		return &payloads.PayoutStatement{}, err
+	}
+	return statement, nil
+}
+
+// RequestPayout requests paying out the revenue of the seller that is not included in another payout yet. Sales are
+// included once they are completed or failed, purchases still being vended wait for the next payout
+func (s *PayoutService) RequestPayout(ctx context.Context, sellerID uuid.UUID) (*models.Payout, error) {
+	payout := &models.Payout{}
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		payout, err = s.requestPayout(tx, sellerID)
+		return err
+	})
+	if err != nil {
+		return &models.Payout{}, err
+	}
+	return payout, nil
+}
+func (s *PayoutService) requestPayout(tx repositories.Session, sellerID uuid.UUID) (*models.Payout, error) {
+	// the seller is locked, so concurrent requests cannot include the same sales twice
+	if _, err := tx.Users().GetForUpdate(sellerID); err != nil {
+		return &models.Payout{}, err
+	}
+	pending, err := tx.Payouts().HasRequested(sellerID)
+	if err != nil {
+		return &models.Payout{}, err
+	}
+	if pending {
+		return &models.Payout{}, ErrPayoutPending
+	}
+
+	sales, err := tx.Payouts().ListUnpaidSales(sellerID)
+	if err != nil {
+		return &models.Payout{}, err
+	}
+	var amount int64
+	for _, sale := range sales {
+		amount += int64(sale.Total - sale.PlatformFee)
+	}
+	if amount <= 0 {
+		return &models.Payout{}, ErrNothingToPayOut
+	}
+
+	payout := &models.Payout{
+		ID:       uuid.NewV4(),
+		SellerID: sellerID,
+		Amount:   amount,
+		Sales:    int32(len(sales)),
+		Status:   models.PayoutStatusRequested,
+	}
+	purchaseIDs := make([]uuid.UUID, len(sales))
+	for i, sale := range sales {
+		purchaseIDs[i] = sale.ID
+	}
+	if err := tx.Payouts().Insert(payout, purchaseIDs); err != nil {
+		return &models.Payout{}, err
+	}
+	return payout, nil
+}
+
+// ApprovePayout approves the requested payout by id, its amount is taken from the revenue of the seller and sent to
+// them through the payout provider
+func (s *PayoutService) ApprovePayout(ctx context.Context, payoutID uuid.UUID, decision *payloads.DecidePayoutPayload, userContext auth.UserContext) (*models.Payout, error) {
+	return s.decidePayout(ctx, payoutID, models.PayoutStatusApproved, decision, userContext)
+}
+
+// RejectPayout rejects the requested payout by id, its sales are included in the next payout the seller requests
+func (s *PayoutService) RejectPayout(ctx context.Context, payoutID uuid.UUID, decision *payloads.DecidePayoutPayload, userContext auth.UserContext) (*models.Payout, error) {
+	return s.decidePayout(ctx, payoutID, models.PayoutStatusRejected, decision, userContext)
+}
+func (s *PayoutService) decidePayout(ctx context.Context, payoutID uuid.UUID, status models.PayoutStatus, decision *payloads.DecidePayoutPayload, userContext auth.UserContext) (*models.Payout, error) {
+	if err := decision.Validate(); err != nil {
+		return &models.Payout{}, err
+	}
+	payout := &models.Payout{}
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		payout, err = s.decidePayoutTx(ctx, tx, payoutID, status, decision.Note, userContext.ID)
+		return err
+	})
+	if err != nil {
+		return &models.Payout{}, err
+	}
+	return payout, nil
+}
+
+// decidePayoutTx records the decision on the payout. An approved payout is posted to the journal before it is sent,
+// so the transaction is rolled back if the provider fails to send it
+func (s *PayoutService) decidePayoutTx(ctx context.Context, tx repositories.Session, payoutID uuid.UUID, status models.PayoutStatus, note string, decidedBy uuid.UUID) (*models.Payout, error) {
+	payout, err := tx.Payouts().GetForUpdate(payoutID)
+	if err != nil {
+		return payout, err
+	}
+	if payout.Status != models.PayoutStatusRequested {
+		return payout, ErrPayoutDecided
+	}
+
+	if status == models.PayoutStatusApproved {
+		_, err := s.accountService.post(tx, models.JournalKindPayout, payout.ID, "", transfer(payout.Amount, sellerRevenue(payout.SellerID), externalAccount)...)
+		if err != nil {
+			return payout, err
+		}
+		if payout.ProviderReference, err = s.provider.SendPayout(ctx, payout); err != nil {
+			return payout, err
+		}
+	}
+
+	decidedAt := time.Now()
+	payout.Status = status
+	payout.Note = note
+	payout.DecidedBy = decidedBy
+	payout.DecidedAt = &decidedAt
+	if err := tx.Payouts().UpdateDecision(payout); err != nil {
+		return payout, err
+	}
+	return payout, nil
+}
@@ -0,0 +1,138 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+)
+
+func TestPayoutService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.Payouts
+	userService := a.Services.Users
+	ctx := context.Background()
+
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	sellerContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+	admin, err := fixture.User.CreateAdminUser()
+	if err != nil {
+		t.Fatalf("could not create admin: %+v", err)
+	}
+	adminContext := auth.UserContext{ID: admin.ID, Role: models.UserRoleAdmin}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+
+	t.Run("nothing to pay out", func(t *testing.T) {
+		if _, err := service.RequestPayout(ctx, seller.ID); err != services.ErrNothingToPayOut {
+			t.Fatalf("expected error %+v, got: %+v", services.ErrNothingToPayOut, err)
+		}
+	})
+
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	report, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, buyer.ID)
+	if err != nil {
+		t.Fatalf("could not create purchase: %+v", err)
+	}
+	purchase := report.Purchases[0]
+	t.Run("reserved purchases wait for the vend", func(t *testing.T) {
+		if _, err := service.RequestPayout(ctx, seller.ID); err != services.ErrNothingToPayOut {
+			t.Fatalf("expected error %+v, got: %+v", services.ErrNothingToPayOut, err)
+		}
+	})
+	if _, err := userService.ConfirmPurchase(ctx, purchase.ID, sellerContext); err != nil {
+		t.Fatalf("confirm purchase failed: %+v", err)
+	}
+	revenue := int64(purchase.Total - purchase.PlatformFee)
+
+	t.Run("request and reject", func(t *testing.T) {
+		payout, err := service.RequestPayout(ctx, seller.ID)
+		if err != nil {
+			t.Fatalf("request payout failed: %+v", err)
+		}
+		if payout.Amount != revenue || payout.Sales != 1 || payout.Status != models.PayoutStatusRequested {
+			t.Fatalf("expected a payout of %d for one sale, got: %+v", revenue, payout)
+		}
+		if _, err := service.RequestPayout(ctx, seller.ID); err != services.ErrPayoutPending {
+			t.Fatalf("expected error %+v, got: %+v", services.ErrPayoutPending, err)
+		}
+
+		rejected, err := service.RejectPayout(ctx, payout.ID, &payloads.DecidePayoutPayload{Note: "bank details missing"}, adminContext)
+		if err != nil {
+			t.Fatalf("reject payout failed: %+v", err)
+		}
+		if rejected.Status != models.PayoutStatusRejected || rejected.DecidedBy != adminContext.ID || rejected.DecidedAt == nil {
+			t.Fatalf("expected the payout to be rejected by the admin, got: %+v", rejected)
+		}
+	})
+
+	var payout *models.Payout
+	t.Run("request and approve", func(t *testing.T) {
+		var err error
+		payout, err = service.RequestPayout(ctx, seller.ID)
+		if err != nil {
+			t.Fatalf("request payout failed: %+v", err)
+		}
+		if payout.Amount != revenue {
+			t.Fatalf("expected the sales of the rejected payout to be included again, got: %+v", payout)
+		}
+
+		approved, err := service.ApprovePayout(ctx, payout.ID, &payloads.DecidePayoutPayload{}, adminContext)
+		if err != nil {
+			t.Fatalf("approve payout failed: %+v", err)
+		}
+		if approved.Status != models.PayoutStatusApproved || !strings.HasPrefix(approved.ProviderReference, "local-") {
+			t.Fatalf("expected the payout to be approved and sent, got: %+v", approved)
+		}
+		if _, err := service.ApprovePayout(ctx, payout.ID, &payloads.DecidePayoutPayload{}, adminContext); err != services.ErrPayoutDecided {
+			t.Fatalf("expected error %+v, got: %+v", services.ErrPayoutDecided, err)
+		}
+
+		statement, err := a.Services.Accounts.GetRevenue(seller.ID)
+		if err != nil {
+			t.Fatalf("get revenue failed: %+v", err)
+		}
+		if statement.Balance != 0 || statement.Entries[0].Kind != models.JournalKindPayout {
+			t.Fatalf("expected the payout to take the revenue, got: %+v", statement)
+		}
+		if _, err := service.RequestPayout(ctx, seller.ID); err != services.ErrNothingToPayOut {
+			t.Fatalf("expected error %+v, got: %+v", services.ErrNothingToPayOut, err)
+		}
+	})
+
+	t.Run("statement", func(t *testing.T) {
+		statement, err := service.GetPayoutStatement(payout.ID, sellerContext)
+		if err != nil {
+			t.Fatalf("get payout statement failed: %+v", err)
+		}
+		if len(statement.Sales) != 1 || statement.Sales[0].PurchaseID != purchase.ID || int64(statement.Sales[0].Net) != revenue {
+			t.Fatalf("expected the purchase in the statement, got: %+v", statement.Sales)
+		}
+
+		otherSeller, err := fixture.User.CreateSellerUser()
+		if err != nil {
+			t.Fatalf("could not create seller: %+v", err)
+		}
+		anotherSeller := auth.UserContext{ID: otherSeller.ID, Role: models.UserRoleSeller}
+		if _, err := service.GetPayoutStatement(payout.ID, anotherSeller); err == nil {
+			t.Fatalf("expected another seller not to read the statement")
+		}
+	})
+}
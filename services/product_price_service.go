@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrPriceNotScheduled is returned when cancelling a price that is already effective
+var ErrPriceNotScheduled = fmt.Errorf("only prices that are not effective yet can be cancelled")
+
+// ProductPriceService is a struct that contains references to the store and the permission policy
+type ProductPriceService struct {
+	store  repositories.Store
+	policy *auth.Policy
+}
+
+// GetProductPriceServiceDefaultInstance returns the default instance of ProductPriceService
+func GetProductPriceServiceDefaultInstance() *ProductPriceService {
+	return GetDefaultInstance().ProductPrices
+}
+
+// NewProductPriceService creates a ProductPriceService keeping the price history in the given store
+func NewProductPriceService(store repositories.Store, policy *auth.Policy) *ProductPriceService {
+	return &ProductPriceService{
+		store:  store,
+		policy: policy,
+	}
+}
+
+// GetPriceHistory returns the past, current and scheduled prices of the product by id, oldest first
+func (s *ProductPriceService) GetPriceHistory(productID uuid.UUID) (*payloads.ProductPriceList, error) {
+	return s.getPriceHistory(productID)
+}
+func (s *ProductPriceService) getPriceHistory(productID uuid.UUID) (*payloads.ProductPriceList, error) {
+	if _, err := s.store.Products().GetByID(productID); err != nil {
+		return nil, err
+	}
+
+	prices, err := s.store.Prices().List(productID)
+	if err != nil {
+		return nil, err
+	}
+	return &payloads.ProductPriceList{ProductID: productID, Prices: prices}, nil
+}
+
+// SchedulePrice schedules a change of the cost of the product by id, the user needs `product:write:own`
+// to schedule prices of their own products or `product:write:any` to schedule prices of any product
+func (s *ProductPriceService) SchedulePrice(ctx context.Context, productID uuid.UUID, schedulePrice *payloads.SchedulePricePayload, userContext auth.UserContext) (*models.ProductPrice, error) {
+	price := &models.ProductPrice{}
+	if err := schedulePrice.Validate(); err != nil {
+		return price, err
+	}
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		product, err := tx.Products().GetForUpdate(productID)
+		if err != nil {
+			return err
+		}
+		if err := s.policy.Authorize(userContext, auth.PermProductWrite, product.SellerID); err != nil {
+			return err
+		}
+		price, err = s.recordPrice(tx, productID, schedulePrice.Cost, schedulePrice.EffectiveFrom, userContext.ID)
+		return err
+	})
+	if err != nil {
+		return price, err
+	}
+	return price, nil
+}
+
+// CancelScheduledPrice removes a price of the product by id that is not effective yet, the previous price
+// then lasts until the removed price would have ended. The user needs the same permissions as for SchedulePrice
+func (s *ProductPriceService) CancelScheduledPrice(ctx context.Context, productID uuid.UUID, priceID uuid.UUID, userContext auth.UserContext) error {
+	return s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		product, err := tx.Products().GetForUpdate(productID)
+		if err != nil {
+			return err
+		}
+		if err := s.policy.Authorize(userContext, auth.PermProductWrite, product.SellerID); err != nil {
+			return err
+		}
+		return s.cancelScheduledPrice(tx, productID, priceID)
+	})
+}
+func (s *ProductPriceService) cancelScheduledPrice(tx repositories.Session, productID uuid.UUID, priceID uuid.UUID) error {
+	prices, err := tx.Prices().List(productID)
+	if err != nil {
+		return err
+	}
+	var price *models.ProductPrice
+	for _, p := range prices {
+		if p.ID == priceID {
+			price = p
+		}
+	}
+	if price == nil {
+		return db.ErrNoMatch
+	}
+	if !price.EffectiveFrom.After(time.Now()) {
+		return ErrPriceNotScheduled
+	}
+
+	if err := tx.Prices().Delete(price.ID); err != nil {
+		return err
+	}
+	for _, previous := range prices {
+		if previous.EffectiveTo == nil || !previous.EffectiveTo.Equal(price.EffectiveFrom) {
+			continue
+		}
+		previous.EffectiveTo = price.EffectiveTo
+		if err := tx.Prices().Update(previous); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ActivateScheduledPrices sets the cost of every product whose effective price changed since it was last
+// activated, returning the number of updated products. Purchases activate the price of their product themselves,
+// so this only keeps product listings current
+func (s *ProductPriceService) ActivateScheduledPrices(ctx context.Context) (int, error) {
+	var activated int
+	err := s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		var err error
+		activated, err = tx.Prices().ActivatePrices(time.Now())
+		return err
+	})
+	return activated, err
+}
+
+// recordPrice makes the cost the price of the product from the given time until the next scheduled price,
+// shortening the price effective at that time. The product must be locked by the transaction
+func (s *ProductPriceService) recordPrice(tx repositories.Session, productID uuid.UUID, cost int32, effectiveFrom time.Time, createdBy uuid.UUID) (*models.ProductPrice, error) {
+	// prices are stored with the precision of Postgres timestamps
+	effectiveFrom = effectiveFrom.Truncate(time.Microsecond)
+	prices, err := tx.Prices().List(productID)
+	if err != nil {
+		return nil, err
+	}
+	for _, price := range prices {
+		if price.EffectiveFrom.Equal(effectiveFrom) {
+			price.Cost = cost
+			price.CreatedBy = createdBy
+			if err := tx.Prices().Update(price); err != nil {
+				return price, err
+			}
+			return price, nil
+		}
+	}
+
+	var nextEffectiveFrom *time.Time
+	for _, price := range prices {
+		if price.EffectiveFrom.After(effectiveFrom) && (nextEffectiveFrom == nil || price.EffectiveFrom.Before(*nextEffectiveFrom)) {
+			next := price.EffectiveFrom
+			nextEffectiveFrom = &next
+		}
+		if price.EffectiveFrom.Before(effectiveFrom) && (price.EffectiveTo == nil || price.EffectiveTo.After(effectiveFrom)) {
+			effectiveTo := effectiveFrom
+			price.EffectiveTo = &effectiveTo
+			if err := tx.Prices().Update(price); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	price := &models.ProductPrice{
+		ID:            uuid.NewV4(),
+		ProductID:     productID,
+		Cost:          cost,
+		EffectiveFrom: effectiveFrom,
+		EffectiveTo:   nextEffectiveFrom,
+		CreatedBy:     createdBy,
+	}
+	if err := tx.Prices().Insert(price); err != nil {
+		return price, err
+	}
+	return price, nil
+}
+
+// activatePrice sets the cost of the locked product to its price effective now, if it changed
+func (s *ProductPriceService) activatePrice(tx repositories.Session, product *models.Product) error {
+	price, err := tx.Prices().GetAt(product.ID, time.Now())
+	if err != nil {
+		if err == db.ErrNoMatch {
+			return nil
+		}
+		return err
+	}
+	if price.Cost == product.Cost {
+		return nil
+	}
+
+	product.Cost = price.Cost
+	return tx.Products().Update(product)
+}
+
+// priceAt returns the cost the product had at the given time, or its current cost if no price was recorded for that time
+func (s *ProductPriceService) priceAt(tx repositories.Session, product *models.Product, at time.Time) (int32, error) {
+	price, err := tx.Prices().GetAt(product.ID, at)
+	if err != nil {
+		if err == db.ErrNoMatch {
+			return product.Cost, nil
+		}
+		return 0, err
+	}
+	return price.Cost, nil
+}
+
+// pricesBetween returns the costs the product had at any time from from until to, oldest first
+func (s *ProductPriceService) pricesBetween(tx repositories.Session, product *models.Product, from time.Time, to time.Time) ([]int32, error) {
+	prices, err := tx.Prices().ListBetween(product.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(prices) == 0 {
+		return []int32{product.Cost}, nil
+	}
+	costs := make([]int32, 0, len(prices))
+	for _, price := range prices {
+		costs = append(costs, price.Cost)
+	}
+	return costs, nil
+}
@@ -0,0 +1,209 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestProductPriceService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.ProductPrices
+	productService := a.Services.Products
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	secondSeller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	sellerContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+	ctx := context.Background()
+
+	t.Run("price history of a new product", func(t *testing.T) {
+		product, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		priceList, err := service.GetPriceHistory(product.ID)
+		if err != nil {
+			t.Fatalf("could not retreive prices: %+v", err)
+		}
+		if len(priceList.Prices) != 1 || priceList.Prices[0].Cost != product.Cost || priceList.Prices[0].EffectiveTo != nil {
+			t.Fatalf("expected the initial price without end, got: %+v", priceList.Prices)
+		}
+	})
+
+	t.Run("price history of a non-existing product", func(t *testing.T) {
+		if _, err := service.GetPriceHistory(uuid.NewV4()); err != db.ErrNoMatch {
+			t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+		}
+	})
+
+	t.Run("update cost", func(t *testing.T) {
+		product, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		productToUpdate := &payloads.UpdateProductPayload{}
+		productToUpdate.ID = product.ID
+		productToUpdate.Cost = product.Cost + 5
+		if _, err := productService.UpdateProduct(ctx, productToUpdate, sellerContext); err != nil {
+			t.Fatalf("update product failed: %+v", err)
+		}
+
+		priceList, err := service.GetPriceHistory(product.ID)
+		if err != nil {
+			t.Fatalf("could not retreive prices: %+v", err)
+		}
+		if len(priceList.Prices) != 2 {
+			t.Fatalf("expected the previous and the new price, got: %+v", priceList.Prices)
+		}
+		previous, current := priceList.Prices[0], priceList.Prices[1]
+		if previous.Cost != product.Cost || previous.EffectiveTo == nil || !previous.EffectiveTo.Equal(current.EffectiveFrom) {
+			t.Fatalf("expected the previous price to end when the new one starts, got: %+v, %+v", previous, current)
+		}
+		if current.Cost != productToUpdate.Cost || current.EffectiveTo != nil {
+			t.Fatalf("expected the new price without end, got: %+v", current)
+		}
+	})
+
+	t.Run("schedule price", func(t *testing.T) {
+		product, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		t.Run("in the past", func(t *testing.T) {
+			schedulePrice := &payloads.SchedulePricePayload{Cost: 100, EffectiveFrom: time.Now().Add(-time.Hour)}
+			if _, err := service.SchedulePrice(ctx, product.ID, schedulePrice, sellerContext); err == nil {
+				t.Fatal("expected schedule price to fail in the past, schedule was allowed")
+			}
+		})
+		t.Run("of another seller's product", func(t *testing.T) {
+			schedulePrice := &payloads.SchedulePricePayload{Cost: 100, EffectiveFrom: time.Now().Add(time.Hour)}
+			secondSellerContext := auth.UserContext{ID: secondSeller.ID, Role: models.UserRoleSeller}
+			if _, err := service.SchedulePrice(ctx, product.ID, schedulePrice, secondSellerContext); err != db.ErrUserForbidden {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrUserForbidden, err)
+			}
+		})
+		t.Run("between scheduled prices", func(t *testing.T) {
+			later := &payloads.SchedulePricePayload{Cost: 300, EffectiveFrom: time.Now().Add(48 * time.Hour)}
+			if _, err := service.SchedulePrice(ctx, product.ID, later, sellerContext); err != nil {
+				t.Fatalf("schedule price failed: %+v", err)
+			}
+			sooner := &payloads.SchedulePricePayload{Cost: 200, EffectiveFrom: time.Now().Add(24 * time.Hour)}
+			scheduledPrice, err := service.SchedulePrice(ctx, product.ID, sooner, sellerContext)
+			if err != nil {
+				t.Fatalf("schedule price failed: %+v", err)
+			}
+			if scheduledPrice.EffectiveTo == nil || !scheduledPrice.EffectiveTo.Equal(later.EffectiveFrom.Truncate(time.Microsecond)) {
+				t.Fatalf("expected the price to end when the later price starts, got: %+v", scheduledPrice)
+			}
+
+			unchangedProduct, err := productService.GetProductByID(product.ID)
+			if err != nil {
+				t.Fatalf("could not retreive product: %+v", err)
+			}
+			if unchangedProduct.Cost != product.Cost {
+				t.Fatalf("expected the cost to stay %d until the scheduled price is effective, got: %d", product.Cost, unchangedProduct.Cost)
+			}
+
+			t.Run("cancel", func(t *testing.T) {
+				if err := service.CancelScheduledPrice(ctx, product.ID, scheduledPrice.ID, sellerContext); err != nil {
+					t.Fatalf("cancel price failed: %+v", err)
+				}
+				priceList, err := service.GetPriceHistory(product.ID)
+				if err != nil {
+					t.Fatalf("could not retreive prices: %+v", err)
+				}
+				if len(priceList.Prices) != 2 || !priceList.Prices[0].EffectiveTo.Equal(priceList.Prices[1].EffectiveFrom) {
+					t.Fatalf("expected the current price to last until the later price, got: %+v", priceList.Prices)
+				}
+			})
+			t.Run("cancel effective price", func(t *testing.T) {
+				priceList, err := service.GetPriceHistory(product.ID)
+				if err != nil {
+					t.Fatalf("could not retreive prices: %+v", err)
+				}
+				err = service.CancelScheduledPrice(ctx, product.ID, priceList.Prices[0].ID, sellerContext)
+				if err != services.ErrPriceNotScheduled {
+					t.Fatalf("expected error %+v, got: %+v", services.ErrPriceNotScheduled, err)
+				}
+			})
+		})
+	})
+
+	t.Run("activate scheduled prices", func(t *testing.T) {
+		product, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		schedulePrice := &payloads.SchedulePricePayload{Cost: product.Cost + 10, EffectiveFrom: time.Now().Add(500 * time.Millisecond)}
+		if _, err := service.SchedulePrice(ctx, product.ID, schedulePrice, sellerContext); err != nil {
+			t.Fatalf("schedule price failed: %+v", err)
+		}
+		time.Sleep(time.Second)
+
+		if _, err := service.ActivateScheduledPrices(ctx); err != nil {
+			t.Fatalf("activate scheduled prices failed: %+v", err)
+		}
+		activatedProduct, err := productService.GetProductByID(product.ID)
+		if err != nil {
+			t.Fatalf("could not retreive product: %+v", err)
+		}
+		if activatedProduct.Cost != schedulePrice.Cost {
+			t.Fatalf("expected the scheduled cost %d, got: %d", schedulePrice.Cost, activatedProduct.Cost)
+		}
+	})
+	t.Run("purchase at a scheduled price", func(t *testing.T) {
+		productToCreate := &payloads.CreateProductPayload{
+			Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Cost: 25,
+		}
+		product, err := productService.CreateProduct(ctx, productToCreate, seller.ID)
+		if err != nil {
+			t.Fatalf("error while creating product %+v", err)
+		}
+		machine, err := fixture.Machine.CreateMachine(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create machine: %+v", err)
+		}
+		if _, err := fixture.Machine.StockProduct(machine, "A1", product.ID, 1); err != nil {
+			t.Fatalf("could not stock product: %+v", err)
+		}
+		schedulePrice := &payloads.SchedulePricePayload{Cost: 50, EffectiveFrom: time.Now().Add(500 * time.Millisecond)}
+		if _, err := service.SchedulePrice(ctx, product.ID, schedulePrice, sellerContext); err != nil {
+			t.Fatalf("schedule price failed: %+v", err)
+		}
+		time.Sleep(time.Second)
+
+		// the deposit pays for exactly one product at the scheduled price, so no change has to be paid out
+		buyer, err := a.Services.Users.CreateUser(ctx, &payloads.CreateUserPayload{
+			Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Password: "password",
+			Role:     models.UserRoleBuyer,
+			Deposit:  schedulePrice.Cost,
+		})
+		if err != nil {
+			t.Fatalf("error while creating user %+v", err)
+		}
+		productPurchase := &payloads.UserProductPurchase{MachineID: machine.ID, ProductID: product.ID, Amount: 1}
+		report, err := a.Services.Users.BuyProduct(ctx, productPurchase, buyer.ID)
+		if err != nil {
+			t.Fatalf("buy product failed: %+v", err)
+		}
+		if len(report.Purchases) != 1 || report.Purchases[0].UnitPrice != schedulePrice.Cost {
+			t.Fatalf("expected a purchase at the scheduled cost %d, got: %+v", schedulePrice.Cost, report.Purchases)
+		}
+	})
+}
@@ -2,76 +2,115 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/dhurimkelmendi/vending_machine/auth"
 	"github.com/dhurimkelmendi/vending_machine/db"
 	"github.com/dhurimkelmendi/vending_machine/models"
 	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
 
-	"github.com/go-pg/pg/v10"
 	uuid "github.com/satori/go.uuid"
 )
 
-// ProductService is a struct that contains references to the db and the StatelessAuthenticationProvider
+// ErrInsufficientProductAmount is returned when a product is not in stock in the requested amount
+var ErrInsufficientProductAmount = fmt.Errorf("insufficient product amount")
+
+// ErrProductHasPurchases is returned when deleting a product that was purchased, its purchases are kept for the ledger
+var ErrProductHasPurchases = fmt.Errorf("product has purchases and cannot be deleted")
+
+// ErrInvalidListParams is returned when a list is requested with an unknown sort field or a malformed cursor
+var ErrInvalidListParams = repositories.ErrInvalidListParams
+
+// ProductService is a struct that contains references to the store and the permission policy
 type ProductService struct {
-	db        *pg.DB
-	stateless *auth.StatelessAuthenticationProvider
+	store        repositories.Store
+	policy       *auth.Policy
+	priceService *ProductPriceService
 }
 
-var productServiceDefaultInstance *ProductService
-
 // GetProductServiceDefaultInstance returns the default instance of ProductService
 func GetProductServiceDefaultInstance() *ProductService {
-	if productServiceDefaultInstance == nil {
-		productServiceDefaultInstance = &ProductService{
-			db:        db.GetDefaultInstance().GetDB(),
-			stateless: auth.GetStatelessAuthenticationProviderDefaultInstance(),
-		}
+	return GetDefaultInstance().Products
+}
+
+// NewProductService creates a ProductService keeping the products in the given store. Creating and updating
+// products also records their price history
+func NewProductService(store repositories.Store, policy *auth.Policy, priceService *ProductPriceService) *ProductService {
+	return &ProductService{
+		store:        store,
+		policy:       policy,
+		priceService: priceService,
 	}
+}
 
-	return productServiceDefaultInstance
+// GetAllProducts returns a page of the products matching the filter
+func (s *ProductService) GetAllProducts(filter *payloads.ProductFilter) (*payloads.ProductList, error) {
+	return s.getAllProducts(s.store, filter)
 }
+func (s *ProductService) getAllProducts(tx repositories.Session, filter *payloads.ProductFilter) (*payloads.ProductList, error) {
+	products, page, err := tx.Products().List(filter)
+	if err != nil {
+		return nil, err
+	}
 
-// GetAllProducts returns all products
-func (s *ProductService) GetAllProducts() (*payloads.ProductList, error) {
-	return s.getAllProducts()
+	productList := &payloads.ProductList{}
+	productList.Products = products
+	productList.Page = page
+
+	return productList, nil
 }
-func (s *ProductService) getAllProducts() (*payloads.ProductList, error) {
-	products := make([]*models.Product, 0)
 
-	err := s.db.Model(&products).Select()
+// SearchProducts returns the products best matching the search text, ranked by how well their name and
+// description match. Every word of the text matches as a prefix, e.g. "choc bar" finds "Chocolate Bar",
+// and names that are similar to the text, e.g. "choclate", are matched as well to tolerate typos
+func (s *ProductService) SearchProducts(text string, limit int) (*payloads.ProductList, error) {
+	return s.searchProducts(s.store, text, limit)
+}
+func (s *ProductService) searchProducts(tx repositories.Session, text string, limit int) (*payloads.ProductList, error) {
+	products, total, err := tx.Products().Search(text, limit)
 	if err != nil {
 		return nil, err
 	}
 
 	productList := &payloads.ProductList{}
 	productList.Products = products
-
+	productList.Total = total
 	return productList, nil
 }
 
 // GetProductByID returns the requested product by id
 func (s *ProductService) GetProductByID(productID uuid.UUID) (*models.Product, error) {
-	return s.getProductByID(productID)
+	return s.getProductByID(s.store, productID)
 }
-func (s *ProductService) getProductByID(productID uuid.UUID) (*models.Product, error) {
-	product := &models.Product{}
-	switch err := s.db.Model(product).Where("id = ?", productID).Select(); err {
-	case pg.ErrNoRows:
-		return product, db.ErrNoMatch
-	default:
+func (s *ProductService) getProductByID(tx repositories.Session, productID uuid.UUID) (*models.Product, error) {
+	return tx.Products().GetByID(productID)
+}
+
+// getProductForUpdate returns the product by id, locking its row until the end of the transaction.
+// A scheduled price that became effective since the last activation is applied first, so the product is
+// sold at its current price
+func (s *ProductService) getProductForUpdate(tx repositories.Session, productID uuid.UUID) (*models.Product, error) {
+	product, err := tx.Products().GetForUpdate(productID)
+	if err != nil {
+		return product, err
+	}
+	if err := s.priceService.activatePrice(tx, product); err != nil {
 		return product, err
 	}
+	return product, nil
 }
 
-// CreateProduct creates a product using the provided payload
+// CreateProduct creates a product using the provided payload, ErrUnknownCategory is returned if its category
+// does not exist
 func (s *ProductService) CreateProduct(ctx context.Context, createProduct *payloads.CreateProductPayload, sellerID uuid.UUID) (*models.Product, error) {
 	product := &models.Product{}
 	if err := createProduct.Validate(); err != nil {
 		return product, err
 	}
 	var err error
-	err = s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
 		product, err = s.createProduct(tx, createProduct, sellerID)
 		return err
 	})
@@ -80,83 +119,94 @@ func (s *ProductService) CreateProduct(ctx context.Context, createProduct *paylo
 	}
 	return product, err
 }
-func (s *ProductService) createProduct(dbSession *pg.Tx, registerProduct *payloads.CreateProductPayload, sellerID uuid.UUID) (*models.Product, error) {
+func (s *ProductService) createProduct(tx repositories.Session, registerProduct *payloads.CreateProductPayload, sellerID uuid.UUID) (*models.Product, error) {
 	product := registerProduct.ToProductModel()
 	product.SellerID = sellerID
 	product.ID = uuid.NewV4()
-	_, err := dbSession.Model(product).Insert()
-	if err != nil {
+	if product.Tags == nil {
+		product.Tags = []string{}
+	}
+	if product.Allergens == nil {
+		product.Allergens = []string{}
+	}
+	if err := checkCategoryExists(tx, product.CategoryID); err != nil {
+		return product, err
+	}
+	if err := tx.Products().Insert(product); err != nil {
+		return product, err
+	}
+	if _, err := s.priceService.recordPrice(tx, product.ID, product.Cost, time.Now(), sellerID); err != nil {
 		return product, err
 	}
 
 	return product, nil
 }
 
-// UpdateProduct updates the product by id using the provided payload
+// UpdateProduct updates the product by id using the provided payload, the user needs `product:write:own`
+// to update their own products or `product:write:any` to update any product. A new cost is effective immediately
+// and recorded in the price history until the next scheduled price
 func (s *ProductService) UpdateProduct(ctx context.Context, updateProduct *payloads.UpdateProductPayload, userContext auth.UserContext) (*models.Product, error) {
 	var updatedProduct *models.Product
 	existingProduct, err := s.GetProductByID(updateProduct.ID)
 	if err != nil {
 		return updatedProduct, db.ErrNoMatch
 	}
-	if userContext.ID != existingProduct.SellerID {
-		return updatedProduct, db.ErrUserForbidden
+	if err := s.policy.Authorize(userContext, auth.PermProductWrite, existingProduct.SellerID); err != nil {
+		return updatedProduct, err
 	}
-	s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
-		updatedProduct, err = s.updateProduct(tx, updateProduct)
+	s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		updatedProduct, err = s.updateProduct(tx, updateProduct, userContext.ID)
 		return err
 	})
 
 	return updatedProduct, err
 }
-func (s *ProductService) updateProduct(dbSession *pg.Tx, updateProduct *payloads.UpdateProductPayload) (*models.Product, error) {
+func (s *ProductService) updateProduct(tx repositories.Session, updateProduct *payloads.UpdateProductPayload, userID uuid.UUID) (*models.Product, error) {
 	product := updateProduct.ToProductModel()
-	existingProduct, err := s.GetProductByID(product.ID)
+	existingProduct, err := s.getProductForUpdate(tx, product.ID)
 	if err != nil {
 		return &models.Product{}, db.ErrNoMatch
 	}
 
 	product.Merge(*existingProduct)
-
-	if _, err := dbSession.Model(product).Where("id = ?", product.ID).Update(); err != nil {
-		if err == pg.ErrNoRows {
-			return product, db.ErrNoMatch
+	if product.CategoryID != existingProduct.CategoryID {
+		if err := checkCategoryExists(tx, product.CategoryID); err != nil {
+			return product, err
 		}
+	}
+
+	if err := tx.Products().Update(product); err != nil {
 		return product, err
 	}
+	if product.Cost != existingProduct.Cost {
+		if _, err := s.priceService.recordPrice(tx, product.ID, product.Cost, time.Now(), userID); err != nil {
+			return product, err
+		}
+	}
 	return product, nil
 }
 
-// DeleteProduct deletes the product by id
+// DeleteProduct deletes the product by id, the user needs `product:write:own` to delete their own products
+// or `product:write:any` to delete any product. Products that were purchased cannot be deleted,
+// ErrProductHasPurchases is returned for them
 func (s *ProductService) DeleteProduct(ctx context.Context, productID uuid.UUID, userContext auth.UserContext) error {
 	existingProduct, err := s.GetProductByID(productID)
 	if err != nil {
 		return db.ErrNoMatch
 	}
-	if userContext.ID != existingProduct.SellerID {
-		return db.ErrUserForbidden
+	if err := s.policy.Authorize(userContext, auth.PermProductWrite, existingProduct.SellerID); err != nil {
+		return err
 	}
-	return s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+	return s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
 		return s.deleteProduct(tx, productID)
 	})
 }
-func (s *ProductService) deleteProduct(dbSession *pg.Tx, productID uuid.UUID) error {
-	product := &models.Product{ID: productID}
-
-	result, err := dbSession.Model(product).WherePK().Delete()
-
-	if err != nil {
-		switch err {
-		case pg.ErrNoRows:
-			return db.ErrNoMatch
-		default:
-			return err
+func (s *ProductService) deleteProduct(tx repositories.Session, productID uuid.UUID) error {
+	if err := tx.Products().Delete(productID); err != nil {
+		if err == repositories.ErrReferenced {
+			return ErrProductHasPurchases
 		}
+		return err
 	}
-
-	if result.RowsAffected() == 0 {
-		err = db.ErrNoMatch
-	}
-
-	return err
+	return nil
 }
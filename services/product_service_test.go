@@ -2,12 +2,14 @@ package services_test
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/brianvoe/gofakeit"
 	"github.com/dhurimkelmendi/vending_machine/auth"
-	"github.com/dhurimkelmendi/vending_machine/fixtures"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
 	"github.com/dhurimkelmendi/vending_machine/payloads"
 	"github.com/dhurimkelmendi/vending_machine/services"
 	uuid "github.com/satori/go.uuid"
@@ -15,12 +17,21 @@ import (
 
 func TestProductService(t *testing.T) {
 	t.Parallel()
-	fixture := fixtures.GetFixturesDefaultInstance()
+	a, fixture := newTestApp(t)
 
-	service := services.GetProductServiceDefaultInstance()
-	buyer := fixture.User.CreateBuyerUser(t)
-	seller := fixture.User.CreateSellerUser(t)
-	product := fixture.Product.CreateProduct(t, seller.ID)
+	service := a.Services.Products
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
 	sellerUserContext := auth.UserContext{
 		ID:   seller.ID,
 		Role: seller.Role,
@@ -31,8 +42,7 @@ func TestProductService(t *testing.T) {
 		t.Run("create product with all fields", func(t *testing.T) {
 			productToCreate := &payloads.CreateProductPayload{}
 			productToCreate.Name = strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
-			productToCreate.Cost = int32(gofakeit.Uint32())
-			productToCreate.AmountAvailable = int32(gofakeit.Uint32())
+			productToCreate.Cost = int32(gofakeit.Number(1, 1000))
 			createdProduct, err := service.CreateProduct(ctx, productToCreate, seller.ID)
 			if err != nil {
 				t.Fatalf("error while creating product %+v", err)
@@ -46,8 +56,7 @@ func TestProductService(t *testing.T) {
 		t.Run("with existing name", func(t *testing.T) {
 			productToCreate := &payloads.CreateProductPayload{}
 			productToCreate.Name = product.Name
-			productToCreate.Cost = int32(gofakeit.Uint32())
-			productToCreate.AmountAvailable = int32(gofakeit.Uint32())
+			productToCreate.Cost = int32(gofakeit.Number(1, 1000))
 			_, err := service.CreateProduct(ctx, productToCreate, seller.ID)
 			if err == nil {
 				t.Fatalf("expected duplicate product to fail %+v", err)
@@ -55,8 +64,7 @@ func TestProductService(t *testing.T) {
 		})
 		t.Run("without name", func(t *testing.T) {
 			productToCreate := &payloads.CreateProductPayload{}
-			productToCreate.Cost = int32(gofakeit.Uint32())
-			productToCreate.AmountAvailable = int32(gofakeit.Uint32())
+			productToCreate.Cost = int32(gofakeit.Number(1, 1000))
 			_, err := service.CreateProduct(ctx, productToCreate, seller.ID)
 			if err == nil {
 				t.Fatalf("expected create product to fail without name, update was allowed, %+v", err)
@@ -65,21 +73,73 @@ func TestProductService(t *testing.T) {
 		t.Run("without cost", func(t *testing.T) {
 			productToCreate := &payloads.CreateProductPayload{}
 			productToCreate.Name = strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
-			productToCreate.AmountAvailable = int32(gofakeit.Uint32())
 			_, err := service.CreateProduct(ctx, productToCreate, seller.ID)
 			if err == nil {
 				t.Fatalf("expected create product to fail without cost, update was allowed, %+v", err)
 			}
 		})
-		t.Run("without amount_available", func(t *testing.T) {
-			productToCreate := &payloads.CreateProductPayload{}
-			productToCreate.Name = strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
-			productToCreate.Cost = int32(gofakeit.Uint32())
-			_, err := service.CreateProduct(ctx, productToCreate, seller.ID)
-			if err == nil {
-				t.Fatalf("expected create product to fail without amount_available, update was allowed, %+v", err)
+	})
+
+	t.Run("create product with metadata", func(t *testing.T) {
+		category, err := fixture.Category.CreateCategory(uuid.Nil)
+		if err != nil {
+			t.Fatalf("could not create category: %+v", err)
+		}
+		calories := int32(240)
+		productToCreate := &payloads.CreateProductPayload{
+			Name:       strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Cost:       50,
+			CategoryID: category.ID,
+			Tags:       []string{" Vegan ", "vegan", "Snack"},
+			Calories:   &calories,
+			Allergens:  []string{"Nuts"},
+			EAN:        "4006381333931",
+			ImageURL:   "https://cdn.example.com/products/bar.png",
+		}
+		t.Run("with valid metadata", func(t *testing.T) {
+			createdProduct, err := service.CreateProduct(ctx, productToCreate, seller.ID)
+			if err != nil {
+				t.Fatalf("error while creating product %+v", err)
+			}
+			if createdProduct.CategoryID != category.ID || len(createdProduct.Tags) != 2 || createdProduct.Tags[0] != "vegan" {
+				t.Fatalf("expected product in category with normalized tags, got: %+v", createdProduct)
+			}
+			storedProduct, err := service.GetProductByID(createdProduct.ID)
+			if err != nil {
+				t.Fatalf("could not retreive product: %+v", err)
+			}
+			if storedProduct.Calories == nil || *storedProduct.Calories != calories || storedProduct.EAN != productToCreate.EAN ||
+				len(storedProduct.Allergens) != 1 || storedProduct.Allergens[0] != "nuts" {
+				t.Fatalf("expected stored metadata to match, got: %+v", storedProduct)
+			}
+		})
+		t.Run("with unknown category", func(t *testing.T) {
+			withUnknownCategory := *productToCreate
+			withUnknownCategory.Name = strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
+			withUnknownCategory.CategoryID = uuid.NewV4()
+			if _, err := service.CreateProduct(ctx, &withUnknownCategory, seller.ID); err != services.ErrUnknownCategory {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrUnknownCategory, err)
 			}
 		})
+		negativeCalories := int32(-1)
+		for name, invalidate := range map[string]func(p *payloads.CreateProductPayload){
+			"with invalid ean check digit": func(p *payloads.CreateProductPayload) { p.EAN = "4006381333932" },
+			"with invalid ean length":      func(p *payloads.CreateProductPayload) { p.EAN = "4006381333" },
+			"with unknown allergen":        func(p *payloads.CreateProductPayload) { p.Allergens = []string{"chocolate"} },
+			"with negative calories":       func(p *payloads.CreateProductPayload) { p.Calories = &negativeCalories },
+			"with relative image url":      func(p *payloads.CreateProductPayload) { p.ImageURL = "/products/bar.png" },
+			"with too long tag":            func(p *payloads.CreateProductPayload) { p.Tags = []string{strings.Repeat("a", 33)} },
+		} {
+			invalidate := invalidate
+			t.Run(name, func(t *testing.T) {
+				invalidProduct := *productToCreate
+				invalidProduct.Name = strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18]
+				invalidate(&invalidProduct)
+				if _, err := service.CreateProduct(ctx, &invalidProduct, seller.ID); err == nil {
+					t.Fatal("expected create product to fail with invalid metadata, create was allowed")
+				}
+			})
+		}
 	})
 
 	t.Run("get product by id", func(t *testing.T) {
@@ -90,17 +150,175 @@ func TestProductService(t *testing.T) {
 	})
 
 	t.Run("get all products", func(t *testing.T) {
-		_, err := service.GetAllProducts()
+		listSeller, err := fixture.User.CreateSellerUser()
+		if err != nil {
+			t.Fatalf("could not create seller: %+v", err)
+		}
+		for _, cost := range []int32{30, 10, 20} {
+			productToCreate := &payloads.CreateProductPayload{
+				Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+				Cost: cost,
+			}
+			if _, err := service.CreateProduct(ctx, productToCreate, listSeller.ID); err != nil {
+				t.Fatalf("error while creating product %+v", err)
+			}
+		}
+		listParams := payloads.ListParams{Limit: 2, Sort: "cost"}
+
+		t.Run("first page", func(t *testing.T) {
+			productList, err := service.GetAllProducts(&payloads.ProductFilter{ListParams: listParams, SellerID: listSeller.ID})
+			if err != nil {
+				t.Fatalf("could not retreive products: %+v", err)
+			}
+			if productList.Total != 3 || len(productList.Products) != 2 || productList.NextCursor == "" {
+				t.Fatalf("expected a page of 2 out of 3 products with a next cursor, got: %+v", productList)
+			}
+			if productList.Products[0].Cost != 10 || productList.Products[1].Cost != 20 {
+				t.Fatalf("expected products sorted by cost, got: %+v, %+v", productList.Products[0], productList.Products[1])
+			}
+
+			t.Run("next page", func(t *testing.T) {
+				nextParams := listParams
+				nextParams.Cursor = productList.NextCursor
+				nextList, err := service.GetAllProducts(&payloads.ProductFilter{ListParams: nextParams, SellerID: listSeller.ID})
+				if err != nil {
+					t.Fatalf("could not retreive products: %+v", err)
+				}
+				if len(nextList.Products) != 1 || nextList.Products[0].Cost != 30 || nextList.NextCursor != "" {
+					t.Fatalf("expected the last product without a next cursor, got: %+v", nextList)
+				}
+			})
+		})
+		t.Run("sorted descending with cost range", func(t *testing.T) {
+			minCost, maxCost := int32(15), int32(30)
+			productList, err := service.GetAllProducts(&payloads.ProductFilter{
+				ListParams: payloads.ListParams{Limit: 10, Sort: "-cost"},
+				SellerID:   listSeller.ID,
+				MinCost:    &minCost,
+				MaxCost:    &maxCost,
+			})
+			if err != nil {
+				t.Fatalf("could not retreive products: %+v", err)
+			}
+			if productList.Total != 2 || productList.Products[0].Cost != 30 || productList.Products[1].Cost != 20 {
+				t.Fatalf("expected products costing 30 and 20, got: %+v", productList.Products)
+			}
+		})
+		t.Run("in stock only", func(t *testing.T) {
+			productList, err := service.GetAllProducts(&payloads.ProductFilter{
+				ListParams: payloads.ListParams{Limit: 10},
+				SellerID:   listSeller.ID,
+				InStock:    true,
+			})
+			if err != nil {
+				t.Fatalf("could not retreive products: %+v", err)
+			}
+			if productList.Total != 0 {
+				t.Fatalf("expected no products in stock, got: %+v", productList.Products)
+			}
+		})
+		t.Run("by category and tag", func(t *testing.T) {
+			drinks, err := fixture.Category.CreateCategory(uuid.Nil)
+			if err != nil {
+				t.Fatalf("could not create category: %+v", err)
+			}
+			soda, err := fixture.Category.CreateCategory(drinks.ID)
+			if err != nil {
+				t.Fatalf("could not create category: %+v", err)
+			}
+			productToCreate := &payloads.CreateProductPayload{
+				Name:       strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+				Cost:       15,
+				CategoryID: soda.ID,
+				Tags:       []string{"sugar-free", "cold"},
+			}
+			soft, err := service.CreateProduct(ctx, productToCreate, listSeller.ID)
+			if err != nil {
+				t.Fatalf("error while creating product %+v", err)
+			}
+
+			productList, err := service.GetAllProducts(&payloads.ProductFilter{
+				ListParams: payloads.ListParams{Limit: 10},
+				CategoryID: drinks.ID,
+			})
+			if err != nil {
+				t.Fatalf("could not retreive products: %+v", err)
+			}
+			if productList.Total != 1 || productList.Products[0].ID != soft.ID {
+				t.Fatalf("expected the product of the subcategory, got: %+v", productList.Products)
+			}
+
+			productList, err = service.GetAllProducts(&payloads.ProductFilter{
+				ListParams: payloads.ListParams{Limit: 10},
+				SellerID:   listSeller.ID,
+				Tags:       []string{"cold", "sugar-free"},
+			})
+			if err != nil {
+				t.Fatalf("could not retreive products: %+v", err)
+			}
+			if productList.Total != 1 || productList.Products[0].ID != soft.ID {
+				t.Fatalf("expected the product with both tags, got: %+v", productList.Products)
+			}
+		})
+		t.Run("with unknown sort", func(t *testing.T) {
+			_, err := service.GetAllProducts(&payloads.ProductFilter{ListParams: payloads.ListParams{Limit: 10, Sort: "seller_id"}})
+			if err != services.ErrInvalidListParams {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrInvalidListParams, err)
+			}
+		})
+	})
+
+	t.Run("search products", func(t *testing.T) {
+		// a word of letters only, so that it is a single token of the search vector
+		uniqueWord := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return 'g' + (r - '0')
+			}
+			return r
+		}, strings.Replace(uuid.NewV4().String(), "-", "", -1)[0:10])
+		productToCreate := &payloads.CreateProductPayload{
+			Name:        fmt.Sprintf("Hazelnut Crunch %s", uniqueWord),
+			Description: fmt.Sprintf("toasted %s wafer", uniqueWord),
+			Cost:        25,
+		}
+		searchedProduct, err := service.CreateProduct(ctx, productToCreate, seller.ID)
 		if err != nil {
-			t.Fatalf("could not retreive products: %+v", err)
+			t.Fatalf("error while creating product %+v", err)
+		}
+
+		for name, text := range map[string]string{
+			"by name prefixes":  fmt.Sprintf("hazel crun %s", uniqueWord[0:6]),
+			"by description":    fmt.Sprintf("%s wafer", uniqueWord),
+			"with a typo":       fmt.Sprintf("Hazlenut Crunch %s", uniqueWord),
+			"with tsquery text": fmt.Sprintf("%s & !| :*", uniqueWord),
+		} {
+			text := text
+			t.Run(name, func(t *testing.T) {
+				productList, err := service.SearchProducts(text, 10)
+				if err != nil {
+					t.Fatalf("could not search products: %+v", err)
+				}
+				if len(productList.Products) == 0 || productList.Products[0].ID != searchedProduct.ID {
+					t.Fatalf("expected product %s to be the best match for %q, got: %+v", searchedProduct.ID, text, productList.Products)
+				}
+			})
 		}
+		t.Run("without words", func(t *testing.T) {
+			productList, err := service.SearchProducts(" & ", 10)
+			if err != nil {
+				t.Fatalf("could not search products: %+v", err)
+			}
+			if len(productList.Products) != 0 {
+				t.Fatalf("expected no products, got: %+v", productList.Products)
+			}
+		})
 	})
 
 	t.Run("update product", func(t *testing.T) {
 		t.Run("with basic attributes", func(t *testing.T) {
 			productToUpdate := &payloads.UpdateProductPayload{}
 			productToUpdate.ID = product.ID
-			newCost := int32(gofakeit.Uint32())
+			newCost := int32(gofakeit.Number(1, 1000))
 			productToUpdate.Cost = newCost
 			updatedProduct, err := service.UpdateProduct(ctx, productToUpdate, sellerUserContext)
 			if err != nil {
@@ -114,7 +332,7 @@ func TestProductService(t *testing.T) {
 			productToUpdate := &payloads.UpdateProductPayload{}
 			newID := uuid.NewV4()
 			productToUpdate.ID = newID
-			newCost := int32(gofakeit.Uint32())
+			newCost := int32(gofakeit.Number(1, 1000))
 			productToUpdate.Cost = newCost
 			_, err := service.UpdateProduct(ctx, productToUpdate, sellerUserContext)
 			if err == nil {
@@ -143,3 +361,48 @@ func TestProductService(t *testing.T) {
 	})
 
 }
+
+func TestProductServiceWithMemoryStore(t *testing.T) {
+	t.Parallel()
+	a, _ := newTestApp(t)
+	store := a.Store
+	service := a.Services.Products
+	ctx := context.Background()
+
+	seller := &models.User{ID: uuid.NewV4(), Username: "seller", Role: models.UserRoleSeller}
+	if err := store.Users().Insert(seller); err != nil {
+		t.Fatalf("error while inserting seller %+v", err)
+	}
+	product := &models.Product{ID: uuid.NewV4(), SellerID: seller.ID, Name: "Chocolate Bar", Cost: 50}
+	if err := store.Products().Insert(product); err != nil {
+		t.Fatalf("error while inserting product %+v", err)
+	}
+
+	t.Run("get all products", func(t *testing.T) {
+		productList, err := service.GetAllProducts(&payloads.ProductFilter{ListParams: payloads.ListParams{Limit: 10}, Name: "chocolate"})
+		if err != nil {
+			t.Fatalf("error while getting all products %+v", err)
+		}
+		if productList.Total != 1 || !productList.Products[0].Equals(product) {
+			t.Fatalf("expected product %+v, got: %+v", product, productList.Products)
+		}
+	})
+	t.Run("search products", func(t *testing.T) {
+		productList, err := service.SearchProducts("choc", 10)
+		if err != nil {
+			t.Fatalf("error while searching products %+v", err)
+		}
+		if productList.Total != 1 {
+			t.Fatalf("expected 1 product, got: %+v", productList.Products)
+		}
+	})
+	t.Run("delete product", func(t *testing.T) {
+		err := service.DeleteProduct(ctx, product.ID, auth.UserContext{ID: seller.ID, Role: seller.Role})
+		if err != nil {
+			t.Fatalf("delete product failed: %+v", err)
+		}
+		if _, err := service.GetProductByID(product.ID); err != db.ErrNoMatch {
+			t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/promotion"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrPromotionProductNotOwned is returned when a promotion includes a product that is not sold by its seller
+var ErrPromotionProductNotOwned = fmt.Errorf("promotions can only include existing products of their seller")
+
+// PromotionService is a struct that contains references to the store and the permission policy
+type PromotionService struct {
+	store  repositories.Store
+	policy *auth.Policy
+}
+
+// GetPromotionServiceDefaultInstance returns the default instance of PromotionService
+func GetPromotionServiceDefaultInstance() *PromotionService {
+	return GetDefaultInstance().Promotions
+}
+
+// NewPromotionService creates a PromotionService keeping the promotions in the given store
+func NewPromotionService(store repositories.Store, policy *auth.Policy) *PromotionService {
+	return &PromotionService{
+		store:  store,
+		policy: policy,
+	}
+}
+
+// GetPromotions returns the promotions matching the filter, oldest first
+func (s *PromotionService) GetPromotions(filter *payloads.PromotionFilter) (*payloads.PromotionList, error) {
+	promotions, err := s.store.Promotions().List(repositories.PromotionFilter{
+		SellerID:  filter.SellerID,
+		ProductID: filter.ProductID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	promotionList := &payloads.PromotionList{Promotions: promotions}
+	if filter.Active {
+		now := time.Now()
+		promotionList.Promotions = make([]*models.Promotion, 0, len(promotions))
+		for _, p := range promotions {
+			if p.IsActiveAt(now) {
+				promotionList.Promotions = append(promotionList.Promotions, p)
+			}
+		}
+	}
+	return promotionList, nil
+}
+
+// GetPromotionByID returns the requested promotion by id
+func (s *PromotionService) GetPromotionByID(promotionID uuid.UUID) (*models.Promotion, error) {
+	return s.store.Promotions().GetByID(promotionID)
+}
+
+// CreatePromotion creates a promotion of the user on their own products, the user needs `promotion:write:own`
+// or `promotion:write:any`
+func (s *PromotionService) CreatePromotion(ctx context.Context, createPromotion *payloads.PromotionPayload, userContext auth.UserContext) (*models.Promotion, error) {
+	promotion := &models.Promotion{}
+	if err := createPromotion.Validate(); err != nil {
+		return promotion, err
+	}
+	if err := s.policy.Authorize(userContext, auth.PermPromotionWrite, userContext.ID); err != nil {
+		return promotion, err
+	}
+
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		promotion, err = s.createPromotion(tx, createPromotion, userContext.ID)
+		return err
+	})
+	if err != nil {
+		return promotion, err
+	}
+	return promotion, nil
+}
+func (s *PromotionService) createPromotion(tx repositories.Session, createPromotion *payloads.PromotionPayload, sellerID uuid.UUID) (*models.Promotion, error) {
+	promotion := createPromotion.ToPromotionModel(sellerID)
+	promotion.ID = uuid.NewV4()
+	if err := checkProductsOwned(tx, promotion.ProductIDs, sellerID); err != nil {
+		return promotion, err
+	}
+	if err := tx.Promotions().Insert(promotion); err != nil {
+		return promotion, err
+	}
+	return promotion, nil
+}
+
+// UpdatePromotion replaces the requested promotion by id, the user needs `promotion:write:own` to update
+// their own promotions or `promotion:write:any` to update any promotion. The products must remain those
+// of the seller of the promotion
+func (s *PromotionService) UpdatePromotion(ctx context.Context, promotionID uuid.UUID, updatePromotion *payloads.PromotionPayload, userContext auth.UserContext) (*models.Promotion, error) {
+	promotion := &models.Promotion{}
+	if err := updatePromotion.Validate(); err != nil {
+		return promotion, err
+	}
+
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		promotion, err = tx.Promotions().GetForUpdate(promotionID)
+		if err != nil {
+			return err
+		}
+		if err := s.policy.Authorize(userContext, auth.PermPromotionWrite, promotion.SellerID); err != nil {
+			return err
+		}
+		promotion, err = s.updatePromotion(tx, promotion, updatePromotion)
+		return err
+	})
+	if err != nil {
+		return promotion, err
+	}
+	return promotion, nil
+}
+func (s *PromotionService) updatePromotion(tx repositories.Session, promotion *models.Promotion, updatePromotion *payloads.PromotionPayload) (*models.Promotion, error) {
+	updatedPromotion := updatePromotion.ToPromotionModel(promotion.SellerID)
+	updatedPromotion.ID = promotion.ID
+	if err := checkProductsOwned(tx, updatedPromotion.ProductIDs, promotion.SellerID); err != nil {
+		return promotion, err
+	}
+	if err := tx.Promotions().Update(updatedPromotion); err != nil {
+		return promotion, err
+	}
+	return updatedPromotion, nil
+}
+
+// DeletePromotion deletes the requested promotion by id, the user needs the same permissions as for UpdatePromotion.
+// Purchases discounted by the promotion keep its id
+func (s *PromotionService) DeletePromotion(ctx context.Context, promotionID uuid.UUID, userContext auth.UserContext) error {
+	return s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		promotion, err := tx.Promotions().GetForUpdate(promotionID)
+		if err != nil {
+			return err
+		}
+		if err := s.policy.Authorize(userContext, auth.PermPromotionWrite, promotion.SellerID); err != nil {
+			return err
+		}
+		return tx.Promotions().Delete(promotion.ID)
+	})
+}
+
+// bestDiscount returns the discount of the promotion that takes the most off the items at the given time
+func (s *PromotionService) bestDiscount(session repositories.Session, items []promotion.Item, at time.Time) (promotion.Discount, error) {
+	productIDs := make([]uuid.UUID, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	promotions, err := session.Promotions().ListEffective(productIDs, at)
+	if err != nil {
+		return promotion.Discount{}, err
+	}
+	return promotion.Best(promotions, items, at), nil
+}
+
+// checkProductsOwned returns ErrPromotionProductNotOwned unless all products exist and are sold by the seller
+func checkProductsOwned(session repositories.Session, productIDs []uuid.UUID, sellerID uuid.UUID) error {
+	for _, productID := range productIDs {
+		product, err := session.Products().GetByID(productID)
+		if err == db.ErrNoMatch {
+			return ErrPromotionProductNotOwned
+		}
+		if err != nil {
+			return err
+		}
+		if product.SellerID != sellerID {
+			return ErrPromotionProductNotOwned
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestPromotionService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.Promotions
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	secondSeller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	sellerContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+	secondSellerContext := auth.UserContext{ID: secondSeller.ID, Role: models.UserRoleSeller}
+	ctx := context.Background()
+
+	t.Run("create promotion", func(t *testing.T) {
+		product, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		t.Run("valid", func(t *testing.T) {
+			promotionToCreate := &payloads.PromotionPayload{
+				Name:          "happy hour",
+				Type:          models.PromotionTypePercentage,
+				ProductIDs:    []uuid.UUID{product.ID},
+				Value:         20,
+				HappyHourFrom: "16:00",
+				HappyHourTo:   "18:00",
+			}
+			promotion, err := service.CreatePromotion(ctx, promotionToCreate, sellerContext)
+			if err != nil {
+				t.Fatalf("create promotion failed: %+v", err)
+			}
+			if promotion.SellerID != seller.ID || promotion.Value != 20 || len(promotion.ProductIDs) != 1 || promotion.ProductIDs[0] != product.ID {
+				t.Fatalf("expected a promotion of the seller on the product, got: %+v", promotion)
+			}
+		})
+		t.Run("on another seller's product", func(t *testing.T) {
+			promotionToCreate := &payloads.PromotionPayload{
+				Name: "discount", Type: models.PromotionTypeFixed, ProductIDs: []uuid.UUID{product.ID}, Value: 5,
+			}
+			if _, err := service.CreatePromotion(ctx, promotionToCreate, secondSellerContext); err != services.ErrPromotionProductNotOwned {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrPromotionProductNotOwned, err)
+			}
+		})
+		t.Run("as a buyer", func(t *testing.T) {
+			buyer, err := fixture.User.CreateBuyerUser()
+			if err != nil {
+				t.Fatalf("could not create buyer: %+v", err)
+			}
+			buyerContext := auth.UserContext{ID: buyer.ID, Role: models.UserRoleBuyer}
+			promotionToCreate := &payloads.PromotionPayload{
+				Name: "discount", Type: models.PromotionTypeFixed, ProductIDs: []uuid.UUID{product.ID}, Value: 5,
+			}
+			if _, err := service.CreatePromotion(ctx, promotionToCreate, buyerContext); err != db.ErrUserForbidden {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrUserForbidden, err)
+			}
+		})
+	})
+
+	t.Run("update promotion", func(t *testing.T) {
+		product, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		promotion, err := fixture.Promotion.CreatePercentagePromotion(seller, 10, product.ID)
+		if err != nil {
+			t.Fatalf("could not create promotion: %+v", err)
+		}
+		promotionToUpdate := &payloads.PromotionPayload{
+			Name: "bundle", Type: models.PromotionTypeBundle, ProductIDs: []uuid.UUID{product.ID, product.ID}, Value: 1,
+		}
+		t.Run("of another seller", func(t *testing.T) {
+			if _, err := service.UpdatePromotion(ctx, promotion.ID, promotionToUpdate, secondSellerContext); err != db.ErrUserForbidden {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrUserForbidden, err)
+			}
+		})
+		t.Run("own", func(t *testing.T) {
+			updatedPromotion, err := service.UpdatePromotion(ctx, promotion.ID, promotionToUpdate, sellerContext)
+			if err != nil {
+				t.Fatalf("update promotion failed: %+v", err)
+			}
+			if updatedPromotion.Type != models.PromotionTypeBundle || updatedPromotion.Value != 1 || len(updatedPromotion.ProductIDs) != 2 {
+				t.Fatalf("expected the promotion to become a bundle, got: %+v", updatedPromotion)
+			}
+		})
+	})
+
+	t.Run("get promotions of a product", func(t *testing.T) {
+		product, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		promotion, err := fixture.Promotion.CreatePercentagePromotion(seller, 10, product.ID)
+		if err != nil {
+			t.Fatalf("could not create promotion: %+v", err)
+		}
+		otherProduct, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		if _, err := fixture.Promotion.CreatePercentagePromotion(seller, 10, otherProduct.ID); err != nil {
+			t.Fatalf("could not create promotion: %+v", err)
+		}
+
+		promotionList, err := service.GetPromotions(&payloads.PromotionFilter{ProductID: product.ID, Active: true})
+		if err != nil {
+			t.Fatalf("could not retreive promotions: %+v", err)
+		}
+		if len(promotionList.Promotions) != 1 || promotionList.Promotions[0].ID != promotion.ID {
+			t.Fatalf("expected only the promotion of the product, got: %+v", promotionList.Promotions)
+		}
+	})
+
+	t.Run("delete promotion", func(t *testing.T) {
+		product, err := fixture.Product.CreateProduct(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create product: %+v", err)
+		}
+		promotion, err := fixture.Promotion.CreatePercentagePromotion(seller, 10, product.ID)
+		if err != nil {
+			t.Fatalf("could not create promotion: %+v", err)
+		}
+		if err := service.DeletePromotion(ctx, promotion.ID, secondSellerContext); err != db.ErrUserForbidden {
+			t.Fatalf("expected error %+v, got: %+v", db.ErrUserForbidden, err)
+		}
+		if err := service.DeletePromotion(ctx, promotion.ID, sellerContext); err != nil {
+			t.Fatalf("delete promotion failed: %+v", err)
+		}
+		if _, err := service.GetPromotionByID(promotion.ID); err != db.ErrNoMatch {
+			t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+		}
+	})
+
+	t.Run("purchase with buy 2 get 1", func(t *testing.T) {
+		productToCreate := &payloads.CreateProductPayload{
+			Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Cost: 40,
+		}
+		product, err := a.Services.Products.CreateProduct(ctx, productToCreate, seller.ID)
+		if err != nil {
+			t.Fatalf("error while creating product %+v", err)
+		}
+		machine, err := fixture.Machine.CreateMachine(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create machine: %+v", err)
+		}
+		if _, err := fixture.Machine.StockProduct(machine, "A1", product.ID, 3); err != nil {
+			t.Fatalf("could not stock product: %+v", err)
+		}
+		promotionToCreate := &payloads.PromotionPayload{
+			Name: "buy 2 get 1", Type: models.PromotionTypeBuyXGetY, ProductIDs: []uuid.UUID{product.ID}, BuyQuantity: 2, FreeQuantity: 1,
+		}
+		promotion, err := service.CreatePromotion(ctx, promotionToCreate, sellerContext)
+		if err != nil {
+			t.Fatalf("create promotion failed: %+v", err)
+		}
+
+		// the deposit pays for exactly two products, so no change has to be paid out
+		buyer, err := a.Services.Users.CreateUser(ctx, &payloads.CreateUserPayload{
+			Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Password: "password",
+			Role:     models.UserRoleBuyer,
+			Deposit:  80,
+		})
+		if err != nil {
+			t.Fatalf("error while creating user %+v", err)
+		}
+		productPurchase := &payloads.UserProductPurchase{MachineID: machine.ID, ProductID: product.ID, Amount: 3}
+		report, err := a.Services.Users.BuyProduct(ctx, productPurchase, buyer.ID)
+		if err != nil {
+			t.Fatalf("buy product failed: %+v", err)
+		}
+		if len(report.Purchases) != 1 {
+			t.Fatalf("expected one purchase, got: %+v", report.Purchases)
+		}
+		purchase := report.Purchases[0]
+		if purchase.OriginalPrice != 120 || purchase.Discount != 40 || purchase.Total != 80 || purchase.PromotionID != promotion.ID {
+			t.Fatalf("expected one product for free by the promotion, got: %+v", purchase)
+		}
+		if report.AmountSpent != 80 || report.AmountDiscounted != 40 {
+			t.Fatalf("expected 80 spent and 40 discounted, got: %d and %d", report.AmountSpent, report.AmountDiscounted)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// PurchaseService is a struct that contains references to the store and the permission policy
+type PurchaseService struct {
+	store  repositories.Store
+	policy *auth.Policy
+}
+
+// GetPurchaseServiceDefaultInstance returns the default instance of PurchaseService
+func GetPurchaseServiceDefaultInstance() *PurchaseService {
+	return GetDefaultInstance().Purchases
+}
+
+// NewPurchaseService creates a PurchaseService reading the purchases ledger from the given store
+func NewPurchaseService(store repositories.Store, policy *auth.Policy) *PurchaseService {
+	return &PurchaseService{
+		store:  store,
+		policy: policy,
+	}
+}
+
+// GetPurchases returns the purchases visible to the current user: all purchases with `purchase:read:any`,
+// the sales of their products with `sale:read`, and otherwise their own purchases with `purchase:read:own`
+func (s *PurchaseService) GetPurchases(userContext auth.UserContext) (*payloads.PurchaseList, error) {
+	var purchases []*models.Purchase
+	var err error
+	if s.policy.Allows(userContext.Role, auth.PermPurchaseRead.Any()) {
+		purchases, err = s.getPurchases(s.store, repositories.PurchaseFilter{})
+	} else if s.policy.Allows(userContext.Role, auth.PermSaleRead) {
+		purchases, err = s.GetPurchasesBySellerID(userContext.ID)
+	} else if s.policy.Allows(userContext.Role, auth.PermPurchaseRead.Own()) {
+		purchases, err = s.GetPurchasesByUserID(userContext.ID)
+	} else {
+		return nil, db.ErrUserForbidden
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	purchaseList := &payloads.PurchaseList{}
+	purchaseList.Purchases = purchases
+
+	return purchaseList, nil
+}
+
+// GetPurchasesByUserID returns all purchases made by the given user, newest first
+func (s *PurchaseService) GetPurchasesByUserID(userID uuid.UUID) ([]*models.Purchase, error) {
+	return s.getPurchases(s.store, repositories.PurchaseFilter{UserID: userID})
+}
+
+// GetPurchasesBySellerID returns all purchases of products sold by the given seller, newest first
+func (s *PurchaseService) GetPurchasesBySellerID(sellerID uuid.UUID) ([]*models.Purchase, error) {
+	return s.getPurchases(s.store, repositories.PurchaseFilter{SellerID: sellerID})
+}
+func (s *PurchaseService) getPurchases(tx repositories.Session, filter repositories.PurchaseFilter) ([]*models.Purchase, error) {
+	return tx.Purchases().List(filter)
+}
+
+// GetSalesReport returns the totals of all purchases net of refunds, with a breakdown per product ordered by revenue
+func (s *PurchaseService) GetSalesReport() (*payloads.SalesReport, error) {
+	return s.store.Purchases().SalesReport()
+}
+
+// GetPurchaseByID returns the requested purchase by id
+func (s *PurchaseService) GetPurchaseByID(purchaseID uuid.UUID) (*models.Purchase, error) {
+	return s.store.Purchases().GetByID(purchaseID)
+}
+
+// createPurchase appends the purchase to the ledger
+func (s *PurchaseService) createPurchase(tx repositories.Session, purchase *models.Purchase) (*models.Purchase, error) {
+	purchase.ID = uuid.NewV4()
+	if err := tx.Purchases().Insert(purchase); err != nil {
+		return purchase, err
+	}
+	return purchase, nil
+}
@@ -0,0 +1,140 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestPurchaseService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.Purchases
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	if _, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, buyer.ID); err != nil {
+		t.Fatalf("could not create purchase: %+v", err)
+	}
+	// the change of the first purchase was paid out, so the buyer inserts coins for the second one
+	deposit := &payloads.DepositMoneyPayload{MachineID: machine.ID, DepositAmount: 100}
+	for deposited := int32(0); deposited < product.Cost; deposited += deposit.DepositAmount {
+		if _, err := a.Services.Users.DepositMoney(context.Background(), deposit, buyer.ID); err != nil {
+			t.Fatalf("deposit money failed: %+v", err)
+		}
+	}
+	if _, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, buyer.ID); err != nil {
+		t.Fatalf("could not create purchase: %+v", err)
+	}
+
+	t.Run("get purchases", func(t *testing.T) {
+		t.Run("as buyer", func(t *testing.T) {
+			buyerUserContext := auth.UserContext{
+				ID:   buyer.ID,
+				Role: buyer.Role,
+			}
+			purchaseList, err := service.GetPurchases(buyerUserContext)
+			if err != nil {
+				t.Fatalf("could not retreive purchases: %+v", err)
+			}
+			if len(purchaseList.Purchases) != 2 {
+				t.Fatalf("expected every buy to be recorded separately, got %d purchases", len(purchaseList.Purchases))
+			}
+			for _, purchase := range purchaseList.Purchases {
+				if purchase.UserID != buyer.ID {
+					t.Fatalf("expected purchases of buyer %s only, got: %+v", buyer.ID, purchase)
+				}
+				if purchase.UnitPrice != product.Cost || purchase.Total != product.Cost*purchase.Quantity {
+					t.Fatalf("purchase recorded with wrong price, expected unit price %d, got: %+v", product.Cost, purchase)
+				}
+			}
+		})
+		t.Run("as seller", func(t *testing.T) {
+			sellerUserContext := auth.UserContext{
+				ID:   seller.ID,
+				Role: seller.Role,
+			}
+			purchaseList, err := service.GetPurchases(sellerUserContext)
+			if err != nil {
+				t.Fatalf("could not retreive sales: %+v", err)
+			}
+			if len(purchaseList.Purchases) != 2 {
+				t.Fatalf("expected 2 sales for seller, got %d", len(purchaseList.Purchases))
+			}
+			for _, purchase := range purchaseList.Purchases {
+				if purchase.SellerID != seller.ID {
+					t.Fatalf("expected sales of seller %s only, got: %+v", seller.ID, purchase)
+				}
+			}
+		})
+		t.Run("as admin", func(t *testing.T) {
+			adminUserContext := auth.UserContext{
+				ID:   uuid.NewV4(),
+				Role: models.UserRoleAdmin,
+			}
+			purchaseList, err := service.GetPurchases(adminUserContext)
+			if err != nil {
+				t.Fatalf("could not retreive purchases: %+v", err)
+			}
+			found := 0
+			for _, purchase := range purchaseList.Purchases {
+				if purchase.UserID == buyer.ID {
+					found++
+				}
+			}
+			if found != 2 {
+				t.Fatalf("expected admin to see the 2 purchases of buyer %s, got %d", buyer.ID, found)
+			}
+		})
+	})
+
+	t.Run("get sales report", func(t *testing.T) {
+		report, err := service.GetSalesReport()
+		if err != nil {
+			t.Fatalf("could not retreive sales report: %+v", err)
+		}
+		if report.Purchases < 2 || report.Revenue < int64(product.Cost)*2 {
+			t.Fatalf("expected report totals to include the purchases of product %s, got: %+v", product.ID, report)
+		}
+		for _, productSales := range report.Products {
+			if productSales.ProductID == product.ID {
+				if productSales.Purchases != 2 || productSales.SellerID != seller.ID {
+					t.Fatalf("expected 2 purchases of product %s by seller %s, got: %+v", product.ID, seller.ID, productSales)
+				}
+				return
+			}
+		}
+		t.Fatalf("expected product %s in sales report, got: %+v", product.ID, report.Products)
+	})
+
+	t.Run("get purchase by id", func(t *testing.T) {
+		purchases, err := service.GetPurchasesByUserID(buyer.ID)
+		if err != nil || len(purchases) == 0 {
+			t.Fatalf("could not retreive purchases: %+v", err)
+		}
+		purchase, err := service.GetPurchaseByID(purchases[0].ID)
+		if err != nil {
+			t.Fatalf("could not retreive existing purchase by ID: %s, %+v", purchases[0].ID, err)
+		}
+		if !purchase.Equals(purchases[0]) {
+			t.Fatalf("expected purchase %+v, got %+v", purchases[0], purchase)
+		}
+	})
+}
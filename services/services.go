@@ -0,0 +1,69 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/change"
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+)
+
+// Services is a struct that contains references to all service instances built from the same config and database
+type Services struct {
+	Users         *UserService
+	UserProducts  *UserProductService
+	Products      *ProductService
+	ProductPrices *ProductPriceService
+	Categories    *CategoryService
+	Promotions    *PromotionService
+	Purchases     *PurchaseService
+	Accounts      *AccountService
+	Payouts       *PayoutService
+	Machines      *MachineService
+	CoinInventory *CoinInventoryService
+	Tokens        *TokenService
+	Idempotency   *IdempotencyService
+	Sync          *SyncService
+}
+
+// New creates all services for the config, keeping their data in the store and authorizing users with the policy
+func New(cfg *config.Config, store repositories.Store, policy *auth.Policy, stateless *auth.StatelessAuthenticationProvider) *Services {
+	s := &Services{}
+	s.ProductPrices = NewProductPriceService(store, policy)
+	s.Products = NewProductService(store, policy, s.ProductPrices)
+	s.Categories = NewCategoryService(store)
+	s.Promotions = NewPromotionService(store, policy)
+	s.Purchases = NewPurchaseService(store, policy)
+	s.UserProducts = NewUserProductService(store, s.Purchases, change.NewChangeMaker(cfg.AcceptableDepositAmountValues))
+	s.Accounts = NewAccountService(store)
+	s.Payouts = NewPayoutService(store, s.Accounts, LocalPayoutProvider{}, policy)
+	s.CoinInventory = NewCoinInventoryService(store, policy, cfg)
+	s.Machines = NewMachineService(store, policy, cfg)
+	s.Tokens = NewTokenService(store, stateless, cfg)
+	s.Idempotency = NewIdempotencyService(store, cfg)
+	s.Users = NewUserService(store, policy, cfg, s.UserProducts, s.Products, s.Machines, s.Purchases,
+		s.CoinInventory, s.Promotions, s.Accounts, s.Tokens)
+	s.Sync = NewSyncService(store, policy, cfg, s.Users, s.Products, s.ProductPrices, s.Machines, s.Purchases,
+		s.CoinInventory, s.Accounts)
+	return s
+}
+
+var (
+	defaultInstance     *Services
+	defaultInstanceOnce sync.Once
+)
+
+// GetDefaultInstance returns the services built from the default config, database and authentication. The
+// GetXxxDefaultInstance functions return the services of this instance
+func GetDefaultInstance() *Services {
+	defaultInstanceOnce.Do(func() {
+		defaultInstance = New(
+			config.GetDefaultInstance(),
+			repositories.GetStoreDefaultInstance(),
+			auth.GetPolicyDefaultInstance(),
+			auth.GetStatelessAuthenticationProviderDefaultInstance(),
+		)
+	})
+	return defaultInstance
+}
@@ -0,0 +1,29 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/dhurimkelmendi/vending_machine/app"
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/fixtures"
+	"github.com/dhurimkelmendi/vending_machine/internal/dbtest"
+)
+
+// newTestApp builds an app from the environment config on an empty store of the driver TEST_DB_DRIVER selects, the
+// memory driver by default, so every test runs on its own data, and fixtures creating their records with its services
+func newTestApp(t *testing.T) (*app.App, *fixtures.Fixtures) {
+	return newConfiguredTestApp(t, func(cfg *config.Config) {})
+}
+
+// newConfiguredTestApp builds a test app like newTestApp from the environment config changed by configure
+func newConfiguredTestApp(t *testing.T, configure func(cfg *config.Config)) (*app.App, *fixtures.Fixtures) {
+	cfg := config.Load()
+	dbtest.Configure(t, cfg)
+	configure(cfg)
+	a, err := app.New(cfg)
+	if err != nil {
+		t.Fatalf("error while building app %+v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a, fixtures.New(cfg, a.Services)
+}
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrSyncOutOfOrder is returned when a machine pushes an event that is not after the last event it synced
+var ErrSyncOutOfOrder = fmt.Errorf("event sequence is not after the last event the machine synced")
+
+// ErrSyncEventReused is returned when a machine pushes an event whose id was synced before with another sequence or
+// by another machine
+var ErrSyncEventReused = fmt.Errorf("event id was already synced with another sequence or machine")
+
+// SyncService is a struct that contains references to the store and the services applying the events of machines
+type SyncService struct {
+	store                repositories.Store
+	policy               *auth.Policy
+	userService          *UserService
+	productService       *ProductService
+	productPriceService  *ProductPriceService
+	machineService       *MachineService
+	purchaseService      *PurchaseService
+	coinInventoryService *CoinInventoryService
+	accountService       *AccountService
+	platformFeePercent   int32
+}
+
+// GetSyncServiceDefaultInstance returns the default instance of SyncService
+func GetSyncServiceDefaultInstance() *SyncService {
+	return GetDefaultInstance().Sync
+}
+
+// NewSyncService creates a SyncService applying the events of machines to the given store with the platform fee of
+// the config
+func NewSyncService(store repositories.Store, policy *auth.Policy, cfg *config.Config, userService *UserService,
+	productService *ProductService, productPriceService *ProductPriceService, machineService *MachineService,
+	purchaseService *PurchaseService, coinInventoryService *CoinInventoryService, accountService *AccountService) *SyncService {
+	return &SyncService{
+		store:                store,
+		policy:               policy,
+		userService:          userService,
+		productService:       productService,
+		productPriceService:  productPriceService,
+		machineService:       machineService,
+		purchaseService:      purchaseService,
+		coinInventoryService: coinInventoryService,
+		accountService:       accountService,
+		platformFeePercent:   cfg.PlatformFeePercent,
+	}
+}
+
+// ApplyBatch applies the events a machine recorded offline in the order of their sequence, all in one transaction.
+// Events that were applied by an earlier batch are reported with the outcome they had, so a machine can push a batch
+// again until it gets a report. Conflicts with the central state are resolved by the same rules whichever server
+// applies the batch, an event that cannot be applied at all is rejected and the batch continues with the next event.
+// The user needs `machine:write:own` to push the events of the machines they operate or `machine:write:any` to push
+// the events of any machine
+func (s *SyncService) ApplyBatch(ctx context.Context, batch *payloads.SyncBatchPayload, userContext auth.UserContext) (*payloads.SyncBatchReport, error) {
+	if err := batch.Validate(); err != nil {
+		return &payloads.SyncBatchReport{}, err
+	}
+	report := &payloads.SyncBatchReport{}
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		report, err = s.applyBatch(tx, batch, userContext)
+		return err
+	})
+	if err != nil {
+		return &payloads.SyncBatchReport{}, err
+	}
+	return report, nil
+}
+func (s *SyncService) applyBatch(tx repositories.Session, batch *payloads.SyncBatchPayload, userContext auth.UserContext) (*payloads.SyncBatchReport, error) {
+	// the machine is locked first, so batches of the same machine are applied one after the other, whichever server
+	// receives them
+	machine, err := tx.Machines().GetForUpdate(batch.MachineID)
+	if err != nil {
+		return &payloads.SyncBatchReport{}, err
+	}
+	if err := s.policy.Authorize(userContext, auth.PermMachineWrite, machine.OwnerFor(userContext.ID)); err != nil {
+		return &payloads.SyncBatchReport{}, err
+	}
+
+	// the machine has been offline since it last synced, so its catalogue may hold any price effective since then
+	lastSequence, lastAppliedAt, err := tx.SyncEvents().LastApplied(machine.ID)
+	if err != nil {
+		return &payloads.SyncBatchReport{}, err
+	}
+	offlineSince := machine.CreatedAt
+	if lastAppliedAt != nil {
+		offlineSince = *lastAppliedAt
+	}
+
+	report := &payloads.SyncBatchReport{
+		BatchID:   batch.BatchID,
+		MachineID: machine.ID,
+		Events:    make([]*models.SyncEvent, 0, len(batch.Events)),
+	}
+	for _, event := range batch.Events {
+		synced, err := tx.SyncEvents().GetByID(event.ID)
+		switch err {
+		case nil:
+			if synced.MachineID != machine.ID || synced.Sequence != event.Sequence {
+				return &payloads.SyncBatchReport{}, ErrSyncEventReused
+			}
+			synced.Duplicate = true
+			report.Duplicates++
+			report.Conflicts += len(synced.Conflicts)
+			report.Events = append(report.Events, synced)
+			continue
+		case db.ErrNoMatch:
+		default:
+			return &payloads.SyncBatchReport{}, err
+		}
+		if event.Sequence <= lastSequence {
+			return &payloads.SyncBatchReport{}, ErrSyncOutOfOrder
+		}
+
+		conflicts, err := s.applyEvent(tx, machine, event, offlineSince, batch.RequestID)
+		if err != nil {
+			return &payloads.SyncBatchReport{}, err
+		}
+		synced = &models.SyncEvent{
+			ID:         event.ID,
+			MachineID:  machine.ID,
+			BatchID:    batch.BatchID,
+			Sequence:   event.Sequence,
+			Kind:       event.Kind,
+			OccurredAt: event.OccurredAt,
+			Status:     models.SyncEventStatusApplied,
+			Conflicts:  conflicts,
+		}
+		for _, conflict := range conflicts {
+			if conflict.Resolution == models.SyncResolutionRejected {
+				synced.Status = models.SyncEventStatusRejected
+			}
+		}
+		if err := tx.SyncEvents().Insert(synced); err != nil {
+			return &payloads.SyncBatchReport{}, err
+		}
+		lastSequence = event.Sequence
+
+		if synced.Status == models.SyncEventStatusRejected {
+			report.Rejected++
+		} else {
+			report.Applied++
+		}
+		report.Conflicts += len(conflicts)
+		report.Events = append(report.Events, synced)
+	}
+	return report, nil
+}
+
+// applyEvent applies the event to the central state and returns the conflicts found while applying it. An event
+// that cannot be applied is returned with a rejected conflict and nothing of it is written
+func (s *SyncService) applyEvent(tx repositories.Session, machine *models.Machine, event *payloads.SyncEvent, offlineSince time.Time, requestID string) ([]*models.SyncConflict, error) {
+	switch event.Kind {
+	case models.SyncEventKindDeposit:
+		return s.applyDeposit(tx, machine, event)
+	case models.SyncEventKindPurchase:
+		return s.applyPurchase(tx, machine, event, offlineSince, requestID)
+	default:
+		return s.applyStock(tx, machine, event)
+	}
+}
+
+// applyDeposit adds the coin to the deposit of the user and to the coin tubes of the machine
+func (s *SyncService) applyDeposit(tx repositories.Session, machine *models.Machine, event *payloads.SyncEvent) ([]*models.SyncConflict, error) {
+	deposit := &payloads.DepositMoneyPayload{MachineID: machine.ID, DepositAmount: event.Amount}
+	if err := deposit.Validate(s.userService.acceptableDepositAmountValues); err != nil {
+		return rejectedSyncEvent(models.SyncConflictInvalidDepositAmount, int64(event.Amount), 0), nil
+	}
+	switch _, err := s.userService.depositMoney(tx, deposit, event.UserID); err {
+	case nil:
+		return make([]*models.SyncConflict, 0), nil
+	case db.ErrNoMatch:
+		return rejectedSyncEvent(models.SyncConflictUnknownUser, int64(event.Amount), 0), nil
+	case db.ErrUserForbidden:
+		return rejectedSyncEvent(models.SyncConflictUserForbidden, int64(event.Amount), 0), nil
+	case ErrDepositHeldByAnotherMachine:
+		return rejectedSyncEvent(models.SyncConflictDepositHeldElsewhere, int64(event.Amount), 0), nil
+	default:
+		return nil, err
+	}
+}
+
+// applyPurchase records the sale the machine made from the deposit the user inserted into it. The sale is recorded at
+// the price the machine charged if that price was effective at some point while the machine was offline, since its
+// catalogue may not have had the later prices, otherwise at the price of the product when the sale happened. Either
+// way a price other than the one effective at the time is reported. The change is the deposit left over, which is
+// what the central server credited to the buyer. Stock the central server does not know of is clamped to the slots
+// and not charged, and change the coin tubes cannot cover is left in the tubes, both are reported for the operator
+// to count
+func (s *SyncService) applyPurchase(tx repositories.Session, machine *models.Machine, event *payloads.SyncEvent, offlineSince time.Time, requestID string) ([]*models.SyncConflict, error) {
+	total := int64(event.UnitPrice) * int64(event.Quantity)
+
+	// rows are locked in the order user, product, slots, coin inventory as in a checkout
+	user, err := tx.Users().GetForUpdate(event.UserID)
+	switch err {
+	case nil:
+	case db.ErrNoMatch:
+		return rejectedSyncEvent(models.SyncConflictUnknownUser, total, 0), nil
+	default:
+		return nil, err
+	}
+	// only coins inserted into this machine can pay for its sales, a deposit held by no machine is not in its tubes
+	switch user.MachineID {
+	case machine.ID:
+	case uuid.Nil:
+		return rejectedSyncEvent(models.SyncConflictDepositNotInMachine, total, int64(user.Deposit)), nil
+	default:
+		return rejectedSyncEvent(models.SyncConflictDepositHeldElsewhere, total, 0), nil
+	}
+	product, err := s.productService.getProductForUpdate(tx, event.ProductID)
+	switch err {
+	case nil:
+	case db.ErrNoMatch:
+		return rejectedSyncEvent(models.SyncConflictUnknownProduct, total, 0), nil
+	default:
+		return nil, err
+	}
+
+	// the machine clock cannot place a sale after it was pushed
+	occurredAt := event.OccurredAt
+	if now := time.Now(); occurredAt.After(now) {
+		occurredAt = now
+	}
+	offlineFrom := offlineSince
+	if occurredAt.Before(offlineFrom) {
+		offlineFrom = occurredAt
+	}
+	conflicts := make([]*models.SyncConflict, 0)
+	unitPrice := event.UnitPrice
+	price, err := s.productPriceService.priceAt(tx, product, occurredAt)
+	if err != nil {
+		return nil, err
+	}
+	if price != unitPrice {
+		offlinePrices, err := s.productPriceService.pricesBetween(tx, product, offlineFrom, occurredAt)
+		if err != nil {
+			return nil, err
+		}
+		resolution := models.SyncResolutionCentralKept
+		for _, offlinePrice := range offlinePrices {
+			if offlinePrice == unitPrice {
+				resolution = models.SyncResolutionMachineKept
+			}
+		}
+		if resolution == models.SyncResolutionCentralKept {
+			unitPrice = price
+		}
+		conflicts = append(conflicts, syncConflict(models.SyncConflictPriceMismatch, resolution, int64(event.UnitPrice), int64(price)))
+	}
+	total = int64(unitPrice) * int64(event.Quantity)
+	if int64(user.Deposit) < total {
+		return rejectedSyncEvent(models.SyncConflictInsufficientDeposit, total, int64(user.Deposit)), nil
+	}
+	taken, err := s.machineService.takeProduct(tx, machine.ID, product.ID, event.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	if taken < event.Quantity {
+		// the machine cannot have vended units its slots did not hold, so the buyer only pays for the units taken
+		if taken == 0 {
+			return rejectedSyncEvent(models.SyncConflictStockShortfall, int64(event.Quantity), 0), nil
+		}
+		conflicts = append(conflicts, syncConflict(models.SyncConflictStockShortfall, models.SyncResolutionClamped, int64(event.Quantity), int64(taken)))
+		total = int64(unitPrice) * int64(taken)
+	}
+
+	changeAmount := user.Deposit - int32(total)
+	if event.ChangeReturned != changeAmount {
+		conflicts = append(conflicts, syncConflict(models.SyncConflictChangeMismatch, models.SyncResolutionCentralKept, int64(event.ChangeReturned), int64(changeAmount)))
+	}
+	switch _, err := s.coinInventoryService.dispenseChange(tx, machine.ID, changeAmount); err {
+	case nil:
+	case ErrExactChangeOnly:
+		conflicts = append(conflicts, syncConflict(models.SyncConflictInsufficientCoins, models.SyncResolutionMachineKept, int64(changeAmount), 0))
+	default:
+		return nil, err
+	}
+
+	user.Deposit = 0
+	user.MachineID = uuid.Nil
+	if err := tx.Users().UpdateDeposit(user); err != nil {
+		return nil, err
+	}
+
+	purchase := &models.Purchase{
+		UserID:         user.ID,
+		ProductID:      product.ID,
+		SellerID:       product.SellerID,
+		MachineID:      machine.ID,
+		Quantity:       taken,
+		UnitPrice:      unitPrice,
+		OriginalPrice:  int32(total),
+		Total:          int32(total),
+		ChangeReturned: changeAmount,
+		RequestID:      requestID,
+		CheckoutID:     uuid.NewV4(),
+		Status:         models.PurchaseStatusCompleted,
+		CreatedAt:      occurredAt,
+	}
+	purchase.PlatformFee = int32(total * int64(s.platformFeePercent) / 100)
+	if purchase, err = s.purchaseService.createPurchase(tx, purchase); err != nil {
+		return nil, err
+	}
+	if _, err := s.accountService.post(tx, models.JournalKindPurchase, purchase.CheckoutID, requestID, salePostings(user.ID, []*models.Purchase{purchase})...); err != nil {
+		return nil, err
+	}
+	_, err = s.accountService.post(tx, models.JournalKindChange, purchase.CheckoutID, requestID, transfer(int64(changeAmount), buyerWallet(user.ID), machineCash(machine.ID))...)
+	if err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// applyStock adds the units the operator put into the slot, or removes the units they took out, keeping the slot
+// between empty and its capacity
+func (s *SyncService) applyStock(tx repositories.Session, machine *models.Machine, event *payloads.SyncEvent) ([]*models.SyncConflict, error) {
+	_, added, err := s.machineService.adjustSlot(tx, machine.ID, event.SlotCode, event.Quantity)
+	switch err {
+	case nil:
+	case db.ErrNoMatch:
+		return rejectedSyncEvent(models.SyncConflictUnknownSlot, int64(event.Quantity), 0), nil
+	default:
+		return nil, err
+	}
+
+	conflicts := make([]*models.SyncConflict, 0)
+	if added != event.Quantity {
+		conflictType := models.SyncConflictStockShortfall
+		if event.Quantity > 0 {
+			conflictType = models.SyncConflictCapacityExceeded
+		}
+		conflicts = append(conflicts, syncConflict(conflictType, models.SyncResolutionClamped, int64(event.Quantity), int64(added)))
+	}
+	return conflicts, nil
+}
+
+func syncConflict(conflictType models.SyncConflictType, resolution models.SyncResolution, machineValue int64, centralValue int64) *models.SyncConflict {
+	return &models.SyncConflict{Type: conflictType, Resolution: resolution, Machine: machineValue, Central: centralValue}
+}
+func rejectedSyncEvent(conflictType models.SyncConflictType, machineValue int64, centralValue int64) []*models.SyncConflict {
+	return []*models.SyncConflict{syncConflict(conflictType, models.SyncResolutionRejected, machineValue, centralValue)}
+}
+
+// GetCatalogue returns the slots of the machine with the products they hold, and the prices scheduled for those
+// products, for the machine to sell from while it is offline. Both are read in one transaction, so the prices match
+// the slots
+func (s *SyncService) GetCatalogue(ctx context.Context, machineID uuid.UUID) (*payloads.SyncCatalogue, error) {
+	catalogue := &payloads.SyncCatalogue{}
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		catalogue, err = s.getCatalogue(tx, machineID)
+		return err
+	})
+	if err != nil {
+		return &payloads.SyncCatalogue{}, err
+	}
+	return catalogue, nil
+}
+func (s *SyncService) getCatalogue(tx repositories.Session, machineID uuid.UUID) (*payloads.SyncCatalogue, error) {
+	if _, err := selectMachine(tx, machineID); err != nil {
+		return &payloads.SyncCatalogue{}, err
+	}
+	catalogue := &payloads.SyncCatalogue{
+		MachineID:       machineID,
+		GeneratedAt:     time.Now(),
+		Slots:           make([]*models.Slot, 0),
+		ScheduledPrices: make([]*models.ProductPrice, 0),
+	}
+	var err error
+	catalogue.Slots, err = tx.Slots().List(machineID)
+	if err != nil {
+		return &payloads.SyncCatalogue{}, err
+	}
+	if len(catalogue.Slots) == 0 {
+		return catalogue, nil
+	}
+
+	productIDs := make([]uuid.UUID, 0, len(catalogue.Slots))
+	for _, slot := range catalogue.Slots {
+		productIDs = append(productIDs, slot.ProductID)
+	}
+	catalogue.ScheduledPrices, err = tx.Prices().ListScheduled(productIDs, catalogue.GeneratedAt)
+	if err != nil {
+		return &payloads.SyncCatalogue{}, err
+	}
+	return catalogue, nil
+}
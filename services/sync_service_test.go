@@ -0,0 +1,269 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestSyncService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.Sync
+	userService := a.Services.Users
+	ctx := context.Background()
+
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	product, err := a.Services.Products.CreateProduct(ctx, &payloads.CreateProductPayload{
+		Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+		Cost: 40,
+	}, seller.ID)
+	if err != nil {
+		t.Fatalf("error while creating product %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	operatorContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+	buyer, err := userService.CreateUser(ctx, &payloads.CreateUserPayload{
+		Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+		Password: "password",
+		Role:     models.UserRoleBuyer,
+	})
+	if err != nil {
+		t.Fatalf("error while creating user %+v", err)
+	}
+
+	var sequence int64
+	event := func(kind models.SyncEventKind) *payloads.SyncEvent {
+		sequence++
+		return &payloads.SyncEvent{ID: uuid.NewV4(), Sequence: sequence, Kind: kind, OccurredAt: time.Now(), UserID: buyer.ID, ProductID: product.ID}
+	}
+	deposit := func(amount int32) *payloads.SyncEvent {
+		e := event(models.SyncEventKindDeposit)
+		e.Amount = amount
+		return e
+	}
+	purchase := func(unitPrice int32, changeReturned int32) *payloads.SyncEvent {
+		e := event(models.SyncEventKindPurchase)
+		e.Quantity = 1
+		e.UnitPrice = unitPrice
+		e.ChangeReturned = changeReturned
+		return e
+	}
+	stock := func(code string, quantity int32) *payloads.SyncEvent {
+		e := event(models.SyncEventKindStock)
+		e.SlotCode = code
+		e.Quantity = quantity
+		return e
+	}
+	batchOf := func(events ...*payloads.SyncEvent) *payloads.SyncBatchPayload {
+		return &payloads.SyncBatchPayload{BatchID: uuid.NewV4(), MachineID: machine.ID, Events: events}
+	}
+	expectConflicts := func(t *testing.T, synced *models.SyncEvent, status models.SyncEventStatus, expected ...models.SyncConflictType) {
+		if synced.Status != status || len(synced.Conflicts) != len(expected) {
+			t.Fatalf("expected event %d to be %s with conflicts %v, got: %s %+v", synced.Sequence, status, expected, synced.Status, synced.Conflicts)
+		}
+		for i, conflictType := range expected {
+			if synced.Conflicts[i].Type != conflictType {
+				t.Fatalf("expected event %d to have conflicts %v, got: %+v", synced.Sequence, expected, synced.Conflicts)
+			}
+		}
+	}
+
+	// the subtests push the events of the machine in order, so they run one after the other
+	var firstBatch *payloads.SyncBatchPayload
+	var firstReport *payloads.SyncBatchReport
+	t.Run("apply batch", func(t *testing.T) {
+		firstBatch = batchOf(deposit(50), deposit(20), purchase(40, 30), stock("A1", 5))
+		firstReport, err = service.ApplyBatch(ctx, firstBatch, operatorContext)
+		if err != nil {
+			t.Fatalf("error while applying batch %+v", err)
+		}
+		if firstReport.Applied != 4 || firstReport.Rejected != 0 || firstReport.Conflicts != 1 {
+			t.Fatalf("expected 4 events applied with one conflict, got: %+v", firstReport)
+		}
+		// the slot is full, so the units put into it are clamped to its capacity
+		expectConflicts(t, firstReport.Events[3], models.SyncEventStatusApplied, models.SyncConflictCapacityExceeded)
+
+		updatedBuyer, err := userService.GetUserByID(buyer.ID)
+		if err != nil {
+			t.Fatalf("error while getting user %+v", err)
+		}
+		if updatedBuyer.Deposit != 0 || updatedBuyer.MachineID != uuid.Nil {
+			t.Fatalf("expected the deposit to be spent, got: %+v", updatedBuyer)
+		}
+		purchases, err := a.Services.Purchases.GetPurchasesByUserID(buyer.ID)
+		if err != nil {
+			t.Fatalf("error while getting purchases %+v", err)
+		}
+		if len(purchases) != 1 || purchases[0].Total != 40 || purchases[0].ChangeReturned != 30 || purchases[0].Status != models.PurchaseStatusCompleted {
+			t.Fatalf("expected a completed purchase of 40 with 30 change, got: %+v", purchases)
+		}
+	})
+
+	t.Run("apply batch again", func(t *testing.T) {
+		report, err := service.ApplyBatch(ctx, firstBatch, operatorContext)
+		if err != nil {
+			t.Fatalf("error while applying batch %+v", err)
+		}
+		if report.Duplicates != 4 || report.Applied != 0 || report.Conflicts != firstReport.Conflicts {
+			t.Fatalf("expected all events to be duplicates, got: %+v", report)
+		}
+		for i, synced := range report.Events {
+			if !synced.Duplicate || synced.Status != firstReport.Events[i].Status || len(synced.Conflicts) != len(firstReport.Events[i].Conflicts) {
+				t.Fatalf("expected event %d to be reported as it was applied, got: %+v", i, synced)
+			}
+		}
+		purchases, _ := a.Services.Purchases.GetPurchasesByUserID(buyer.ID)
+		if len(purchases) != 1 {
+			t.Fatalf("expected the purchase to be recorded once, got: %+v", purchases)
+		}
+	})
+
+	t.Run("resolve conflicts", func(t *testing.T) {
+		invalidDeposit := deposit(7)
+		unknownUser := purchase(40, 10)
+		unknownUser.UserID = uuid.NewV4()
+		batch := batchOf(
+			invalidDeposit,
+			unknownUser,
+			purchase(40, 0),
+			deposit(50),
+			purchase(30, 25),
+			stock("A1", -5000),
+			stock("Z9", 1),
+		)
+		report, err := service.ApplyBatch(ctx, batch, operatorContext)
+		if err != nil {
+			t.Fatalf("error while applying batch %+v", err)
+		}
+		if report.Applied != 3 || report.Rejected != 4 {
+			t.Fatalf("expected 3 events applied and 4 rejected, got: %+v", report)
+		}
+		expectConflicts(t, report.Events[0], models.SyncEventStatusRejected, models.SyncConflictInvalidDepositAmount)
+		expectConflicts(t, report.Events[1], models.SyncEventStatusRejected, models.SyncConflictUnknownUser)
+		// the buyer has no coins in the machine, so the machine cannot have been paid
+		expectConflicts(t, report.Events[2], models.SyncEventStatusRejected, models.SyncConflictDepositNotInMachine)
+		expectConflicts(t, report.Events[3], models.SyncEventStatusApplied)
+		// the product never cost what the machine charged, so the buyer pays its price, and the change is the deposit
+		// left over at the central server
+		expectConflicts(t, report.Events[4], models.SyncEventStatusApplied, models.SyncConflictPriceMismatch, models.SyncConflictChangeMismatch)
+		if conflict := report.Events[4].Conflicts[0]; conflict.Resolution != models.SyncResolutionCentralKept || conflict.Central != 40 {
+			t.Fatalf("expected the price of the central server to be kept, got: %+v", conflict)
+		}
+		if conflict := report.Events[4].Conflicts[1]; conflict.Resolution != models.SyncResolutionCentralKept || conflict.Central != 10 {
+			t.Fatalf("expected the change of the central server to be kept, got: %+v", conflict)
+		}
+		expectConflicts(t, report.Events[5], models.SyncEventStatusApplied, models.SyncConflictStockShortfall)
+		expectConflicts(t, report.Events[6], models.SyncEventStatusRejected, models.SyncConflictUnknownSlot)
+
+		updatedMachine, err := a.Services.Machines.GetMachineByID(machine.ID)
+		if err != nil {
+			t.Fatalf("error while getting machine %+v", err)
+		}
+		if updatedMachine.Slots[0].Quantity != 0 {
+			t.Fatalf("expected the slot to be emptied, got: %+v", updatedMachine.Slots[0])
+		}
+	})
+
+	t.Run("charge a price of the offline window", func(t *testing.T) {
+		// the machine went offline with the old price in its catalogue
+		productToUpdate := &payloads.UpdateProductPayload{}
+		productToUpdate.ID = product.ID
+		productToUpdate.Cost = 45
+		if _, err := a.Services.Products.UpdateProduct(ctx, productToUpdate, operatorContext); err != nil {
+			t.Fatalf("error while updating product %+v", err)
+		}
+		report, err := service.ApplyBatch(ctx, batchOf(stock("A1", 1), deposit(50), purchase(40, 10)), operatorContext)
+		if err != nil {
+			t.Fatalf("error while applying batch %+v", err)
+		}
+		expectConflicts(t, report.Events[2], models.SyncEventStatusApplied, models.SyncConflictPriceMismatch)
+		if conflict := report.Events[2].Conflicts[0]; conflict.Resolution != models.SyncResolutionMachineKept || conflict.Central != 45 {
+			t.Fatalf("expected the price the machine charged to be kept, got: %+v", conflict)
+		}
+	})
+
+	t.Run("charge only the units the slots held", func(t *testing.T) {
+		// the machine clock runs ahead, and it sold more units than the central server put into its slots
+		events := []*payloads.SyncEvent{stock("A1", 1), deposit(50), deposit(50), purchase(45, 55)}
+		events[3].Quantity = 2
+		events[3].OccurredAt = time.Now().Add(time.Hour)
+		report, err := service.ApplyBatch(ctx, batchOf(events...), operatorContext)
+		if err != nil {
+			t.Fatalf("error while applying batch %+v", err)
+		}
+		synced := report.Events[3]
+		if synced.Status != models.SyncEventStatusApplied || len(synced.Conflicts) == 0 || synced.Conflicts[0].Type != models.SyncConflictStockShortfall {
+			t.Fatalf("expected the purchase to be applied with a stock shortfall, got: %s %+v", synced.Status, synced.Conflicts)
+		}
+
+		purchases, err := a.Services.Purchases.GetPurchasesByUserID(buyer.ID)
+		if err != nil {
+			t.Fatalf("error while getting purchases %+v", err)
+		}
+		var recorded *models.Purchase
+		for _, p := range purchases {
+			if p.UnitPrice == 45 {
+				recorded = p
+			}
+		}
+		if recorded == nil || recorded.Quantity != 1 || recorded.Total != 45 {
+			t.Fatalf("expected the buyer to pay for the unit taken, got: %+v", recorded)
+		}
+		if recorded.CreatedAt.After(time.Now()) {
+			t.Fatalf("expected the purchase not to be recorded in the future, got: %v", recorded.CreatedAt)
+		}
+
+		report, err = service.ApplyBatch(ctx, batchOf(deposit(50), purchase(45, 5)), operatorContext)
+		if err != nil {
+			t.Fatalf("error while applying batch %+v", err)
+		}
+		expectConflicts(t, report.Events[1], models.SyncEventStatusRejected, models.SyncConflictStockShortfall)
+	})
+
+	t.Run("apply events out of order", func(t *testing.T) {
+		outOfOrder := deposit(50)
+		outOfOrder.Sequence = 1
+		if _, err := service.ApplyBatch(ctx, batchOf(outOfOrder), operatorContext); err != services.ErrSyncOutOfOrder {
+			t.Fatalf("expected batch to fail with %v, got: %+v", services.ErrSyncOutOfOrder, err)
+		}
+	})
+
+	t.Run("apply batch of a machine operated by another seller", func(t *testing.T) {
+		secondSeller, err := fixture.User.CreateSellerUser()
+		if err != nil {
+			t.Fatalf("could not create seller: %+v", err)
+		}
+		sellerContext := auth.UserContext{ID: secondSeller.ID, Role: models.UserRoleSeller}
+		if _, err := service.ApplyBatch(ctx, batchOf(deposit(50)), sellerContext); err != db.ErrUserForbidden {
+			t.Fatalf("expected batch to fail with %v, got: %+v", db.ErrUserForbidden, err)
+		}
+	})
+
+	t.Run("get catalogue", func(t *testing.T) {
+		catalogue, err := service.GetCatalogue(ctx, machine.ID)
+		if err != nil {
+			t.Fatalf("error while getting catalogue %+v", err)
+		}
+		if len(catalogue.Slots) != 1 || catalogue.Slots[0].Product == nil || catalogue.Slots[0].Product.ID != product.ID {
+			t.Fatalf("expected the slot of the machine with its product, got: %+v", catalogue)
+		}
+		if _, err := service.GetCatalogue(ctx, uuid.NewV4()); err != db.ErrNoMatch {
+			t.Fatalf("expected catalogue of an unknown machine to fail with %v, got: %+v", db.ErrNoMatch, err)
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/config"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or was already used
+var ErrInvalidRefreshToken = fmt.Errorf("refresh token is invalid or expired")
+
+// TokenService is a struct that contains references to the store, the StatelessAuthenticationProvider
+// and the time refresh tokens are valid for
+type TokenService struct {
+	store           repositories.Store
+	stateless       *auth.StatelessAuthenticationProvider
+	refreshTokenTTL time.Duration
+}
+
+// GetTokenServiceDefaultInstance returns the default instance of TokenService
+func GetTokenServiceDefaultInstance() *TokenService {
+	return GetDefaultInstance().Tokens
+}
+
+// NewTokenService creates a TokenService keeping the refresh tokens in the given store, valid for the refresh token
+// TTL of the config
+func NewTokenService(store repositories.Store, stateless *auth.StatelessAuthenticationProvider, cfg *config.Config) *TokenService {
+	return &TokenService{
+		store:           store,
+		stateless:       stateless,
+		refreshTokenTTL: cfg.RefreshTokenTTL,
+	}
+}
+
+// issueTokens starts a session for the user on the given client, creating an access token and a refresh token
+// for it and setting them on the user
+func (s *TokenService) issueTokens(tx repositories.Session, user *models.User, client payloads.SessionClient) error {
+	accessToken, err := s.stateless.CreateUserAuthToken(user)
+	if err != nil {
+		return err
+	}
+
+	session := &models.Session{
+		ID:        uuid.NewV4(),
+		UserID:    user.ID,
+		JTI:       accessToken.ID,
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+	}
+	if err := tx.Sessions().Insert(session); err != nil {
+		return err
+	}
+
+	refreshToken, err := s.createRefreshToken(tx, session)
+	if err != nil {
+		return err
+	}
+
+	user.Token = accessToken.Token
+	user.TokenExpiresAt = &accessToken.ExpiresAt
+	user.RefreshToken = refreshToken
+	return nil
+}
+func (s *TokenService) createRefreshToken(tx repositories.Session, session *models.Session) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(secret)
+
+	storedToken := &models.RefreshToken{
+		ID:        uuid.NewV4(),
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+	}
+	if err := tx.RefreshTokens().Insert(storedToken); err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// hasActiveSession returns true if the user has a session that has not ended or expired
+func (s *TokenService) hasActiveSession(tx repositories.Session, userID uuid.UUID) (bool, error) {
+	return tx.Sessions().HasActive(userID)
+}
+
+// RefreshTokens exchanges the refresh token for a new access token and a new refresh token, extending its session.
+// Every refresh token can be used once; using it again ends all sessions of the user,
+// as it means that the token has been stolen
+func (s *TokenService) RefreshTokens(ctx context.Context, refresh *payloads.RefreshTokenPayload) (*payloads.AuthTokens, error) {
+	if err := refresh.Validate(); err != nil {
+		return nil, err
+	}
+
+	var tokens *payloads.AuthTokens
+	reused := false
+	err := s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		var err error
+		tokens, reused, err = s.refreshTokens(tx, refresh)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ErrInvalidRefreshToken
+	}
+	return tokens, nil
+}
+func (s *TokenService) refreshTokens(tx repositories.Session, refresh *payloads.RefreshTokenPayload) (*payloads.AuthTokens, bool, error) {
+	storedToken, err := tx.RefreshTokens().GetByHashForUpdate(hashRefreshToken(refresh.RefreshToken))
+	if err != nil {
+		if err == db.ErrNoMatch {
+			return nil, false, ErrInvalidRefreshToken
+		}
+		return nil, false, err
+	}
+
+	session, err := tx.Sessions().GetForUpdate(storedToken.SessionID)
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	if !session.IsActive(now) {
+		return nil, false, ErrInvalidRefreshToken
+	}
+
+	if storedToken.IsRevoked() {
+		// ending the sessions has to be committed, so this is not returned as an error
+		if err := tx.Sessions().EndAll(storedToken.UserID, ""); err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
+	}
+	if storedToken.IsExpired(now) {
+		return nil, false, ErrInvalidRefreshToken
+	}
+
+	if err := tx.RefreshTokens().Revoke(storedToken); err != nil {
+		return nil, false, err
+	}
+
+	user, err := tx.Users().GetByID(storedToken.UserID)
+	if err != nil {
+		return nil, false, err
+	}
+	accessToken, err := s.stateless.CreateUserAuthToken(user)
+	if err != nil {
+		return nil, false, err
+	}
+
+	session.JTI = accessToken.ID
+	session.ExpiresAt = now.Add(s.refreshTokenTTL)
+	if err := tx.Sessions().Refresh(session); err != nil {
+		return nil, false, err
+	}
+	refreshToken, err := s.createRefreshToken(tx, session)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &payloads.AuthTokens{
+		Token:          accessToken.Token,
+		TokenExpiresAt: accessToken.ExpiresAt,
+		RefreshToken:   refreshToken,
+	}, false, nil
+}
+
+// GetSessions returns the active sessions of the current user, most recently seen first
+func (s *TokenService) GetSessions(userContext auth.UserContext) (*payloads.SessionList, error) {
+	sessions, err := s.store.Sessions().ListActive(userContext.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.JTI == userContext.TokenID
+	}
+
+	sessionList := &payloads.SessionList{}
+	sessionList.Sessions = sessions
+	return sessionList, nil
+}
+
+// Logout ends the session of the current access token and puts the token on the denylist.
+// If a refresh token is given, the session it belongs to is ended as well
+func (s *TokenService) Logout(ctx context.Context, logout *payloads.RefreshTokenPayload, userContext auth.UserContext) error {
+	return s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		return s.logout(tx, logout, userContext)
+	})
+}
+func (s *TokenService) logout(tx repositories.Session, logout *payloads.RefreshTokenPayload, userContext auth.UserContext) error {
+	if logout.RefreshToken != "" {
+		storedToken, err := tx.RefreshTokens().RevokeByHash(userContext.ID, hashRefreshToken(logout.RefreshToken))
+		if err == db.ErrNoMatch {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Sessions().End(storedToken.SessionID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Sessions().EndByJTI(userContext.ID, userContext.TokenID); err != nil {
+		return err
+	}
+
+	return s.revokeAccessToken(tx, userContext.TokenID, userContext.TokenExpiresAt)
+}
+
+// LogoutOtherSessions ends all sessions of the current user except the one of the current access token
+func (s *TokenService) LogoutOtherSessions(ctx context.Context, userContext auth.UserContext) error {
+	return s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		return tx.Sessions().EndAll(userContext.ID, userContext.TokenID)
+	})
+}
+
+// revokeAccessToken puts the access token on the denylist until it expires,
+// dropping the entries of tokens that have expired in the meantime
+func (s *TokenService) revokeAccessToken(tx repositories.Session, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	return tx.RevokedTokens().Revoke(jti, expiresAt)
+}
+
+// hashRefreshToken returns the hash the refresh token is stored and looked up by
+func hashRefreshToken(refreshToken string) string {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,158 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dhurimkelmendi/vending_machine/app"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/models"
+	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/services"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestTokenService(t *testing.T) {
+	t.Parallel()
+	a, fixture := newTestApp(t)
+	service := a.Services.Tokens
+	denylist := a.Store.RevokedTokens()
+	sessionStore := a.Store.Sessions()
+	ctx := context.Background()
+
+	t.Run("created user gets an expiring access token and a refresh token", func(t *testing.T) {
+		buyer, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		if buyer.Token == "" || buyer.RefreshToken == "" {
+			t.Fatalf("expected auth tokens on the created user, got: %+v", buyer)
+		}
+		if buyer.TokenExpiresAt == nil || !buyer.TokenExpiresAt.After(time.Now()) {
+			t.Fatalf("expected the access token to expire in the future, got: %+v", buyer.TokenExpiresAt)
+		}
+	})
+
+	t.Run("refresh rotates the refresh token", func(t *testing.T) {
+		buyer, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		tokens, err := service.RefreshTokens(ctx, &payloads.RefreshTokenPayload{RefreshToken: buyer.RefreshToken})
+		if err != nil {
+			t.Fatalf("refresh tokens failed: %+v", err)
+		}
+		if tokens.RefreshToken == buyer.RefreshToken {
+			t.Fatalf("expected a new refresh token")
+		}
+
+		t.Run("reusing the old refresh token revokes the new one", func(t *testing.T) {
+			if _, err := service.RefreshTokens(ctx, &payloads.RefreshTokenPayload{RefreshToken: buyer.RefreshToken}); err != services.ErrInvalidRefreshToken {
+				t.Fatalf("expected %v, got %+v", services.ErrInvalidRefreshToken, err)
+			}
+			if _, err := service.RefreshTokens(ctx, &payloads.RefreshTokenPayload{RefreshToken: tokens.RefreshToken}); err != services.ErrInvalidRefreshToken {
+				t.Fatalf("expected %v, got %+v", services.ErrInvalidRefreshToken, err)
+			}
+		})
+	})
+
+	t.Run("unknown refresh token", func(t *testing.T) {
+		if _, err := service.RefreshTokens(ctx, &payloads.RefreshTokenPayload{RefreshToken: uuid.NewV4().String()}); err != services.ErrInvalidRefreshToken {
+			t.Fatalf("expected %v, got %+v", services.ErrInvalidRefreshToken, err)
+		}
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		buyer, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		userContext := userContextOf(t, a, buyer)
+
+		t.Run("with a refresh token of another user", func(t *testing.T) {
+			seller, err := fixture.User.CreateSellerUser()
+			if err != nil {
+				t.Fatalf("could not create seller: %+v", err)
+			}
+			if err := service.Logout(ctx, &payloads.RefreshTokenPayload{RefreshToken: seller.RefreshToken}, userContext); err != services.ErrInvalidRefreshToken {
+				t.Fatalf("expected %v, got %+v", services.ErrInvalidRefreshToken, err)
+			}
+		})
+
+		if err := service.Logout(ctx, &payloads.RefreshTokenPayload{RefreshToken: buyer.RefreshToken}, userContext); err != nil {
+			t.Fatalf("logout failed: %+v", err)
+		}
+		revoked, err := denylist.IsRevoked(userContext.TokenID)
+		if err != nil || !revoked {
+			t.Fatalf("expected the access token to be revoked, got: %+v, %+v", revoked, err)
+		}
+		if _, err := service.RefreshTokens(ctx, &payloads.RefreshTokenPayload{RefreshToken: buyer.RefreshToken}); err != services.ErrInvalidRefreshToken {
+			t.Fatalf("expected %v, got %+v", services.ErrInvalidRefreshToken, err)
+		}
+		sessions, err := service.GetSessions(userContext)
+		if err != nil || len(sessions.Sessions) != 0 {
+			t.Fatalf("expected the session to have ended, got: %+v, %+v", sessions, err)
+		}
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		seller, err := fixture.User.CreateSellerUser()
+		if err != nil {
+			t.Fatalf("could not create seller: %+v", err)
+		}
+		firstSession := userContextOf(t, a, seller)
+
+		loginUser := &payloads.LoginUserPayload{Username: seller.Username, Password: "password"}
+		loginUser.Client = payloads.SessionClient{UserAgent: "vending-machine-test", IPAddress: "10.0.0.1"}
+		loggedInUser, err := a.Services.Users.LoginUser(ctx, loginUser)
+		if err != nil {
+			t.Fatalf("login failed: %+v", err)
+		}
+		if !loggedInUser.HasActiveSession {
+			t.Fatalf("expected login to report the already active session")
+		}
+		secondSession := userContextOf(t, a, loggedInUser)
+
+		sessions, err := service.GetSessions(secondSession)
+		if err != nil || len(sessions.Sessions) != 2 {
+			t.Fatalf("expected two active sessions, got: %+v, %+v", sessions, err)
+		}
+		for _, session := range sessions.Sessions {
+			if session.Current != (session.UserAgent == "vending-machine-test") {
+				t.Fatalf("expected only the session of the login to be current, got: %+v", session)
+			}
+		}
+
+		t.Run("logout other sessions", func(t *testing.T) {
+			if err := service.LogoutOtherSessions(ctx, secondSession); err != nil {
+				t.Fatalf("logout other sessions failed: %+v", err)
+			}
+			active, err := sessionStore.TouchSession(firstSession.TokenID)
+			if err != nil || active {
+				t.Fatalf("expected the first session to have ended, got: %+v, %+v", active, err)
+			}
+			active, err = sessionStore.TouchSession(secondSession.TokenID)
+			if err != nil || !active {
+				t.Fatalf("expected the current session to stay active, got: %+v, %+v", active, err)
+			}
+			if _, err := service.RefreshTokens(ctx, &payloads.RefreshTokenPayload{RefreshToken: seller.RefreshToken}); err != services.ErrInvalidRefreshToken {
+				t.Fatalf("expected %v, got %+v", services.ErrInvalidRefreshToken, err)
+			}
+		})
+	})
+}
+
+// userContextOf returns the context of requests made to the app with the access token of the user
+func userContextOf(t *testing.T, a *app.App, user *models.User) auth.UserContext {
+	token, err := a.Stateless.ParseToken(user.Token)
+	if err != nil {
+		t.Fatalf("error decoding access token: %+v", err)
+	}
+	return auth.UserContext{
+		ID:             user.ID,
+		Role:           user.Role,
+		TokenID:        token.JwtID(),
+		TokenExpiresAt: token.Expiration(),
+	}
+}
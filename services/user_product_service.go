@@ -1,144 +1,76 @@
 package services
 
 import (
-	"context"
-	"strconv"
-
-	"github.com/dhurimkelmendi/vending_machine/auth"
-	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/change"
 	"github.com/dhurimkelmendi/vending_machine/models"
 	"github.com/dhurimkelmendi/vending_machine/payloads"
-	"github.com/go-pg/pg/v10"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
 	uuid "github.com/satori/go.uuid"
 )
 
-// UserProductService is a struct that contains references to the db and the StatelessAuthenticationProvider
+// UserProductService is a struct that contains references to the store and the purchase service
 type UserProductService struct {
-	db        *pg.DB
-	stateless *auth.StatelessAuthenticationProvider
+	store           repositories.Store
+	purchaseService *PurchaseService
+	changeMaker     change.ChangeMaker
 }
 
-var userProductServiceDefaultInstance *UserProductService
-
 // GetUserProductServiceDefaultInstance returns the default instance of UserProductService
 func GetUserProductServiceDefaultInstance() *UserProductService {
-	if userProductServiceDefaultInstance == nil {
-
-		userProductServiceDefaultInstance = &UserProductService{
-			db:        db.GetDefaultInstance().GetDB(),
-			stateless: auth.GetStatelessAuthenticationProviderDefaultInstance(),
-		}
-	}
-	return userProductServiceDefaultInstance
+	return GetDefaultInstance().UserProducts
 }
 
-// CreateChangeRepresentation returns a UserChange instance from a given int32
-func (s *UserProductService) CreateChangeRepresentation(change int32) *payloads.UserChange {
-	userChange := &payloads.UserChange{}
-	if change < 0 {
-		return userChange
+// NewUserProductService creates a UserProductService reading the users from the given store, the purchases of the
+// reports are read by the purchase service
+func NewUserProductService(store repositories.Store, purchaseService *PurchaseService, changeMaker change.ChangeMaker) *UserProductService {
+	return &UserProductService{
+		store:           store,
+		purchaseService: purchaseService,
+		changeMaker:     changeMaker,
 	}
+}
 
-	changeString := strconv.Itoa(int(change))
-	hundreds, err := strconv.Atoi(changeString[0 : len(changeString)-2])
-	if err != nil {
-		userChange.HundredCentCoins = 0
-	}
-	userChange.HundredCentCoins = int32(hundreds)
-	tens, err := strconv.Atoi(changeString[len(changeString)-2 : len(changeString)-1])
-	if err != nil {
-		userChange.TenCentCoins = 0
-		userChange.FiftyCentCoins = 0
-		userChange.TwentyCentCoins = 0
+// CreateChangeRepresentation breaks the given amount down into coins of the acceptable deposit amounts
+func (s *UserProductService) CreateChangeRepresentation(amount int32) (change.Coins, error) {
+	if amount <= 0 {
+		return change.Coins{}, nil
 	}
-	if tens/5 > 0 {
-		userChange.FiftyCentCoins = int32(tens / 5)
-		tens -= 5
-	}
-	if tens/2 > 0 {
-		userChange.TwentyCentCoins = int32(tens / 2)
-		tens -= 2
-	}
-	if tens > 0 {
-		userChange.TenCentCoins = int32(tens)
-	}
-
-	ones, err := strconv.Atoi(string(changeString[len(changeString)-1:]))
-	userChange.FiveCentCoins = int32(ones / 5)
-	return userChange
+	return s.changeMaker.MakeChange(amount)
 }
 
-// GetUserBuysReport returns all userProducts related to a given user, with the amount spent and change(if any)
+// GetUserBuysReport returns all products bought by a given user, with the amount spent and change(if any).
+// The amount spent is computed from the purchases ledger, using the price the products had at the time of sale
 func (s *UserProductService) GetUserBuysReport(userID uuid.UUID) (*payloads.UserBuysReport, error) {
 	return s.getUserBuysReport(userID)
 }
 func (s *UserProductService) getUserBuysReport(userID uuid.UUID) (*payloads.UserBuysReport, error) {
 	userReport := &payloads.UserBuysReport{UserID: userID}
-	user := &models.User{ID: userID}
-	if err := s.db.Model(user).
-		WherePK().
-		Relation("Products").
-		Select(); err != nil {
-		switch err {
-		case pg.ErrNoRows:
-			return userReport, db.ErrNoMatch
-		default:
-			return userReport, err
-		}
-	}
-	productAmounts := make(map[string]int32, len(userReport.Products))
-	userProducts, err := s.GetAllUserProductsForUser(userID)
+	user, err := s.store.Users().GetByID(userID)
 	if err != nil {
-		return &payloads.UserBuysReport{}, err
+		return userReport, err
 	}
 
-	for _, userProduct := range userProducts {
-		productAmounts[userProduct.ProductID.String()] = userProduct.Amount
-	}
-
-	for _, product := range user.Products {
-		userReport.AmountSpent += product.Cost * productAmounts[product.ID.String()]
-	}
-	userReport.Products = user.Products
-	userChange := user.Deposit - userReport.AmountSpent
-	userReport.Change = *s.CreateChangeRepresentation(userChange)
-
-	return userReport, nil
-}
-
-// GetAllUserProductsForUser returns all UserProducts for user
-func (s *UserProductService) GetAllUserProductsForUser(UserID uuid.UUID) ([]models.UsersProduct, error) {
-	UserProducts := make([]models.UsersProduct, 0)
-	err := s.db.Model(&UserProducts).Where("User_id = ?", UserID).Select()
+	purchases, err := s.purchaseService.GetPurchasesByUserID(userID)
 	if err != nil {
-		return UserProducts, err
+		return &payloads.UserBuysReport{}, err
 	}
-	return UserProducts, nil
-}
 
-// CreateUserProduct creates a userProduct using the provided payload
-func (s *UserProductService) CreateUserProduct(ctx context.Context, createUserProduct *payloads.UserProductPurchase, userID uuid.UUID) (*payloads.UserBuysReport, error) {
-	var err error
-	s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
-		_, err = s.createUserProduct(tx, createUserProduct, userID)
-		return err
-	})
-	userReport := &payloads.UserBuysReport{UserID: userID}
-
-	return userReport, err
-}
-func (s *UserProductService) createUserProduct(dbSession *pg.Tx, createUserProduct *payloads.UserProductPurchase, userID uuid.UUID) (*models.UsersProduct, error) {
-	createdUserProduct := &models.UsersProduct{
-		UserID:    userID,
-		ProductID: createUserProduct.ProductID,
-		Amount:    createUserProduct.Amount,
-	}
-	if err := createUserProduct.Validate(); err != nil {
-		return createdUserProduct, err
+	products := make([]*models.Product, 0)
+	seenProducts := make(map[uuid.UUID]bool)
+	for _, purchase := range purchases {
+		userReport.AmountSpent += purchase.Total
+		userReport.AmountDiscounted += purchase.Discount
+		if purchase.Product != nil && !seenProducts[purchase.ProductID] {
+			seenProducts[purchase.ProductID] = true
+			products = append(products, purchase.Product)
+		}
 	}
-	_, err := dbSession.Model(createdUserProduct).OnConflict("(user_id, product_id) DO UPDATE").Insert()
+	userReport.Products = products
+	userReport.Purchases = purchases
+	userReport.Change, err = s.CreateChangeRepresentation(user.Deposit)
 	if err != nil {
-		return createdUserProduct, err
+		return &payloads.UserBuysReport{}, err
 	}
-	return createdUserProduct, nil
+
+	return userReport, nil
 }
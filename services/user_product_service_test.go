@@ -4,77 +4,83 @@ import (
 	"context"
 	"testing"
 
-	"github.com/brianvoe/gofakeit"
-	"github.com/dhurimkelmendi/vending_machine/fixtures"
+	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/change"
 	"github.com/dhurimkelmendi/vending_machine/payloads"
-	"github.com/dhurimkelmendi/vending_machine/services"
 )
 
 func TestUserProductService(t *testing.T) {
 	t.Parallel()
-	fixture := fixtures.GetFixturesDefaultInstance()
-	service := services.GetUserProductServiceDefaultInstance()
-	seller := fixture.User.CreateSellerUser(t)
-	buyer := fixture.User.CreateBuyerUser(t)
-	product := fixture.Product.CreateProduct(t, seller.ID)
+	a, fixture := newTestApp(t)
+	service := a.Services.UserProducts
+	userService := a.Services.Users
+	productService := a.Services.Products
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	sellerUserContext := auth.UserContext{
+		ID:   seller.ID,
+		Role: seller.Role,
+	}
 	ctx := context.Background()
 	t.Run("change representation", func(t *testing.T) {
 		t.Run("one of each coin", func(t *testing.T) {
-			expectedUserChange := &payloads.UserChange{
-				HundredCentCoins: 1,
-				FiftyCentCoins:   1,
-				TwentyCentCoins:  1,
-				TenCentCoins:     1,
-				FiveCentCoins:    1,
-			}
-			actualUserChange := service.CreateChangeRepresentation(185)
-			if !expectedUserChange.Equals(actualUserChange) {
-				t.Fatalf("charge representation generation failed, expected %+v, got %+v", expectedUserChange, actualUserChange)
+			expectedUserChange := change.Coins{100: 1, 50: 1, 20: 1, 10: 1, 5: 1}
+			actualUserChange, err := service.CreateChangeRepresentation(185)
+			if err != nil || !expectedUserChange.Equals(actualUserChange) {
+				t.Fatalf("charge representation generation failed, expected %+v, got %+v, %+v", expectedUserChange, actualUserChange, err)
 			}
 		})
 		t.Run("random number of each coin", func(t *testing.T) {
-			expectedUserChange := &payloads.UserChange{
-				HundredCentCoins: 5,
-				FiftyCentCoins:   1,
-				TwentyCentCoins:  1,
-				TenCentCoins:     1,
-				FiveCentCoins:    1,
-			}
-			actualUserChange := service.CreateChangeRepresentation(585)
-			if !expectedUserChange.Equals(actualUserChange) {
-				t.Fatalf("charge representation generation failed, expected %+v, got %+v", expectedUserChange, actualUserChange)
+			expectedUserChange := change.Coins{100: 5, 50: 1, 20: 1, 10: 1, 5: 1}
+			actualUserChange, err := service.CreateChangeRepresentation(585)
+			if err != nil || !expectedUserChange.Equals(actualUserChange) {
+				t.Fatalf("charge representation generation failed, expected %+v, got %+v, %+v", expectedUserChange, actualUserChange, err)
 			}
 		})
-	})
-	t.Run("create user_product", func(t *testing.T) {
-		t.Run("with all fields", func(t *testing.T) {
-			userProductToCreate := &payloads.UserProductPurchase{}
-			userProductToCreate.ProductID = product.ID
-			userProductToCreate.Amount = int32(gofakeit.Uint16())
-			_, err := service.CreateUserProduct(ctx, userProductToCreate, buyer.ID)
-			if err != nil {
-				t.Fatalf("error while creating userProduct %+v", err)
+		t.Run("more than one coin of a denomination below one hundred", func(t *testing.T) {
+			expectedUserChange := change.Coins{50: 1, 20: 2}
+			actualUserChange, err := service.CreateChangeRepresentation(90)
+			if err != nil || !expectedUserChange.Equals(actualUserChange) {
+				t.Fatalf("charge representation generation failed, expected %+v, got %+v, %+v", expectedUserChange, actualUserChange, err)
 			}
 		})
-		t.Run("without product_id", func(t *testing.T) {
-			userProductToCreate := &payloads.UserProductPurchase{}
-			userProductToCreate.Amount = int32(gofakeit.Uint16())
-			_, err := service.CreateUserProduct(ctx, userProductToCreate, buyer.ID)
-			if err == nil {
-				t.Fatal("expected create to fail without product_id, create was allowed")
-			}
-		})
-		t.Run("without amount", func(t *testing.T) {
-			userProductToCreate := &payloads.UserProductPurchase{}
-			userProductToCreate.ProductID = product.ID
-			_, err := service.CreateUserProduct(ctx, userProductToCreate, buyer.ID)
-			if err == nil {
-				t.Fatal("expected create to fail without amount, create was allowed")
+		t.Run("with a remainder", func(t *testing.T) {
+			if _, err := service.CreateChangeRepresentation(93); err == nil {
+				t.Fatal("expected change representation to fail for an amount with a remainder")
 			}
 		})
 	})
-
 	t.Run("get user report", func(t *testing.T) {
+		productPurchase := &payloads.UserProductPurchase{
+			MachineID: machine.ID,
+			ProductID: product.ID,
+			Amount:    1,
+		}
+		if _, err := userService.BuyProduct(ctx, productPurchase, buyer.ID); err != nil {
+			t.Fatalf("product purchase failed: %+v", err)
+		}
+		oldCost := product.Cost
+		productToUpdate := &payloads.UpdateProductPayload{}
+		productToUpdate.ID = product.ID
+		productToUpdate.Cost = oldCost + 5
+		if _, err := productService.UpdateProduct(ctx, productToUpdate, sellerUserContext); err != nil {
+			t.Fatalf("update product failed: %+v", err)
+		}
+
 		userReport, err := service.GetUserBuysReport(buyer.ID)
 		if err != nil {
 			t.Fatalf("generate user report failed: %+v", err)
@@ -82,34 +88,24 @@ func TestUserProductService(t *testing.T) {
 		if userReport.UserID != buyer.ID {
 			t.Fatalf("user report generated for wrong user, expected: %s, got %s", buyer.ID, userReport.UserID)
 		}
-		userProducts, err := service.GetAllUserProductsForUser(buyer.ID)
-		if err != nil {
-			t.Fatalf("error while getting user_products: %+v", err)
-		}
-
-		var productSpend int32
-		productSpend = 0
-		for _, userProduct := range userProducts {
-			if userProduct.ProductID == userProduct.ProductID {
-				productSpend = userProduct.Amount
-			}
+		if len(userReport.Purchases) != 1 {
+			t.Fatalf("expected user report to contain 1 purchase, got %d", len(userReport.Purchases))
 		}
-		totalSpendExpected := product.Cost * productSpend
-		if userReport.AmountSpent != totalSpendExpected {
-			t.Fatalf("user report generated wrong amount_spent, expected: %d, got %d", totalSpendExpected, userReport.AmountSpent)
+		if userReport.AmountSpent != oldCost {
+			t.Fatalf("user report generated wrong amount_spent, expected price at time of sale: %d, got %d", oldCost, userReport.AmountSpent)
 		}
 		productIsInList := false
 		for _, p := range userReport.Products {
-			if p.Equals(product) {
+			if p.ID == product.ID {
 				productIsInList = true
 			}
 		}
 		if !productIsInList {
 			t.Fatalf("user report generated wrong products list, expected it to contain: %+v, got %+v", product, userReport.Products)
 		}
-		change := buyer.Deposit - totalSpendExpected
-		expectedReportChange := service.CreateChangeRepresentation(change)
-		if !expectedReportChange.Equals(&userReport.Change) {
+		// the change was paid out with the purchase, so there is no deposit left to be returned
+		expectedReportChange := change.Coins{}
+		if !expectedReportChange.Equals(userReport.Change) {
 			t.Fatalf("user report generated wrong change report, expected it to contain: %+v, got %+v", expectedReportChange, userReport.Change)
 		}
 	})
@@ -1,56 +1,116 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"math"
+	"sort"
+	"time"
 
 	"github.com/dhurimkelmendi/vending_machine/auth"
+	"github.com/dhurimkelmendi/vending_machine/change"
+	"github.com/dhurimkelmendi/vending_machine/config"
 	"github.com/dhurimkelmendi/vending_machine/db"
 	"github.com/dhurimkelmendi/vending_machine/models"
 	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/promotion"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
 	"golang.org/x/crypto/bcrypt"
 
-	"github.com/go-pg/pg/v10"
 	uuid "github.com/satori/go.uuid"
 )
 
-// UserService is a struct that contains references to the db and the StatelessAuthenticationProvider
+// ErrInsufficientDeposit is returned when the deposit of a user is too low to pay for a purchase
+var ErrInsufficientDeposit = fmt.Errorf("unable to buy product amount, deposit too low")
+
+// ErrDepositHeldByAnotherMachine is returned when a user tries to use a machine while their coins are in another one
+var ErrDepositHeldByAnotherMachine = fmt.Errorf("deposit is held by another machine, reset it first")
+
+// ErrUserDisabled is returned when a disabled user tries to log in
+var ErrUserDisabled = fmt.Errorf("user is disabled")
+
+// ErrRefundWindowExpired is returned when a buyer refunds their purchase after the refund window
+var ErrRefundWindowExpired = fmt.Errorf("the refund window of the purchase has expired")
+
+// ErrPurchaseRefunded is returned when refunding a purchase that is already refunded completely
+var ErrPurchaseRefunded = fmt.Errorf("purchase is already refunded")
+
+// ErrRefundQuantity is returned when refunding more units than are left to refund of a purchase
+var ErrRefundQuantity = fmt.Errorf("quantity exceeds the units of the purchase that are not refunded yet")
+
+// ErrRefundNotRefundable is returned when refunding a refund entry of the ledger
+var ErrRefundNotRefundable = fmt.Errorf("a refund cannot be refunded")
+
+// ErrUserHasPurchases is returned when deleting a user who made or sold purchases, which are kept for the ledger
+var ErrUserHasPurchases = fmt.Errorf("user has purchases and cannot be deleted")
+
+// ErrPurchaseTransition is returned when a purchase cannot move from its vend status to the requested one
+var ErrPurchaseTransition = fmt.Errorf("purchase cannot move from its current status to the requested one")
+
+// ErrUnknownRole is returned when a user is given a role that has no permissions configured
+var ErrUnknownRole = fmt.Errorf("role is unknown")
+
+// UserService is a struct that contains references to the store, the permission policy and the services the buy flow goes through
 type UserService struct {
-	db                 *pg.DB
-	stateless          *auth.StatelessAuthenticationProvider
-	userProductService *UserProductService
-	productService     *ProductService
+	store                repositories.Store
+	userProductService   *UserProductService
+	productService       *ProductService
+	machineService       *MachineService
+	purchaseService      *PurchaseService
+	coinInventoryService *CoinInventoryService
+	promotionService     *PromotionService
+	accountService       *AccountService
+	tokenService         *TokenService
+	policy               *auth.Policy
+	refundWindow         time.Duration
+	vendReservationTTL   time.Duration
+	platformFeePercent   int32
+	// acceptableDepositAmountValues are the coins a deposit can be made of
+	acceptableDepositAmountValues []int32
 }
 
-var userServiceDefaultInstance *UserService
-
 // GetUserServiceDefaultInstance returns the default instance of UserService
 func GetUserServiceDefaultInstance() *UserService {
-	if userServiceDefaultInstance == nil {
-		userServiceDefaultInstance = &UserService{
-			db:                 db.GetDefaultInstance().GetDB(),
-			stateless:          auth.GetStatelessAuthenticationProviderDefaultInstance(),
-			userProductService: GetUserProductServiceDefaultInstance(),
-			productService:     GetProductServiceDefaultInstance(),
-		}
-	}
-
-	return userServiceDefaultInstance
+	return GetDefaultInstance().Users
 }
 
-// GetAllUsers returns all users
-func (s *UserService) GetAllUsers() (*payloads.UserList, error) {
-	return s.getAllUsers()
+// NewUserService creates a UserService keeping the users and purchases in the given store, with the refund window,
+// vend reservation TTL and platform fee of the config
+func NewUserService(store repositories.Store, policy *auth.Policy, cfg *config.Config,
+	userProductService *UserProductService, productService *ProductService, machineService *MachineService,
+	purchaseService *PurchaseService, coinInventoryService *CoinInventoryService, promotionService *PromotionService,
+	accountService *AccountService, tokenService *TokenService) *UserService {
+	return &UserService{
+		store:                store,
+		userProductService:   userProductService,
+		productService:       productService,
+		machineService:       machineService,
+		purchaseService:      purchaseService,
+		coinInventoryService: coinInventoryService,
+		promotionService:     promotionService,
+		accountService:       accountService,
+		tokenService:         tokenService,
+		policy:               policy,
+		refundWindow:         cfg.RefundWindow,
+		vendReservationTTL:   cfg.VendReservationTTL,
+		platformFeePercent:   cfg.PlatformFeePercent,
+
+		acceptableDepositAmountValues: cfg.AcceptableDepositAmountValues,
+	}
 }
-func (s *UserService) getAllUsers() (*payloads.UserList, error) {
-	users := make([]*models.User, 0)
 
-	err := s.db.Model(&users).Select()
+// GetAllUsers returns a page of the users matching the filter
+func (s *UserService) GetAllUsers(filter *payloads.UserFilter) (*payloads.UserList, error) {
+	return s.getAllUsers(s.store, filter)
+}
+func (s *UserService) getAllUsers(tx repositories.Session, filter *payloads.UserFilter) (*payloads.UserList, error) {
+	users, page, err := tx.Users().List(filter)
 	if err != nil {
 		return nil, err
 	}
 
-	userList := &payloads.UserList{}
+	userList := &payloads.UserList{Page: page}
 	userList.Users = make([]*payloads.UserDetails, len(users))
 
 	for i, user := range users {
@@ -62,30 +122,12 @@ func (s *UserService) getAllUsers() (*payloads.UserList, error) {
 
 // GetUserByID returns the requested user by id
 func (s *UserService) GetUserByID(userID uuid.UUID) (*models.User, error) {
-	return s.getUserByID(userID)
-}
-func (s *UserService) getUserByID(userID uuid.UUID) (*models.User, error) {
-	user := &models.User{}
-	switch err := s.db.Model(user).Where("id = ?", userID).Select(); err {
-	case pg.ErrNoRows:
-		return user, db.ErrNoMatch
-	default:
-		return user, err
-	}
+	return s.store.Users().GetByID(userID)
 }
 
 // GetUserByUsername returns the requested user by username
 func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
-	return s.getUserByUsername(username)
-}
-func (s *UserService) getUserByUsername(username string) (*models.User, error) {
-	user := &models.User{}
-	switch err := s.db.Model(user).Where("username = ?", username).Select(); err {
-	case pg.ErrNoRows:
-		return user, db.ErrNoMatch
-	default:
-		return user, err
-	}
+	return s.store.Users().GetByUsername(username)
 }
 
 // CreateUser creates a user using the provided payload
@@ -96,7 +138,7 @@ func (s *UserService) CreateUser(ctx context.Context, createUser *payloads.Creat
 	}
 
 	var err error
-	err = s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
 		user, err = s.createUser(tx, createUser)
 		return err
 	})
@@ -105,7 +147,7 @@ func (s *UserService) CreateUser(ctx context.Context, createUser *payloads.Creat
 	}
 	return user, err
 }
-func (s *UserService) createUser(dbSession *pg.Tx, createUser *payloads.CreateUserPayload) (*models.User, error) {
+func (s *UserService) createUser(tx repositories.Session, createUser *payloads.CreateUserPayload) (*models.User, error) {
 	user := createUser.ToUserModel()
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -113,37 +155,36 @@ func (s *UserService) createUser(dbSession *pg.Tx, createUser *payloads.CreateUs
 	}
 	user.Password = string(hashedPassword)
 	user.ID = uuid.NewV4()
-	_, err = dbSession.Model(user).Insert()
-	if err != nil {
+	if err := tx.Users().Insert(user); err != nil {
 		return user, err
 	}
-
-	// We need the user to be created (for their id) before we can create their auth token
-	user.Token, err = s.stateless.CreateUserAuthToken(user)
+	// the initial deposit of a user is not inserted into any machine
+	_, err = s.accountService.post(tx, models.JournalKindDeposit, uuid.Nil, "", transfer(int64(user.Deposit), externalAccount, buyerWallet(user.ID))...)
 	if err != nil {
 		return user, err
 	}
 
-	if _, err := dbSession.Model(user).Where("id = ?", user.ID).Update(); err != nil {
+	// We need the user to be created (for their id) before we can create their auth tokens
+	if err := s.tokenService.issueTokens(tx, user, createUser.Client); err != nil {
 		return user, err
 	}
 
 	return user, nil
 }
 
-// LoginUser creates a user using the provided payload
+// LoginUser checks the credentials in the provided payload and issues new auth tokens for the user
 func (s *UserService) LoginUser(ctx context.Context, loginUser *payloads.LoginUserPayload) (*models.User, error) {
 	var updatedUser *models.User
 	var err error
-	s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+	s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
 		updatedUser, err = s.loginUser(tx, loginUser)
 		return err
 	})
 
 	return updatedUser, err
 }
-func (s *UserService) loginUser(dbSession *pg.Tx, loginUser *payloads.LoginUserPayload) (*models.User, error) {
-	user, err := s.getUserByUsername(loginUser.Username)
+func (s *UserService) loginUser(tx repositories.Session, loginUser *payloads.LoginUserPayload) (*models.User, error) {
+	user, err := tx.Users().GetByUsername(loginUser.Username)
 	if err != nil {
 		return &models.User{}, fmt.Errorf("incorrect username or password")
 	}
@@ -151,6 +192,16 @@ func (s *UserService) loginUser(dbSession *pg.Tx, loginUser *payloads.LoginUserP
 	if user.Username != loginUser.Username || hashPasswordErr != nil {
 		return &models.User{}, fmt.Errorf("incorrect username or password")
 	}
+	if user.IsDisabled() {
+		return &models.User{}, ErrUserDisabled
+	}
+	user.HasActiveSession, err = s.tokenService.hasActiveSession(tx, user.ID)
+	if err != nil {
+		return &models.User{}, err
+	}
+	if err := s.tokenService.issueTokens(tx, user, loginUser.Client); err != nil {
+		return &models.User{}, err
+	}
 	return user, nil
 }
 
@@ -158,171 +209,665 @@ func (s *UserService) loginUser(dbSession *pg.Tx, loginUser *payloads.LoginUserP
 func (s *UserService) UpdateUser(ctx context.Context, updateUser *payloads.UpdateUserPayload) (*models.User, error) {
 	var updatedUser *models.User
 	var err error
-	s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+	s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
 		updatedUser, err = s.updateUser(tx, updateUser)
 		return err
 	})
 
 	return updatedUser, err
 }
-func (s *UserService) updateUser(dbSession *pg.Tx, updateUser *payloads.UpdateUserPayload) (*models.User, error) {
-	user := updateUser.ToUserModel()
-	existingUser, err := s.GetUserByID(user.ID)
+func (s *UserService) updateUser(tx repositories.Session, updateUser *payloads.UpdateUserPayload) (*models.User, error) {
+	// only the username is written, so that a deposit or purchase of the user committing meanwhile is kept
+	user, err := tx.Users().GetForUpdate(updateUser.ID)
 	if err != nil {
 		return &models.User{}, db.ErrNoMatch
 	}
+	if updateUser.Username == "" {
+		return user, nil
+	}
 
-	user.Merge(*existingUser)
-
-	if _, err := dbSession.Model(user).Where("id = ?", user.ID).Update(); err != nil {
-		if err == pg.ErrNoRows {
-			return user, db.ErrNoMatch
-		}
+	user.Username = updateUser.Username
+	if err := tx.Users().UpdateUsername(user); err != nil {
 		return user, err
 	}
 	return user, nil
 }
 
-// DepositMoney updates the user deposit by adding the specified amount
+// DepositMoney updates the user deposit by adding the specified amount, inserted as a single coin into the machine
 func (s *UserService) DepositMoney(ctx context.Context, depositMoney *payloads.DepositMoneyPayload, userID uuid.UUID) (*models.User, error) {
 	var updatedUser *models.User
-	if err := depositMoney.Validate(); err != nil {
+	if err := depositMoney.Validate(s.acceptableDepositAmountValues); err != nil {
 		return &models.User{}, err
 	}
 	var err error
-	s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+	s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
 		updatedUser, err = s.depositMoney(tx, depositMoney, userID)
 		return err
 	})
 
 	return updatedUser, err
 }
-func (s *UserService) depositMoney(dbSession *pg.Tx, depositMoney *payloads.DepositMoneyPayload, userID uuid.UUID) (*models.User, error) {
-	user, err := s.GetUserByID(userID)
+func (s *UserService) depositMoney(tx repositories.Session, depositMoney *payloads.DepositMoneyPayload, userID uuid.UUID) (*models.User, error) {
+	user, err := tx.Users().GetForUpdate(userID)
 	if err != nil {
 		return &models.User{}, db.ErrNoMatch
 	}
-	if user.Role != models.UserRoleBuyer {
+	if !s.policy.Allows(user.Role, auth.PermDepositWrite) {
 		return &models.User{}, db.ErrUserForbidden
 	}
+	if user.Deposit > 0 && user.MachineID != uuid.Nil && user.MachineID != depositMoney.MachineID {
+		return &models.User{}, ErrDepositHeldByAnotherMachine
+	}
+	if _, err := selectMachine(tx, depositMoney.MachineID); err != nil {
+		return &models.User{}, err
+	}
 	user.Deposit += depositMoney.DepositAmount
-	if _, err := dbSession.Model(user).Where("id = ?", user.ID).Update(); err != nil {
-		if err == pg.ErrNoRows {
-			return user, db.ErrNoMatch
-		}
+	user.MachineID = depositMoney.MachineID
+	if err := tx.Users().UpdateDeposit(user); err != nil {
+		return user, err
+	}
+	if err := tx.Coins().Add(depositMoney.MachineID, depositMoney.DepositAmount, 1); err != nil {
+		return user, err
+	}
+	_, err = s.accountService.post(tx, models.JournalKindDeposit, uuid.Nil, "", transfer(int64(depositMoney.DepositAmount), machineCash(depositMoney.MachineID), buyerWallet(user.ID))...)
+	if err != nil {
 		return user, err
 	}
 	return user, nil
 }
 
-// ResetDeposit resets the user deposit
+// ResetDeposit resets the user deposit, paying it out in coins from the machine holding it.
+// A deposit that was never inserted into a machine is cleared without paying out coins
 func (s *UserService) ResetDeposit(ctx context.Context, userID uuid.UUID) (*models.User, error) {
 	var updatedUser *models.User
 
 	var err error
-	s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+	s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
 		updatedUser, err = s.resetDeposit(tx, userID)
 		return err
 	})
 
 	return updatedUser, err
 }
-func (s *UserService) resetDeposit(dbSession *pg.Tx, userID uuid.UUID) (*models.User, error) {
-	user, err := s.GetUserByID(userID)
+func (s *UserService) resetDeposit(tx repositories.Session, userID uuid.UUID) (*models.User, error) {
+	user, err := tx.Users().GetForUpdate(userID)
 	if err != nil {
 		return &models.User{}, db.ErrNoMatch
 	}
-	user.Deposit = 0
-	if _, err := dbSession.Model(user).Where("id = ?", user.ID).Update(); err != nil {
-		if err == pg.ErrNoRows {
-			return user, db.ErrNoMatch
+	paidFrom := externalAccount
+	if user.MachineID != uuid.Nil {
+		if _, err := s.coinInventoryService.dispenseChange(tx, user.MachineID, user.Deposit); err != nil {
+			return &models.User{}, err
 		}
+		paidFrom = machineCash(user.MachineID)
+	}
+	if _, err := s.accountService.post(tx, models.JournalKindWithdrawal, uuid.Nil, "", transfer(int64(user.Deposit), buyerWallet(user.ID), paidFrom)...); err != nil {
+		return &models.User{}, err
+	}
+	user.Deposit = 0
+	user.MachineID = uuid.Nil
+	if err := tx.Users().UpdateDeposit(user); err != nil {
 		return user, err
 	}
 	return user, nil
 }
 
-// DeleteUser deletes the user by id
-func (s *UserService) DeleteUser(ctx context.Context, userID uuid.UUID) error {
-	return s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+// DeleteUser deletes the user by id, the user needs `user:write:own` to delete themselves
+// or `user:write:any` to delete any user. Users who made or sold purchases cannot be deleted, ErrUserHasPurchases is
+// returned for them, so that the ledger keeps its history
+func (s *UserService) DeleteUser(ctx context.Context, userID uuid.UUID, userContext auth.UserContext) error {
+	if err := s.policy.Authorize(userContext, auth.PermUserWrite, userID); err != nil {
+		return err
+	}
+	return s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
 		return s.deleteUser(tx, userID)
 	})
 }
-func (s *UserService) deleteUser(dbSession *pg.Tx, userID uuid.UUID) error {
-	user := &models.User{ID: userID}
-
-	result, err := dbSession.Model(user).WherePK().Delete()
+func (s *UserService) deleteUser(tx repositories.Session, userID uuid.UUID) error {
+	if err := tx.Users().Delete(userID); err != nil {
+		if err == repositories.ErrReferenced {
+			return ErrUserHasPurchases
+		}
+		return err
+	}
+	return nil
+}
 
+// SetUserDisabled disables or enables the user by id. Disabling a user ends all of their sessions
+func (s *UserService) SetUserDisabled(ctx context.Context, userID uuid.UUID, disabled bool) (*models.User, error) {
+	var user *models.User
+	err := s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		var err error
+		user, err = s.setUserDisabled(tx, userID, disabled)
+		return err
+	})
 	if err != nil {
-		switch err {
-		case pg.ErrNoRows:
-			return db.ErrNoMatch
-		default:
-			return err
-		}
+		return &models.User{}, err
+	}
+	return user, nil
+}
+func (s *UserService) setUserDisabled(tx repositories.Session, userID uuid.UUID, disabled bool) (*models.User, error) {
+	user, err := tx.Users().GetForUpdate(userID)
+	if err != nil {
+		return user, err
+	}
+
+	if !disabled {
+		return user, tx.Users().SetDisabledAt(user, nil)
+	}
+	if user.IsDisabled() {
+		return user, nil
+	}
+	now := time.Now()
+	if err := tx.Users().SetDisabledAt(user, &now); err != nil {
+		return user, err
 	}
+	if err := tx.Sessions().EndAll(userID, ""); err != nil {
+		return user, err
+	}
+	return user, nil
+}
 
-	if result.RowsAffected() == 0 {
-		err = db.ErrNoMatch
+// UpdateUserRole changes the role of the user by id to one of the roles known to the policy. All sessions of
+// the user are ended, as their access tokens carry the previous role
+func (s *UserService) UpdateUserRole(ctx context.Context, userID uuid.UUID, updateRole *payloads.UpdateUserRolePayload) (*models.User, error) {
+	user := &models.User{}
+	if err := updateRole.Validate(); err != nil {
+		return user, err
+	}
+	if !s.policy.HasRole(updateRole.Role) {
+		return user, ErrUnknownRole
+	}
+	err := s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		var err error
+		user, err = s.updateUserRole(tx, userID, updateRole.Role)
+		return err
+	})
+	if err != nil {
+		return &models.User{}, err
+	}
+	return user, nil
+}
+func (s *UserService) updateUserRole(tx repositories.Session, userID uuid.UUID, role models.UserRole) (*models.User, error) {
+	user, err := tx.Users().GetForUpdate(userID)
+	if err != nil {
+		return user, err
+	}
+	if user.Role == role {
+		return user, nil
 	}
 
-	return err
+	user.Role = role
+	if err := tx.Users().UpdateRole(user); err != nil {
+		return user, err
+	}
+	if err := tx.Sessions().EndAll(userID, ""); err != nil {
+		return user, err
+	}
+	return user, nil
 }
 
-// BuyProduct links a product to the given user
+// BuyProduct takes the product from the slots of the machine, records the purchase in the purchases ledger
+// and pays out the remaining deposit as change from the coins of the machine. The purchase stays reserved until the
+// machine confirms or fails its vend. The user, product, slot and coin
+// inventory rows are locked for the whole purchase, so concurrent purchases can neither oversell stock nor overspend
+// a deposit
 func (s *UserService) BuyProduct(ctx context.Context, createUserProduct *payloads.UserProductPurchase, userID uuid.UUID) (*payloads.UserBuysReport, error) {
-	var userReport *payloads.UserBuysReport
+	var dispensedCoins change.Coins
+	var err error
+	s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		_, dispensedCoins, err = s.buyProduct(tx, createUserProduct, userID)
+		return err
+	})
+	if err != nil {
+		return &payloads.UserBuysReport{}, err
+	}
+
+	// The report is read from the ledger, so it can only be generated once the purchase is committed
+	userReport, err := s.userProductService.GetUserBuysReport(userID)
+	if err != nil {
+		return userReport, err
+	}
+	userReport.Change = dispensedCoins
+	return userReport, nil
+}
+func (s *UserService) buyProduct(tx repositories.Session, createUserProduct *payloads.UserProductPurchase, userID uuid.UUID) (*models.Purchase, change.Coins, error) {
+	if err := createUserProduct.Validate(); err != nil {
+		return &models.Purchase{}, change.Coins{}, err
+	}
 
+	checkout := &payloads.CheckoutPayload{
+		MachineID: createUserProduct.MachineID,
+		Items:     []*payloads.CheckoutItem{{ProductID: createUserProduct.ProductID, Amount: createUserProduct.Amount}},
+		RequestID: createUserProduct.RequestID,
+	}
+	receipt, err := s.checkout(tx, checkout, userID)
+	if err != nil {
+		return &models.Purchase{}, change.Coins{}, err
+	}
+	return receipt.Lines[0], receipt.Change, nil
+}
+
+// Checkout buys all items of the checkout from the machine in one transaction, either every item is reserved or
+// none is. The items are priced together, so a promotion can apply to several of them, and the remaining deposit is
+// paid out once as change. The receipt lists a purchase for every item, each reserved until its vend is confirmed
+func (s *UserService) Checkout(ctx context.Context, checkout *payloads.CheckoutPayload, userID uuid.UUID) (*payloads.CheckoutReceipt, error) {
+	receipt := &payloads.CheckoutReceipt{}
 	var err error
-	s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
-		userReport, err = s.buyProduct(ctx, tx, createUserProduct, userID)
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		receipt, err = s.checkout(tx, checkout, userID)
 		return err
 	})
+	if err != nil {
+		return &payloads.CheckoutReceipt{}, err
+	}
+	return receipt, nil
+}
+func (s *UserService) checkout(tx repositories.Session, checkout *payloads.CheckoutPayload, userID uuid.UUID) (*payloads.CheckoutReceipt, error) {
+	if err := checkout.Validate(); err != nil {
+		return &payloads.CheckoutReceipt{}, err
+	}
 
-	return userReport, err
+	// rows are always locked in the order user, product, slots, coin inventory to avoid deadlocks
+	user, err := tx.Users().GetForUpdate(userID)
+	if err != nil {
+		return &payloads.CheckoutReceipt{}, db.ErrNoMatch
+	}
+	if user.MachineID != uuid.Nil && user.MachineID != checkout.MachineID {
+		return &payloads.CheckoutReceipt{}, ErrDepositHeldByAnotherMachine
+	}
+
+	// lock the products, and below their slots, ordered by id, so concurrent checkouts cannot deadlock
+	order := make([]int, len(checkout.Items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return bytes.Compare(checkout.Items[order[a]].ProductID.Bytes(), checkout.Items[order[b]].ProductID.Bytes()) < 0
+	})
+	products := make([]*models.Product, len(checkout.Items))
+	for _, i := range order {
+		products[i], err = s.productService.getProductForUpdate(tx, checkout.Items[i].ProductID)
+		if err != nil {
+			return &payloads.CheckoutReceipt{}, db.ErrNoMatch
+		}
+	}
+
+	items := make([]promotion.Item, len(checkout.Items))
+	for i, item := range checkout.Items {
+		items[i] = promotion.Item{ProductID: item.ProductID, Quantity: item.Amount, UnitPrice: products[i].Cost}
+	}
+	discount, err := s.promotionService.bestDiscount(tx, items, time.Now())
+	if err != nil {
+		return &payloads.CheckoutReceipt{}, err
+	}
+
+	// compare in 64 bits, so large amounts cannot overflow into an affordable price
+	var amountToBeSpent int64
+	for _, item := range items {
+		amountToBeSpent += item.Price()
+	}
+	amountToBeSpent -= discount.Total
+	if int64(user.Deposit) < amountToBeSpent {
+		return &payloads.CheckoutReceipt{}, ErrInsufficientDeposit
+	}
+	for _, i := range order {
+		if err := s.machineService.dispenseProduct(tx, checkout.MachineID, products[i].ID, checkout.Items[i].Amount); err != nil {
+			return &payloads.CheckoutReceipt{}, err
+		}
+	}
+
+	changeAmount := user.Deposit - int32(amountToBeSpent)
+	dispensedCoins, err := s.coinInventoryService.dispenseChange(tx, checkout.MachineID, changeAmount)
+	if err != nil {
+		return &payloads.CheckoutReceipt{}, err
+	}
+
+	user.Deposit = 0
+	user.MachineID = uuid.Nil
+	if err := tx.Users().UpdateDeposit(user); err != nil {
+		return &payloads.CheckoutReceipt{}, err
+	}
+
+	receipt := &payloads.CheckoutReceipt{
+		CheckoutID:     uuid.NewV4(),
+		UserID:         user.ID,
+		MachineID:      checkout.MachineID,
+		Lines:          make([]*models.Purchase, 0, len(items)),
+		PromotionID:    discount.PromotionID,
+		ChangeReturned: changeAmount,
+		Change:         dispensedCoins,
+	}
+	for i, item := range items {
+		purchase := &models.Purchase{
+			UserID:        user.ID,
+			ProductID:     item.ProductID,
+			SellerID:      products[i].SellerID,
+			MachineID:     checkout.MachineID,
+			Quantity:      item.Quantity,
+			UnitPrice:     item.UnitPrice,
+			OriginalPrice: int32(item.Price()),
+			Discount:      discount.Items[i],
+			Total:         int32(item.Price()) - discount.Items[i],
+			RequestID:     checkout.RequestID,
+			CheckoutID:    receipt.CheckoutID,
+			Status:        models.PurchaseStatusReserved,
+		}
+		purchase.PlatformFee = int32(int64(purchase.Total) * int64(s.platformFeePercent) / 100)
+		if purchase.Discount > 0 {
+			purchase.PromotionID = discount.PromotionID
+		}
+		if i == len(items)-1 {
+			purchase.ChangeReturned = changeAmount
+		}
+		if purchase, err = s.purchaseService.createPurchase(tx, purchase); err != nil {
+			return &payloads.CheckoutReceipt{}, err
+		}
+
+		receipt.Lines = append(receipt.Lines, purchase)
+		receipt.OriginalPrice += purchase.OriginalPrice
+		receipt.Discount += purchase.Discount
+		receipt.Total += purchase.Total
+	}
+
+	// the buyer pays the sellers and the platform fee from their wallet, the change leaves the cash box of the machine
+	if _, err := s.accountService.post(tx, models.JournalKindPurchase, receipt.CheckoutID, checkout.RequestID, salePostings(user.ID, receipt.Lines)...); err != nil {
+		return &payloads.CheckoutReceipt{}, err
+	}
+	_, err = s.accountService.post(tx, models.JournalKindChange, receipt.CheckoutID, checkout.RequestID, transfer(int64(changeAmount), buyerWallet(user.ID), machineCash(checkout.MachineID))...)
+	if err != nil {
+		return &payloads.CheckoutReceipt{}, err
+	}
+	return receipt, nil
 }
-func (s *UserService) buyProduct(ctx context.Context, dbSession *pg.Tx, createUserProduct *payloads.UserProductPurchase, userID uuid.UUID) (*payloads.UserBuysReport, error) {
-	userReport := &payloads.UserBuysReport{}
 
-	user := &models.User{ID: userID}
-	user, err := s.GetUserByID(user.ID)
+// RefundPurchase reverses the purchase by id, or the given quantity of it, for instance when the machine failed to
+// vend. The units go back into the slots of the machine and the amount paid is credited to the deposit of the buyer,
+// unless their deposit is held by another machine, then it is recorded as change owed. The buyer can refund their
+// purchase within the refund window with `purchase:refund:own`, the seller of the product with `sale:refund` and
+// users with `purchase:refund:any` can refund it at any time
+func (s *UserService) RefundPurchase(ctx context.Context, purchaseID uuid.UUID, refund *payloads.RefundPurchasePayload, userContext auth.UserContext) (*payloads.RefundReceipt, error) {
+	receipt := &payloads.RefundReceipt{}
+	if err := refund.Validate(); err != nil {
+		return receipt, err
+	}
+	var err error
+	err = s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		receipt, err = s.refundPurchase(tx, purchaseID, refund, userContext)
+		return err
+	})
 	if err != nil {
-		return userReport, db.ErrNoMatch
+		return &payloads.RefundReceipt{}, err
+	}
+	return receipt, nil
+}
+func (s *UserService) refundPurchase(tx repositories.Session, purchaseID uuid.UUID, refund *payloads.RefundPurchasePayload, userContext auth.UserContext) (*payloads.RefundReceipt, error) {
+	purchase, err := tx.Purchases().GetByID(purchaseID)
+	if err != nil {
+		return &payloads.RefundReceipt{}, err
+	}
+	if err := s.authorizeRefund(purchase, userContext); err != nil {
+		return &payloads.RefundReceipt{}, err
+	}
+	if purchase.IsRefund() {
+		return &payloads.RefundReceipt{}, ErrRefundNotRefundable
 	}
 
-	product, err := s.productService.GetProductByID(createUserProduct.ProductID)
+	// lock the buyer before the purchase, as purchases lock the buyer first, the purchase lock serializes its refunds
+	user, err := tx.Users().GetForUpdate(purchase.UserID)
 	if err != nil {
-		return userReport, db.ErrNoMatch
+		return &payloads.RefundReceipt{}, err
 	}
+	if purchase, err = tx.Purchases().GetForUpdate(purchase.ID); err != nil {
+		return &payloads.RefundReceipt{}, err
+	}
+	return s.reversePurchase(tx, user, purchase, int64(refund.Quantity), refund.RequestID, refund.Reason)
+}
 
-	if product.AmountAvailable < createUserProduct.Amount {
-		return userReport, fmt.Errorf("insufficient product amount")
+// reversePurchase records the refund of the quantity of the purchase, or of everything not refunded yet when the
+// quantity is zero. The buyer and the purchase must be locked by the transaction
+func (s *UserService) reversePurchase(tx repositories.Session, user *models.User, purchase *models.Purchase, quantity int64, requestID string, reason string) (*payloads.RefundReceipt, error) {
+	refunded, err := tx.Purchases().RefundedAmounts(purchase.ID)
+	if err != nil {
+		return &payloads.RefundReceipt{}, err
+	}
+	remaining := int64(purchase.Quantity) - refunded.Quantity
+	if remaining <= 0 {
+		return &payloads.RefundReceipt{}, ErrPurchaseRefunded
+	}
+	if quantity == 0 {
+		quantity = remaining
+	}
+	if quantity > remaining {
+		return &payloads.RefundReceipt{}, ErrRefundQuantity
 	}
 
-	amountToBeSpent := product.Cost * createUserProduct.Amount
-	if user.Deposit < amountToBeSpent {
-		return userReport, fmt.Errorf("unable to buy product amount, deposit too low")
+	// partial refunds are rounded down, the last refund returns what is left, so the refunds add up to the purchase
+	originalPrice := int64(purchase.OriginalPrice) * quantity / int64(purchase.Quantity)
+	total := int64(purchase.Total) * quantity / int64(purchase.Quantity)
+	fee := int64(purchase.PlatformFee) * quantity / int64(purchase.Quantity)
+	if quantity == remaining {
+		originalPrice = int64(purchase.OriginalPrice) - refunded.OriginalPrice
+		total = int64(purchase.Total) - refunded.Total
+		fee = int64(purchase.PlatformFee) - refunded.PlatformFee
 	}
-	if _, err = s.userProductService.CreateUserProduct(ctx, createUserProduct, userID); err != nil {
-		return userReport, err
+
+	restocked, err := s.machineService.restockProduct(tx, purchase.MachineID, purchase.ProductID, int32(quantity))
+	if err != nil {
+		return &payloads.RefundReceipt{}, err
 	}
-	user.Deposit -= amountToBeSpent
-	if _, err := dbSession.Model(user).Where("id = ?", user.ID).Update(); err != nil {
-		if err == pg.ErrNoRows {
-			return userReport, db.ErrNoMatch
+
+	var owed int64
+	heldByAnotherMachine := user.MachineID != uuid.Nil && user.MachineID != purchase.MachineID
+	if heldByAnotherMachine || int64(user.Deposit)+total > math.MaxInt32 {
+		owed = total
+	} else if total > 0 {
+		// the coins paid for the purchase are still in its machine, so they become the deposit held by it
+		user.Deposit += int32(total)
+		user.MachineID = purchase.MachineID
+		if err := tx.Users().UpdateDeposit(user); err != nil {
+			return &payloads.RefundReceipt{}, err
 		}
-		return userReport, err
 	}
-	product.AmountAvailable -= createUserProduct.Amount
-	productForUpdate := &payloads.UpdateProductPayload{}
-	productForUpdate.AmountAvailable = product.AmountAvailable
-	productForUpdate.ID = product.ID
-	if _, err := s.productService.updateProduct(dbSession, productForUpdate); err != nil {
-		return userReport, err
+
+	refundEntry := &models.Purchase{
+		UserID:        purchase.UserID,
+		ProductID:     purchase.ProductID,
+		SellerID:      purchase.SellerID,
+		MachineID:     purchase.MachineID,
+		Quantity:      -int32(quantity),
+		UnitPrice:     purchase.UnitPrice,
+		OriginalPrice: -int32(originalPrice),
+		Discount:      -int32(originalPrice - total),
+		PromotionID:   purchase.PromotionID,
+		Total:         -int32(total),
+		PlatformFee:   -int32(fee),
+		RequestID:     requestID,
+		RefundOf:      purchase.ID,
+		ChangeOwed:    int32(owed),
+		Reason:        reason,
+		Status:        models.PurchaseStatusCompleted,
 	}
-	userReport, err = s.userProductService.GetUserBuysReport(user.ID)
+	if refundEntry, err = s.purchaseService.createPurchase(tx, refundEntry); err != nil {
+		return &payloads.RefundReceipt{}, err
+	}
+	_, err = s.accountService.post(tx, models.JournalKindRefund, refundEntry.ID, requestID,
+		posting{account: sellerRevenue(purchase.SellerID), amount: total - fee},
+		posting{account: platformFeeAccount, amount: fee},
+		posting{account: buyerWallet(purchase.UserID), amount: -(total - owed)},
+		posting{account: changeOwed(purchase.UserID), amount: -owed},
+	)
 	if err != nil {
-		return userReport, err
+		return &payloads.RefundReceipt{}, err
+	}
+	return &payloads.RefundReceipt{
+		Purchase:        purchase,
+		Refund:          refundEntry,
+		Restocked:       restocked,
+		DepositCredited: int32(total - owed),
+	}, nil
+}
+
+// authorizeRefund returns db.ErrUserForbidden unless the user may refund the purchase, or ErrRefundWindowExpired
+// when the buyer may only refund it within the refund window and it has passed
+func (s *UserService) authorizeRefund(purchase *models.Purchase, userContext auth.UserContext) error {
+	switch {
+	case s.policy.Allows(userContext.Role, auth.PermPurchaseRefund.Any()):
+		return nil
+	case purchase.SellerID == userContext.ID && s.policy.Allows(userContext.Role, auth.PermSaleRefund):
+		return nil
+	case purchase.UserID == userContext.ID && s.policy.Allows(userContext.Role, auth.PermPurchaseRefund.Own()):
+		if time.Since(purchase.CreatedAt) > s.refundWindow {
+			return ErrRefundWindowExpired
+		}
+		return nil
+	default:
+		return db.ErrUserForbidden
+	}
+}
+
+// expiredReservationsBatch is the largest number of stale reservations failed by one run of ExpireReservations
+const expiredReservationsBatch = 100
+
+// DispensePurchase records that the machine started to vend the reserved purchase by id. The user needs
+// `purchase:vend:own` for purchases from the machines they operate or `purchase:vend:any` for purchases from any machine
+func (s *UserService) DispensePurchase(ctx context.Context, purchaseID uuid.UUID, userContext auth.UserContext) (*models.Purchase, error) {
+	return s.transitionPurchase(ctx, purchaseID, models.PurchaseStatusDispensing, userContext)
+}
+
+// ConfirmPurchase records that the machine vended the purchase by id, which completes it
+func (s *UserService) ConfirmPurchase(ctx context.Context, purchaseID uuid.UUID, userContext auth.UserContext) (*models.Purchase, error) {
+	return s.transitionPurchase(ctx, purchaseID, models.PurchaseStatusCompleted, userContext)
+}
+func (s *UserService) transitionPurchase(ctx context.Context, purchaseID uuid.UUID, status models.PurchaseStatus, userContext auth.UserContext) (*models.Purchase, error) {
+	purchase := &models.Purchase{}
+	err := s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		var err error
+		if purchase, err = s.getPurchaseToVend(tx, purchaseID, userContext); err != nil {
+			return err
+		}
+		if purchase, err = tx.Purchases().GetForUpdate(purchaseID); err != nil {
+			return err
+		}
+		if !purchase.Status.CanTransitionTo(status) {
+			return ErrPurchaseTransition
+		}
+		// a purchase refunded completely gave its units back to the slot and its money back to the buyer,
+		// so the machine must not vend it anymore
+		refunded, err := tx.Purchases().RefundedAmounts(purchase.ID)
+		if err != nil {
+			return err
+		}
+		if refunded.Quantity >= int64(purchase.Quantity) {
+			return ErrPurchaseRefunded
+		}
+		return s.setPurchaseStatus(tx, purchase, status)
+	})
+	if err != nil {
+		return &models.Purchase{}, err
+	}
+	return purchase, nil
+}
+
+// FailPurchase records that the machine could not vend the purchase by id. Everything of the purchase that was not
+// refunded yet is reversed, the units go back into the slots and the amount paid is credited to the buyer like a refund
+func (s *UserService) FailPurchase(ctx context.Context, purchaseID uuid.UUID, failure *payloads.FailPurchasePayload, userContext auth.UserContext) (*payloads.RefundReceipt, error) {
+	receipt := &payloads.RefundReceipt{}
+	if err := failure.Validate(); err != nil {
+		return receipt, err
+	}
+	err := s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+		purchase, err := s.getPurchaseToVend(tx, purchaseID, userContext)
+		if err != nil {
+			return err
+		}
+		receipt, err = s.failPurchase(tx, purchase, failure.RequestID, failure.Reason)
+		return err
+	})
+	if err != nil {
+		return &payloads.RefundReceipt{}, err
+	}
+	return receipt, nil
+}
+
+// ExpireReservations fails the purchases that stayed reserved for longer than the vend reservation TTL, returning
+// their stock and money, and returns the number of failed purchases
+func (s *UserService) ExpireReservations(ctx context.Context) (int, error) {
+	purchases, err := s.store.Purchases().ListReserved(time.Now().Add(-s.vendReservationTTL), expiredReservationsBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, purchase := range purchases {
+		err := s.store.RunInTransaction(ctx, func(tx repositories.Session) error {
+			_, err := s.failPurchase(tx, purchase, "", "vend reservation expired")
+			return err
+		})
+		switch err {
+		case nil:
+			expired++
+		case ErrPurchaseTransition:
+			// the machine started to vend the purchase since it was selected
+		default:
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// failPurchase fails the purchase and reverses what is left of it, locking the buyer before the purchase like refunds
+func (s *UserService) failPurchase(tx repositories.Session, purchase *models.Purchase, requestID string, reason string) (*payloads.RefundReceipt, error) {
+	user, err := tx.Users().GetForUpdate(purchase.UserID)
+	if err != nil {
+		return &payloads.RefundReceipt{}, err
+	}
+	locked, err := tx.Purchases().GetForUpdate(purchase.ID)
+	if err != nil {
+		return &payloads.RefundReceipt{}, err
+	}
+	*purchase = *locked
+	if !purchase.Status.CanTransitionTo(models.PurchaseStatusFailed) {
+		return &payloads.RefundReceipt{}, ErrPurchaseTransition
+	}
+
+	receipt, err := s.reversePurchase(tx, user, purchase, 0, requestID, reason)
+	switch err {
+	case nil:
+	case ErrPurchaseRefunded:
+		// the buyer got everything back already, so only the status is left to record
+		receipt = &payloads.RefundReceipt{Purchase: purchase}
+	default:
+		return &payloads.RefundReceipt{}, err
+	}
+	if err := s.setPurchaseStatus(tx, purchase, models.PurchaseStatusFailed); err != nil {
+		return &payloads.RefundReceipt{}, err
+	}
+	return receipt, nil
+}
+
+// getPurchaseToVend returns the purchase by id, or db.ErrUserForbidden unless the user may report the vends of
+// its machine
+func (s *UserService) getPurchaseToVend(tx repositories.Session, purchaseID uuid.UUID, userContext auth.UserContext) (*models.Purchase, error) {
+	purchase, err := tx.Purchases().GetByID(purchaseID)
+	if err != nil {
+		return purchase, err
+	}
+	machine, err := selectMachine(tx, purchase.MachineID)
+	if err != nil {
+		return purchase, err
+	}
+	if err := s.policy.Authorize(userContext, auth.PermPurchaseVend, machine.OwnerFor(userContext.ID)); err != nil {
+		return purchase, err
+	}
+	return purchase, nil
+}
+
+// setPurchaseStatus moves the purchase on to the status, or returns ErrPurchaseTransition if its current status
+// does not allow it. The purchase must be locked by the transaction
+func (s *UserService) setPurchaseStatus(tx repositories.Session, purchase *models.Purchase, status models.PurchaseStatus) error {
+	if !purchase.Status.CanTransitionTo(status) {
+		return ErrPurchaseTransition
 	}
-	return userReport, err
+	return tx.Purchases().SetStatus(purchase, status)
 }
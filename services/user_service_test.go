@@ -5,26 +5,44 @@ import (
 	"fmt"
 	"math/rand"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/brianvoe/gofakeit"
+	"github.com/dhurimkelmendi/vending_machine/auth"
 	"github.com/dhurimkelmendi/vending_machine/config"
-	"github.com/dhurimkelmendi/vending_machine/fixtures"
+	"github.com/dhurimkelmendi/vending_machine/db"
+	"github.com/dhurimkelmendi/vending_machine/internal/dbtest"
 	"github.com/dhurimkelmendi/vending_machine/models"
 	"github.com/dhurimkelmendi/vending_machine/payloads"
+	"github.com/dhurimkelmendi/vending_machine/repositories"
 	"github.com/dhurimkelmendi/vending_machine/services"
 	uuid "github.com/satori/go.uuid"
 )
 
 func TestUserService(t *testing.T) {
 	t.Parallel()
-	fixture := fixtures.GetFixturesDefaultInstance()
+	a, fixture := newTestApp(t)
 
-	service := services.GetUserServiceDefaultInstance()
-	seller := fixture.User.CreateSellerUser(t)
-	buyer := fixture.User.CreateBuyerUser(t)
-	product := fixture.Product.CreateProduct(t, seller.ID)
-	acceptableDepositAmountValues := config.GetDefaultInstance().AcceptableDepositAmountValues
+	service := a.Services.Users
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	buyer, err := fixture.User.CreateBuyerUser()
+	if err != nil {
+		t.Fatalf("could not create buyer: %+v", err)
+	}
+	product, err := fixture.Product.CreateProduct(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create product: %+v", err)
+	}
+	machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+	if err != nil {
+		t.Fatalf("could not create stocked machine: %+v", err)
+	}
+	acceptableDepositAmountValues := a.Config.AcceptableDepositAmountValues
 
 	ctx := context.Background()
 
@@ -136,14 +154,36 @@ func TestUserService(t *testing.T) {
 	})
 
 	t.Run("get all users", func(t *testing.T) {
-		_, err := service.GetAllUsers()
-		if err != nil {
-			t.Fatalf("could not retreive users: %+v", err)
-		}
+		t.Run("by username", func(t *testing.T) {
+			userList, err := service.GetAllUsers(&payloads.UserFilter{
+				ListParams: payloads.ListParams{Limit: 10},
+				Username:   strings.ToUpper(buyer.Username),
+			})
+			if err != nil {
+				t.Fatalf("could not retreive users: %+v", err)
+			}
+			if userList.Total != 1 || userList.Users[0].ID != buyer.ID {
+				t.Fatalf("expected only user %s, got: %+v", buyer.ID, userList.Users)
+			}
+		})
+		t.Run("by role", func(t *testing.T) {
+			userList, err := service.GetAllUsers(&payloads.UserFilter{
+				ListParams: payloads.ListParams{Limit: 5, Sort: "-username"},
+				Role:       models.UserRoleSeller,
+			})
+			if err != nil {
+				t.Fatalf("could not retreive users: %+v", err)
+			}
+			for _, user := range userList.Users {
+				if user.Role != models.UserRoleSeller {
+					t.Fatalf("expected sellers only, got: %+v", user)
+				}
+			}
+		})
 	})
 	t.Run("deposit money", func(t *testing.T) {
 		t.Run("as seller", func(t *testing.T) {
-			userToUpdate := &payloads.DepositMoneyPayload{}
+			userToUpdate := &payloads.DepositMoneyPayload{MachineID: machine.ID}
 			newDepositAmount := acceptableDepositAmountValues[rand.Intn(len(acceptableDepositAmountValues))]
 			userToUpdate.DepositAmount = newDepositAmount
 			_, err := service.DepositMoney(ctx, userToUpdate, seller.ID)
@@ -153,7 +193,7 @@ func TestUserService(t *testing.T) {
 		})
 		t.Run("as buyer", func(t *testing.T) {
 			t.Run("deposit unacceptable amount", func(t *testing.T) {
-				userToUpdate := &payloads.DepositMoneyPayload{}
+				userToUpdate := &payloads.DepositMoneyPayload{MachineID: machine.ID}
 				newDepositAmount := int32(123)
 				userToUpdate.DepositAmount = newDepositAmount
 				_, err := service.DepositMoney(ctx, userToUpdate, buyer.ID)
@@ -164,7 +204,7 @@ func TestUserService(t *testing.T) {
 			t.Run("deposit acceptable amount", func(t *testing.T) {
 				newDepositAmount := acceptableDepositAmountValues[rand.Intn(len(acceptableDepositAmountValues))]
 				oldDepositAmount := buyer.Deposit
-				userToUpdate := &payloads.DepositMoneyPayload{}
+				userToUpdate := &payloads.DepositMoneyPayload{MachineID: machine.ID}
 				userToUpdate.DepositAmount = newDepositAmount
 				updatedUser, err := service.DepositMoney(ctx, userToUpdate, buyer.ID)
 				if err != nil {
@@ -173,6 +213,27 @@ func TestUserService(t *testing.T) {
 				if updatedUser.Deposit != (oldDepositAmount + newDepositAmount) {
 					t.Fatalf("expected new deposit to be: %d, got: %+v", newDepositAmount, updatedUser.Deposit)
 				}
+				if updatedUser.MachineID != machine.ID {
+					t.Fatalf("expected deposit to be held by machine %s, got: %s", machine.ID, updatedUser.MachineID)
+				}
+			})
+			t.Run("deposit into another machine", func(t *testing.T) {
+				otherMachine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+				if err != nil {
+					t.Fatalf("could not create stocked machine: %+v", err)
+				}
+				userToUpdate := &payloads.DepositMoneyPayload{MachineID: otherMachine.ID}
+				userToUpdate.DepositAmount = acceptableDepositAmountValues[0]
+				if _, err := service.DepositMoney(ctx, userToUpdate, buyer.ID); err != services.ErrDepositHeldByAnotherMachine {
+					t.Fatalf("expected deposit to fail with %v, got: %+v", services.ErrDepositHeldByAnotherMachine, err)
+				}
+			})
+			t.Run("deposit into a machine that does not exist", func(t *testing.T) {
+				userToUpdate := &payloads.DepositMoneyPayload{MachineID: uuid.NewV4()}
+				userToUpdate.DepositAmount = acceptableDepositAmountValues[0]
+				if _, err := service.DepositMoney(ctx, userToUpdate, buyer.ID); err == nil {
+					t.Fatal("expected deposit into a machine that does not exist to fail, deposit was allowed")
+				}
 			})
 		})
 	})
@@ -186,8 +247,23 @@ func TestUserService(t *testing.T) {
 		}
 	})
 	t.Run("buy product", func(t *testing.T) {
+		t.Run("from a machine not holding the deposit", func(t *testing.T) {
+			otherMachine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+			if err != nil {
+				t.Fatalf("could not create stocked machine: %+v", err)
+			}
+			productPurchase := &payloads.UserProductPurchase{
+				MachineID: otherMachine.ID,
+				ProductID: product.ID,
+				Amount:    1,
+			}
+			if _, err := service.BuyProduct(ctx, productPurchase, buyer.ID); err != services.ErrDepositHeldByAnotherMachine {
+				t.Fatalf("expected purchase to fail with %v, got: %+v", services.ErrDepositHeldByAnotherMachine, err)
+			}
+		})
 		t.Run("with sufficient deposit", func(t *testing.T) {
 			productPurchase := &payloads.UserProductPurchase{
+				MachineID: machine.ID,
 				ProductID: product.ID,
 				Amount:    2,
 			}
@@ -198,6 +274,7 @@ func TestUserService(t *testing.T) {
 		})
 		t.Run("with insufficient deposit", func(t *testing.T) {
 			productPurchase := &payloads.UserProductPurchase{
+				MachineID: machine.ID,
 				ProductID: product.ID,
 				Amount:    int32(rand.Intn(999999999)),
 			}
@@ -207,6 +284,374 @@ func TestUserService(t *testing.T) {
 			}
 		})
 	})
+	t.Run("checkout", func(t *testing.T) {
+		createProduct := func(t *testing.T, cost int32) *models.Product {
+			productToCreate := &payloads.CreateProductPayload{
+				Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+				Cost: cost,
+			}
+			product, err := a.Services.Products.CreateProduct(ctx, productToCreate, seller.ID)
+			if err != nil {
+				t.Fatalf("error while creating product %+v", err)
+			}
+			return product
+		}
+		createBuyer := func(t *testing.T, deposit int32) *models.User {
+			buyer, err := service.CreateUser(ctx, &payloads.CreateUserPayload{
+				Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+				Password: "password",
+				Role:     models.UserRoleBuyer,
+				Deposit:  deposit,
+			})
+			if err != nil {
+				t.Fatalf("error while creating user %+v", err)
+			}
+			return buyer
+		}
+		soda := createProduct(t, 30)
+		chips := createProduct(t, 45)
+		checkoutMachine, err := fixture.Machine.CreateStockedMachine(seller.ID, soda, chips)
+		if err != nil {
+			t.Fatalf("could not create stocked machine: %+v", err)
+		}
+
+		t.Run("with several items", func(t *testing.T) {
+			checkoutBuyer := createBuyer(t, 100)
+			checkout := &payloads.CheckoutPayload{
+				MachineID: checkoutMachine.ID,
+				Items:     []*payloads.CheckoutItem{{ProductID: soda.ID, Amount: 1}, {ProductID: chips.ID, Amount: 1}},
+			}
+			receipt, err := service.Checkout(ctx, checkout, checkoutBuyer.ID)
+			if err != nil {
+				t.Fatalf("checkout failed: %+v", err)
+			}
+			if len(receipt.Lines) != 2 || receipt.Lines[0].ProductID != soda.ID || receipt.Lines[1].ProductID != chips.ID {
+				t.Fatalf("expected a line for every item in order, got: %+v", receipt.Lines)
+			}
+			if receipt.Total != 75 || receipt.ChangeReturned != 25 || receipt.Change.Total() != 25 {
+				t.Fatalf("expected a total of 75 and 25 change, got: %+v", receipt)
+			}
+			for i, line := range receipt.Lines {
+				if line.CheckoutID != receipt.CheckoutID {
+					t.Fatalf("expected line %d in checkout %s, got: %s", i, receipt.CheckoutID, line.CheckoutID)
+				}
+			}
+			if receipt.Lines[0].ChangeReturned != 0 || receipt.Lines[1].ChangeReturned != 25 {
+				t.Fatalf("expected the change on the last line only, got: %+v", receipt.Lines)
+			}
+		})
+		t.Run("with a bundle across items", func(t *testing.T) {
+			promotionToCreate := &payloads.PromotionPayload{
+				Name: "snack deal", Type: models.PromotionTypeBundle, ProductIDs: []uuid.UUID{soda.ID, chips.ID}, Value: 60,
+			}
+			sellerContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+			promotion, err := a.Services.Promotions.CreatePromotion(ctx, promotionToCreate, sellerContext)
+			if err != nil {
+				t.Fatalf("create promotion failed: %+v", err)
+			}
+			defer a.Services.Promotions.DeletePromotion(ctx, promotion.ID, sellerContext)
+
+			checkoutBuyer := createBuyer(t, 60)
+			checkout := &payloads.CheckoutPayload{
+				MachineID: checkoutMachine.ID,
+				Items:     []*payloads.CheckoutItem{{ProductID: soda.ID, Amount: 1}, {ProductID: chips.ID, Amount: 1}},
+			}
+			receipt, err := service.Checkout(ctx, checkout, checkoutBuyer.ID)
+			if err != nil {
+				t.Fatalf("checkout failed: %+v", err)
+			}
+			if receipt.OriginalPrice != 75 || receipt.Discount != 15 || receipt.Total != 60 || receipt.PromotionID != promotion.ID {
+				t.Fatalf("expected the bundle price of 60, got: %+v", receipt)
+			}
+		})
+		t.Run("all or nothing", func(t *testing.T) {
+			// the machine has no slot for the candy, so it can only fail once the soda is dispensed or about to be
+			candy := createProduct(t, 10)
+			checkoutBuyer := createBuyer(t, 100)
+			checkout := &payloads.CheckoutPayload{
+				MachineID: checkoutMachine.ID,
+				Items:     []*payloads.CheckoutItem{{ProductID: soda.ID, Amount: 1}, {ProductID: candy.ID, Amount: 1}},
+			}
+			if _, err := service.Checkout(ctx, checkout, checkoutBuyer.ID); err == nil {
+				t.Fatal("expected checkout to fail for a product the machine does not sell, checkout was allowed")
+			}
+			unchangedBuyer, err := service.GetUserByID(checkoutBuyer.ID)
+			if err != nil {
+				t.Fatalf("could not retreive user: %+v", err)
+			}
+			if unchangedBuyer.Deposit != 100 {
+				t.Fatalf("expected the deposit to stay 100, got: %d", unchangedBuyer.Deposit)
+			}
+			report, err := a.Services.UserProducts.GetUserBuysReport(checkoutBuyer.ID)
+			if err != nil {
+				t.Fatalf("could not retreive report: %+v", err)
+			}
+			if len(report.Purchases) != 0 {
+				t.Fatalf("expected no purchases, got: %+v", report.Purchases)
+			}
+		})
+		t.Run("with a product listed twice", func(t *testing.T) {
+			checkout := &payloads.CheckoutPayload{
+				MachineID: checkoutMachine.ID,
+				Items:     []*payloads.CheckoutItem{{ProductID: soda.ID, Amount: 1}, {ProductID: soda.ID, Amount: 2}},
+			}
+			if _, err := service.Checkout(ctx, checkout, buyer.ID); err == nil {
+				t.Fatal("expected checkout to fail with a duplicate product, checkout was allowed")
+			}
+		})
+	})
+	t.Run("refund purchase", func(t *testing.T) {
+		productToCreate := &payloads.CreateProductPayload{
+			Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Cost: 30,
+		}
+		refundProduct, err := a.Services.Products.CreateProduct(ctx, productToCreate, seller.ID)
+		if err != nil {
+			t.Fatalf("error while creating product %+v", err)
+		}
+		refundMachine, err := fixture.Machine.CreateStockedMachine(seller.ID, refundProduct)
+		if err != nil {
+			t.Fatalf("could not create stocked machine: %+v", err)
+		}
+		buyUnits := func(t *testing.T, amount int32) (*models.User, *models.Purchase) {
+			refundBuyer, err := service.CreateUser(ctx, &payloads.CreateUserPayload{
+				Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+				Password: "password",
+				Role:     models.UserRoleBuyer,
+				Deposit:  refundProduct.Cost * amount,
+			})
+			if err != nil {
+				t.Fatalf("error while creating user %+v", err)
+			}
+			productPurchase := &payloads.UserProductPurchase{MachineID: refundMachine.ID, ProductID: refundProduct.ID, Amount: amount}
+			report, err := service.BuyProduct(ctx, productPurchase, refundBuyer.ID)
+			if err != nil {
+				t.Fatalf("buy product failed: %+v", err)
+			}
+			return refundBuyer, report.Purchases[0]
+		}
+		sellerContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+		admin, err := fixture.User.CreateAdminUser()
+		if err != nil {
+			t.Fatalf("could not create admin: %+v", err)
+		}
+		adminContext := auth.UserContext{ID: admin.ID, Role: models.UserRoleAdmin}
+
+		t.Run("in parts", func(t *testing.T) {
+			refundBuyer, purchase := buyUnits(t, 3)
+			receipt, err := service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{Quantity: 1, Reason: "jammed"}, sellerContext)
+			if err != nil {
+				t.Fatalf("refund purchase failed: %+v", err)
+			}
+			if receipt.Refund.RefundOf != purchase.ID || receipt.Refund.Quantity != -1 || receipt.Refund.Total != -30 {
+				t.Fatalf("expected a refund of one unit of the purchase, got: %+v", receipt.Refund)
+			}
+			if receipt.Restocked != 1 || receipt.DepositCredited != 30 {
+				t.Fatalf("expected one unit restocked and 30 credited, got: %+v", receipt)
+			}
+			creditedBuyer, err := service.GetUserByID(refundBuyer.ID)
+			if err != nil {
+				t.Fatalf("could not retreive user: %+v", err)
+			}
+			if creditedBuyer.Deposit != 30 || creditedBuyer.MachineID != refundMachine.ID {
+				t.Fatalf("expected a deposit of 30 held by the machine, got: %+v", creditedBuyer)
+			}
+
+			receipt, err = service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{}, adminContext)
+			if err != nil {
+				t.Fatalf("refund purchase failed: %+v", err)
+			}
+			if receipt.Refund.Quantity != -2 || receipt.Refund.Total != -60 {
+				t.Fatalf("expected a refund of the remaining two units, got: %+v", receipt.Refund)
+			}
+			if _, err := service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{}, adminContext); err != services.ErrPurchaseRefunded {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrPurchaseRefunded, err)
+			}
+			if _, err := service.RefundPurchase(ctx, receipt.Refund.ID, &payloads.RefundPurchasePayload{}, adminContext); err != services.ErrRefundNotRefundable {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrRefundNotRefundable, err)
+			}
+
+			report, err := a.Services.UserProducts.GetUserBuysReport(refundBuyer.ID)
+			if err != nil {
+				t.Fatalf("could not retreive report: %+v", err)
+			}
+			if report.AmountSpent != 0 {
+				t.Fatalf("expected nothing spent after the refunds, got: %d", report.AmountSpent)
+			}
+		})
+		t.Run("more than was bought", func(t *testing.T) {
+			_, purchase := buyUnits(t, 1)
+			if _, err := service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{Quantity: 2}, sellerContext); err != services.ErrRefundQuantity {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrRefundQuantity, err)
+			}
+		})
+		t.Run("by the buyer", func(t *testing.T) {
+			refundBuyer, purchase := buyUnits(t, 1)
+			buyerContext := auth.UserContext{ID: refundBuyer.ID, Role: models.UserRoleBuyer}
+			otherBuyerContext := auth.UserContext{ID: buyer.ID, Role: models.UserRoleBuyer}
+			if _, err := service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{}, otherBuyerContext); err != db.ErrUserForbidden {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrUserForbidden, err)
+			}
+			if _, err := service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{}, buyerContext); err != nil {
+				t.Fatalf("expected the buyer to refund within the refund window, got: %+v", err)
+			}
+		})
+		t.Run("with the deposit in another machine", func(t *testing.T) {
+			refundBuyer, purchase := buyUnits(t, 1)
+			otherMachine, err := fixture.Machine.CreateStockedMachine(seller.ID, refundProduct)
+			if err != nil {
+				t.Fatalf("could not create stocked machine: %+v", err)
+			}
+			if _, err := service.DepositMoney(ctx, &payloads.DepositMoneyPayload{MachineID: otherMachine.ID, DepositAmount: acceptableDepositAmountValues[0]}, refundBuyer.ID); err != nil {
+				t.Fatalf("deposit money failed: %+v", err)
+			}
+			receipt, err := service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{}, sellerContext)
+			if err != nil {
+				t.Fatalf("refund purchase failed: %+v", err)
+			}
+			if receipt.DepositCredited != 0 || receipt.Refund.ChangeOwed != refundProduct.Cost {
+				t.Fatalf("expected the refund to be owed as change, got: %+v, %+v", receipt, receipt.Refund)
+			}
+		})
+	})
+	t.Run("vend purchase", func(t *testing.T) {
+		productToCreate := &payloads.CreateProductPayload{
+			Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Cost: 20,
+		}
+		vendProduct, err := a.Services.Products.CreateProduct(ctx, productToCreate, seller.ID)
+		if err != nil {
+			t.Fatalf("error while creating product %+v", err)
+		}
+		vendMachine, err := fixture.Machine.CreateMachine(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create machine: %+v", err)
+		}
+		if _, err := fixture.Machine.StockProduct(vendMachine, "A1", vendProduct.ID, 10); err != nil {
+			t.Fatalf("could not stock product: %+v", err)
+		}
+		reserve := func(t *testing.T) (*models.User, *models.Purchase) {
+			vendBuyer, err := service.CreateUser(ctx, &payloads.CreateUserPayload{
+				Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+				Password: "password",
+				Role:     models.UserRoleBuyer,
+				Deposit:  vendProduct.Cost,
+			})
+			if err != nil {
+				t.Fatalf("error while creating user %+v", err)
+			}
+			productPurchase := &payloads.UserProductPurchase{MachineID: vendMachine.ID, ProductID: vendProduct.ID, Amount: 1}
+			report, err := service.BuyProduct(ctx, productPurchase, vendBuyer.ID)
+			if err != nil {
+				t.Fatalf("buy product failed: %+v", err)
+			}
+			if report.Purchases[0].Status != models.PurchaseStatusReserved {
+				t.Fatalf("expected the purchase to be reserved, got: %+v", report.Purchases[0])
+			}
+			return vendBuyer, report.Purchases[0]
+		}
+		slotQuantity := func(t *testing.T) int32 {
+			stockedMachine, err := a.Services.Machines.GetMachineByID(vendMachine.ID)
+			if err != nil {
+				t.Fatalf("could not retreive machine: %+v", err)
+			}
+			return stockedMachine.Slots[0].Quantity
+		}
+		sellerContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+
+		t.Run("dispense and confirm", func(t *testing.T) {
+			_, purchase := reserve(t)
+			dispensed, err := service.DispensePurchase(ctx, purchase.ID, sellerContext)
+			if err != nil {
+				t.Fatalf("dispense purchase failed: %+v", err)
+			}
+			if dispensed.Status != models.PurchaseStatusDispensing {
+				t.Fatalf("expected the purchase to be dispensing, got: %+v", dispensed)
+			}
+			if _, err := service.DispensePurchase(ctx, purchase.ID, sellerContext); err != services.ErrPurchaseTransition {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrPurchaseTransition, err)
+			}
+			confirmed, err := service.ConfirmPurchase(ctx, purchase.ID, sellerContext)
+			if err != nil {
+				t.Fatalf("confirm purchase failed: %+v", err)
+			}
+			if confirmed.Status != models.PurchaseStatusCompleted {
+				t.Fatalf("expected the purchase to be completed, got: %+v", confirmed)
+			}
+		})
+		t.Run("confirm reserved", func(t *testing.T) {
+			_, purchase := reserve(t)
+			if _, err := service.ConfirmPurchase(ctx, purchase.ID, sellerContext); err != nil {
+				t.Fatalf("confirm purchase failed: %+v", err)
+			}
+			if _, err := service.FailPurchase(ctx, purchase.ID, &payloads.FailPurchasePayload{}, sellerContext); err != services.ErrPurchaseTransition {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrPurchaseTransition, err)
+			}
+		})
+		t.Run("by another seller", func(t *testing.T) {
+			_, purchase := reserve(t)
+			otherSeller, err := fixture.User.CreateSellerUser()
+			if err != nil {
+				t.Fatalf("could not create seller: %+v", err)
+			}
+			otherSellerContext := auth.UserContext{ID: otherSeller.ID, Role: models.UserRoleSeller}
+			if _, err := service.ConfirmPurchase(ctx, purchase.ID, otherSellerContext); err != db.ErrUserForbidden {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrUserForbidden, err)
+			}
+		})
+		t.Run("dispense and fail", func(t *testing.T) {
+			vendBuyer, purchase := reserve(t)
+			stocked := slotQuantity(t)
+			if _, err := service.DispensePurchase(ctx, purchase.ID, sellerContext); err != nil {
+				t.Fatalf("dispense purchase failed: %+v", err)
+			}
+			receipt, err := service.FailPurchase(ctx, purchase.ID, &payloads.FailPurchasePayload{Reason: "motor stalled"}, sellerContext)
+			if err != nil {
+				t.Fatalf("fail purchase failed: %+v", err)
+			}
+			if receipt.Purchase.Status != models.PurchaseStatusFailed || receipt.Refund.RefundOf != purchase.ID || receipt.Refund.Reason != "motor stalled" {
+				t.Fatalf("expected the failed purchase to be reversed, got: %+v, %+v", receipt.Purchase, receipt.Refund)
+			}
+			if slotQuantity(t) != stocked+1 {
+				t.Fatalf("expected the unit back in the slot, got: %d, had: %d", slotQuantity(t), stocked)
+			}
+			creditedBuyer, err := service.GetUserByID(vendBuyer.ID)
+			if err != nil {
+				t.Fatalf("could not retreive user: %+v", err)
+			}
+			if creditedBuyer.Deposit != vendProduct.Cost || creditedBuyer.MachineID != vendMachine.ID {
+				t.Fatalf("expected the price credited to the deposit, got: %+v", creditedBuyer)
+			}
+			if _, err := service.ConfirmPurchase(ctx, purchase.ID, sellerContext); err != services.ErrPurchaseTransition {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrPurchaseTransition, err)
+			}
+		})
+		t.Run("fail refunded", func(t *testing.T) {
+			_, purchase := reserve(t)
+			if _, err := service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{}, sellerContext); err != nil {
+				t.Fatalf("refund purchase failed: %+v", err)
+			}
+			receipt, err := service.FailPurchase(ctx, purchase.ID, &payloads.FailPurchasePayload{}, sellerContext)
+			if err != nil {
+				t.Fatalf("fail purchase failed: %+v", err)
+			}
+			if receipt.Purchase.Status != models.PurchaseStatusFailed || receipt.Refund != nil {
+				t.Fatalf("expected the purchase to fail without another refund, got: %+v, %+v", receipt.Purchase, receipt.Refund)
+			}
+		})
+		t.Run("confirm refunded", func(t *testing.T) {
+			_, purchase := reserve(t)
+			if _, err := service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{}, sellerContext); err != nil {
+				t.Fatalf("refund purchase failed: %+v", err)
+			}
+			if _, err := service.DispensePurchase(ctx, purchase.ID, sellerContext); err != services.ErrPurchaseRefunded {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrPurchaseRefunded, err)
+			}
+			if _, err := service.ConfirmPurchase(ctx, purchase.ID, sellerContext); err != services.ErrPurchaseRefunded {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrPurchaseRefunded, err)
+			}
+		})
+	})
 	t.Run("update user", func(t *testing.T) {
 		t.Run("with basic attributes", func(t *testing.T) {
 			userToUpdate := &payloads.UpdateUserPayload{}
@@ -235,13 +680,415 @@ func TestUserService(t *testing.T) {
 		})
 	})
 
+	t.Run("disable user", func(t *testing.T) {
+		userToCreate := &payloads.CreateUserPayload{
+			Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Password: "password",
+			Role:     models.UserRoleBuyer,
+		}
+		userToDisable, err := service.CreateUser(ctx, userToCreate)
+		if err != nil {
+			t.Fatalf("error while creating user %+v", err)
+		}
+		loginPayload := &payloads.LoginUserPayload{Username: userToCreate.Username, Password: userToCreate.Password}
+
+		t.Run("disable", func(t *testing.T) {
+			disabledUser, err := service.SetUserDisabled(ctx, userToDisable.ID, true)
+			if err != nil {
+				t.Fatalf("disable user failed: %+v", err)
+			}
+			if !disabledUser.IsDisabled() {
+				t.Fatalf("expected user to be disabled, got: %+v", disabledUser)
+			}
+			if _, err := service.LoginUser(ctx, loginPayload); err != services.ErrUserDisabled {
+				t.Fatalf("expected error %+v on login, got: %+v", services.ErrUserDisabled, err)
+			}
+		})
+		t.Run("enable", func(t *testing.T) {
+			enabledUser, err := service.SetUserDisabled(ctx, userToDisable.ID, false)
+			if err != nil {
+				t.Fatalf("enable user failed: %+v", err)
+			}
+			if enabledUser.IsDisabled() {
+				t.Fatalf("expected user to be enabled, got: %+v", enabledUser)
+			}
+			if _, err := service.LoginUser(ctx, loginPayload); err != nil {
+				t.Fatalf("expected enabled user to log in, got: %+v", err)
+			}
+		})
+		t.Run("non existing user", func(t *testing.T) {
+			if _, err := service.SetUserDisabled(ctx, uuid.NewV4(), true); err != db.ErrNoMatch {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+			}
+		})
+	})
+
+	t.Run("update user role", func(t *testing.T) {
+		userToPromote, err := fixture.User.CreateBuyerUser()
+		if err != nil {
+			t.Fatalf("could not create buyer: %+v", err)
+		}
+		t.Run("with invalid role", func(t *testing.T) {
+			if _, err := service.UpdateUserRole(ctx, userToPromote.ID, &payloads.UpdateUserRolePayload{Role: "operator"}); err == nil {
+				t.Fatal("expected invalid role to be rejected")
+			}
+		})
+		t.Run("to admin", func(t *testing.T) {
+			promotedUser, err := service.UpdateUserRole(ctx, userToPromote.ID, &payloads.UpdateUserRolePayload{Role: models.UserRoleAdmin})
+			if err != nil {
+				t.Fatalf("update user role failed: %+v", err)
+			}
+			if promotedUser.Role != models.UserRoleAdmin {
+				t.Fatalf("expected role %s, got: %s", models.UserRoleAdmin, promotedUser.Role)
+			}
+		})
+	})
+
 	t.Run("delete user", func(t *testing.T) {
+		t.Run("another user", func(t *testing.T) {
+			err := service.DeleteUser(ctx, seller.ID, userContextOf(t, a, buyer))
+			if err != db.ErrUserForbidden {
+				t.Fatalf("expected error %+v, got: %+v", db.ErrUserForbidden, err)
+			}
+		})
+		t.Run("with sales", func(t *testing.T) {
+			err := service.DeleteUser(ctx, seller.ID, userContextOf(t, a, seller))
+			if err != services.ErrUserHasPurchases {
+				t.Fatalf("expected error %+v, got: %+v", services.ErrUserHasPurchases, err)
+			}
+		})
 		t.Run("existing user", func(t *testing.T) {
-			err := service.DeleteUser(ctx, seller.ID)
+			userToDelete, err := fixture.User.CreateSellerUser()
+			if err != nil {
+				t.Fatalf("could not create seller: %+v", err)
+			}
+			if err := service.DeleteUser(ctx, userToDelete.ID, userContextOf(t, a, userToDelete)); err != nil {
+				t.Fatalf("delete user failed: %+v", err)
+			}
+		})
+		t.Run("another user as admin", func(t *testing.T) {
+			admin, err := fixture.User.CreateAdminUser()
 			if err != nil {
+				t.Fatalf("could not create admin: %+v", err)
+			}
+			userToDelete, err := fixture.User.CreateBuyerUser()
+			if err != nil {
+				t.Fatalf("could not create buyer: %+v", err)
+			}
+			if err := service.DeleteUser(ctx, userToDelete.ID, userContextOf(t, a, admin)); err != nil {
 				t.Fatalf("delete user failed: %+v", err)
 			}
 		})
 	})
 
 }
+
+// TestUserServiceExpiredWindows runs on an app without a refund window or a vend reservation TTL, so purchases are
+// past both as soon as they are made
+func TestUserServiceExpiredWindows(t *testing.T) {
+	t.Parallel()
+	a, fixture := newConfiguredTestApp(t, func(cfg *config.Config) {
+		cfg.RefundWindow = 0
+		cfg.VendReservationTTL = 0
+	})
+
+	service := a.Services.Users
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	sellerContext := auth.UserContext{ID: seller.ID, Role: models.UserRoleSeller}
+	ctx := context.Background()
+
+	t.Run("refund by the buyer", func(t *testing.T) {
+		product, err := a.Services.Products.CreateProduct(ctx, &payloads.CreateProductPayload{Name: "Refunded", Cost: 30}, seller.ID)
+		if err != nil {
+			t.Fatalf("error while creating product %+v", err)
+		}
+		machine, err := fixture.Machine.CreateStockedMachine(seller.ID, product)
+		if err != nil {
+			t.Fatalf("could not create stocked machine: %+v", err)
+		}
+		refundBuyer, err := service.CreateUser(ctx, &payloads.CreateUserPayload{
+			Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Password: "password",
+			Role:     models.UserRoleBuyer,
+			Deposit:  product.Cost,
+		})
+		if err != nil {
+			t.Fatalf("error while creating user %+v", err)
+		}
+		report, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, refundBuyer.ID)
+		if err != nil {
+			t.Fatalf("could not create purchase: %+v", err)
+		}
+		purchase := report.Purchases[0]
+
+		buyerContext := auth.UserContext{ID: refundBuyer.ID, Role: models.UserRoleBuyer}
+		if _, err := service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{}, buyerContext); err != services.ErrRefundWindowExpired {
+			t.Fatalf("expected error %+v, got: %+v", services.ErrRefundWindowExpired, err)
+		}
+		if _, err := service.RefundPurchase(ctx, purchase.ID, &payloads.RefundPurchasePayload{}, sellerContext); err != nil {
+			t.Fatalf("expected the seller to refund after the refund window, got: %+v", err)
+		}
+	})
+	t.Run("expire reservation", func(t *testing.T) {
+		product, err := a.Services.Products.CreateProduct(ctx, &payloads.CreateProductPayload{Name: "Reserved", Cost: 20}, seller.ID)
+		if err != nil {
+			t.Fatalf("error while creating product %+v", err)
+		}
+		machine, err := fixture.Machine.CreateMachine(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create machine: %+v", err)
+		}
+		if _, err := fixture.Machine.StockProduct(machine, "A1", product.ID, 10); err != nil {
+			t.Fatalf("could not stock product: %+v", err)
+		}
+		vendBuyer, err := service.CreateUser(ctx, &payloads.CreateUserPayload{
+			Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Password: "password",
+			Role:     models.UserRoleBuyer,
+			Deposit:  product.Cost,
+		})
+		if err != nil {
+			t.Fatalf("error while creating user %+v", err)
+		}
+		report, err := fixture.Purchase.CreatePurchase(machine.ID, product.ID, vendBuyer.ID)
+		if err != nil {
+			t.Fatalf("could not create purchase: %+v", err)
+		}
+		purchase := report.Purchases[0]
+		if purchase.Status != models.PurchaseStatusReserved {
+			t.Fatalf("expected the purchase to be reserved, got: %+v", purchase)
+		}
+
+		expired, err := service.ExpireReservations(ctx)
+		if err != nil {
+			t.Fatalf("expire reservations failed: %+v", err)
+		}
+		if expired == 0 {
+			t.Fatal("expected the stale reservation to expire")
+		}
+		expiredPurchase, err := a.Services.Purchases.GetPurchaseByID(purchase.ID)
+		if err != nil {
+			t.Fatalf("could not retreive purchase: %+v", err)
+		}
+		stockedMachine, err := a.Services.Machines.GetMachineByID(machine.ID)
+		if err != nil {
+			t.Fatalf("could not retreive machine: %+v", err)
+		}
+		if expiredPurchase.Status != models.PurchaseStatusFailed || stockedMachine.Slots[0].Quantity != 10 {
+			t.Fatalf("expected the reservation to fail and return its stock, got: %+v", expiredPurchase)
+		}
+	})
+}
+
+// TestUserServiceConcurrentBuys only runs on Postgres, since the other stores run one transaction at a time and would
+// never oversell even without the row locks it tests
+func TestUserServiceConcurrentBuys(t *testing.T) {
+	dbtest.SkipUnlessPostgres(t)
+	t.Parallel()
+	a, fixture := newTestApp(t)
+
+	service := a.Services.Users
+	productService := a.Services.Products
+	purchaseService := a.Services.Purchases
+	machineService := a.Services.Machines
+	seller, err := fixture.User.CreateSellerUser()
+	if err != nil {
+		t.Fatalf("could not create seller: %+v", err)
+	}
+	ctx := context.Background()
+
+	const stock = 50
+	const buyers = 200
+	productToCreate := &payloads.CreateProductPayload{
+		Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+		Cost: 25,
+	}
+	product, err := productService.CreateProduct(ctx, productToCreate, seller.ID)
+	if err != nil {
+		t.Fatalf("error while creating product %+v", err)
+	}
+	machine, err := fixture.Machine.CreateMachine(seller.ID)
+	if err != nil {
+		t.Fatalf("could not create machine: %+v", err)
+	}
+	if _, err := fixture.Machine.StockProduct(machine, "A1", product.ID, stock); err != nil {
+		t.Fatalf("could not stock product: %+v", err)
+	}
+
+	t.Run("many buyers never oversell stock", func(t *testing.T) {
+		buyerIDs := make([]uuid.UUID, buyers)
+		for i := range buyerIDs {
+			// the deposit pays for exactly one product, so no change has to be paid out
+			userToCreate := &payloads.CreateUserPayload{
+				Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+				Password: "password",
+				Role:     models.UserRoleBuyer,
+				Deposit:  product.Cost,
+			}
+			buyer, err := service.CreateUser(ctx, userToCreate)
+			if err != nil {
+				t.Fatalf("error while creating user %+v", err)
+			}
+			buyerIDs[i] = buyer.ID
+		}
+
+		var wg sync.WaitGroup
+		var succeeded int32
+		for _, buyerID := range buyerIDs {
+			wg.Add(1)
+			go func(buyerID uuid.UUID) {
+				defer wg.Done()
+				productPurchase := &payloads.UserProductPurchase{MachineID: machine.ID, ProductID: product.ID, Amount: 1}
+				if _, err := service.BuyProduct(ctx, productPurchase, buyerID); err == nil {
+					atomic.AddInt32(&succeeded, 1)
+				}
+			}(buyerID)
+		}
+		wg.Wait()
+
+		if succeeded != stock {
+			t.Fatalf("expected exactly %d purchases to succeed, got %d", stock, succeeded)
+		}
+		updatedMachine, err := machineService.GetMachineByID(machine.ID)
+		if err != nil {
+			t.Fatalf("could not retreive machine: %+v", err)
+		}
+		if updatedMachine.Slots[0].Quantity != 0 {
+			t.Fatalf("expected product to be sold out, got quantity: %d", updatedMachine.Slots[0].Quantity)
+		}
+		sales, err := purchaseService.GetPurchasesBySellerID(seller.ID)
+		if err != nil {
+			t.Fatalf("could not retreive sales: %+v", err)
+		}
+		if len(sales) != stock {
+			t.Fatalf("expected %d sales in the ledger, got %d", stock, len(sales))
+		}
+		for _, buyerID := range buyerIDs {
+			buyer, err := service.GetUserByID(buyerID)
+			if err != nil {
+				t.Fatalf("could not retreive buyer: %+v", err)
+			}
+			if buyer.Deposit < 0 {
+				t.Fatalf("expected deposit not to be negative, got %d", buyer.Deposit)
+			}
+		}
+	})
+
+	t.Run("one buyer never overspends a deposit", func(t *testing.T) {
+		productToCreate := &payloads.CreateProductPayload{
+			Name: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Cost: 25,
+		}
+		product, err := productService.CreateProduct(ctx, productToCreate, seller.ID)
+		if err != nil {
+			t.Fatalf("error while creating product %+v", err)
+		}
+		machine, err := fixture.Machine.CreateMachine(seller.ID)
+		if err != nil {
+			t.Fatalf("could not create machine: %+v", err)
+		}
+		if _, err := fixture.Machine.StockProduct(machine, "A1", product.ID, buyers); err != nil {
+			t.Fatalf("could not stock product: %+v", err)
+		}
+		userToCreate := &payloads.CreateUserPayload{
+			Username: strings.Replace(uuid.NewV4().String(), "-", "_", -1)[0:18],
+			Password: "password",
+			Role:     models.UserRoleBuyer,
+			Deposit:  product.Cost,
+		}
+		buyer, err := service.CreateUser(ctx, userToCreate)
+		if err != nil {
+			t.Fatalf("error while creating user %+v", err)
+		}
+
+		var wg sync.WaitGroup
+		var succeeded int32
+		for i := 0; i < buyers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				productPurchase := &payloads.UserProductPurchase{MachineID: machine.ID, ProductID: product.ID, Amount: 1}
+				if _, err := service.BuyProduct(ctx, productPurchase, buyer.ID); err == nil {
+					atomic.AddInt32(&succeeded, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if succeeded != 1 {
+			t.Fatalf("expected the deposit to pay for exactly 1 purchase, got %d", succeeded)
+		}
+		updatedBuyer, err := service.GetUserByID(buyer.ID)
+		if err != nil {
+			t.Fatalf("could not retreive buyer: %+v", err)
+		}
+		if updatedBuyer.Deposit != 0 {
+			t.Fatalf("expected deposit to be spent, got %d", updatedBuyer.Deposit)
+		}
+		updatedMachine, err := machineService.GetMachineByID(machine.ID)
+		if err != nil {
+			t.Fatalf("could not retreive machine: %+v", err)
+		}
+		if updatedMachine.Slots[0].Quantity != buyers-1 {
+			t.Fatalf("expected quantity to be %d, got %d", buyers-1, updatedMachine.Slots[0].Quantity)
+		}
+	})
+}
+
+func TestUserServiceWithMemoryStore(t *testing.T) {
+	t.Parallel()
+	a, _ := newTestApp(t)
+	store := a.Store
+	service := a.Services.Users
+	ctx := context.Background()
+
+	buyer := &models.User{ID: uuid.NewV4(), Username: "buyer", Role: models.UserRoleBuyer, Deposit: 20}
+	seller := &models.User{ID: uuid.NewV4(), Username: "seller", Role: models.UserRoleSeller}
+	for _, user := range []*models.User{buyer, seller} {
+		if err := store.Users().Insert(user); err != nil {
+			t.Fatalf("error while inserting user %+v", err)
+		}
+	}
+
+	t.Run("get all users", func(t *testing.T) {
+		userList, err := service.GetAllUsers(&payloads.UserFilter{ListParams: payloads.ListParams{Limit: 1}})
+		if err != nil {
+			t.Fatalf("error while getting all users %+v", err)
+		}
+		if userList.Total != 2 || len(userList.Users) != 1 || userList.NextCursor == "" {
+			t.Fatalf("expected the first page of 2 users, got: %+v", userList)
+		}
+	})
+	t.Run("update user", func(t *testing.T) {
+		updateUser := &payloads.UpdateUserPayload{ID: buyer.ID, Username: "renamed buyer"}
+		updatedUser, err := service.UpdateUser(ctx, updateUser)
+		if err != nil {
+			t.Fatalf("update user failed: %+v", err)
+		}
+		if updatedUser.Username != updateUser.Username || updatedUser.Deposit != buyer.Deposit {
+			t.Fatalf("expected only the username to change, got: %+v", updatedUser)
+		}
+	})
+	t.Run("update user to a taken username", func(t *testing.T) {
+		_, err := service.UpdateUser(ctx, &payloads.UpdateUserPayload{ID: buyer.ID, Username: seller.Username})
+		if err != repositories.ErrConflict {
+			t.Fatalf("expected error %+v, got: %+v", repositories.ErrConflict, err)
+		}
+		user, _ := service.GetUserByID(buyer.ID)
+		if user.Username == seller.Username {
+			t.Fatalf("expected the failed update to be rolled back, got: %+v", user)
+		}
+	})
+	t.Run("delete user", func(t *testing.T) {
+		err := service.DeleteUser(ctx, seller.ID, auth.UserContext{ID: seller.ID, Role: seller.Role})
+		if err != nil {
+			t.Fatalf("delete user failed: %+v", err)
+		}
+		if _, err := service.GetUserByUsername(seller.Username); err != db.ErrNoMatch {
+			t.Fatalf("expected error %+v, got: %+v", db.ErrNoMatch, err)
+		}
+	})
+}